@@ -0,0 +1,113 @@
+// ethtool parser a-la ethtool -S
+
+// The driver specific stats are retrieved via the SIOCETHTOOL ioctl, since the
+// ethtool netlink family exposes only the standard (IEEE 802.3, RMON, etc)
+// groups and not the driver private counters, such as rx_missed_errors or the
+// per queue ones. The data is presented as slices of the stats selected by a
+// regex on their names, which allows for metrics generation in a loop.
+
+package ethtool
+
+import (
+	"net"
+	"regexp"
+	"time"
+)
+
+const (
+	// How often to refresh the Interface index -> name cache:
+	ETHTOOL_IF_INDEX_TO_NAME_CACHE_REFRESH_INTERVAL = 60 * time.Second
+)
+
+type EthtoolIfStats struct {
+	IfName string
+	// The names of the selected stats:
+	Names []string
+	// The values of the selected stats, in the same order as Names:
+	Stats []uint64
+	// The indexes of the selected stats in the full list returned by the
+	// driver:
+	indexes []int
+	// The number of stats in the full list, used to detect changes to the
+	// stats set, e.g. after the number of queues was changed:
+	nStats uint32
+	// Scan number used to identify out of scope interfaces:
+	scanNum int
+}
+
+// EthtoolStats object will be used for metrics generation as a current,
+// previous tandem. The following information will be shared by both members;
+// normally the access should be protected by a lock but since only one member
+// is used at a time, the lock can be skipped.
+type EthtoolStatsShared struct {
+	// Scan number used to identify out of scope interfaces; incremented w/
+	// every call, interfaces that have scan#(I/F) != scan#, will be removed:
+	scanNum *int
+
+	// Interface index -> name cache, refreshed periodically:
+	ifIndexToNameCache            map[uint32]string
+	ifIndexToNameCacheLastRefresh time.Time
+
+	// Interfaces that should be skipped until the next cache refresh, either
+	// because they have no driver stats support (e.g. lo, virtual devices) or
+	// because no stat was selected:
+	skipIfIndex map[uint32]bool
+
+	// The regex used for selecting the stats by name, nil for all:
+	statNameRegex *regexp.Regexp
+
+	// The socket used for ioctl, however since the package that uses it may be
+	// OS specific, use an unspecified type here:
+	sock any
+
+	// Buffers used for the ioctl data, grown as needed:
+	stringsBuf, statsBuf []byte
+
+	// The following are needed for testing only. Left to their default
+	// values, the usual functions will be used:
+	interfacesFn    func() ([]net.Interface, error)
+	drvinfoNStatsFn func(fd int, ifName string) (uint32, error)
+	ioctlFn         func(fd int, ifName string, data []byte) error
+}
+
+type EthtoolStats struct {
+	// Map stats by interface index, since it is unique:
+	Info map[uint32]*EthtoolIfStats
+
+	// Shared info:
+	shared *EthtoolStatsShared
+}
+
+func NewEthtoolStats(statNameRegex *regexp.Regexp) *EthtoolStats {
+	return &EthtoolStats{
+		Info: make(map[uint32]*EthtoolIfStats),
+		shared: &EthtoolStatsShared{
+			ifIndexToNameCache: make(map[uint32]string),
+			skipIfIndex:        make(map[uint32]bool),
+			statNameRegex:      statNameRegex,
+			scanNum:            new(int),
+		},
+	}
+}
+
+func (es *EthtoolStats) Clone() *EthtoolStats {
+	newEs := &EthtoolStats{
+		Info:   make(map[uint32]*EthtoolIfStats),
+		shared: es.shared,
+	}
+
+	// Names and indexes are replaced, rather than updated, when the stats set
+	// changes, so they can be shared:
+	for ifIndex, ifStats := range es.Info {
+		newEs.Info[ifIndex] = &EthtoolIfStats{
+			IfName:  ifStats.IfName,
+			Names:   ifStats.Names,
+			Stats:   make([]uint64, len(ifStats.Stats)),
+			indexes: ifStats.indexes,
+			nStats:  ifStats.nStats,
+			scanNum: ifStats.scanNum,
+		}
+	}
+
+	return newEs
+}
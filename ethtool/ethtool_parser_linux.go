@@ -0,0 +1,274 @@
+// ethtool parser a-la ethtool -S
+
+// References:
+//  https://github.com/torvalds/linux/blob/v6.8/include/uapi/linux/ethtool.h
+//  https://github.com/torvalds/linux/blob/v6.8/net/ethtool/ioctl.c
+
+//go:build linux
+
+package ethtool
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+	"unsafe"
+
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// The string set for the driver stats, enum ethtool_stringset:
+	ETH_SS_STATS = 1
+
+	// The length of a stat name, including the terminating 0:
+	ETH_GSTRING_LEN = 32
+
+	// The size of the header for struct ethtool_gstrings (cmd, string_set,
+	// len) and struct ethtool_stats (cmd, n_stats):
+	ETHTOOL_GSTRINGS_HEADER_SIZE = 12
+	ETHTOOL_GSTATS_HEADER_SIZE   = 8
+
+	// The kernel ignores the count passed w/ ETHTOOL_GSTRINGS and
+	// ETHTOOL_GSTATS and it copies as many items as the driver currently
+	// reports, which may have grown since ETHTOOL_GDRVINFO, e.g. following
+	// `ethtool -L`. The buffers are therefore allocated w/ headroom, for
+	// FACTOR * N_STATS + SLACK items:
+	ETHTOOL_N_STATS_HEADROOM_FACTOR = 2
+	ETHTOOL_N_STATS_HEADROOM_SLACK  = 256
+)
+
+var EthtoolAvailable = true
+
+// struct ifreq w/ the ifr_data member of the union, see
+// golang.org/x/sys/unix/ifreq_linux.go ifreqData:
+type ethtoolIfreq struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer
+	// Pad to the same size as ifreq:
+	_ [unsafe.Sizeof(unix.Ifreq{}) - unix.IFNAMSIZ - unix.SizeofPtr]byte
+}
+
+func ethtoolIoctl(fd int, ifName string, data []byte) error {
+	ifr := ethtoolIfreq{data: unsafe.Pointer(&data[0])}
+	copy(ifr.name[:unix.IFNAMSIZ-1], ifName)
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func ethtoolDrvinfoNStats(fd int, ifName string) (uint32, error) {
+	drvinfo, err := unix.IoctlGetEthtoolDrvinfo(fd, ifName)
+	if err != nil {
+		return 0, err
+	}
+	return drvinfo.N_stats, nil
+}
+
+// The number of items, including the headroom, for a given number of stats:
+func ethtoolHeadroomNStats(nStats uint32) int {
+	return ETHTOOL_N_STATS_HEADROOM_FACTOR*int(nStats) + ETHTOOL_N_STATS_HEADROOM_SLACK
+}
+
+// Ensure that the buffer has at least the required size:
+func ethtoolBuf(buf []byte, size int) []byte {
+	if cap(buf) < size {
+		return make([]byte, size)
+	}
+	buf = buf[:size]
+	clear(buf)
+	return buf
+}
+
+// Select the stats based on their names, as returned by ETHTOOL_GSTRINGS, w/o
+// the header; return the selected names and their indexes:
+func selectStatNames(strings []byte, nStats int, statNameRegex *regexp.Regexp) ([]string, []int) {
+	names, indexes := make([]string, 0), make([]int, 0)
+	for i := 0; i < nStats; i++ {
+		off := i * ETH_GSTRING_LEN
+		name := strings[off : off+ETH_GSTRING_LEN]
+		if eos := bytes.IndexByte(name, 0); eos >= 0 {
+			name = name[:eos]
+		}
+		if statNameRegex == nil || statNameRegex.Match(name) {
+			names = append(names, string(name))
+			indexes = append(indexes, i)
+		}
+	}
+	return names, indexes
+}
+
+func (es *EthtoolStats) ifIndexToNameCacheRefresh() error {
+	interfacesFn := net.Interfaces
+	if es.shared.interfacesFn != nil {
+		interfacesFn = es.shared.interfacesFn
+	}
+	ifas, err := interfacesFn()
+	if err != nil {
+		return err
+	}
+	esShared := es.shared
+
+	clear(esShared.ifIndexToNameCache)
+	clear(esShared.skipIfIndex)
+	for _, ifa := range ifas {
+		if ifa.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		esShared.ifIndexToNameCache[uint32(ifa.Index)] = ifa.Name
+	}
+	esShared.ifIndexToNameCacheLastRefresh = time.Now()
+	return nil
+}
+
+// Retrieve the names of the stats and select them based on the regex:
+func (es *EthtoolStats) updateNames(fd int, ifStats *EthtoolIfStats) error {
+	esShared := es.shared
+	ioctlFn := ethtoolIoctl
+	if esShared.ioctlFn != nil {
+		ioctlFn = esShared.ioctlFn
+	}
+
+	nStats := ifStats.nStats
+	esShared.stringsBuf = ethtoolBuf(
+		esShared.stringsBuf,
+		ETHTOOL_GSTRINGS_HEADER_SIZE+ethtoolHeadroomNStats(nStats)*ETH_GSTRING_LEN,
+	)
+	buf := esShared.stringsBuf
+	nlenc.PutUint32(buf[0:4], unix.ETHTOOL_GSTRINGS)
+	nlenc.PutUint32(buf[4:8], ETH_SS_STATS)
+	nlenc.PutUint32(buf[8:12], nStats)
+	err := ioctlFn(fd, ifStats.IfName, buf)
+	if err != nil {
+		return err
+	}
+	// A different count, within the headroom or not, means that the stats set
+	// changed in the meantime:
+	if n := nlenc.Uint32(buf[8:12]); n != nStats {
+		return fmt.Errorf("%s: ETHTOOL_GSTRINGS: len: want: %d, got: %d", ifStats.IfName, nStats, n)
+	}
+
+	ifStats.Names, ifStats.indexes = selectStatNames(
+		buf[ETHTOOL_GSTRINGS_HEADER_SIZE:], int(nStats), esShared.statNameRegex,
+	)
+	ifStats.Stats = make([]uint64, len(ifStats.Names))
+	return nil
+}
+
+func (es *EthtoolStats) updateStats(fd int, ifStats *EthtoolIfStats) error {
+	esShared := es.shared
+	ioctlFn := ethtoolIoctl
+	if esShared.ioctlFn != nil {
+		ioctlFn = esShared.ioctlFn
+	}
+
+	nStats := ifStats.nStats
+	esShared.statsBuf = ethtoolBuf(
+		esShared.statsBuf,
+		ETHTOOL_GSTATS_HEADER_SIZE+ethtoolHeadroomNStats(nStats)*8,
+	)
+	buf := esShared.statsBuf
+	nlenc.PutUint32(buf[0:4], unix.ETHTOOL_GSTATS)
+	nlenc.PutUint32(buf[4:8], nStats)
+	err := ioctlFn(fd, ifStats.IfName, buf)
+	if err != nil {
+		return err
+	}
+	if n := nlenc.Uint32(buf[4:8]); n != nStats {
+		return fmt.Errorf("%s: ETHTOOL_GSTATS: n_stats: want: %d, got: %d", ifStats.IfName, nStats, n)
+	}
+
+	for i, index := range ifStats.indexes {
+		off := ETHTOOL_GSTATS_HEADER_SIZE + index*8
+		ifStats.Stats[i] = nlenc.Uint64(buf[off : off+8])
+	}
+	return nil
+}
+
+func (es *EthtoolStats) Parse() error {
+	esShared := es.shared
+	if esShared.sock == nil {
+		fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open ioctl socket: %v", err)
+		}
+		esShared.sock = fd
+	}
+	fd := esShared.sock.(int)
+	drvinfoNStatsFn := ethtoolDrvinfoNStats
+	if esShared.drvinfoNStatsFn != nil {
+		drvinfoNStatsFn = esShared.drvinfoNStatsFn
+	}
+
+	scanNum := *esShared.scanNum + 1
+
+	if esShared.ifIndexToNameCache == nil ||
+		time.Since(esShared.ifIndexToNameCacheLastRefresh) >= ETHTOOL_IF_INDEX_TO_NAME_CACHE_REFRESH_INTERVAL {
+		err := es.ifIndexToNameCacheRefresh()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Errors for a given interface, e.g. no driver stats support, interface
+	// removed in the meantime, etc, are not fatal, the interface is simply
+	// skipped until the next cache refresh:
+	for ifIndex, ifName := range esShared.ifIndexToNameCache {
+		if esShared.skipIfIndex[ifIndex] {
+			continue
+		}
+
+		nStats, err := drvinfoNStatsFn(fd, ifName)
+		if err != nil || nStats == 0 {
+			esShared.skipIfIndex[ifIndex] = true
+			continue
+		}
+
+		ifStats := es.Info[ifIndex]
+		if ifStats == nil {
+			ifStats = &EthtoolIfStats{}
+			es.Info[ifIndex] = ifStats
+		}
+		// The name of the interface may change at refresh time, whereas the
+		// stats set may change at any time:
+		if ifStats.IfName != ifName || ifStats.nStats != nStats {
+			ifStats.IfName = ifName
+			ifStats.nStats = nStats
+			ifStats.Names = nil
+		}
+		if ifStats.Names == nil {
+			err = es.updateNames(fd, ifStats)
+			if err != nil || len(ifStats.Names) == 0 {
+				esShared.skipIfIndex[ifIndex] = true
+				delete(es.Info, ifIndex)
+				continue
+			}
+		}
+		if err = es.updateStats(fd, ifStats); err != nil {
+			// Most likely the stats set changed since ETHTOOL_GDRVINFO; the
+			// interface is left out of this scan and its names are retrieved
+			// again at the next one:
+			delete(es.Info, ifIndex)
+			continue
+		}
+
+		ifStats.scanNum = scanNum
+	}
+
+	// Remove out-of-scope interfaces as needed:
+	for ifIndex, ifStats := range es.Info {
+		if ifStats.scanNum != scanNum {
+			delete(es.Info, ifIndex)
+		}
+	}
+
+	*esShared.scanNum = scanNum
+	return nil
+}
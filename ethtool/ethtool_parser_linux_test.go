@@ -0,0 +1,417 @@
+package ethtool
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+// Fake interface, as seen by net.Interfaces and the ioctl's:
+type ethtoolFakeIf struct {
+	index uint32
+	name  string
+	flags net.Flags
+	// The stats, nil for no driver stats support:
+	names []string
+	stats []uint64
+	// If > 0, the number of stats found by ETHTOOL_GSTRINGS/GSTATS, as if the
+	// stats set changed since ETHTOOL_GDRVINFO:
+	changedNStats int
+}
+
+type ethtoolFake struct {
+	ifs []*ethtoolFakeIf
+	// Call counters:
+	interfacesCalls int
+	drvinfoCalls    map[string]int
+	// Whether an ioctl would have written past the buffer:
+	overflow bool
+}
+
+func (fake *ethtoolFake) getIf(ifName string) *ethtoolFakeIf {
+	for _, fakeIf := range fake.ifs {
+		if fakeIf.name == ifName {
+			return fakeIf
+		}
+	}
+	return nil
+}
+
+func (fake *ethtoolFake) interfaces() ([]net.Interface, error) {
+	fake.interfacesCalls++
+	ifas := make([]net.Interface, len(fake.ifs))
+	for i, fakeIf := range fake.ifs {
+		ifas[i] = net.Interface{Index: int(fakeIf.index), Name: fakeIf.name, Flags: fakeIf.flags}
+	}
+	return ifas, nil
+}
+
+func (fake *ethtoolFake) drvinfoNStats(fd int, ifName string) (uint32, error) {
+	fake.drvinfoCalls[ifName]++
+	fakeIf := fake.getIf(ifName)
+	if fakeIf == nil {
+		return 0, unix.ENODEV
+	}
+	return uint32(len(fakeIf.names)), nil
+}
+
+// Mimic the kernel, which ignores the count passed in the request:
+func (fake *ethtoolFake) ioctl(fd int, ifName string, data []byte) error {
+	fakeIf := fake.getIf(ifName)
+	if fakeIf == nil {
+		return unix.ENODEV
+	}
+	nStats := len(fakeIf.names)
+	if fakeIf.changedNStats > 0 {
+		nStats = fakeIf.changedNStats
+	}
+	switch cmd := nlenc.Uint32(data[0:4]); cmd {
+	case unix.ETHTOOL_GSTRINGS:
+		nlenc.PutUint32(data[8:12], uint32(nStats))
+		if ETHTOOL_GSTRINGS_HEADER_SIZE+nStats*ETH_GSTRING_LEN > len(data) {
+			fake.overflow = true
+			return nil
+		}
+		for i := 0; i < nStats; i++ {
+			name := fmt.Sprintf("stat_%d", i)
+			if i < len(fakeIf.names) {
+				name = fakeIf.names[i]
+			}
+			copy(data[ETHTOOL_GSTRINGS_HEADER_SIZE+i*ETH_GSTRING_LEN:], name)
+		}
+	case unix.ETHTOOL_GSTATS:
+		nlenc.PutUint32(data[4:8], uint32(nStats))
+		if ETHTOOL_GSTATS_HEADER_SIZE+nStats*8 > len(data) {
+			fake.overflow = true
+			return nil
+		}
+		for i := 0; i < nStats && i < len(fakeIf.stats); i++ {
+			off := ETHTOOL_GSTATS_HEADER_SIZE + i*8
+			nlenc.PutUint64(data[off:off+8], fakeIf.stats[i])
+		}
+	default:
+		return fmt.Errorf("unexpected ethtool cmd: %d", cmd)
+	}
+	return nil
+}
+
+type SelectStatNamesTestCase struct {
+	name          string
+	names         []string
+	statNameRegex string
+	wantNames     []string
+	wantIndexes   []int
+}
+
+func testSelectStatNames(tc *SelectStatNamesTestCase, t *testing.T) {
+	strings := make([]byte, len(tc.names)*ETH_GSTRING_LEN)
+	for i, name := range tc.names {
+		copy(strings[i*ETH_GSTRING_LEN:], name)
+	}
+	var statNameRegex *regexp.Regexp
+	if tc.statNameRegex != "" {
+		statNameRegex = regexp.MustCompile(tc.statNameRegex)
+	}
+
+	gotNames, gotIndexes := selectStatNames(strings, len(tc.names), statNameRegex)
+
+	diffBuf := &bytes.Buffer{}
+	if fmt.Sprint(tc.wantNames) != fmt.Sprint(gotNames) {
+		fmt.Fprintf(diffBuf, "\nnames: want: %q, got: %q", tc.wantNames, gotNames)
+	}
+	if fmt.Sprint(tc.wantIndexes) != fmt.Sprint(gotIndexes) {
+		fmt.Fprintf(diffBuf, "\nindexes: want: %v, got: %v", tc.wantIndexes, gotIndexes)
+	}
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf)
+	}
+}
+
+func TestSelectStatNames(t *testing.T) {
+	// A name w/ the max length, i.e. w/o the terminating 0:
+	longName := "rx_queue_1234_xdp_redirect_errs_"[:ETH_GSTRING_LEN]
+	for _, tc := range []*SelectStatNamesTestCase{
+		{
+			name:        "all",
+			names:       []string{"rx_packets", "rx_missed_errors", "tx_packets"},
+			wantNames:   []string{"rx_packets", "rx_missed_errors", "tx_packets"},
+			wantIndexes: []int{0, 1, 2},
+		},
+		{
+			name:          "regex",
+			names:         []string{"rx_packets", "rx_missed_errors", "tx_packets", "rx_queue_0_drops"},
+			statNameRegex: `err|drop`,
+			wantNames:     []string{"rx_missed_errors", "rx_queue_0_drops"},
+			wantIndexes:   []int{1, 3},
+		},
+		{
+			name:          "none",
+			names:         []string{"rx_packets", "tx_packets"},
+			statNameRegex: `err|drop`,
+			wantNames:     []string{},
+			wantIndexes:   []int{},
+		},
+		{
+			name:          "max_len",
+			names:         []string{"rx_packets", longName},
+			statNameRegex: `err`,
+			wantNames:     []string{longName},
+			wantIndexes:   []int{1},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testSelectStatNames(tc, t) },
+		)
+	}
+}
+
+type EthtoolStatsParseTestStep struct {
+	// Update the fake before the parse:
+	updateFn func(fake *ethtoolFake)
+	// Force the refresh of the index -> name cache:
+	refresh bool
+	// The expected state after the parse:
+	wantInfo            map[uint32]*EthtoolIfStats
+	wantSkipIfIndex     []uint32
+	wantInterfacesCalls int
+	// The ETHTOOL_GDRVINFO calls, by interface name, for this step only:
+	wantDrvinfoCalls map[string]int
+}
+
+type EthtoolStatsParseTestCase struct {
+	name  string
+	ifs   []*ethtoolFakeIf
+	steps []*EthtoolStatsParseTestStep
+}
+
+func testEthtoolStatsParse(tc *EthtoolStatsParseTestCase, t *testing.T) {
+	fake := &ethtoolFake{ifs: tc.ifs}
+	es := NewEthtoolStats(regexp.MustCompile(`err|drop`))
+	es.shared.interfacesFn = fake.interfaces
+	es.shared.drvinfoNStatsFn = fake.drvinfoNStats
+	es.shared.ioctlFn = fake.ioctl
+	// No actual ioctl is made:
+	es.shared.sock = -1
+
+	for stepNum, step := range tc.steps {
+		if step.updateFn != nil {
+			step.updateFn(fake)
+		}
+		if step.refresh {
+			es.shared.ifIndexToNameCacheLastRefresh = es.shared.ifIndexToNameCacheLastRefresh.Add(
+				-ETHTOOL_IF_INDEX_TO_NAME_CACHE_REFRESH_INTERVAL,
+			)
+		}
+		fake.drvinfoCalls = make(map[string]int)
+		if err := es.Parse(); err != nil {
+			t.Fatalf("step %d: %v", stepNum, err)
+		}
+
+		diffBuf := &bytes.Buffer{}
+		if fake.overflow {
+			fmt.Fprintf(diffBuf, "\nioctl buffer overflow")
+		}
+		if len(step.wantInfo) != len(es.Info) {
+			fmt.Fprintf(diffBuf, "\nlen(Info): want: %d, got: %d", len(step.wantInfo), len(es.Info))
+		}
+		for ifIndex, wantIfStats := range step.wantInfo {
+			gotIfStats := es.Info[ifIndex]
+			if gotIfStats == nil {
+				fmt.Fprintf(diffBuf, "\nInfo[%d]: missing", ifIndex)
+				continue
+			}
+			if wantIfStats.IfName != gotIfStats.IfName {
+				fmt.Fprintf(diffBuf, "\nInfo[%d].IfName: want: %q, got: %q", ifIndex, wantIfStats.IfName, gotIfStats.IfName)
+			}
+			if fmt.Sprint(wantIfStats.Names) != fmt.Sprint(gotIfStats.Names) {
+				fmt.Fprintf(diffBuf, "\nInfo[%d].Names: want: %q, got: %q", ifIndex, wantIfStats.Names, gotIfStats.Names)
+			}
+			if fmt.Sprint(wantIfStats.Stats) != fmt.Sprint(gotIfStats.Stats) {
+				fmt.Fprintf(diffBuf, "\nInfo[%d].Stats: want: %v, got: %v", ifIndex, wantIfStats.Stats, gotIfStats.Stats)
+			}
+		}
+		if len(step.wantSkipIfIndex) != len(es.shared.skipIfIndex) {
+			fmt.Fprintf(diffBuf, "\nlen(skipIfIndex): want: %d, got: %d", len(step.wantSkipIfIndex), len(es.shared.skipIfIndex))
+		}
+		for _, ifIndex := range step.wantSkipIfIndex {
+			if !es.shared.skipIfIndex[ifIndex] {
+				fmt.Fprintf(diffBuf, "\nskipIfIndex[%d]: missing", ifIndex)
+			}
+		}
+		if step.wantInterfacesCalls != fake.interfacesCalls {
+			fmt.Fprintf(diffBuf, "\ninterfaces calls: want: %d, got: %d", step.wantInterfacesCalls, fake.interfacesCalls)
+		}
+		if fmt.Sprint(step.wantDrvinfoCalls) != fmt.Sprint(fake.drvinfoCalls) {
+			fmt.Fprintf(diffBuf, "\nETHTOOL_GDRVINFO calls: want: %v, got: %v", step.wantDrvinfoCalls, fake.drvinfoCalls)
+		}
+		if diffBuf.Len() > 0 {
+			t.Fatalf("step %d:%s", stepNum, diffBuf)
+		}
+
+		// Simulate the current, previous tandem:
+		es = es.Clone()
+	}
+}
+
+func TestEthtoolStatsParse(t *testing.T) {
+	newIfs := func() []*ethtoolFakeIf {
+		return []*ethtoolFakeIf{
+			{
+				index: 1, name: "lo", flags: net.FlagLoopback | net.FlagUp,
+				names: []string{"rx_errors"}, stats: []uint64{1},
+			},
+			{
+				index: 2, name: "eth0", flags: net.FlagUp,
+				names: []string{"rx_packets", "rx_missed_errors", "rx_crc_errors"},
+				stats: []uint64{1000, 10, 20},
+			},
+			// No driver stats support:
+			{index: 3, name: "veth0", flags: net.FlagUp},
+			// No selected stat:
+			{
+				index: 4, name: "eth1", flags: net.FlagUp,
+				names: []string{"rx_packets", "tx_packets"},
+				stats: []uint64{1000, 2000},
+			},
+		}
+	}
+	eth0Names := []string{"rx_missed_errors", "rx_crc_errors"}
+
+	for _, tc := range []*EthtoolStatsParseTestCase{
+		{
+			name: "select_and_skip",
+			ifs:  newIfs(),
+			steps: []*EthtoolStatsParseTestStep{
+				{
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {IfName: "eth0", Names: eth0Names, Stats: []uint64{10, 20}},
+					},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1, "eth1": 1, "veth0": 1},
+				},
+				{
+					updateFn: func(fake *ethtoolFake) {
+						fake.getIf("eth0").stats[1] = 11
+					},
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {IfName: "eth0", Names: eth0Names, Stats: []uint64{11, 20}},
+					},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1},
+				},
+			},
+		},
+		{
+			name: "stats_set_change",
+			ifs:  newIfs(),
+			steps: []*EthtoolStatsParseTestStep{
+				{
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {IfName: "eth0", Names: eth0Names, Stats: []uint64{10, 20}},
+					},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1, "eth1": 1, "veth0": 1},
+				},
+				{
+					updateFn: func(fake *ethtoolFake) {
+						fakeIf := fake.getIf("eth0")
+						fakeIf.names = append(fakeIf.names, "rx_queue_0_drops")
+						fakeIf.stats = append(fakeIf.stats, 5)
+					},
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {
+							IfName: "eth0",
+							Names:  []string{"rx_missed_errors", "rx_crc_errors", "rx_queue_0_drops"},
+							Stats:  []uint64{10, 20, 5},
+						},
+					},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1},
+				},
+			},
+		},
+		{
+			name: "stats_set_grown_in_between",
+			ifs:  newIfs(),
+			steps: []*EthtoolStatsParseTestStep{
+				{
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {IfName: "eth0", Names: eth0Names, Stats: []uint64{10, 20}},
+					},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1, "eth1": 1, "veth0": 1},
+				},
+				{
+					// Within the headroom:
+					updateFn: func(fake *ethtoolFake) {
+						fake.getIf("eth0").changedNStats = 16
+					},
+					wantInfo:            map[uint32]*EthtoolIfStats{},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1},
+				},
+				{
+					updateFn: func(fake *ethtoolFake) {
+						fake.getIf("eth0").changedNStats = 0
+					},
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {IfName: "eth0", Names: eth0Names, Stats: []uint64{10, 20}},
+					},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1},
+				},
+			},
+		},
+		{
+			name: "refresh",
+			ifs:  newIfs(),
+			steps: []*EthtoolStatsParseTestStep{
+				{
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {IfName: "eth0", Names: eth0Names, Stats: []uint64{10, 20}},
+					},
+					wantSkipIfIndex:     []uint32{3, 4},
+					wantInterfacesCalls: 1,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1, "eth1": 1, "veth0": 1},
+				},
+				{
+					// eth1 renamed and w/ a selected stat, veth0 removed, the
+					// skipped interfaces are re-evaluated:
+					updateFn: func(fake *ethtoolFake) {
+						fakeIf := fake.getIf("eth1")
+						fakeIf.name = "eth2"
+						fakeIf.names = append(fakeIf.names, "rx_dropped")
+						fakeIf.stats = append(fakeIf.stats, 7)
+						fake.ifs = []*ethtoolFakeIf{fake.ifs[0], fake.ifs[1], fakeIf}
+					},
+					refresh: true,
+					wantInfo: map[uint32]*EthtoolIfStats{
+						2: {IfName: "eth0", Names: eth0Names, Stats: []uint64{10, 20}},
+						4: {IfName: "eth2", Names: []string{"rx_dropped"}, Stats: []uint64{7}},
+					},
+					wantSkipIfIndex:     []uint32{},
+					wantInterfacesCalls: 2,
+					wantDrvinfoCalls:    map[string]int{"eth0": 1, "eth2": 1},
+				},
+			},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testEthtoolStatsParse(tc, t) },
+		)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package ethtool
+
+import (
+	"fmt"
+	"runtime"
+)
+
+var EthtoolAvailable = false
+
+func (es *EthtoolStats) Parse() error {
+	return fmt.Errorf("ethtool not supported for GOOS=%s", runtime.GOOS)
+}
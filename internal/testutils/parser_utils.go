@@ -52,6 +52,8 @@ var PidStatusByteSliceFieldsIndexToName = []string{
 	"PID_STATUS_HUGETLBPAGES",
 	"PID_STATUS_CPUS_ALLOWED_LIST",
 	"PID_STATUS_MEMS_ALLOWED_LIST",
+	"PID_STATUS_NSTGID",
+	"PID_STATUS_NSPID",
 }
 
 var PidStatusNumericFieldsIndexToName = []string{
@@ -10,4 +10,5 @@ var (
 	ProcfsTestDataSubdir  = "testdata/procfs"
 	ProcfsTestCasesSubdir = "testdata/procfs/testcases"
 	ProcfsProcSubdir      = "testdata/procfs/proc"
+	SysfsTestDataSubdir   = "testdata/sysfs"
 )
@@ -32,25 +32,42 @@ const (
 	GLOBAL_CONFIG_INSTANCE_DEFAULT           = "lsvmi"
 	GLOBAL_CONFIG_USE_SHORT_HOSTNAME_DEFAULT = true
 	GLOBAL_CONFIG_PROCFS_ROOT_DEFAULT        = "/proc"
+	GLOBAL_CONFIG_SYSFS_ROOT_DEFAULT         = "/sys"
 )
 
 type LsvmiConfig struct {
-	GlobalConfig                *GlobalConfig                `yaml:"global_config"`
-	ProcStatMetricsConfig       *ProcStatMetricsConfig       `yaml:"proc_stat_metrics_config"`
-	ProcNetDevMetricsConfig     *ProcNetDevMetricsConfig     `yaml:"proc_net_dev_metrics_config"`
-	ProcInterruptsMetricsConfig *ProcInterruptsMetricsConfig `yaml:"proc_interrupts_metrics_config"`
-	ProcSoftirqsMetricsConfig   *ProcSoftirqsMetricsConfig   `yaml:"proc_softirqs_metrics_config"`
-	ProcNetSnmpMetricsConfig    *ProcNetSnmpMetricsConfig    `yaml:"proc_net_snmp_metrics_config"`
-	ProcNetSnmp6MetricsConfig   *ProcNetSnmp6MetricsConfig   `yaml:"proc_net_snmp6_metrics_config"`
-	ProcDiskstatsMetricsConfig  *ProcDiskstatsMetricsConfig  `yaml:"proc_diskstats_metrics_config"`
-	ProcPidMetricsConfig        *ProcPidMetricsConfig        `yaml:"proc_pid_metrics_config"`
-	StatfsMetricsConfig         *StatfsMetricsConfig         `yaml:"statfs_metrics_config"`
-	QdiscMetricsConfig          *QdiscMetricsConfig          `yaml:"qdisc_metrics_config"`
-	InternalMetricsConfig       *InternalMetricsConfig       `yaml:"internal_metrics_config"`
-	SchedulerConfig             *SchedulerConfig             `yaml:"scheduler_config"`
-	CompressorPoolConfig        *CompressorPoolConfig        `yaml:"compressor_pool_config"`
-	HttpEndpointPoolConfig      *HttpEndpointPoolConfig      `yaml:"http_endpoint_pool_config"`
-	LoggerConfig                *LoggerConfig                `yaml:"log_config"`
+	GlobalConfig                    *GlobalConfig                    `yaml:"global_config"`
+	ProcStatMetricsConfig           *ProcStatMetricsConfig           `yaml:"proc_stat_metrics_config"`
+	ProcNetDevMetricsConfig         *ProcNetDevMetricsConfig         `yaml:"proc_net_dev_metrics_config"`
+	ProcInterruptsMetricsConfig     *ProcInterruptsMetricsConfig     `yaml:"proc_interrupts_metrics_config"`
+	ProcSoftirqsMetricsConfig       *ProcSoftirqsMetricsConfig       `yaml:"proc_softirqs_metrics_config"`
+	ProcNetSnmpMetricsConfig        *ProcNetSnmpMetricsConfig        `yaml:"proc_net_snmp_metrics_config"`
+	ProcNetSnmp6MetricsConfig       *ProcNetSnmp6MetricsConfig       `yaml:"proc_net_snmp6_metrics_config"`
+	ProcDiskstatsMetricsConfig      *ProcDiskstatsMetricsConfig      `yaml:"proc_diskstats_metrics_config"`
+	ProcPidMetricsConfig            *ProcPidMetricsConfig            `yaml:"proc_pid_metrics_config"`
+	StatfsMetricsConfig             *StatfsMetricsConfig             `yaml:"statfs_metrics_config"`
+	QdiscMetricsConfig              *QdiscMetricsConfig              `yaml:"qdisc_metrics_config"`
+	NfConntrackMetricsConfig        *NfConntrackMetricsConfig        `yaml:"nf_conntrack_metrics_config"`
+	HwmonMetricsConfig              *HwmonMetricsConfig              `yaml:"hwmon_metrics_config"`
+	CpufreqMetricsConfig            *CpufreqMetricsConfig            `yaml:"cpufreq_metrics_config"`
+	ProcMdstatMetricsConfig         *ProcMdstatMetricsConfig         `yaml:"proc_mdstat_metrics_config"`
+	NfsMetricsConfig                *NfsMetricsConfig                `yaml:"nfs_metrics_config"`
+	ProcNetSoftnetStatMetricsConfig *ProcNetSoftnetStatMetricsConfig `yaml:"proc_net_softnet_stat_metrics_config"`
+	NumaMetricsConfig               *NumaMetricsConfig               `yaml:"numa_metrics_config"`
+	KernelResourcesMetricsConfig    *KernelResourcesMetricsConfig    `yaml:"kernel_resources_metrics_config"`
+	FileWatcherMetricsConfig        *FileWatcherMetricsConfig        `yaml:"file_watcher_metrics_config"`
+	TextfileMetricsConfig           *TextfileMetricsConfig           `yaml:"textfile_metrics_config"`
+	ProcSchedstatMetricsConfig      *ProcSchedstatMetricsConfig      `yaml:"proc_schedstat_metrics_config"`
+	KmsgMetricsConfig               *KmsgMetricsConfig               `yaml:"kmsg_metrics_config"`
+	ProcBuddyinfoMetricsConfig      *ProcBuddyinfoMetricsConfig      `yaml:"proc_buddyinfo_metrics_config"`
+	ProcSlabinfoMetricsConfig       *ProcSlabinfoMetricsConfig       `yaml:"proc_slabinfo_metrics_config"`
+	ProcNetBondingMetricsConfig     *ProcNetBondingMetricsConfig     `yaml:"proc_net_bonding_metrics_config"`
+	EthtoolMetricsConfig            *EthtoolMetricsConfig            `yaml:"ethtool_metrics_config"`
+	InternalMetricsConfig           *InternalMetricsConfig           `yaml:"internal_metrics_config"`
+	SchedulerConfig                 *SchedulerConfig                 `yaml:"scheduler_config"`
+	CompressorPoolConfig            *CompressorPoolConfig            `yaml:"compressor_pool_config"`
+	HttpEndpointPoolConfig          *HttpEndpointPoolConfig          `yaml:"http_endpoint_pool_config"`
+	LoggerConfig                    *LoggerConfig                    `yaml:"log_config"`
 }
 
 type GlobalConfig struct {
@@ -69,6 +86,9 @@ type GlobalConfig struct {
 
 	// procfs root. It may be overridden by --procfs-root command line arg.
 	ProcfsRoot string `yaml:"procfs_root"`
+
+	// sysfs root. It may be overridden by --sysfs-root command line arg.
+	SysfsRoot string `yaml:"sysfs_root"`
 }
 
 var ErrConfigFileArgNotProvided = errors.New("config file arg not provided")
@@ -103,6 +123,14 @@ var procfsRootArg = flag.String(
 	),
 )
 
+var sysfsRootArg = flag.String(
+	"sysfs-root",
+	"",
+	FormatFlagUsage(
+		`Override the "global_config.sysfs_root" config setting`,
+	),
+)
+
 var loggerLevelArg = flag.String(
 	"log-level",
 	"",
@@ -133,26 +161,43 @@ func DefaultGlobalConfig() *GlobalConfig {
 		Instance:         GLOBAL_CONFIG_INSTANCE_DEFAULT,
 		UseShortHostname: GLOBAL_CONFIG_USE_SHORT_HOSTNAME_DEFAULT,
 		ProcfsRoot:       GLOBAL_CONFIG_PROCFS_ROOT_DEFAULT,
+		SysfsRoot:        GLOBAL_CONFIG_SYSFS_ROOT_DEFAULT,
 	}
 }
 
 func DefaultLsvmiConfig() *LsvmiConfig {
 	return &LsvmiConfig{
-		GlobalConfig:                DefaultGlobalConfig(),
-		ProcStatMetricsConfig:       DefaultProcStatMetricsConfig(),
-		ProcNetDevMetricsConfig:     DefaultProcNetDevMetricsConfig(),
-		ProcInterruptsMetricsConfig: DefaultProcInterruptsMetricsConfig(),
-		ProcSoftirqsMetricsConfig:   DefaultProcSoftirqsMetricsConfig(),
-		ProcNetSnmpMetricsConfig:    DefaultProcNetSnmpMetricsConfig(),
-		ProcNetSnmp6MetricsConfig:   DefaultProcNetSnmp6MetricsConfig(),
-		ProcDiskstatsMetricsConfig:  DefaultProcDiskstatsMetricsConfig(),
-		ProcPidMetricsConfig:        DefaultProcPidMetricsConfig(),
-		StatfsMetricsConfig:         DefaultStatfsMetricsConfig(),
-		QdiscMetricsConfig:          DefaultQdiscMetricsConfig(),
-		InternalMetricsConfig:       DefaultInternalMetricsConfig(),
-		SchedulerConfig:             DefaultSchedulerConfig(),
-		CompressorPoolConfig:        DefaultCompressorPoolConfig(),
-		HttpEndpointPoolConfig:      DefaultHttpEndpointPoolConfig(),
+		GlobalConfig:                    DefaultGlobalConfig(),
+		ProcStatMetricsConfig:           DefaultProcStatMetricsConfig(),
+		ProcNetDevMetricsConfig:         DefaultProcNetDevMetricsConfig(),
+		ProcInterruptsMetricsConfig:     DefaultProcInterruptsMetricsConfig(),
+		ProcSoftirqsMetricsConfig:       DefaultProcSoftirqsMetricsConfig(),
+		ProcNetSnmpMetricsConfig:        DefaultProcNetSnmpMetricsConfig(),
+		ProcNetSnmp6MetricsConfig:       DefaultProcNetSnmp6MetricsConfig(),
+		ProcDiskstatsMetricsConfig:      DefaultProcDiskstatsMetricsConfig(),
+		ProcPidMetricsConfig:            DefaultProcPidMetricsConfig(),
+		StatfsMetricsConfig:             DefaultStatfsMetricsConfig(),
+		QdiscMetricsConfig:              DefaultQdiscMetricsConfig(),
+		NfConntrackMetricsConfig:        DefaultNfConntrackMetricsConfig(),
+		HwmonMetricsConfig:              DefaultHwmonMetricsConfig(),
+		CpufreqMetricsConfig:            DefaultCpufreqMetricsConfig(),
+		ProcMdstatMetricsConfig:         DefaultProcMdstatMetricsConfig(),
+		NfsMetricsConfig:                DefaultNfsMetricsConfig(),
+		ProcNetSoftnetStatMetricsConfig: DefaultProcNetSoftnetStatMetricsConfig(),
+		NumaMetricsConfig:               DefaultNumaMetricsConfig(),
+		KernelResourcesMetricsConfig:    DefaultKernelResourcesMetricsConfig(),
+		FileWatcherMetricsConfig:        DefaultFileWatcherMetricsConfig(),
+		TextfileMetricsConfig:           DefaultTextfileMetricsConfig(),
+		ProcSchedstatMetricsConfig:      DefaultProcSchedstatMetricsConfig(),
+		KmsgMetricsConfig:               DefaultKmsgMetricsConfig(),
+		ProcBuddyinfoMetricsConfig:      DefaultProcBuddyinfoMetricsConfig(),
+		ProcSlabinfoMetricsConfig:       DefaultProcSlabinfoMetricsConfig(),
+		ProcNetBondingMetricsConfig:     DefaultProcNetBondingMetricsConfig(),
+		EthtoolMetricsConfig:            DefaultEthtoolMetricsConfig(),
+		InternalMetricsConfig:           DefaultInternalMetricsConfig(),
+		SchedulerConfig:                 DefaultSchedulerConfig(),
+		CompressorPoolConfig:            DefaultCompressorPoolConfig(),
+		HttpEndpointPoolConfig:          DefaultHttpEndpointPoolConfig(),
 	}
 }
 
@@ -188,6 +233,9 @@ func LoadLsvmiConfigFromArgs() (*LsvmiConfig, error) {
 	if *procfsRootArg != "" {
 		cfg.GlobalConfig.ProcfsRoot = *procfsRootArg
 	}
+	if *sysfsRootArg != "" {
+		cfg.GlobalConfig.SysfsRoot = *sysfsRootArg
+	}
 	if *loggerLevelArg != "" {
 		cfg.LoggerConfig.Level = *loggerLevelArg
 	}
@@ -0,0 +1,437 @@
+// CPU frequency and idle state residency metrics based on:
+//  /sys/devices/system/cpu/online
+//  /sys/devices/system/cpu/cpu*/cpufreq
+//  /sys/devices/system/cpu/cpu*/cpuidle
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
+)
+
+const (
+	CPUFREQ_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	CPUFREQ_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+
+	// This generator id:
+	CPUFREQ_METRICS_ID = "cpufreq_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",cpu="CPU"}:
+	CPUFREQ_CUR_KHZ_METRIC = "cpufreq_cur_khz"
+	CPUFREQ_MIN_KHZ_METRIC = "cpufreq_min_khz"
+	CPUFREQ_MAX_KHZ_METRIC = "cpufreq_max_khz"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",cpu="CPU",state="STATE",name="NAME"}:
+	CPUIDLE_STATE_TIME_PCT_METRIC    = "cpuidle_state_time_pct"
+	CPUIDLE_STATE_USAGE_DELTA_METRIC = "cpuidle_state_usage_delta"
+
+	CPUFREQ_CPU_LABEL_NAME        = "cpu"
+	CPUIDLE_STATE_LABEL_NAME      = "state"
+	CPUIDLE_STATE_NAME_LABEL_NAME = "name"
+
+	// The idle time is in microseconds:
+	CPUIDLE_STATE_TIME_FACTOR   = 1. / 1000000.
+	CPUIDLE_STATE_TIME_PCT_PREC = 1
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	CPUFREQ_INTERVAL_METRIC = "cpufreq_metrics_delta_sec"
+)
+
+var cpufreqMetricsLog = NewCompLogger(CPUFREQ_METRICS_ID)
+
+type CpufreqMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultCpufreqMetricsConfig() *CpufreqMetricsConfig {
+	return &CpufreqMetricsConfig{
+		Interval:          CPUFREQ_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: CPUFREQ_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+// Per idle state info:
+type CpuidleStateMetricInfo struct {
+	// The metrics, including labels:
+	timePctMetric, usageDeltaMetric []byte
+	// No metrics will be generated for 0 after 0, except for full cycles. Keep
+	// whether the previous value was 0 or not:
+	zeroTimePct, zeroUsageDelta bool
+	// The previous counters, used for deltas:
+	prevTime, prevUsage uint64
+	prevValid           bool
+}
+
+// Group together info indexed by CPU# to minimize the number of lookups:
+type CpufreqMetricsCpuInfo struct {
+	// Frequency metrics cache:
+	curFreqMetric, minFreqMetric, maxFreqMetric []byte
+	// The previous values, used for change detection:
+	prevCurFreq, prevMinFreq, prevMaxFreq int64
+	prevFreqValid                         bool
+	// Idle state info, indexed like the parser's IdleStates:
+	idleStateMetricInfo []*CpuidleStateMetricInfo
+	// Current cycle#:
+	cycleNum int
+	// The parser CPU info the cache was built for, used for detecting
+	// rediscovered CPUs:
+	cpu *sysfs.CpuFreqIdleCpu
+	// The scan# when the CPU was last found, used for detecting out-of-scope
+	// CPUs:
+	scanNum uint64
+}
+
+type CpufreqMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The parser:
+	cpuFreqIdle *sysfs.CpuFreqIdle
+
+	// Timestamp of the current and previous scan:
+	currTs, prevTs time.Time
+
+	// Per CPU# info:
+	cpuInfo map[int]*CpufreqMetricsCpuInfo
+
+	// Scan#, used for detecting out-of-scope CPUs:
+	scanNum uint64
+
+	// Interval metric:
+	intervalMetric []byte
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// Cache the total metrics count, this is revised every time the number of
+	// observed CPUs or idle states increases:
+	maxNumCpus        int
+	maxNumIdleStates  int
+	totalMetricsCount int
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	sysfsRoot          string
+}
+
+func NewCpufreqMetrics(cfg any) (*CpufreqMetrics, error) {
+	var (
+		err               error
+		cpufreqMetricsCfg *CpufreqMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		cpufreqMetricsCfg = cfg.CpufreqMetricsConfig
+	case *CpufreqMetricsConfig:
+		cpufreqMetricsCfg = cfg
+	case nil:
+		cpufreqMetricsCfg = DefaultCpufreqMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewCpufreqMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(cpufreqMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	cpufreqMetrics := &CpufreqMetrics{
+		id:                CPUFREQ_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: cpufreqMetricsCfg.FullMetricsFactor,
+		cpuInfo:           make(map[int]*CpufreqMetricsCpuInfo),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+	cpufreqMetrics.updateMaxNumCpus(1)
+
+	cpufreqMetricsLog.Infof("id=%s", cpufreqMetrics.id)
+	cpufreqMetricsLog.Infof("interval=%s", cpufreqMetrics.interval)
+	cpufreqMetricsLog.Infof("full_metrics_factor=%d", cpufreqMetrics.fullMetricsFactor)
+	return cpufreqMetrics, nil
+}
+
+func (cfm *CpufreqMetrics) updateMaxNumCpus(numCpus int) {
+	cfm.maxNumCpus = numCpus
+	cfm.totalMetricsCount = (
+	// cur, min, max freq + time pct, usage delta for each idle state:
+	cfm.maxNumCpus*(3+2*cfm.maxNumIdleStates) +
+		// +1 for interval
+		1)
+}
+
+func (cfm *CpufreqMetrics) updateCpuInfo(cpu *sysfs.CpuFreqIdleCpu) *CpufreqMetricsCpuInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if cfm.instance != "" {
+		instance = cfm.instance
+	}
+	if cfm.hostname != "" {
+		hostname = cfm.hostname
+	}
+
+	cpuLabelVal := strconv.Itoa(cpu.Cpu)
+	freqMetric := func(name string) []byte {
+		return []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			CPUFREQ_CPU_LABEL_NAME, cpuLabelVal,
+		))
+	}
+	cpuInfo := &CpufreqMetricsCpuInfo{
+		curFreqMetric:       freqMetric(CPUFREQ_CUR_KHZ_METRIC),
+		minFreqMetric:       freqMetric(CPUFREQ_MIN_KHZ_METRIC),
+		maxFreqMetric:       freqMetric(CPUFREQ_MAX_KHZ_METRIC),
+		idleStateMetricInfo: make([]*CpuidleStateMetricInfo, len(cpu.IdleStates)),
+		cycleNum:            initialCycleNum.Get(cfm.fullMetricsFactor),
+		cpu:                 cpu,
+	}
+	for i, idleState := range cpu.IdleStates {
+		idleStateMetric := func(name string) []byte {
+			return []byte(fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+				name,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				CPUFREQ_CPU_LABEL_NAME, cpuLabelVal,
+				CPUIDLE_STATE_LABEL_NAME, idleState.State,
+				CPUIDLE_STATE_NAME_LABEL_NAME, idleState.Name,
+			))
+		}
+		cpuInfo.idleStateMetricInfo[i] = &CpuidleStateMetricInfo{
+			timePctMetric:    idleStateMetric(CPUIDLE_STATE_TIME_PCT_METRIC),
+			usageDeltaMetric: idleStateMetric(CPUIDLE_STATE_USAGE_DELTA_METRIC),
+		}
+	}
+	cfm.cpuInfo[cpu.Cpu] = cpuInfo
+
+	if len(cpu.IdleStates) > cfm.maxNumIdleStates {
+		cfm.maxNumIdleStates = len(cpu.IdleStates)
+		cfm.updateMaxNumCpus(cfm.maxNumCpus)
+	}
+
+	if cfm.intervalMetric == nil {
+		cfm.intervalMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. include space before val
+			CPUFREQ_INTERVAL_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+
+	return cpuInfo
+}
+
+func (cfm *CpufreqMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	cpuFreqIdle := cfm.cpuFreqIdle
+	actualMetricsCount := 0
+	numCpus := len(cpuFreqIdle.Online)
+	if numCpus > cfm.maxNumCpus {
+		cfm.updateMaxNumCpus(numCpus)
+	}
+
+	cfm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		cfm.tsSuffixBuf, " %d\n", cfm.currTs.UnixMilli(),
+	)
+	promTs := cfm.tsSuffixBuf.Bytes()
+
+	// The residency % is based on the delta time; it can be evaluated only if
+	// there is a previous scan:
+	pctFactor := float64(0)
+	if !cfm.prevTs.IsZero() {
+		pctFactor = CPUIDLE_STATE_TIME_FACTOR * 100. / cfm.currTs.Sub(cfm.prevTs).Seconds()
+	}
+
+	cfm.scanNum++
+	numCpus = 0
+
+	for _, cpuNum := range cpuFreqIdle.Online {
+		cpu := cpuFreqIdle.Cpus[cpuNum]
+		if cpu == nil {
+			continue
+		}
+		cpuInfo := cfm.cpuInfo[cpuNum]
+		// A CPU going offline and back online in between scans is rediscovered
+		// by the parser, possibly w/ a different idle state set; either way
+		// the cache and the previous values are no longer valid:
+		if cpuInfo != nil && (cpuInfo.cpu != cpu || len(cpuInfo.idleStateMetricInfo) != len(cpu.IdleStates)) {
+			cpuInfo = nil
+		}
+		fullMetrics := cpuInfo == nil || cpuInfo.cycleNum == 0
+		if cpuInfo == nil {
+			cpuInfo = cfm.updateCpuInfo(cpu)
+		}
+		cpuInfo.scanNum = cfm.scanNum
+		numCpus++
+
+		if cpu.FreqValid {
+			if fullMetrics || !cpuInfo.prevFreqValid || cpu.CurFreq != cpuInfo.prevCurFreq {
+				buf.Write(cpuInfo.curFreqMetric)
+				buf.WriteString(strconv.FormatInt(cpu.CurFreq, 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			if fullMetrics || !cpuInfo.prevFreqValid || cpu.MinFreq != cpuInfo.prevMinFreq {
+				buf.Write(cpuInfo.minFreqMetric)
+				buf.WriteString(strconv.FormatInt(cpu.MinFreq, 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			if fullMetrics || !cpuInfo.prevFreqValid || cpu.MaxFreq != cpuInfo.prevMaxFreq {
+				buf.Write(cpuInfo.maxFreqMetric)
+				buf.WriteString(strconv.FormatInt(cpu.MaxFreq, 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+		}
+		cpuInfo.prevCurFreq, cpuInfo.prevMinFreq, cpuInfo.prevMaxFreq = cpu.CurFreq, cpu.MinFreq, cpu.MaxFreq
+		cpuInfo.prevFreqValid = cpu.FreqValid
+
+		for i, idleState := range cpu.IdleStates {
+			idleStateMetricInfo := cpuInfo.idleStateMetricInfo[i]
+			if idleState.Valid && idleStateMetricInfo.prevValid && pctFactor > 0 {
+				dTime := idleState.Time - idleStateMetricInfo.prevTime
+				if fullMetrics || dTime != 0 || !idleStateMetricInfo.zeroTimePct {
+					buf.Write(idleStateMetricInfo.timePctMetric)
+					buf.WriteString(strconv.FormatFloat(
+						float64(dTime)*pctFactor, 'f', CPUIDLE_STATE_TIME_PCT_PREC, 64,
+					))
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				idleStateMetricInfo.zeroTimePct = dTime == 0
+
+				dUsage := idleState.Usage - idleStateMetricInfo.prevUsage
+				if fullMetrics || dUsage != 0 || !idleStateMetricInfo.zeroUsageDelta {
+					buf.Write(idleStateMetricInfo.usageDeltaMetric)
+					buf.WriteString(strconv.FormatUint(dUsage, 10))
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				idleStateMetricInfo.zeroUsageDelta = dUsage == 0
+			}
+			idleStateMetricInfo.prevTime, idleStateMetricInfo.prevUsage = idleState.Time, idleState.Usage
+			idleStateMetricInfo.prevValid = idleState.Valid
+		}
+
+		if cpuInfo.cycleNum++; cpuInfo.cycleNum >= cfm.fullMetricsFactor {
+			cpuInfo.cycleNum = 0
+		}
+	}
+
+	// CPU's may be unplugged dynamically; remove out-of-scope CPUs:
+	if len(cfm.cpuInfo) > numCpus {
+		for cpuNum, cpuInfo := range cfm.cpuInfo {
+			if cpuInfo.scanNum != cfm.scanNum {
+				delete(cfm.cpuInfo, cpuNum)
+			}
+		}
+	}
+
+	if pctFactor > 0 && cfm.intervalMetric != nil {
+		buf.Write(cfm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(cfm.currTs.Sub(cfm.prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+
+	return actualMetricsCount, cfm.totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (cfm *CpufreqMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if cfm.timeNowFn != nil {
+		timeNowFn = cfm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if cfm.metricsQueue != nil {
+		metricsQueue = cfm.metricsQueue
+	}
+
+	firstParse := cfm.cpuFreqIdle == nil
+	if firstParse {
+		sysfsRoot := GlobalSysfsRoot
+		if cfm.sysfsRoot != "" {
+			sysfsRoot = cfm.sysfsRoot
+		}
+		cfm.cpuFreqIdle = sysfs.NewCpuFreqIdle(sysfsRoot)
+	}
+
+	err := cfm.cpuFreqIdle.Parse()
+	if err != nil {
+		cpufreqMetricsLog.Warnf("%v: cpufreq metrics will be disabled", err)
+		return false
+	}
+	if firstParse {
+		available := false
+		for _, cpu := range cfm.cpuFreqIdle.Cpus {
+			if cpu.FreqValid || len(cpu.IdleStates) > 0 {
+				available = true
+				break
+			}
+		}
+		if !available {
+			cpufreqMetricsLog.Info("neither cpufreq nor cpuidle available, cpufreq metrics will be disabled")
+			return false
+		}
+	}
+	cfm.prevTs, cfm.currTs = cfm.currTs, timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := cfm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		cfm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func CpufreqMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	cfm, err := NewCpufreqMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfm.interval <= 0 {
+		cpufreqMetricsLog.Infof(
+			"interval=%s, metrics disabled", cfm.interval,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(cfm.id, cfm.interval, cfm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(CpufreqMetricsTaskBuilder)
+}
@@ -0,0 +1,280 @@
+// Tests for cpufreq_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
+)
+
+type CpufreqMetricsTestCase struct {
+	Name                   string
+	Instance               string
+	Hostname               string
+	CurrPromTs, PrevPromTs int64
+	CycleNum               int
+	// Update the parsed data before generating metrics, simulating a change
+	// from the primed state:
+	UpdateFn         func(cpuFreqIdle *sysfs.CpuFreqIdle)
+	WantMetricsCount int
+	WantMetrics      []string
+	ReportExtra      bool
+	// Whether the CPU info should exist after the metrics generation, indexed
+	// by CPU#:
+	WantCpuInfo map[int]bool
+}
+
+var cpufreqMetricsTestSysfsRoot = path.Join("..", testutils.SysfsTestDataSubdir, "cpu", "field_mapping")
+
+func testCpufreqMetrics(tc *CpufreqMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	cpufreqMetrics, err := NewCpufreqMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpufreqMetrics.instance = tc.Instance
+	cpufreqMetrics.hostname = tc.Hostname
+
+	cpufreqMetrics.cpuFreqIdle = sysfs.NewCpuFreqIdle(cpufreqMetricsTestSysfsRoot)
+	if err := cpufreqMetrics.cpuFreqIdle.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Prime the cache w/ the current state:
+	cpufreqMetrics.currTs = time.UnixMilli(tc.PrevPromTs)
+	cpufreqMetrics.generateMetrics(&bytes.Buffer{})
+
+	if tc.UpdateFn != nil {
+		tc.UpdateFn(cpufreqMetrics.cpuFreqIdle)
+	}
+	for _, cpuInfo := range cpufreqMetrics.cpuInfo {
+		cpuInfo.cycleNum = tc.CycleNum
+	}
+	cpufreqMetrics.prevTs = time.UnixMilli(tc.PrevPromTs)
+	cpufreqMetrics.currTs = time.UnixMilli(tc.CurrPromTs)
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := cpufreqMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+
+	for cpu, wantCpuInfo := range tc.WantCpuInfo {
+		if gotCpuInfo := cpufreqMetrics.cpuInfo[cpu] != nil; wantCpuInfo != gotCpuInfo {
+			fmt.Fprintf(
+				errBuf,
+				"\ncpuInfo[%d] exists: want: %v, got: %v",
+				cpu, wantCpuInfo, gotCpuInfo,
+			)
+		}
+	}
+
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestCpufreqMetrics(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	freqMetrics := func(cpu, cur, min, max string) []string {
+		metrics := make([]string, 0)
+		for _, nameVal := range [][2]string{
+			{"cpufreq_cur_khz", cur},
+			{"cpufreq_min_khz", min},
+			{"cpufreq_max_khz", max},
+		} {
+			if nameVal[1] == "" {
+				continue
+			}
+			metrics = append(metrics, fmt.Sprintf(
+				`%s{instance="%s",hostname="%s",cpu="%s"} %s %d`,
+				nameVal[0], instance, hostname, cpu, nameVal[1], currPromTs,
+			))
+		}
+		return metrics
+	}
+	idleStateMetrics := func(cpu, state, name, timePct, usageDelta string) []string {
+		return []string{
+			fmt.Sprintf(
+				`cpuidle_state_time_pct{instance="%s",hostname="%s",cpu="%s",state="%s",name="%s"} %s %d`,
+				instance, hostname, cpu, state, name, timePct, currPromTs,
+			),
+			fmt.Sprintf(
+				`cpuidle_state_usage_delta{instance="%s",hostname="%s",cpu="%s",state="%s",name="%s"} %s %d`,
+				instance, hostname, cpu, state, name, usageDelta, currPromTs,
+			),
+		}
+	}
+	intervalMetric := fmt.Sprintf(
+		`cpufreq_metrics_delta_sec{instance="%s",hostname="%s"} 5.000000 %d`,
+		instance, hostname, currPromTs,
+	)
+	join := func(metricsList ...[]string) []string {
+		metrics := make([]string, 0)
+		for _, m := range metricsList {
+			metrics = append(metrics, m...)
+		}
+		return metrics
+	}
+
+	// All idle states w/ no change from the primed state:
+	zeroIdleStateMetrics := func(excludeCpu string) []string {
+		metrics := make([]string, 0)
+		for _, cpu := range []string{"0", "1"} {
+			if cpu == excludeCpu {
+				continue
+			}
+			metrics = append(metrics, idleStateMetrics(cpu, "state0", "POLL", "0.0", "0")...)
+			metrics = append(metrics, idleStateMetrics(cpu, "state1", "C1", "0.0", "0")...)
+			metrics = append(metrics, idleStateMetrics(cpu, "state2", "C6", "0.0", "0")...)
+		}
+		if excludeCpu != "3" {
+			metrics = append(metrics, idleStateMetrics("3", "state0", "POLL", "0.0", "0")...)
+			metrics = append(metrics, idleStateMetrics("3", "state1", "C1", "0.0", "0")...)
+		}
+		return metrics
+	}
+
+	for _, tc := range []*CpufreqMetricsTestCase{
+		{
+			Name:     "no_change",
+			CycleNum: 1,
+			WantMetrics: join(
+				zeroIdleStateMetrics(""),
+				[]string{intervalMetric},
+			),
+		},
+		{
+			Name:     "full",
+			CycleNum: 0,
+			WantMetrics: join(
+				freqMetrics("0", "2400000", "800000", "3600000"),
+				freqMetrics("1", "1200000", "800000", "3600000"),
+				zeroIdleStateMetrics(""),
+				[]string{intervalMetric},
+			),
+		},
+		{
+			Name:     "change",
+			CycleNum: 1,
+			UpdateFn: func(cpuFreqIdle *sysfs.CpuFreqIdle) {
+				cpuFreqIdle.Cpus[0].IdleStates[1].Time += 2_500_000
+				cpuFreqIdle.Cpus[0].IdleStates[1].Usage += 100
+				cpuFreqIdle.Cpus[1].CurFreq = 3000000
+				cpuFreqIdle.Cpus[3].IdleStates[0].Time += 50_000
+				cpuFreqIdle.Cpus[3].IdleStates[0].Usage += 5
+			},
+			WantMetrics: join(
+				freqMetrics("1", "3000000", "", ""),
+				idleStateMetrics("0", "state0", "POLL", "0.0", "0"),
+				idleStateMetrics("0", "state1", "C1", "50.0", "100"),
+				idleStateMetrics("0", "state2", "C6", "0.0", "0"),
+				idleStateMetrics("1", "state0", "POLL", "0.0", "0"),
+				idleStateMetrics("1", "state1", "C1", "0.0", "0"),
+				idleStateMetrics("1", "state2", "C6", "0.0", "0"),
+				idleStateMetrics("3", "state0", "POLL", "1.0", "5"),
+				idleStateMetrics("3", "state1", "C1", "0.0", "0"),
+				[]string{intervalMetric},
+			),
+		},
+		{
+			Name:     "cpu_offline",
+			CycleNum: 1,
+			UpdateFn: func(cpuFreqIdle *sysfs.CpuFreqIdle) {
+				cpuFreqIdle.Online = []int{0, 3}
+				delete(cpuFreqIdle.Cpus, 1)
+			},
+			WantMetrics: join(
+				zeroIdleStateMetrics("1"),
+				[]string{intervalMetric},
+			),
+			WantCpuInfo: map[int]bool{0: true, 1: false, 3: true},
+		},
+		{
+			Name:     "cpu_swap",
+			CycleNum: 1,
+			UpdateFn: func(cpuFreqIdle *sysfs.CpuFreqIdle) {
+				cpu := *cpuFreqIdle.Cpus[1]
+				cpu.Cpu = 5
+				cpuFreqIdle.Online = []int{0, 3, 5}
+				delete(cpuFreqIdle.Cpus, 1)
+				cpuFreqIdle.Cpus[5] = &cpu
+			},
+			WantMetrics: join(
+				freqMetrics("5", "1200000", "800000", "3600000"),
+				zeroIdleStateMetrics("1"),
+				[]string{intervalMetric},
+			),
+			WantCpuInfo: map[int]bool{0: true, 1: false, 3: true, 5: true},
+		},
+		{
+			Name:     "cpu_rediscovered",
+			CycleNum: 1,
+			UpdateFn: func(cpuFreqIdle *sysfs.CpuFreqIdle) {
+				// Offline and back online in between scans, w/ the counters
+				// restarted:
+				cpu := *cpuFreqIdle.Cpus[1]
+				cpu.IdleStates = make([]*sysfs.CpuIdleState, len(cpu.IdleStates))
+				for i, idleState := range cpuFreqIdle.Cpus[1].IdleStates {
+					newIdleState := *idleState
+					newIdleState.Time, newIdleState.Usage = 0, 0
+					cpu.IdleStates[i] = &newIdleState
+				}
+				cpuFreqIdle.Cpus[1] = &cpu
+			},
+			WantMetrics: join(
+				freqMetrics("1", "1200000", "800000", "3600000"),
+				zeroIdleStateMetrics("1"),
+				[]string{intervalMetric},
+			),
+			WantCpuInfo: map[int]bool{0: true, 1: true, 3: true},
+		},
+		{
+			Name:     "idle_states_change",
+			CycleNum: 1,
+			UpdateFn: func(cpuFreqIdle *sysfs.CpuFreqIdle) {
+				cpu := cpuFreqIdle.Cpus[3]
+				idleState := *cpu.IdleStates[1]
+				idleState.State, idleState.Name = "state2", "C6"
+				cpu.IdleStates = append(cpu.IdleStates, &idleState)
+			},
+			WantMetrics: join(
+				freqMetrics("3", "", "", ""),
+				zeroIdleStateMetrics("3"),
+				[]string{intervalMetric},
+			),
+			WantCpuInfo: map[int]bool{0: true, 1: true, 3: true},
+		},
+	} {
+		tc.Instance, tc.Hostname = instance, hostname
+		tc.CurrPromTs, tc.PrevPromTs = currPromTs, prevPromTs
+		tc.WantMetricsCount = len(tc.WantMetrics)
+		tc.ReportExtra = true
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testCpufreqMetrics(tc, t) },
+		)
+	}
+}
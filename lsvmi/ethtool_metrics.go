@@ -0,0 +1,357 @@
+// NIC driver stats metrics a-la ethtool -S
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/ethtool"
+)
+
+const (
+	ETHTOOL_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	ETHTOOL_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+	ETHTOOL_METRICS_CONFIG_STAT_NAME_REGEX_DEFAULT     = `err|drop|miss|discard|crc|fifo|over|timeout|lost|fail`
+
+	// This generator id:
+	ETHTOOL_METRICS_ID = "ethtool_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",dev="eth0",stat="rx_missed_errors"}:
+	ETHTOOL_STAT_DELTA_METRIC = "ethtool_stat_delta"
+
+	// Use the same label as proc_net_dev_metrics, to allow joins:
+	ETHTOOL_DEV_LABEL_NAME  = PROC_NET_DEV_LABEL_NAME
+	ETHTOOL_STAT_LABEL_NAME = "stat"
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	ETHTOOL_INTERVAL_METRIC = "ethtool_metrics_delta_sec"
+)
+
+var ethtoolMetricsLog = NewCompLogger(ETHTOOL_METRICS_ID)
+
+type EthtoolMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The regex used for selecting the stats by name; use "" to select all the
+	// stats, which may be a large number for multi-queue NICs:
+	StatNameRegex string `yaml:"stat_name_regex"`
+}
+
+func DefaultEthtoolMetricsConfig() *EthtoolMetricsConfig {
+	return &EthtoolMetricsConfig{
+		Interval:          ETHTOOL_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: ETHTOOL_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		StatNameRegex:     ETHTOOL_METRICS_CONFIG_STAT_NAME_REGEX_DEFAULT,
+	}
+}
+
+// Each interface will have some info cached, such as metrics, cycle#, etc:
+type EthtoolMetricsInfo struct {
+	// Delta metrics, in the same order as the stats:
+	deltaMetrics [][]byte
+
+	// Delta metrics are skipped for zero-after-zero, keep track of previous
+	// condition:
+	zeroDelta []bool
+
+	// Cycle#:
+	cycleNum int
+}
+
+type EthtoolMetrics struct {
+	// id/task_id:
+	id string
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// Stat selection regex, nil for all:
+	statNameRegex *regexp.Regexp
+
+	// Dual storage for parsed stats used as previous, current:
+	ethtoolStats [2]*ethtool.EthtoolStats
+	// Timestamp when the stats were collected:
+	ethtoolStatsTs [2]time.Time
+	// Index for current stats, toggled after each use:
+	currIndex int
+
+	// Interface info, indexed by interface index:
+	ethtoolMetricsInfoMap map[uint32]*EthtoolMetricsInfo
+
+	// Interval metric:
+	intervalMetric []byte
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+}
+
+func NewEthtoolMetrics(cfg any) (*EthtoolMetrics, error) {
+	var (
+		err               error
+		ethtoolMetricsCfg *EthtoolMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		ethtoolMetricsCfg = cfg.EthtoolMetricsConfig
+	case *EthtoolMetricsConfig:
+		ethtoolMetricsCfg = cfg
+	case nil:
+		ethtoolMetricsCfg = DefaultEthtoolMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewEthtoolMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(ethtoolMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	ethtoolMetrics := &EthtoolMetrics{
+		id:                    ETHTOOL_METRICS_ID,
+		interval:              interval,
+		fullMetricsFactor:     ethtoolMetricsCfg.FullMetricsFactor,
+		ethtoolMetricsInfoMap: make(map[uint32]*EthtoolMetricsInfo),
+		tsSuffixBuf:           &bytes.Buffer{},
+	}
+	if ethtoolMetricsCfg.StatNameRegex != "" {
+		ethtoolMetrics.statNameRegex, err = regexp.Compile(ethtoolMetricsCfg.StatNameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("stat_name_regex: %q: %v", ethtoolMetricsCfg.StatNameRegex, err)
+		}
+	}
+
+	ethtoolMetricsLog.Infof("id=%s", ethtoolMetrics.id)
+	ethtoolMetricsLog.Infof("interval=%s", ethtoolMetrics.interval)
+	ethtoolMetricsLog.Infof("full_metrics_factor=%d", ethtoolMetrics.fullMetricsFactor)
+	ethtoolMetricsLog.Infof("stat_name_regex=%q", ethtoolMetricsCfg.StatNameRegex)
+	return ethtoolMetrics, nil
+}
+
+func (em *EthtoolMetrics) updateEthtoolMetricsInfo(ifIndex uint32, ifStats *ethtool.EthtoolIfStats) {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if em.instance != "" {
+		instance = em.instance
+	}
+	if em.hostname != "" {
+		hostname = em.hostname
+	}
+
+	emi := &EthtoolMetricsInfo{
+		deltaMetrics: make([][]byte, len(ifStats.Names)),
+		zeroDelta:    make([]bool, len(ifStats.Names)),
+		cycleNum:     initialCycleNum.Get(em.fullMetricsFactor),
+	}
+	for i, name := range ifStats.Names {
+		emi.deltaMetrics[i] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. include space before value
+			ETHTOOL_STAT_DELTA_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			ETHTOOL_DEV_LABEL_NAME, ifStats.IfName,
+			ETHTOOL_STAT_LABEL_NAME, name,
+		))
+	}
+
+	em.ethtoolMetricsInfoMap[ifIndex] = emi
+}
+
+func (em *EthtoolMetrics) updateIntervalMetric() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if em.instance != "" {
+		instance = em.instance
+	}
+	if em.hostname != "" {
+		hostname = em.hostname
+	}
+	em.intervalMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"} `, // N.B. include space before value
+		ETHTOOL_INTERVAL_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+	))
+}
+
+// Whether the stats set is the same for current and previous stats, i.e. deltas
+// can be computed:
+func ethtoolSameStatsSet(currIfStats, prevIfStats *ethtool.EthtoolIfStats) bool {
+	if currIfStats.IfName != prevIfStats.IfName ||
+		len(currIfStats.Names) != len(prevIfStats.Names) ||
+		len(currIfStats.Stats) != len(prevIfStats.Stats) {
+		return false
+	}
+	for i, name := range currIfStats.Names {
+		if name != prevIfStats.Names[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (em *EthtoolMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	currEthtoolStats, prevEthtoolStats := em.ethtoolStats[em.currIndex], em.ethtoolStats[1-em.currIndex]
+	currTs, prevTs := em.ethtoolStatsTs[em.currIndex], em.ethtoolStatsTs[1-em.currIndex]
+	em.currIndex = 1 - em.currIndex
+
+	// Since all metrics are delta, a previous state is required:
+	if prevEthtoolStats == nil {
+		return 0, 0
+	}
+
+	actualMetricsCount := 0
+	em.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		em.tsSuffixBuf, " %d\n", currTs.UnixMilli(),
+	)
+	promTs := em.tsSuffixBuf.Bytes()
+	totalMetricsCount := 0
+
+	for ifIndex, currIfStats := range currEthtoolStats.Info {
+		ethtoolMetricsInfo := em.ethtoolMetricsInfoMap[ifIndex]
+		prevIfStats := prevEthtoolStats.Info[ifIndex]
+		if prevIfStats == nil || !ethtoolSameStatsSet(currIfStats, prevIfStats) {
+			// New interface or the stats set has changed; the metrics will be
+			// generated starting w/ the next scan, when the deltas become
+			// available:
+			if ethtoolMetricsInfo != nil {
+				delete(em.ethtoolMetricsInfoMap, ifIndex)
+			}
+			continue
+		}
+
+		fullMetrics := ethtoolMetricsInfo == nil || ethtoolMetricsInfo.cycleNum == 0
+		if ethtoolMetricsInfo == nil {
+			em.updateEthtoolMetricsInfo(ifIndex, currIfStats)
+			ethtoolMetricsInfo = em.ethtoolMetricsInfoMap[ifIndex]
+		}
+
+		prevStats := prevIfStats.Stats
+		for i, currVal := range currIfStats.Stats {
+			// Driver stats are reset when the NIC is reset, in which case the
+			// delta is computed against 0:
+			val := currVal
+			if prevVal := prevStats[i]; currVal >= prevVal {
+				val -= prevVal
+			}
+			if fullMetrics || val > 0 || !ethtoolMetricsInfo.zeroDelta[i] {
+				buf.Write(ethtoolMetricsInfo.deltaMetrics[i])
+				buf.WriteString(strconv.FormatUint(val, 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			ethtoolMetricsInfo.zeroDelta[i] = val == 0
+		}
+		totalMetricsCount += len(currIfStats.Stats)
+
+		if ethtoolMetricsInfo.cycleNum++; ethtoolMetricsInfo.cycleNum >= em.fullMetricsFactor {
+			ethtoolMetricsInfo.cycleNum = 0
+		}
+	}
+
+	// Remove out-of-scope interfaces as needed:
+	if len(em.ethtoolMetricsInfoMap) > len(currEthtoolStats.Info) {
+		for ifIndex := range em.ethtoolMetricsInfoMap {
+			if currEthtoolStats.Info[ifIndex] == nil {
+				delete(em.ethtoolMetricsInfoMap, ifIndex)
+			}
+		}
+	}
+
+	if em.intervalMetric == nil {
+		em.updateIntervalMetric()
+	}
+	buf.Write(em.intervalMetric)
+	buf.WriteString(strconv.FormatFloat(currTs.Sub(prevTs).Seconds(), 'f', 6, 64))
+	buf.Write(promTs)
+	actualMetricsCount++
+	totalMetricsCount++
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (em *EthtoolMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if em.timeNowFn != nil {
+		timeNowFn = em.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if em.metricsQueue != nil {
+		metricsQueue = em.metricsQueue
+	}
+
+	currEthtoolStats := em.ethtoolStats[em.currIndex]
+	if currEthtoolStats == nil {
+		prevEthtoolStats := em.ethtoolStats[1-em.currIndex]
+		if prevEthtoolStats != nil {
+			currEthtoolStats = prevEthtoolStats.Clone()
+		} else {
+			currEthtoolStats = ethtool.NewEthtoolStats(em.statNameRegex)
+		}
+		em.ethtoolStats[em.currIndex] = currEthtoolStats
+	}
+	err := currEthtoolStats.Parse()
+	if err != nil {
+		ethtoolMetricsLog.Warnf("%v: ethtool metrics will be disabled", err)
+		return false
+	}
+	em.ethtoolStatsTs[em.currIndex] = timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := em.generateMetrics(buf)
+	if totalMetricsCount > 0 {
+		byteCount := buf.Len()
+		metricsQueue.QueueBuf(buf)
+		GlobalMetricsGeneratorStatsContainer.Update(
+			em.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+		)
+	} else {
+		metricsQueue.ReturnBuf(buf)
+	}
+
+	return true
+}
+
+// Define and register the task builder:
+func EthtoolMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	em, err := NewEthtoolMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if em.interval <= 0 {
+		ethtoolMetricsLog.Infof(
+			"interval=%s, metrics disabled", em.interval,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(em.id, em.interval, em),
+	}
+	return tasks, nil
+}
+
+func init() {
+	if ethtool.EthtoolAvailable {
+		TaskBuilders.Register(EthtoolMetricsTaskBuilder)
+	}
+}
@@ -0,0 +1,249 @@
+// Tests for ethtool_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/ethtool"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type EthtoolMetricsInfoTestData struct {
+	IfIndex   uint32
+	ZeroDelta []bool
+	CycleNum  int
+}
+
+type EthtoolMetricsTestCase struct {
+	Name                               string
+	CurrEthtoolStats, PrevEthtoolStats map[uint32]*ethtool.EthtoolIfStats
+	CurrPromTs, PrevPromTs             int64
+	EthtoolMetricsInfo                 []EthtoolMetricsInfoTestData
+	FullMetricsFactor                  int
+	WantMetricsCount                   int
+	WantMetrics                        []string
+	ReportExtra                        bool
+	// The expected interfaces in the metrics cache:
+	WantIfIndexes []uint32
+}
+
+func testEthtoolMetrics(tc *EthtoolMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	ethtoolMetrics, err := NewEthtoolMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ethtoolMetrics.instance = "lsvmi-test"
+	ethtoolMetrics.hostname = "lsvmi-test-host"
+	ethtoolMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	currIndex := ethtoolMetrics.currIndex
+
+	prevEthtoolStats := ethtool.NewEthtoolStats(nil)
+	for ifIndex, ifStats := range tc.PrevEthtoolStats {
+		prevEthtoolStats.Info[ifIndex] = ifStats
+	}
+	currEthtoolStats := prevEthtoolStats.Clone()
+	clear(currEthtoolStats.Info)
+	for ifIndex, ifStats := range tc.CurrEthtoolStats {
+		currEthtoolStats.Info[ifIndex] = ifStats
+	}
+
+	ethtoolMetrics.ethtoolStats[currIndex] = currEthtoolStats
+	ethtoolMetrics.ethtoolStats[1-currIndex] = prevEthtoolStats
+	ethtoolMetrics.ethtoolStatsTs[currIndex] = time.UnixMilli(tc.CurrPromTs)
+	ethtoolMetrics.ethtoolStatsTs[1-currIndex] = time.UnixMilli(tc.PrevPromTs)
+
+	for _, emiTD := range tc.EthtoolMetricsInfo {
+		if ifStats := tc.PrevEthtoolStats[emiTD.IfIndex]; ifStats != nil {
+			ethtoolMetrics.updateEthtoolMetricsInfo(emiTD.IfIndex, ifStats)
+			emi := ethtoolMetrics.ethtoolMetricsInfoMap[emiTD.IfIndex]
+			copy(emi.zeroDelta, emiTD.ZeroDelta)
+			emi.cycleNum = emiTD.CycleNum
+		}
+	}
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := ethtoolMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+
+	if wantCurrIndex, gotCurrIndex := 1-currIndex, ethtoolMetrics.currIndex; wantCurrIndex != gotCurrIndex {
+		fmt.Fprintf(
+			errBuf,
+			"\ncurrIndex: want: %d, got: %d",
+			wantCurrIndex, gotCurrIndex,
+		)
+	}
+
+	if tc.WantIfIndexes != nil {
+		if len(tc.WantIfIndexes) != len(ethtoolMetrics.ethtoolMetricsInfoMap) {
+			fmt.Fprintf(
+				errBuf,
+				"\nlen(ethtoolMetricsInfoMap): want: %d, got: %d",
+				len(tc.WantIfIndexes), len(ethtoolMetrics.ethtoolMetricsInfoMap),
+			)
+		}
+		for _, ifIndex := range tc.WantIfIndexes {
+			if ethtoolMetrics.ethtoolMetricsInfoMap[ifIndex] == nil {
+				fmt.Fprintf(errBuf, "\nethtoolMetricsInfoMap[%d]: missing", ifIndex)
+			}
+		}
+	}
+
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestEthtoolMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	prevPromTs := int64(1_700_000_000_000)
+	currPromTs := prevPromTs + 5000
+
+	names := []string{"rx_missed_errors", "rx_crc_errors", "rx_queue_0_drops"}
+	newIfStats := func(ifName string, names []string, stats ...uint64) *ethtool.EthtoolIfStats {
+		return &ethtool.EthtoolIfStats{
+			IfName: ifName,
+			Names:  names,
+			Stats:  stats,
+		}
+	}
+
+	for _, tc := range []*EthtoolMetricsTestCase{
+		{
+			Name: "new",
+			PrevEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 10, 0, 100),
+			},
+			CurrEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 12, 0, 100),
+			},
+			PrevPromTs:        prevPromTs,
+			CurrPromTs:        currPromTs,
+			FullMetricsFactor: 12,
+			WantMetricsCount:  4,
+			WantMetrics: []string{
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_missed_errors"} 2 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_crc_errors"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_queue_0_drops"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra:   true,
+			WantIfIndexes: []uint32{2},
+		},
+		{
+			Name: "zero_after_zero",
+			PrevEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 10, 0, 100),
+			},
+			CurrEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 10, 0, 103),
+			},
+			PrevPromTs: prevPromTs,
+			CurrPromTs: currPromTs,
+			EthtoolMetricsInfo: []EthtoolMetricsInfoTestData{
+				{IfIndex: 2, ZeroDelta: []bool{false, true, true}, CycleNum: 1},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  3,
+			WantMetrics: []string{
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_missed_errors"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_queue_0_drops"} 3 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra:   true,
+			WantIfIndexes: []uint32{2},
+		},
+		{
+			Name: "full_cycle_and_reset",
+			PrevEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 10, 0, 100),
+			},
+			CurrEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 1, 0, 100),
+			},
+			PrevPromTs: prevPromTs,
+			CurrPromTs: currPromTs,
+			EthtoolMetricsInfo: []EthtoolMetricsInfoTestData{
+				{IfIndex: 2, ZeroDelta: []bool{true, true, true}, CycleNum: 0},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  4,
+			WantMetrics: []string{
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_missed_errors"} 1 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_crc_errors"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_stat_delta{%s,dev="eth0",stat="rx_queue_0_drops"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`ethtool_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra:   true,
+			WantIfIndexes: []uint32{2},
+		},
+		{
+			Name: "stats_set_change",
+			PrevEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 10, 0, 100),
+			},
+			CurrEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names[:2], 10, 0),
+			},
+			PrevPromTs: prevPromTs,
+			CurrPromTs: currPromTs,
+			EthtoolMetricsInfo: []EthtoolMetricsInfoTestData{
+				{IfIndex: 2, ZeroDelta: []bool{true, true, true}, CycleNum: 1},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  1,
+			WantMetrics: []string{
+				fmt.Sprintf(`ethtool_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra:   true,
+			WantIfIndexes: []uint32{},
+		},
+		{
+			Name: "out_of_scope",
+			PrevEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				2: newIfStats("eth0", names, 10, 0, 100),
+				3: newIfStats("eth1", names, 10, 0, 100),
+			},
+			CurrEthtoolStats: map[uint32]*ethtool.EthtoolIfStats{
+				3: newIfStats("eth1", names, 10, 0, 100),
+			},
+			PrevPromTs: prevPromTs,
+			CurrPromTs: currPromTs,
+			EthtoolMetricsInfo: []EthtoolMetricsInfoTestData{
+				{IfIndex: 2, ZeroDelta: []bool{true, true, true}, CycleNum: 1},
+				{IfIndex: 3, ZeroDelta: []bool{true, true, true}, CycleNum: 1},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  1,
+			WantMetrics: []string{
+				fmt.Sprintf(`ethtool_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra:   true,
+			WantIfIndexes: []uint32{3},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testEthtoolMetrics(tc, t) },
+		)
+	}
+}
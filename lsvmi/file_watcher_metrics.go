@@ -0,0 +1,542 @@
+// Generic metrics based on user configured procfs/sysfs files, e.g.
+// /proc/sys/net/core/somaxconn, /proc/sys/vm/swappiness.
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/utils"
+)
+
+const (
+	FILE_WATCHER_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	FILE_WATCHER_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+
+	// This generator id:
+	FILE_WATCHER_METRICS_ID = "file_watcher_metrics"
+)
+
+const (
+	// The roots:
+	FILE_WATCHER_ROOT_PROCFS = "procfs"
+	FILE_WATCHER_ROOT_SYSFS  = "sysfs"
+
+	// The value types:
+	FILE_WATCHER_TYPE_GAUGE = "gauge"
+	FILE_WATCHER_TYPE_DELTA = "delta"
+	FILE_WATCHER_TYPE_INFO  = "info"
+
+	// The label used for the value of info type files:
+	FILE_WATCHER_INFO_VALUE_LABEL_NAME = "value"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",root="ROOT",path="PATH"}:
+	FILE_WATCHER_READ_ERROR_COUNT_METRIC = "file_watcher_read_error_count"
+
+	FILE_WATCHER_ROOT_LABEL_NAME = "root"
+	FILE_WATCHER_PATH_LABEL_NAME = "path"
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	FILE_WATCHER_INTERVAL_METRIC = "file_watcher_metrics_delta_sec"
+)
+
+var fileWatcherMetricsLog = NewCompLogger(FILE_WATCHER_METRICS_ID)
+
+// The watched files hold, typically, small values:
+var fileWatcherReadFileBufPool = utils.NewReadFileBufPool(16, 0x1000)
+
+// Prometheus metric and label name syntax:
+var (
+	fileWatcherMetricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	fileWatcherLabelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Label names set by the generator, they cannot be used in config:
+var fileWatcherReservedLabelNames = map[string]bool{
+	INSTANCE_LABEL_NAME:                true,
+	HOSTNAME_LABEL_NAME:                true,
+	FILE_WATCHER_INFO_VALUE_LABEL_NAME: true,
+}
+
+// Escape the value of a label built from the file content:
+var fileWatcherLabelValueReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+type FileWatcherFileConfig struct {
+	// The root: procfs (default) or sysfs:
+	Root string `yaml:"root"`
+	// The path, relative to the root, e.g. sys/net/core/somaxconn:
+	Path string `yaml:"path"`
+	// The metric name:
+	Metric string `yaml:"metric"`
+	// The value type:
+	//  gauge: the file holds a numerical value, used as-is (default)
+	//  delta: the file holds an unsigned integer counter, the metric is the
+	//         delta since the previous scan
+	//  info:  the file holds a string, the metric is pseudo-categorical with
+	//         the content as value="..." label
+	Type string `yaml:"type"`
+	// Optional labels, added to the metric:
+	Labels map[string]string `yaml:"labels"`
+}
+
+type FileWatcherMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The list of files to watch; the generator is disabled if empty:
+	Files []*FileWatcherFileConfig `yaml:"files"`
+}
+
+func DefaultFileWatcherMetricsConfig() *FileWatcherMetricsConfig {
+	return &FileWatcherMetricsConfig{
+		Interval:          FILE_WATCHER_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: FILE_WATCHER_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+// Per file state:
+type FileWatcherFile struct {
+	// As configured:
+	root, path, metricName, valueType string
+	// The label set, as `,NAME="VALUE",...`, sorted by label name:
+	labels string
+
+	// The content of the most recent read, trimmed, and whether the read (and
+	// the parse, as the case may be) was successful or not:
+	content string
+	ok      bool
+	// The cumulative read/parse error count:
+	errCount uint64
+
+	// Gauge and delta metric, w/o value:
+	metric []byte
+	// Info metric, w/ all the labels, w/o value, as of the most recent
+	// generation:
+	infoMetric []byte
+
+	// Gauge: the previous value, used for change detection:
+	prevVal string
+	// Delta: the previous counter, whether it is valid and whether the
+	// previous delta was zero:
+	prevCounter      uint64
+	prevCounterValid bool
+	zeroDelta        bool
+	// The counter value, for the most recent read:
+	counter uint64
+
+	// Read error count metric, w/o value and the previous value:
+	errCountMetric []byte
+	prevErrCount   uint64
+}
+
+type FileWatcherMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The watched files, in config order:
+	files []*FileWatcherFile
+
+	// Whether there are delta type files or not, i.e. whether the interval
+	// metric is needed:
+	hasDelta bool
+
+	// Timestamps of the current and previous scan:
+	currTs, prevTs time.Time
+
+	// Whether the metrics cache was built or not:
+	metricsCacheBuilt bool
+	// Interval metric:
+	intervalMetric []byte
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+	sysfsRoot          string
+}
+
+func newFileWatcherFile(fileCfg *FileWatcherFileConfig) (*FileWatcherFile, error) {
+	file := &FileWatcherFile{
+		root:       fileCfg.Root,
+		path:       fileCfg.Path,
+		metricName: fileCfg.Metric,
+		valueType:  fileCfg.Type,
+	}
+	if file.root == "" {
+		file.root = FILE_WATCHER_ROOT_PROCFS
+	}
+	if file.valueType == "" {
+		file.valueType = FILE_WATCHER_TYPE_GAUGE
+	}
+
+	switch file.root {
+	case FILE_WATCHER_ROOT_PROCFS, FILE_WATCHER_ROOT_SYSFS:
+	default:
+		return nil, fmt.Errorf("%q: invalid root", file.root)
+	}
+	if file.path == "" || path.IsAbs(file.path) {
+		return nil, fmt.Errorf("%q: path must be relative to root", file.path)
+	}
+	if cleanPath := path.Clean(file.path); cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+		return nil, fmt.Errorf("%q: path must be under root", file.path)
+	}
+	if !fileWatcherMetricNameRe.MatchString(file.metricName) {
+		return nil, fmt.Errorf("%s: %q: invalid metric", file.path, file.metricName)
+	}
+	switch file.valueType {
+	case FILE_WATCHER_TYPE_GAUGE, FILE_WATCHER_TYPE_DELTA, FILE_WATCHER_TYPE_INFO:
+	default:
+		return nil, fmt.Errorf("%s: %q: invalid type", file.path, file.valueType)
+	}
+
+	labelNames := make([]string, 0, len(fileCfg.Labels))
+	for name := range fileCfg.Labels {
+		if !fileWatcherLabelNameRe.MatchString(name) || fileWatcherReservedLabelNames[name] {
+			return nil, fmt.Errorf("%s: %q: invalid label", file.path, name)
+		}
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+	labels := &bytes.Buffer{}
+	for _, name := range labelNames {
+		fmt.Fprintf(labels, `,%s="%s"`, name, fileWatcherLabelValueReplacer.Replace(fileCfg.Labels[name]))
+	}
+	file.labels = labels.String()
+
+	return file, nil
+}
+
+func NewFileWatcherMetrics(cfg any) (*FileWatcherMetrics, error) {
+	var (
+		err                   error
+		fileWatcherMetricsCfg *FileWatcherMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		fileWatcherMetricsCfg = cfg.FileWatcherMetricsConfig
+	case *FileWatcherMetricsConfig:
+		fileWatcherMetricsCfg = cfg
+	case nil:
+		fileWatcherMetricsCfg = DefaultFileWatcherMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewFileWatcherMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(fileWatcherMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	fileWatcherMetrics := &FileWatcherMetrics{
+		id:                FILE_WATCHER_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: fileWatcherMetricsCfg.FullMetricsFactor,
+		files:             make([]*FileWatcherFile, 0, len(fileWatcherMetricsCfg.Files)),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+	for _, fileCfg := range fileWatcherMetricsCfg.Files {
+		file, err := newFileWatcherFile(fileCfg)
+		if err != nil {
+			return nil, fmt.Errorf("NewFileWatcherMetrics: files: %v", err)
+		}
+		fileWatcherMetrics.files = append(fileWatcherMetrics.files, file)
+		if file.valueType == FILE_WATCHER_TYPE_DELTA {
+			fileWatcherMetrics.hasDelta = true
+		}
+	}
+
+	fileWatcherMetricsLog.Infof("id=%s", fileWatcherMetrics.id)
+	fileWatcherMetricsLog.Infof("interval=%s", fileWatcherMetrics.interval)
+	fileWatcherMetricsLog.Infof("full_metrics_factor=%d", fileWatcherMetrics.fullMetricsFactor)
+	for _, file := range fileWatcherMetrics.files {
+		fileWatcherMetricsLog.Infof(
+			"file: root=%s, path=%s, metric=%s, type=%s", file.root, file.path, file.metricName, file.valueType,
+		)
+	}
+	return fileWatcherMetrics, nil
+}
+
+func (fwm *FileWatcherMetrics) updateMetricsCache() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if fwm.instance != "" {
+		instance = fwm.instance
+	}
+	if fwm.hostname != "" {
+		hostname = fwm.hostname
+	}
+
+	for _, file := range fwm.files {
+		if file.valueType != FILE_WATCHER_TYPE_INFO {
+			file.metric = []byte(fmt.Sprintf(
+				`%s{%s="%s",%s="%s"%s} `, // N.B. the space before the value is included!
+				file.metricName,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				file.labels,
+			))
+		}
+		file.errCountMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			FILE_WATCHER_READ_ERROR_COUNT_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			FILE_WATCHER_ROOT_LABEL_NAME, file.root,
+			FILE_WATCHER_PATH_LABEL_NAME, file.path,
+		))
+	}
+	fwm.intervalMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		FILE_WATCHER_INTERVAL_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+	))
+	fwm.cycleNum = initialCycleNum.Get(fwm.fullMetricsFactor)
+	fwm.metricsCacheBuilt = true
+}
+
+// Build the info metric for the current content, w/o value:
+func (fwm *FileWatcherMetrics) buildInfoMetric(file *FileWatcherFile) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if fwm.instance != "" {
+		instance = fwm.instance
+	}
+	if fwm.hostname != "" {
+		hostname = fwm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"%s,%s="%s"} `, // N.B. the space before the value is included!
+		file.metricName,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		file.labels,
+		FILE_WATCHER_INFO_VALUE_LABEL_NAME, fileWatcherLabelValueReplacer.Replace(file.content),
+	))
+}
+
+// Read the files and validate the content based on type. Read errors are
+// counted, they do not abort the scan.
+func (fwm *FileWatcherMetrics) readFiles() {
+	procfsRoot, sysfsRoot := GlobalProcfsRoot, GlobalSysfsRoot
+	if fwm.procfsRoot != "" {
+		procfsRoot = fwm.procfsRoot
+	}
+	if fwm.sysfsRoot != "" {
+		sysfsRoot = fwm.sysfsRoot
+	}
+
+	for _, file := range fwm.files {
+		root := procfsRoot
+		if file.root == FILE_WATCHER_ROOT_SYSFS {
+			root = sysfsRoot
+		}
+		filePath := path.Join(root, file.path)
+		fBuf, err := fileWatcherReadFileBufPool.ReadFile(filePath)
+		if err == nil {
+			file.content = string(bytes.TrimSpace(fBuf.Bytes()))
+		}
+		fileWatcherReadFileBufPool.ReturnBuf(fBuf)
+		if err == nil {
+			switch file.valueType {
+			case FILE_WATCHER_TYPE_GAUGE:
+				_, err = strconv.ParseFloat(file.content, 64)
+			case FILE_WATCHER_TYPE_DELTA:
+				file.counter, err = strconv.ParseUint(file.content, 10, 64)
+			}
+		}
+		file.ok = err == nil
+		if !file.ok {
+			if file.errCount == 0 {
+				// Log only the 1st error, to avoid flooding the log:
+				fileWatcherMetricsLog.Warnf("%s: %v", filePath, err)
+			}
+			file.errCount++
+		}
+	}
+}
+
+func (fwm *FileWatcherMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	if !fwm.metricsCacheBuilt {
+		fwm.updateMetricsCache()
+	}
+
+	actualMetricsCount := 0
+	fwm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		fwm.tsSuffixBuf, " %d\n", fwm.currTs.UnixMilli(),
+	)
+	promTs := fwm.tsSuffixBuf.Bytes()
+
+	fullMetrics := fwm.cycleNum == 0
+	totalMetricsCount := 0
+
+	for _, file := range fwm.files {
+		if file.ok {
+			switch file.valueType {
+			case FILE_WATCHER_TYPE_GAUGE:
+				if fullMetrics || file.content != file.prevVal {
+					buf.Write(file.metric)
+					buf.WriteString(file.content)
+					buf.Write(promTs)
+					actualMetricsCount++
+					file.prevVal = file.content
+				}
+				totalMetricsCount++
+			case FILE_WATCHER_TYPE_DELTA:
+				// Deltas require a previous value:
+				if file.prevCounterValid {
+					// The counter may go backwards, e.g. module reload, in
+					// which case the delta is computed against 0:
+					delta := file.counter
+					if delta >= file.prevCounter {
+						delta -= file.prevCounter
+					}
+					if delta != 0 || fullMetrics || !file.zeroDelta {
+						buf.Write(file.metric)
+						buf.WriteString(strconv.FormatUint(delta, 10))
+						buf.Write(promTs)
+						actualMetricsCount++
+					}
+					file.zeroDelta = delta == 0
+					totalMetricsCount++
+				}
+				file.prevCounter, file.prevCounterValid = file.counter, true
+			case FILE_WATCHER_TYPE_INFO:
+				// Pseudo-categorical metric, clear the previous one if the
+				// content changed:
+				infoMetric := fwm.buildInfoMetric(file)
+				changed := !bytes.Equal(file.infoMetric, infoMetric)
+				if changed && file.infoMetric != nil {
+					buf.Write(file.infoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				if changed || fullMetrics {
+					buf.Write(infoMetric)
+					buf.WriteByte('1')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				file.infoMetric = infoMetric
+				totalMetricsCount++
+			}
+		} else {
+			// The delta cannot be computed across a failed read:
+			file.prevCounterValid = false
+			file.zeroDelta = false
+			// The content is no longer known, clear the info metric:
+			if file.infoMetric != nil {
+				buf.Write(file.infoMetric)
+				buf.WriteByte('0')
+				buf.Write(promTs)
+				actualMetricsCount++
+				file.infoMetric = nil
+			}
+		}
+
+		if fullMetrics || file.errCount != file.prevErrCount {
+			buf.Write(file.errCountMetric)
+			buf.WriteString(strconv.FormatUint(file.errCount, 10))
+			buf.Write(promTs)
+			actualMetricsCount++
+			file.prevErrCount = file.errCount
+		}
+		totalMetricsCount++
+	}
+
+	if fwm.hasDelta && !fwm.prevTs.IsZero() {
+		buf.Write(fwm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(fwm.currTs.Sub(fwm.prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+		totalMetricsCount++
+	}
+
+	if fwm.cycleNum++; fwm.cycleNum >= fwm.fullMetricsFactor {
+		fwm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (fwm *FileWatcherMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if fwm.timeNowFn != nil {
+		timeNowFn = fwm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if fwm.metricsQueue != nil {
+		metricsQueue = fwm.metricsQueue
+	}
+
+	fwm.readFiles()
+	fwm.prevTs, fwm.currTs = fwm.currTs, timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := fwm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		fwm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func FileWatcherMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	fwm, err := NewFileWatcherMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if fwm.interval <= 0 {
+		fileWatcherMetricsLog.Infof(
+			"interval=%s, metrics disabled", fwm.interval,
+		)
+		return nil, nil
+	}
+	if len(fwm.files) == 0 {
+		fileWatcherMetricsLog.Info("no files configured, metrics disabled")
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(fwm.id, fwm.interval, fwm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(FileWatcherMetricsTaskBuilder)
+}
@@ -0,0 +1,311 @@
+// Tests for file_watcher_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type FileWatcherMetricsTestCase struct {
+	Name  string
+	Files []*FileWatcherFileConfig
+	// The sequence of file contents, indexed by root/path; a missing entry
+	// denotes a missing file. Metrics are checked after the last one:
+	ContentSeq        []map[string]string
+	FullMetricsFactor int
+	WantMetricsCount  int
+	WantMetrics       []string
+	ReportExtra       bool
+}
+
+func testFileWatcherMetrics(tc *FileWatcherMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	fileWatcherMetricsCfg := DefaultFileWatcherMetricsConfig()
+	fileWatcherMetricsCfg.FullMetricsFactor = tc.FullMetricsFactor
+	fileWatcherMetricsCfg.Files = tc.Files
+	fileWatcherMetrics, err := NewFileWatcherMetrics(fileWatcherMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileWatcherMetrics.instance = "lsvmi-test"
+	fileWatcherMetrics.hostname = "lsvmi-test-host"
+	rootDir := t.TempDir()
+	fileWatcherMetrics.procfsRoot = path.Join(rootDir, FILE_WATCHER_ROOT_PROCFS)
+	fileWatcherMetrics.sysfsRoot = path.Join(rootDir, FILE_WATCHER_ROOT_SYSFS)
+
+	ts := time.UnixMilli(1_700_000_000_000)
+	var testMetricsQueue *testutils.TestMetricsQueue
+	gotMetricsCount := 0
+	for _, contents := range tc.ContentSeq {
+		for _, file := range fileWatcherMetrics.files {
+			filePath := path.Join(rootDir, file.root, file.path)
+			content, ok := contents[path.Join(file.root, file.path)]
+			if !ok {
+				os.Remove(filePath)
+				continue
+			}
+			if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fileWatcherMetrics.readFiles()
+		fileWatcherMetrics.prevTs, fileWatcherMetrics.currTs = fileWatcherMetrics.currTs, ts
+		testMetricsQueue = testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ = fileWatcherMetrics.generateMetrics(buf)
+		testMetricsQueue.QueueBuf(buf)
+		ts = ts.Add(5 * time.Second)
+	}
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestFileWatcherMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_005_000)
+
+	files := []*FileWatcherFileConfig{
+		{
+			Path:   "sys/net/core/somaxconn",
+			Metric: "sysctl_net_core_somaxconn",
+		},
+		{
+			Path:   "sys/fs/counter",
+			Metric: "test_counter_delta",
+			Type:   FILE_WATCHER_TYPE_DELTA,
+			Labels: map[string]string{"b": "2", "a": "1"},
+		},
+		{
+			Root:   FILE_WATCHER_ROOT_SYSFS,
+			Path:   "kernel/mm/transparent_hugepage/enabled",
+			Metric: "thp_enabled_info",
+			Type:   FILE_WATCHER_TYPE_INFO,
+		},
+	}
+
+	for _, tc := range []*FileWatcherMetricsTestCase{
+		{
+			Name:  "full",
+			Files: files,
+			ContentSeq: []map[string]string{
+				{
+					"procfs/sys/net/core/somaxconn":                "4096\n",
+					"procfs/sys/fs/counter":                        "100\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+				{
+					"procfs/sys/net/core/somaxconn":                "4096\n",
+					"procfs/sys/fs/counter":                        "150\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+			},
+			FullMetricsFactor: 0,
+			WantMetricsCount:  7,
+			WantMetrics: []string{
+				fmt.Sprintf(`sysctl_net_core_somaxconn{%s} 4096 %d`, labels, promTs),
+				fmt.Sprintf(`test_counter_delta{%s,a="1",b="2"} 50 %d`, labels, promTs),
+				fmt.Sprintf(`thp_enabled_info{%s,value="always [madvise] never"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_read_error_count{%s,root="procfs",path="sys/net/core/somaxconn"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_read_error_count{%s,root="procfs",path="sys/fs/counter"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_read_error_count{%s,root="sysfs",path="kernel/mm/transparent_hugepage/enabled"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name:  "partial",
+			Files: files,
+			ContentSeq: []map[string]string{
+				{
+					"procfs/sys/net/core/somaxconn":                "4096\n",
+					"procfs/sys/fs/counter":                        "100\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+				{
+					"procfs/sys/net/core/somaxconn":                "8192\n",
+					"procfs/sys/fs/counter":                        "100\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "[always] madvise never\n",
+				},
+			},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  5,
+			WantMetrics: []string{
+				fmt.Sprintf(`sysctl_net_core_somaxconn{%s} 8192 %d`, labels, promTs),
+				// 1st delta, no previous zero:
+				fmt.Sprintf(`test_counter_delta{%s,a="1",b="2"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`thp_enabled_info{%s,value="always [madvise] never"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`thp_enabled_info{%s,value="[always] madvise never"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name:  "counter_reset",
+			Files: files,
+			ContentSeq: []map[string]string{
+				{
+					"procfs/sys/net/core/somaxconn":                "4096\n",
+					"procfs/sys/fs/counter":                        "100\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+				{
+					"procfs/sys/net/core/somaxconn":                "4096\n",
+					"procfs/sys/fs/counter":                        "30\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+			},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  2,
+			WantMetrics: []string{
+				fmt.Sprintf(`test_counter_delta{%s,a="1",b="2"} 30 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name:  "read_error",
+			Files: files,
+			ContentSeq: []map[string]string{
+				{
+					"procfs/sys/net/core/somaxconn":                "4096\n",
+					"procfs/sys/fs/counter":                        "100\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+				{
+					"procfs/sys/net/core/somaxconn":                "not a number\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+			},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  3,
+			WantMetrics: []string{
+				fmt.Sprintf(`file_watcher_read_error_count{%s,root="procfs",path="sys/net/core/somaxconn"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_read_error_count{%s,root="procfs",path="sys/fs/counter"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name:  "info_read_error",
+			Files: files,
+			ContentSeq: []map[string]string{
+				{
+					"procfs/sys/net/core/somaxconn":                "4096\n",
+					"procfs/sys/fs/counter":                        "100\n",
+					"sysfs/kernel/mm/transparent_hugepage/enabled": "always [madvise] never\n",
+				},
+				{
+					"procfs/sys/net/core/somaxconn": "4096\n",
+					"procfs/sys/fs/counter":         "100\n",
+				},
+			},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  4,
+			WantMetrics: []string{
+				// 1st delta, no previous zero:
+				fmt.Sprintf(`test_counter_delta{%s,a="1",b="2"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`thp_enabled_info{%s,value="always [madvise] never"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_read_error_count{%s,root="sysfs",path="kernel/mm/transparent_hugepage/enabled"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`file_watcher_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testFileWatcherMetrics(tc, t) },
+		)
+	}
+}
+
+func TestFileWatcherMetricsConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		fileCfg   *FileWatcherFileConfig
+		wantError error
+	}{
+		{
+			name:    "valid",
+			fileCfg: &FileWatcherFileConfig{Path: "sys/vm/swappiness", Metric: "sysctl_vm_swappiness"},
+		},
+		{
+			name:      "invalid_root",
+			fileCfg:   &FileWatcherFileConfig{Root: "devfs", Path: "null", Metric: "null"},
+			wantError: fmt.Errorf(`NewFileWatcherMetrics: files: "devfs": invalid root`),
+		},
+		{
+			name:      "abs_path",
+			fileCfg:   &FileWatcherFileConfig{Path: "/proc/sys/vm/swappiness", Metric: "sysctl_vm_swappiness"},
+			wantError: fmt.Errorf(`NewFileWatcherMetrics: files: "/proc/sys/vm/swappiness": path must be relative to root`),
+		},
+		{
+			name:      "outside_root",
+			fileCfg:   &FileWatcherFileConfig{Path: "../../etc/shadow", Metric: "shadow"},
+			wantError: fmt.Errorf(`NewFileWatcherMetrics: files: "../../etc/shadow": path must be under root`),
+		},
+		{
+			name:      "outside_root_unclean",
+			fileCfg:   &FileWatcherFileConfig{Path: "sys/../../etc/shadow", Metric: "shadow"},
+			wantError: fmt.Errorf(`NewFileWatcherMetrics: files: "sys/../../etc/shadow": path must be under root`),
+		},
+		{
+			name:      "invalid_metric",
+			fileCfg:   &FileWatcherFileConfig{Path: "sys/vm/swappiness", Metric: "vm.swappiness"},
+			wantError: fmt.Errorf(`NewFileWatcherMetrics: files: sys/vm/swappiness: "vm.swappiness": invalid metric`),
+		},
+		{
+			name:      "invalid_type",
+			fileCfg:   &FileWatcherFileConfig{Path: "sys/vm/swappiness", Metric: "sysctl_vm_swappiness", Type: "counter"},
+			wantError: fmt.Errorf(`NewFileWatcherMetrics: files: sys/vm/swappiness: "counter": invalid type`),
+		},
+		{
+			name: "reserved_label",
+			fileCfg: &FileWatcherFileConfig{
+				Path: "sys/vm/swappiness", Metric: "sysctl_vm_swappiness", Labels: map[string]string{"instance": "x"},
+			},
+			wantError: fmt.Errorf(`NewFileWatcherMetrics: files: sys/vm/swappiness: "instance": invalid label`),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) {
+				tlc := testutils.NewTestLogCollect(t, Log, nil)
+				defer tlc.RestoreLog()
+
+				fileWatcherMetricsCfg := DefaultFileWatcherMetricsConfig()
+				fileWatcherMetricsCfg.Files = []*FileWatcherFileConfig{tc.fileCfg}
+				_, err := NewFileWatcherMetrics(fileWatcherMetricsCfg)
+				if tc.wantError == nil {
+					if err != nil {
+						t.Fatal(err)
+					}
+				} else if err == nil || tc.wantError.Error() != err.Error() {
+					t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+				}
+			},
+		)
+	}
+}
@@ -2,6 +2,10 @@
 
 package lsvmi
 
+import (
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
 var (
 	GlobalLsvmiConfig                    *LsvmiConfig
 	GlobalHttpEndpointPool               *HttpEndpointPool
@@ -11,5 +15,9 @@ var (
 	GlobalInstance                       string
 	GlobalHostname                       string
 	GlobalProcfsRoot                     string
+	GlobalSysfsRoot                      string
 	GlobalMetricsGeneratorStatsContainer *MetricsGeneratorStatsContainer
+	GlobalPidMemsAllowedContainer        *PidMemsAllowedContainer
+	GlobalPidOomCandidatesContainer      *PidOomCandidatesContainer
+	GlobalPidTidListCache                procfs.PidTidListCacheIF
 )
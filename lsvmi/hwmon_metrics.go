@@ -0,0 +1,413 @@
+// Hardware sensors metrics based on:
+//  /sys/class/hwmon/hwmon*
+//  /sys/class/thermal/thermal_zone*
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
+)
+
+const (
+	HWMON_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	HWMON_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+
+	// This generator id:
+	HWMON_METRICS_ID = "hwmon_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",chip="CHIP",sensor="SENSOR",device="DEVICE"}:
+	HWMON_TEMP_METRIC  = "hwmon_temp_celsius"
+	HWMON_FAN_METRIC   = "hwmon_fan_rpm"
+	HWMON_IN_METRIC    = "hwmon_in_volts"
+	HWMON_POWER_METRIC = "hwmon_power_watts"
+
+	HWMON_CHIP_LABEL_NAME   = "chip"
+	HWMON_SENSOR_LABEL_NAME = "sensor"
+	HWMON_DEVICE_LABEL_NAME = "device"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",zone="ZONE",type="TYPE"}:
+	THERMAL_ZONE_TEMP_METRIC = "thermal_zone_temp_celsius"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",zone="ZONE",type="TYPE",trip_point="N",trip_type="TRIP_TYPE"}:
+	THERMAL_ZONE_TRIP_POINT_METRIC = "thermal_zone_trip_point_celsius"
+
+	THERMAL_ZONE_LABEL_NAME            = "zone"
+	THERMAL_ZONE_TYPE_LABEL_NAME       = "type"
+	THERMAL_ZONE_TRIP_POINT_LABEL_NAME = "trip_point"
+	THERMAL_ZONE_TRIP_TYPE_LABEL_NAME  = "trip_type"
+
+	// Temperatures are reported in millidegree Celsius:
+	THERMAL_ZONE_TEMP_FACTOR = 1. / 1000.
+	THERMAL_ZONE_TEMP_PREC   = 3
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	HWMON_INTERVAL_METRIC = "hwmon_metrics_delta_sec"
+)
+
+// The metric name and the conversion from kernel units, indexed by sensor
+// type (see sysfs/hwmon_parser.go):
+type HwmonSensorTypeMetric struct {
+	name   string
+	factor float64 // val * factor
+	prec   int     // FormatFloat prec arg
+}
+
+var hwmonSensorTypeMetric = [sysfs.HWMON_SENSOR_NUM_TYPES]*HwmonSensorTypeMetric{
+	sysfs.HWMON_SENSOR_TEMP:  {HWMON_TEMP_METRIC, 1. / 1000., 3},     // millidegree Celsius
+	sysfs.HWMON_SENSOR_FAN:   {HWMON_FAN_METRIC, 1., 0},              // RPM
+	sysfs.HWMON_SENSOR_IN:    {HWMON_IN_METRIC, 1. / 1000., 3},       // millivolt
+	sysfs.HWMON_SENSOR_POWER: {HWMON_POWER_METRIC, 1. / 1000000., 3}, // microwatt
+}
+
+var hwmonMetricsLog = NewCompLogger(HWMON_METRICS_ID)
+
+type HwmonMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle. The sensors are re-discovered
+	// with every full cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultHwmonMetricsConfig() *HwmonMetricsConfig {
+	return &HwmonMetricsConfig{
+		Interval:          HWMON_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: HWMON_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+// Per sensor/zone info, built at discovery time:
+type HwmonSensorMetricInfo struct {
+	// The metric, including labels:
+	metric []byte
+	// Unit conversion:
+	typeMetric *HwmonSensorTypeMetric
+	// The previous value, used for change detection:
+	prevValue int64
+	prevValid bool
+}
+
+type ThermalZoneMetricInfo struct {
+	// The temperature metric, including labels:
+	tempMetric []byte
+	// Trip point metrics, indexed like the zone's TripPoints:
+	tripPointMetrics [][]byte
+	// The previous value, used for change detection:
+	prevTemp  int64
+	prevValid bool
+}
+
+type HwmonMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The parsers:
+	hwmon        *sysfs.Hwmon
+	thermalZones *sysfs.ThermalZones
+
+	// Timestamp of the current and previous scan:
+	currTs, prevTs time.Time
+
+	// Cycle#, the sensors are re-discovered when it is 0:
+	cycleNum int
+
+	// Metrics cache, rebuilt after each discovery; nil means rebuild needed.
+	// The hwmon info is indexed by chip#, sensor# and the thermal zones by
+	// zone#, matching the parsers:
+	sensorMetricInfo      [][]*HwmonSensorMetricInfo
+	thermalZoneMetricInfo []*ThermalZoneMetricInfo
+
+	// Interval metric:
+	intervalMetric []byte
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The total number of metrics, evaluated every time the cache is rebuilt:
+	totalMetricsCount int
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	sysfsRoot          string
+}
+
+func NewHwmonMetrics(cfg any) (*HwmonMetrics, error) {
+	var (
+		err             error
+		hwmonMetricsCfg *HwmonMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		hwmonMetricsCfg = cfg.HwmonMetricsConfig
+	case *HwmonMetricsConfig:
+		hwmonMetricsCfg = cfg
+	case nil:
+		hwmonMetricsCfg = DefaultHwmonMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewHwmonMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(hwmonMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	hwmonMetrics := &HwmonMetrics{
+		id:                HWMON_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: hwmonMetricsCfg.FullMetricsFactor,
+		cycleNum:          initialCycleNum.Get(hwmonMetricsCfg.FullMetricsFactor),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	hwmonMetricsLog.Infof("id=%s", hwmonMetrics.id)
+	hwmonMetricsLog.Infof("interval=%s", hwmonMetrics.interval)
+	hwmonMetricsLog.Infof("full_metrics_factor=%d", hwmonMetrics.fullMetricsFactor)
+	return hwmonMetrics, nil
+}
+
+func (hm *HwmonMetrics) updateMetricsCache() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if hm.instance != "" {
+		instance = hm.instance
+	}
+	if hm.hostname != "" {
+		hostname = hm.hostname
+	}
+
+	totalMetricsCount := 0
+
+	hm.sensorMetricInfo = make([][]*HwmonSensorMetricInfo, len(hm.hwmon.Chips))
+	for i, chip := range hm.hwmon.Chips {
+		chipSensorMetricInfo := make([]*HwmonSensorMetricInfo, len(chip.Sensors))
+		for j, sensor := range chip.Sensors {
+			typeMetric := hwmonSensorTypeMetric[sensor.Type]
+			chipSensorMetricInfo[j] = &HwmonSensorMetricInfo{
+				metric: []byte(fmt.Sprintf(
+					`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+					typeMetric.name,
+					INSTANCE_LABEL_NAME, instance,
+					HOSTNAME_LABEL_NAME, hostname,
+					HWMON_CHIP_LABEL_NAME, chip.Name,
+					HWMON_SENSOR_LABEL_NAME, sensor.Label,
+					HWMON_DEVICE_LABEL_NAME, chip.Device,
+				)),
+				typeMetric: typeMetric,
+			}
+		}
+		hm.sensorMetricInfo[i] = chipSensorMetricInfo
+		totalMetricsCount += len(chip.Sensors)
+	}
+
+	hm.thermalZoneMetricInfo = make([]*ThermalZoneMetricInfo, len(hm.thermalZones.Zones))
+	for i, zone := range hm.thermalZones.Zones {
+		zoneMetricInfo := &ThermalZoneMetricInfo{
+			tempMetric: []byte(fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+				THERMAL_ZONE_TEMP_METRIC,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				THERMAL_ZONE_LABEL_NAME, zone.Zone,
+				THERMAL_ZONE_TYPE_LABEL_NAME, zone.Type,
+			)),
+			tripPointMetrics: make([][]byte, len(zone.TripPoints)),
+		}
+		for j, tripPoint := range zone.TripPoints {
+			zoneMetricInfo.tripPointMetrics[j] = []byte(fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+				THERMAL_ZONE_TRIP_POINT_METRIC,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				THERMAL_ZONE_LABEL_NAME, zone.Zone,
+				THERMAL_ZONE_TYPE_LABEL_NAME, zone.Type,
+				THERMAL_ZONE_TRIP_POINT_LABEL_NAME, tripPoint.Num,
+				THERMAL_ZONE_TRIP_TYPE_LABEL_NAME, tripPoint.Type,
+			))
+		}
+		hm.thermalZoneMetricInfo[i] = zoneMetricInfo
+		totalMetricsCount += 1 + len(zone.TripPoints)
+	}
+
+	if hm.intervalMetric == nil {
+		hm.intervalMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. include space before val
+			HWMON_INTERVAL_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+	totalMetricsCount++
+
+	hm.totalMetricsCount = totalMetricsCount
+}
+
+func (hm *HwmonMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	// Trip points are generated when the cache is (re)built, i.e. after
+	// discovery, or for full cycles:
+	newCache := hm.sensorMetricInfo == nil || hm.thermalZoneMetricInfo == nil
+	if newCache {
+		hm.updateMetricsCache()
+	}
+
+	actualMetricsCount := 0
+	hm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		hm.tsSuffixBuf, " %d\n", hm.currTs.UnixMilli(),
+	)
+	promTs := hm.tsSuffixBuf.Bytes()
+
+	fullMetrics := hm.cycleNum == 0
+
+	for i, chip := range hm.hwmon.Chips {
+		chipSensorMetricInfo := hm.sensorMetricInfo[i]
+		for j, sensor := range chip.Sensors {
+			sensorMetricInfo := chipSensorMetricInfo[j]
+			if sensor.Valid &&
+				(fullMetrics || !sensorMetricInfo.prevValid || sensor.Value != sensorMetricInfo.prevValue) {
+				typeMetric := sensorMetricInfo.typeMetric
+				buf.Write(sensorMetricInfo.metric)
+				buf.WriteString(strconv.FormatFloat(
+					float64(sensor.Value)*typeMetric.factor, 'f', typeMetric.prec, 64,
+				))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			sensorMetricInfo.prevValue, sensorMetricInfo.prevValid = sensor.Value, sensor.Valid
+		}
+	}
+
+	for i, zone := range hm.thermalZones.Zones {
+		zoneMetricInfo := hm.thermalZoneMetricInfo[i]
+		if zone.Valid &&
+			(fullMetrics || !zoneMetricInfo.prevValid || zone.Temp != zoneMetricInfo.prevTemp) {
+			buf.Write(zoneMetricInfo.tempMetric)
+			buf.WriteString(strconv.FormatFloat(
+				float64(zone.Temp)*THERMAL_ZONE_TEMP_FACTOR, 'f', THERMAL_ZONE_TEMP_PREC, 64,
+			))
+			buf.Write(promTs)
+			actualMetricsCount++
+		}
+		zoneMetricInfo.prevTemp, zoneMetricInfo.prevValid = zone.Temp, zone.Valid
+
+		// Trip points are updated at discovery time only:
+		if fullMetrics || newCache {
+			for j, tripPoint := range zone.TripPoints {
+				buf.Write(zoneMetricInfo.tripPointMetrics[j])
+				buf.WriteString(strconv.FormatFloat(
+					float64(tripPoint.Temp)*THERMAL_ZONE_TEMP_FACTOR, 'f', THERMAL_ZONE_TEMP_PREC, 64,
+				))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+		}
+	}
+
+	if !hm.prevTs.IsZero() {
+		buf.Write(hm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(hm.currTs.Sub(hm.prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+
+	if hm.cycleNum++; hm.cycleNum >= hm.fullMetricsFactor {
+		hm.cycleNum = 0
+	}
+
+	return actualMetricsCount, hm.totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (hm *HwmonMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if hm.timeNowFn != nil {
+		timeNowFn = hm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if hm.metricsQueue != nil {
+		metricsQueue = hm.metricsQueue
+	}
+
+	firstDiscovery := hm.hwmon == nil
+	if firstDiscovery {
+		sysfsRoot := GlobalSysfsRoot
+		if hm.sysfsRoot != "" {
+			sysfsRoot = hm.sysfsRoot
+		}
+		hm.hwmon = sysfs.NewHwmon(sysfsRoot)
+		hm.thermalZones = sysfs.NewThermalZones(sysfsRoot)
+	}
+
+	if firstDiscovery || hm.cycleNum == 0 {
+		err := hm.hwmon.Discover()
+		if err == nil {
+			err = hm.thermalZones.Discover()
+		}
+		if err != nil {
+			hwmonMetricsLog.Warnf("%v: hwmon metrics will be disabled", err)
+			return false
+		}
+		if firstDiscovery && len(hm.hwmon.Chips) == 0 && len(hm.thermalZones.Zones) == 0 {
+			hwmonMetricsLog.Info("no hwmon devices or thermal zones found, hwmon metrics will be disabled")
+			return false
+		}
+		// Force cache rebuild:
+		hm.sensorMetricInfo, hm.thermalZoneMetricInfo = nil, nil
+	}
+
+	hm.hwmon.Parse()
+	hm.thermalZones.Parse()
+	hm.prevTs, hm.currTs = hm.currTs, timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := hm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		hm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func HwmonMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	hm, err := NewHwmonMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if hm.interval <= 0 {
+		hwmonMetricsLog.Infof(
+			"interval=%s, metrics disabled", hm.interval,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(hm.id, hm.interval, hm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(HwmonMetricsTaskBuilder)
+}
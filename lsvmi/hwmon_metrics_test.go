@@ -0,0 +1,195 @@
+// Tests for hwmon_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
+)
+
+type HwmonMetricsTestCase struct {
+	Name                   string
+	Instance               string
+	Hostname               string
+	CurrPromTs, PrevPromTs int64
+	CycleNum               int
+	// Update the parsed data before generating metrics, simulating a change
+	// from the primed state:
+	UpdateFn func(hwmon *sysfs.Hwmon, thermalZones *sysfs.ThermalZones)
+	// Do not prime the cache, simulating the first scan after discovery:
+	NoPrime          bool
+	WantMetricsCount int
+	WantMetrics      []string
+	ReportExtra      bool
+}
+
+var hwmonMetricsTestSysfsRoot = path.Join("..", testutils.SysfsTestDataSubdir, "hwmon", "field_mapping")
+var thermalZoneMetricsTestSysfsRoot = path.Join("..", testutils.SysfsTestDataSubdir, "thermal", "field_mapping")
+
+func testHwmonMetrics(tc *HwmonMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	hwmonMetrics, err := NewHwmonMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hwmonMetrics.instance = tc.Instance
+	hwmonMetrics.hostname = tc.Hostname
+
+	hwmonMetrics.hwmon = sysfs.NewHwmon(hwmonMetricsTestSysfsRoot)
+	if err := hwmonMetrics.hwmon.Discover(); err != nil {
+		t.Fatal(err)
+	}
+	hwmonMetrics.hwmon.Parse()
+	hwmonMetrics.thermalZones = sysfs.NewThermalZones(thermalZoneMetricsTestSysfsRoot)
+	if err := hwmonMetrics.thermalZones.Discover(); err != nil {
+		t.Fatal(err)
+	}
+	hwmonMetrics.thermalZones.Parse()
+
+	// Prime the cache w/ the current state:
+	if !tc.NoPrime {
+		hwmonMetrics.generateMetrics(&bytes.Buffer{})
+	}
+
+	if tc.UpdateFn != nil {
+		tc.UpdateFn(hwmonMetrics.hwmon, hwmonMetrics.thermalZones)
+	}
+	hwmonMetrics.cycleNum = tc.CycleNum
+	hwmonMetrics.currTs = time.UnixMilli(tc.CurrPromTs)
+	if tc.PrevPromTs > 0 {
+		hwmonMetrics.prevTs = time.UnixMilli(tc.PrevPromTs)
+	} else {
+		hwmonMetrics.prevTs = time.Time{}
+	}
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := hwmonMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestHwmonMetrics(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	hwmonMetric := func(name, chip, sensor, device, val string) string {
+		return fmt.Sprintf(
+			`%s{instance="%s",hostname="%s",chip="%s",sensor="%s",device="%s"} %s %d`,
+			name, instance, hostname, chip, sensor, device, val, currPromTs,
+		)
+	}
+	zoneMetric := func(zone, zoneType, val string) string {
+		return fmt.Sprintf(
+			`thermal_zone_temp_celsius{instance="%s",hostname="%s",zone="%s",type="%s"} %s %d`,
+			instance, hostname, zone, zoneType, val, currPromTs,
+		)
+	}
+	tripPointMetric := func(zone, zoneType, num, tripType, val string) string {
+		return fmt.Sprintf(
+			`thermal_zone_trip_point_celsius{instance="%s",hostname="%s",zone="%s",type="%s",trip_point="%s",trip_type="%s"} %s %d`,
+			instance, hostname, zone, zoneType, num, tripType, val, currPromTs,
+		)
+	}
+	intervalMetric := fmt.Sprintf(
+		`hwmon_metrics_delta_sec{instance="%s",hostname="%s"} 5.000000 %d`,
+		instance, hostname, currPromTs,
+	)
+
+	fullMetrics := []string{
+		hwmonMetric("hwmon_temp_celsius", "coretemp", "Package id 0", "/devices/platform/coretemp.0", "45.000"),
+		hwmonMetric("hwmon_temp_celsius", "coretemp", "Core 0", "/devices/platform/coretemp.0", "43.000"),
+		hwmonMetric("hwmon_fan_rpm", "nct6775", "fan1", "", "1100"),
+		hwmonMetric("hwmon_fan_rpm", "nct6775", "fan2", "", "1200"),
+		hwmonMetric("hwmon_in_volts", "nct6775", "in0", "", "1.050"),
+		hwmonMetric("hwmon_in_volts", "nct6775", "in10", "", "-0.005"),
+		hwmonMetric("hwmon_power_watts", "nct6775", "power1", "", "35.000"),
+		hwmonMetric("hwmon_temp_celsius", "acpitz", "temp1", "", "-2.000"),
+		zoneMetric("thermal_zone0", "x86_pkg_temp", "46.000"),
+		tripPointMetric("thermal_zone0", "x86_pkg_temp", "0", "passive", "0.000"),
+		tripPointMetric("thermal_zone0", "x86_pkg_temp", "1", "critical", "95.000"),
+		zoneMetric("thermal_zone2", "acpitz", "27.800"),
+	}
+	for i := 0; i <= 10; i++ {
+		fullMetrics = append(fullMetrics, tripPointMetric(
+			"thermal_zone2", "acpitz", fmt.Sprintf("%d", i), "active",
+			fmt.Sprintf("%d.000", 100-i),
+		))
+	}
+
+	for _, tc := range []*HwmonMetricsTestCase{
+		{
+			Name:        "full_first",
+			CycleNum:    0,
+			WantMetrics: fullMetrics,
+		},
+		{
+			Name:        "first_not_full",
+			CycleNum:    3,
+			NoPrime:     true,
+			WantMetrics: fullMetrics,
+		},
+		{
+			Name:        "full",
+			CycleNum:    0,
+			PrevPromTs:  prevPromTs,
+			WantMetrics: append([]string{intervalMetric}, fullMetrics...),
+		},
+		{
+			Name:        "no_change",
+			CycleNum:    1,
+			PrevPromTs:  prevPromTs,
+			WantMetrics: []string{intervalMetric},
+		},
+		{
+			Name:       "change",
+			CycleNum:   1,
+			PrevPromTs: prevPromTs,
+			UpdateFn: func(hwmon *sysfs.Hwmon, thermalZones *sysfs.ThermalZones) {
+				hwmon.Chips[0].Sensors[1].Value = 44500
+				hwmon.Chips[1].Sensors[1].Valid = false
+				hwmon.Chips[1].Sensors[3].Value, hwmon.Chips[1].Sensors[3].Valid = 12, true
+				thermalZones.Zones[0].Temp = 47125
+			},
+			WantMetrics: []string{
+				hwmonMetric("hwmon_temp_celsius", "coretemp", "Core 0", "/devices/platform/coretemp.0", "44.500"),
+				hwmonMetric("hwmon_in_volts", "nct6775", "in1", "", "0.012"),
+				zoneMetric("thermal_zone0", "x86_pkg_temp", "47.125"),
+				intervalMetric,
+			},
+		},
+	} {
+		tc.Instance, tc.Hostname = instance, hostname
+		tc.CurrPromTs = currPromTs
+		tc.WantMetricsCount = len(tc.WantMetrics)
+		tc.ReportExtra = true
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testHwmonMetrics(tc, t) },
+		)
+	}
+}
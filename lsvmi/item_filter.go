@@ -0,0 +1,164 @@
+// Include/exclude regexp based item filter, used for selecting the devices,
+// IRQs, etc. for metrics generation.
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+type ItemFilter struct {
+	// The regexps are anchored, i.e. they have to match the entire name. An
+	// empty include list means that everything is included. Exclude takes
+	// precedence over include:
+	includeRe, excludeRe []*regexp.Regexp
+
+	// The items excluded thus far, indexed by key and mapped into the names
+	// used for the decision. If the names change the decision is re-evaluated:
+	excluded map[string][]string
+
+	// Excluded count metric, w/o value, built by the generator upon first use:
+	countMetric []byte
+	// The count is generated only if it changed from the previous scan, save
+	// for full cycles:
+	prevCount int
+	cycleNum  int
+}
+
+func compileItemFilterRegexps(reList []string) ([]*regexp.Regexp, error) {
+	if len(reList) == 0 {
+		return nil, nil
+	}
+	compiled := make([]*regexp.Regexp, len(reList))
+	for i, re := range reList {
+		var err error
+		if compiled[i], err = regexp.Compile("^(?:" + re + ")$"); err != nil {
+			return nil, fmt.Errorf("%q: %v", re, err)
+		}
+	}
+	return compiled, nil
+}
+
+// Build a filter from include/exclude regexp lists. If both lists are empty
+// then return nil, meaning no filtering.
+func NewItemFilter(include, exclude []string, fullMetricsFactor int) (*ItemFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	itemFilter := &ItemFilter{
+		excluded:  make(map[string][]string),
+		prevCount: -1,
+		cycleNum:  initialCycleNum.Get(fullMetricsFactor),
+	}
+	var err error
+	if itemFilter.includeRe, err = compileItemFilterRegexps(include); err != nil {
+		return nil, fmt.Errorf("include: %v", err)
+	}
+	if itemFilter.excludeRe, err = compileItemFilterRegexps(exclude); err != nil {
+		return nil, fmt.Errorf("exclude: %v", err)
+	}
+	return itemFilter, nil
+}
+
+func matchAnyRegexp(reList []*regexp.Regexp, names []string) bool {
+	for _, re := range reList {
+		for _, name := range names {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Whether the item identified by key should be excluded or not, based on its
+// names; if any of the names matches an exclude regexp then the item is
+// excluded, otherwise if include is not empty then any of the names has to
+// match an include regexp. A nil filter excludes nothing.
+func (itemFilter *ItemFilter) exclude(key string, names ...string) bool {
+	if itemFilter == nil {
+		return false
+	}
+
+	if excludedNames, ok := itemFilter.excluded[key]; ok {
+		sameNames := len(excludedNames) == len(names)
+		for i := 0; sameNames && i < len(names); i++ {
+			sameNames = excludedNames[i] == names[i]
+		}
+		if sameNames {
+			return true
+		}
+		delete(itemFilter.excluded, key)
+	}
+
+	exclude := matchAnyRegexp(itemFilter.excludeRe, names) ||
+		itemFilter.includeRe != nil && !matchAnyRegexp(itemFilter.includeRe, names)
+	if exclude {
+		itemFilter.excluded[key] = append([]string(nil), names...)
+	}
+	return exclude
+}
+
+// Whether the item identified by key was excluded at the most recent decision:
+func (itemFilter *ItemFilter) isExcluded(key string) bool {
+	if itemFilter == nil {
+		return false
+	}
+	_, ok := itemFilter.excluded[key]
+	return ok
+}
+
+// The number of excluded items:
+func (itemFilter *ItemFilter) excludedCount() int {
+	if itemFilter == nil {
+		return 0
+	}
+	return len(itemFilter.excluded)
+}
+
+// Remove the excluded items that are no longer in scope, i.e. not present in
+// the current stats:
+func pruneExcludedItems[T any](itemFilter *ItemFilter, curr map[string]T) {
+	if itemFilter == nil || len(itemFilter.excluded) == 0 {
+		return
+	}
+	for key := range itemFilter.excluded {
+		if _, ok := curr[key]; !ok {
+			delete(itemFilter.excluded, key)
+		}
+	}
+}
+
+func (itemFilter *ItemFilter) updateCountMetric(name, instance, hostname string) {
+	itemFilter.countMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"} `, // N.B. include space before val
+		name,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+	))
+}
+
+// Generate the excluded count metric, if it changed or for full cycles; return
+// the number of generated metrics. The metric should have been built
+// beforehand via updateCountMetric.
+func (itemFilter *ItemFilter) generateCountMetric(buf *bytes.Buffer, promTs []byte, fullMetricsFactor int) int {
+	if itemFilter == nil {
+		return 0
+	}
+	actualMetricsCount := 0
+	count := len(itemFilter.excluded)
+	if count != itemFilter.prevCount || itemFilter.cycleNum == 0 {
+		buf.Write(itemFilter.countMetric)
+		buf.WriteString(strconv.Itoa(count))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+	itemFilter.prevCount = count
+	if itemFilter.cycleNum++; itemFilter.cycleNum >= fullMetricsFactor {
+		itemFilter.cycleNum = 0
+	}
+	return actualMetricsCount
+}
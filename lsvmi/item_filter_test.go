@@ -0,0 +1,232 @@
+// Tests for item_filter.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type ItemFilterTestItem struct {
+	key         string
+	names       []string
+	wantExclude bool
+}
+
+type ItemFilterTestCase struct {
+	name             string
+	include, exclude []string
+	wantNil          bool
+	wantErr          bool
+	// The items are evaluated in order, the same key may appear multiple times
+	// w/ different names:
+	items             []*ItemFilterTestItem
+	wantExcludedCount int
+}
+
+func testItemFilter(tc *ItemFilterTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+include=%q
+exclude=%q
+`,
+		tc.name, tc.include, tc.exclude,
+	)
+
+	itemFilter, err := NewItemFilter(tc.include, tc.exclude, 0)
+	if tc.wantErr {
+		if err == nil {
+			t.Fatal("want error, got nil")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.wantNil != (itemFilter == nil) {
+		t.Fatalf("nil filter: want: %v, got: %v", tc.wantNil, itemFilter == nil)
+	}
+
+	errBuf := &bytes.Buffer{}
+	for i, item := range tc.items {
+		gotExclude := itemFilter.exclude(item.key, item.names...)
+		if item.wantExclude != gotExclude {
+			fmt.Fprintf(
+				errBuf,
+				"\nitems[%d] key=%q, names=%q: exclude: want: %v, got: %v",
+				i, item.key, item.names, item.wantExclude, gotExclude,
+			)
+		}
+		if gotIsExcluded := itemFilter.isExcluded(item.key); gotExclude != gotIsExcluded {
+			fmt.Fprintf(
+				errBuf,
+				"\nitems[%d] key=%q: isExcluded: want: %v, got: %v",
+				i, item.key, gotExclude, gotIsExcluded,
+			)
+		}
+	}
+	if gotExcludedCount := itemFilter.excludedCount(); tc.wantExcludedCount != gotExcludedCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nexcludedCount: want: %d, got: %d",
+			tc.wantExcludedCount, gotExcludedCount,
+		)
+	}
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestItemFilter(t *testing.T) {
+	for _, tc := range []*ItemFilterTestCase{
+		{
+			name:    "no_filter",
+			wantNil: true,
+			items: []*ItemFilterTestItem{
+				{"eth0", []string{"eth0"}, false},
+			},
+		},
+		{
+			name:    "exclude",
+			exclude: []string{`veth.*`, `lo`},
+			items: []*ItemFilterTestItem{
+				{"eth0", []string{"eth0"}, false},
+				{"lo", []string{"lo"}, true},
+				{"veth1a2b", []string{"veth1a2b"}, true},
+				{"loop0", []string{"loop0"}, false},
+			},
+			wantExcludedCount: 2,
+		},
+		{
+			name:    "include",
+			include: []string{`sd[a-z]+`, `nvme\d+n\d+`},
+			items: []*ItemFilterTestItem{
+				{"8:0", []string{"sda"}, false},
+				{"8:1", []string{"sda1"}, true},
+				{"259:0", []string{"nvme0n1"}, false},
+				{"259:1", []string{"nvme0n1p1"}, true},
+			},
+			wantExcludedCount: 2,
+		},
+		{
+			name:    "exclude_takes_precedence",
+			include: []string{`sd.*`},
+			exclude: []string{`sdb`},
+			items: []*ItemFilterTestItem{
+				{"8:0", []string{"sda"}, false},
+				{"8:16", []string{"sdb"}, true},
+			},
+			wantExcludedCount: 1,
+		},
+		{
+			name:    "any_name",
+			exclude: []string{`timer`},
+			items: []*ItemFilterTestItem{
+				{"0", []string{"0", "timer"}, true},
+				{"LOC", []string{"LOC", "Local timer interrupts"}, false},
+			},
+			wantExcludedCount: 1,
+		},
+		{
+			name:    "name_change",
+			exclude: []string{`dm-.*`},
+			items: []*ItemFilterTestItem{
+				{"253:0", []string{"dm-0"}, true},
+				{"253:0", []string{"dm-0"}, true},
+				{"253:0", []string{"vg0-root"}, false},
+				{"253:0", []string{"dm-1"}, true},
+			},
+			wantExcludedCount: 1,
+		},
+		{
+			name:    "invalid_include",
+			include: []string{`(`},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_exclude",
+			exclude: []string{`[`},
+			wantErr: true,
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testItemFilter(tc, t) },
+		)
+	}
+}
+
+func TestItemFilterPrune(t *testing.T) {
+	itemFilter, err := NewItemFilter(nil, []string{`veth.*`}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dev := range []string{"veth0", "veth1", "eth0"} {
+		itemFilter.exclude(dev, dev)
+	}
+	pruneExcludedItems(itemFilter, map[string][]uint64{"veth1": nil, "eth0": nil})
+	if itemFilter.isExcluded("veth0") {
+		t.Fatal("veth0: want pruned, got excluded")
+	}
+	if !itemFilter.isExcluded("veth1") {
+		t.Fatal("veth1: want excluded, got pruned")
+	}
+	if want, got := 1, itemFilter.excludedCount(); want != got {
+		t.Fatalf("excludedCount: want: %d, got: %d", want, got)
+	}
+}
+
+func TestItemFilterCountMetric(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	promTs := []byte(" 1700000005000\n")
+	fullMetricsFactor := 3
+
+	itemFilter, err := NewItemFilter(nil, []string{`veth.*`}, fullMetricsFactor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itemFilter.updateCountMetric("test_excluded_count", instance, hostname)
+	itemFilter.cycleNum = 1
+
+	countMetric := func(count int) string {
+		return fmt.Sprintf(
+			`test_excluded_count{instance="%s",hostname="%s"} %d 1700000005000`,
+			instance, hostname, count,
+		)
+	}
+
+	for i, step := range []struct {
+		devs      []string
+		wantCount int
+		want      []string
+	}{
+		// 1st time, count is generated:
+		{[]string{"eth0", "veth0"}, 1, []string{countMetric(1)}},
+		// No change:
+		{[]string{"eth0", "veth0"}, 0, nil},
+		// Full cycle:
+		{[]string{"eth0", "veth0"}, 1, []string{countMetric(1)}},
+		// Change:
+		{[]string{"eth0", "veth0", "veth1"}, 1, []string{countMetric(2)}},
+	} {
+		for _, dev := range step.devs {
+			itemFilter.exclude(dev, dev)
+		}
+		testMetricsQueue := testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotCount := itemFilter.generateCountMetric(buf, promTs, fullMetricsFactor)
+		testMetricsQueue.QueueBuf(buf)
+
+		errBuf := &bytes.Buffer{}
+		if step.wantCount != gotCount {
+			fmt.Fprintf(errBuf, "\nmetrics count: want: %d, got: %d", step.wantCount, gotCount)
+		}
+		testMetricsQueue.GenerateReport(step.want, false, errBuf)
+		if errBuf.Len() > 0 {
+			t.Fatalf("step %d: %s", i, errBuf)
+		}
+	}
+}
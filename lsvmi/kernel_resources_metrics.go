@@ -0,0 +1,377 @@
+// Kernel global resource usage and limits metrics based on:
+//  /proc/sys/fs/file-nr
+//  /proc/sys/fs/inode-nr
+//  /proc/sys/kernel/pid_max
+//  /proc/sys/kernel/threads-max
+//  /proc/sys/kernel/random/{entropy_avail,poolsize}
+//  the PID/TID counts from PidTidListCache
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	KERNEL_RESOURCES_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	KERNEL_RESOURCES_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+
+	// This generator id:
+	KERNEL_RESOURCES_METRICS_ID = "kernel_resources_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME"}:
+	KERNEL_RESOURCES_FILE_HANDLES_USED_METRIC     = "kernel_file_handles_used"
+	KERNEL_RESOURCES_FILE_HANDLES_MAX_METRIC      = "kernel_file_handles_max"
+	KERNEL_RESOURCES_FILE_HANDLES_USED_PCT_METRIC = "kernel_file_handles_used_pct"
+	KERNEL_RESOURCES_INODES_ALLOCATED_METRIC      = "kernel_inodes_allocated"
+	KERNEL_RESOURCES_INODES_FREE_METRIC           = "kernel_inodes_free"
+	KERNEL_RESOURCES_PROCESSES_COUNT_METRIC       = "kernel_processes_count"
+	KERNEL_RESOURCES_THREADS_COUNT_METRIC         = "kernel_threads_count"
+	KERNEL_RESOURCES_THREADS_MAX_METRIC           = "kernel_threads_max"
+	KERNEL_RESOURCES_THREADS_USED_PCT_METRIC      = "kernel_threads_used_pct"
+	KERNEL_RESOURCES_PID_MAX_METRIC               = "kernel_pid_max"
+	KERNEL_RESOURCES_PID_USED_PCT_METRIC          = "kernel_pid_used_pct"
+	KERNEL_RESOURCES_ENTROPY_AVAIL_METRIC         = "kernel_entropy_avail"
+	KERNEL_RESOURCES_ENTROPY_POOLSIZE_METRIC      = "kernel_entropy_poolsize"
+	KERNEL_RESOURCES_ENTROPY_AVAIL_PCT_METRIC     = "kernel_entropy_avail_pct"
+
+	KERNEL_RESOURCES_PCT_METRIC_PREC = 1
+)
+
+// The metrics, in the order in which they are generated:
+const (
+	KERNEL_RESOURCES_FILE_HANDLES_USED = iota
+	KERNEL_RESOURCES_FILE_HANDLES_MAX
+	KERNEL_RESOURCES_FILE_HANDLES_USED_PCT
+	KERNEL_RESOURCES_INODES_ALLOCATED
+	KERNEL_RESOURCES_INODES_FREE
+	KERNEL_RESOURCES_PROCESSES_COUNT
+	KERNEL_RESOURCES_THREADS_COUNT
+	KERNEL_RESOURCES_THREADS_MAX
+	KERNEL_RESOURCES_THREADS_USED_PCT
+	KERNEL_RESOURCES_PID_MAX
+	KERNEL_RESOURCES_PID_USED_PCT
+	KERNEL_RESOURCES_ENTROPY_AVAIL
+	KERNEL_RESOURCES_ENTROPY_POOLSIZE
+	KERNEL_RESOURCES_ENTROPY_AVAIL_PCT
+
+	// Must be last:
+	KERNEL_RESOURCES_NUM_METRICS
+)
+
+var kernelResourcesMetricNames = []string{
+	KERNEL_RESOURCES_FILE_HANDLES_USED:     KERNEL_RESOURCES_FILE_HANDLES_USED_METRIC,
+	KERNEL_RESOURCES_FILE_HANDLES_MAX:      KERNEL_RESOURCES_FILE_HANDLES_MAX_METRIC,
+	KERNEL_RESOURCES_FILE_HANDLES_USED_PCT: KERNEL_RESOURCES_FILE_HANDLES_USED_PCT_METRIC,
+	KERNEL_RESOURCES_INODES_ALLOCATED:      KERNEL_RESOURCES_INODES_ALLOCATED_METRIC,
+	KERNEL_RESOURCES_INODES_FREE:           KERNEL_RESOURCES_INODES_FREE_METRIC,
+	KERNEL_RESOURCES_PROCESSES_COUNT:       KERNEL_RESOURCES_PROCESSES_COUNT_METRIC,
+	KERNEL_RESOURCES_THREADS_COUNT:         KERNEL_RESOURCES_THREADS_COUNT_METRIC,
+	KERNEL_RESOURCES_THREADS_MAX:           KERNEL_RESOURCES_THREADS_MAX_METRIC,
+	KERNEL_RESOURCES_THREADS_USED_PCT:      KERNEL_RESOURCES_THREADS_USED_PCT_METRIC,
+	KERNEL_RESOURCES_PID_MAX:               KERNEL_RESOURCES_PID_MAX_METRIC,
+	KERNEL_RESOURCES_PID_USED_PCT:          KERNEL_RESOURCES_PID_USED_PCT_METRIC,
+	KERNEL_RESOURCES_ENTROPY_AVAIL:         KERNEL_RESOURCES_ENTROPY_AVAIL_METRIC,
+	KERNEL_RESOURCES_ENTROPY_POOLSIZE:      KERNEL_RESOURCES_ENTROPY_POOLSIZE_METRIC,
+	KERNEL_RESOURCES_ENTROPY_AVAIL_PCT:     KERNEL_RESOURCES_ENTROPY_AVAIL_PCT_METRIC,
+}
+
+var kernelResourcesMetricsLog = NewCompLogger(KERNEL_RESOURCES_METRICS_ID)
+
+type KernelResourcesMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultKernelResourcesMetricsConfig() *KernelResourcesMetricsConfig {
+	return &KernelResourcesMetricsConfig{
+		Interval:          KERNEL_RESOURCES_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: KERNEL_RESOURCES_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+type KernelResourcesMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The parser; the metrics are generated based on value changes, so there
+	// is no need for prev, curr storage:
+	kernelResources *procfs.KernelResources
+
+	// The source for the process and thread counts. Normally this is the cache
+	// shared with proc_pid_metrics, to avoid a second /proc scan. If the
+	// latter is disabled, then a private PID only cache is used, refreshed at
+	// every scan:
+	pidTidListCache    procfs.PidTidListCacheIF
+	ownPidTidListCache bool
+	// The counts, as of the most recent scan; -1 if not available:
+	pidCount, tidCount int
+
+	// Metrics cache, w/o value, indexed by KERNEL_RESOURCES_...:
+	metrics [][]byte
+	// Previous values, as formatted, used for change detection:
+	prevVals []string
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+}
+
+func NewKernelResourcesMetrics(cfg any) (*KernelResourcesMetrics, error) {
+	var (
+		err                       error
+		kernelResourcesMetricsCfg *KernelResourcesMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		kernelResourcesMetricsCfg = cfg.KernelResourcesMetricsConfig
+	case *KernelResourcesMetricsConfig:
+		kernelResourcesMetricsCfg = cfg
+	case nil:
+		kernelResourcesMetricsCfg = DefaultKernelResourcesMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewKernelResourcesMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(kernelResourcesMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	kernelResourcesMetrics := &KernelResourcesMetrics{
+		id:                KERNEL_RESOURCES_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: kernelResourcesMetricsCfg.FullMetricsFactor,
+		pidCount:          -1,
+		tidCount:          -1,
+		prevVals:          make([]string, KERNEL_RESOURCES_NUM_METRICS),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	kernelResourcesMetricsLog.Infof("id=%s", kernelResourcesMetrics.id)
+	kernelResourcesMetricsLog.Infof("interval=%s", kernelResourcesMetrics.interval)
+	kernelResourcesMetricsLog.Infof("full_metrics_factor=%d", kernelResourcesMetrics.fullMetricsFactor)
+	return kernelResourcesMetrics, nil
+}
+
+func (krm *KernelResourcesMetrics) updateMetricsCache() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if krm.instance != "" {
+		instance = krm.instance
+	}
+	if krm.hostname != "" {
+		hostname = krm.hostname
+	}
+
+	krm.metrics = make([][]byte, KERNEL_RESOURCES_NUM_METRICS)
+	for index, name := range kernelResourcesMetricNames {
+		krm.metrics[index] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+	krm.cycleNum = initialCycleNum.Get(krm.fullMetricsFactor)
+}
+
+// Format used/limit as percentage, or "" if the limit is 0:
+func formatKernelResourcesPct(used, limit uint64) string {
+	if limit == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(
+		float64(used)/float64(limit)*100, 'f', KERNEL_RESOURCES_PCT_METRIC_PREC, 64,
+	)
+}
+
+func (krm *KernelResourcesMetrics) generateMetrics(buf *bytes.Buffer, ts time.Time) (int, int) {
+	if krm.metrics == nil {
+		krm.updateMetricsCache()
+	}
+
+	actualMetricsCount := 0
+	krm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		krm.tsSuffixBuf, " %d\n", ts.UnixMilli(),
+	)
+	promTs := krm.tsSuffixBuf.Bytes()
+
+	fullMetrics := krm.cycleNum == 0
+
+	// Build the values; an empty value indicates an unavailable metric:
+	values := krm.kernelResources.Values
+	vals := make([]string, KERNEL_RESOURCES_NUM_METRICS)
+
+	// N.B. FREE is always 0 for modern kernels, but account for it anyway:
+	fileHandlesUsed := values[procfs.KERNEL_RESOURCES_FILE_NR_ALLOCATED] - values[procfs.KERNEL_RESOURCES_FILE_NR_FREE]
+	vals[KERNEL_RESOURCES_FILE_HANDLES_USED] = strconv.FormatUint(fileHandlesUsed, 10)
+	vals[KERNEL_RESOURCES_FILE_HANDLES_MAX] = strconv.FormatUint(values[procfs.KERNEL_RESOURCES_FILE_NR_MAX], 10)
+	vals[KERNEL_RESOURCES_FILE_HANDLES_USED_PCT] = formatKernelResourcesPct(
+		fileHandlesUsed, values[procfs.KERNEL_RESOURCES_FILE_NR_MAX],
+	)
+
+	vals[KERNEL_RESOURCES_INODES_ALLOCATED] = strconv.FormatUint(values[procfs.KERNEL_RESOURCES_INODE_NR], 10)
+	vals[KERNEL_RESOURCES_INODES_FREE] = strconv.FormatUint(values[procfs.KERNEL_RESOURCES_INODE_NR_FREE], 10)
+
+	if krm.pidCount >= 0 {
+		vals[KERNEL_RESOURCES_PROCESSES_COUNT] = strconv.Itoa(krm.pidCount)
+	}
+
+	// Use the TID count from the cache if available, otherwise fallback over
+	// the loadavg one:
+	threadsCount := values[procfs.KERNEL_RESOURCES_NR_THREADS]
+	if krm.tidCount >= 0 {
+		threadsCount = uint64(krm.tidCount)
+	}
+	vals[KERNEL_RESOURCES_THREADS_COUNT] = strconv.FormatUint(threadsCount, 10)
+	vals[KERNEL_RESOURCES_THREADS_MAX] = strconv.FormatUint(values[procfs.KERNEL_RESOURCES_THREADS_MAX], 10)
+	vals[KERNEL_RESOURCES_THREADS_USED_PCT] = formatKernelResourcesPct(
+		threadsCount, values[procfs.KERNEL_RESOURCES_THREADS_MAX],
+	)
+
+	// Every thread consumes a PID:
+	vals[KERNEL_RESOURCES_PID_MAX] = strconv.FormatUint(values[procfs.KERNEL_RESOURCES_PID_MAX], 10)
+	vals[KERNEL_RESOURCES_PID_USED_PCT] = formatKernelResourcesPct(
+		threadsCount, values[procfs.KERNEL_RESOURCES_PID_MAX],
+	)
+
+	vals[KERNEL_RESOURCES_ENTROPY_AVAIL] = strconv.FormatUint(values[procfs.KERNEL_RESOURCES_ENTROPY_AVAIL], 10)
+	vals[KERNEL_RESOURCES_ENTROPY_POOLSIZE] = strconv.FormatUint(values[procfs.KERNEL_RESOURCES_ENTROPY_POOLSIZE], 10)
+	vals[KERNEL_RESOURCES_ENTROPY_AVAIL_PCT] = formatKernelResourcesPct(
+		values[procfs.KERNEL_RESOURCES_ENTROPY_AVAIL], values[procfs.KERNEL_RESOURCES_ENTROPY_POOLSIZE],
+	)
+
+	totalMetricsCount := 0
+	for index, val := range vals {
+		if val == "" {
+			continue
+		}
+		if fullMetrics || val != krm.prevVals[index] {
+			buf.Write(krm.metrics[index])
+			buf.WriteString(val)
+			buf.Write(promTs)
+			actualMetricsCount++
+		}
+		totalMetricsCount++
+	}
+	krm.prevVals = vals
+
+	if krm.cycleNum++; krm.cycleNum >= krm.fullMetricsFactor {
+		krm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Update the process and thread counts:
+func (krm *KernelResourcesMetrics) updatePidTidCount() {
+	if krm.pidTidListCache == nil {
+		if GlobalPidTidListCache != nil {
+			krm.pidTidListCache = GlobalPidTidListCache
+			kernelResourcesMetricsLog.Info("process/thread counts based on proc_pid_metrics PID list cache")
+		} else {
+			procfsRoot := GlobalProcfsRoot
+			if krm.procfsRoot != "" {
+				procfsRoot = krm.procfsRoot
+			}
+			krm.pidTidListCache = procfs.NewPidTidListCache(procfsRoot, 1, 0, procfs.PID_LIST_CACHE_PID_ENABLED)
+			krm.ownPidTidListCache = true
+			kernelResourcesMetricsLog.Info("process counts based on own PID list cache, thread counts based on loadavg")
+		}
+	}
+	if krm.ownPidTidListCache {
+		krm.pidTidListCache.Invalidate()
+	}
+	pidCount, tidCount, err := krm.pidTidListCache.GetPidTidCount()
+	if err != nil {
+		kernelResourcesMetricsLog.Warnf("process/thread counts: %v", err)
+		pidCount, tidCount = -1, -1
+	}
+	krm.pidCount, krm.tidCount = pidCount, tidCount
+}
+
+// Satisfy the TaskActivity interface:
+func (krm *KernelResourcesMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if krm.timeNowFn != nil {
+		timeNowFn = krm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if krm.metricsQueue != nil {
+		metricsQueue = krm.metricsQueue
+	}
+
+	if krm.kernelResources == nil {
+		procfsRoot := GlobalProcfsRoot
+		if krm.procfsRoot != "" {
+			procfsRoot = krm.procfsRoot
+		}
+		krm.kernelResources = procfs.NewKernelResources(procfsRoot)
+	}
+	err := krm.kernelResources.Parse()
+	if err != nil {
+		kernelResourcesMetricsLog.Warnf("%v: kernel resources metrics will be disabled", err)
+		return false
+	}
+	krm.updatePidTidCount()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := krm.generateMetrics(buf, timeNowFn())
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		krm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func KernelResourcesMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	krm, err := NewKernelResourcesMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if krm.interval <= 0 {
+		kernelResourcesMetricsLog.Infof(
+			"interval=%s, metrics disabled", krm.interval,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(krm.id, krm.interval, krm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(KernelResourcesMetricsTaskBuilder)
+}
@@ -0,0 +1,172 @@
+// Tests for kernel_resources_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+type KernelResourcesMetricsTestCase struct {
+	Name               string
+	Values             []uint64
+	PidCount, TidCount int
+	PrevVals           []string
+	CycleNum           int
+	FullMetricsFactor  int
+	WantMetricsCount   int
+	WantMetrics        []string
+	ReportExtra        bool
+}
+
+func testKernelResourcesMetrics(tc *KernelResourcesMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	kernelResourcesMetrics, err := NewKernelResourcesMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kernelResourcesMetrics.instance = "lsvmi-test"
+	kernelResourcesMetrics.hostname = "lsvmi-test-host"
+	kernelResourcesMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	kernelResourcesMetrics.updateMetricsCache()
+	kernelResourcesMetrics.cycleNum = tc.CycleNum
+	if tc.PrevVals != nil {
+		copy(kernelResourcesMetrics.prevVals, tc.PrevVals)
+	}
+	kernelResourcesMetrics.kernelResources = procfs.NewKernelResources("")
+	copy(kernelResourcesMetrics.kernelResources.Values, tc.Values)
+	kernelResourcesMetrics.pidCount, kernelResourcesMetrics.tidCount = tc.PidCount, tc.TidCount
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := kernelResourcesMetrics.generateMetrics(buf, time.UnixMilli(1_700_000_000_000))
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestKernelResourcesMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_000_000)
+
+	values := []uint64{
+		procfs.KERNEL_RESOURCES_FILE_NR_ALLOCATED: 2000,
+		procfs.KERNEL_RESOURCES_FILE_NR_FREE:      0,
+		procfs.KERNEL_RESOURCES_FILE_NR_MAX:       8000,
+		procfs.KERNEL_RESOURCES_INODE_NR:          5000,
+		procfs.KERNEL_RESOURCES_INODE_NR_FREE:     100,
+		procfs.KERNEL_RESOURCES_PID_MAX:           32768,
+		procfs.KERNEL_RESOURCES_THREADS_MAX:       4000,
+		procfs.KERNEL_RESOURCES_ENTROPY_AVAIL:     192,
+		procfs.KERNEL_RESOURCES_ENTROPY_POOLSIZE:  256,
+		procfs.KERNEL_RESOURCES_NR_THREADS:        1000,
+	}
+
+	for _, tc := range []*KernelResourcesMetricsTestCase{
+		{
+			Name:              "full_tid_count",
+			Values:            values,
+			PidCount:          300,
+			TidCount:          1200,
+			FullMetricsFactor: 0,
+			WantMetricsCount:  14,
+			WantMetrics: []string{
+				fmt.Sprintf(`kernel_file_handles_used{%s} 2000 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_file_handles_max{%s} 8000 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_file_handles_used_pct{%s} 25.0 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_inodes_allocated{%s} 5000 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_inodes_free{%s} 100 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_processes_count{%s} 300 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_threads_count{%s} 1200 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_threads_max{%s} 4000 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_threads_used_pct{%s} 30.0 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_pid_max{%s} 32768 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_pid_used_pct{%s} 3.7 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_entropy_avail{%s} 192 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_entropy_poolsize{%s} 256 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_entropy_avail_pct{%s} 75.0 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name:              "full_loadavg_threads_no_pid_count",
+			Values:            values,
+			PidCount:          -1,
+			TidCount:          -1,
+			FullMetricsFactor: 0,
+			WantMetricsCount:  13,
+			WantMetrics: []string{
+				fmt.Sprintf(`kernel_threads_count{%s} 1000 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_threads_used_pct{%s} 25.0 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_pid_used_pct{%s} 3.1 %d`, labels, promTs),
+			},
+		},
+		{
+			Name:     "partial",
+			Values:   values,
+			PidCount: 301,
+			TidCount: 1200,
+			PrevVals: []string{
+				KERNEL_RESOURCES_FILE_HANDLES_USED:     "2000",
+				KERNEL_RESOURCES_FILE_HANDLES_MAX:      "8000",
+				KERNEL_RESOURCES_FILE_HANDLES_USED_PCT: "25.0",
+				KERNEL_RESOURCES_INODES_ALLOCATED:      "5000",
+				KERNEL_RESOURCES_INODES_FREE:           "101",
+				KERNEL_RESOURCES_PROCESSES_COUNT:       "300",
+				KERNEL_RESOURCES_THREADS_COUNT:         "1200",
+				KERNEL_RESOURCES_THREADS_MAX:           "4000",
+				KERNEL_RESOURCES_THREADS_USED_PCT:      "30.0",
+				KERNEL_RESOURCES_PID_MAX:               "32768",
+				KERNEL_RESOURCES_PID_USED_PCT:          "3.7",
+				KERNEL_RESOURCES_ENTROPY_AVAIL:         "192",
+				KERNEL_RESOURCES_ENTROPY_POOLSIZE:      "256",
+				KERNEL_RESOURCES_ENTROPY_AVAIL_PCT:     "75.0",
+			},
+			CycleNum:          1,
+			FullMetricsFactor: 12,
+			WantMetricsCount:  2,
+			WantMetrics: []string{
+				fmt.Sprintf(`kernel_inodes_free{%s} 100 %d`, labels, promTs),
+				fmt.Sprintf(`kernel_processes_count{%s} 301 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "zero_limit",
+			Values: []uint64{
+				procfs.KERNEL_RESOURCES_FILE_NR_ALLOCATED: 2000,
+				procfs.KERNEL_RESOURCES_PID_MAX:           32768,
+				procfs.KERNEL_RESOURCES_THREADS_MAX:       4000,
+				procfs.KERNEL_RESOURCES_NR_THREADS:        1000,
+			},
+			PidCount:          300,
+			TidCount:          -1,
+			FullMetricsFactor: 0,
+			// No pct for file handles and entropy:
+			WantMetricsCount: 12,
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testKernelResourcesMetrics(tc, t) },
+		)
+	}
+}
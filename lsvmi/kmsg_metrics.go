@@ -0,0 +1,578 @@
+// Kernel log event counters, based on /dev/kmsg records matched against
+// configurable regex rules, e.g. OOM kills, hung tasks, I/O errors.
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	KMSG_METRICS_CONFIG_INTERVAL_DEFAULT              = "5s"
+	KMSG_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT   = 12
+	KMSG_METRICS_CONFIG_KMSG_PATH_DEFAULT             = "/dev/kmsg"
+	KMSG_METRICS_CONFIG_LAST_MATCH_INFO_DEFAULT       = false
+	KMSG_METRICS_CONFIG_LAST_MATCH_MAX_LENGTH_DEFAULT = 128
+
+	// This generator id:
+	KMSG_METRICS_ID = "kmsg_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",rule="RULE"}:
+	KMSG_RULE_MATCH_DELTA_METRIC = "kmsg_rule_match_delta"
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",rule="RULE",line="LINE"}:
+	KMSG_RULE_LAST_MATCH_INFO_METRIC = "kmsg_rule_last_match_info"
+
+	KMSG_RULE_LABEL_NAME = "rule"
+	KMSG_LINE_LABEL_NAME = "line"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME"}:
+	KMSG_RECORD_DELTA_METRIC      = "kmsg_record_delta"
+	KMSG_LOST_RECORD_DELTA_METRIC = "kmsg_lost_record_delta"
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	KMSG_INTERVAL_METRIC = "kmsg_metrics_delta_sec"
+)
+
+// Each read from /dev/kmsg returns exactly one record and it fails w/ EINVAL if
+// the buffer cannot accommodate it. The max formatted record size is given by
+// CONSOLE_EXT_LOG_MAX in the kernel. The read buffer is twice that, to allow
+// for a partial line carried over from a previous read when the path is a
+// regular file.
+const (
+	KMSG_MAX_RECORD_SIZE = 8192
+	KMSG_READ_BUF_SIZE   = 2 * KMSG_MAX_RECORD_SIZE
+)
+
+var kmsgMetricsLog = NewCompLogger(KMSG_METRICS_ID)
+
+// Escape the value of a label built from the record message:
+var kmsgLabelValueReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+type KmsgRuleConfig struct {
+	// The rule name, used as the value of the rule label:
+	Name string `yaml:"name"`
+	// The regex matched against the message part of the record, RE2 syntax:
+	Regex string `yaml:"regex"`
+}
+
+type KmsgMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The kernel log device; a regular file may be used instead, e.g. for
+	// testing, in which case it should hold one record per line:
+	KmsgPath string `yaml:"kmsg_path"`
+	// The list of rules; a record is classified according to the first
+	// matching rule. The generator is disabled if empty:
+	Rules []*KmsgRuleConfig `yaml:"rules"`
+	// Whether to generate the last matched line info metric or not:
+	LastMatchInfo bool `yaml:"last_match_info"`
+	// The max length of the line in the info metric, longer lines are
+	// truncated:
+	LastMatchMaxLength int `yaml:"last_match_max_length"`
+}
+
+func DefaultKmsgRulesConfig() []*KmsgRuleConfig {
+	return []*KmsgRuleConfig{
+		{Name: "oom_kill", Regex: `(?i)out of memory: kill(ed)? process`},
+		{Name: "hung_task", Regex: `blocked for more than \d+ seconds`},
+		{Name: "soft_lockup", Regex: `soft lockup - CPU#\d+ stuck`},
+		{Name: "hard_lockup", Regex: `(?i)hard lockup on cpu`},
+		{Name: "mce", Regex: `\[Hardware Error\]|Machine check events logged`},
+		{Name: "nic_reset", Regex: `(?i)netdev watchdog:|(tx|transmit) (hang|timeout)|reset adapter`},
+		{Name: "io_error", Regex: `I/O error`},
+		{Name: "segfault", Regex: `segfault at [0-9a-f]+`},
+	}
+}
+
+func DefaultKmsgMetricsConfig() *KmsgMetricsConfig {
+	return &KmsgMetricsConfig{
+		Interval:           KMSG_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor:  KMSG_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		KmsgPath:           KMSG_METRICS_CONFIG_KMSG_PATH_DEFAULT,
+		Rules:              DefaultKmsgRulesConfig(),
+		LastMatchInfo:      KMSG_METRICS_CONFIG_LAST_MATCH_INFO_DEFAULT,
+		LastMatchMaxLength: KMSG_METRICS_CONFIG_LAST_MATCH_MAX_LENGTH_DEFAULT,
+	}
+}
+
+// Per rule state:
+type KmsgRule struct {
+	name string
+	re   *regexp.Regexp
+
+	// The number of matches since the previous generation and whether the
+	// previous delta was zero:
+	matchCount uint64
+	zeroDelta  bool
+
+	// The most recent matched line, truncated, "" if none yet, and whether it
+	// changed since the previous generation:
+	lastMatch        string
+	lastMatchChanged bool
+
+	// Match delta metric, w/o value:
+	matchDeltaMetric []byte
+	// Info metric, w/ all the labels, w/o value, rebuilt only when the last
+	// match changes:
+	infoMetric []byte
+}
+
+type KmsgMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// As configured:
+	kmsgPath           string
+	lastMatchInfo      bool
+	lastMatchMaxLength int
+
+	// The rules, in config order:
+	rules []*KmsgRule
+
+	// The file descriptor, -1 if not open yet. The file is read w/ syscalls
+	// rather than via os.File since the latter would register a non-blocking
+	// character device w/ the runtime poller, turning EAGAIN into a wait:
+	fd int
+	// The read buffer and the length of the partial line at its start, if
+	// any, carried over from the previous read:
+	readBuf    []byte
+	partialLen int
+
+	// The sequence# of the most recent record and whether it is valid or not;
+	// gaps in the sequence indicate records overwritten in the kernel ring
+	// buffer before they could be read:
+	seq      uint64
+	seqValid bool
+
+	// The number of records and lost records since the previous generation and
+	// whether the previous delta was zero:
+	recordCount, lostCount         uint64
+	zeroRecordDelta, zeroLostDelta bool
+
+	// Timestamps of the current and previous scan:
+	currTs, prevTs time.Time
+
+	// Whether the metrics cache was built or not:
+	metricsCacheBuilt bool
+	// Generator level metrics, w/o value:
+	recordDeltaMetric, lostDeltaMetric, intervalMetric []byte
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+}
+
+func NewKmsgMetrics(cfg any) (*KmsgMetrics, error) {
+	var (
+		err            error
+		kmsgMetricsCfg *KmsgMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		kmsgMetricsCfg = cfg.KmsgMetricsConfig
+	case *KmsgMetricsConfig:
+		kmsgMetricsCfg = cfg
+	case nil:
+		kmsgMetricsCfg = DefaultKmsgMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewKmsgMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(kmsgMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	kmsgMetrics := &KmsgMetrics{
+		id:                 KMSG_METRICS_ID,
+		interval:           interval,
+		fullMetricsFactor:  kmsgMetricsCfg.FullMetricsFactor,
+		kmsgPath:           kmsgMetricsCfg.KmsgPath,
+		lastMatchInfo:      kmsgMetricsCfg.LastMatchInfo,
+		lastMatchMaxLength: kmsgMetricsCfg.LastMatchMaxLength,
+		rules:              make([]*KmsgRule, 0, len(kmsgMetricsCfg.Rules)),
+		fd:                 -1,
+		tsSuffixBuf:        &bytes.Buffer{},
+	}
+	if kmsgMetrics.kmsgPath == "" {
+		kmsgMetrics.kmsgPath = KMSG_METRICS_CONFIG_KMSG_PATH_DEFAULT
+	}
+	if kmsgMetrics.lastMatchMaxLength <= 0 {
+		kmsgMetrics.lastMatchMaxLength = KMSG_METRICS_CONFIG_LAST_MATCH_MAX_LENGTH_DEFAULT
+	}
+	ruleNames := make(map[string]bool)
+	for _, ruleCfg := range kmsgMetricsCfg.Rules {
+		if ruleCfg.Name == "" {
+			return nil, fmt.Errorf("NewKmsgMetrics: rules: %q: empty name", ruleCfg.Regex)
+		}
+		if ruleNames[ruleCfg.Name] {
+			return nil, fmt.Errorf("NewKmsgMetrics: rules: %q: duplicate name", ruleCfg.Name)
+		}
+		ruleNames[ruleCfg.Name] = true
+		re, err := regexp.Compile(ruleCfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("NewKmsgMetrics: rules: %q: %v", ruleCfg.Name, err)
+		}
+		kmsgMetrics.rules = append(kmsgMetrics.rules, &KmsgRule{name: ruleCfg.Name, re: re})
+	}
+
+	kmsgMetricsLog.Infof("id=%s", kmsgMetrics.id)
+	kmsgMetricsLog.Infof("interval=%s", kmsgMetrics.interval)
+	kmsgMetricsLog.Infof("full_metrics_factor=%d", kmsgMetrics.fullMetricsFactor)
+	kmsgMetricsLog.Infof("kmsg_path=%s", kmsgMetrics.kmsgPath)
+	kmsgMetricsLog.Infof("last_match_info=%v", kmsgMetrics.lastMatchInfo)
+	kmsgMetricsLog.Infof("last_match_max_length=%d", kmsgMetrics.lastMatchMaxLength)
+	for _, rule := range kmsgMetrics.rules {
+		kmsgMetricsLog.Infof("rule: name=%s, regex=%s", rule.name, rule.re)
+	}
+	return kmsgMetrics, nil
+}
+
+func (kmm *KmsgMetrics) updateMetricsCache() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if kmm.instance != "" {
+		instance = kmm.instance
+	}
+	if kmm.hostname != "" {
+		hostname = kmm.hostname
+	}
+
+	for _, rule := range kmm.rules {
+		rule.matchDeltaMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			KMSG_RULE_MATCH_DELTA_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			KMSG_RULE_LABEL_NAME, kmsgLabelValueReplacer.Replace(rule.name),
+		))
+	}
+	kmm.recordDeltaMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		KMSG_RECORD_DELTA_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+	))
+	kmm.lostDeltaMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		KMSG_LOST_RECORD_DELTA_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+	))
+	kmm.intervalMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		KMSG_INTERVAL_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+	))
+	kmm.cycleNum = initialCycleNum.Get(kmm.fullMetricsFactor)
+	kmm.metricsCacheBuilt = true
+}
+
+// Build the info metric for the last match, w/o value:
+func (kmm *KmsgMetrics) buildInfoMetric(rule *KmsgRule) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if kmm.instance != "" {
+		instance = kmm.instance
+	}
+	if kmm.hostname != "" {
+		hostname = kmm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		KMSG_RULE_LAST_MATCH_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		KMSG_RULE_LABEL_NAME, kmsgLabelValueReplacer.Replace(rule.name),
+		KMSG_LINE_LABEL_NAME, kmsgLabelValueReplacer.Replace(rule.lastMatch),
+	))
+}
+
+// Classify a record, in the format:
+//
+//	PRIO,SEQ,TS_USEC,FLAGS[,...];MESSAGE
+//
+// optionally followed by continuation lines, starting w/ space, which are
+// ignored.
+func (kmm *KmsgMetrics) processRecord(record []byte) {
+	if len(record) == 0 || record[0] == ' ' {
+		return
+	}
+	kmm.recordCount++
+
+	msg := record
+	if i := bytes.IndexByte(record, ';'); i >= 0 {
+		msg = record[i+1:]
+		fields := bytes.SplitN(record[:i], []byte{','}, 3)
+		if len(fields) >= 2 {
+			seq, err := strconv.ParseUint(string(fields[1]), 10, 64)
+			if err == nil {
+				if kmm.seqValid && seq > kmm.seq+1 {
+					kmm.lostCount += seq - kmm.seq - 1
+				}
+				kmm.seq, kmm.seqValid = seq, true
+			}
+		}
+	}
+
+	for _, rule := range kmm.rules {
+		if rule.re.Match(msg) {
+			rule.matchCount++
+			if kmm.lastMatchInfo {
+				if len(msg) > kmm.lastMatchMaxLength {
+					n := kmm.lastMatchMaxLength
+					// Do not split a multi-byte character:
+					for n > 0 && !utf8.RuneStart(msg[n]) {
+						n--
+					}
+					msg = msg[:n]
+				}
+				if string(msg) != rule.lastMatch {
+					rule.lastMatch = string(msg)
+					rule.lastMatchChanged = true
+				}
+			}
+			break
+		}
+	}
+}
+
+// Open the file, if needed, positioned at the end, i.e. only the records
+// logged after the start are considered, and read all the available records.
+func (kmm *KmsgMetrics) readRecords() error {
+	if kmm.fd < 0 {
+		fd, err := syscall.Open(kmm.kmsgPath, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open(%s): %w", kmm.kmsgPath, err)
+		}
+		_, err = syscall.Seek(fd, 0, io.SeekEnd)
+		if err != nil {
+			syscall.Close(fd)
+			return fmt.Errorf("seek(%s): %w", kmm.kmsgPath, err)
+		}
+		kmm.fd = fd
+		kmm.readBuf = make([]byte, KMSG_READ_BUF_SIZE)
+		kmm.partialLen = 0
+	}
+
+	buf := kmm.readBuf
+	for {
+		n, err := syscall.Read(kmm.fd, buf[kmm.partialLen:])
+		if err != nil {
+			switch err {
+			case syscall.EAGAIN:
+				// No more records:
+				return nil
+			case syscall.EPIPE, syscall.EINTR:
+				// EPIPE: records were overwritten before they could be read,
+				// the next read resumes w/ the oldest available one; they
+				// are accounted for via the sequence# gap.
+				continue
+			default:
+				return fmt.Errorf("read(%s): %w", kmm.kmsgPath, err)
+			}
+		}
+		if n == 0 {
+			// EOF, regular file:
+			return nil
+		}
+		end, start := kmm.partialLen+n, 0
+		for {
+			i := bytes.IndexByte(buf[start:end], '\n')
+			if i < 0 {
+				break
+			}
+			kmm.processRecord(buf[start : start+i])
+			start += i + 1
+		}
+		kmm.partialLen = copy(buf, buf[start:end])
+		if kmm.partialLen > KMSG_MAX_RECORD_SIZE {
+			// Overlong line, discard it:
+			kmm.partialLen = 0
+		}
+	}
+}
+
+func (kmm *KmsgMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	if !kmm.metricsCacheBuilt {
+		kmm.updateMetricsCache()
+	}
+
+	actualMetricsCount := 0
+	kmm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		kmm.tsSuffixBuf, " %d\n", kmm.currTs.UnixMilli(),
+	)
+	promTs := kmm.tsSuffixBuf.Bytes()
+
+	fullMetrics := kmm.cycleNum == 0
+	totalMetricsCount := 0
+
+	for _, rule := range kmm.rules {
+		delta := rule.matchCount
+		if delta != 0 || fullMetrics || !rule.zeroDelta {
+			buf.Write(rule.matchDeltaMetric)
+			buf.WriteString(strconv.FormatUint(delta, 10))
+			buf.Write(promTs)
+			actualMetricsCount++
+		}
+		rule.zeroDelta = delta == 0
+		rule.matchCount = 0
+		totalMetricsCount++
+
+		if kmm.lastMatchInfo && rule.lastMatch != "" {
+			// Pseudo-categorical metric, clear the previous one if the line
+			// changed:
+			changed := rule.lastMatchChanged
+			if changed {
+				if rule.infoMetric != nil {
+					buf.Write(rule.infoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				rule.infoMetric = kmm.buildInfoMetric(rule)
+				rule.lastMatchChanged = false
+			}
+			if changed || fullMetrics {
+				buf.Write(rule.infoMetric)
+				buf.WriteByte('1')
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			totalMetricsCount++
+		}
+	}
+
+	delta := kmm.recordCount
+	if delta != 0 || fullMetrics || !kmm.zeroRecordDelta {
+		buf.Write(kmm.recordDeltaMetric)
+		buf.WriteString(strconv.FormatUint(delta, 10))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+	kmm.zeroRecordDelta = delta == 0
+	kmm.recordCount = 0
+	totalMetricsCount++
+
+	delta = kmm.lostCount
+	if delta != 0 || fullMetrics || !kmm.zeroLostDelta {
+		buf.Write(kmm.lostDeltaMetric)
+		buf.WriteString(strconv.FormatUint(delta, 10))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+	kmm.zeroLostDelta = delta == 0
+	kmm.lostCount = 0
+	totalMetricsCount++
+
+	if !kmm.prevTs.IsZero() {
+		buf.Write(kmm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(kmm.currTs.Sub(kmm.prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+		totalMetricsCount++
+	}
+
+	if kmm.cycleNum++; kmm.cycleNum >= kmm.fullMetricsFactor {
+		kmm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (kmm *KmsgMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if kmm.timeNowFn != nil {
+		timeNowFn = kmm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if kmm.metricsQueue != nil {
+		metricsQueue = kmm.metricsQueue
+	}
+
+	err := kmm.readRecords()
+	if err != nil {
+		kmsgMetricsLog.Warnf("%v: kmsg metrics will be disabled", err)
+		return false
+	}
+	kmm.prevTs, kmm.currTs = kmm.currTs, timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := kmm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		kmm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func KmsgMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	kmm, err := NewKmsgMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if kmm.interval <= 0 {
+		kmsgMetricsLog.Infof(
+			"interval=%s, metrics disabled", kmm.interval,
+		)
+		return nil, nil
+	}
+	if len(kmm.rules) == 0 {
+		kmsgMetricsLog.Info("no rules configured, metrics disabled")
+		return nil, nil
+	}
+	if _, err := os.Stat(kmm.kmsgPath); errors.Is(err, fs.ErrNotExist) {
+		kmsgMetricsLog.Infof("%s not found, metrics disabled", kmm.kmsgPath)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(kmm.id, kmm.interval, kmm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(KmsgMetricsTaskBuilder)
+}
@@ -0,0 +1,233 @@
+// Tests for kmsg_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+var kmsgMetricsTestRecordedFile = path.Join("..", testutils.LsvmiTestDataSubdir, "kmsg", "kmsg")
+
+type KmsgMetricsTestCase struct {
+	Name string
+	// Content present before the first scan, it should be skipped:
+	InitialContent string
+	// The sequence of content appended before each scan; the special value
+	// "@recorded" denotes the recorded kmsg stream. Metrics are checked after
+	// the last one:
+	ContentSeq         []string
+	LastMatchInfo      bool
+	LastMatchMaxLength int
+	FullMetricsFactor  int
+	WantMetricsCount   int
+	WantMetrics        []string
+	ReportExtra        bool
+}
+
+func testKmsgMetrics(tc *KmsgMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	kmsgPath := path.Join(t.TempDir(), "kmsg")
+	if err := os.WriteFile(kmsgPath, []byte(tc.InitialContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := os.ReadFile(kmsgMetricsTestRecordedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kmsgMetricsCfg := DefaultKmsgMetricsConfig()
+	kmsgMetricsCfg.FullMetricsFactor = tc.FullMetricsFactor
+	kmsgMetricsCfg.KmsgPath = kmsgPath
+	kmsgMetricsCfg.LastMatchInfo = tc.LastMatchInfo
+	if tc.LastMatchMaxLength > 0 {
+		kmsgMetricsCfg.LastMatchMaxLength = tc.LastMatchMaxLength
+	}
+	kmsgMetrics, err := NewKmsgMetrics(kmsgMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmsgMetrics.instance = "lsvmi-test"
+	kmsgMetrics.hostname = "lsvmi-test-host"
+
+	ts := time.UnixMilli(1_700_000_000_000)
+	var testMetricsQueue *testutils.TestMetricsQueue
+	gotMetricsCount := 0
+	for _, content := range tc.ContentSeq {
+		data := []byte(content)
+		if content == "@recorded" {
+			data = recorded
+		}
+		f, err := os.OpenFile(kmsgPath, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write(data)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := kmsgMetrics.readRecords(); err != nil {
+			t.Fatal(err)
+		}
+		kmsgMetrics.prevTs, kmsgMetrics.currTs = kmsgMetrics.currTs, ts
+		testMetricsQueue = testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ = kmsgMetrics.generateMetrics(buf)
+		testMetricsQueue.QueueBuf(buf)
+		ts = ts.Add(5 * time.Second)
+	}
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestKmsgMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_005_000)
+
+	for _, tc := range []*KmsgMetricsTestCase{
+		{
+			Name:               "full",
+			InitialContent:     "3,900,1000000,-;Out of memory: Killed process 1 (init)\n",
+			ContentSeq:         []string{"", "@recorded"},
+			LastMatchInfo:      true,
+			LastMatchMaxLength: 32,
+			FullMetricsFactor:  0,
+			WantMetricsCount:   15,
+			WantMetrics: []string{
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="oom_kill"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="hung_task"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="soft_lockup"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="hard_lockup"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="mce"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="nic_reset"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="io_error"} 2 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="segfault"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_last_match_info{%s,rule="oom_kill",line="Out of memory: Killed process 43"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_last_match_info{%s,rule="nic_reset",line="NETDEV WATCHDOG: eno1 (e1000e): "} 1 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_last_match_info{%s,rule="io_error",line="Buffer I/O error on dev sda1, lo"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_rule_last_match_info{%s,rule="segfault",line="python3[4242]: segfault at 0 ip "} 1 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_record_delta{%s} 7 %d`, labels, promTs),
+				// 1005 and 1006 are missing:
+				fmt.Sprintf(`kmsg_lost_record_delta{%s} 2 %d`, labels, promTs),
+				fmt.Sprintf(`kmsg_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "partial_line",
+			ContentSeq: []string{
+				"",
+				"3,2001,1000000,-;Out of memory: Killed pro",
+				"cess 1 (init)\n",
+			},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  3,
+			WantMetrics: []string{
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="oom_kill"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_record_delta{%s} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+5000),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "info_change",
+			ContentSeq: []string{
+				"",
+				"@recorded",
+				"3,1010,9000000,-;blk_update_request: I/O error, dev sdb, sector 1\n",
+			},
+			LastMatchInfo:     true,
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  9,
+			WantMetrics: []string{
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="oom_kill"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="nic_reset"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="io_error"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="segfault"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_last_match_info{%s,rule="io_error",line="Buffer I/O error on dev sda1, logical block 15432, async page read"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_last_match_info{%s,rule="io_error",line="blk_update_request: I/O error, dev sdb, sector 1"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_record_delta{%s} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_lost_record_delta{%s} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+5000),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "info_same_line",
+			ContentSeq: []string{
+				"",
+				"@recorded",
+				"3,1010,9000000,-;Buffer I/O error on dev sda1, logical block 15432, async page read\n",
+			},
+			LastMatchInfo:     true,
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  7,
+			WantMetrics: []string{
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="oom_kill"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="nic_reset"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="io_error"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_rule_match_delta{%s,rule="segfault"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_record_delta{%s} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_lost_record_delta{%s} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`kmsg_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+5000),
+			},
+			ReportExtra: true,
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testKmsgMetrics(tc, t) },
+		)
+	}
+}
+
+func TestKmsgMetricsConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		rules     []*KmsgRuleConfig
+		wantError bool
+	}{
+		{"valid", []*KmsgRuleConfig{{Name: "a", Regex: "a"}, {Name: "b", Regex: "b+"}}, false},
+		{"empty_name", []*KmsgRuleConfig{{Regex: "a"}}, true},
+		{"duplicate_name", []*KmsgRuleConfig{{Name: "a", Regex: "a"}, {Name: "a", Regex: "b"}}, true},
+		{"invalid_regex", []*KmsgRuleConfig{{Name: "a", Regex: "a("}}, true},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) {
+				tlc := testutils.NewTestLogCollect(t, Log, nil)
+				defer tlc.RestoreLog()
+
+				kmsgMetricsCfg := DefaultKmsgMetricsConfig()
+				kmsgMetricsCfg.Rules = tc.rules
+				_, err := NewKmsgMetrics(kmsgMetricsCfg)
+				if tc.wantError && err == nil {
+					t.Fatal("want error, got nil")
+				}
+				if !tc.wantError && err != nil {
+					t.Fatal(err)
+				}
+			},
+		)
+	}
+}
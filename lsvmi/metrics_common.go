@@ -180,6 +180,7 @@ func InitCommonMetrics(cfg any) error {
 	GlobalInstance = globalCfg.Instance
 	GlobalHostname = hostname
 	GlobalProcfsRoot = globalCfg.ProcfsRoot
+	GlobalSysfsRoot = globalCfg.SysfsRoot
 	GlobalMetricsGeneratorStatsContainer = NewMetricsGeneratorStatsContainer()
 
 	return nil
@@ -0,0 +1,335 @@
+// netfilter conntrack metrics based on:
+//  /proc/sys/net/netfilter/nf_conntrack_count
+//  /proc/sys/net/netfilter/nf_conntrack_max
+//  /proc/net/stat/nf_conntrack
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	NF_CONNTRACK_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	NF_CONNTRACK_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+
+	// This generator id:
+	NF_CONNTRACK_METRICS_ID = "nf_conntrack_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME"}:
+	NF_CONNTRACK_COUNT_METRIC    = "nf_conntrack_count"
+	NF_CONNTRACK_MAX_METRIC      = "nf_conntrack_max"
+	NF_CONNTRACK_FILL_PCT_METRIC = "nf_conntrack_fill_pct"
+
+	NF_CONNTRACK_FOUND_DELTA_METRIC          = "nf_conntrack_found_delta"
+	NF_CONNTRACK_INVALID_DELTA_METRIC        = "nf_conntrack_invalid_delta"
+	NF_CONNTRACK_INSERT_FAILED_DELTA_METRIC  = "nf_conntrack_insert_failed_delta"
+	NF_CONNTRACK_DROP_DELTA_METRIC           = "nf_conntrack_drop_delta"
+	NF_CONNTRACK_EARLY_DROP_DELTA_METRIC     = "nf_conntrack_early_drop_delta"
+	NF_CONNTRACK_SEARCH_RESTART_DELTA_METRIC = "nf_conntrack_search_restart_delta"
+
+	NF_CONNTRACK_FILL_PCT_METRIC_PREC = 1
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	NF_CONNTRACK_INTERVAL_METRIC = "nf_conntrack_metrics_delta_sec"
+)
+
+// Map stats index (see procfs/nf_conntrack_parser.go) into metrics names:
+var nfConntrackIndexDeltaMetricNameMap = map[int]string{
+	procfs.NF_CONNTRACK_STAT_FOUND:          NF_CONNTRACK_FOUND_DELTA_METRIC,
+	procfs.NF_CONNTRACK_STAT_INVALID:        NF_CONNTRACK_INVALID_DELTA_METRIC,
+	procfs.NF_CONNTRACK_STAT_INSERT_FAILED:  NF_CONNTRACK_INSERT_FAILED_DELTA_METRIC,
+	procfs.NF_CONNTRACK_STAT_DROP:           NF_CONNTRACK_DROP_DELTA_METRIC,
+	procfs.NF_CONNTRACK_STAT_EARLY_DROP:     NF_CONNTRACK_EARLY_DROP_DELTA_METRIC,
+	procfs.NF_CONNTRACK_STAT_SEARCH_RESTART: NF_CONNTRACK_SEARCH_RESTART_DELTA_METRIC,
+}
+
+var nfConntrackMetricsLog = NewCompLogger(NF_CONNTRACK_METRICS_ID)
+
+type NfConntrackMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultNfConntrackMetricsConfig() *NfConntrackMetricsConfig {
+	return &NfConntrackMetricsConfig{
+		Interval:          NF_CONNTRACK_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: NF_CONNTRACK_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+type NfConntrackMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// Dual storage for parsed stats used as previous, current:
+	nfConntrack [2]*procfs.NfConntrack
+	// Timestamp when the stats were collected:
+	nfConntrackTs [2]time.Time
+	// Index for current stats, toggled after each use:
+	currIndex int
+
+	// Cycle#:
+	cycleNum int
+
+	// Delta metrics are generated with skip-zero-after-zero rule, i.e. if the
+	// current and previous deltas are both zero, then the current metric is
+	// skipped, save for full cycles. Keep track of zero deltas, indexed by
+	// procfs.NF_CONNTRACK_STAT_...:
+	zeroDelta []bool
+
+	// Metrics cache:
+	countMetric, maxMetric, fillPctMetric []byte
+	// Delta metrics, indexed by procfs.NF_CONNTRACK_STAT_...:
+	deltaMetrics [][]byte
+	// Interval metric:
+	intervalMetric []byte
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+}
+
+func NewNfConntrackMetrics(cfg any) (*NfConntrackMetrics, error) {
+	var (
+		err                   error
+		nfConntrackMetricsCfg *NfConntrackMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		nfConntrackMetricsCfg = cfg.NfConntrackMetricsConfig
+	case *NfConntrackMetricsConfig:
+		nfConntrackMetricsCfg = cfg
+	case nil:
+		nfConntrackMetricsCfg = DefaultNfConntrackMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewNfConntrackMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(nfConntrackMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	nfConntrackMetrics := &NfConntrackMetrics{
+		id:                NF_CONNTRACK_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: nfConntrackMetricsCfg.FullMetricsFactor,
+		zeroDelta:         make([]bool, procfs.NF_CONNTRACK_NUM_STATS),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	nfConntrackMetricsLog.Infof("id=%s", nfConntrackMetrics.id)
+	nfConntrackMetricsLog.Infof("interval=%s", nfConntrackMetrics.interval)
+	nfConntrackMetricsLog.Infof("full_metrics_factor=%d", nfConntrackMetrics.fullMetricsFactor)
+	return nfConntrackMetrics, nil
+}
+
+func (nfcm *NfConntrackMetrics) updateMetricsCache() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if nfcm.instance != "" {
+		instance = nfcm.instance
+	}
+	if nfcm.hostname != "" {
+		hostname = nfcm.hostname
+	}
+
+	buildMetric := func(name string) []byte {
+		return []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+
+	nfcm.countMetric = buildMetric(NF_CONNTRACK_COUNT_METRIC)
+	nfcm.maxMetric = buildMetric(NF_CONNTRACK_MAX_METRIC)
+	nfcm.fillPctMetric = buildMetric(NF_CONNTRACK_FILL_PCT_METRIC)
+	nfcm.deltaMetrics = make([][]byte, procfs.NF_CONNTRACK_NUM_STATS)
+	for index, name := range nfConntrackIndexDeltaMetricNameMap {
+		nfcm.deltaMetrics[index] = buildMetric(name)
+	}
+	nfcm.intervalMetric = buildMetric(NF_CONNTRACK_INTERVAL_METRIC)
+	nfcm.cycleNum = initialCycleNum.Get(nfcm.fullMetricsFactor)
+}
+
+func (nfcm *NfConntrackMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	currNfConntrack, prevNfConntrack := nfcm.nfConntrack[nfcm.currIndex], nfcm.nfConntrack[1-nfcm.currIndex]
+	currTs, prevTs := nfcm.nfConntrackTs[nfcm.currIndex], nfcm.nfConntrackTs[1-nfcm.currIndex]
+	nfcm.currIndex = 1 - nfcm.currIndex
+
+	if nfcm.intervalMetric == nil {
+		nfcm.updateMetricsCache()
+	}
+
+	actualMetricsCount := 0
+	nfcm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		nfcm.tsSuffixBuf, " %d\n", currTs.UnixMilli(),
+	)
+	promTs := nfcm.tsSuffixBuf.Bytes()
+
+	fullMetrics := prevNfConntrack == nil || nfcm.cycleNum == 0
+
+	// Usage metrics:
+	count, max := currNfConntrack.Count, currNfConntrack.Max
+	countChanged := fullMetrics || count != prevNfConntrack.Count
+	maxChanged := fullMetrics || max != prevNfConntrack.Max
+	if countChanged {
+		buf.Write(nfcm.countMetric)
+		buf.WriteString(strconv.FormatUint(count, 10))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+	if maxChanged {
+		buf.Write(nfcm.maxMetric)
+		buf.WriteString(strconv.FormatUint(max, 10))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+	if (countChanged || maxChanged) && max > 0 {
+		buf.Write(nfcm.fillPctMetric)
+		buf.WriteString(strconv.FormatFloat(
+			float64(count)/float64(max)*100, 'f', NF_CONNTRACK_FILL_PCT_METRIC_PREC, 64,
+		))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+
+	// Delta metrics, they require a previous state:
+	if prevNfConntrack != nil {
+		currStats, prevStats := currNfConntrack.Stats, prevNfConntrack.Stats
+		zeroDelta := nfcm.zeroDelta
+		for index, metric := range nfcm.deltaMetrics {
+			// N.B. The stats are uint32, see procfs/nf_conntrack_parser.go:
+			val := currStats[index] - prevStats[index]
+			if val != 0 || fullMetrics || !zeroDelta[index] {
+				buf.Write(metric)
+				buf.WriteString(strconv.FormatUint(uint64(val), 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			zeroDelta[index] = val == 0
+		}
+
+		buf.Write(nfcm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(currTs.Sub(prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+
+	if nfcm.cycleNum++; nfcm.cycleNum >= nfcm.fullMetricsFactor {
+		nfcm.cycleNum = 0
+	}
+
+	// The total number of metrics:
+	//		usage metrics#: 3 (count, max, fill pct)
+	//		delta metrics#: number of stats
+	//		interval metric#: 1
+	totalMetricsCount := 3 + procfs.NF_CONNTRACK_NUM_STATS + 1
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (nfcm *NfConntrackMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if nfcm.timeNowFn != nil {
+		timeNowFn = nfcm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if nfcm.metricsQueue != nil {
+		metricsQueue = nfcm.metricsQueue
+	}
+
+	currNfConntrack := nfcm.nfConntrack[nfcm.currIndex]
+	if currNfConntrack == nil {
+		prevNfConntrack := nfcm.nfConntrack[1-nfcm.currIndex]
+		if prevNfConntrack != nil {
+			currNfConntrack = prevNfConntrack.Clone(false)
+		} else {
+			procfsRoot := GlobalProcfsRoot
+			if nfcm.procfsRoot != "" {
+				procfsRoot = nfcm.procfsRoot
+			}
+			currNfConntrack = procfs.NewNfConntrack(procfsRoot)
+		}
+		nfcm.nfConntrack[nfcm.currIndex] = currNfConntrack
+	}
+	err := currNfConntrack.Parse()
+	if err != nil {
+		nfConntrackMetricsLog.Warnf("%v: nf conntrack metrics will be disabled", err)
+		return false
+	}
+	nfcm.nfConntrackTs[nfcm.currIndex] = timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := nfcm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		nfcm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func NfConntrackMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	nfcm, err := NewNfConntrackMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if nfcm.interval <= 0 {
+		nfConntrackMetricsLog.Infof(
+			"interval=%s, metrics disabled", nfcm.interval,
+		)
+		return nil, nil
+	}
+	// The files are available only if the nf_conntrack module is loaded:
+	countPath := procfs.NfConntrackCountPath(GlobalProcfsRoot)
+	if _, err := os.Stat(countPath); errors.Is(err, fs.ErrNotExist) {
+		nfConntrackMetricsLog.Infof(
+			"%s not found, nf_conntrack module not loaded?, metrics disabled", countPath,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(nfcm.id, nfcm.interval, nfcm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(NfConntrackMetricsTaskBuilder)
+}
@@ -0,0 +1,223 @@
+// Tests for nf_conntrack_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+type NfConntrackMetricsTestCase struct {
+	Name                             string
+	Instance                         string
+	Hostname                         string
+	CurrNfConntrack, PrevNfConntrack *procfs.NfConntrack
+	CurrPromTs, PrevPromTs           int64
+	CycleNum                         int
+	FullMetricsFactor                int
+	ZeroDelta                        []bool
+	WantMetricsCount                 int
+	WantMetrics                      []string
+	ReportExtra                      bool
+	WantZeroDelta                    []bool
+}
+
+func testNfConntrackMetrics(tc *NfConntrackMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	nfConntrackMetrics, err := NewNfConntrackMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfConntrackMetrics.instance = tc.Instance
+	nfConntrackMetrics.hostname = tc.Hostname
+	nfConntrackMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	nfConntrackMetrics.updateMetricsCache()
+	nfConntrackMetrics.cycleNum = tc.CycleNum
+	if tc.ZeroDelta != nil {
+		copy(nfConntrackMetrics.zeroDelta, tc.ZeroDelta)
+	}
+	currIndex := nfConntrackMetrics.currIndex
+	nfConntrackMetrics.nfConntrack[currIndex] = tc.CurrNfConntrack
+	nfConntrackMetrics.nfConntrackTs[currIndex] = time.UnixMilli(tc.CurrPromTs)
+	nfConntrackMetrics.nfConntrack[1-currIndex] = tc.PrevNfConntrack
+	nfConntrackMetrics.nfConntrackTs[1-currIndex] = time.UnixMilli(tc.PrevPromTs)
+
+	wantCurrIndex := 1 - currIndex
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := nfConntrackMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+
+	gotCurrIndex := nfConntrackMetrics.currIndex
+	if wantCurrIndex != gotCurrIndex {
+		fmt.Fprintf(
+			errBuf,
+			"\n.currIndex: want: %d, got: %d",
+			wantCurrIndex, gotCurrIndex,
+		)
+	}
+
+	if tc.WantZeroDelta != nil {
+		for index, wantVal := range tc.WantZeroDelta {
+			gotVal := nfConntrackMetrics.zeroDelta[index]
+			if wantVal != gotVal {
+				fmt.Fprintf(
+					errBuf,
+					"\n.zeroDelta[%d]: want: %v, got: %v",
+					index, wantVal, gotVal,
+				)
+			}
+		}
+	}
+
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestNfConntrackMetrics(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	labels := fmt.Sprintf(`{instance="%s",hostname="%s"}`, instance, hostname)
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	for _, tc := range []*NfConntrackMetricsTestCase{
+		{
+			Name: "first_scan",
+			CurrNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   4000,
+				Stats: []uint32{1, 2, 3, 4, 5, 6},
+			},
+			CycleNum: 1,
+			WantMetrics: []string{
+				fmt.Sprintf(`nf_conntrack_count%s 1000 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_max%s 4000 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_fill_pct%s 25.0 %d`, labels, currPromTs),
+			},
+		},
+		{
+			Name: "full_cycle",
+			CurrNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   4000,
+				Stats: []uint32{1, 2, 3, 4, 5, 6},
+			},
+			PrevNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   4000,
+				Stats: []uint32{1, 2, 3, 4, 5, 6},
+			},
+			CycleNum:  0,
+			ZeroDelta: []bool{true, true, true, true, true, true},
+			WantMetrics: []string{
+				fmt.Sprintf(`nf_conntrack_count%s 1000 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_max%s 4000 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_fill_pct%s 25.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_found_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_invalid_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_insert_failed_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_drop_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_early_drop_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_search_restart_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_metrics_delta_sec%s 5.000000 %d`, labels, currPromTs),
+			},
+			WantZeroDelta: []bool{true, true, true, true, true, true},
+		},
+		{
+			Name: "no_change",
+			CurrNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   4000,
+				Stats: []uint32{1, 2, 3, 4, 5, 6},
+			},
+			PrevNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   4000,
+				Stats: []uint32{1, 2, 3, 4, 5, 6},
+			},
+			CycleNum:  1,
+			ZeroDelta: []bool{true, true, true, false, false, false},
+			WantMetrics: []string{
+				fmt.Sprintf(`nf_conntrack_drop_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_early_drop_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_search_restart_delta%s 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_metrics_delta_sec%s 5.000000 %d`, labels, currPromTs),
+			},
+			WantZeroDelta: []bool{true, true, true, true, true, true},
+		},
+		{
+			Name: "change",
+			CurrNfConntrack: &procfs.NfConntrack{
+				Count: 3000,
+				Max:   4000,
+				Stats: []uint32{11, 2, 13, 4, 2, 6},
+			},
+			PrevNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   4000,
+				Stats: []uint32{1, 2, 3, 4, 0xffffffff, 6},
+			},
+			CycleNum:  1,
+			ZeroDelta: []bool{true, true, true, true, true, true},
+			WantMetrics: []string{
+				fmt.Sprintf(`nf_conntrack_count%s 3000 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_fill_pct%s 75.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_found_delta%s 10 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_insert_failed_delta%s 10 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_early_drop_delta%s 3 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_metrics_delta_sec%s 5.000000 %d`, labels, currPromTs),
+			},
+			WantZeroDelta: []bool{false, true, false, true, false, true},
+		},
+		{
+			Name: "max_change",
+			CurrNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   8000,
+				Stats: []uint32{1, 2, 3, 4, 5, 6},
+			},
+			PrevNfConntrack: &procfs.NfConntrack{
+				Count: 1000,
+				Max:   4000,
+				Stats: []uint32{1, 2, 3, 4, 5, 6},
+			},
+			CycleNum:  1,
+			ZeroDelta: []bool{true, true, true, true, true, true},
+			WantMetrics: []string{
+				fmt.Sprintf(`nf_conntrack_max%s 8000 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_fill_pct%s 12.5 %d`, labels, currPromTs),
+				fmt.Sprintf(`nf_conntrack_metrics_delta_sec%s 5.000000 %d`, labels, currPromTs),
+			},
+		},
+	} {
+		tc.Instance, tc.Hostname = instance, hostname
+		tc.CurrPromTs, tc.PrevPromTs = currPromTs, prevPromTs
+		tc.FullMetricsFactor = NF_CONNTRACK_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT
+		tc.WantMetricsCount = len(tc.WantMetrics)
+		tc.ReportExtra = true
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testNfConntrackMetrics(tc, t) },
+		)
+	}
+}
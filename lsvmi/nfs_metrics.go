@@ -0,0 +1,638 @@
+// NFS client and server metrics based on:
+//  /proc/net/rpc/nfs
+//  /proc/net/rpc/nfsd
+//  /proc/PID/mountstats
+// with the NFS mounts discovered via /proc/PID/mountinfo.
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	NFS_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	NFS_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+	NFS_METRICS_CONFIG_MOUNTINFO_PID_DEFAULT       = 0
+
+	// This generator id:
+	NFS_METRICS_ID = "nfs_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME"}:
+	NFS_CLIENT_RPC_CALLS_DELTA_METRIC       = "nfs_client_rpc_calls_delta"
+	NFS_CLIENT_RPC_RETRANS_DELTA_METRIC     = "nfs_client_rpc_retrans_delta"
+	NFS_CLIENT_RPC_AUTHREFRESH_DELTA_METRIC = "nfs_client_rpc_authrefresh_delta"
+
+	NFS_SERVER_RPC_CALLS_DELTA_METRIC    = "nfs_server_rpc_calls_delta"
+	NFS_SERVER_RPC_BADCALLS_DELTA_METRIC = "nfs_server_rpc_badcalls_delta"
+	NFS_SERVER_RPC_BADFMT_DELTA_METRIC   = "nfs_server_rpc_badfmt_delta"
+	NFS_SERVER_RPC_BADAUTH_DELTA_METRIC  = "nfs_server_rpc_badauth_delta"
+	NFS_SERVER_RPC_BADCLNT_DELTA_METRIC  = "nfs_server_rpc_badclnt_delta"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",version="VERSION",proc="PROC"}:
+	NFS_CLIENT_PROC_CALLS_DELTA_METRIC = "nfs_client_proc_calls_delta"
+	NFS_SERVER_PROC_CALLS_DELTA_METRIC = "nfs_server_proc_calls_delta"
+
+	NFS_VERSION_LABEL_NAME = "version"
+	NFS_PROC_LABEL_NAME    = "proc"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",fs="SERVER:/EXPORT",mount_point="MOUNT_POINT",op="OP"}:
+	NFS_MOUNT_OP_CALLS_DELTA_METRIC          = "nfs_mount_op_calls_delta"
+	NFS_MOUNT_OP_RETRANS_DELTA_METRIC        = "nfs_mount_op_retrans_delta"
+	NFS_MOUNT_OP_MAJOR_TIMEOUTS_DELTA_METRIC = "nfs_mount_op_major_timeouts_delta"
+	NFS_MOUNT_OP_AVG_RTT_MS_METRIC           = "nfs_mount_op_avg_rtt_ms"
+	NFS_MOUNT_OP_AVG_EXEC_MS_METRIC          = "nfs_mount_op_avg_exec_ms"
+
+	NFS_MOUNT_FS_LABEL_NAME          = "fs"
+	NFS_MOUNT_MOUNT_POINT_LABEL_NAME = "mount_point"
+	NFS_MOUNT_OP_LABEL_NAME          = "op"
+
+	NFS_MOUNT_OP_AVG_METRIC_PREC = 3
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	NFS_INTERVAL_METRIC = "nfs_metrics_delta_sec"
+)
+
+// Indexes for client/server storage:
+const (
+	NFS_CLIENT = iota
+	NFS_SERVER
+
+	// Must be last:
+	NFS_NUM_SIDES
+)
+
+// The rpc line metrics, indexed by procfs.NET_RPC_NFS{,D}_RPC_..., per side:
+var nfsRpcDeltaMetricNames = [NFS_NUM_SIDES][]string{
+	NFS_CLIENT: {
+		procfs.NET_RPC_NFS_RPC_CALLS:       NFS_CLIENT_RPC_CALLS_DELTA_METRIC,
+		procfs.NET_RPC_NFS_RPC_RETRANS:     NFS_CLIENT_RPC_RETRANS_DELTA_METRIC,
+		procfs.NET_RPC_NFS_RPC_AUTHREFRESH: NFS_CLIENT_RPC_AUTHREFRESH_DELTA_METRIC,
+	},
+	NFS_SERVER: {
+		procfs.NET_RPC_NFSD_RPC_CALLS:    NFS_SERVER_RPC_CALLS_DELTA_METRIC,
+		procfs.NET_RPC_NFSD_RPC_BADCALLS: NFS_SERVER_RPC_BADCALLS_DELTA_METRIC,
+		procfs.NET_RPC_NFSD_RPC_BADFMT:   NFS_SERVER_RPC_BADFMT_DELTA_METRIC,
+		procfs.NET_RPC_NFSD_RPC_BADAUTH:  NFS_SERVER_RPC_BADAUTH_DELTA_METRIC,
+		procfs.NET_RPC_NFSD_RPC_BADCLNT:  NFS_SERVER_RPC_BADCLNT_DELTA_METRIC,
+	},
+}
+
+var nfsProcDeltaMetricNames = [NFS_NUM_SIDES]string{
+	NFS_CLIENT: NFS_CLIENT_PROC_CALLS_DELTA_METRIC,
+	NFS_SERVER: NFS_SERVER_PROC_CALLS_DELTA_METRIC,
+}
+
+// The per mount, per op metrics:
+const (
+	NFS_MOUNT_OP_CALLS_DELTA = iota
+	NFS_MOUNT_OP_RETRANS_DELTA
+	NFS_MOUNT_OP_MAJOR_TIMEOUTS_DELTA
+	NFS_MOUNT_OP_AVG_RTT_MS
+	NFS_MOUNT_OP_AVG_EXEC_MS
+
+	// Must be last:
+	NFS_MOUNT_OP_NUM_METRICS
+)
+
+var nfsMountOpMetricNames = []string{
+	NFS_MOUNT_OP_CALLS_DELTA:          NFS_MOUNT_OP_CALLS_DELTA_METRIC,
+	NFS_MOUNT_OP_RETRANS_DELTA:        NFS_MOUNT_OP_RETRANS_DELTA_METRIC,
+	NFS_MOUNT_OP_MAJOR_TIMEOUTS_DELTA: NFS_MOUNT_OP_MAJOR_TIMEOUTS_DELTA_METRIC,
+	NFS_MOUNT_OP_AVG_RTT_MS:           NFS_MOUNT_OP_AVG_RTT_MS_METRIC,
+	NFS_MOUNT_OP_AVG_EXEC_MS:          NFS_MOUNT_OP_AVG_EXEC_MS_METRIC,
+}
+
+// The fs types of interest, as per mountinfo:
+var nfsMountFsTypes = map[string]bool{
+	"nfs":  true,
+	"nfs4": true,
+}
+
+var nfsMetricsLog = NewCompLogger(NFS_METRICS_ID)
+
+type NfsMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The PID to use for /proc/PID/mountinfo and /proc/PID/mountstats, use 0
+	// for self:
+	MountinfoPid int `yaml:"mountinfo_pid"`
+}
+
+func DefaultNfsMetricsConfig() *NfsMetricsConfig {
+	return &NfsMetricsConfig{
+		Interval:          NFS_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: NFS_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		MountinfoPid:      NFS_METRICS_CONFIG_MOUNTINFO_PID_DEFAULT,
+	}
+}
+
+// Per proc line tag metrics cache, indexed by procedure number; nil for unused
+// procedures:
+type NfsProcMetricsInfo struct {
+	deltaMetrics [][]byte
+	zeroDelta    []bool
+}
+
+// Per mount metrics cache:
+type NfsMountMetricsInfo struct {
+	// The fs (export) for which the cache was built:
+	fs string
+	// Per op metrics, indexed by op and by NFS_MOUNT_OP_...:
+	opMetrics map[string][][]byte
+	opZero    map[string][]bool
+}
+
+type NfsMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// Dual storage for parsed stats used as previous, current, per side:
+	netRpcNfs [NFS_NUM_SIDES][2]*procfs.NetRpcNfs
+	// Whether the stats are valid, since the files are available only if the
+	// corresponding kernel module is loaded:
+	netRpcNfsValid [NFS_NUM_SIDES][2]bool
+	// Dual storage for mountstats, valid only if there are NFS mounts:
+	mountstats      [2]*procfs.Mountstats
+	mountstatsValid [2]bool
+	// Timestamp when the stats were collected:
+	nfsTs [2]time.Time
+	// Index for current stats, toggled after each use:
+	currIndex int
+
+	// Mountinfo, used for discovering the NFS mounts, parsed for full cycles
+	// only:
+	mountinfoPid  int
+	procMountinfo *procfs.Mountinfo
+	// The NFS mounts, mount point -> fs (export):
+	nfsMounts map[string]string
+
+	// Cycle#:
+	cycleNum int
+
+	// Metrics cache:
+	rpcDeltaMetrics [NFS_NUM_SIDES][][]byte
+	rpcZeroDelta    [NFS_NUM_SIDES][]bool
+	// Indexed by proc line tag:
+	procMetricsInfo [NFS_NUM_SIDES]map[string]*NfsProcMetricsInfo
+	// Indexed by mount point:
+	mountMetricsInfo map[string]*NfsMountMetricsInfo
+	// Interval metric:
+	intervalMetric []byte
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+}
+
+func NewNfsMetrics(cfg any) (*NfsMetrics, error) {
+	var (
+		err           error
+		nfsMetricsCfg *NfsMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		nfsMetricsCfg = cfg.NfsMetricsConfig
+	case *NfsMetricsConfig:
+		nfsMetricsCfg = cfg
+	case nil:
+		nfsMetricsCfg = DefaultNfsMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewNfsMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(nfsMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	nfsMetrics := &NfsMetrics{
+		id:                NFS_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: nfsMetricsCfg.FullMetricsFactor,
+		mountinfoPid:      nfsMetricsCfg.MountinfoPid,
+		nfsMounts:         make(map[string]string),
+		mountMetricsInfo:  make(map[string]*NfsMountMetricsInfo),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+	for side := 0; side < NFS_NUM_SIDES; side++ {
+		nfsMetrics.procMetricsInfo[side] = make(map[string]*NfsProcMetricsInfo)
+		nfsMetrics.rpcZeroDelta[side] = make([]bool, len(nfsRpcDeltaMetricNames[side]))
+	}
+
+	nfsMetricsLog.Infof("id=%s", nfsMetrics.id)
+	nfsMetricsLog.Infof("interval=%s", nfsMetrics.interval)
+	nfsMetricsLog.Infof("full_metrics_factor=%d", nfsMetrics.fullMetricsFactor)
+	nfsMetricsLog.Infof("mountinfo_pid=%d", nfsMetrics.mountinfoPid)
+	return nfsMetrics, nil
+}
+
+func (nfsm *NfsMetrics) updateMetricsCache() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if nfsm.instance != "" {
+		instance = nfsm.instance
+	}
+	if nfsm.hostname != "" {
+		hostname = nfsm.hostname
+	}
+
+	buildMetric := func(name string) []byte {
+		return []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+
+	for side := 0; side < NFS_NUM_SIDES; side++ {
+		nfsm.rpcDeltaMetrics[side] = make([][]byte, len(nfsRpcDeltaMetricNames[side]))
+		for index, name := range nfsRpcDeltaMetricNames[side] {
+			nfsm.rpcDeltaMetrics[side][index] = buildMetric(name)
+		}
+	}
+	nfsm.intervalMetric = buildMetric(NFS_INTERVAL_METRIC)
+	nfsm.cycleNum = initialCycleNum.Get(nfsm.fullMetricsFactor)
+}
+
+// Build/extend the proc metrics for a given side and proc line tag:
+func (nfsm *NfsMetrics) updateProcMetricsInfo(side int, netRpcNfs *procfs.NetRpcNfs, tag string, numProcs int) *NfsProcMetricsInfo {
+	procMetricsInfo := nfsm.procMetricsInfo[side][tag]
+	if procMetricsInfo == nil {
+		procMetricsInfo = &NfsProcMetricsInfo{}
+		nfsm.procMetricsInfo[side][tag] = procMetricsInfo
+	}
+	if len(procMetricsInfo.deltaMetrics) >= numProcs {
+		return procMetricsInfo
+	}
+
+	instance, hostname := GlobalInstance, GlobalHostname
+	if nfsm.instance != "" {
+		instance = nfsm.instance
+	}
+	if nfsm.hostname != "" {
+		hostname = nfsm.hostname
+	}
+	version := strings.TrimSuffix(strings.TrimPrefix(tag, procfs.NET_RPC_NFS_PROC_LINE_TAG_PFX), "ops")
+	for procNum := len(procMetricsInfo.deltaMetrics); procNum < numProcs; procNum++ {
+		var metric []byte
+		if proc := netRpcNfs.ProcName(tag, procNum); proc != "" {
+			metric = []byte(fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+				nfsProcDeltaMetricNames[side],
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				NFS_VERSION_LABEL_NAME, version,
+				NFS_PROC_LABEL_NAME, proc,
+			))
+		}
+		procMetricsInfo.deltaMetrics = append(procMetricsInfo.deltaMetrics, metric)
+		procMetricsInfo.zeroDelta = append(procMetricsInfo.zeroDelta, false)
+	}
+	return procMetricsInfo
+}
+
+// Build the per op metrics for a mount:
+func (nfsm *NfsMetrics) updateMountOpMetrics(mountMetricsInfo *NfsMountMetricsInfo, mountPoint, op string) [][]byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if nfsm.instance != "" {
+		instance = nfsm.instance
+	}
+	if nfsm.hostname != "" {
+		hostname = nfsm.hostname
+	}
+	opLabel := strings.ToLower(op)
+	opMetrics := make([][]byte, NFS_MOUNT_OP_NUM_METRICS)
+	for index, name := range nfsMountOpMetricNames {
+		opMetrics[index] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			NFS_MOUNT_FS_LABEL_NAME, mountMetricsInfo.fs,
+			NFS_MOUNT_MOUNT_POINT_LABEL_NAME, mountPoint,
+			NFS_MOUNT_OP_LABEL_NAME, opLabel,
+		))
+	}
+	mountMetricsInfo.opMetrics[op] = opMetrics
+	mountMetricsInfo.opZero[op] = make([]bool, NFS_MOUNT_OP_NUM_METRICS)
+	return opMetrics
+}
+
+func (nfsm *NfsMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	currIndex := nfsm.currIndex
+	currTs, prevTs := nfsm.nfsTs[currIndex], nfsm.nfsTs[1-currIndex]
+	nfsm.currIndex = 1 - currIndex
+
+	if nfsm.intervalMetric == nil {
+		nfsm.updateMetricsCache()
+	}
+
+	actualMetricsCount, totalMetricsCount := 0, 0
+	nfsm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		nfsm.tsSuffixBuf, " %d\n", currTs.UnixMilli(),
+	)
+	promTs := nfsm.tsSuffixBuf.Bytes()
+
+	fullMetrics := nfsm.cycleNum == 0
+	hasDeltas := false
+
+	// Client/server stats:
+	for side := 0; side < NFS_NUM_SIDES; side++ {
+		if !nfsm.netRpcNfsValid[side][currIndex] || !nfsm.netRpcNfsValid[side][1-currIndex] {
+			continue
+		}
+		hasDeltas = true
+		currNetRpcNfs, prevNetRpcNfs := nfsm.netRpcNfs[side][currIndex], nfsm.netRpcNfs[side][1-currIndex]
+
+		currRpc, prevRpc := currNetRpcNfs.Rpc, prevNetRpcNfs.Rpc
+		zeroDelta := nfsm.rpcZeroDelta[side]
+		for index, metric := range nfsm.rpcDeltaMetrics[side] {
+			if index >= len(currRpc) || index >= len(prevRpc) {
+				break
+			}
+			val := currRpc[index] - prevRpc[index]
+			if val != 0 || fullMetrics || !zeroDelta[index] {
+				buf.Write(metric)
+				buf.WriteString(strconv.FormatUint(val, 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			zeroDelta[index] = val == 0
+			totalMetricsCount++
+		}
+
+		for tag, currStats := range currNetRpcNfs.Proc {
+			prevStats := prevNetRpcNfs.Proc[tag]
+			if len(prevStats) != len(currStats) {
+				continue
+			}
+			procMetricsInfo := nfsm.updateProcMetricsInfo(side, currNetRpcNfs, tag, len(currStats))
+			zeroDelta := procMetricsInfo.zeroDelta
+			for procNum, metric := range procMetricsInfo.deltaMetrics[:len(currStats)] {
+				if metric == nil {
+					continue
+				}
+				val := currStats[procNum] - prevStats[procNum]
+				if val != 0 || fullMetrics || !zeroDelta[procNum] {
+					buf.Write(metric)
+					buf.WriteString(strconv.FormatUint(val, 10))
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				zeroDelta[procNum] = val == 0
+				totalMetricsCount++
+			}
+		}
+	}
+
+	// Per mount stats:
+	if nfsm.mountstatsValid[currIndex] && nfsm.mountstatsValid[1-currIndex] {
+		currMountstats, prevMountstats := nfsm.mountstats[currIndex], nfsm.mountstats[1-currIndex]
+		for mountPoint, currMount := range currMountstats.Mounts {
+			mountFs, ok := nfsm.nfsMounts[mountPoint]
+			if !ok {
+				continue
+			}
+			prevMount := prevMountstats.Mounts[mountPoint]
+			if prevMount == nil || prevMount.Device != currMount.Device {
+				continue
+			}
+			hasDeltas = true
+			mountMetricsInfo := nfsm.mountMetricsInfo[mountPoint]
+			if mountMetricsInfo == nil || mountMetricsInfo.fs != mountFs {
+				mountMetricsInfo = &NfsMountMetricsInfo{
+					fs:        mountFs,
+					opMetrics: make(map[string][][]byte),
+					opZero:    make(map[string][]bool),
+				}
+				nfsm.mountMetricsInfo[mountPoint] = mountMetricsInfo
+			}
+			for _, op := range currMount.OpNames {
+				currStats, prevStats := currMount.OpStats[op], prevMount.OpStats[op]
+				if prevStats == nil {
+					continue
+				}
+				opMetrics := mountMetricsInfo.opMetrics[op]
+				if opMetrics == nil {
+					opMetrics = nfsm.updateMountOpMetrics(mountMetricsInfo, mountPoint, op)
+				}
+				opZero := mountMetricsInfo.opZero[op]
+
+				dOps := currStats[procfs.MOUNTSTATS_OP_OPS] - prevStats[procfs.MOUNTSTATS_OP_OPS]
+				dTrans := currStats[procfs.MOUNTSTATS_OP_TRANSMISSIONS] - prevStats[procfs.MOUNTSTATS_OP_TRANSMISSIONS]
+				dRetrans := uint64(0)
+				if dTrans > dOps {
+					dRetrans = dTrans - dOps
+				}
+				dTimeouts := currStats[procfs.MOUNTSTATS_OP_MAJOR_TIMEOUTS] - prevStats[procfs.MOUNTSTATS_OP_MAJOR_TIMEOUTS]
+				avgRtt, avgExec := 0., 0.
+				if dOps > 0 {
+					avgRtt = float64(currStats[procfs.MOUNTSTATS_OP_RTT_MS]-prevStats[procfs.MOUNTSTATS_OP_RTT_MS]) / float64(dOps)
+					avgExec = float64(currStats[procfs.MOUNTSTATS_OP_EXECUTE_MS]-prevStats[procfs.MOUNTSTATS_OP_EXECUTE_MS]) / float64(dOps)
+				}
+
+				for index, metric := range opMetrics {
+					var (
+						val    string
+						isZero bool
+					)
+					switch index {
+					case NFS_MOUNT_OP_CALLS_DELTA:
+						val, isZero = strconv.FormatUint(dOps, 10), dOps == 0
+					case NFS_MOUNT_OP_RETRANS_DELTA:
+						val, isZero = strconv.FormatUint(dRetrans, 10), dRetrans == 0
+					case NFS_MOUNT_OP_MAJOR_TIMEOUTS_DELTA:
+						val, isZero = strconv.FormatUint(dTimeouts, 10), dTimeouts == 0
+					case NFS_MOUNT_OP_AVG_RTT_MS:
+						val, isZero = strconv.FormatFloat(avgRtt, 'f', NFS_MOUNT_OP_AVG_METRIC_PREC, 64), avgRtt == 0
+					case NFS_MOUNT_OP_AVG_EXEC_MS:
+						val, isZero = strconv.FormatFloat(avgExec, 'f', NFS_MOUNT_OP_AVG_METRIC_PREC, 64), avgExec == 0
+					}
+					if !isZero || fullMetrics || !opZero[index] {
+						buf.Write(metric)
+						buf.WriteString(val)
+						buf.Write(promTs)
+						actualMetricsCount++
+					}
+					opZero[index] = isZero
+				}
+				totalMetricsCount += NFS_MOUNT_OP_NUM_METRICS
+			}
+		}
+	}
+
+	// Remove out of scope mounts:
+	for mountPoint := range nfsm.mountMetricsInfo {
+		if _, ok := nfsm.nfsMounts[mountPoint]; !ok {
+			delete(nfsm.mountMetricsInfo, mountPoint)
+		}
+	}
+
+	if hasDeltas {
+		buf.Write(nfsm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(currTs.Sub(prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+		totalMetricsCount++
+	}
+
+	if nfsm.cycleNum++; nfsm.cycleNum >= nfsm.fullMetricsFactor {
+		nfsm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Update the NFS mounts based on mountinfo:
+func (nfsm *NfsMetrics) updateNfsMounts() {
+	for mountPoint := range nfsm.nfsMounts {
+		delete(nfsm.nfsMounts, mountPoint)
+	}
+	for _, parsedLine := range nfsm.procMountinfo.ParsedLines {
+		if !nfsMountFsTypes[string(parsedLine[procfs.MOUNTINFO_FS_TYPE])] {
+			continue
+		}
+		mountPoint := string(parsedLine[procfs.MOUNTINFO_MOUNT_POINT])
+		if _, ok := nfsm.nfsMounts[mountPoint]; !ok {
+			nfsm.nfsMounts[mountPoint] = string(parsedLine[procfs.MOUNTINFO_MOUNT_SOURCE])
+		}
+	}
+}
+
+// Satisfy the TaskActivity interface:
+func (nfsm *NfsMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if nfsm.timeNowFn != nil {
+		timeNowFn = nfsm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if nfsm.metricsQueue != nil {
+		metricsQueue = nfsm.metricsQueue
+	}
+
+	procfsRoot := GlobalProcfsRoot
+	if nfsm.procfsRoot != "" {
+		procfsRoot = nfsm.procfsRoot
+	}
+
+	currIndex := nfsm.currIndex
+
+	// Client/server stats; a missing file is not an error, the corresponding
+	// module may be loaded later:
+	for side := 0; side < NFS_NUM_SIDES; side++ {
+		currNetRpcNfs := nfsm.netRpcNfs[side][currIndex]
+		if currNetRpcNfs == nil {
+			prevNetRpcNfs := nfsm.netRpcNfs[side][1-currIndex]
+			if prevNetRpcNfs != nil {
+				currNetRpcNfs = prevNetRpcNfs.Clone(false)
+			} else {
+				currNetRpcNfs = procfs.NewNetRpcNfs(procfsRoot, side == NFS_SERVER)
+			}
+			nfsm.netRpcNfs[side][currIndex] = currNetRpcNfs
+		}
+		err := currNetRpcNfs.Parse()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			nfsMetricsLog.Warnf("%v: nfs metrics will be disabled", err)
+			return false
+		}
+		nfsm.netRpcNfsValid[side][currIndex] = err == nil
+	}
+
+	// NFS mounts discovery, for full cycles only:
+	firstTime := nfsm.procMountinfo == nil
+	if firstTime {
+		nfsm.procMountinfo = procfs.NewMountinfo(procfsRoot, nfsm.mountinfoPid)
+	}
+	if firstTime || nfsm.cycleNum == 0 {
+		err := nfsm.procMountinfo.Parse()
+		if err != nil {
+			nfsMetricsLog.Warnf("%v: nfs metrics will be disabled", err)
+			return false
+		}
+		if firstTime || nfsm.procMountinfo.Changed {
+			nfsm.updateNfsMounts()
+		}
+	}
+
+	// Mountstats, only if there are NFS mounts; an error affects only the per
+	// mount stats for the current scan, the client/server stats are still
+	// generated:
+	nfsm.mountstatsValid[currIndex] = false
+	if len(nfsm.nfsMounts) > 0 {
+		currMountstats := nfsm.mountstats[currIndex]
+		if currMountstats == nil {
+			currMountstats = procfs.NewMountstats(procfsRoot, nfsm.mountinfoPid)
+			nfsm.mountstats[currIndex] = currMountstats
+		}
+		err := currMountstats.Parse()
+		if err != nil {
+			nfsMetricsLog.Warnf("%v: per mount nfs metrics skipped for this scan", err)
+		}
+		nfsm.mountstatsValid[currIndex] = err == nil
+	}
+
+	nfsm.nfsTs[currIndex] = timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := nfsm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		nfsm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func NfsMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	nfsm, err := NewNfsMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if nfsm.interval <= 0 {
+		nfsMetricsLog.Infof(
+			"interval=%s, metrics disabled", nfsm.interval,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(nfsm.id, nfsm.interval, nfsm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(NfsMetricsTaskBuilder)
+}
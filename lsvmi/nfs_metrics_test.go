@@ -0,0 +1,336 @@
+// Tests for nfs_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+type NfsMetricsTestCase struct {
+	Name                           string
+	CurrNetRpcNfs, PrevNetRpcNfs   *procfs.NetRpcNfs
+	CurrNetRpcNfsd, PrevNetRpcNfsd *procfs.NetRpcNfs
+	CurrMountstats, PrevMountstats *procfs.Mountstats
+	NfsMounts                      map[string]string
+	CurrPromTs, PrevPromTs         int64
+	CycleNum                       int
+	FullMetricsFactor              int
+	WantMetricsCount               int
+	WantMetrics                    []string
+	ReportExtra                    bool
+}
+
+func testNfsMetrics(tc *NfsMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	nfsMetrics, err := NewNfsMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfsMetrics.instance = "lsvmi-test"
+	nfsMetrics.hostname = "lsvmi-test-host"
+	nfsMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	nfsMetrics.updateMetricsCache()
+	nfsMetrics.cycleNum = tc.CycleNum
+
+	currIndex := nfsMetrics.currIndex
+	for _, stats := range []struct {
+		side       int
+		curr, prev *procfs.NetRpcNfs
+	}{
+		{NFS_CLIENT, tc.CurrNetRpcNfs, tc.PrevNetRpcNfs},
+		{NFS_SERVER, tc.CurrNetRpcNfsd, tc.PrevNetRpcNfsd},
+	} {
+		nfsMetrics.netRpcNfs[stats.side][currIndex] = stats.curr
+		nfsMetrics.netRpcNfsValid[stats.side][currIndex] = stats.curr != nil
+		nfsMetrics.netRpcNfs[stats.side][1-currIndex] = stats.prev
+		nfsMetrics.netRpcNfsValid[stats.side][1-currIndex] = stats.prev != nil
+	}
+	nfsMetrics.mountstats[currIndex] = tc.CurrMountstats
+	nfsMetrics.mountstatsValid[currIndex] = tc.CurrMountstats != nil
+	nfsMetrics.mountstats[1-currIndex] = tc.PrevMountstats
+	nfsMetrics.mountstatsValid[1-currIndex] = tc.PrevMountstats != nil
+	if tc.NfsMounts != nil {
+		nfsMetrics.nfsMounts = tc.NfsMounts
+	}
+	nfsMetrics.nfsTs[currIndex] = time.UnixMilli(tc.CurrPromTs)
+	nfsMetrics.nfsTs[1-currIndex] = time.UnixMilli(tc.PrevPromTs)
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := nfsMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestNfsMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	mountLabels := func(op string) string {
+		return fmt.Sprintf(`%s,fs="server:/export",mount_point="/mnt/nfs",op="%s"`, labels, op)
+	}
+
+	for _, tc := range []*NfsMetricsTestCase{
+		{
+			Name: "first_scan",
+			CurrNetRpcNfs: &procfs.NetRpcNfs{
+				Rpc:  []uint64{100, 1, 0},
+				Proc: map[string][]uint64{"proc3": {0, 10}},
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			FullMetricsFactor: 12,
+			CycleNum:          0,
+		},
+		{
+			Name: "client_full_cycle",
+			CurrNetRpcNfs: &procfs.NetRpcNfs{
+				Rpc:  []uint64{110, 1, 0},
+				Proc: map[string][]uint64{"proc3": {0, 15}},
+			},
+			PrevNetRpcNfs: &procfs.NetRpcNfs{
+				Rpc:  []uint64{100, 1, 0},
+				Proc: map[string][]uint64{"proc3": {0, 10}},
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			FullMetricsFactor: 12,
+			CycleNum:          0,
+			WantMetricsCount:  6,
+			WantMetrics: []string{
+				fmt.Sprintf(`nfs_client_rpc_calls_delta{%s} 10 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_client_rpc_retrans_delta{%s} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_client_rpc_authrefresh_delta{%s} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_client_proc_calls_delta{%s,version="3",proc="null"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_client_proc_calls_delta{%s,version="3",proc="getattr"} 5 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+		},
+		{
+			Name: "server",
+			CurrNetRpcNfsd: &procfs.NetRpcNfs{
+				Server: true,
+				Rpc:    []uint64{200, 1, 0, 1, 0},
+				Proc: map[string][]uint64{
+					"proc4":    {1, 20},
+					"proc4ops": {0, 0, 0, 7, 3},
+				},
+			},
+			PrevNetRpcNfsd: &procfs.NetRpcNfs{
+				Server: true,
+				Rpc:    []uint64{180, 0, 0, 1, 0},
+				Proc: map[string][]uint64{
+					"proc4":    {1, 18},
+					"proc4ops": {0, 0, 0, 5, 3},
+				},
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			FullMetricsFactor: 12,
+			CycleNum:          1,
+			WantMetricsCount:  10,
+			WantMetrics: []string{
+				fmt.Sprintf(`nfs_server_rpc_calls_delta{%s} 20 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_rpc_badcalls_delta{%s} 1 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_rpc_badfmt_delta{%s} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_rpc_badauth_delta{%s} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_rpc_badclnt_delta{%s} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_proc_calls_delta{%s,version="4",proc="null"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_proc_calls_delta{%s,version="4",proc="compound"} 2 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_proc_calls_delta{%s,version="4",proc="access"} 2 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_server_proc_calls_delta{%s,version="4",proc="close"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`nfs_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+		},
+		{
+			Name: "mount",
+			CurrMountstats: &procfs.Mountstats{
+				Mounts: map[string]*procfs.MountstatsMount{
+					"/mnt/nfs": {
+						Device:     "server:/export",
+						MountPoint: "/mnt/nfs",
+						FsType:     "nfs4",
+						OpNames:    []string{"READ", "WRITE"},
+						OpStats: map[string][]uint64{
+							"READ":  {110, 113, 1, 0, 0, 0, 1200, 1300, 0},
+							"WRITE": {5, 5, 0, 0, 0, 0, 50, 60, 0},
+						},
+					},
+					// Not in mountinfo, ignored:
+					"/mnt/other": {
+						Device:     "other:/export",
+						MountPoint: "/mnt/other",
+						FsType:     "nfs4",
+						OpNames:    []string{"READ"},
+						OpStats: map[string][]uint64{
+							"READ": {10, 10, 0, 0, 0, 0, 10, 10, 0},
+						},
+					},
+				},
+			},
+			PrevMountstats: &procfs.Mountstats{
+				Mounts: map[string]*procfs.MountstatsMount{
+					"/mnt/nfs": {
+						Device:     "server:/export",
+						MountPoint: "/mnt/nfs",
+						FsType:     "nfs4",
+						OpNames:    []string{"READ", "WRITE"},
+						OpStats: map[string][]uint64{
+							"READ":  {100, 100, 0, 0, 0, 0, 1000, 1050, 0},
+							"WRITE": {5, 5, 0, 0, 0, 0, 50, 60, 0},
+						},
+					},
+					"/mnt/other": {
+						Device:     "other:/export",
+						MountPoint: "/mnt/other",
+						FsType:     "nfs4",
+						OpNames:    []string{"READ"},
+						OpStats: map[string][]uint64{
+							"READ": {0, 0, 0, 0, 0, 0, 0, 0, 0},
+						},
+					},
+				},
+			},
+			NfsMounts: map[string]string{
+				"/mnt/nfs": "server:/export",
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			FullMetricsFactor: 12,
+			CycleNum:          1,
+			WantMetricsCount:  11,
+			WantMetrics: []string{
+				fmt.Sprintf(`nfs_mount_op_calls_delta{%s} 10 %d`, mountLabels("read"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_retrans_delta{%s} 3 %d`, mountLabels("read"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_major_timeouts_delta{%s} 1 %d`, mountLabels("read"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_avg_rtt_ms{%s} 20.000 %d`, mountLabels("read"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_avg_exec_ms{%s} 25.000 %d`, mountLabels("read"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_calls_delta{%s} 0 %d`, mountLabels("write"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_retrans_delta{%s} 0 %d`, mountLabels("write"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_major_timeouts_delta{%s} 0 %d`, mountLabels("write"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_avg_rtt_ms{%s} 0.000 %d`, mountLabels("write"), currPromTs),
+				fmt.Sprintf(`nfs_mount_op_avg_exec_ms{%s} 0.000 %d`, mountLabels("write"), currPromTs),
+				fmt.Sprintf(`nfs_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testNfsMetrics(tc, t) },
+		)
+	}
+}
+
+// A metrics queue which also retains the queued content, for metrics with
+// unpredictable values:
+type nfsMetricsTestContentQueue struct {
+	*testutils.TestMetricsQueue
+	content bytes.Buffer
+}
+
+func (mq *nfsMetricsTestContentQueue) QueueBuf(buf *bytes.Buffer) {
+	mq.content.Write(buf.Bytes())
+	mq.TestMetricsQueue.QueueBuf(buf)
+}
+
+func TestNfsMetricsMountstatsError(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	savedGlobalMetricsGeneratorStatsContainer := GlobalMetricsGeneratorStatsContainer
+	defer func() { GlobalMetricsGeneratorStatsContainer = savedGlobalMetricsGeneratorStatsContainer }()
+	GlobalMetricsGeneratorStatsContainer = NewMetricsGeneratorStatsContainer()
+
+	procfsRoot := t.TempDir()
+	writeFile := func(content []byte, pathComp ...string) {
+		filePath := path.Join(append([]string{procfsRoot}, pathComp...)...)
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	netRpcNfs, err := os.ReadFile(path.Join(
+		"..", testutils.ProcfsTestDataSubdir, "net_rpc_nfs", "field_mapping", "net", "rpc", "nfs",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(netRpcNfs, "net", "rpc", "nfs")
+	writeFile(
+		[]byte("36 35 0:50 / /mnt/nfs rw,relatime shared:1 - nfs4 server:/export rw,vers=4.2\n"),
+		"self", "mountinfo",
+	)
+	mountstats, err := os.ReadFile(path.Join(
+		"..", testutils.ProcfsTestDataSubdir, "mountstats", "field_mapping", "self", "mountstats",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nfsMetrics, err := NewNfsMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfsMetrics.instance = "lsvmi-test"
+	nfsMetrics.hostname = "lsvmi-test-host"
+	nfsMetrics.procfsRoot = procfsRoot
+	nfsMetrics.fullMetricsFactor = 1
+
+	for scan, step := range []struct {
+		mountstats                 []byte
+		wantClient, wantMountStats bool
+	}{
+		{mountstats, false, false},
+		{mountstats, true, true},
+		// Invalid per-op stats:
+		{bytes.Replace(mountstats, []byte("READ: 256 "), []byte("READ: 2x6 "), 1), true, false},
+		// The deltas require 2 consecutive valid scans:
+		{mountstats, true, false},
+		{mountstats, true, true},
+	} {
+		writeFile(step.mountstats, "self", "mountstats")
+		testMetricsQueue := &nfsMetricsTestContentQueue{
+			TestMetricsQueue: testutils.NewTestMetricsQueue(0),
+		}
+		nfsMetrics.metricsQueue = testMetricsQueue
+		if !nfsMetrics.Execute() {
+			t.Fatalf("scan# %d: Execute: want: true, got: false", scan)
+		}
+		for _, want := range []struct {
+			metric string
+			want   bool
+		}{
+			{NFS_CLIENT_RPC_CALLS_DELTA_METRIC, step.wantClient},
+			{NFS_MOUNT_OP_CALLS_DELTA_METRIC, step.wantMountStats},
+		} {
+			if got := bytes.Contains(testMetricsQueue.content.Bytes(), []byte(want.metric+"{")); got != want.want {
+				t.Fatalf("scan# %d: %s: want: %v, got: %v", scan, want.metric, want.want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,582 @@
+// NUMA node metrics based on:
+//  /sys/devices/system/node/online
+//  /sys/devices/system/node/node*/{meminfo,numastat,cpulist}
+// and, optionally, on the /proc/PID/status Mems_allowed_list as collected by
+// proc_pid_metrics.
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
+)
+
+const (
+	NUMA_METRICS_CONFIG_INTERVAL_DEFAULT                = "5s"
+	NUMA_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT     = 12
+	NUMA_METRICS_CONFIG_PID_MEMS_ALLOWED_COUNTS_DEFAULT = false
+
+	// This generator id:
+	NUMA_METRICS_ID = "numa_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",node="NODE",cpulist="CPULIST"}:
+	NUMA_NODE_INFO_METRIC             = "numa_node_info"
+	NUMA_NODE_INFO_CPULIST_LABEL_NAME = "cpulist"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",node="NODE",field="FIELD",unit="UNIT"}:
+	NUMA_NODE_MEMINFO_METRIC           = "numa_node_meminfo"
+	NUMA_NODE_MEMINFO_FIELD_LABEL_NAME = "field"
+	NUMA_NODE_MEMINFO_UNIT_LABEL_NAME  = "unit"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",node="NODE"}:
+	NUMA_NODE_HIT_DELTA_METRIC            = "numa_node_hit_delta"
+	NUMA_NODE_MISS_DELTA_METRIC           = "numa_node_miss_delta"
+	NUMA_NODE_FOREIGN_DELTA_METRIC        = "numa_node_foreign_delta"
+	NUMA_NODE_INTERLEAVE_HIT_DELTA_METRIC = "numa_node_interleave_hit_delta"
+	NUMA_NODE_LOCAL_DELTA_METRIC          = "numa_node_local_delta"
+	NUMA_NODE_OTHER_DELTA_METRIC          = "numa_node_other_delta"
+
+	// The number of processes allowed to allocate memory on the node, as per
+	// /proc/PID/status Mems_allowed_list:
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",node="NODE"}:
+	NUMA_NODE_PID_COUNT_METRIC = "numa_node_pid_count"
+
+	NUMA_NODE_LABEL_NAME = "node"
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	NUMA_INTERVAL_METRIC = "numa_metrics_delta_sec"
+)
+
+// Map numastat index into metric name:
+var numaNodeNumastatDeltaMetricNames = [sysfs.NUMA_NODE_NUMASTAT_NUM_STATS]string{
+	sysfs.NUMA_NODE_NUMASTAT_NUMA_HIT:       NUMA_NODE_HIT_DELTA_METRIC,
+	sysfs.NUMA_NODE_NUMASTAT_NUMA_MISS:      NUMA_NODE_MISS_DELTA_METRIC,
+	sysfs.NUMA_NODE_NUMASTAT_NUMA_FOREIGN:   NUMA_NODE_FOREIGN_DELTA_METRIC,
+	sysfs.NUMA_NODE_NUMASTAT_INTERLEAVE_HIT: NUMA_NODE_INTERLEAVE_HIT_DELTA_METRIC,
+	sysfs.NUMA_NODE_NUMASTAT_LOCAL_NODE:     NUMA_NODE_LOCAL_DELTA_METRIC,
+	sysfs.NUMA_NODE_NUMASTAT_OTHER_NODE:     NUMA_NODE_OTHER_DELTA_METRIC,
+}
+
+var numaMetricsLog = NewCompLogger(NUMA_METRICS_ID)
+
+type NumaMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The list of node meminfo fields to use, e.g. MemTotal, MemFree. An
+	// empty/nil list will cause all fields to be used.
+	MeminfoFields []string `yaml:"meminfo_fields"`
+	// Whether to aggregate the per process Mems_allowed_list, as collected by
+	// proc_pid_metrics, into per node process counts. This requires
+	// proc_pid_metrics to be enabled, with use_pid_status: true.
+	PidMemsAllowedCounts bool `yaml:"pid_mems_allowed_counts"`
+}
+
+func DefaultNumaMetricsConfig() *NumaMetricsConfig {
+	return &NumaMetricsConfig{
+		Interval:             NUMA_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor:    NUMA_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		PidMemsAllowedCounts: NUMA_METRICS_CONFIG_PID_MEMS_ALLOWED_COUNTS_DEFAULT,
+	}
+}
+
+// The proc_pid_metrics partitions report the number of processes for each
+// Mems_allowed_list value, at the end of each scan, into a container shared
+// with this generator:
+type PidMemsAllowedCounts map[string]int
+
+type PidMemsAllowedContainer struct {
+	// Counts indexed by partition#:
+	counts map[int]PidMemsAllowedCounts
+	// Lock:
+	mu *sync.Mutex
+}
+
+func NewPidMemsAllowedContainer() *PidMemsAllowedContainer {
+	return &PidMemsAllowedContainer{
+		counts: make(map[int]PidMemsAllowedCounts),
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Replace the counts for a given partition:
+func (pmac *PidMemsAllowedContainer) Update(partNo int, counts PidMemsAllowedCounts) {
+	pmac.mu.Lock()
+	defer pmac.mu.Unlock()
+
+	partCounts := pmac.counts[partNo]
+	if partCounts == nil {
+		partCounts = make(PidMemsAllowedCounts)
+		pmac.counts[partNo] = partCounts
+	} else {
+		clear(partCounts)
+	}
+	for memsAllowed, count := range counts {
+		partCounts[memsAllowed] = count
+	}
+}
+
+// Return the counts aggregated across all partitions, reusing the storage
+// provided as an argument:
+func (pmac *PidMemsAllowedContainer) SnapCounts(to PidMemsAllowedCounts) PidMemsAllowedCounts {
+	pmac.mu.Lock()
+	defer pmac.mu.Unlock()
+
+	if to == nil {
+		to = make(PidMemsAllowedCounts)
+	} else {
+		clear(to)
+	}
+	for _, partCounts := range pmac.counts {
+		for memsAllowed, count := range partCounts {
+			to[memsAllowed] += count
+		}
+	}
+	return to
+}
+
+// Group together info indexed by node# to minimize the number of lookups:
+type NumaMetricsNodeInfo struct {
+	// Pseudo-categorical info metric:
+	infoMetric []byte
+	// Meminfo metrics, indexed like the parser's MeminfoNames; nil for excluded
+	// fields. The names are kept for detecting changes:
+	meminfoMetrics [][]byte
+	meminfoNames   []string
+	// The previous meminfo values, used for change detection:
+	prevMeminfo      []uint64
+	prevMeminfoValid bool
+	// Numastat delta metrics, indexed by sysfs.NUMA_NODE_NUMASTAT_...:
+	numastatMetrics [][]byte
+	// The previous numastat values, used for deltas:
+	prevNumastat      []uint64
+	prevNumastatValid bool
+	// Delta metrics are generated with skip-zero-after-zero rule, i.e. if the
+	// current and previous deltas are both zero, then the current metric is
+	// skipped, save for full cycles:
+	zeroDelta []bool
+	// PID count metric, and the previous value for change detection:
+	pidCountMetric    []byte
+	prevPidCount      int
+	prevPidCountValid bool
+	// Current cycle#:
+	cycleNum int
+}
+
+type NumaMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The meminfo fields to use, nil for all:
+	meminfoFields map[string]bool
+
+	// The parser:
+	numaNodes *sysfs.NumaNodes
+
+	// Timestamp of the current and previous scan:
+	currTs, prevTs time.Time
+
+	// Per node# info:
+	nodeInfo map[int]*NumaMetricsNodeInfo
+
+	// Storage for the aggregated mems allowed counts and for the per node
+	// PID counts, reused from one scan to the next:
+	pidMemsAllowedCounts PidMemsAllowedCounts
+	nodePidCounts        map[int]int
+	nodeList             []int
+
+	// Interval metric:
+	intervalMetric []byte
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname      string
+	timeNowFn               func() time.Time
+	metricsQueue            MetricsQueue
+	sysfsRoot               string
+	pidMemsAllowedContainer *PidMemsAllowedContainer
+}
+
+func NewNumaMetrics(cfg any) (*NumaMetrics, error) {
+	var (
+		err            error
+		numaMetricsCfg *NumaMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		numaMetricsCfg = cfg.NumaMetricsConfig
+	case *NumaMetricsConfig:
+		numaMetricsCfg = cfg
+	case nil:
+		numaMetricsCfg = DefaultNumaMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewNumaMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(numaMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	numaMetrics := &NumaMetrics{
+		id:                NUMA_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: numaMetricsCfg.FullMetricsFactor,
+		nodeInfo:          make(map[int]*NumaMetricsNodeInfo),
+		nodePidCounts:     make(map[int]int),
+		nodeList:          make([]int, 0),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+	if len(numaMetricsCfg.MeminfoFields) > 0 {
+		numaMetrics.meminfoFields = make(map[string]bool)
+		for _, field := range numaMetricsCfg.MeminfoFields {
+			numaMetrics.meminfoFields[field] = true
+		}
+	}
+
+	numaMetricsLog.Infof("id=%s", numaMetrics.id)
+	numaMetricsLog.Infof("interval=%s", numaMetrics.interval)
+	numaMetricsLog.Infof("full_metrics_factor=%d", numaMetrics.fullMetricsFactor)
+	numaMetricsLog.Infof("meminfo_fields=%q", numaMetricsCfg.MeminfoFields)
+	numaMetricsLog.Infof("pid_mems_allowed_counts=%v", numaMetricsCfg.PidMemsAllowedCounts)
+	return numaMetrics, nil
+}
+
+func (nm *NumaMetrics) updateNodeInfo(node *sysfs.NumaNode) *NumaMetricsNodeInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if nm.instance != "" {
+		instance = nm.instance
+	}
+	if nm.hostname != "" {
+		hostname = nm.hostname
+	}
+	nodeLabelVal := strconv.Itoa(node.Node)
+
+	nodeInfo := &NumaMetricsNodeInfo{
+		infoMetric: []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			NUMA_NODE_INFO_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			NUMA_NODE_LABEL_NAME, nodeLabelVal,
+			NUMA_NODE_INFO_CPULIST_LABEL_NAME, node.CpuList,
+		)),
+		numastatMetrics: make([][]byte, sysfs.NUMA_NODE_NUMASTAT_NUM_STATS),
+		prevNumastat:    make([]uint64, sysfs.NUMA_NODE_NUMASTAT_NUM_STATS),
+		zeroDelta:       make([]bool, sysfs.NUMA_NODE_NUMASTAT_NUM_STATS),
+		pidCountMetric: []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			NUMA_NODE_PID_COUNT_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			NUMA_NODE_LABEL_NAME, nodeLabelVal,
+		)),
+		cycleNum: initialCycleNum.Get(nm.fullMetricsFactor),
+	}
+	for index, name := range numaNodeNumastatDeltaMetricNames {
+		nodeInfo.numastatMetrics[index] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			NUMA_NODE_LABEL_NAME, nodeLabelVal,
+		))
+	}
+	nm.nodeInfo[node.Node] = nodeInfo
+
+	if nm.intervalMetric == nil {
+		nm.intervalMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. include space before val
+			NUMA_INTERVAL_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+
+	return nodeInfo
+}
+
+// Rebuild the meminfo metrics cache whenever the list of fields changes, which
+// normally happens only once, at the 1st scan:
+func (nm *NumaMetrics) updateMeminfoMetrics(node *sysfs.NumaNode, nodeInfo *NumaMetricsNodeInfo) {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if nm.instance != "" {
+		instance = nm.instance
+	}
+	if nm.hostname != "" {
+		hostname = nm.hostname
+	}
+	nodeLabelVal := strconv.Itoa(node.Node)
+
+	numFields := len(node.MeminfoNames)
+	nodeInfo.meminfoMetrics = make([][]byte, numFields)
+	nodeInfo.meminfoNames = make([]string, numFields)
+	nodeInfo.prevMeminfo = make([]uint64, numFields)
+	nodeInfo.prevMeminfoValid = false
+	for i, name := range node.MeminfoNames {
+		nodeInfo.meminfoNames[i] = name
+		if nm.meminfoFields != nil && !nm.meminfoFields[name] {
+			continue
+		}
+		nodeInfo.meminfoMetrics[i] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			NUMA_NODE_MEMINFO_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			NUMA_NODE_LABEL_NAME, nodeLabelVal,
+			NUMA_NODE_MEMINFO_FIELD_LABEL_NAME, name,
+			NUMA_NODE_MEMINFO_UNIT_LABEL_NAME, node.MeminfoUnits[i],
+		))
+	}
+}
+
+// Aggregate the per process mems allowed list into per node counts; return
+// false if the counts are not available:
+func (nm *NumaMetrics) updateNodePidCounts() bool {
+	pidMemsAllowedContainer := GlobalPidMemsAllowedContainer
+	if nm.pidMemsAllowedContainer != nil {
+		pidMemsAllowedContainer = nm.pidMemsAllowedContainer
+	}
+	if pidMemsAllowedContainer == nil {
+		return false
+	}
+
+	nm.pidMemsAllowedCounts = pidMemsAllowedContainer.SnapCounts(nm.pidMemsAllowedCounts)
+	clear(nm.nodePidCounts)
+	for memsAllowed, count := range nm.pidMemsAllowedCounts {
+		nodeList, err := sysfs.ParseCpuList(memsAllowed, nm.nodeList[:0])
+		if err != nil {
+			numaMetricsLog.Warnf("mems_allowed: %v", err)
+			continue
+		}
+		for _, node := range nodeList {
+			nm.nodePidCounts[node] += count
+		}
+		nm.nodeList = nodeList
+	}
+	return true
+}
+
+func (nm *NumaMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	numaNodes := nm.numaNodes
+	actualMetricsCount, totalMetricsCount := 0, 0
+
+	nm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		nm.tsSuffixBuf, " %d\n", nm.currTs.UnixMilli(),
+	)
+	promTs := nm.tsSuffixBuf.Bytes()
+
+	// The deltas can be evaluated only if there is a previous scan:
+	hasPrevScan := !nm.prevTs.IsZero()
+
+	hasPidCounts := nm.updateNodePidCounts()
+
+	for _, nodeNum := range numaNodes.Online {
+		node := numaNodes.Nodes[nodeNum]
+		if node == nil {
+			continue
+		}
+		nodeInfo := nm.nodeInfo[nodeNum]
+		fullMetrics := nodeInfo == nil || nodeInfo.cycleNum == 0
+		if nodeInfo == nil {
+			nodeInfo = nm.updateNodeInfo(node)
+		}
+
+		// Info:
+		if fullMetrics {
+			buf.Write(nodeInfo.infoMetric)
+			buf.WriteByte('1')
+			buf.Write(promTs)
+			actualMetricsCount++
+		}
+		totalMetricsCount++
+
+		// Meminfo:
+		if node.MeminfoValid {
+			changed := len(node.MeminfoNames) != len(nodeInfo.meminfoNames)
+			for i := 0; !changed && i < len(node.MeminfoNames); i++ {
+				changed = node.MeminfoNames[i] != nodeInfo.meminfoNames[i]
+			}
+			if changed {
+				nm.updateMeminfoMetrics(node, nodeInfo)
+			}
+			prevMeminfo, prevMeminfoValid := nodeInfo.prevMeminfo, nodeInfo.prevMeminfoValid
+			for i, val := range node.Meminfo {
+				metric := nodeInfo.meminfoMetrics[i]
+				if metric == nil {
+					continue
+				}
+				if fullMetrics || !prevMeminfoValid || val != prevMeminfo[i] {
+					buf.Write(metric)
+					buf.WriteString(strconv.FormatUint(val, 10))
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				prevMeminfo[i] = val
+				totalMetricsCount++
+			}
+		}
+		nodeInfo.prevMeminfoValid = node.MeminfoValid
+
+		// Numastat deltas:
+		if node.NumastatValid {
+			prevNumastat, zeroDelta := nodeInfo.prevNumastat, nodeInfo.zeroDelta
+			if hasPrevScan && nodeInfo.prevNumastatValid {
+				for index, val := range node.Numastat {
+					delta := val - prevNumastat[index]
+					if fullMetrics || delta != 0 || !zeroDelta[index] {
+						buf.Write(nodeInfo.numastatMetrics[index])
+						buf.WriteString(strconv.FormatUint(delta, 10))
+						buf.Write(promTs)
+						actualMetricsCount++
+					}
+					zeroDelta[index] = delta == 0
+				}
+			}
+			copy(prevNumastat, node.Numastat)
+			totalMetricsCount += len(node.Numastat)
+		}
+		nodeInfo.prevNumastatValid = node.NumastatValid
+
+		// PID counts:
+		if hasPidCounts {
+			pidCount := nm.nodePidCounts[nodeNum]
+			if fullMetrics || !nodeInfo.prevPidCountValid || pidCount != nodeInfo.prevPidCount {
+				buf.Write(nodeInfo.pidCountMetric)
+				buf.WriteString(strconv.Itoa(pidCount))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			nodeInfo.prevPidCount = pidCount
+			totalMetricsCount++
+		}
+		nodeInfo.prevPidCountValid = hasPidCounts
+
+		if nodeInfo.cycleNum++; nodeInfo.cycleNum >= nm.fullMetricsFactor {
+			nodeInfo.cycleNum = 0
+		}
+	}
+
+	// Nodes may be taken offline; clear the info metric for out-of-scope nodes:
+	if len(nm.nodeInfo) > len(numaNodes.Nodes) {
+		for nodeNum, nodeInfo := range nm.nodeInfo {
+			if _, ok := numaNodes.Nodes[nodeNum]; !ok {
+				buf.Write(nodeInfo.infoMetric)
+				buf.WriteByte('0')
+				buf.Write(promTs)
+				actualMetricsCount++
+				delete(nm.nodeInfo, nodeNum)
+			}
+		}
+	}
+
+	if hasPrevScan && nm.intervalMetric != nil {
+		buf.Write(nm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(nm.currTs.Sub(nm.prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+	totalMetricsCount++
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (nm *NumaMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if nm.timeNowFn != nil {
+		timeNowFn = nm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if nm.metricsQueue != nil {
+		metricsQueue = nm.metricsQueue
+	}
+
+	firstParse := nm.numaNodes == nil
+	if firstParse {
+		sysfsRoot := GlobalSysfsRoot
+		if nm.sysfsRoot != "" {
+			sysfsRoot = nm.sysfsRoot
+		}
+		nm.numaNodes = sysfs.NewNumaNodes(sysfsRoot)
+	}
+
+	err := nm.numaNodes.Parse()
+	if err != nil {
+		if firstParse && errors.Is(err, fs.ErrNotExist) {
+			numaMetricsLog.Infof("%v: NUMA not available, numa metrics will be disabled", err)
+		} else {
+			numaMetricsLog.Warnf("%v: numa metrics will be disabled", err)
+		}
+		return false
+	}
+	nm.prevTs, nm.currTs = nm.currTs, timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := nm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		nm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func NumaMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	nm, err := NewNumaMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if nm.interval <= 0 {
+		numaMetricsLog.Infof(
+			"interval=%s, metrics disabled", nm.interval,
+		)
+		return nil, nil
+	}
+	if cfg.NumaMetricsConfig.PidMemsAllowedCounts {
+		procPidMetricsCfg := cfg.ProcPidMetricsConfig
+		interval, err := time.ParseDuration(procPidMetricsCfg.Interval)
+		if err != nil || interval <= 0 || !procPidMetricsCfg.UsePidStatus {
+			numaMetricsLog.Warn(
+				"pid_mems_allowed_counts requires proc_pid_metrics enabled, with use_pid_status: true; PID counts disabled",
+			)
+		} else {
+			GlobalPidMemsAllowedContainer = NewPidMemsAllowedContainer()
+		}
+	}
+	tasks := []*Task{
+		NewTask(nm.id, nm.interval, nm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(NumaMetricsTaskBuilder)
+}
@@ -0,0 +1,192 @@
+// Tests for numa_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
+)
+
+type NumaMetricsTestCase struct {
+	Name string
+	// The sequence of node states, metrics are checked after the last one:
+	NodesSeq [][]*sysfs.NumaNode
+	// The mems allowed counts, per partition; nil if not enabled:
+	PidMemsAllowedCounts map[int]PidMemsAllowedCounts
+	MeminfoFields        []string
+	FullMetricsFactor    int
+	WantMetricsCount     int
+	WantMetrics          []string
+	ReportExtra          bool
+}
+
+func testNumaMetrics(tc *NumaMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	numaMetricsCfg := DefaultNumaMetricsConfig()
+	numaMetricsCfg.FullMetricsFactor = tc.FullMetricsFactor
+	numaMetricsCfg.MeminfoFields = tc.MeminfoFields
+	numaMetrics, err := NewNumaMetrics(numaMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numaMetrics.instance = "lsvmi-test"
+	numaMetrics.hostname = "lsvmi-test-host"
+	if tc.PidMemsAllowedCounts != nil {
+		numaMetrics.pidMemsAllowedContainer = NewPidMemsAllowedContainer()
+		for partNo, counts := range tc.PidMemsAllowedCounts {
+			numaMetrics.pidMemsAllowedContainer.Update(partNo, counts)
+		}
+	}
+
+	// The parser is used only as a container, populated from the test case:
+	numaMetrics.numaNodes = sysfs.NewNumaNodes("")
+
+	ts := time.UnixMilli(1_700_000_000_000)
+	var testMetricsQueue *testutils.TestMetricsQueue
+	gotMetricsCount := 0
+	for _, nodes := range tc.NodesSeq {
+		numaMetrics.numaNodes.Online = numaMetrics.numaNodes.Online[:0]
+		clear(numaMetrics.numaNodes.Nodes)
+		for _, node := range nodes {
+			numaMetrics.numaNodes.Online = append(numaMetrics.numaNodes.Online, node.Node)
+			numaMetrics.numaNodes.Nodes[node.Node] = node
+		}
+		numaMetrics.prevTs, numaMetrics.currTs = numaMetrics.currTs, ts
+		testMetricsQueue = testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ = numaMetrics.generateMetrics(buf)
+		testMetricsQueue.QueueBuf(buf)
+		ts = ts.Add(5 * time.Second)
+	}
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestNumaMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_005_000)
+
+	node := func(nodeNum int, cpuList string, memFree uint64, numastat ...uint64) *sysfs.NumaNode {
+		return &sysfs.NumaNode{
+			Node:          nodeNum,
+			CpuList:       cpuList,
+			MeminfoNames:  []string{"MemTotal", "MemFree", "HugePages_Total"},
+			Meminfo:       []uint64{1000, memFree, 2},
+			MeminfoUnits:  []string{"kB", "kB", ""},
+			MeminfoValid:  true,
+			Numastat:      numastat,
+			NumastatValid: true,
+		}
+	}
+
+	for _, tc := range []*NumaMetricsTestCase{
+		{
+			Name: "full",
+			NodesSeq: [][]*sysfs.NumaNode{
+				{node(0, "0-3", 500, 100, 10, 1, 5, 90, 10)},
+				{node(0, "0-3", 400, 150, 10, 3, 5, 130, 20)},
+			},
+			PidMemsAllowedCounts: map[int]PidMemsAllowedCounts{
+				0: {"0": 10, "0-1": 5},
+				1: {"0-1": 2, "1": 7},
+			},
+			FullMetricsFactor: 0,
+			WantMetricsCount:  12,
+			WantMetrics: []string{
+				fmt.Sprintf(`numa_node_info{%s,node="0",cpulist="0-3"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_meminfo{%s,node="0",field="MemTotal",unit="kB"} 1000 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_meminfo{%s,node="0",field="MemFree",unit="kB"} 400 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_meminfo{%s,node="0",field="HugePages_Total",unit=""} 2 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_hit_delta{%s,node="0"} 50 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_miss_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_foreign_delta{%s,node="0"} 2 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_interleave_hit_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_local_delta{%s,node="0"} 40 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_other_delta{%s,node="0"} 10 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_pid_count{%s,node="0"} 17 %d`, labels, promTs),
+				fmt.Sprintf(`numa_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "partial",
+			NodesSeq: [][]*sysfs.NumaNode{
+				{node(0, "0-3", 500, 100, 10, 1, 5, 90, 10), node(1, "4-7", 500, 100, 10, 1, 5, 90, 10)},
+				{node(0, "0-3", 500, 100, 10, 1, 5, 90, 10), node(1, "4-7", 500, 100, 10, 1, 5, 90, 10)},
+				{node(0, "0-3", 400, 150, 10, 1, 5, 130, 20), node(1, "4-7", 500, 100, 10, 1, 5, 90, 10)},
+			},
+			PidMemsAllowedCounts: map[int]PidMemsAllowedCounts{
+				0: {"0-1": 5},
+			},
+			MeminfoFields:     []string{"MemFree"},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  5,
+			WantMetrics: []string{
+				fmt.Sprintf(`numa_node_meminfo{%s,node="0",field="MemFree",unit="kB"} 400 %d`, labels, promTs+5000),
+				fmt.Sprintf(`numa_node_hit_delta{%s,node="0"} 50 %d`, labels, promTs+5000),
+				fmt.Sprintf(`numa_node_local_delta{%s,node="0"} 40 %d`, labels, promTs+5000),
+				fmt.Sprintf(`numa_node_other_delta{%s,node="0"} 10 %d`, labels, promTs+5000),
+				fmt.Sprintf(`numa_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+5000),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "node_offline",
+			NodesSeq: [][]*sysfs.NumaNode{
+				{node(0, "0-3", 500, 100, 10, 1, 5, 90, 10), node(1, "4-7", 500, 100, 10, 1, 5, 90, 10)},
+				{node(0, "0-3", 500, 100, 10, 1, 5, 90, 10)},
+			},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  8,
+			WantMetrics: []string{
+				fmt.Sprintf(`numa_node_info{%s,node="1",cpulist="4-7"} 0 %d`, labels, promTs),
+				// 1st deltas, no previous zero:
+				fmt.Sprintf(`numa_node_hit_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_miss_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_foreign_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_interleave_hit_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_local_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_node_other_delta{%s,node="0"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`numa_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testNumaMetrics(tc, t) },
+		)
+	}
+}
+
+func TestPidMemsAllowedContainer(t *testing.T) {
+	pmac := NewPidMemsAllowedContainer()
+	pmac.Update(0, PidMemsAllowedCounts{"0": 1, "0-1": 2})
+	pmac.Update(1, PidMemsAllowedCounts{"0-1": 3})
+	// Replace partition 0:
+	pmac.Update(0, PidMemsAllowedCounts{"1": 4})
+
+	want := PidMemsAllowedCounts{"0-1": 3, "1": 4}
+	got := pmac.SnapCounts(nil)
+	if fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,440 @@
+// Memory fragmentation metrics based on /proc/buddyinfo and, optionally,
+// /proc/zoneinfo watermarks.
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	PROC_BUDDYINFO_METRICS_CONFIG_INTERVAL_DEFAULT            = "30s"
+	PROC_BUDDYINFO_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 10
+	PROC_BUDDYINFO_METRICS_CONFIG_USE_ZONEINFO_DEFAULT        = false
+
+	// This generator id:
+	PROC_BUDDYINFO_METRICS_ID = "proc_buddyinfo_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",node="NODE",zone="ZONE",order="ORDER"}:
+	PROC_BUDDYINFO_FREE_BLOCKS_METRIC      = "proc_buddyinfo_free_blocks"
+	PROC_BUDDYINFO_FREE_GE_ORDER_KB_METRIC = "proc_buddyinfo_free_ge_order_kb"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",node="NODE",zone="ZONE"}:
+	PROC_ZONEINFO_FREE_KB_METRIC    = "proc_zoneinfo_free_kb"
+	PROC_ZONEINFO_MANAGED_KB_METRIC = "proc_zoneinfo_managed_kb"
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",node="NODE",zone="ZONE",watermark="WATERMARK"}:
+	PROC_ZONEINFO_WATERMARK_KB_METRIC = "proc_zoneinfo_watermark_kb"
+
+	PROC_BUDDYINFO_NODE_LABEL_NAME     = "node"
+	PROC_BUDDYINFO_ZONE_LABEL_NAME     = "zone"
+	PROC_BUDDYINFO_ORDER_LABEL_NAME    = "order"
+	PROC_ZONEINFO_WATERMARK_LABEL_NAME = "watermark"
+	PROC_ZONEINFO_WATERMARK_MIN_VALUE  = "min"
+	PROC_ZONEINFO_WATERMARK_LOW_VALUE  = "low"
+	PROC_ZONEINFO_WATERMARK_HIGH_VALUE = "high"
+)
+
+// Map zoneinfo stats index into watermark label value, "" for non-watermark
+// stats:
+var procZoneinfoWatermarkLabelValue = []string{
+	procfs.ZONEINFO_FREE_PAGES:    "",
+	procfs.ZONEINFO_MIN_PAGES:     PROC_ZONEINFO_WATERMARK_MIN_VALUE,
+	procfs.ZONEINFO_LOW_PAGES:     PROC_ZONEINFO_WATERMARK_LOW_VALUE,
+	procfs.ZONEINFO_HIGH_PAGES:    PROC_ZONEINFO_WATERMARK_HIGH_VALUE,
+	procfs.ZONEINFO_MANAGED_PAGES: "",
+}
+
+var procBuddyinfoMetricsLog = NewCompLogger(PROC_BUDDYINFO_METRICS_ID)
+
+type ProcBuddyinfoMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// Whether to generate the /proc/zoneinfo free vs watermarks metrics or
+	// not:
+	UseZoneinfo bool `yaml:"use_zoneinfo"`
+}
+
+func DefaultProcBuddyinfoMetricsConfig() *ProcBuddyinfoMetricsConfig {
+	return &ProcBuddyinfoMetricsConfig{
+		Interval:          PROC_BUDDYINFO_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: PROC_BUDDYINFO_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		UseZoneinfo:       PROC_BUDDYINFO_METRICS_CONFIG_USE_ZONEINFO_DEFAULT,
+	}
+}
+
+// Per node, zone buddyinfo metrics cache:
+type ProcBuddyinfoZoneInfo struct {
+	// The metrics, w/o value, indexed by order:
+	freeBlocksMetrics, freeGeOrderKbMetrics [][]byte
+	// The previous values, for change detection, indexed by order:
+	prevFreeBlocks, prevFreeGeOrderKb []uint64
+	// The scan# when the zone was last found, used for detecting out-of-scope
+	// zones:
+	scanNum uint64
+}
+
+// Per node, zone zoneinfo metrics cache:
+type ProcZoneinfoZoneInfo struct {
+	// The metrics, w/o value, indexed by procfs.ZONEINFO_...:
+	metrics [][]byte
+	// The previous values, for change detection, indexed by
+	// procfs.ZONEINFO_...:
+	prevStats []uint64
+	// The scan# when the zone was last found, used for detecting out-of-scope
+	// zones:
+	scanNum uint64
+}
+
+type ProcBuddyinfoMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// As configured:
+	useZoneinfo bool
+
+	// Parsers:
+	buddyinfo *procfs.Buddyinfo
+	zoneinfo  *procfs.Zoneinfo
+	// Timestamp when the stats were collected:
+	statsTs time.Time
+
+	// Metrics cache, indexed by "NODE/ZONE":
+	buddyinfoZoneInfo map[string]*ProcBuddyinfoZoneInfo
+	zoneinfoZoneInfo  map[string]*ProcZoneinfoZoneInfo
+
+	// Scan#, used for detecting out-of-scope zones:
+	scanNum uint64
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+	pageSize           int
+}
+
+func NewProcBuddyinfoMetrics(cfg any) (*ProcBuddyinfoMetrics, error) {
+	var (
+		err                     error
+		procBuddyinfoMetricsCfg *ProcBuddyinfoMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		procBuddyinfoMetricsCfg = cfg.ProcBuddyinfoMetricsConfig
+	case *ProcBuddyinfoMetricsConfig:
+		procBuddyinfoMetricsCfg = cfg
+	case nil:
+		procBuddyinfoMetricsCfg = DefaultProcBuddyinfoMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewProcBuddyinfoMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(procBuddyinfoMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	procBuddyinfoMetrics := &ProcBuddyinfoMetrics{
+		id:                PROC_BUDDYINFO_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: procBuddyinfoMetricsCfg.FullMetricsFactor,
+		useZoneinfo:       procBuddyinfoMetricsCfg.UseZoneinfo,
+		buddyinfoZoneInfo: make(map[string]*ProcBuddyinfoZoneInfo),
+		zoneinfoZoneInfo:  make(map[string]*ProcZoneinfoZoneInfo),
+		cycleNum:          initialCycleNum.Get(procBuddyinfoMetricsCfg.FullMetricsFactor),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	procBuddyinfoMetricsLog.Infof("id=%s", procBuddyinfoMetrics.id)
+	procBuddyinfoMetricsLog.Infof("interval=%s", procBuddyinfoMetrics.interval)
+	procBuddyinfoMetricsLog.Infof("full_metrics_factor=%d", procBuddyinfoMetrics.fullMetricsFactor)
+	procBuddyinfoMetricsLog.Infof("use_zoneinfo=%v", procBuddyinfoMetrics.useZoneinfo)
+	return procBuddyinfoMetrics, nil
+}
+
+func (pbm *ProcBuddyinfoMetrics) newBuddyinfoZoneInfo(node int, zone string, numOrders int) *ProcBuddyinfoZoneInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pbm.instance != "" {
+		instance = pbm.instance
+	}
+	if pbm.hostname != "" {
+		hostname = pbm.hostname
+	}
+	buildMetric := func(name string, order int) []byte {
+		return []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%d",%s="%s",%s="%d"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			PROC_BUDDYINFO_NODE_LABEL_NAME, node,
+			PROC_BUDDYINFO_ZONE_LABEL_NAME, zone,
+			PROC_BUDDYINFO_ORDER_LABEL_NAME, order,
+		))
+	}
+
+	zoneInfo := &ProcBuddyinfoZoneInfo{
+		freeBlocksMetrics:    make([][]byte, numOrders),
+		freeGeOrderKbMetrics: make([][]byte, numOrders),
+		prevFreeBlocks:       make([]uint64, numOrders),
+		prevFreeGeOrderKb:    make([]uint64, numOrders),
+	}
+	for order := 0; order < numOrders; order++ {
+		zoneInfo.freeBlocksMetrics[order] = buildMetric(PROC_BUDDYINFO_FREE_BLOCKS_METRIC, order)
+		zoneInfo.freeGeOrderKbMetrics[order] = buildMetric(PROC_BUDDYINFO_FREE_GE_ORDER_KB_METRIC, order)
+	}
+	return zoneInfo
+}
+
+func (pbm *ProcBuddyinfoMetrics) newZoneinfoZoneInfo(node int, zone string) *ProcZoneinfoZoneInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pbm.instance != "" {
+		instance = pbm.instance
+	}
+	if pbm.hostname != "" {
+		hostname = pbm.hostname
+	}
+	zoneInfo := &ProcZoneinfoZoneInfo{
+		metrics:   make([][]byte, procfs.ZONEINFO_NUM_STATS),
+		prevStats: make([]uint64, procfs.ZONEINFO_NUM_STATS),
+	}
+	for index, watermark := range procZoneinfoWatermarkLabelValue {
+		var metric string
+		switch index {
+		case procfs.ZONEINFO_FREE_PAGES:
+			metric = fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%d",%s="%s"} `, // N.B. the space before the value is included!
+				PROC_ZONEINFO_FREE_KB_METRIC,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				PROC_BUDDYINFO_NODE_LABEL_NAME, node,
+				PROC_BUDDYINFO_ZONE_LABEL_NAME, zone,
+			)
+		case procfs.ZONEINFO_MANAGED_PAGES:
+			metric = fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%d",%s="%s"} `, // N.B. the space before the value is included!
+				PROC_ZONEINFO_MANAGED_KB_METRIC,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				PROC_BUDDYINFO_NODE_LABEL_NAME, node,
+				PROC_BUDDYINFO_ZONE_LABEL_NAME, zone,
+			)
+		default:
+			metric = fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%d",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+				PROC_ZONEINFO_WATERMARK_KB_METRIC,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				PROC_BUDDYINFO_NODE_LABEL_NAME, node,
+				PROC_BUDDYINFO_ZONE_LABEL_NAME, zone,
+				PROC_ZONEINFO_WATERMARK_LABEL_NAME, watermark,
+			)
+		}
+		zoneInfo.metrics[index] = []byte(metric)
+	}
+	return zoneInfo
+}
+
+func (pbm *ProcBuddyinfoMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	actualMetricsCount, totalMetricsCount := 0, 0
+
+	pbm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		pbm.tsSuffixBuf, " %d\n", pbm.statsTs.UnixMilli(),
+	)
+	promTs := pbm.tsSuffixBuf.Bytes()
+
+	fullMetrics := pbm.cycleNum == 0
+	pbm.scanNum++
+
+	pageSize := pbm.pageSize
+	if pageSize <= 0 {
+		pageSize = os.Getpagesize()
+	}
+	pageSizeKb := uint64(pageSize / 1024)
+
+	for _, zone := range pbm.buddyinfo.Zones {
+		key := fmt.Sprintf("%d/%s", zone.Node, zone.Zone)
+		numOrders := len(zone.FreeBlocks)
+		zoneInfo := pbm.buddyinfoZoneInfo[key]
+		zoneFullMetrics := fullMetrics
+		if zoneInfo == nil || len(zoneInfo.freeBlocksMetrics) != numOrders {
+			zoneInfo = pbm.newBuddyinfoZoneInfo(zone.Node, zone.Zone, numOrders)
+			pbm.buddyinfoZoneInfo[key] = zoneInfo
+			zoneFullMetrics = true
+		}
+		zoneInfo.scanNum = pbm.scanNum
+
+		// Free memory available at order >= N, built from the highest order
+		// down:
+		freeGeOrderKb := uint64(0)
+		for order := numOrders - 1; order >= 0; order-- {
+			freeBlocks := zone.FreeBlocks[order]
+			freeGeOrderKb += freeBlocks * (pageSizeKb << order)
+			if zoneFullMetrics || freeBlocks != zoneInfo.prevFreeBlocks[order] {
+				buf.Write(zoneInfo.freeBlocksMetrics[order])
+				buf.WriteString(strconv.FormatUint(freeBlocks, 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+				zoneInfo.prevFreeBlocks[order] = freeBlocks
+			}
+			if zoneFullMetrics || freeGeOrderKb != zoneInfo.prevFreeGeOrderKb[order] {
+				buf.Write(zoneInfo.freeGeOrderKbMetrics[order])
+				buf.WriteString(strconv.FormatUint(freeGeOrderKb, 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+				zoneInfo.prevFreeGeOrderKb[order] = freeGeOrderKb
+			}
+		}
+		totalMetricsCount += 2 * numOrders
+	}
+
+	// Zones may be hot(un)plugged; remove out-of-scope zones:
+	if len(pbm.buddyinfoZoneInfo) > len(pbm.buddyinfo.Zones) {
+		for key, zoneInfo := range pbm.buddyinfoZoneInfo {
+			if zoneInfo.scanNum != pbm.scanNum {
+				delete(pbm.buddyinfoZoneInfo, key)
+			}
+		}
+	}
+
+	if pbm.useZoneinfo && pbm.zoneinfo != nil {
+		numZones := 0
+		for _, zone := range pbm.zoneinfo.Zones {
+			// Skip unpopulated zones:
+			if zone.Stats[procfs.ZONEINFO_MANAGED_PAGES] == 0 {
+				continue
+			}
+			numZones++
+			key := fmt.Sprintf("%d/%s", zone.Node, zone.Zone)
+			zoneInfo := pbm.zoneinfoZoneInfo[key]
+			zoneFullMetrics := fullMetrics
+			if zoneInfo == nil {
+				zoneInfo = pbm.newZoneinfoZoneInfo(zone.Node, zone.Zone)
+				pbm.zoneinfoZoneInfo[key] = zoneInfo
+				zoneFullMetrics = true
+			}
+			zoneInfo.scanNum = pbm.scanNum
+			for index, metric := range zoneInfo.metrics {
+				val := zone.Stats[index]
+				if zoneFullMetrics || val != zoneInfo.prevStats[index] {
+					buf.Write(metric)
+					buf.WriteString(strconv.FormatUint(val*pageSizeKb, 10))
+					buf.Write(promTs)
+					actualMetricsCount++
+					zoneInfo.prevStats[index] = val
+				}
+			}
+			totalMetricsCount += procfs.ZONEINFO_NUM_STATS
+		}
+
+		if len(pbm.zoneinfoZoneInfo) > numZones {
+			for key, zoneInfo := range pbm.zoneinfoZoneInfo {
+				if zoneInfo.scanNum != pbm.scanNum {
+					delete(pbm.zoneinfoZoneInfo, key)
+				}
+			}
+		}
+	}
+
+	if pbm.cycleNum++; pbm.cycleNum >= pbm.fullMetricsFactor {
+		pbm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (pbm *ProcBuddyinfoMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if pbm.timeNowFn != nil {
+		timeNowFn = pbm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if pbm.metricsQueue != nil {
+		metricsQueue = pbm.metricsQueue
+	}
+
+	procfsRoot := GlobalProcfsRoot
+	if pbm.procfsRoot != "" {
+		procfsRoot = pbm.procfsRoot
+	}
+
+	if pbm.buddyinfo == nil {
+		pbm.buddyinfo = procfs.NewBuddyinfo(procfsRoot)
+	}
+	err := pbm.buddyinfo.Parse()
+	if err != nil {
+		procBuddyinfoMetricsLog.Warnf("%v: proc buddyinfo metrics will be disabled", err)
+		return false
+	}
+
+	if pbm.useZoneinfo {
+		if pbm.zoneinfo == nil {
+			pbm.zoneinfo = procfs.NewZoneinfo(procfsRoot)
+		}
+		err = pbm.zoneinfo.Parse()
+		if err != nil {
+			procBuddyinfoMetricsLog.Warnf("%v: zoneinfo metrics will be disabled", err)
+			pbm.useZoneinfo = false
+		}
+	}
+	pbm.statsTs = timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := pbm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		pbm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func ProcBuddyinfoMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	pbm, err := NewProcBuddyinfoMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if pbm.interval <= 0 {
+		procBuddyinfoMetricsLog.Infof(
+			"interval=%s, metrics disabled", pbm.interval,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(pbm.id, pbm.interval, pbm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(ProcBuddyinfoMetricsTaskBuilder)
+}
@@ -0,0 +1,186 @@
+// Tests for proc_buddyinfo_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+type ProcBuddyinfoMetricsTestCase struct {
+	Name string
+	// The sequence of parsed stats, metrics are checked after the last one;
+	// nil zoneinfo entries are allowed if UseZoneinfo is false:
+	BuddyinfoSeq      []*procfs.Buddyinfo
+	ZoneinfoSeq       []*procfs.Zoneinfo
+	UseZoneinfo       bool
+	FullMetricsFactor int
+	WantMetricsCount  int
+	WantMetrics       []string
+	ReportExtra       bool
+	// The expected cached zones, as NODE/ZONE:
+	WantBuddyinfoZones []string
+}
+
+func testProcBuddyinfoMetrics(tc *ProcBuddyinfoMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	procBuddyinfoMetricsCfg := DefaultProcBuddyinfoMetricsConfig()
+	procBuddyinfoMetricsCfg.UseZoneinfo = tc.UseZoneinfo
+	procBuddyinfoMetrics, err := NewProcBuddyinfoMetrics(procBuddyinfoMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procBuddyinfoMetrics.instance = "lsvmi-test"
+	procBuddyinfoMetrics.hostname = "lsvmi-test-host"
+	procBuddyinfoMetrics.pageSize = 4096
+	procBuddyinfoMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	procBuddyinfoMetrics.cycleNum = 0
+
+	ts := time.UnixMilli(1_700_000_000_000)
+	var testMetricsQueue *testutils.TestMetricsQueue
+	gotMetricsCount := 0
+	for i, buddyinfo := range tc.BuddyinfoSeq {
+		procBuddyinfoMetrics.buddyinfo = buddyinfo
+		if i < len(tc.ZoneinfoSeq) {
+			procBuddyinfoMetrics.zoneinfo = tc.ZoneinfoSeq[i]
+		}
+		procBuddyinfoMetrics.statsTs = ts
+		testMetricsQueue = testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ = procBuddyinfoMetrics.generateMetrics(buf)
+		testMetricsQueue.QueueBuf(buf)
+		ts = ts.Add(30 * time.Second)
+	}
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	if tc.WantBuddyinfoZones != nil {
+		if len(tc.WantBuddyinfoZones) != len(procBuddyinfoMetrics.buddyinfoZoneInfo) {
+			fmt.Fprintf(
+				errBuf,
+				"\nlen(buddyinfoZoneInfo): want: %d, got: %d",
+				len(tc.WantBuddyinfoZones), len(procBuddyinfoMetrics.buddyinfoZoneInfo),
+			)
+		}
+		for _, key := range tc.WantBuddyinfoZones {
+			if procBuddyinfoMetrics.buddyinfoZoneInfo[key] == nil {
+				fmt.Fprintf(errBuf, "\nbuddyinfoZoneInfo[%s]: missing", key)
+			}
+		}
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestProcBuddyinfoMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_000_000)
+
+	buddyinfo := &procfs.Buddyinfo{
+		Zones: []*procfs.BuddyinfoZone{
+			{Node: 0, Zone: "Normal", FreeBlocks: []uint64{100, 10, 1}},
+		},
+	}
+	buddyinfo2 := &procfs.Buddyinfo{
+		Zones: []*procfs.BuddyinfoZone{
+			{Node: 0, Zone: "Normal", FreeBlocks: []uint64{90, 10, 1}},
+			{Node: 1, Zone: "Normal", FreeBlocks: []uint64{1, 1, 1}},
+		},
+	}
+	zoneinfo := &procfs.Zoneinfo{
+		Zones: []*procfs.ZoneinfoZone{
+			{Node: 0, Zone: "Normal", Stats: []uint64{1000, 50, 60, 70, 100000}},
+			// Unpopulated, skipped:
+			{Node: 0, Zone: "Movable", Stats: []uint64{0, 0, 0, 0, 0}},
+		},
+	}
+	zoneinfo2 := &procfs.Zoneinfo{
+		Zones: []*procfs.ZoneinfoZone{
+			{Node: 0, Zone: "Normal", Stats: []uint64{900, 50, 60, 80, 100000}},
+			{Node: 0, Zone: "Movable", Stats: []uint64{0, 0, 0, 0, 0}},
+		},
+	}
+
+	for _, tc := range []*ProcBuddyinfoMetricsTestCase{
+		{
+			Name:              "full",
+			BuddyinfoSeq:      []*procfs.Buddyinfo{buddyinfo},
+			ZoneinfoSeq:       []*procfs.Zoneinfo{zoneinfo},
+			UseZoneinfo:       true,
+			FullMetricsFactor: 0,
+			WantMetricsCount:  11,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_buddyinfo_free_blocks{%s,node="0",zone="Normal",order="0"} 100 %d`, labels, promTs),
+				fmt.Sprintf(`proc_buddyinfo_free_blocks{%s,node="0",zone="Normal",order="1"} 10 %d`, labels, promTs),
+				fmt.Sprintf(`proc_buddyinfo_free_blocks{%s,node="0",zone="Normal",order="2"} 1 %d`, labels, promTs),
+				// 4k pages: 1*16 + 10*8 + 100*4:
+				fmt.Sprintf(`proc_buddyinfo_free_ge_order_kb{%s,node="0",zone="Normal",order="0"} 496 %d`, labels, promTs),
+				fmt.Sprintf(`proc_buddyinfo_free_ge_order_kb{%s,node="0",zone="Normal",order="1"} 96 %d`, labels, promTs),
+				fmt.Sprintf(`proc_buddyinfo_free_ge_order_kb{%s,node="0",zone="Normal",order="2"} 16 %d`, labels, promTs),
+				fmt.Sprintf(`proc_zoneinfo_free_kb{%s,node="0",zone="Normal"} 4000 %d`, labels, promTs),
+				fmt.Sprintf(`proc_zoneinfo_watermark_kb{%s,node="0",zone="Normal",watermark="min"} 200 %d`, labels, promTs),
+				fmt.Sprintf(`proc_zoneinfo_watermark_kb{%s,node="0",zone="Normal",watermark="low"} 240 %d`, labels, promTs),
+				fmt.Sprintf(`proc_zoneinfo_watermark_kb{%s,node="0",zone="Normal",watermark="high"} 280 %d`, labels, promTs),
+				fmt.Sprintf(`proc_zoneinfo_managed_kb{%s,node="0",zone="Normal"} 400000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name:              "no_zoneinfo",
+			BuddyinfoSeq:      []*procfs.Buddyinfo{buddyinfo},
+			ZoneinfoSeq:       []*procfs.Zoneinfo{zoneinfo},
+			FullMetricsFactor: 0,
+			WantMetricsCount:  6,
+		},
+		{
+			Name:              "changes",
+			BuddyinfoSeq:      []*procfs.Buddyinfo{buddyinfo, buddyinfo2},
+			ZoneinfoSeq:       []*procfs.Zoneinfo{zoneinfo, zoneinfo2},
+			UseZoneinfo:       true,
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  10,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_buddyinfo_free_blocks{%s,node="0",zone="Normal",order="0"} 90 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_buddyinfo_free_ge_order_kb{%s,node="0",zone="Normal",order="0"} 456 %d`, labels, promTs+30000),
+				// New zone, all metrics:
+				fmt.Sprintf(`proc_buddyinfo_free_blocks{%s,node="1",zone="Normal",order="0"} 1 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_buddyinfo_free_blocks{%s,node="1",zone="Normal",order="1"} 1 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_buddyinfo_free_blocks{%s,node="1",zone="Normal",order="2"} 1 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_buddyinfo_free_ge_order_kb{%s,node="1",zone="Normal",order="0"} 28 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_buddyinfo_free_ge_order_kb{%s,node="1",zone="Normal",order="1"} 24 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_buddyinfo_free_ge_order_kb{%s,node="1",zone="Normal",order="2"} 16 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_zoneinfo_free_kb{%s,node="0",zone="Normal"} 3600 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_zoneinfo_watermark_kb{%s,node="0",zone="Normal",watermark="high"} 320 %d`, labels, promTs+30000),
+			},
+			ReportExtra:        true,
+			WantBuddyinfoZones: []string{"0/Normal", "1/Normal"},
+		},
+		{
+			Name:               "zone_removed",
+			BuddyinfoSeq:       []*procfs.Buddyinfo{buddyinfo2, buddyinfo},
+			FullMetricsFactor:  1000,
+			WantMetricsCount:   2,
+			WantBuddyinfoZones: []string{"0/Normal"},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcBuddyinfoMetrics(tc, t) },
+		)
+	}
+}
@@ -6,15 +6,18 @@ import (
 	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
 )
 
 const (
 	PROC_DISKSTATS_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
 	PROC_DISKSTATS_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
 	PROC_DISKSTATS_METRICS_CONFIG_MOUNTINFO_PID_DEFAULT       = 0 // i.e. self
+	PROC_DISKSTATS_METRICS_CONFIG_SYSFS_BLOCK_INFO_DEFAULT    = true
 
 	// This generator id:
 	PROC_DISKSTATS_METRICS_ID = "proc_diskstats_metrics"
@@ -40,11 +43,41 @@ const (
 	PROC_DISKSTATS_NUM_FLUSH_REQUESTS_DELTA_METRIC     = "proc_diskstats_num_flush_requests_delta"
 	PROC_DISKSTATS_FLUSH_PCT_METRIC                    = "proc_diskstats_flush_pct"
 
+	// iostat -x style derived metrics:
+	PROC_DISKSTATS_READ_AWAIT_MS_METRIC       = "proc_diskstats_read_await_ms"
+	PROC_DISKSTATS_WRITE_AWAIT_MS_METRIC      = "proc_diskstats_write_await_ms"
+	PROC_DISKSTATS_DISCARD_AWAIT_MS_METRIC    = "proc_diskstats_discard_await_ms"
+	PROC_DISKSTATS_FLUSH_AWAIT_MS_METRIC      = "proc_diskstats_flush_await_ms"
+	PROC_DISKSTATS_READ_AVG_REQ_KIB_METRIC    = "proc_diskstats_read_avg_req_kib"
+	PROC_DISKSTATS_WRITE_AVG_REQ_KIB_METRIC   = "proc_diskstats_write_avg_req_kib"
+	PROC_DISKSTATS_DISCARD_AVG_REQ_KIB_METRIC = "proc_diskstats_discard_avg_req_kib"
+	PROC_DISKSTATS_READ_KIBPS_METRIC          = "proc_diskstats_read_kibps"
+	PROC_DISKSTATS_WRITE_KIBPS_METRIC         = "proc_diskstats_write_kibps"
+
 	PROC_DISKSTATS_INFO_METRIC = "proc_diskstats_info"
 
+	// The number of devices excluded via include/exclude filters, generated
+	// only if filters are defined:
+	PROC_DISKSTATS_EXCLUDED_COUNT_METRIC = "proc_diskstats_excluded_count"
+
 	PROC_DISKSTATS_MAJ_MIN_LABEL_NAME = "maj_min"
 	PROC_DISKSTATS_NAME_LABEL_NAME    = "name"
 
+	// /sys/block/DEV based info:
+	PROC_DISKSTATS_BLOCK_INFO_METRIC                    = "proc_diskstats_block_info"
+	PROC_DISKSTATS_BLOCK_DM_NAME_LABEL_NAME             = "dm_name"
+	PROC_DISKSTATS_BLOCK_DM_UUID_LABEL_NAME             = "dm_uuid"
+	PROC_DISKSTATS_BLOCK_HOLDERS_LABEL_NAME             = "holders"
+	PROC_DISKSTATS_BLOCK_SLAVES_LABEL_NAME              = "slaves"
+	PROC_DISKSTATS_BLOCK_ROTATIONAL_LABEL_NAME          = "rotational"
+	PROC_DISKSTATS_BLOCK_SCHEDULER_LABEL_NAME           = "scheduler"
+	PROC_DISKSTATS_BLOCK_NR_REQUESTS_LABEL_NAME         = "nr_requests"
+	PROC_DISKSTATS_BLOCK_LOGICAL_BLOCK_SIZE_LABEL_NAME  = "logical_block_size"
+	PROC_DISKSTATS_BLOCK_PHYSICAL_BLOCK_SIZE_LABEL_NAME = "physical_block_size"
+	PROC_DISKSTATS_BLOCK_SIZE_BYTES_LABEL_NAME          = "size_bytes"
+	PROC_DISKSTATS_BLOCK_MODEL_LABEL_NAME               = "model"
+	PROC_DISKSTATS_BLOCK_SERIAL_LABEL_NAME              = "serial"
+
 	// mountinfo:
 	PROC_MOUNTINFO_METRIC                  = "proc_mountinfo"
 	PROC_MOUNTINFO_PID_LABEL_NAME          = "pid"
@@ -103,6 +136,36 @@ var procDiskstatsIndexPctMetric = [procfs.DISKSTATS_VALUE_FIELDS_NUM]*ProcDiskst
 	procfs.DISKSTATS_FLUSH_MILLISEC:       {100. / 1000., 2},
 }
 
+// Derived metrics, iostat -x style, based on a pair of diskstats values:
+//
+//	value = dVal / dOps * factor, if opsIndex >= 0; 0 if dOps == 0
+//	value = dVal / dTime * factor, if opsIndex < 0
+//
+// The metric is generated only if the kernel provides all the values, i.e.
+// both indexes are < DiskstatsDevInfo.NumValues.
+type ProcDiskstatsDerivedMetric struct {
+	name     string
+	valIndex int
+	opsIndex int
+	factor   float64
+	prec     int
+}
+
+// The size of a sector, as used by diskstats, is 512 bytes, i.e. 1/2 KiB:
+const PROC_DISKSTATS_SECTOR_KIB = 0.5
+
+var procDiskstatsDerivedMetrics = []*ProcDiskstatsDerivedMetric{
+	{PROC_DISKSTATS_READ_AWAIT_MS_METRIC, procfs.DISKSTATS_READ_MILLISEC, procfs.DISKSTATS_NUM_READS_COMPLETED, 1, 2},
+	{PROC_DISKSTATS_WRITE_AWAIT_MS_METRIC, procfs.DISKSTATS_WRITE_MILLISEC, procfs.DISKSTATS_NUM_WRITES_COMPLETED, 1, 2},
+	{PROC_DISKSTATS_DISCARD_AWAIT_MS_METRIC, procfs.DISKSTATS_DISCARD_MILLISEC, procfs.DISKSTATS_NUM_DISCARDS_COMPLETED, 1, 2},
+	{PROC_DISKSTATS_FLUSH_AWAIT_MS_METRIC, procfs.DISKSTATS_FLUSH_MILLISEC, procfs.DISKSTATS_NUM_FLUSH_REQUESTS, 1, 2},
+	{PROC_DISKSTATS_READ_AVG_REQ_KIB_METRIC, procfs.DISKSTATS_NUM_READ_SECTORS, procfs.DISKSTATS_NUM_READS_COMPLETED, PROC_DISKSTATS_SECTOR_KIB, 1},
+	{PROC_DISKSTATS_WRITE_AVG_REQ_KIB_METRIC, procfs.DISKSTATS_NUM_WRITE_SECTORS, procfs.DISKSTATS_NUM_WRITES_COMPLETED, PROC_DISKSTATS_SECTOR_KIB, 1},
+	{PROC_DISKSTATS_DISCARD_AVG_REQ_KIB_METRIC, procfs.DISKSTATS_NUM_DISCARD_SECTORS, procfs.DISKSTATS_NUM_DISCARDS_COMPLETED, PROC_DISKSTATS_SECTOR_KIB, 1},
+	{PROC_DISKSTATS_READ_KIBPS_METRIC, procfs.DISKSTATS_NUM_READ_SECTORS, -1, PROC_DISKSTATS_SECTOR_KIB, 1},
+	{PROC_DISKSTATS_WRITE_KIBPS_METRIC, procfs.DISKSTATS_NUM_WRITE_SECTORS, -1, PROC_DISKSTATS_SECTOR_KIB, 1},
+}
+
 // List of Mountinfo indexes used for labels; to ensure predictable label order,
 // they are grouped a list of pairs:
 type MountinfoIndexLabelPair struct {
@@ -127,6 +190,15 @@ type ProcDiskstatsMetricsConfig struct {
 	FullMetricsFactor int `yaml:"full_metrics_factor"`
 	// The PID to use for /proc/PID/mountinfo, use 0 for self:
 	MountinfoPid int `yaml:"mountinfo_pid"`
+	// Whether to read /sys/block/DEV attributes for full metrics cycles and to
+	// generate the block info metric:
+	SysfsBlockInfo bool `yaml:"sysfs_block_info"`
+	// The list of device name regexps to include; the regexps should match the
+	// entire name. If not defined/empty then all are included:
+	IncludeDevices []string `yaml:"include_devices"`
+	// The list of device name regexps to exclude; if not defined/empty then
+	// none is excluded. Exclude takes precedence over include.
+	ExcludeDevices []string `yaml:"exclude_devices"`
 }
 
 func DefaultProcDiskstatsMetricsConfig() *ProcDiskstatsMetricsConfig {
@@ -134,6 +206,7 @@ func DefaultProcDiskstatsMetricsConfig() *ProcDiskstatsMetricsConfig {
 		Interval:          PROC_DISKSTATS_METRICS_CONFIG_INTERVAL_DEFAULT,
 		FullMetricsFactor: PROC_DISKSTATS_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
 		MountinfoPid:      PROC_DISKSTATS_METRICS_CONFIG_MOUNTINFO_PID_DEFAULT,
+		SysfsBlockInfo:    PROC_DISKSTATS_METRICS_CONFIG_SYSFS_BLOCK_INFO_DEFAULT,
 	}
 }
 
@@ -148,8 +221,15 @@ type ProcDiskstatsMetricsInfo struct {
 	zeroDelta []bool
 	// Metrics cache, indexed by diskstats index:
 	metricsCache [][]byte
+	// Derived metrics cache and zero value tracking for the skip-zero-after-zero
+	// rule, indexed as procDiskstatsDerivedMetrics:
+	derivedMetricsCache [][]byte
+	derivedZero         []bool
 	// Info metric:
 	infoMetric []byte
+	// Block info metric, built from the most recent sysfs attributes, nil if
+	// not applicable (e.g. partitions):
+	blockInfoMetric []byte
 }
 
 type ProcDiskstatsMetrics struct {
@@ -167,6 +247,13 @@ type ProcDiskstatsMetrics struct {
 	currIndex int
 	// Info, indexed by maj:min:
 	diskstatsMetricsInfo map[string]*ProcDiskstatsMetricsInfo
+	// Device filter, keyed by maj:min, nil if no filtering:
+	devFilter *ItemFilter
+
+	// The sysfs block attributes, indexed by maj:min, parsed for full cycles
+	// only; only whole devices have such attributes:
+	sysfsBlockInfo bool
+	blockDevMap    map[string]*sysfs.BlockDev
 
 	// Mountinfo:
 	mountinfoPid      int
@@ -194,6 +281,7 @@ type ProcDiskstatsMetrics struct {
 	timeNowFn          func() time.Time
 	metricsQueue       MetricsQueue
 	procfsRoot         string
+	sysfsRoot          string
 }
 
 func NewProcDiskstatsMetrics(cfg any) (*ProcDiskstatsMetrics, error) {
@@ -224,13 +312,27 @@ func NewProcDiskstatsMetrics(cfg any) (*ProcDiskstatsMetrics, error) {
 		mountinfoPid:         procDiskstatsMetricsCfg.MountinfoPid,
 		mountinfoCycleNum:    initialCycleNum.Get(procDiskstatsMetricsCfg.FullMetricsFactor),
 		fullMetricsFactor:    procDiskstatsMetricsCfg.FullMetricsFactor,
+		sysfsBlockInfo:       procDiskstatsMetricsCfg.SysfsBlockInfo,
+		blockDevMap:          make(map[string]*sysfs.BlockDev),
 		tsSuffixBuf:          &bytes.Buffer{},
 	}
 
+	procDiskstatsMetrics.devFilter, err = NewItemFilter(
+		procDiskstatsMetricsCfg.IncludeDevices,
+		procDiskstatsMetricsCfg.ExcludeDevices,
+		procDiskstatsMetrics.fullMetricsFactor,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("NewProcDiskstatsMetrics: include/exclude_devices: %v", err)
+	}
+
 	procDiskstatsMetricsLog.Infof("id=%s", procDiskstatsMetrics.id)
 	procDiskstatsMetricsLog.Infof("interval=%s", procDiskstatsMetrics.interval)
 	procDiskstatsMetricsLog.Infof("full_metrics_factor=%d", procDiskstatsMetrics.fullMetricsFactor)
 	procDiskstatsMetricsLog.Infof("mountinfoPid=%d", procDiskstatsMetrics.mountinfoPid)
+	procDiskstatsMetricsLog.Infof("sysfs_block_info=%v", procDiskstatsMetrics.sysfsBlockInfo)
+	procDiskstatsMetricsLog.Infof("include_devices=%q", procDiskstatsMetricsCfg.IncludeDevices)
+	procDiskstatsMetricsLog.Infof("exclude_devices=%q", procDiskstatsMetricsCfg.ExcludeDevices)
 	return procDiskstatsMetrics, nil
 }
 
@@ -246,15 +348,20 @@ func (pdsm *ProcDiskstatsMetrics) updateDiskstatsMetricsCache(majMin, diskName s
 	info := pdsm.diskstatsMetricsInfo[majMin]
 	if info == nil {
 		info = &ProcDiskstatsMetricsInfo{
-			cycleNum:     initialCycleNum.Get(pdsm.fullMetricsFactor),
-			zeroDelta:    make([]bool, procfs.DISKSTATS_VALUE_FIELDS_NUM),
-			metricsCache: make([][]byte, procfs.DISKSTATS_VALUE_FIELDS_NUM),
+			cycleNum:            initialCycleNum.Get(pdsm.fullMetricsFactor),
+			zeroDelta:           make([]bool, procfs.DISKSTATS_VALUE_FIELDS_NUM),
+			metricsCache:        make([][]byte, procfs.DISKSTATS_VALUE_FIELDS_NUM),
+			derivedMetricsCache: make([][]byte, len(procDiskstatsDerivedMetrics)),
+			derivedZero:         make([]bool, len(procDiskstatsDerivedMetrics)),
 		}
 		pdsm.diskstatsMetricsInfo[majMin] = info
 	} else {
 		for i := 0; i < len(info.zeroDelta); i++ {
 			info.zeroDelta[i] = false
 		}
+		for i := 0; i < len(info.derivedZero); i++ {
+			info.derivedZero[i] = false
+		}
 	}
 
 	for i, name := range procDiskstatsIndexToMetricNameMap {
@@ -268,6 +375,17 @@ func (pdsm *ProcDiskstatsMetrics) updateDiskstatsMetricsCache(majMin, diskName s
 		))
 	}
 
+	for i, derivedMetric := range procDiskstatsDerivedMetrics {
+		info.derivedMetricsCache[i] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. space before value included
+			derivedMetric.name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			PROC_DISKSTATS_MAJ_MIN_LABEL_NAME, majMin,
+			PROC_DISKSTATS_NAME_LABEL_NAME, diskName,
+		))
+	}
+
 	info.infoMetric = []byte(fmt.Sprintf(
 		`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. space before value included
 		PROC_DISKSTATS_INFO_METRIC,
@@ -278,6 +396,82 @@ func (pdsm *ProcDiskstatsMetrics) updateDiskstatsMetricsCache(majMin, diskName s
 	))
 }
 
+func (pdsm *ProcDiskstatsMetrics) buildBlockInfoMetric(majMin string, blockDev *sysfs.BlockDev) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pdsm.instance != "" {
+		instance = pdsm.instance
+	}
+	if pdsm.hostname != "" {
+		hostname = pdsm.hostname
+	}
+
+	formatInt := func(val int64) string {
+		if val < 0 {
+			return ""
+		}
+		return strconv.FormatInt(val, 10)
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. space before value included
+		PROC_DISKSTATS_BLOCK_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_DISKSTATS_MAJ_MIN_LABEL_NAME, majMin,
+		PROC_DISKSTATS_NAME_LABEL_NAME, blockDev.Name,
+		PROC_DISKSTATS_BLOCK_DM_NAME_LABEL_NAME, blockDev.DmName,
+		PROC_DISKSTATS_BLOCK_DM_UUID_LABEL_NAME, blockDev.DmUuid,
+		PROC_DISKSTATS_BLOCK_HOLDERS_LABEL_NAME, strings.Join(blockDev.Holders, ","),
+		PROC_DISKSTATS_BLOCK_SLAVES_LABEL_NAME, strings.Join(blockDev.Slaves, ","),
+		PROC_DISKSTATS_BLOCK_ROTATIONAL_LABEL_NAME, formatInt(blockDev.Rotational),
+		PROC_DISKSTATS_BLOCK_SCHEDULER_LABEL_NAME, blockDev.Scheduler,
+		PROC_DISKSTATS_BLOCK_NR_REQUESTS_LABEL_NAME, formatInt(blockDev.NrRequests),
+		PROC_DISKSTATS_BLOCK_LOGICAL_BLOCK_SIZE_LABEL_NAME, formatInt(blockDev.LogicalBlockSize),
+		PROC_DISKSTATS_BLOCK_PHYSICAL_BLOCK_SIZE_LABEL_NAME, formatInt(blockDev.PhysicalBlockSize),
+		PROC_DISKSTATS_BLOCK_SIZE_BYTES_LABEL_NAME, formatInt(blockDev.SizeBytes),
+		PROC_DISKSTATS_BLOCK_MODEL_LABEL_NAME, blockDev.Model,
+		PROC_DISKSTATS_BLOCK_SERIAL_LABEL_NAME, blockDev.Serial,
+	))
+}
+
+// Parse the sysfs block attributes for the devices about to have a full metrics
+// cycle. This should be invoked after the current stats were parsed and before
+// the metrics are generated:
+func (pdsm *ProcDiskstatsMetrics) updateBlockDevs(currProcDiskstats *procfs.Diskstats) {
+	sysfsRoot := GlobalSysfsRoot
+	if pdsm.sysfsRoot != "" {
+		sysfsRoot = pdsm.sysfsRoot
+	}
+
+	for majMin, devInfo := range currProcDiskstats.DevInfoMap {
+		info := pdsm.diskstatsMetricsInfo[majMin]
+		blockDev := pdsm.blockDevMap[majMin]
+		if blockDev != nil && blockDev.Name != devInfo.Name {
+			// Device renamed:
+			blockDev = nil
+		} else if info != nil && info.cycleNum != 0 ||
+			info == nil && pdsm.devFilter.exclude(majMin, devInfo.Name) {
+			continue
+		}
+		if blockDev == nil {
+			blockDev = sysfs.NewBlockDev(sysfsRoot, devInfo.Name)
+			pdsm.blockDevMap[majMin] = blockDev
+		}
+		if err := blockDev.Parse(); err != nil || blockDev.MajMin != majMin {
+			// Not a whole device (e.g. partition) or it was removed in the
+			// meantime:
+			delete(pdsm.blockDevMap, majMin)
+		}
+	}
+
+	if len(pdsm.blockDevMap) > 0 {
+		for majMin := range pdsm.blockDevMap {
+			if currProcDiskstats.DevInfoMap[majMin] == nil {
+				delete(pdsm.blockDevMap, majMin)
+			}
+		}
+	}
+}
+
 // When updating mountinfo return an iterable object with the metrics that went
 // out of scope, they should be pushed w/ the associated value set to 0.
 func (pdsm *ProcDiskstatsMetrics) updateMountinfoMetricsCache() map[string]bool {
@@ -308,8 +502,10 @@ func (pdsm *ProcDiskstatsMetrics) updateMountinfoMetricsCache() map[string]bool
 	prefixLen := buf.Len()
 	diskstats := pdsm.procDiskstats[pdsm.currIndex]
 	for _, parsedLine := range parsedLines {
-		// Keep only info that has a maj:min matching diskstats:
-		if diskstats.DevInfoMap[string((*parsedLine)[procfs.MOUNTINFO_MAJOR_MINOR])] == nil {
+		// Keep only info that has a maj:min matching diskstats, which was not
+		// excluded:
+		majMin := string((*parsedLine)[procfs.MOUNTINFO_MAJOR_MINOR])
+		if diskstats.DevInfoMap[majMin] == nil || pdsm.devFilter.isExcluded(majMin) {
 			continue
 		}
 		buf.Truncate(prefixLen)
@@ -341,6 +537,9 @@ func (pdsm *ProcDiskstatsMetrics) updateIntervalMetricsCache() {
 		INSTANCE_LABEL_NAME, instance,
 		HOSTNAME_LABEL_NAME, hostname,
 	))
+	if pdsm.devFilter != nil {
+		pdsm.devFilter.updateCountMetric(PROC_DISKSTATS_EXCLUDED_COUNT_METRIC, instance, hostname)
+	}
 }
 
 func (pdsm *ProcDiskstatsMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
@@ -363,12 +562,15 @@ func (pdsm *ProcDiskstatsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 
 	// diskstats metrics:
 	for majMin, currDevInfo := range currProcDiskstats.DevInfoMap {
+		diskstatsMetricInfo := pdsm.diskstatsMetricsInfo[majMin]
+		if diskstatsMetricInfo == nil && pdsm.devFilter.exclude(majMin, currDevInfo.Name) {
+			continue
+		}
 		prevDevInfo := prevProcDiskstats.DevInfoMap[majMin]
 		if prevDevInfo == nil {
 			// New disk, it doesn't have a previous state captured yet:
 			continue
 		}
-		diskstatsMetricInfo := pdsm.diskstatsMetricsInfo[majMin]
 		nameChanged := currProcDiskstats.Changed && currDevInfo.Name != prevDevInfo.Name
 		fullData := diskstatsMetricInfo == nil || diskstatsMetricInfo.cycleNum == 0 || nameChanged
 		if diskstatsMetricInfo == nil || nameChanged {
@@ -378,6 +580,18 @@ func (pdsm *ProcDiskstatsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 				buf.WriteByte('0')
 				buf.Write(promTs)
 				actualMetricsCount++
+				if diskstatsMetricInfo.blockInfoMetric != nil {
+					buf.Write(diskstatsMetricInfo.blockInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+					diskstatsMetricInfo.blockInfoMetric = nil
+				}
+				// The new name may be excluded:
+				if pdsm.devFilter.exclude(majMin, currDevInfo.Name) {
+					delete(pdsm.diskstatsMetricsInfo, majMin)
+					continue
+				}
 			}
 			pdsm.updateDiskstatsMetricsCache(majMin, currDevInfo.Name)
 			diskstatsMetricInfo = pdsm.diskstatsMetricsInfo[majMin]
@@ -413,19 +627,66 @@ func (pdsm *ProcDiskstatsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 			}
 		}
 
+		// Derived metrics, only for the values supported by the kernel:
+		derivedZero := diskstatsMetricInfo.derivedZero
+		numDerivedMetrics := 0
+		for i, derivedMetric := range procDiskstatsDerivedMetrics {
+			if derivedMetric.valIndex >= currDevInfo.NumValues || derivedMetric.opsIndex >= currDevInfo.NumValues {
+				continue
+			}
+			numDerivedMetrics++
+			dVal := currStats[derivedMetric.valIndex] - prevStats[derivedMetric.valIndex]
+			val := 0.
+			if derivedMetric.opsIndex < 0 {
+				if deltaSec > 0 {
+					val = float64(dVal) * derivedMetric.factor / deltaSec
+				}
+			} else if dOps := currStats[derivedMetric.opsIndex] - prevStats[derivedMetric.opsIndex]; dOps > 0 {
+				val = float64(dVal) * derivedMetric.factor / float64(dOps)
+			}
+			isZero := val == 0
+			if fullData || !isZero || !derivedZero[i] {
+				buf.Write(diskstatsMetricInfo.derivedMetricsCache[i])
+				buf.WriteString(strconv.FormatFloat(val, 'f', derivedMetric.prec, 64))
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			derivedZero[i] = isZero
+		}
+
 		if fullData {
 			// Info:
 			buf.Write(diskstatsMetricInfo.infoMetric)
 			buf.WriteByte('1')
 			buf.Write(promTs)
 			actualMetricsCount++
+
+			// Block info, for whole devices:
+			if blockDev := pdsm.blockDevMap[majMin]; pdsm.sysfsBlockInfo && blockDev != nil {
+				blockInfoMetric := pdsm.buildBlockInfoMetric(majMin, blockDev)
+				if diskstatsMetricInfo.blockInfoMetric != nil && !bytes.Equal(diskstatsMetricInfo.blockInfoMetric, blockInfoMetric) {
+					// Clear previous info:
+					buf.Write(diskstatsMetricInfo.blockInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				buf.Write(blockInfoMetric)
+				buf.WriteByte('1')
+				buf.Write(promTs)
+				actualMetricsCount++
+				diskstatsMetricInfo.blockInfoMetric = blockInfoMetric
+			}
 		}
 
 		// Update cycleNum for this maj:min:
 		if diskstatsMetricInfo.cycleNum += 1; diskstatsMetricInfo.cycleNum >= pdsm.fullMetricsFactor {
 			diskstatsMetricInfo.cycleNum = 0
 		}
-		totalMetricsCount += len(diskstatsMetricInfo.metricsCache) + 1
+		totalMetricsCount += len(diskstatsMetricInfo.metricsCache) + numDerivedMetrics + 1
+		if diskstatsMetricInfo.blockInfoMetric != nil {
+			totalMetricsCount++
+		}
 	}
 
 	// mountinfo metrics, unless disabled:
@@ -472,10 +733,20 @@ func (pdsm *ProcDiskstatsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 	}
 
 	// Clean up info no longer in scope:
-	if len(pdsm.diskstatsMetricsInfo) != len(currProcDiskstats.DevInfoMap) {
-		for majMin := range pdsm.diskstatsMetricsInfo {
-			if currProcDiskstats.DevInfoMap[majMin] != nil {
-				delete(currProcDiskstats.DevInfoMap, majMin)
+	pruneExcludedItems(pdsm.devFilter, currProcDiskstats.DevInfoMap)
+	if len(pdsm.diskstatsMetricsInfo)+pdsm.devFilter.excludedCount() != len(currProcDiskstats.DevInfoMap) {
+		for majMin, diskstatsMetricInfo := range pdsm.diskstatsMetricsInfo {
+			if currProcDiskstats.DevInfoMap[majMin] == nil {
+				// Annul the info metrics for the removed device:
+				for _, metric := range [][]byte{diskstatsMetricInfo.infoMetric, diskstatsMetricInfo.blockInfoMetric} {
+					if metric != nil {
+						buf.Write(metric)
+						buf.WriteByte('0')
+						buf.Write(promTs)
+						actualMetricsCount++
+					}
+				}
+				delete(pdsm.diskstatsMetricsInfo, majMin)
 			}
 		}
 	}
@@ -489,6 +760,12 @@ func (pdsm *ProcDiskstatsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 	buf.Write(promTs)
 	actualMetricsCount++
 
+	// Excluded count metric, if filtering:
+	if pdsm.devFilter != nil {
+		actualMetricsCount += pdsm.devFilter.generateCountMetric(buf, promTs, pdsm.fullMetricsFactor)
+		totalMetricsCount++
+	}
+
 	// Flip the current index:
 	pdsm.currIndex = 1 - pdsm.currIndex
 
@@ -549,6 +826,9 @@ func (pdsm *ProcDiskstatsMetrics) Execute() bool {
 	}
 
 	pdsm.procDiskstatsTs[pdsm.currIndex] = timeNowFn()
+	if pdsm.sysfsBlockInfo {
+		pdsm.updateBlockDevs(currProcDiskstats)
+	}
 
 	buf := metricsQueue.GetBuf()
 	actualMetricsCount, totalMetricsCount := pdsm.generateMetrics(buf)
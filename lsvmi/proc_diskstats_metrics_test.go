@@ -388,3 +388,447 @@ func TestProcDiskstatsMetrics(t *testing.T) {
 		)
 	}
 }
+
+type ProcDiskstatsMetricsDerivedTestCase struct {
+	Name string
+	// Whether to prime the metrics info as if not in a full cycle, with all
+	// previous values zero:
+	PrimePartial     bool
+	WantMetricsCount int
+	WantMetrics      []string
+}
+
+func TestProcDiskstatsMetricsDerived(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	derivedMetric := func(name, majMin, diskName, val string) string {
+		return fmt.Sprintf(
+			`%s{instance="%s",hostname="%s",maj_min="%s",name="%s"} %s %d`,
+			name, instance, hostname, majMin, diskName, val, currPromTs,
+		)
+	}
+
+	// sda: all fields, 100 reads of 2000 sectors in 250 ms, 50 writes of 800
+	// sectors in 100 ms.
+	// sdb: older kernel, no discard and flush fields, 10 reads of 80 sectors
+	// in 15 ms.
+	newDiskstats := func(prev bool) *procfs.Diskstats {
+		diskstats := &procfs.Diskstats{
+			DevInfoMap: map[string]*procfs.DiskstatsDevInfo{
+				"8:0": {
+					Name:      "sda",
+					Stats:     make([]uint32, procfs.DISKSTATS_VALUE_FIELDS_NUM),
+					NumValues: procfs.DISKSTATS_VALUE_FIELDS_NUM,
+				},
+				"8:16": {
+					Name:      "sdb",
+					Stats:     make([]uint32, procfs.DISKSTATS_VALUE_FIELDS_NUM),
+					NumValues: 11,
+				},
+			},
+		}
+		if !prev {
+			stats := diskstats.DevInfoMap["8:0"].Stats
+			stats[procfs.DISKSTATS_NUM_READS_COMPLETED] = 100
+			stats[procfs.DISKSTATS_NUM_READ_SECTORS] = 2000
+			stats[procfs.DISKSTATS_READ_MILLISEC] = 250
+			stats[procfs.DISKSTATS_NUM_WRITES_COMPLETED] = 50
+			stats[procfs.DISKSTATS_NUM_WRITE_SECTORS] = 800
+			stats[procfs.DISKSTATS_WRITE_MILLISEC] = 100
+			stats = diskstats.DevInfoMap["8:16"].Stats
+			stats[procfs.DISKSTATS_NUM_READS_COMPLETED] = 10
+			stats[procfs.DISKSTATS_NUM_READ_SECTORS] = 80
+			stats[procfs.DISKSTATS_READ_MILLISEC] = 15
+		}
+		return diskstats
+	}
+
+	for _, tc := range []*ProcDiskstatsMetricsDerivedTestCase{
+		{
+			Name: "full",
+			// sda: 17 raw + 9 derived + info
+			// sdb: 17 raw + 6 derived + info
+			// + interval
+			WantMetricsCount: (17 + 9 + 1) + (17 + 6 + 1) + 1,
+			WantMetrics: []string{
+				derivedMetric("proc_diskstats_read_await_ms", "8:0", "sda", "2.50"),
+				derivedMetric("proc_diskstats_write_await_ms", "8:0", "sda", "2.00"),
+				derivedMetric("proc_diskstats_discard_await_ms", "8:0", "sda", "0.00"),
+				derivedMetric("proc_diskstats_flush_await_ms", "8:0", "sda", "0.00"),
+				derivedMetric("proc_diskstats_read_avg_req_kib", "8:0", "sda", "10.0"),
+				derivedMetric("proc_diskstats_write_avg_req_kib", "8:0", "sda", "8.0"),
+				derivedMetric("proc_diskstats_discard_avg_req_kib", "8:0", "sda", "0.0"),
+				derivedMetric("proc_diskstats_read_kibps", "8:0", "sda", "200.0"),
+				derivedMetric("proc_diskstats_write_kibps", "8:0", "sda", "80.0"),
+				derivedMetric("proc_diskstats_read_await_ms", "8:16", "sdb", "1.50"),
+				derivedMetric("proc_diskstats_write_await_ms", "8:16", "sdb", "0.00"),
+				derivedMetric("proc_diskstats_read_avg_req_kib", "8:16", "sdb", "4.0"),
+				derivedMetric("proc_diskstats_write_avg_req_kib", "8:16", "sdb", "0.0"),
+				derivedMetric("proc_diskstats_read_kibps", "8:16", "sdb", "8.0"),
+				derivedMetric("proc_diskstats_write_kibps", "8:16", "sdb", "0.0"),
+			},
+		},
+		{
+			Name:         "zero_after_zero",
+			PrimePartial: true,
+			// sda: 6 raw deltas (reads, read sectors, read %, writes, write
+			// sectors, write %) + 6 derived (read/write await, avg req, kibps)
+			// sdb: 3 raw deltas + 3 derived
+			// + interval
+			WantMetricsCount: (6 + 6) + (3 + 3) + 1,
+			WantMetrics: []string{
+				derivedMetric("proc_diskstats_read_await_ms", "8:0", "sda", "2.50"),
+				derivedMetric("proc_diskstats_write_await_ms", "8:0", "sda", "2.00"),
+				derivedMetric("proc_diskstats_read_avg_req_kib", "8:0", "sda", "10.0"),
+				derivedMetric("proc_diskstats_write_avg_req_kib", "8:0", "sda", "8.0"),
+				derivedMetric("proc_diskstats_read_kibps", "8:0", "sda", "200.0"),
+				derivedMetric("proc_diskstats_write_kibps", "8:0", "sda", "80.0"),
+				derivedMetric("proc_diskstats_read_await_ms", "8:16", "sdb", "1.50"),
+				derivedMetric("proc_diskstats_read_avg_req_kib", "8:16", "sdb", "4.0"),
+				derivedMetric("proc_diskstats_read_kibps", "8:16", "sdb", "8.0"),
+			},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) {
+				tlc := testutils.NewTestLogCollect(t, Log, nil)
+				defer tlc.RestoreLog()
+
+				pdsm, err := NewProcDiskstatsMetrics(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pdsm.instance = instance
+				pdsm.hostname = hostname
+				pdsm.mountifoDisabled = true
+				currIndex := pdsm.currIndex
+				pdsm.procDiskstats[currIndex] = newDiskstats(false)
+				pdsm.procDiskstatsTs[currIndex] = time.UnixMilli(currPromTs)
+				pdsm.procDiskstats[1-currIndex] = newDiskstats(true)
+				pdsm.procDiskstatsTs[1-currIndex] = time.UnixMilli(prevPromTs)
+				if tc.PrimePartial {
+					for majMin, devInfo := range pdsm.procDiskstats[currIndex].DevInfoMap {
+						pdsm.updateDiskstatsMetricsCache(majMin, devInfo.Name)
+						info := pdsm.diskstatsMetricsInfo[majMin]
+						info.cycleNum = 1
+						for i := range info.zeroDelta {
+							info.zeroDelta[i] = true
+						}
+						for i := range info.derivedZero {
+							info.derivedZero[i] = true
+						}
+					}
+				}
+
+				testMetricsQueue := testutils.NewTestMetricsQueue(0)
+				buf := testMetricsQueue.GetBuf()
+				gotMetricsCount, _ := pdsm.generateMetrics(buf)
+				testMetricsQueue.QueueBuf(buf)
+
+				errBuf := &bytes.Buffer{}
+				if tc.WantMetricsCount != gotMetricsCount {
+					fmt.Fprintf(
+						errBuf,
+						"\nmetrics count: want: %d, got: %d",
+						tc.WantMetricsCount, gotMetricsCount,
+					)
+				}
+				testMetricsQueue.GenerateReport(tc.WantMetrics, false, errBuf)
+				if errBuf.Len() > 0 {
+					t.Fatal(errBuf)
+				}
+			},
+		)
+	}
+}
+
+var procDiskstatsMetricsTestSysfsRoot = path.Join("..", testutils.SysfsTestDataSubdir, "block", "field_mapping")
+
+func TestProcDiskstatsMetricsBlockInfo(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	blockInfoMetric := func(majMin, name, dmName, dmUuid, holders, slaves, rotational, scheduler, nrRequests, lbs, pbs, sizeBytes, model, serial string) string {
+		return fmt.Sprintf(
+			`proc_diskstats_block_info{instance="%s",hostname="%s",maj_min="%s",name="%s",dm_name="%s",dm_uuid="%s",holders="%s",slaves="%s",rotational="%s",scheduler="%s",nr_requests="%s",logical_block_size="%s",physical_block_size="%s",size_bytes="%s",model="%s",serial="%s"} `,
+			instance, hostname, majMin, name, dmName, dmUuid, holders, slaves, rotational, scheduler, nrRequests, lbs, pbs, sizeBytes, model, serial,
+		)
+	}
+	sdaBlockInfoMetric := blockInfoMetric(
+		"8:0", "sda", "", "", "dm-0", "", "1", "mq-deadline", "64", "512", "4096", "1000204886016", "ST1000DM010-2EP1", "",
+	)
+	dm0BlockInfoMetric := blockInfoMetric(
+		"253:0", "dm-0", "vg0-root", "LVM-0123456789abcdef", "", "sda", "1", "none", "", "512", "4096", "21470642176", "", "",
+	)
+	nvme0n1BlockInfoMetric := blockInfoMetric(
+		"259:0", "nvme0n1", "", "", "", "", "0", "none", "1023", "512", "512", "1024209543168", "Samsung SSD 980 PRO 1TB", "S5GXNX0T123456",
+	)
+
+	newDiskstats := func() *procfs.Diskstats {
+		diskstats := &procfs.Diskstats{DevInfoMap: make(map[string]*procfs.DiskstatsDevInfo)}
+		for majMin, name := range map[string]string{
+			"8:0":   "sda",
+			"8:1":   "sda1",
+			"253:0": "dm-0",
+			"259:0": "nvme0n1",
+		} {
+			diskstats.DevInfoMap[majMin] = &procfs.DiskstatsDevInfo{
+				Name:      name,
+				Stats:     make([]uint32, procfs.DISKSTATS_VALUE_FIELDS_NUM),
+				NumValues: procfs.DISKSTATS_VALUE_FIELDS_NUM,
+			}
+		}
+		return diskstats
+	}
+
+	for _, tc := range []struct {
+		Name string
+		// Prime the metrics info w/ the block info metric, indexed by maj:min:
+		PrimeBlockInfoMetric map[string]string
+		WantMetrics          []string
+		WantNoBlockInfo      []string
+	}{
+		{
+			Name: "full",
+			WantMetrics: []string{
+				fmt.Sprintf("%s1 %d", sdaBlockInfoMetric, currPromTs),
+				fmt.Sprintf("%s1 %d", dm0BlockInfoMetric, currPromTs),
+				fmt.Sprintf("%s1 %d", nvme0n1BlockInfoMetric, currPromTs),
+			},
+			WantNoBlockInfo: []string{"8:1"},
+		},
+		{
+			Name: "change",
+			PrimeBlockInfoMetric: map[string]string{
+				"8:0": blockInfoMetric(
+					"8:0", "sda", "", "", "", "", "1", "bfq", "64", "512", "4096", "1000204886016", "ST1000DM010-2EP1", "",
+				),
+				"253:0": dm0BlockInfoMetric,
+			},
+			WantMetrics: []string{
+				fmt.Sprintf(
+					"%s0 %d",
+					blockInfoMetric(
+						"8:0", "sda", "", "", "", "", "1", "bfq", "64", "512", "4096", "1000204886016", "ST1000DM010-2EP1", "",
+					),
+					currPromTs,
+				),
+				fmt.Sprintf("%s1 %d", sdaBlockInfoMetric, currPromTs),
+				fmt.Sprintf("%s1 %d", dm0BlockInfoMetric, currPromTs),
+				fmt.Sprintf("%s1 %d", nvme0n1BlockInfoMetric, currPromTs),
+			},
+			WantNoBlockInfo: []string{"8:1"},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) {
+				tlc := testutils.NewTestLogCollect(t, Log, nil)
+				defer tlc.RestoreLog()
+
+				pdsm, err := NewProcDiskstatsMetrics(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pdsm.instance = instance
+				pdsm.hostname = hostname
+				pdsm.sysfsRoot = procDiskstatsMetricsTestSysfsRoot
+				pdsm.mountifoDisabled = true
+				currIndex := pdsm.currIndex
+				currProcDiskstats := newDiskstats()
+				pdsm.procDiskstats[currIndex] = currProcDiskstats
+				pdsm.procDiskstatsTs[currIndex] = time.UnixMilli(currPromTs)
+				pdsm.procDiskstats[1-currIndex] = newDiskstats()
+				pdsm.procDiskstatsTs[1-currIndex] = time.UnixMilli(prevPromTs)
+				for majMin, metric := range tc.PrimeBlockInfoMetric {
+					pdsm.updateDiskstatsMetricsCache(majMin, currProcDiskstats.DevInfoMap[majMin].Name)
+					info := pdsm.diskstatsMetricsInfo[majMin]
+					info.cycleNum = 0
+					info.blockInfoMetric = []byte(metric)
+				}
+				pdsm.updateBlockDevs(currProcDiskstats)
+
+				testMetricsQueue := testutils.NewTestMetricsQueue(0)
+				buf := testMetricsQueue.GetBuf()
+				pdsm.generateMetrics(buf)
+				testMetricsQueue.QueueBuf(buf)
+
+				errBuf := &bytes.Buffer{}
+				for _, majMin := range tc.WantNoBlockInfo {
+					if info := pdsm.diskstatsMetricsInfo[majMin]; info == nil || info.blockInfoMetric != nil {
+						fmt.Fprintf(errBuf, "\n%s: unexpected block info", majMin)
+					}
+				}
+				testMetricsQueue.GenerateReport(tc.WantMetrics, false, errBuf)
+				if errBuf.Len() > 0 {
+					t.Fatal(errBuf)
+				}
+			},
+		)
+	}
+}
+
+func TestProcDiskstatsMetricsFilter(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	procDiskstatsMetricsCfg := DefaultProcDiskstatsMetricsConfig()
+	procDiskstatsMetricsCfg.ExcludeDevices = []string{`loop.*`}
+	pdsm, err := NewProcDiskstatsMetrics(procDiskstatsMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdsm.instance = instance
+	pdsm.hostname = hostname
+	pdsm.mountifoDisabled = true
+
+	newDiskstats := func() *procfs.Diskstats {
+		diskstats := &procfs.Diskstats{
+			DevInfoMap: make(map[string]*procfs.DiskstatsDevInfo),
+		}
+		for majMin, name := range map[string]string{"8:0": "sda", "7:0": "loop0", "7:1": "loop1"} {
+			diskstats.DevInfoMap[majMin] = &procfs.DiskstatsDevInfo{
+				Name:      name,
+				Stats:     make([]uint32, procfs.DISKSTATS_VALUE_FIELDS_NUM),
+				NumValues: procfs.DISKSTATS_VALUE_FIELDS_NUM,
+			}
+		}
+		return diskstats
+	}
+	currIndex := pdsm.currIndex
+	pdsm.procDiskstats[currIndex] = newDiskstats()
+	pdsm.procDiskstatsTs[currIndex] = time.UnixMilli(currPromTs)
+	pdsm.procDiskstats[1-currIndex] = newDiskstats()
+	pdsm.procDiskstatsTs[1-currIndex] = time.UnixMilli(prevPromTs)
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := pdsm.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+	// sda: 17 raw + 9 derived + info, + interval + excluded count:
+	wantMetricsCount := (17 + 9 + 1) + 1 + 1
+	if wantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(errBuf, "\nmetrics count: want: %d, got: %d", wantMetricsCount, gotMetricsCount)
+	}
+	for _, majMin := range []string{"7:0", "7:1"} {
+		if _, ok := pdsm.diskstatsMetricsInfo[majMin]; ok {
+			fmt.Fprintf(errBuf, "\ndiskstatsMetricsInfo: unexpected %q", majMin)
+		}
+	}
+	if _, ok := pdsm.diskstatsMetricsInfo["8:0"]; !ok {
+		fmt.Fprintf(errBuf, "\ndiskstatsMetricsInfo: missing %q", "8:0")
+	}
+	wantMetrics := []string{
+		fmt.Sprintf(
+			`proc_diskstats_metrics_delta_sec{instance="%s",hostname="%s"} 5.000000 %d`,
+			instance, hostname, currPromTs,
+		),
+		fmt.Sprintf(
+			`proc_diskstats_excluded_count{instance="%s",hostname="%s"} 2 %d`,
+			instance, hostname, currPromTs,
+		),
+	}
+	testMetricsQueue.GenerateReport(wantMetrics, false, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestProcDiskstatsMetricsRemoveDev(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	promTs := int64(1_700_000_000_000)
+
+	pdsm, err := NewProcDiskstatsMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdsm.instance = instance
+	pdsm.hostname = hostname
+	pdsm.mountifoDisabled = true
+
+	devNames := map[string]string{"8:0": "sda", "8:16": "sdb", "7:0": "loop0"}
+	newDiskstats := func(numReads uint32, majMins ...string) *procfs.Diskstats {
+		diskstats := &procfs.Diskstats{
+			DevInfoMap: make(map[string]*procfs.DiskstatsDevInfo),
+		}
+		for _, majMin := range majMins {
+			stats := make([]uint32, procfs.DISKSTATS_VALUE_FIELDS_NUM)
+			stats[procfs.DISKSTATS_NUM_READS_COMPLETED] = numReads
+			diskstats.DevInfoMap[majMin] = &procfs.DiskstatsDevInfo{
+				Name:      devNames[majMin],
+				Stats:     stats,
+				NumValues: procfs.DISKSTATS_VALUE_FIELDS_NUM,
+			}
+		}
+		return diskstats
+	}
+	// The block info metric for loop0, primed after scan 1:
+	loop0BlockInfoMetric := fmt.Sprintf(
+		`%s{instance="%s",hostname="%s",maj_min="%s",name="%s",rotational="0"} `,
+		PROC_DISKSTATS_BLOCK_INFO_METRIC, instance, hostname, "7:0", devNames["7:0"],
+	)
+	readsDeltaMetric := func(majMin string, val int, ts int64) string {
+		return fmt.Sprintf(
+			`%s{instance="%s",hostname="%s",maj_min="%s",name="%s"} %d %d`,
+			PROC_DISKSTATS_NUM_READS_COMPLETED_DELTA_METRIC, instance, hostname, majMin, devNames[majMin], val, ts,
+		)
+	}
+
+	// Scans 0 and 1: all devices, scan 2: loop0 removed, scans 3 and 4: the
+	// remaining devices should still produce deltas:
+	pdsm.procDiskstats[1-pdsm.currIndex] = newDiskstats(0, "8:0", "8:16", "7:0")
+	pdsm.procDiskstatsTs[1-pdsm.currIndex] = time.UnixMilli(promTs)
+	for scan := 1; scan <= 4; scan++ {
+		scanPromTs := promTs + int64(scan)*5_000
+		majMins := []string{"8:0", "8:16"}
+		if scan == 1 {
+			majMins = append(majMins, "7:0")
+		}
+		pdsm.procDiskstats[pdsm.currIndex] = newDiskstats(uint32(scan*10), majMins...)
+		pdsm.procDiskstatsTs[pdsm.currIndex] = time.UnixMilli(scanPromTs)
+
+		testMetricsQueue := testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		pdsm.generateMetrics(buf)
+		testMetricsQueue.QueueBuf(buf)
+
+		errBuf := &bytes.Buffer{}
+		wantMetrics := []string{
+			readsDeltaMetric("8:0", 10, scanPromTs),
+			readsDeltaMetric("8:16", 10, scanPromTs),
+		}
+		if scan == 2 {
+			wantMetrics = append(
+				wantMetrics,
+				fmt.Sprintf(
+					`%s{instance="%s",hostname="%s",maj_min="%s",name="%s"} 0 %d`,
+					PROC_DISKSTATS_INFO_METRIC, instance, hostname, "7:0", devNames["7:0"], scanPromTs,
+				),
+				fmt.Sprintf("%s0 %d", loop0BlockInfoMetric, scanPromTs),
+			)
+		}
+		testMetricsQueue.GenerateReport(wantMetrics, false, errBuf)
+		if _, ok := pdsm.diskstatsMetricsInfo["7:0"]; scan > 1 && ok {
+			fmt.Fprintf(errBuf, "\ndiskstatsMetricsInfo: unexpected %q", "7:0")
+		}
+		if errBuf.Len() > 0 {
+			t.Fatalf("scan# %d:%s", scan, errBuf)
+		}
+		if scan == 1 {
+			pdsm.diskstatsMetricsInfo["7:0"].blockInfoMetric = []byte(loop0BlockInfoMetric)
+		}
+	}
+}
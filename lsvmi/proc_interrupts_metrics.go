@@ -33,6 +33,10 @@ const (
 	PROC_INTERRUPTS_INFO_HW_INTERRUPT_LABEL_NAME = "hw_interrupt"
 	PROC_INTERRUPTS_INFO_DEV_LABEL_NAME          = PROC_INTERRUPTS_DEV_LABEL_NAME
 
+	// The number of IRQs excluded via include/exclude filters, generated only
+	// if filters are defined:
+	PROC_INTERRUPTS_EXCLUDED_COUNT_METRIC = "proc_interrupts_excluded_count"
+
 	// Interval since last generation, i.e. the interval underlying the deltas.
 	// Normally this should be close to scan interval, but this is the actual
 	// value, rather than the desired one:
@@ -48,6 +52,14 @@ type ProcInterruptsMetricsConfig struct {
 	// the previous scan. However every N cycles the full set is generated. Use
 	// 0 to generate full metrics every cycle.
 	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The list of regexps to include, matched against the IRQ (e.g. `0`, `NMI`)
+	// and the device(s) (e.g. `timer`); the regexps should match the entire
+	// value. If not defined/empty then all are included:
+	IncludeIrqs []string `yaml:"include_irqs"`
+	// The list of regexps to exclude, same matching as above; if not
+	// defined/empty then none is excluded. Exclude takes precedence over
+	// include.
+	ExcludeIrqs []string `yaml:"exclude_irqs"`
 }
 
 func DefaultProcInterruptsMetricsConfig() *ProcInterruptsMetricsConfig {
@@ -93,6 +105,8 @@ type ProcInterruptsMetrics struct {
 
 	// Data indexed by IRQ:
 	irqDataCache map[string]*ProcInterruptsMetricsIrqData
+	// IRQ filter, nil if no filtering:
+	irqFilter *ItemFilter
 
 	// Delta metrics suffix cache (CPU#), indexed by counter#:
 	//              ... cpu="CPU"} `
@@ -141,9 +155,20 @@ func NewProcInterruptsMetrics(cfg any) (*ProcInterruptsMetrics, error) {
 		tsSuffixBuf:       &bytes.Buffer{},
 	}
 
+	procInterruptsMetrics.irqFilter, err = NewItemFilter(
+		procInterruptsMetricsCfg.IncludeIrqs,
+		procInterruptsMetricsCfg.ExcludeIrqs,
+		procInterruptsMetrics.fullMetricsFactor,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("NewProcInterruptsMetrics: include/exclude_irqs: %v", err)
+	}
+
 	procInterruptsMetricsLog.Infof("id=%s", procInterruptsMetrics.id)
 	procInterruptsMetricsLog.Infof("interval=%s", procInterruptsMetrics.interval)
 	procInterruptsMetricsLog.Infof("full_metrics_factor=%d", procInterruptsMetrics.fullMetricsFactor)
+	procInterruptsMetricsLog.Infof("include_irqs=%q", procInterruptsMetricsCfg.IncludeIrqs)
+	procInterruptsMetricsLog.Infof("exclude_irqs=%q", procInterruptsMetricsCfg.ExcludeIrqs)
 	return procInterruptsMetrics, nil
 }
 
@@ -262,6 +287,9 @@ func (pim *ProcInterruptsMetrics) updateIntervalMetricsCache() {
 		INSTANCE_LABEL_NAME, instance,
 		HOSTNAME_LABEL_NAME, hostname,
 	))
+	if pim.irqFilter != nil {
+		pim.irqFilter.updateCountMetric(PROC_INTERRUPTS_EXCLUDED_COUNT_METRIC, instance, hostname)
+	}
 }
 
 func (pim *ProcInterruptsMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
@@ -292,15 +320,18 @@ func (pim *ProcInterruptsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 		}
 
 		for irq, currCounters := range currProcInterrupts.Counters {
+			currIrqInfo := currInfo.IrqInfo[irq]
+			irqData := pim.irqDataCache[irq]
+			if irqData == nil && pim.irqFilter.exclude(irq, irq, string(currIrqInfo.Devices)) {
+				continue
+			}
+
 			prevCounters := prevProcInterrupts.Counters[irq]
 			if prevCounters == nil {
 				// This is a new IRQ, no deltas for it:
 				continue
 			}
 
-			currIrqInfo := currInfo.IrqInfo[irq]
-
-			irqData := pim.irqDataCache[irq]
 			fullMetrics := irqData == nil || // 1st time IRQ
 				currIrqInfo.Changed || // something changed
 				irqData.cycleNum == 0 // regular full cycle
@@ -311,6 +342,15 @@ func (pim *ProcInterruptsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 			} else if currIrqInfo.Changed {
 				// Info changed, may have to 0 the previous info metric:
 				prevInfoMetric = irqData.infoMetric
+				if pim.irqFilter.exclude(irq, irq, string(currIrqInfo.Devices)) {
+					// The IRQ is excluded under its new info:
+					buf.Write(prevInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+					delete(pim.irqDataCache, irq)
+					continue
+				}
 				irqData = pim.updateIrqDataCache(irq)
 			}
 
@@ -366,7 +406,8 @@ func (pim *ProcInterruptsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 		}
 
 		// Clear info for removed IRQ's, if any:
-		if len(pim.irqDataCache) != len(currInfo.IrqInfo) {
+		pruneExcludedItems(pim.irqFilter, currProcInterrupts.Counters)
+		if len(pim.irqDataCache)+pim.irqFilter.excludedCount() != len(currInfo.IrqInfo) {
 			for irq, prevIrqData := range pim.irqDataCache {
 				if _, ok := currProcInterrupts.Counters[irq]; !ok {
 					buf.Write(prevIrqData.infoMetric)
@@ -386,13 +427,20 @@ func (pim *ProcInterruptsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 		buf.WriteString(strconv.FormatFloat(deltaSec, 'f', 6, 64))
 		buf.Write(promTs)
 		actualMetricsCount++
+
+		actualMetricsCount += pim.irqFilter.generateCountMetric(buf, promTs, pim.fullMetricsFactor)
 	}
 
 	// The total number of metrics:
 	//		delta metrics#: number of IRQs * number of counter
 	//		info metrics#:  number of IRQs
 	//		interval metric#: 1
-	totalMetricsCount := len(currProcInterrupts.Counters)*(currProcInterrupts.NumCounters+1) + 1
+	//		excluded count metric#: 1 if filtering
+	numIrqs := len(currProcInterrupts.Counters) - pim.irqFilter.excludedCount()
+	totalMetricsCount := numIrqs*(currProcInterrupts.NumCounters+1) + 1
+	if pim.irqFilter != nil {
+		totalMetricsCount++
+	}
 
 	// Toggle the buffers:
 	pim.currIndex = 1 - pim.currIndex
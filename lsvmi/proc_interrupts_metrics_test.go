@@ -248,3 +248,70 @@ func TestProcInterruptsMetrics(t *testing.T) {
 		)
 	}
 }
+
+func TestProcInterruptsMetricsFilter(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	procInterruptsMetricsCfg := DefaultProcInterruptsMetricsConfig()
+	procInterruptsMetricsCfg.ExcludeIrqs = []string{`NMI`, `virtio.*`}
+	procInterruptsMetrics, err := NewProcInterruptsMetrics(procInterruptsMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procInterruptsMetrics.instance = instance
+	procInterruptsMetrics.hostname = hostname
+
+	// IRQ 0 is included, NMI is excluded by IRQ, 24 by device:
+	prevInterrupts := procfs.NewInterrupts("")
+	prevInterrupts.NumCounters = 2
+	for irq, devices := range map[string]string{"0": "timer", "NMI": "", "24": "virtio0-input.0"} {
+		prevInterrupts.Counters[irq] = make([]uint64, prevInterrupts.NumCounters)
+		prevInterrupts.Info.IrqInfo[irq] = &procfs.InterruptsIrqInfo{Devices: []byte(devices)}
+	}
+	currInterrupts := prevInterrupts.Clone(true)
+
+	currIndex := procInterruptsMetrics.currIndex
+	procInterruptsMetrics.procInterrupts[currIndex] = currInterrupts
+	procInterruptsMetrics.procInterruptsTs[currIndex] = time.UnixMilli(currPromTs)
+	procInterruptsMetrics.procInterrupts[1-currIndex] = prevInterrupts
+	procInterruptsMetrics.procInterruptsTs[1-currIndex] = time.UnixMilli(prevPromTs)
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, gotTotalMetricsCount := procInterruptsMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+	// IRQ 0: 2 deltas + info, + interval + excluded count:
+	wantMetricsCount := (2 + 1) + 1 + 1
+	if wantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(errBuf, "\nmetrics count: want: %d, got: %d", wantMetricsCount, gotMetricsCount)
+	}
+	if wantMetricsCount != gotTotalMetricsCount {
+		fmt.Fprintf(errBuf, "\ntotal metrics count: want: %d, got: %d", wantMetricsCount, gotTotalMetricsCount)
+	}
+	for _, irq := range []string{"NMI", "24"} {
+		if _, ok := procInterruptsMetrics.irqDataCache[irq]; ok {
+			fmt.Fprintf(errBuf, "\nirqDataCache: unexpected %q", irq)
+		}
+	}
+	wantMetrics := []string{
+		fmt.Sprintf(
+			`proc_interrupts_metrics_delta_sec{instance="%s",hostname="%s"} 5.000000 %d`,
+			instance, hostname, currPromTs,
+		),
+		fmt.Sprintf(
+			`proc_interrupts_excluded_count{instance="%s",hostname="%s"} 2 %d`,
+			instance, hostname, currPromTs,
+		),
+	}
+	testMetricsQueue.GenerateReport(wantMetrics, false, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
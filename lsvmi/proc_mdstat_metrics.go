@@ -0,0 +1,470 @@
+// Software RAID (md) metrics based on /proc/mdstat
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	PROC_MDSTAT_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	PROC_MDSTAT_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+
+	// This generator id:
+	PROC_MDSTAT_METRICS_ID = "proc_mdstat_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",name="md0",state="active",level="raid1",mode=""}:
+	PROC_MDSTAT_INFO_METRIC = "proc_mdstat_info"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",name="md0"}:
+	PROC_MDSTAT_SIZE_KIB_METRIC       = "proc_mdstat_size_kib"
+	PROC_MDSTAT_TOTAL_DISKS_METRIC    = "proc_mdstat_total_disks"
+	PROC_MDSTAT_ACTIVE_DISKS_METRIC   = "proc_mdstat_active_disks"
+	PROC_MDSTAT_FAILED_DISKS_METRIC   = "proc_mdstat_failed_disks"
+	PROC_MDSTAT_SPARE_DISKS_METRIC    = "proc_mdstat_spare_disks"
+	PROC_MDSTAT_DEGRADED_DISKS_METRIC = "proc_mdstat_degraded_disks"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",name="md0",action="resync",status="running"}:
+	PROC_MDSTAT_SYNC_INFO_METRIC = "proc_mdstat_sync_info"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",name="md0"}:
+	PROC_MDSTAT_SYNC_PCT_METRIC         = "proc_mdstat_sync_pct"
+	PROC_MDSTAT_SYNC_SPEED_KIBPS_METRIC = "proc_mdstat_sync_speed_kibps"
+	PROC_MDSTAT_SYNC_ETA_SEC_METRIC     = "proc_mdstat_sync_eta_sec"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",name="md0",member="sda1",role="0",state="active"}:
+	PROC_MDSTAT_MEMBER_INFO_METRIC = "proc_mdstat_member_info"
+
+	PROC_MDSTAT_NAME_LABEL_NAME         = "name"
+	PROC_MDSTAT_STATE_LABEL_NAME        = "state"
+	PROC_MDSTAT_LEVEL_LABEL_NAME        = "level"
+	PROC_MDSTAT_MODE_LABEL_NAME         = "mode"
+	PROC_MDSTAT_SYNC_ACTION_LABEL_NAME  = "action"
+	PROC_MDSTAT_SYNC_STATUS_LABEL_NAME  = "status"
+	PROC_MDSTAT_MEMBER_LABEL_NAME       = "member"
+	PROC_MDSTAT_MEMBER_ROLE_LABEL_NAME  = "role"
+	PROC_MDSTAT_MEMBER_STATE_LABEL_NAME = "state"
+
+	PROC_MDSTAT_SYNC_PCT_METRIC_PREC = 1
+)
+
+// The per array gauge metrics, in the order in which they are generated:
+const (
+	PROC_MDSTAT_SIZE_KIB = iota
+	PROC_MDSTAT_TOTAL_DISKS
+	PROC_MDSTAT_ACTIVE_DISKS
+	PROC_MDSTAT_FAILED_DISKS
+	PROC_MDSTAT_SPARE_DISKS
+	PROC_MDSTAT_DEGRADED_DISKS
+	PROC_MDSTAT_SYNC_PCT
+	PROC_MDSTAT_SYNC_SPEED_KIBPS
+	PROC_MDSTAT_SYNC_ETA_SEC
+
+	// Must be last:
+	PROC_MDSTAT_NUM_GAUGES
+)
+
+var procMdstatGaugeMetricNames = []string{
+	PROC_MDSTAT_SIZE_KIB:         PROC_MDSTAT_SIZE_KIB_METRIC,
+	PROC_MDSTAT_TOTAL_DISKS:      PROC_MDSTAT_TOTAL_DISKS_METRIC,
+	PROC_MDSTAT_ACTIVE_DISKS:     PROC_MDSTAT_ACTIVE_DISKS_METRIC,
+	PROC_MDSTAT_FAILED_DISKS:     PROC_MDSTAT_FAILED_DISKS_METRIC,
+	PROC_MDSTAT_SPARE_DISKS:      PROC_MDSTAT_SPARE_DISKS_METRIC,
+	PROC_MDSTAT_DEGRADED_DISKS:   PROC_MDSTAT_DEGRADED_DISKS_METRIC,
+	PROC_MDSTAT_SYNC_PCT:         PROC_MDSTAT_SYNC_PCT_METRIC,
+	PROC_MDSTAT_SYNC_SPEED_KIBPS: PROC_MDSTAT_SYNC_SPEED_KIBPS_METRIC,
+	PROC_MDSTAT_SYNC_ETA_SEC:     PROC_MDSTAT_SYNC_ETA_SEC_METRIC,
+}
+
+var procMdstatMetricsLog = NewCompLogger(PROC_MDSTAT_METRICS_ID)
+
+type ProcMdstatMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultProcMdstatMetricsConfig() *ProcMdstatMetricsConfig {
+	return &ProcMdstatMetricsConfig{
+		Interval:          PROC_MDSTAT_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: PROC_MDSTAT_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+// Per array metrics cache:
+type ProcMdstatMetricsInfo struct {
+	// Pseudo-categorical metrics, w/ value, they are cleared (0) when the
+	// labels change or when the array disappears:
+	infoMetric, syncInfoMetric []byte
+	// Member info metrics, indexed by member device:
+	memberInfoMetrics map[string][]byte
+
+	// Gauge metrics, w/o value, indexed by PROC_MDSTAT_...:
+	gaugeMetrics [][]byte
+	// Previous values, as formatted, used for change detection:
+	prevGaugeVals []string
+}
+
+type ProcMdstatMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The parser; the file is re-parsed only if its content changed, so there
+	// is no need for prev, curr storage:
+	mdstat *procfs.Mdstat
+
+	// Per array metrics cache, indexed by array name:
+	arrayInfoMap map[string]*ProcMdstatMetricsInfo
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+}
+
+func NewProcMdstatMetrics(cfg any) (*ProcMdstatMetrics, error) {
+	var (
+		err                  error
+		procMdstatMetricsCfg *ProcMdstatMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		procMdstatMetricsCfg = cfg.ProcMdstatMetricsConfig
+	case *ProcMdstatMetricsConfig:
+		procMdstatMetricsCfg = cfg
+	case nil:
+		procMdstatMetricsCfg = DefaultProcMdstatMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewProcMdstatMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(procMdstatMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	procMdstatMetrics := &ProcMdstatMetrics{
+		id:                PROC_MDSTAT_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: procMdstatMetricsCfg.FullMetricsFactor,
+		arrayInfoMap:      make(map[string]*ProcMdstatMetricsInfo),
+		cycleNum:          initialCycleNum.Get(procMdstatMetricsCfg.FullMetricsFactor),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	procMdstatMetricsLog.Infof("id=%s", procMdstatMetrics.id)
+	procMdstatMetricsLog.Infof("interval=%s", procMdstatMetrics.interval)
+	procMdstatMetricsLog.Infof("full_metrics_factor=%d", procMdstatMetrics.fullMetricsFactor)
+	return procMdstatMetrics, nil
+}
+
+func (pmm *ProcMdstatMetrics) newArrayInfo(name string) *ProcMdstatMetricsInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pmm.instance != "" {
+		instance = pmm.instance
+	}
+	if pmm.hostname != "" {
+		hostname = pmm.hostname
+	}
+	arrayInfo := &ProcMdstatMetricsInfo{
+		memberInfoMetrics: make(map[string][]byte),
+		gaugeMetrics:      make([][]byte, PROC_MDSTAT_NUM_GAUGES),
+		prevGaugeVals:     make([]string, PROC_MDSTAT_NUM_GAUGES),
+	}
+	for index, metricName := range procMdstatGaugeMetricNames {
+		arrayInfo.gaugeMetrics[index] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			metricName,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			PROC_MDSTAT_NAME_LABEL_NAME, name,
+		))
+	}
+	return arrayInfo
+}
+
+// Build the info metrics, w/o value:
+func (pmm *ProcMdstatMetrics) buildInfoMetric(array *procfs.MdstatArray) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pmm.instance != "" {
+		instance = pmm.instance
+	}
+	if pmm.hostname != "" {
+		hostname = pmm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_MDSTAT_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_MDSTAT_NAME_LABEL_NAME, array.Name,
+		PROC_MDSTAT_STATE_LABEL_NAME, array.State,
+		PROC_MDSTAT_LEVEL_LABEL_NAME, array.Level,
+		PROC_MDSTAT_MODE_LABEL_NAME, array.Mode,
+	))
+}
+
+func (pmm *ProcMdstatMetrics) buildSyncInfoMetric(array *procfs.MdstatArray) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pmm.instance != "" {
+		instance = pmm.instance
+	}
+	if pmm.hostname != "" {
+		hostname = pmm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_MDSTAT_SYNC_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_MDSTAT_NAME_LABEL_NAME, array.Name,
+		PROC_MDSTAT_SYNC_ACTION_LABEL_NAME, array.SyncAction,
+		PROC_MDSTAT_SYNC_STATUS_LABEL_NAME, array.SyncStatus,
+	))
+}
+
+func (pmm *ProcMdstatMetrics) buildMemberInfoMetric(array *procfs.MdstatArray, member *procfs.MdstatMember) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pmm.instance != "" {
+		instance = pmm.instance
+	}
+	if pmm.hostname != "" {
+		hostname = pmm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%d",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_MDSTAT_MEMBER_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_MDSTAT_NAME_LABEL_NAME, array.Name,
+		PROC_MDSTAT_MEMBER_LABEL_NAME, member.Dev,
+		PROC_MDSTAT_MEMBER_ROLE_LABEL_NAME, member.Role,
+		PROC_MDSTAT_MEMBER_STATE_LABEL_NAME, member.State,
+	))
+}
+
+// Generate a pseudo-categorical metric: if the previous one is different, then
+// clear it (0) first. Return the number of generated metrics.
+func generateProcMdstatInfoMetric(buf *bytes.Buffer, prevMetric, metric []byte, promTs []byte) int {
+	count := 0
+	if prevMetric != nil && !bytes.Equal(prevMetric, metric) {
+		buf.Write(prevMetric)
+		buf.WriteByte('0')
+		buf.Write(promTs)
+		count++
+	}
+	buf.Write(metric)
+	buf.WriteByte('1')
+	buf.Write(promTs)
+	return count + 1
+}
+
+func (pmm *ProcMdstatMetrics) generateMetrics(buf *bytes.Buffer, ts time.Time) (int, int) {
+	mdstat := pmm.mdstat
+
+	actualMetricsCount := 0
+	pmm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		pmm.tsSuffixBuf, " %d\n", ts.UnixMilli(),
+	)
+	promTs := pmm.tsSuffixBuf.Bytes()
+
+	fullMetrics := pmm.cycleNum == 0
+	totalMetricsCount := 0
+
+	gaugeVals := make([]string, PROC_MDSTAT_NUM_GAUGES)
+	for name, array := range mdstat.Arrays {
+		arrayInfo := pmm.arrayInfoMap[name]
+		if arrayInfo == nil {
+			arrayInfo = pmm.newArrayInfo(name)
+			pmm.arrayInfoMap[name] = arrayInfo
+		}
+
+		// The metrics depend solely on the file content, so nothing to do if
+		// unchanged, save for full cycles:
+		if mdstat.Changed || fullMetrics {
+			// Info metrics, generated if they changed or for full cycles:
+			infoMetric := pmm.buildInfoMetric(array)
+			if fullMetrics || !bytes.Equal(arrayInfo.infoMetric, infoMetric) {
+				actualMetricsCount += generateProcMdstatInfoMetric(buf, arrayInfo.infoMetric, infoMetric, promTs)
+				arrayInfo.infoMetric = infoMetric
+			}
+			syncInfoMetric := pmm.buildSyncInfoMetric(array)
+			if fullMetrics || !bytes.Equal(arrayInfo.syncInfoMetric, syncInfoMetric) {
+				actualMetricsCount += generateProcMdstatInfoMetric(buf, arrayInfo.syncInfoMetric, syncInfoMetric, promTs)
+				arrayInfo.syncInfoMetric = syncInfoMetric
+			}
+			memberInfoMetrics := make(map[string][]byte, len(array.Members))
+			for _, member := range array.Members {
+				memberInfoMetric := pmm.buildMemberInfoMetric(array, member)
+				prevMemberInfoMetric := arrayInfo.memberInfoMetrics[member.Dev]
+				if fullMetrics || !bytes.Equal(prevMemberInfoMetric, memberInfoMetric) {
+					actualMetricsCount += generateProcMdstatInfoMetric(buf, prevMemberInfoMetric, memberInfoMetric, promTs)
+				}
+				memberInfoMetrics[member.Dev] = memberInfoMetric
+			}
+			// Clear out of scope members:
+			for dev, memberInfoMetric := range arrayInfo.memberInfoMetrics {
+				if _, ok := memberInfoMetrics[dev]; !ok {
+					buf.Write(memberInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+			}
+			arrayInfo.memberInfoMetrics = memberInfoMetrics
+
+			// Gauges, generated if they changed or for full cycles:
+			gaugeVals[PROC_MDSTAT_SIZE_KIB] = strconv.FormatUint(array.Blocks, 10)
+			gaugeVals[PROC_MDSTAT_TOTAL_DISKS] = strconv.Itoa(array.TotalDisks)
+			gaugeVals[PROC_MDSTAT_ACTIVE_DISKS] = strconv.Itoa(array.ActiveDisks)
+			gaugeVals[PROC_MDSTAT_FAILED_DISKS] = strconv.Itoa(array.FailedDisks)
+			gaugeVals[PROC_MDSTAT_SPARE_DISKS] = strconv.Itoa(array.SpareDisks)
+			degradedDisks := 0
+			if array.State == "active" && array.TotalDisks > array.ActiveDisks {
+				degradedDisks = array.TotalDisks - array.ActiveDisks
+			}
+			gaugeVals[PROC_MDSTAT_DEGRADED_DISKS] = strconv.Itoa(degradedDisks)
+			gaugeVals[PROC_MDSTAT_SYNC_PCT] = strconv.FormatFloat(array.SyncPct, 'f', PROC_MDSTAT_SYNC_PCT_METRIC_PREC, 64)
+			gaugeVals[PROC_MDSTAT_SYNC_SPEED_KIBPS] = strconv.FormatFloat(array.SyncSpeedKiBps, 'f', -1, 64)
+			gaugeVals[PROC_MDSTAT_SYNC_ETA_SEC] = strconv.FormatFloat(array.SyncFinishSec, 'f', 0, 64)
+			for index, val := range gaugeVals {
+				if fullMetrics || val != arrayInfo.prevGaugeVals[index] {
+					buf.Write(arrayInfo.gaugeMetrics[index])
+					buf.WriteString(val)
+					buf.Write(promTs)
+					actualMetricsCount++
+					arrayInfo.prevGaugeVals[index] = val
+				}
+			}
+		}
+
+		// The total number of metrics:
+		//		info metrics#: 2 (info, sync info) + (number of members)
+		//		gauge metrics#: number of gauges
+		totalMetricsCount += 2 + len(array.Members) + PROC_MDSTAT_NUM_GAUGES
+	}
+
+	// Arrays may be stopped, clear the info metrics for out of scope ones:
+	if len(pmm.arrayInfoMap) > len(mdstat.Arrays) {
+		for name, arrayInfo := range pmm.arrayInfoMap {
+			if _, ok := mdstat.Arrays[name]; ok {
+				continue
+			}
+			for _, metric := range [][]byte{arrayInfo.infoMetric, arrayInfo.syncInfoMetric} {
+				if metric != nil {
+					buf.Write(metric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+			}
+			for _, memberInfoMetric := range arrayInfo.memberInfoMetrics {
+				buf.Write(memberInfoMetric)
+				buf.WriteByte('0')
+				buf.Write(promTs)
+				actualMetricsCount++
+			}
+			delete(pmm.arrayInfoMap, name)
+		}
+	}
+
+	if pmm.cycleNum++; pmm.cycleNum >= pmm.fullMetricsFactor {
+		pmm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (pmm *ProcMdstatMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if pmm.timeNowFn != nil {
+		timeNowFn = pmm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if pmm.metricsQueue != nil {
+		metricsQueue = pmm.metricsQueue
+	}
+
+	if pmm.mdstat == nil {
+		procfsRoot := GlobalProcfsRoot
+		if pmm.procfsRoot != "" {
+			procfsRoot = pmm.procfsRoot
+		}
+		pmm.mdstat = procfs.NewMdstat(procfsRoot)
+	}
+	err := pmm.mdstat.Parse()
+	if err != nil {
+		procMdstatMetricsLog.Warnf("%v: proc mdstat metrics will be disabled", err)
+		return false
+	}
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := pmm.generateMetrics(buf, timeNowFn())
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		pmm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func ProcMdstatMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	pmm, err := NewProcMdstatMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if pmm.interval <= 0 {
+		procMdstatMetricsLog.Infof(
+			"interval=%s, metrics disabled", pmm.interval,
+		)
+		return nil, nil
+	}
+	// The file is available only if the md module is loaded:
+	mdstatPath := procfs.MdstatPath(GlobalProcfsRoot)
+	if _, err := os.Stat(mdstatPath); errors.Is(err, fs.ErrNotExist) {
+		procMdstatMetricsLog.Infof(
+			"%s not found, md module not loaded?, metrics disabled", mdstatPath,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(pmm.id, pmm.interval, pmm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(ProcMdstatMetricsTaskBuilder)
+}
@@ -0,0 +1,196 @@
+// Tests for proc_mdstat_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+// The test consists of a sequence of steps applied to the same generator, since
+// the metrics depend on the state built at the previous steps:
+type ProcMdstatMetricsTestStep struct {
+	Name             string
+	Arrays           map[string]*procfs.MdstatArray
+	Changed          bool
+	CycleNum         int
+	WantMetricsCount int
+	WantMetrics      []string
+}
+
+func testProcMdstatMetrics(steps []*ProcMdstatMetricsTestStep, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	procMdstatMetrics, err := NewProcMdstatMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procMdstatMetrics.instance = "lsvmi-test"
+	procMdstatMetrics.hostname = "lsvmi-test-host"
+	procMdstatMetrics.fullMetricsFactor = 3
+	currPromTs := int64(1_700_000_005_000)
+
+	for _, step := range steps {
+		procMdstatMetrics.mdstat = &procfs.Mdstat{
+			Arrays:  step.Arrays,
+			Changed: step.Changed,
+		}
+		procMdstatMetrics.cycleNum = step.CycleNum
+
+		testMetricsQueue := testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ := procMdstatMetrics.generateMetrics(buf, time.UnixMilli(currPromTs))
+		testMetricsQueue.QueueBuf(buf)
+
+		errBuf := &bytes.Buffer{}
+		if step.WantMetricsCount != gotMetricsCount {
+			fmt.Fprintf(
+				errBuf,
+				"\nmetrics count: want: %d, got: %d",
+				step.WantMetricsCount, gotMetricsCount,
+			)
+		}
+		testMetricsQueue.GenerateReport(step.WantMetrics, false, errBuf)
+		if errBuf.Len() > 0 {
+			t.Fatalf("step %q: %s", step.Name, errBuf)
+		}
+	}
+}
+
+func TestProcMdstatMetrics(t *testing.T) {
+	promTs := int64(1_700_000_005_000)
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+
+	newMd0 := func(sdbState string, action, status string, pct, speed, finish float64) *procfs.MdstatArray {
+		failed, active := 0, 2
+		if sdbState == procfs.MDSTAT_MEMBER_STATE_FAULTY {
+			failed, active = 1, 1
+		}
+		return &procfs.MdstatArray{
+			Name:        "md0",
+			State:       "active",
+			Level:       "raid1",
+			Blocks:      1046528,
+			TotalDisks:  2,
+			ActiveDisks: active,
+			FailedDisks: failed,
+			Members: []*procfs.MdstatMember{
+				{Dev: "sdb1", Role: 1, State: sdbState},
+				{Dev: "sda1", Role: 0, State: procfs.MDSTAT_MEMBER_STATE_ACTIVE},
+			},
+			SyncAction:     action,
+			SyncStatus:     status,
+			SyncPct:        pct,
+			SyncSpeedKiBps: speed,
+			SyncFinishSec:  finish,
+		}
+	}
+	md0Metrics := func(activeDisks, failedDisks, degradedDisks int, pct, speed, eta string) []string {
+		return []string{
+			fmt.Sprintf(`proc_mdstat_size_kib{%s,name="md0"} 1046528 %d`, labels, promTs),
+			fmt.Sprintf(`proc_mdstat_total_disks{%s,name="md0"} 2 %d`, labels, promTs),
+			fmt.Sprintf(`proc_mdstat_active_disks{%s,name="md0"} %d %d`, labels, activeDisks, promTs),
+			fmt.Sprintf(`proc_mdstat_failed_disks{%s,name="md0"} %d %d`, labels, failedDisks, promTs),
+			fmt.Sprintf(`proc_mdstat_spare_disks{%s,name="md0"} 0 %d`, labels, promTs),
+			fmt.Sprintf(`proc_mdstat_degraded_disks{%s,name="md0"} %d %d`, labels, degradedDisks, promTs),
+			fmt.Sprintf(`proc_mdstat_sync_pct{%s,name="md0"} %s %d`, labels, pct, promTs),
+			fmt.Sprintf(`proc_mdstat_sync_speed_kibps{%s,name="md0"} %s %d`, labels, speed, promTs),
+			fmt.Sprintf(`proc_mdstat_sync_eta_sec{%s,name="md0"} %s %d`, labels, eta, promTs),
+		}
+	}
+	md0Info := fmt.Sprintf(`proc_mdstat_info{%s,name="md0",state="active",level="raid1",mode=""}`, labels)
+	md0IdleSyncInfo := fmt.Sprintf(`proc_mdstat_sync_info{%s,name="md0",action="",status="idle"}`, labels)
+	md0RecoverySyncInfo := fmt.Sprintf(`proc_mdstat_sync_info{%s,name="md0",action="recovery",status="running"}`, labels)
+	sdb1ActiveInfo := fmt.Sprintf(`proc_mdstat_member_info{%s,name="md0",member="sdb1",role="1",state="active"}`, labels)
+	sdb1FaultyInfo := fmt.Sprintf(`proc_mdstat_member_info{%s,name="md0",member="sdb1",role="1",state="faulty"}`, labels)
+	sda1ActiveInfo := fmt.Sprintf(`proc_mdstat_member_info{%s,name="md0",member="sda1",role="0",state="active"}`, labels)
+
+	steps := []*ProcMdstatMetricsTestStep{
+		{
+			Name: "first_scan",
+			Arrays: map[string]*procfs.MdstatArray{
+				"md0": newMd0(procfs.MDSTAT_MEMBER_STATE_ACTIVE, "", procfs.MDSTAT_SYNC_STATUS_IDLE, 0, 0, 0),
+			},
+			Changed:          true,
+			CycleNum:         1,
+			WantMetricsCount: 13,
+			WantMetrics: append(
+				[]string{
+					fmt.Sprintf(`%s 1 %d`, md0Info, promTs),
+					fmt.Sprintf(`%s 1 %d`, md0IdleSyncInfo, promTs),
+					fmt.Sprintf(`%s 1 %d`, sdb1ActiveInfo, promTs),
+					fmt.Sprintf(`%s 1 %d`, sda1ActiveInfo, promTs),
+				},
+				md0Metrics(2, 0, 0, "0.0", "0", "0")...,
+			),
+		},
+		{
+			Name: "no_change",
+			Arrays: map[string]*procfs.MdstatArray{
+				"md0": newMd0(procfs.MDSTAT_MEMBER_STATE_ACTIVE, "", procfs.MDSTAT_SYNC_STATUS_IDLE, 0, 0, 0),
+			},
+			Changed:          false,
+			CycleNum:         2,
+			WantMetricsCount: 0,
+		},
+		{
+			Name: "degraded_recovery",
+			Arrays: map[string]*procfs.MdstatArray{
+				"md0": newMd0(procfs.MDSTAT_MEMBER_STATE_FAULTY, "recovery", procfs.MDSTAT_SYNC_STATUS_RUNNING, 8.5, 10240, 90),
+			},
+			Changed:          true,
+			CycleNum:         1,
+			WantMetricsCount: 10,
+			WantMetrics: []string{
+				fmt.Sprintf(`%s 0 %d`, md0IdleSyncInfo, promTs),
+				fmt.Sprintf(`%s 1 %d`, md0RecoverySyncInfo, promTs),
+				fmt.Sprintf(`%s 0 %d`, sdb1ActiveInfo, promTs),
+				fmt.Sprintf(`%s 1 %d`, sdb1FaultyInfo, promTs),
+				fmt.Sprintf(`proc_mdstat_active_disks{%s,name="md0"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`proc_mdstat_failed_disks{%s,name="md0"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`proc_mdstat_degraded_disks{%s,name="md0"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`proc_mdstat_sync_pct{%s,name="md0"} 8.5 %d`, labels, promTs),
+				fmt.Sprintf(`proc_mdstat_sync_speed_kibps{%s,name="md0"} 10240 %d`, labels, promTs),
+				fmt.Sprintf(`proc_mdstat_sync_eta_sec{%s,name="md0"} 90 %d`, labels, promTs),
+			},
+		},
+		{
+			Name: "full_cycle",
+			Arrays: map[string]*procfs.MdstatArray{
+				"md0": newMd0(procfs.MDSTAT_MEMBER_STATE_FAULTY, "recovery", procfs.MDSTAT_SYNC_STATUS_RUNNING, 8.5, 10240, 90),
+			},
+			Changed:          false,
+			CycleNum:         0,
+			WantMetricsCount: 13,
+			WantMetrics: append(
+				[]string{
+					fmt.Sprintf(`%s 1 %d`, md0Info, promTs),
+					fmt.Sprintf(`%s 1 %d`, md0RecoverySyncInfo, promTs),
+					fmt.Sprintf(`%s 1 %d`, sdb1FaultyInfo, promTs),
+					fmt.Sprintf(`%s 1 %d`, sda1ActiveInfo, promTs),
+				},
+				md0Metrics(1, 1, 1, "8.5", "10240", "90")...,
+			),
+		},
+		{
+			Name:             "array_stopped",
+			Arrays:           map[string]*procfs.MdstatArray{},
+			Changed:          true,
+			CycleNum:         1,
+			WantMetricsCount: 4,
+			WantMetrics: []string{
+				fmt.Sprintf(`%s 0 %d`, md0Info, promTs),
+				fmt.Sprintf(`%s 0 %d`, md0RecoverySyncInfo, promTs),
+				fmt.Sprintf(`%s 0 %d`, sdb1FaultyInfo, promTs),
+				fmt.Sprintf(`%s 0 %d`, sda1ActiveInfo, promTs),
+			},
+		},
+	}
+	testProcMdstatMetrics(steps, t)
+}
@@ -0,0 +1,611 @@
+// Network bonding metrics based on /proc/net/bonding/BOND
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	PROC_NET_BONDING_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	PROC_NET_BONDING_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+
+	// This generator id:
+	PROC_NET_BONDING_METRICS_ID = "proc_net_bonding_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",bond="bond0",mode="MODE"}:
+	PROC_NET_BONDING_INFO_METRIC = "proc_net_bonding_info"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",bond="bond0",dev="eth0"}:
+	PROC_NET_BONDING_ACTIVE_SLAVE_INFO_METRIC = "proc_net_bonding_active_slave_info"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",bond="bond0"}:
+	PROC_NET_BONDING_MII_UP_METRIC = "proc_net_bonding_mii_up"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",bond="bond0",aggregator_id="1",partner_mac="MAC"}:
+	PROC_NET_BONDING_LACP_INFO_METRIC = "proc_net_bonding_lacp_info"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",bond="bond0",dev="eth0"}:
+	PROC_NET_BONDING_SLAVE_MII_UP_METRIC             = "proc_net_bonding_slave_mii_up"
+	PROC_NET_BONDING_SLAVE_LINK_FAILURE_DELTA_METRIC = "proc_net_bonding_slave_link_failure_delta"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",bond="bond0",dev="eth0",aggregator_id="1",partner_mac="MAC"}:
+	PROC_NET_BONDING_SLAVE_LACP_INFO_METRIC = "proc_net_bonding_slave_lacp_info"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME"}:
+	PROC_NET_BONDING_INTERVAL_METRIC = "proc_net_bonding_metrics_delta_sec"
+
+	PROC_NET_BONDING_BOND_LABEL_NAME          = "bond"
+	PROC_NET_BONDING_MODE_LABEL_NAME          = "mode"
+	PROC_NET_BONDING_AGGREGATOR_ID_LABEL_NAME = "aggregator_id"
+	PROC_NET_BONDING_PARTNER_MAC_LABEL_NAME   = "partner_mac"
+	// Slave devices use the same label as proc_net_dev_metrics, to allow
+	// joins:
+	PROC_NET_BONDING_DEV_LABEL_NAME = PROC_NET_DEV_LABEL_NAME
+
+	// The MII status value that maps to 1, everything else maps to 0:
+	PROC_NET_BONDING_MII_STATUS_UP = "up"
+)
+
+var procNetBondingMetricsLog = NewCompLogger(PROC_NET_BONDING_METRICS_ID)
+
+type ProcNetBondingMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultProcNetBondingMetricsConfig() *ProcNetBondingMetricsConfig {
+	return &ProcNetBondingMetricsConfig{
+		Interval:          PROC_NET_BONDING_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: PROC_NET_BONDING_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+// Per slave metrics cache:
+type ProcNetBondingSlaveMetricsInfo struct {
+	// Gauge and delta metrics, w/o value:
+	miiUpMetric, linkFailureDeltaMetric []byte
+	// Previous values, used for change detection and deltas:
+	prevMiiUp            string
+	prevLinkFailureCount uint64
+	// Whether the previous link failure delta was zero or not:
+	zeroLinkFailureDelta bool
+	// Pseudo-categorical metric, w/ value, cleared (0) when the labels change
+	// or when the slave disappears:
+	lacpInfoMetric []byte
+	// The label values the pseudo-categorical metric was built for, used for
+	// change detection:
+	aggregatorId, partnerMac string
+	// The scan# when the slave was last found, used for detecting out-of-scope
+	// slaves:
+	scanNum uint64
+}
+
+// Per bond metrics cache:
+type ProcNetBondingMetricsInfo struct {
+	// Pseudo-categorical metrics, w/ value, they are cleared (0) when the
+	// labels change or when the bond disappears:
+	infoMetric, activeSlaveInfoMetric, lacpInfoMetric []byte
+	// The label values the pseudo-categorical metrics were built for, used for
+	// change detection:
+	mode, activeSlave, aggregatorId, partnerMac string
+	// Gauge metric, w/o value:
+	miiUpMetric []byte
+	// Previous value, used for change detection:
+	prevMiiUp string
+	// Slaves, indexed by device:
+	slaves map[string]*ProcNetBondingSlaveMetricsInfo
+}
+
+type ProcNetBondingMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The parser; the files are parsed into new objects at every scan, the
+	// previous values needed for deltas are kept in the metrics cache:
+	netBonding *procfs.NetBonding
+
+	// Per bond metrics cache, indexed by bond name:
+	bondInfoMap map[string]*ProcNetBondingMetricsInfo
+
+	// Scan#, used for detecting out-of-scope slaves:
+	scanNum uint64
+
+	// Timestamps of the current and previous scan:
+	currTs, prevTs time.Time
+
+	// Interval metric, w/o value; built on the first use:
+	intervalMetric []byte
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+}
+
+func NewProcNetBondingMetrics(cfg any) (*ProcNetBondingMetrics, error) {
+	var (
+		err                      error
+		procNetBondingMetricsCfg *ProcNetBondingMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		procNetBondingMetricsCfg = cfg.ProcNetBondingMetricsConfig
+	case *ProcNetBondingMetricsConfig:
+		procNetBondingMetricsCfg = cfg
+	case nil:
+		procNetBondingMetricsCfg = DefaultProcNetBondingMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewProcNetBondingMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(procNetBondingMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	procNetBondingMetrics := &ProcNetBondingMetrics{
+		id:                PROC_NET_BONDING_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: procNetBondingMetricsCfg.FullMetricsFactor,
+		bondInfoMap:       make(map[string]*ProcNetBondingMetricsInfo),
+		cycleNum:          initialCycleNum.Get(procNetBondingMetricsCfg.FullMetricsFactor),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	procNetBondingMetricsLog.Infof("id=%s", procNetBondingMetrics.id)
+	procNetBondingMetricsLog.Infof("interval=%s", procNetBondingMetrics.interval)
+	procNetBondingMetricsLog.Infof("full_metrics_factor=%d", procNetBondingMetrics.fullMetricsFactor)
+	return procNetBondingMetrics, nil
+}
+
+func (pnbm *ProcNetBondingMetrics) newBondInfo(name string) *ProcNetBondingMetricsInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pnbm.instance != "" {
+		instance = pnbm.instance
+	}
+	if pnbm.hostname != "" {
+		hostname = pnbm.hostname
+	}
+	return &ProcNetBondingMetricsInfo{
+		miiUpMetric: []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			PROC_NET_BONDING_MII_UP_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			PROC_NET_BONDING_BOND_LABEL_NAME, name,
+		)),
+		slaves: make(map[string]*ProcNetBondingSlaveMetricsInfo),
+	}
+}
+
+func (pnbm *ProcNetBondingMetrics) newSlaveInfo(bond *procfs.NetBond, slave *procfs.NetBondingSlave) *ProcNetBondingSlaveMetricsInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pnbm.instance != "" {
+		instance = pnbm.instance
+	}
+	if pnbm.hostname != "" {
+		hostname = pnbm.hostname
+	}
+	slaveInfo := &ProcNetBondingSlaveMetricsInfo{
+		prevLinkFailureCount: slave.LinkFailureCount,
+	}
+	slaveInfo.miiUpMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_NET_BONDING_SLAVE_MII_UP_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_NET_BONDING_BOND_LABEL_NAME, bond.Name,
+		PROC_NET_BONDING_DEV_LABEL_NAME, slave.Dev,
+	))
+	slaveInfo.linkFailureDeltaMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_NET_BONDING_SLAVE_LINK_FAILURE_DELTA_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_NET_BONDING_BOND_LABEL_NAME, bond.Name,
+		PROC_NET_BONDING_DEV_LABEL_NAME, slave.Dev,
+	))
+	return slaveInfo
+}
+
+// Build the info metrics, w/o value:
+func (pnbm *ProcNetBondingMetrics) buildInfoMetric(bond *procfs.NetBond) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pnbm.instance != "" {
+		instance = pnbm.instance
+	}
+	if pnbm.hostname != "" {
+		hostname = pnbm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_NET_BONDING_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_NET_BONDING_BOND_LABEL_NAME, bond.Name,
+		PROC_NET_BONDING_MODE_LABEL_NAME, bond.Mode,
+	))
+}
+
+func (pnbm *ProcNetBondingMetrics) buildActiveSlaveInfoMetric(bond *procfs.NetBond) []byte {
+	if bond.ActiveSlave == "" {
+		return nil
+	}
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pnbm.instance != "" {
+		instance = pnbm.instance
+	}
+	if pnbm.hostname != "" {
+		hostname = pnbm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_NET_BONDING_ACTIVE_SLAVE_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_NET_BONDING_BOND_LABEL_NAME, bond.Name,
+		PROC_NET_BONDING_DEV_LABEL_NAME, bond.ActiveSlave,
+	))
+}
+
+func (pnbm *ProcNetBondingMetrics) buildLacpInfoMetric(bond *procfs.NetBond) []byte {
+	if bond.AggregatorId == "" {
+		return nil
+	}
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pnbm.instance != "" {
+		instance = pnbm.instance
+	}
+	if pnbm.hostname != "" {
+		hostname = pnbm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_NET_BONDING_LACP_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_NET_BONDING_BOND_LABEL_NAME, bond.Name,
+		PROC_NET_BONDING_AGGREGATOR_ID_LABEL_NAME, bond.AggregatorId,
+		PROC_NET_BONDING_PARTNER_MAC_LABEL_NAME, bond.PartnerMac,
+	))
+}
+
+func (pnbm *ProcNetBondingMetrics) buildSlaveLacpInfoMetric(bond *procfs.NetBond, slave *procfs.NetBondingSlave) []byte {
+	if slave.AggregatorId == "" {
+		return nil
+	}
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pnbm.instance != "" {
+		instance = pnbm.instance
+	}
+	if pnbm.hostname != "" {
+		hostname = pnbm.hostname
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_NET_BONDING_SLAVE_LACP_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_NET_BONDING_BOND_LABEL_NAME, bond.Name,
+		PROC_NET_BONDING_DEV_LABEL_NAME, slave.Dev,
+		PROC_NET_BONDING_AGGREGATOR_ID_LABEL_NAME, slave.AggregatorId,
+		PROC_NET_BONDING_PARTNER_MAC_LABEL_NAME, slave.PartnerMac,
+	))
+}
+
+// Generate a pseudo-categorical metric: if its labels changed, then clear the
+// previous one (0) first. A nil metric indicates that the metric is no longer
+// applicable and only the clearing is performed. Return the number of generated
+// metrics.
+func generateProcNetBondingInfoMetric(buf *bytes.Buffer, prevMetric, metric []byte, promTs []byte, changed, fullMetrics bool) int {
+	count := 0
+	if changed && prevMetric != nil {
+		buf.Write(prevMetric)
+		buf.WriteByte('0')
+		buf.Write(promTs)
+		count++
+	}
+	if metric != nil && (changed || fullMetrics) {
+		buf.Write(metric)
+		buf.WriteByte('1')
+		buf.Write(promTs)
+		count++
+	}
+	return count
+}
+
+func procNetBondingMiiUpVal(miiStatus string) string {
+	if miiStatus == PROC_NET_BONDING_MII_STATUS_UP {
+		return "1"
+	}
+	return "0"
+}
+
+func (pnbm *ProcNetBondingMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	netBonding := pnbm.netBonding
+
+	actualMetricsCount := 0
+	pnbm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		pnbm.tsSuffixBuf, " %d\n", pnbm.currTs.UnixMilli(),
+	)
+	promTs := pnbm.tsSuffixBuf.Bytes()
+
+	fullMetrics := pnbm.cycleNum == 0
+	totalMetricsCount := 0
+	pnbm.scanNum++
+
+	for name, bond := range netBonding.Bonds {
+		bondInfo := pnbm.bondInfoMap[name]
+		if bondInfo == nil {
+			bondInfo = pnbm.newBondInfo(name)
+			pnbm.bondInfoMap[name] = bondInfo
+		}
+
+		// Info metrics, rebuilt only when their labels change and generated
+		// if they changed or for full cycles:
+		infoMetric := bondInfo.infoMetric
+		changed := infoMetric == nil || bond.Mode != bondInfo.mode
+		if changed {
+			infoMetric = pnbm.buildInfoMetric(bond)
+			bondInfo.mode = bond.Mode
+		}
+		actualMetricsCount += generateProcNetBondingInfoMetric(buf, bondInfo.infoMetric, infoMetric, promTs, changed, fullMetrics)
+		bondInfo.infoMetric = infoMetric
+		totalMetricsCount++
+
+		activeSlaveInfoMetric := bondInfo.activeSlaveInfoMetric
+		changed = bond.ActiveSlave != bondInfo.activeSlave
+		if changed {
+			activeSlaveInfoMetric = pnbm.buildActiveSlaveInfoMetric(bond)
+			bondInfo.activeSlave = bond.ActiveSlave
+		}
+		actualMetricsCount += generateProcNetBondingInfoMetric(buf, bondInfo.activeSlaveInfoMetric, activeSlaveInfoMetric, promTs, changed, fullMetrics)
+		bondInfo.activeSlaveInfoMetric = activeSlaveInfoMetric
+		if activeSlaveInfoMetric != nil {
+			totalMetricsCount++
+		}
+
+		lacpInfoMetric := bondInfo.lacpInfoMetric
+		changed = bond.AggregatorId != bondInfo.aggregatorId || bond.PartnerMac != bondInfo.partnerMac
+		if changed {
+			lacpInfoMetric = pnbm.buildLacpInfoMetric(bond)
+			bondInfo.aggregatorId, bondInfo.partnerMac = bond.AggregatorId, bond.PartnerMac
+		}
+		actualMetricsCount += generateProcNetBondingInfoMetric(buf, bondInfo.lacpInfoMetric, lacpInfoMetric, promTs, changed, fullMetrics)
+		bondInfo.lacpInfoMetric = lacpInfoMetric
+		if lacpInfoMetric != nil {
+			totalMetricsCount++
+		}
+
+		// MII status gauge, generated if it changed or for full cycles:
+		miiUp := procNetBondingMiiUpVal(bond.MiiStatus)
+		if fullMetrics || miiUp != bondInfo.prevMiiUp {
+			buf.Write(bondInfo.miiUpMetric)
+			buf.WriteString(miiUp)
+			buf.Write(promTs)
+			actualMetricsCount++
+			bondInfo.prevMiiUp = miiUp
+		}
+		totalMetricsCount++
+
+		// Slaves:
+		for _, slave := range bond.Slaves {
+			slaveInfo := bondInfo.slaves[slave.Dev]
+			// The link failure delta requires a previous value, so it cannot be
+			// generated for new slaves:
+			newSlave := slaveInfo == nil
+			if newSlave {
+				slaveInfo = pnbm.newSlaveInfo(bond, slave)
+				bondInfo.slaves[slave.Dev] = slaveInfo
+			}
+			slaveInfo.scanNum = pnbm.scanNum
+
+			miiUp := procNetBondingMiiUpVal(slave.MiiStatus)
+			if fullMetrics || miiUp != slaveInfo.prevMiiUp {
+				buf.Write(slaveInfo.miiUpMetric)
+				buf.WriteString(miiUp)
+				buf.Write(promTs)
+				actualMetricsCount++
+				slaveInfo.prevMiiUp = miiUp
+			}
+			totalMetricsCount++
+
+			if !newSlave {
+				// The count is reset if the slave is released and re-enslaved
+				// in between scans, so the delta is computed against 0:
+				delta := slave.LinkFailureCount
+				if delta >= slaveInfo.prevLinkFailureCount {
+					delta -= slaveInfo.prevLinkFailureCount
+				}
+				if delta != 0 || fullMetrics || !slaveInfo.zeroLinkFailureDelta {
+					buf.Write(slaveInfo.linkFailureDeltaMetric)
+					buf.WriteString(strconv.FormatUint(delta, 10))
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				slaveInfo.zeroLinkFailureDelta = delta == 0
+				totalMetricsCount++
+			}
+			slaveInfo.prevLinkFailureCount = slave.LinkFailureCount
+
+			slaveLacpInfoMetric := slaveInfo.lacpInfoMetric
+			changed = slave.AggregatorId != slaveInfo.aggregatorId || slave.PartnerMac != slaveInfo.partnerMac
+			if changed {
+				slaveLacpInfoMetric = pnbm.buildSlaveLacpInfoMetric(bond, slave)
+				slaveInfo.aggregatorId, slaveInfo.partnerMac = slave.AggregatorId, slave.PartnerMac
+			}
+			actualMetricsCount += generateProcNetBondingInfoMetric(buf, slaveInfo.lacpInfoMetric, slaveLacpInfoMetric, promTs, changed, fullMetrics)
+			slaveInfo.lacpInfoMetric = slaveLacpInfoMetric
+			if slaveLacpInfoMetric != nil {
+				totalMetricsCount++
+			}
+		}
+		// Slaves may be released, clear out-of-scope ones:
+		if len(bondInfo.slaves) > len(bond.Slaves) {
+			for dev, slaveInfo := range bondInfo.slaves {
+				if slaveInfo.scanNum == pnbm.scanNum {
+					continue
+				}
+				if slaveInfo.lacpInfoMetric != nil {
+					buf.Write(slaveInfo.lacpInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				delete(bondInfo.slaves, dev)
+			}
+		}
+	}
+
+	// Bonds may be deleted, clear the info metrics for out of scope ones:
+	if len(pnbm.bondInfoMap) > len(netBonding.Bonds) {
+		for name, bondInfo := range pnbm.bondInfoMap {
+			if _, ok := netBonding.Bonds[name]; ok {
+				continue
+			}
+			for _, metric := range [][]byte{bondInfo.infoMetric, bondInfo.activeSlaveInfoMetric, bondInfo.lacpInfoMetric} {
+				if metric != nil {
+					buf.Write(metric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+			}
+			for _, slaveInfo := range bondInfo.slaves {
+				if slaveInfo.lacpInfoMetric != nil {
+					buf.Write(slaveInfo.lacpInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+			}
+			delete(pnbm.bondInfoMap, name)
+		}
+	}
+
+	if !pnbm.prevTs.IsZero() {
+		if pnbm.intervalMetric == nil {
+			instance, hostname := GlobalInstance, GlobalHostname
+			if pnbm.instance != "" {
+				instance = pnbm.instance
+			}
+			if pnbm.hostname != "" {
+				hostname = pnbm.hostname
+			}
+			pnbm.intervalMetric = []byte(fmt.Sprintf(
+				`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+				PROC_NET_BONDING_INTERVAL_METRIC,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+			))
+		}
+		buf.Write(pnbm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(pnbm.currTs.Sub(pnbm.prevTs).Seconds(), 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+		totalMetricsCount++
+	}
+
+	if pnbm.cycleNum++; pnbm.cycleNum >= pnbm.fullMetricsFactor {
+		pnbm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (pnbm *ProcNetBondingMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if pnbm.timeNowFn != nil {
+		timeNowFn = pnbm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if pnbm.metricsQueue != nil {
+		metricsQueue = pnbm.metricsQueue
+	}
+
+	if pnbm.netBonding == nil {
+		procfsRoot := GlobalProcfsRoot
+		if pnbm.procfsRoot != "" {
+			procfsRoot = pnbm.procfsRoot
+		}
+		pnbm.netBonding = procfs.NewNetBonding(procfsRoot)
+	}
+	err := pnbm.netBonding.Parse()
+	if err != nil {
+		procNetBondingMetricsLog.Warnf("%v: proc net bonding metrics will be disabled", err)
+		return false
+	}
+	pnbm.prevTs, pnbm.currTs = pnbm.currTs, timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := pnbm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		pnbm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func ProcNetBondingMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	pnbm, err := NewProcNetBondingMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if pnbm.interval <= 0 {
+		procNetBondingMetricsLog.Infof(
+			"interval=%s, metrics disabled", pnbm.interval,
+		)
+		return nil, nil
+	}
+	// The directory is available only if the bonding module is loaded:
+	netBondingDirPath := procfs.NetBondingDirPath(GlobalProcfsRoot)
+	if _, err := os.Stat(netBondingDirPath); errors.Is(err, fs.ErrNotExist) {
+		procNetBondingMetricsLog.Infof(
+			"%s not found, bonding module not loaded?, metrics disabled", netBondingDirPath,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(pnbm.id, pnbm.interval, pnbm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(ProcNetBondingMetricsTaskBuilder)
+}
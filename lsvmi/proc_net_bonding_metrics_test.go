@@ -0,0 +1,234 @@
+// Tests for proc_net_bonding_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+// The test consists of a sequence of steps applied to the same generator, since
+// the metrics depend on the state built at the previous steps:
+type ProcNetBondingMetricsTestStep struct {
+	Name             string
+	Bonds            map[string]*procfs.NetBond
+	CycleNum         int
+	WantMetricsCount int
+	WantMetrics      []string
+}
+
+func testProcNetBondingMetrics(steps []*ProcNetBondingMetricsTestStep, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	procNetBondingMetrics, err := NewProcNetBondingMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procNetBondingMetrics.instance = "lsvmi-test"
+	procNetBondingMetrics.hostname = "lsvmi-test-host"
+	procNetBondingMetrics.fullMetricsFactor = 3
+	ts := time.UnixMilli(1_700_000_000_000)
+
+	for _, step := range steps {
+		procNetBondingMetrics.netBonding = &procfs.NetBonding{
+			Bonds: step.Bonds,
+		}
+		procNetBondingMetrics.cycleNum = step.CycleNum
+		procNetBondingMetrics.prevTs, procNetBondingMetrics.currTs = procNetBondingMetrics.currTs, ts
+
+		testMetricsQueue := testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ := procNetBondingMetrics.generateMetrics(buf)
+		testMetricsQueue.QueueBuf(buf)
+
+		errBuf := &bytes.Buffer{}
+		if step.WantMetricsCount != gotMetricsCount {
+			fmt.Fprintf(
+				errBuf,
+				"\nmetrics count: want: %d, got: %d",
+				step.WantMetricsCount, gotMetricsCount,
+			)
+		}
+		testMetricsQueue.GenerateReport(step.WantMetrics, true, errBuf)
+		if errBuf.Len() > 0 {
+			t.Fatalf("step %q: %s", step.Name, errBuf)
+		}
+		ts = ts.Add(5 * time.Second)
+	}
+}
+
+func TestProcNetBondingMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_000_000)
+
+	lacpMode := "IEEE 802.3ad Dynamic link aggregation"
+	abMode := "fault-tolerance (active-backup)"
+	partnerMac := "00:1c:73:aa:bb:cc"
+	noMac := "00:00:00:00:00:00"
+
+	newBond0 := func(eth0Lfc, eth1Lfc uint64, eth1Mii, eth1AggId, eth1Mac string) *procfs.NetBond {
+		return &procfs.NetBond{
+			Name:         "bond0",
+			Mode:         lacpMode,
+			MiiStatus:    "up",
+			AggregatorId: "1",
+			PartnerMac:   partnerMac,
+			Slaves: []*procfs.NetBondingSlave{
+				{Dev: "eth0", MiiStatus: "up", LinkFailureCount: eth0Lfc, AggregatorId: "1", PartnerMac: partnerMac},
+				{Dev: "eth1", MiiStatus: eth1Mii, LinkFailureCount: eth1Lfc, AggregatorId: eth1AggId, PartnerMac: eth1Mac},
+			},
+		}
+	}
+	newBond1 := func(activeSlave string) *procfs.NetBond {
+		bond := &procfs.NetBond{
+			Name:        "bond1",
+			Mode:        abMode,
+			MiiStatus:   "up",
+			ActiveSlave: activeSlave,
+			Slaves: []*procfs.NetBondingSlave{
+				{Dev: "eth2", MiiStatus: "up", LinkFailureCount: 0},
+				{Dev: "eth3", MiiStatus: "up", LinkFailureCount: 0},
+			},
+		}
+		if activeSlave == "" {
+			bond.MiiStatus = "down"
+		}
+		return bond
+	}
+
+	newBond0Eth0Only := func() *procfs.NetBond {
+		bond := newBond0(1, 4, "up", "1", partnerMac)
+		bond.Slaves = bond.Slaves[:1]
+		return bond
+	}
+
+	steps := []*ProcNetBondingMetricsTestStep{
+		{
+			Name: "initial",
+			Bonds: map[string]*procfs.NetBond{
+				"bond0": newBond0(1, 3, "down", "2", noMac),
+			},
+			CycleNum:         0,
+			WantMetricsCount: 7,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_net_bonding_info{%s,bond="bond0",mode="%s"} 1 %d`, labels, lacpMode, promTs),
+				fmt.Sprintf(`proc_net_bonding_lacp_info{%s,bond="bond0",aggregator_id="1",partner_mac="%s"} 1 %d`, labels, partnerMac, promTs),
+				fmt.Sprintf(`proc_net_bonding_mii_up{%s,bond="bond0"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond0",dev="eth0"} 1 %d`, labels, promTs),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth0",aggregator_id="1",partner_mac="%s"} 1 %d`, labels, partnerMac, promTs),
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond0",dev="eth1"} 0 %d`, labels, promTs),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth1",aggregator_id="2",partner_mac="%s"} 1 %d`, labels, noMac, promTs),
+			},
+		},
+		{
+			Name: "slave_recovered",
+			Bonds: map[string]*procfs.NetBond{
+				"bond0": newBond0(1, 4, "up", "1", partnerMac),
+				"bond1": newBond1("eth3"),
+			},
+			CycleNum:         1,
+			WantMetricsCount: 11,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_net_bonding_slave_link_failure_delta{%s,bond="bond0",dev="eth0"} 0 %d`, labels, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond0",dev="eth1"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_slave_link_failure_delta{%s,bond="bond0",dev="eth1"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth1",aggregator_id="2",partner_mac="%s"} 0 %d`, labels, noMac, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth1",aggregator_id="1",partner_mac="%s"} 1 %d`, labels, partnerMac, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_info{%s,bond="bond1",mode="%s"} 1 %d`, labels, abMode, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_active_slave_info{%s,bond="bond1",dev="eth3"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_mii_up{%s,bond="bond1"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond1",dev="eth2"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond1",dev="eth3"} 1 %d`, labels, promTs+5000),
+				fmt.Sprintf(`proc_net_bonding_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+5000),
+			},
+		},
+		{
+			Name: "no_change",
+			Bonds: map[string]*procfs.NetBond{
+				"bond0": newBond0(1, 4, "up", "1", partnerMac),
+				"bond1": newBond1("eth3"),
+			},
+			CycleNum:         2,
+			WantMetricsCount: 4,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_net_bonding_slave_link_failure_delta{%s,bond="bond0",dev="eth1"} 0 %d`, labels, promTs+10000),
+				fmt.Sprintf(`proc_net_bonding_slave_link_failure_delta{%s,bond="bond1",dev="eth2"} 0 %d`, labels, promTs+10000),
+				fmt.Sprintf(`proc_net_bonding_slave_link_failure_delta{%s,bond="bond1",dev="eth3"} 0 %d`, labels, promTs+10000),
+				fmt.Sprintf(`proc_net_bonding_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+10000),
+			},
+		},
+		{
+			Name: "bond_removed_no_active_slave",
+			Bonds: map[string]*procfs.NetBond{
+				"bond1": newBond1(""),
+			},
+			CycleNum:         1,
+			WantMetricsCount: 7,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_net_bonding_active_slave_info{%s,bond="bond1",dev="eth3"} 0 %d`, labels, promTs+15000),
+				fmt.Sprintf(`proc_net_bonding_mii_up{%s,bond="bond1"} 0 %d`, labels, promTs+15000),
+				fmt.Sprintf(`proc_net_bonding_info{%s,bond="bond0",mode="%s"} 0 %d`, labels, lacpMode, promTs+15000),
+				fmt.Sprintf(`proc_net_bonding_lacp_info{%s,bond="bond0",aggregator_id="1",partner_mac="%s"} 0 %d`, labels, partnerMac, promTs+15000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth0",aggregator_id="1",partner_mac="%s"} 0 %d`, labels, partnerMac, promTs+15000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth1",aggregator_id="1",partner_mac="%s"} 0 %d`, labels, partnerMac, promTs+15000),
+				fmt.Sprintf(`proc_net_bonding_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+15000),
+			},
+		},
+		{
+			Name: "bond_readded",
+			Bonds: map[string]*procfs.NetBond{
+				"bond0": newBond0(1, 4, "up", "1", partnerMac),
+				"bond1": newBond1(""),
+			},
+			CycleNum:         1,
+			WantMetricsCount: 8,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_net_bonding_info{%s,bond="bond0",mode="%s"} 1 %d`, labels, lacpMode, promTs+20000),
+				fmt.Sprintf(`proc_net_bonding_lacp_info{%s,bond="bond0",aggregator_id="1",partner_mac="%s"} 1 %d`, labels, partnerMac, promTs+20000),
+				fmt.Sprintf(`proc_net_bonding_mii_up{%s,bond="bond0"} 1 %d`, labels, promTs+20000),
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond0",dev="eth0"} 1 %d`, labels, promTs+20000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth0",aggregator_id="1",partner_mac="%s"} 1 %d`, labels, partnerMac, promTs+20000),
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond0",dev="eth1"} 1 %d`, labels, promTs+20000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth1",aggregator_id="1",partner_mac="%s"} 1 %d`, labels, partnerMac, promTs+20000),
+				fmt.Sprintf(`proc_net_bonding_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+20000),
+			},
+		},
+		{
+			Name: "slave_released",
+			Bonds: map[string]*procfs.NetBond{
+				"bond0": newBond0Eth0Only(),
+				"bond1": newBond1(""),
+			},
+			CycleNum:         1,
+			WantMetricsCount: 3,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_net_bonding_slave_link_failure_delta{%s,bond="bond0",dev="eth0"} 0 %d`, labels, promTs+25000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth1",aggregator_id="1",partner_mac="%s"} 0 %d`, labels, partnerMac, promTs+25000),
+				fmt.Sprintf(`proc_net_bonding_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+25000),
+			},
+		},
+		{
+			Name: "slave_reenslaved",
+			Bonds: map[string]*procfs.NetBond{
+				"bond0": newBond0(1, 4, "up", "1", partnerMac),
+				"bond1": newBond1(""),
+			},
+			CycleNum:         1,
+			WantMetricsCount: 3,
+			WantMetrics: []string{
+				// New slave, no link failure delta:
+				fmt.Sprintf(`proc_net_bonding_slave_mii_up{%s,bond="bond0",dev="eth1"} 1 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_net_bonding_slave_lacp_info{%s,bond="bond0",dev="eth1",aggregator_id="1",partner_mac="%s"} 1 %d`, labels, partnerMac, promTs+30000),
+				fmt.Sprintf(`proc_net_bonding_metrics_delta_sec{%s} 5.000000 %d`, labels, promTs+30000),
+			},
+		},
+	}
+
+	testProcNetBondingMetrics(steps, t)
+}
@@ -1,4 +1,4 @@
-// /proc/net/dev metrics
+// /proc/net/dev metrics, optionally augmented w/ /sys/class/net/DEV attributes
 
 package lsvmi
 
@@ -9,11 +9,14 @@ import (
 	"time"
 
 	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/sysfs"
 )
 
 const (
 	PROC_NET_DEV_METRICS_CONFIG_INTERVAL_DEFAULT            = "1s"
 	PROC_NET_DEV_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 15
+	PROC_NET_DEV_METRICS_CONFIG_SYSFS_ATTRIBUTES_DEFAULT    = true
+	PROC_NET_DEV_METRICS_CONFIG_UTIL_PCT_DEFAULT            = false
 
 	// This generator id:
 	PROC_NET_DEV_METRICS_ID = "proc_net_dev_metrics"
@@ -40,8 +43,34 @@ const (
 
 	PROC_NET_DEV_PRESENCE_METRIC = "proc_net_dev_present"
 
+	// The number of devices excluded via include/exclude filters, generated
+	// only if filters are defined:
+	PROC_NET_DEV_EXCLUDED_COUNT_METRIC = "proc_net_dev_excluded_count"
+
 	PROC_NET_DEV_LABEL_NAME = "dev"
 
+	// The following are based on /sys/class/net/DEV attributes, read for full
+	// cycles only:
+	//
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",dev="DEV",speed="SPEED",duplex="DUPLEX",mtu="MTU",operstate="OPERSTATE",type="TYPE"}:
+	PROC_NET_DEV_LINK_INFO_METRIC = "proc_net_dev_link_info"
+
+	PROC_NET_DEV_LINK_SPEED_LABEL_NAME     = "speed"
+	PROC_NET_DEV_LINK_DUPLEX_LABEL_NAME    = "duplex"
+	PROC_NET_DEV_LINK_MTU_LABEL_NAME       = "mtu"
+	PROC_NET_DEV_LINK_OPERSTATE_LABEL_NAME = "operstate"
+	PROC_NET_DEV_LINK_TYPE_LABEL_NAME      = "type"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",dev="DEV"}:
+	PROC_NET_DEV_CARRIER_CHANGES_DELTA_METRIC = "proc_net_dev_carrier_changes_delta"
+
+	// Utilization % of link speed, generated alongside the throughput metrics
+	// if enabled and if the link speed is known:
+	//
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",dev="DEV"}:
+	PROC_NET_DEV_RX_UTIL_PCT_METRIC = "proc_net_dev_rx_util_pct"
+	PROC_NET_DEV_TX_UTIL_PCT_METRIC = "proc_net_dev_tx_util_pct"
+
 	// Interval since last generation, i.e. the interval underlying the deltas.
 	// Normally this should be close to scan interval, but this is the actual
 	// value, rather than the desired one:
@@ -79,6 +108,19 @@ var procNetDevIndexRate = [procfs.NET_DEV_NUM_STATS]*ProcNetDevRate{
 	procfs.NET_DEV_TX_BYTES: {8. / 1000., 1},
 }
 
+// Map stats index into utilization % metrics names; the stats should have a
+// kbps rate in procNetDevIndexRate:
+var procNetDevIndexUtilPctMetricNameMap = map[int]string{
+	procfs.NET_DEV_RX_BYTES: PROC_NET_DEV_RX_UTIL_PCT_METRIC,
+	procfs.NET_DEV_TX_BYTES: PROC_NET_DEV_TX_UTIL_PCT_METRIC,
+}
+
+// The utilization % is (rate kbps) / (speed Mbps * 1000) * 100:
+const (
+	PROC_NET_DEV_UTIL_PCT_FACTOR = 100. / 1000.
+	PROC_NET_DEV_UTIL_PCT_PREC   = 2
+)
+
 var procNetDevMetricsLog = NewCompLogger(PROC_NET_DEV_METRICS_ID)
 
 type ProcNetDevMetricsConfig struct {
@@ -88,12 +130,26 @@ type ProcNetDevMetricsConfig struct {
 	// the previous scan. However every N cycles the full set is generated. Use
 	// 0 to generate full metrics every cycle.
 	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// Whether to read /sys/class/net/DEV/{speed,duplex,mtu,operstate,carrier_changes,type}
+	// for full cycles and to generate link info and carrier changes metrics:
+	SysfsAttributes bool `yaml:"sysfs_attributes"`
+	// Whether to generate rx/tx utilization % of the link speed. This requires
+	// sysfs_attributes and it applies only to devices reporting a speed:
+	UtilPct bool `yaml:"util_pct"`
+	// The list of device regexps to include; the regexps should match the
+	// entire device name. If not defined/empty then all are included:
+	IncludeDevices []string `yaml:"include_devices"`
+	// The list of device regexps to exclude; if not defined/empty then none
+	// is excluded. Exclude takes precedence over include.
+	ExcludeDevices []string `yaml:"exclude_devices"`
 }
 
 func DefaultProcNetDevMetricsConfig() *ProcNetDevMetricsConfig {
 	return &ProcNetDevMetricsConfig{
 		Interval:          PROC_NET_DEV_METRICS_CONFIG_INTERVAL_DEFAULT,
 		FullMetricsFactor: PROC_NET_DEV_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		SysfsAttributes:   PROC_NET_DEV_METRICS_CONFIG_SYSFS_ATTRIBUTES_DEFAULT,
+		UtilPct:           PROC_NET_DEV_METRICS_CONFIG_UTIL_PCT_DEFAULT,
 	}
 }
 
@@ -113,6 +169,21 @@ type ProcNetDevInfo struct {
 	// skipped, save for full cycles. Keep track of zero deltas, indexed by
 	// procfs.NET_DEV_...:
 	zeroDelta []bool
+
+	// The following are based on sysfs attributes:
+	//
+	// Link info metric, w/o value. It is rebuilt with every full cycle and if
+	// it changes, the previous one is cleared:
+	linkInfoMetric []byte
+	// Carrier changes delta metric:
+	carrierChangesDeltaMetric []byte
+	// The previous carrier changes, used for the delta:
+	prevCarrierChanges      uint64
+	prevCarrierChangesValid bool
+	// Utilization % metrics cache, indexed by procfs.NET_DEV_...:
+	utilPctMetrics [][]byte
+	// Link speed in Mbps, as of the most recent full cycle, <= 0 if unknown:
+	speed int64
 }
 
 type ProcNetDevMetrics struct {
@@ -125,6 +196,17 @@ type ProcNetDevMetrics struct {
 	// Full metric factor:
 	fullMetricsFactor int
 
+	// Whether to use /sys/class/net/DEV attributes and to generate utilization
+	// %:
+	sysfsAttributes bool
+	utilPct         bool
+
+	// Device filter, nil if no filtering:
+	devFilter *ItemFilter
+
+	// The sysfs attributes, indexed by device, parsed for full cycles only:
+	netClassDevMap map[string]*sysfs.NetClassDev
+
 	// Dual storage for parsed stats used as previous, current:
 	procNetDev [2]*procfs.NetDev
 	// Timestamp when the stats were collected:
@@ -150,6 +232,7 @@ type ProcNetDevMetrics struct {
 	timeNowFn          func() time.Time
 	metricsQueue       MetricsQueue
 	procfsRoot         string
+	sysfsRoot          string
 }
 
 func NewProcNetDevMetrics(cfg any) (*ProcNetDevMetrics, error) {
@@ -177,13 +260,29 @@ func NewProcNetDevMetrics(cfg any) (*ProcNetDevMetrics, error) {
 		id:                PROC_NET_DEV_METRICS_ID,
 		interval:          interval,
 		fullMetricsFactor: procNetDevMetricsCfg.FullMetricsFactor,
+		sysfsAttributes:   procNetDevMetricsCfg.SysfsAttributes,
+		utilPct:           procNetDevMetricsCfg.SysfsAttributes && procNetDevMetricsCfg.UtilPct,
+		netClassDevMap:    make(map[string]*sysfs.NetClassDev),
 		devInfoMap:        make(map[string]*ProcNetDevInfo),
 		tsSuffixBuf:       &bytes.Buffer{},
 	}
 
+	procNetDevMetrics.devFilter, err = NewItemFilter(
+		procNetDevMetricsCfg.IncludeDevices,
+		procNetDevMetricsCfg.ExcludeDevices,
+		procNetDevMetrics.fullMetricsFactor,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("NewProcNetDevMetrics: include/exclude_devices: %v", err)
+	}
+
 	procNetDevMetricsLog.Infof("id=%s", procNetDevMetrics.id)
 	procNetDevMetricsLog.Infof("interval=%s", procNetDevMetrics.interval)
 	procNetDevMetricsLog.Infof("full_metrics_factor=%d", procNetDevMetrics.fullMetricsFactor)
+	procNetDevMetricsLog.Infof("sysfs_attributes=%v", procNetDevMetrics.sysfsAttributes)
+	procNetDevMetricsLog.Infof("util_pct=%v", procNetDevMetrics.utilPct)
+	procNetDevMetricsLog.Infof("include_devices=%q", procNetDevMetricsCfg.IncludeDevices)
+	procNetDevMetricsLog.Infof("exclude_devices=%q", procNetDevMetricsCfg.ExcludeDevices)
 	return procNetDevMetrics, nil
 }
 
@@ -206,8 +305,33 @@ func (pndm *ProcNetDevMetrics) updateDevInfo(dev string) {
 			PROC_NET_DEV_LABEL_NAME, dev,
 		))
 	}
+	var carrierChangesDeltaMetric []byte
+	if pndm.sysfsAttributes {
+		carrierChangesDeltaMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			PROC_NET_DEV_CARRIER_CHANGES_DELTA_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			PROC_NET_DEV_LABEL_NAME, dev,
+		))
+	}
+	var utilPctMetrics [][]byte
+	if pndm.utilPct {
+		utilPctMetrics = make([][]byte, procfs.NET_DEV_NUM_STATS)
+		for index, name := range procNetDevIndexUtilPctMetricNameMap {
+			utilPctMetrics[index] = []byte(fmt.Sprintf(
+				`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+				name,
+				INSTANCE_LABEL_NAME, instance,
+				HOSTNAME_LABEL_NAME, hostname,
+				PROC_NET_DEV_LABEL_NAME, dev,
+			))
+		}
+	}
 	pndm.devInfoMap[dev] = &ProcNetDevInfo{
-		deltaMetrics: deltaMetrics,
+		deltaMetrics:              deltaMetrics,
+		carrierChangesDeltaMetric: carrierChangesDeltaMetric,
+		utilPctMetrics:            utilPctMetrics,
 		presentMetric: []byte(fmt.Sprintf(
 			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
 			PROC_NET_DEV_PRESENCE_METRIC,
@@ -220,6 +344,76 @@ func (pndm *ProcNetDevMetrics) updateDevInfo(dev string) {
 	}
 }
 
+// Build the link info metric, w/o value, from the sysfs attributes:
+func (pndm *ProcNetDevMetrics) buildLinkInfoMetric(netClassDev *sysfs.NetClassDev) []byte {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pndm.instance != "" {
+		instance = pndm.instance
+	}
+	if pndm.hostname != "" {
+		hostname = pndm.hostname
+	}
+
+	speed := ""
+	if netClassDev.Speed > 0 {
+		speed = strconv.FormatInt(netClassDev.Speed, 10)
+	}
+	mtu := ""
+	if netClassDev.Mtu >= 0 {
+		mtu = strconv.FormatInt(netClassDev.Mtu, 10)
+	}
+	linkType := ""
+	if netClassDev.Type >= 0 {
+		linkType = strconv.FormatInt(netClassDev.Type, 10)
+	}
+	return []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+		PROC_NET_DEV_LINK_INFO_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+		PROC_NET_DEV_LABEL_NAME, netClassDev.Dev,
+		PROC_NET_DEV_LINK_SPEED_LABEL_NAME, speed,
+		PROC_NET_DEV_LINK_DUPLEX_LABEL_NAME, netClassDev.Duplex,
+		PROC_NET_DEV_LINK_MTU_LABEL_NAME, mtu,
+		PROC_NET_DEV_LINK_OPERSTATE_LABEL_NAME, netClassDev.Operstate,
+		PROC_NET_DEV_LINK_TYPE_LABEL_NAME, linkType,
+	))
+}
+
+// Parse the sysfs attributes for the devices about to have a full metrics
+// cycle. This should be invoked after the current stats were parsed and
+// before the metrics are generated:
+func (pndm *ProcNetDevMetrics) updateNetClassDevs(currProcNetDev *procfs.NetDev) {
+	sysfsRoot := GlobalSysfsRoot
+	if pndm.sysfsRoot != "" {
+		sysfsRoot = pndm.sysfsRoot
+	}
+
+	for dev := range currProcNetDev.DevStats {
+		devInfo := pndm.devInfoMap[dev]
+		if devInfo != nil && devInfo.cycleNum != 0 || devInfo == nil && pndm.devFilter.exclude(dev, dev) {
+			continue
+		}
+		netClassDev := pndm.netClassDevMap[dev]
+		if netClassDev == nil {
+			netClassDev = sysfs.NewNetClassDev(sysfsRoot, dev)
+			pndm.netClassDevMap[dev] = netClassDev
+		}
+		if err := netClassDev.Parse(); err != nil {
+			// The device may have been removed in the meantime:
+			delete(pndm.netClassDevMap, dev)
+		}
+	}
+
+	if len(pndm.netClassDevMap) > len(currProcNetDev.DevStats) {
+		for dev := range pndm.netClassDevMap {
+			if _, ok := currProcNetDev.DevStats[dev]; !ok {
+				delete(pndm.netClassDevMap, dev)
+			}
+		}
+	}
+}
+
 func (pndm *ProcNetDevMetrics) updateMetricsCache() {
 	instance, hostname := GlobalInstance, GlobalHostname
 	if pndm.instance != "" {
@@ -234,7 +428,9 @@ func (pndm *ProcNetDevMetrics) updateMetricsCache() {
 		INSTANCE_LABEL_NAME, instance,
 		HOSTNAME_LABEL_NAME, hostname,
 	))
-
+	if pndm.devFilter != nil {
+		pndm.devFilter.updateCountMetric(PROC_NET_DEV_EXCLUDED_COUNT_METRIC, instance, hostname)
+	}
 }
 
 func (pndm *ProcNetDevMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
@@ -264,6 +460,9 @@ func (pndm *ProcNetDevMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
 		devInfo := pndm.devInfoMap[dev]
 		fullMetrics := devInfo == nil || devInfo.cycleNum == 0
 		if devInfo == nil {
+			if pndm.devFilter.exclude(dev, dev) {
+				continue
+			}
 			pndm.updateDevInfo(dev)
 			devInfo = pndm.devInfoMap[dev]
 			evalTotalMetricsCount = true
@@ -271,20 +470,82 @@ func (pndm *ProcNetDevMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
 		deltaMetrics := devInfo.deltaMetrics
 		zeroDelta := devInfo.zeroDelta
 
+		// Sysfs attributes based metrics, full cycles only:
+		if fullMetrics && pndm.sysfsAttributes {
+			netClassDev := pndm.netClassDevMap[dev]
+			if netClassDev != nil {
+				linkInfoMetric := pndm.buildLinkInfoMetric(netClassDev)
+				if devInfo.linkInfoMetric != nil && !bytes.Equal(devInfo.linkInfoMetric, linkInfoMetric) {
+					// Clear previous info:
+					buf.Write(devInfo.linkInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				buf.Write(linkInfoMetric)
+				buf.WriteByte('1')
+				buf.Write(promTs)
+				actualMetricsCount++
+				devInfo.linkInfoMetric = linkInfoMetric
+
+				if netClassDev.CarrierChangesValid && devInfo.prevCarrierChangesValid {
+					// The count is reset if the device is re-created in
+					// between scans, so the delta is computed against 0:
+					delta := netClassDev.CarrierChanges
+					if delta >= devInfo.prevCarrierChanges {
+						delta -= devInfo.prevCarrierChanges
+					}
+					buf.Write(devInfo.carrierChangesDeltaMetric)
+					buf.WriteString(strconv.FormatUint(delta, 10))
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				devInfo.prevCarrierChanges = netClassDev.CarrierChanges
+				devInfo.prevCarrierChangesValid = netClassDev.CarrierChangesValid
+
+				devInfo.speed = netClassDev.Speed
+			} else {
+				// The attributes are no longer available, e.g. the device was
+				// removed from sysfs; clear the previous info:
+				if devInfo.linkInfoMetric != nil {
+					buf.Write(devInfo.linkInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+					devInfo.linkInfoMetric = nil
+				}
+				devInfo.prevCarrierChangesValid = false
+				devInfo.speed = 0
+			}
+		}
+		utilPctMetrics := devInfo.utilPctMetrics
+		if devInfo.speed <= 0 {
+			utilPctMetrics = nil
+		}
+
 		for index, metric := range deltaMetrics {
 			val := currDevStats[index] - prevDevStats[index]
 			if val != 0 || fullMetrics || !zeroDelta[index] {
 				buf.Write(metric)
 				rate := procNetDevIndexRate[index]
 				if rate != nil {
-					buf.WriteString(strconv.FormatFloat(
-						float64(val)/deltaSec*rate.factor, 'f', rate.prec, 64,
-					))
+					rateVal := float64(val) / deltaSec * rate.factor
+					buf.WriteString(strconv.FormatFloat(rateVal, 'f', rate.prec, 64))
+					buf.Write(promTs)
+					actualMetricsCount++
+					if utilPctMetrics != nil && utilPctMetrics[index] != nil {
+						buf.Write(utilPctMetrics[index])
+						buf.WriteString(strconv.FormatFloat(
+							rateVal/float64(devInfo.speed)*PROC_NET_DEV_UTIL_PCT_FACTOR, 'f', PROC_NET_DEV_UTIL_PCT_PREC, 64,
+						))
+						buf.Write(promTs)
+						actualMetricsCount++
+					}
 				} else {
 					buf.WriteString(strconv.FormatUint(val, 10))
+					buf.Write(promTs)
+					actualMetricsCount++
 				}
-				buf.Write(promTs)
-				actualMetricsCount++
 			}
 			zeroDelta[index] = val == 0
 		}
@@ -303,7 +564,9 @@ func (pndm *ProcNetDevMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
 
 	// Network devices may be created/enabled dynamically, remove out of
 	// scope ones:
-	if len(pndm.devInfoMap) > len(currProcNetDev.DevStats) {
+	pruneExcludedItems(pndm.devFilter, currProcNetDev.DevStats)
+	numExcluded := pndm.devFilter.excludedCount()
+	if len(pndm.devInfoMap)+numExcluded > len(currProcNetDev.DevStats) {
 		evalTotalMetricsCount = true
 		for dev, devInfo := range pndm.devInfoMap {
 			if _, ok := currProcNetDev.DevStats[dev]; !ok {
@@ -311,6 +574,12 @@ func (pndm *ProcNetDevMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
 				buf.WriteByte('0')
 				buf.Write(promTs)
 				actualMetricsCount++
+				if devInfo.linkInfoMetric != nil {
+					buf.Write(devInfo.linkInfoMetric)
+					buf.WriteByte('0')
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
 				delete(pndm.devInfoMap, dev)
 			}
 		}
@@ -324,11 +593,25 @@ func (pndm *ProcNetDevMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
 	buf.Write(promTs)
 	actualMetricsCount++
 
+	actualMetricsCount += pndm.devFilter.generateCountMetric(buf, promTs, pndm.fullMetricsFactor)
+
 	if evalTotalMetricsCount {
 		// The total number of metrics:
 		//		delta metrics#: (number of dev) * (number of counters + 1 (presence))
+		//		sysfs metrics#: (number of dev) * (2 (link info, carrier changes) + (number of util %))
 		//		interval metric#: 1
-		pndm.totalMetricsCount = len(currProcNetDev.DevStats)*(procfs.NET_DEV_NUM_STATS+1) + 1
+		//		excluded count metric#: 1 if filtering
+		perDevMetricsCount := procfs.NET_DEV_NUM_STATS + 1
+		if pndm.sysfsAttributes {
+			perDevMetricsCount += 2
+		}
+		if pndm.utilPct {
+			perDevMetricsCount += len(procNetDevIndexUtilPctMetricNameMap)
+		}
+		pndm.totalMetricsCount = (len(currProcNetDev.DevStats)-numExcluded)*perDevMetricsCount + 1
+		if pndm.devFilter != nil {
+			pndm.totalMetricsCount++
+		}
 	}
 
 	return actualMetricsCount, pndm.totalMetricsCount
@@ -366,6 +649,9 @@ func (pndm *ProcNetDevMetrics) Execute() bool {
 		return false
 	}
 	pndm.procNetDevTs[pndm.currIndex] = timeNowFn()
+	if pndm.sysfsAttributes {
+		pndm.updateNetClassDevs(currProcNetDev)
+	}
 
 	buf := metricsQueue.GetBuf()
 	actualMetricsCount, totalMetricsCount := pndm.generateMetrics(buf)
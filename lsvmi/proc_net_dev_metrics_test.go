@@ -142,3 +142,310 @@ func TestProcNetDevMetrics(t *testing.T) {
 		)
 	}
 }
+
+type ProcNetDevSysfsInfoTestData struct {
+	CycleNum           int
+	ZeroDelta          bool
+	PrevCarrierChanges uint64
+	PrevLinkInfoMetric string
+	Speed              int64
+}
+
+type ProcNetDevMetricsSysfsTestCase struct {
+	Name       string
+	DevInfoMap map[string]*ProcNetDevSysfsInfoTestData
+	// Devices in addition to eth0 and wlan0, w/o sysfs attributes:
+	ExtraDevs        []string
+	WantMetricsCount int
+	WantMetrics      []string
+	ReportExtra      bool
+}
+
+var procNetDevMetricsTestSysfsRoot = path.Join("..", testutils.SysfsTestDataSubdir, "net", "field_mapping")
+
+func TestProcNetDevMetricsSysfs(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	linkInfoMetric := func(dev, speed, duplex, mtu, operstate, linkType string) string {
+		return fmt.Sprintf(
+			`proc_net_dev_link_info{instance="%s",hostname="%s",dev="%s",speed="%s",duplex="%s",mtu="%s",operstate="%s",type="%s"} `,
+			instance, hostname, dev, speed, duplex, mtu, operstate, linkType,
+		)
+	}
+	devMetric := func(name, dev, val string) string {
+		return fmt.Sprintf(
+			`%s{instance="%s",hostname="%s",dev="%s"} %s %d`,
+			name, instance, hostname, dev, val, currPromTs,
+		)
+	}
+	eth0LinkInfoMetric := linkInfoMetric("eth0", "1000", "full", "1500", "up", "1")
+	wlan0LinkInfoMetric := linkInfoMetric("wlan0", "", "unknown", "1500", "down", "1")
+	intervalMetric := fmt.Sprintf(
+		`proc_net_dev_metrics_delta_sec{instance="%s",hostname="%s"} 5.000000 %d`,
+		instance, hostname, currPromTs,
+	)
+
+	// eth0 received 62,500,000 bytes in 5 sec, i.e. 100,000 kbps or 10% of
+	// 1000 Mbps:
+	newNetDev := func(eth0RxBytes uint64, extraDevs []string) *procfs.NetDev {
+		netDev := &procfs.NetDev{DevStats: make(map[string][]uint64)}
+		for _, dev := range append([]string{"eth0", "wlan0"}, extraDevs...) {
+			netDev.DevStats[dev] = make([]uint64, procfs.NET_DEV_NUM_STATS_SIZE)
+		}
+		netDev.DevStats["eth0"][procfs.NET_DEV_RX_BYTES] = eth0RxBytes
+		return netDev
+	}
+
+	for _, tc := range []*ProcNetDevMetricsSysfsTestCase{
+		{
+			Name: "full_first",
+			// eth0: 16 deltas + presence + link info + 2 util %
+			// wlan0: 16 deltas + presence + link info
+			// + interval
+			WantMetricsCount: 20 + 18 + 1,
+			WantMetrics: []string{
+				fmt.Sprintf("%s1 %d", eth0LinkInfoMetric, currPromTs),
+				fmt.Sprintf("%s1 %d", wlan0LinkInfoMetric, currPromTs),
+				devMetric("proc_net_dev_rx_kbps", "eth0", "100000.0"),
+				devMetric("proc_net_dev_rx_util_pct", "eth0", "10.00"),
+				devMetric("proc_net_dev_tx_util_pct", "eth0", "0.00"),
+				intervalMetric,
+			},
+		},
+		{
+			Name: "full_carrier_change",
+			DevInfoMap: map[string]*ProcNetDevSysfsInfoTestData{
+				"eth0": {
+					PrevCarrierChanges: 1,
+					PrevLinkInfoMetric: linkInfoMetric("eth0", "", "full", "1500", "down", "1"),
+				},
+				"wlan0": {
+					PrevCarrierChanges: 12,
+					PrevLinkInfoMetric: wlan0LinkInfoMetric,
+				},
+			},
+			// eth0: 16 deltas + presence + link info clear + link info + carrier changes + 2 util %
+			// wlan0: 16 deltas + presence + link info + carrier changes
+			// + interval
+			WantMetricsCount: 22 + 19 + 1,
+			WantMetrics: []string{
+				fmt.Sprintf("%s0 %d", linkInfoMetric("eth0", "", "full", "1500", "down", "1"), currPromTs),
+				fmt.Sprintf("%s1 %d", eth0LinkInfoMetric, currPromTs),
+				devMetric("proc_net_dev_carrier_changes_delta", "eth0", "2"),
+				fmt.Sprintf("%s1 %d", wlan0LinkInfoMetric, currPromTs),
+				devMetric("proc_net_dev_carrier_changes_delta", "wlan0", "0"),
+				devMetric("proc_net_dev_rx_util_pct", "eth0", "10.00"),
+				intervalMetric,
+			},
+		},
+		{
+			Name: "full_carrier_changes_reset",
+			DevInfoMap: map[string]*ProcNetDevSysfsInfoTestData{
+				"eth0": {
+					PrevCarrierChanges: 10,
+					PrevLinkInfoMetric: eth0LinkInfoMetric,
+				},
+				"wlan0": {
+					PrevCarrierChanges: 12,
+					PrevLinkInfoMetric: wlan0LinkInfoMetric,
+				},
+			},
+			// eth0: 16 deltas + presence + link info + carrier changes + 2 util %
+			// wlan0: 16 deltas + presence + link info + carrier changes
+			// + interval
+			WantMetricsCount: 21 + 19 + 1,
+			WantMetrics: []string{
+				devMetric("proc_net_dev_carrier_changes_delta", "eth0", "3"),
+				devMetric("proc_net_dev_carrier_changes_delta", "wlan0", "0"),
+				intervalMetric,
+			},
+		},
+		{
+			Name: "full_sysfs_gone",
+			DevInfoMap: map[string]*ProcNetDevSysfsInfoTestData{
+				"eth0": {
+					PrevCarrierChanges: 3,
+					PrevLinkInfoMetric: eth0LinkInfoMetric,
+				},
+				"wlan0": {
+					PrevCarrierChanges: 12,
+					PrevLinkInfoMetric: wlan0LinkInfoMetric,
+				},
+				"veth9": {
+					PrevCarrierChanges: 5,
+					PrevLinkInfoMetric: linkInfoMetric("veth9", "10000", "full", "1500", "up", "1"),
+					Speed:              10000,
+				},
+			},
+			ExtraDevs: []string{"veth9"},
+			// eth0: 16 deltas + presence + link info + carrier changes + 2 util %
+			// wlan0: 16 deltas + presence + link info + carrier changes
+			// veth9: 16 deltas + presence + link info clear
+			// + interval
+			WantMetricsCount: 21 + 19 + 18 + 1,
+			WantMetrics: []string{
+				fmt.Sprintf("%s0 %d", linkInfoMetric("veth9", "10000", "full", "1500", "up", "1"), currPromTs),
+				devMetric("proc_net_dev_rx_kbps", "veth9", "0.0"),
+				devMetric("proc_net_dev_present", "veth9", "1"),
+				intervalMetric,
+			},
+		},
+		{
+			Name: "partial_util",
+			DevInfoMap: map[string]*ProcNetDevSysfsInfoTestData{
+				"eth0": {
+					CycleNum:           1,
+					ZeroDelta:          true,
+					PrevCarrierChanges: 3,
+					PrevLinkInfoMetric: eth0LinkInfoMetric,
+					Speed:              1000,
+				},
+				"wlan0": {
+					CycleNum:           1,
+					ZeroDelta:          true,
+					PrevCarrierChanges: 12,
+					PrevLinkInfoMetric: wlan0LinkInfoMetric,
+					Speed:              -1,
+				},
+			},
+			WantMetrics: []string{
+				devMetric("proc_net_dev_rx_kbps", "eth0", "100000.0"),
+				devMetric("proc_net_dev_rx_util_pct", "eth0", "10.00"),
+				intervalMetric,
+			},
+			ReportExtra: true,
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) {
+				tlc := testutils.NewTestLogCollect(t, Log, nil)
+				defer tlc.RestoreLog()
+
+				procNetDevMetrics, err := NewProcNetDevMetrics(&ProcNetDevMetricsConfig{
+					Interval:          PROC_NET_DEV_METRICS_CONFIG_INTERVAL_DEFAULT,
+					FullMetricsFactor: PROC_NET_DEV_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+					SysfsAttributes:   true,
+					UtilPct:           true,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				procNetDevMetrics.instance = instance
+				procNetDevMetrics.hostname = hostname
+				procNetDevMetrics.sysfsRoot = procNetDevMetricsTestSysfsRoot
+				currIndex := procNetDevMetrics.currIndex
+				currProcNetDev := newNetDev(62_500_000, tc.ExtraDevs)
+				procNetDevMetrics.procNetDev[currIndex] = currProcNetDev
+				procNetDevMetrics.procNetDevTs[currIndex] = time.UnixMilli(currPromTs)
+				procNetDevMetrics.procNetDev[1-currIndex] = newNetDev(0, tc.ExtraDevs)
+				procNetDevMetrics.procNetDevTs[1-currIndex] = time.UnixMilli(prevPromTs)
+				for dev, devInfoTd := range tc.DevInfoMap {
+					procNetDevMetrics.updateDevInfo(dev)
+					devInfo := procNetDevMetrics.devInfoMap[dev]
+					devInfo.cycleNum = devInfoTd.CycleNum
+					for index := range devInfo.zeroDelta {
+						devInfo.zeroDelta[index] = devInfoTd.ZeroDelta
+					}
+					devInfo.prevCarrierChanges, devInfo.prevCarrierChangesValid = devInfoTd.PrevCarrierChanges, true
+					devInfo.linkInfoMetric = []byte(devInfoTd.PrevLinkInfoMetric)
+					devInfo.speed = devInfoTd.Speed
+				}
+				procNetDevMetrics.updateNetClassDevs(currProcNetDev)
+
+				testMetricsQueue := testutils.NewTestMetricsQueue(0)
+				buf := testMetricsQueue.GetBuf()
+				gotMetricsCount, _ := procNetDevMetrics.generateMetrics(buf)
+				testMetricsQueue.QueueBuf(buf)
+
+				errBuf := &bytes.Buffer{}
+				wantMetricsCount := tc.WantMetricsCount
+				if tc.ReportExtra {
+					wantMetricsCount = len(tc.WantMetrics)
+				}
+				if wantMetricsCount != gotMetricsCount {
+					fmt.Fprintf(
+						errBuf,
+						"\nmetrics count: want: %d, got: %d",
+						wantMetricsCount, gotMetricsCount,
+					)
+				}
+				testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+				if errBuf.Len() > 0 {
+					t.Fatal(errBuf)
+				}
+			},
+		)
+	}
+}
+
+func TestProcNetDevMetricsFilter(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	procNetDevMetrics, err := NewProcNetDevMetrics(&ProcNetDevMetricsConfig{
+		Interval:          PROC_NET_DEV_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: PROC_NET_DEV_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		ExcludeDevices:    []string{`veth.*`, `lo`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	procNetDevMetrics.instance = instance
+	procNetDevMetrics.hostname = hostname
+
+	newNetDev := func() *procfs.NetDev {
+		netDev := &procfs.NetDev{DevStats: make(map[string][]uint64)}
+		for _, dev := range []string{"eth0", "lo", "veth1a2b"} {
+			netDev.DevStats[dev] = make([]uint64, procfs.NET_DEV_NUM_STATS_SIZE)
+		}
+		return netDev
+	}
+	currIndex := procNetDevMetrics.currIndex
+	procNetDevMetrics.procNetDev[currIndex] = newNetDev()
+	procNetDevMetrics.procNetDevTs[currIndex] = time.UnixMilli(currPromTs)
+	procNetDevMetrics.procNetDev[1-currIndex] = newNetDev()
+	procNetDevMetrics.procNetDevTs[1-currIndex] = time.UnixMilli(prevPromTs)
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, gotTotalMetricsCount := procNetDevMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+	// eth0: 16 deltas + presence + interval + excluded count:
+	wantMetricsCount := procfs.NET_DEV_NUM_STATS + 1 + 1 + 1
+	if wantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(errBuf, "\nmetrics count: want: %d, got: %d", wantMetricsCount, gotMetricsCount)
+	}
+	if wantMetricsCount != gotTotalMetricsCount {
+		fmt.Fprintf(errBuf, "\ntotal metrics count: want: %d, got: %d", wantMetricsCount, gotTotalMetricsCount)
+	}
+	if _, ok := procNetDevMetrics.devInfoMap["veth1a2b"]; ok {
+		fmt.Fprintf(errBuf, "\ndevInfoMap: unexpected %q", "veth1a2b")
+	}
+	wantMetrics := []string{
+		fmt.Sprintf(
+			`proc_net_dev_present{instance="%s",hostname="%s",dev="eth0"} 1 %d`,
+			instance, hostname, currPromTs,
+		),
+		fmt.Sprintf(
+			`proc_net_dev_metrics_delta_sec{instance="%s",hostname="%s"} 5.000000 %d`,
+			instance, hostname, currPromTs,
+		),
+		fmt.Sprintf(
+			`proc_net_dev_excluded_count{instance="%s",hostname="%s"} 2 %d`,
+			instance, hostname, currPromTs,
+		),
+	}
+	testMetricsQueue.GenerateReport(wantMetrics, false, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
@@ -0,0 +1,373 @@
+// Metrics based on /proc/net/softnet_stat
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	PROC_NET_SOFTNET_STAT_METRICS_CONFIG_INTERVAL_DEFAULT            = "1s"
+	PROC_NET_SOFTNET_STAT_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 15
+
+	// This generator id:
+	PROC_NET_SOFTNET_STAT_METRICS_ID = "proc_net_softnet_stat_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",cpu="CPU"}:
+	PROC_NET_SOFTNET_STAT_PROCESSED_DELTA_METRIC        = "proc_net_softnet_stat_processed_delta"
+	PROC_NET_SOFTNET_STAT_DROPPED_DELTA_METRIC          = "proc_net_softnet_stat_dropped_delta"
+	PROC_NET_SOFTNET_STAT_TIME_SQUEEZE_DELTA_METRIC     = "proc_net_softnet_stat_time_squeeze_delta"
+	PROC_NET_SOFTNET_STAT_RECEIVED_RPS_DELTA_METRIC     = "proc_net_softnet_stat_received_rps_delta"
+	PROC_NET_SOFTNET_STAT_FLOW_LIMIT_COUNT_DELTA_METRIC = "proc_net_softnet_stat_flow_limit_count_delta"
+	PROC_NET_SOFTNET_STAT_CPU_LABEL_NAME                = "cpu"
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	PROC_NET_SOFTNET_STAT_INTERVAL_METRIC = "proc_net_softnet_stat_metrics_delta_sec"
+)
+
+// Map stats index into metric name:
+var procNetSoftnetStatDeltaMetricNames = [procfs.NET_SOFTNET_STAT_NUM_STATS]string{
+	procfs.NET_SOFTNET_STAT_PROCESSED:        PROC_NET_SOFTNET_STAT_PROCESSED_DELTA_METRIC,
+	procfs.NET_SOFTNET_STAT_DROPPED:          PROC_NET_SOFTNET_STAT_DROPPED_DELTA_METRIC,
+	procfs.NET_SOFTNET_STAT_TIME_SQUEEZE:     PROC_NET_SOFTNET_STAT_TIME_SQUEEZE_DELTA_METRIC,
+	procfs.NET_SOFTNET_STAT_RECEIVED_RPS:     PROC_NET_SOFTNET_STAT_RECEIVED_RPS_DELTA_METRIC,
+	procfs.NET_SOFTNET_STAT_FLOW_LIMIT_COUNT: PROC_NET_SOFTNET_STAT_FLOW_LIMIT_COUNT_DELTA_METRIC,
+}
+
+var procNetSoftnetStatMetricsLog = NewCompLogger(PROC_NET_SOFTNET_STAT_METRICS_ID)
+
+type ProcNetSoftnetStatMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultProcNetSoftnetStatMetricsConfig() *ProcNetSoftnetStatMetricsConfig {
+	return &ProcNetSoftnetStatMetricsConfig{
+		Interval:          PROC_NET_SOFTNET_STAT_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: PROC_NET_SOFTNET_STAT_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+type ProcNetSoftnetStatMetrics struct {
+	// id/task_id:
+	id string
+	// Scan interval:
+	interval time.Duration
+	// Dual storage for parsed stats used as previous, current:
+	procNetSoftnetStat [2]*procfs.NetSoftnetStat
+	// Timestamp when the stats were collected:
+	procNetSoftnetStatTs [2]time.Time
+	// Index for current stats, toggled after each use:
+	currIndex int
+	// Current cycle#:
+	cycleNum int
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// Delta metrics prefix cache (i.e. all but CPU#), indexed by
+	// procfs.NET_SOFTNET_STAT_...:
+	// 		`METRIC{instance="INSTANCE",hostname="HOSTNAME"`
+	deltaMetricsPrefixCache [][]byte
+
+	// Delta metrics suffix cache (CPU#), indexed by line#:
+	//              ... cpu="CPU"} `
+	deltaMetricsSuffixCache [][]byte
+
+	// Delta metrics are generated with skip-zero-after-zero rule, i.e. if the
+	// current and previous deltas are both zero, then the current metric is
+	// skipped, save for full cycles. Keep track of zero deltas, indexed by
+	// line# and procfs.NET_SOFTNET_STAT_...:
+	zeroDelta [][procfs.NET_SOFTNET_STAT_NUM_STATS]bool
+
+	// Interval metric:
+	intervalMetric []byte
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+}
+
+func NewProcNetSoftnetStatMetrics(cfg any) (*ProcNetSoftnetStatMetrics, error) {
+	var (
+		err                          error
+		procNetSoftnetStatMetricsCfg *ProcNetSoftnetStatMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		procNetSoftnetStatMetricsCfg = cfg.ProcNetSoftnetStatMetricsConfig
+	case *ProcNetSoftnetStatMetricsConfig:
+		procNetSoftnetStatMetricsCfg = cfg
+	case nil:
+		procNetSoftnetStatMetricsCfg = DefaultProcNetSoftnetStatMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewProcNetSoftnetStatMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(procNetSoftnetStatMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	procNetSoftnetStatMetrics := &ProcNetSoftnetStatMetrics{
+		id:                PROC_NET_SOFTNET_STAT_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: procNetSoftnetStatMetricsCfg.FullMetricsFactor,
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	procNetSoftnetStatMetricsLog.Infof("id=%s", procNetSoftnetStatMetrics.id)
+	procNetSoftnetStatMetricsLog.Infof("interval=%s", procNetSoftnetStatMetrics.interval)
+	procNetSoftnetStatMetricsLog.Infof("full_metrics_factor=%d", procNetSoftnetStatMetrics.fullMetricsFactor)
+	return procNetSoftnetStatMetrics, nil
+}
+
+func (pnsm *ProcNetSoftnetStatMetrics) updateMetricsCache() {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if pnsm.instance != "" {
+		instance = pnsm.instance
+	}
+	if pnsm.hostname != "" {
+		hostname = pnsm.hostname
+	}
+
+	pnsm.deltaMetricsPrefixCache = make([][]byte, procfs.NET_SOFTNET_STAT_NUM_STATS)
+	for index, name := range procNetSoftnetStatDeltaMetricNames {
+		pnsm.deltaMetricsPrefixCache[index] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"`,
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+
+	pnsm.intervalMetric = []byte(fmt.Sprintf(
+		`%s{%s="%s",%s="%s"} `, // N.B. include space before val
+		PROC_NET_SOFTNET_STAT_INTERVAL_METRIC,
+		INSTANCE_LABEL_NAME, instance,
+		HOSTNAME_LABEL_NAME, hostname,
+	))
+}
+
+// Update suffix cache every time there is a change to the CPU list; return the
+// mapping from current to previous line index such that they target the same
+// CPU#. This follows the same conventions as ProcSoftirqsMetrics.updateCpuList.
+func (pnsm *ProcNetSoftnetStatMetrics) updateCpuList() map[int]int {
+	currNetSoftnetStat, prevNetSoftnetStat := pnsm.procNetSoftnetStat[pnsm.currIndex], pnsm.procNetSoftnetStat[1-pnsm.currIndex]
+
+	// Suffix cache:
+	if currNetSoftnetStat.CpuList == nil {
+		// No CPU is missing, i.e. CPU# == line index#
+		numCpus := len(currNetSoftnetStat.Stats)
+		pnsm.deltaMetricsSuffixCache = make([][]byte, numCpus)
+		for i := 0; i < numCpus; i++ {
+			pnsm.deltaMetricsSuffixCache[i] = []byte(fmt.Sprintf(
+				`,%s="%d"} `, // N.B. include space before value
+				PROC_NET_SOFTNET_STAT_CPU_LABEL_NAME, i,
+			))
+		}
+	} else {
+		pnsm.deltaMetricsSuffixCache = make([][]byte, len(currNetSoftnetStat.CpuList))
+		for i, cpu := range currNetSoftnetStat.CpuList {
+			pnsm.deltaMetricsSuffixCache[i] = []byte(fmt.Sprintf(
+				`,%s="%d"} `, // N.B. include space before value
+				PROC_NET_SOFTNET_STAT_CPU_LABEL_NAME, cpu,
+			))
+		}
+	}
+
+	// Mapping:
+	currToPrevLineIndexMap := make(map[int]int)
+	if prevNetSoftnetStat == nil {
+		return currToPrevLineIndexMap
+	}
+	prevCpuNumToLineIndexMap := make(map[int]int)
+	if prevNetSoftnetStat.CpuList == nil {
+		for i := 0; i < len(prevNetSoftnetStat.Stats); i++ {
+			prevCpuNumToLineIndexMap[i] = i
+		}
+	} else {
+		for i, cpuNum := range prevNetSoftnetStat.CpuList {
+			prevCpuNumToLineIndexMap[cpuNum] = i
+		}
+	}
+	if currNetSoftnetStat.CpuList == nil {
+		for i := 0; i < len(currNetSoftnetStat.Stats); i++ {
+			if prevI, ok := prevCpuNumToLineIndexMap[i]; ok {
+				currToPrevLineIndexMap[i] = prevI
+			}
+		}
+	} else {
+		for currI, cpuNum := range currNetSoftnetStat.CpuList {
+			if prevI, ok := prevCpuNumToLineIndexMap[cpuNum]; ok {
+				currToPrevLineIndexMap[currI] = prevI
+			}
+		}
+	}
+	return currToPrevLineIndexMap
+}
+
+func (pnsm *ProcNetSoftnetStatMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	actualMetricsCount := 0
+	currNetSoftnetStat, prevNetSoftnetStat := pnsm.procNetSoftnetStat[pnsm.currIndex], pnsm.procNetSoftnetStat[1-pnsm.currIndex]
+
+	if pnsm.deltaMetricsPrefixCache == nil {
+		pnsm.updateMetricsCache()
+	}
+
+	// If there was a CPU list change, then build curr to previous line index#
+	// map such that they refer to the same CPU#.
+	var currToPrevLineIndexMap map[int]int = nil
+	if currNetSoftnetStat.CpuListChanged || pnsm.deltaMetricsSuffixCache == nil {
+		currToPrevLineIndexMap = pnsm.updateCpuList()
+		// Previous zero delta is no longer valid:
+		pnsm.zeroDelta = make([][procfs.NET_SOFTNET_STAT_NUM_STATS]bool, len(currNetSoftnetStat.Stats))
+	}
+
+	// All metrics are deltas, so must have previous stats:
+	if prevNetSoftnetStat != nil {
+		currTs, prevTs := pnsm.procNetSoftnetStatTs[pnsm.currIndex], pnsm.procNetSoftnetStatTs[1-pnsm.currIndex]
+		pnsm.tsSuffixBuf.Reset()
+		fmt.Fprintf(
+			pnsm.tsSuffixBuf, " %d\n", currTs.UnixMilli(),
+		)
+		promTs := pnsm.tsSuffixBuf.Bytes()
+
+		deltaSec := currTs.Sub(prevTs).Seconds()
+
+		fullMetrics := pnsm.cycleNum == 0
+		prevStats := prevNetSoftnetStat.Stats
+		for currI, currLineStats := range currNetSoftnetStat.Stats {
+			prevI, ok := currI, true
+			if currToPrevLineIndexMap != nil {
+				prevI, ok = currToPrevLineIndexMap[currI]
+				if !ok {
+					// This CPU didn't exist before, so no delta for it:
+					continue
+				}
+			}
+			prevLineStats := prevStats[prevI]
+			zeroDelta := &pnsm.zeroDelta[currI]
+			suffix := pnsm.deltaMetricsSuffixCache[currI]
+			for index, currVal := range currLineStats {
+				// The values are 32 bit unsigned, so the delta is modulo 2^32:
+				delta := currVal - prevLineStats[index]
+				if fullMetrics || delta > 0 || !zeroDelta[index] {
+					buf.Write(pnsm.deltaMetricsPrefixCache[index])
+					buf.Write(suffix)
+					buf.WriteString(strconv.FormatUint(uint64(delta), 10))
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				zeroDelta[index] = delta == 0
+			}
+		}
+
+		// Interval metric:
+		buf.Write(pnsm.intervalMetric)
+		buf.WriteString(strconv.FormatFloat(deltaSec, 'f', 6, 64))
+		buf.Write(promTs)
+		actualMetricsCount++
+	}
+
+	// Update cycle#:
+	if pnsm.cycleNum++; pnsm.cycleNum >= pnsm.fullMetricsFactor {
+		pnsm.cycleNum = 0
+	}
+
+	// The total number of metrics:
+	//		delta metrics#: number of CPUs * number of stats
+	//		interval metric#: 1
+	totalMetricsCount := len(currNetSoftnetStat.Stats)*procfs.NET_SOFTNET_STAT_NUM_STATS + 1
+
+	// Toggle the buffers:
+	pnsm.currIndex = 1 - pnsm.currIndex
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (pnsm *ProcNetSoftnetStatMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if pnsm.timeNowFn != nil {
+		timeNowFn = pnsm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if pnsm.metricsQueue != nil {
+		metricsQueue = pnsm.metricsQueue
+	}
+
+	currNetSoftnetStat := pnsm.procNetSoftnetStat[pnsm.currIndex]
+	if currNetSoftnetStat == nil {
+		prevNetSoftnetStat := pnsm.procNetSoftnetStat[1-pnsm.currIndex]
+		if prevNetSoftnetStat != nil {
+			currNetSoftnetStat = prevNetSoftnetStat.Clone(false)
+		} else {
+			procfsRoot := GlobalProcfsRoot
+			if pnsm.procfsRoot != "" {
+				procfsRoot = pnsm.procfsRoot
+			}
+			currNetSoftnetStat = procfs.NewNetSoftnetStat(procfsRoot)
+			pnsm.cycleNum = initialCycleNum.Get(pnsm.fullMetricsFactor)
+		}
+		pnsm.procNetSoftnetStat[pnsm.currIndex] = currNetSoftnetStat
+	}
+	err := currNetSoftnetStat.Parse()
+	if err != nil {
+		procNetSoftnetStatMetricsLog.Warnf("%v: proc net softnet_stat metrics will be disabled", err)
+		return false
+	}
+	pnsm.procNetSoftnetStatTs[pnsm.currIndex] = timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := pnsm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+
+	GlobalMetricsGeneratorStatsContainer.Update(
+		pnsm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func ProcNetSoftnetStatMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	pnsm, err := NewProcNetSoftnetStatMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if pnsm.interval <= 0 {
+		procNetSoftnetStatMetricsLog.Infof(
+			"interval=%s, metrics disabled", pnsm.interval,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(pnsm.id, pnsm.interval, pnsm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(ProcNetSoftnetStatMetricsTaskBuilder)
+}
@@ -0,0 +1,209 @@
+// Tests for proc_net_softnet_stat_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+type ProcNetSoftnetStatMetricsTestCase struct {
+	Name                                   string
+	CurrNetSoftnetStat, PrevNetSoftnetStat *procfs.NetSoftnetStat
+	CurrPromTs, PrevPromTs                 int64
+	CycleNum                               int
+	FullMetricsFactor                      int
+	ZeroDelta                              [][procfs.NET_SOFTNET_STAT_NUM_STATS]bool
+	WantMetricsCount                       int
+	WantMetrics                            []string
+	ReportExtra                            bool
+}
+
+func testProcNetSoftnetStatMetrics(tc *ProcNetSoftnetStatMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	procNetSoftnetStatMetrics, err := NewProcNetSoftnetStatMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procNetSoftnetStatMetrics.instance = "lsvmi-test"
+	procNetSoftnetStatMetrics.hostname = "lsvmi-test-host"
+	procNetSoftnetStatMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	procNetSoftnetStatMetrics.cycleNum = tc.CycleNum
+
+	currIndex := procNetSoftnetStatMetrics.currIndex
+	procNetSoftnetStatMetrics.procNetSoftnetStat[currIndex] = tc.CurrNetSoftnetStat
+	procNetSoftnetStatMetrics.procNetSoftnetStat[1-currIndex] = tc.PrevNetSoftnetStat
+	procNetSoftnetStatMetrics.procNetSoftnetStatTs[currIndex] = time.UnixMilli(tc.CurrPromTs)
+	procNetSoftnetStatMetrics.procNetSoftnetStatTs[1-currIndex] = time.UnixMilli(tc.PrevPromTs)
+	if tc.ZeroDelta != nil {
+		// Simulate a previous scan w/ the same CPU list:
+		procNetSoftnetStatMetrics.updateCpuList()
+		procNetSoftnetStatMetrics.zeroDelta = tc.ZeroDelta
+	}
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := procNetSoftnetStatMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestProcNetSoftnetStatMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	currPromTs := int64(1_700_000_001_000)
+	prevPromTs := currPromTs - 1_000
+
+	deltaMetrics := func(cpu int, deltas ...uint32) []string {
+		metrics := make([]string, 0, len(deltas))
+		for index, delta := range deltas {
+			metrics = append(metrics, fmt.Sprintf(
+				`%s{%s,cpu="%d"} %d %d`,
+				procNetSoftnetStatDeltaMetricNames[index], labels, cpu, delta, currPromTs,
+			))
+		}
+		return metrics
+	}
+	intervalMetric := fmt.Sprintf(
+		`%s{%s} %.6f %d`, PROC_NET_SOFTNET_STAT_INTERVAL_METRIC, labels, 1., currPromTs,
+	)
+
+	for _, tc := range []*ProcNetSoftnetStatMetricsTestCase{
+		{
+			Name: "first_scan",
+			CurrNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats:          [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{{1, 2, 3, 4, 5}},
+				CpuListChanged: true,
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			FullMetricsFactor: 15,
+		},
+		{
+			Name: "full",
+			CurrNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{110, 2, 3, 4, 5},
+					{200, 1, 0, 0, 0},
+				},
+			},
+			PrevNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{100, 1, 3, 4, 5},
+					{0xfffffff0, 1, 0, 0, 0},
+				},
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			FullMetricsFactor: 15,
+			ZeroDelta:         make([][procfs.NET_SOFTNET_STAT_NUM_STATS]bool, 2),
+			WantMetricsCount:  11,
+			WantMetrics: append(
+				append(deltaMetrics(0, 10, 1, 0, 0, 0), deltaMetrics(1, 216, 0, 0, 0, 0)...),
+				intervalMetric,
+			),
+		},
+		{
+			Name: "skip_zero_after_zero",
+			CurrNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{110, 2, 3, 4, 5},
+				},
+			},
+			PrevNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{100, 1, 3, 4, 5},
+				},
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          1,
+			FullMetricsFactor: 15,
+			ZeroDelta:         [][procfs.NET_SOFTNET_STAT_NUM_STATS]bool{{true, true, true, false, true}},
+			WantMetricsCount:  4,
+			WantMetrics: []string{
+				deltaMetrics(0, 10)[0],
+				deltaMetrics(0, 10, 1)[1],
+				deltaMetrics(0, 10, 1, 0, 0)[3],
+				intervalMetric,
+			},
+		},
+		{
+			Name: "cpu_offline",
+			CurrNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{110, 0, 0, 0, 0},
+					{310, 0, 0, 0, 0},
+				},
+				CpuList:        []int{0, 2},
+				CpuListChanged: true,
+			},
+			PrevNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{100, 0, 0, 0, 0},
+					{200, 0, 0, 0, 0},
+					{300, 0, 0, 0, 0},
+				},
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          1,
+			FullMetricsFactor: 15,
+			WantMetricsCount:  11,
+			WantMetrics: append(
+				append(deltaMetrics(0, 10, 0, 0, 0, 0), deltaMetrics(2, 10, 0, 0, 0, 0)...),
+				intervalMetric,
+			),
+		},
+		{
+			Name: "cpu_online",
+			CurrNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{110, 0, 0, 0, 0},
+					{0, 0, 0, 0, 0},
+					{310, 0, 0, 0, 0},
+				},
+				CpuListChanged: true,
+			},
+			PrevNetSoftnetStat: &procfs.NetSoftnetStat{
+				Stats: [][procfs.NET_SOFTNET_STAT_NUM_STATS]uint32{
+					{100, 0, 0, 0, 0},
+					{300, 0, 0, 0, 0},
+				},
+				CpuList: []int{0, 2},
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          1,
+			FullMetricsFactor: 15,
+			WantMetricsCount:  11,
+			WantMetrics: append(
+				append(deltaMetrics(0, 10, 0, 0, 0, 0), deltaMetrics(2, 10, 0, 0, 0, 0)...),
+				intervalMetric,
+			),
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcNetSoftnetStatMetrics(tc, t) },
+		)
+	}
+}
@@ -1,4 +1,4 @@
-// Metrics bases on /proc/PID/... and/or /proc/PID/task/TID stat, status and cmdline files.
+// Metrics bases on /proc/PID/... and/or /proc/PID/task/TID stat, status, schedstat, smaps_rollup, oom_score, ns and cmdline files.
 
 package lsvmi
 
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/utils"
@@ -28,6 +29,12 @@ const (
 	PROC_PID_METRICS_CONFIG_PID_LIST_CACHE_VALID_INTERVAL_DEFAULT = "900ms"
 	PROC_PID_METRICS_CONFIG_NUM_PART_DEFAULT                      = -1
 	PROC_PID_METRICS_USE_PID_STATUS_DEFAULT                       = true
+	PROC_PID_METRICS_USE_PID_SCHEDSTAT_DEFAULT                    = false
+	PROC_PID_METRICS_USE_PID_SMAPS_ROLLUP_DEFAULT                 = false
+	PROC_PID_METRICS_PID_SMAPS_ROLLUP_INTERVAL_DEFAULT            = ""
+	PROC_PID_METRICS_USE_PID_OOM_SCORE_DEFAULT                    = false
+	PROC_PID_METRICS_PID_OOM_TOP_CANDIDATES_DEFAULT               = 5
+	PROC_PID_METRICS_USE_PID_NS_DEFAULT                           = false
 
 	// This generator id:
 	PROC_PID_METRICS_ID = "proc_pid_metrics"
@@ -109,6 +116,37 @@ const (
 	PROC_PID_STATUS_VOLUNTARY_CTXT_SWITCHES_METRIC    = "proc_pid_status_vol_ctx_switch_delta"    // PID + TID
 	PROC_PID_STATUS_NONVOLUNTARY_CTXT_SWITCHES_METRIC = "proc_pid_status_nonvol_ctx_switch_delta" // PID + TID
 
+	// /proc/PID/schedstat:
+	PROC_PID_SCHEDSTAT_RUN_PCT_METRIC  = "proc_pid_schedstat_run_pct"  // PID + TID
+	PROC_PID_SCHEDSTAT_WAIT_PCT_METRIC = "proc_pid_schedstat_wait_pct" // PID + TID
+
+	// /proc/PID/smaps_rollup:
+	PROC_PID_SMAPS_ROLLUP_PSS_METRIC           = "proc_pid_smaps_rollup_pss_bytes"           // PID only
+	PROC_PID_SMAPS_ROLLUP_PSS_ANON_METRIC      = "proc_pid_smaps_rollup_pss_anon_bytes"      // PID only
+	PROC_PID_SMAPS_ROLLUP_PSS_FILE_METRIC      = "proc_pid_smaps_rollup_pss_file_bytes"      // PID only
+	PROC_PID_SMAPS_ROLLUP_PSS_SHMEM_METRIC     = "proc_pid_smaps_rollup_pss_shmem_bytes"     // PID only
+	PROC_PID_SMAPS_ROLLUP_SWAP_PSS_METRIC      = "proc_pid_smaps_rollup_swap_pss_bytes"      // PID only
+	PROC_PID_SMAPS_ROLLUP_PRIVATE_DIRTY_METRIC = "proc_pid_smaps_rollup_private_dirty_bytes" // PID only
+	PROC_PID_SMAPS_ROLLUP_SHARED_CLEAN_METRIC  = "proc_pid_smaps_rollup_shared_clean_bytes"  // PID only
+
+	// /proc/PID/oom_score, /proc/PID/oom_score_adj:
+	PROC_PID_OOM_SCORE_METRIC     = "proc_pid_oom_score"     // PID only
+	PROC_PID_OOM_SCORE_ADJ_METRIC = "proc_pid_oom_score_adj" // PID only
+
+	// Host level top OOM candidates, merged across partitions and generated by
+	// partition 0 only:
+	PROC_PID_OOM_TOP_CANDIDATE_METRIC       = "proc_pid_oom_top_candidate"
+	PROC_PID_OOM_TOP_CANDIDATE_SCORE_METRIC = "proc_pid_oom_top_candidate_score"
+	PROC_PID_OOM_RANK_LABEL_NAME            = "rank"
+	PROC_PID_OOM_COMM_LABEL_NAME            = "comm"
+
+	// /proc/PID/ns/* + /proc/PID/status NStgid, NSpid:
+	PROC_PID_NS_INFO_METRIC              = "proc_pid_ns_info" // PID only
+	PROC_PID_NS_INFO_LABEL_NAME_SUFFIX   = "_ns"              // e.g. pid_ns, net_ns, ...
+	PROC_PID_NS_INFO_NS_PID_LABEL_NAME   = "ns_pid"           // PID in the innermost PID namespace
+	PROC_PID_NS_INFO_NS_TGID_LABEL_NAME  = "ns_tgid"          // TGID in the innermost PID namespace
+	PROC_PID_NS_INFO_NS_LEVEL_LABEL_NAME = "ns_level"         // PID namespace nesting level, 0 for the root namespace
+
 	// /proc/PID/cmdline.
 	PROC_PID_CMDLINE_METRIC              = "proc_pid_cmdline" // PID only, well behaved threads don't change their command line
 	PROC_PID_CMDLINE_CMD_PATH_LABEL_NAME = "cmd_path"
@@ -135,6 +173,13 @@ const (
 	PROC_PID_INTERVAL_METRIC = "proc_pid_metrics_delta_sec"
 
 	PROC_PID_SPECIFIC_METRICS_COUNT = 7
+
+	// The cost of /proc/PID/smaps_rollup sampling, generated only if enabled:
+	PROC_PID_SMAPS_ROLLUP_PARSE_COUNT_METRIC     = "proc_pid_smaps_rollup_parse_count"     // parsed in this scan
+	PROC_PID_SMAPS_ROLLUP_PARSE_ERR_COUNT_METRIC = "proc_pid_smaps_rollup_parse_err_count" // parsing error in this scan
+	PROC_PID_SMAPS_ROLLUP_PARSE_SEC_METRIC       = "proc_pid_smaps_rollup_parse_sec"       // time spent parsing in this scan
+
+	PROC_PID_SMAPS_ROLLUP_SPECIFIC_METRICS_COUNT = 3
 )
 
 var procPidMetricsLog = NewCompLogger(PROC_PID_METRICS_ID)
@@ -169,6 +214,28 @@ type ProcPidMetricsConfig struct {
 	// "Contents of the status fields", "VmPeak" thru "HugetlbPages"). An
 	// empty/nil list will cause all fields to be used.
 	PidStatusMemoryFields []string `yaml:"pid_status_memory_fields"`
+	// Whether to generate metrics based on /proc/PID/schedstat or not. The file
+	// is available only if the kernel was built w/ CONFIG_SCHEDSTATS.
+	UsePidSchedstat bool `yaml:"use_pid_schedstat"`
+	// Whether to generate metrics based on /proc/PID/smaps_rollup or not. The
+	// file is expensive to read, therefore it is sampled only for full metrics
+	// cycles or at the interval below, whichever comes first.
+	UsePidSmapsRollup bool `yaml:"use_pid_smaps_rollup"`
+	// How often to sample /proc/PID/smaps_rollup, in time.ParseDuration()
+	// format; it is rounded up to a multiple of the scan interval. Leave empty
+	// or use 0 to sample only for full metrics cycles.
+	PidSmapsRollupInterval string `yaml:"pid_smaps_rollup_interval"`
+	// Whether to generate metrics based on /proc/PID/oom_score and
+	// /proc/PID/oom_score_adj or not. The files are read only for full metrics
+	// cycles.
+	UsePidOomScore bool `yaml:"use_pid_oom_score"`
+	// The number of highest OOM score processes, merged across all partitions,
+	// listed by the host level top OOM candidates metrics. Use 0 to disable.
+	PidOomTopCandidates int `yaml:"pid_oom_top_candidates"`
+	// Whether to generate the namespace info metric, based on /proc/PID/ns/*
+	// and /proc/PID/status NStgid, NSpid, or not. The latter requires
+	// use_pid_status. The metric is generated only for full metrics cycles.
+	UsePidNs bool `yaml:"use_pid_ns"`
 }
 
 func DefaultProcPidMetricsConfig() *ProcPidMetricsConfig {
@@ -179,6 +246,12 @@ func DefaultProcPidMetricsConfig() *ProcPidMetricsConfig {
 		PidTidListCacheValidInterval: PROC_PID_METRICS_CONFIG_PID_LIST_CACHE_VALID_INTERVAL_DEFAULT,
 		NumPartitions:                PROC_PID_METRICS_CONFIG_NUM_PART_DEFAULT,
 		UsePidStatus:                 PROC_PID_METRICS_USE_PID_STATUS_DEFAULT,
+		UsePidSchedstat:              PROC_PID_METRICS_USE_PID_SCHEDSTAT_DEFAULT,
+		UsePidSmapsRollup:            PROC_PID_METRICS_USE_PID_SMAPS_ROLLUP_DEFAULT,
+		PidSmapsRollupInterval:       PROC_PID_METRICS_PID_SMAPS_ROLLUP_INTERVAL_DEFAULT,
+		UsePidOomScore:               PROC_PID_METRICS_USE_PID_OOM_SCORE_DEFAULT,
+		PidOomTopCandidates:          PROC_PID_METRICS_PID_OOM_TOP_CANDIDATES_DEFAULT,
+		UsePidNs:                     PROC_PID_METRICS_USE_PID_NS_DEFAULT,
 	}
 }
 
@@ -188,8 +261,38 @@ type ProcPidTidMetricsInfo struct {
 	next, prev *ProcPidTidMetricsInfo
 
 	// Parsers, used to maintain the previous state:
-	pidStat   procfs.PidStatParser
-	pidStatus procfs.PidStatusParser
+	pidStat      procfs.PidStatParser
+	pidStatus    procfs.PidStatusParser
+	pidSchedstat procfs.PidSchedstatParser
+
+	// The schedstat parser maintains the previous state only if the file was
+	// parsed successfully at least once; the time stamp is that of the most
+	// recent parse, since inactive processes are not parsed at every scan:
+	pidSchedstatHasPrev bool
+	pidSchedstatTs      time.Time
+	// Whether it was parsed in the current scan:
+	pidSchedstatParsed bool
+
+	// The smaps_rollup parser is used only when sampled, see
+	// ProcPidMetricsConfig.PidSmapsRollupInterval; it maintains the previous
+	// sample, if any:
+	pidSmapsRollup        procfs.PidSmapsRollupParser
+	pidSmapsRollupHasPrev bool
+	// Whether it was sampled in the current scan:
+	pidSmapsRollupSampled bool
+	// The number of scans since the last sample:
+	pidSmapsRollupCycleNum int
+
+	// The OOM score and adjustment, updated for full metrics cycles. Used for
+	// the top OOM candidates as well:
+	oomScore, oomScoreAdj int
+	hasOomScore           bool
+
+	// The namespace info labels, as per the most recent full metrics cycle;
+	// used to clear the previous info metric when they change:
+	pidNsInfoLabels string
+	// Whether the namespaces were parsed in the current scan:
+	pidNsParsed bool
 
 	// The time stamp when stats above were collected:
 	prevTs time.Time
@@ -249,6 +352,18 @@ type ProcPidMetrics struct {
 	// are all used. Note: it is implemented as a map for fast lookup (is-in
 	// function).
 	pidStatusMemKeepIndex map[int]bool
+	// Whether to use /proc/PID/schedstat metrics or not:
+	usePidSchedstat bool
+	// Whether to use /proc/PID/smaps_rollup metrics or not:
+	usePidSmapsRollup bool
+	// Sample smaps_rollup every N scans; 0 stands for full metrics cycles only:
+	pidSmapsRollupFactor int
+	// Whether to use /proc/PID/oom_score metrics or not:
+	usePidOomScore bool
+	// The number of top OOM candidates; 0 stands for disabled:
+	pidOomTopCandidates int
+	// Whether to use /proc/PID/ns metrics or not:
+	usePidNs bool
 
 	// The PidTid list cache, shared among ProcPidMetrics instances:
 	pidTidListCache procfs.PidTidListCacheIF
@@ -266,8 +381,18 @@ type ProcPidMetrics struct {
 	pidTidMetricsInfoHead, pidTidMetricsInfoTail *ProcPidTidMetricsInfo
 
 	// Unbound parsers, see Musical Chairs Approach For Deltas above:
-	pidStat   procfs.PidStatParser
-	pidStatus procfs.PidStatusParser
+	pidStat      procfs.PidStatParser
+	pidStatus    procfs.PidStatusParser
+	pidSchedstat procfs.PidSchedstatParser
+	// Ditto for smaps_rollup, it is swapped only when sampled:
+	pidSmapsRollup procfs.PidSmapsRollupParser
+
+	// The OOM score is not cached either, it is parsed for every full metrics
+	// cycle and its values are stored in the PID, TID info:
+	pidOomScore procfs.PidOomScoreParser
+
+	// Ditto for the namespaces:
+	pidNs procfs.PidNsParser
 
 	// The command line is not cached, it is parsed for every full metrics cycle
 	// when the metrics is generated. A single parser is used for all PID, TID:
@@ -303,6 +428,19 @@ type ProcPidMetrics struct {
 	pidStatusPidTidMemoryMetricFmt  []*ProcPidMetricsIndexFmt
 	pidStatusCtxMetricFmt           []*ProcPidMetricsIndexFmt
 
+	// PidSchedstat based metric formats:
+	pidSchedstatPctMetricFmt []*ProcPidMetricsIndexFmt
+
+	// PidSmapsRollup based metric formats:
+	pidSmapsRollupMetricFmt []*ProcPidMetricsIndexFmt
+
+	// PidOomScore based metric formats:
+	pidOomScoreMetricFmt    string
+	pidOomScoreAdjMetricFmt string
+
+	// PidNs metric format:
+	pidNsInfoMetricFmt string
+
 	// PidCmdline metric format:
 	pidCmdlineMetricFmt string
 	// Fallback for kernel threads and zombie processes where cmdline is empty:
@@ -321,6 +459,15 @@ type ProcPidMetrics struct {
 	pidDelCountMetricFmt      string
 	intervalMetricFmt         string
 
+	// Generator specific smaps_rollup metrics formats:
+	pidSmapsRollupParseCountMetricFmt    string
+	pidSmapsRollupParseErrCountMetricFmt string
+	pidSmapsRollupParseSecMetricFmt      string
+
+	// Top OOM candidates metrics formats, partition 0 only:
+	oomTopCandidateMetricFmt      string
+	oomTopCandidateScoreMetricFmt string
+
 	// Timestamp for the previous generator specific metrics:
 	prevTs time.Time
 
@@ -330,17 +477,37 @@ type ProcPidMetrics struct {
 	// Page size, needed to convert some of the memory stats:
 	pageSize uint64
 
+	// Per Mems_allowed_list process counts, reported to the NUMA metrics
+	// generator, if enabled (see numa_metrics.go):
+	pidMemsAllowedCounts PidMemsAllowedCounts
+
+	// This partition's top OOM candidates, reported to the shared container
+	// (see proc_pid_oom_candidates.go):
+	pidOomCandidates []PidOomCandidate
+	// The merged top OOM candidates, current and previous, partition 0 only:
+	oomTopCandidates, prevOomTopCandidates []PidOomCandidate
+	// Cycle# for the above, used for full metrics cycles:
+	oomTopCycleNum int
+
 	// The following are needed for testing only. Left to their default values,
 	// the usual objects will be used.
-	instance, hostname  string
-	timeNowFn           func() time.Time
-	metricsQueue        MetricsQueue
-	procfsRoot          string
-	linuxClktckSec      float64
-	boottimeMsec        int64
-	newPidStatParser    procfs.NewPidStatParser
-	newPidStatusParser  procfs.NewPidStatusParser
-	newPidCmdlineParser procfs.NewPidCmdlineParser
+	instance, hostname      string
+	timeNowFn               func() time.Time
+	metricsQueue            MetricsQueue
+	procfsRoot              string
+	linuxClktckSec          float64
+	boottimeMsec            int64
+	newPidStatParser        procfs.NewPidStatParser
+	newPidStatusParser      procfs.NewPidStatusParser
+	newPidSchedstatParser   procfs.NewPidSchedstatParser
+	newPidSmapsRollupParser procfs.NewPidSmapsRollupParser
+	newPidOomScoreParser    procfs.NewPidOomScoreParser
+	newPidNsParser          procfs.NewPidNsParser
+	newPidCmdlineParser     procfs.NewPidCmdlineParser
+	// The container for the per Mems_allowed_list counts:
+	pidMemsAllowedContainer *PidMemsAllowedContainer
+	// The container for the top OOM candidates:
+	pidOomCandidatesContainer *PidOomCandidatesContainer
 }
 
 func NewProcProcPidMetrics(cfg any, partNo int, pidTidListCache procfs.PidTidListCacheIF) (*ProcPidMetrics, error) {
@@ -366,25 +533,33 @@ func NewProcProcPidMetrics(cfg any, partNo int, pidTidListCache procfs.PidTidLis
 	}
 
 	procPidMetrics := &ProcPidMetrics{
-		id:                  fmt.Sprintf("%s#%d", PROC_PID_METRICS_ID, partNo),
-		interval:            interval,
-		fullMetricsFactor:   procPidMetricsConfig.FullMetricsFactor,
-		usePidStatus:        procPidMetricsConfig.UsePidStatus,
-		pidTidListCache:     pidTidListCache,
-		partNo:              partNo,
-		pidTidMetricsInfo:   make(map[procfs.PidTid]*ProcPidTidMetricsInfo),
-		tsBuf:               &bytes.Buffer{},
-		pageSize:            uint64(os.Getpagesize()),
-		instance:            GlobalInstance,
-		hostname:            GlobalHostname,
-		timeNowFn:           time.Now,
-		metricsQueue:        GlobalMetricsQueue,
-		procfsRoot:          GlobalProcfsRoot,
-		linuxClktckSec:      utils.LinuxClktckSec,
-		boottimeMsec:        utils.OSBtime.UnixMilli(),
-		newPidStatParser:    procfs.NewPidStat,
-		newPidStatusParser:  procfs.NewPidStatus,
-		newPidCmdlineParser: procfs.NewPidCmdline,
+		id:                      fmt.Sprintf("%s#%d", PROC_PID_METRICS_ID, partNo),
+		interval:                interval,
+		fullMetricsFactor:       procPidMetricsConfig.FullMetricsFactor,
+		usePidStatus:            procPidMetricsConfig.UsePidStatus,
+		usePidSchedstat:         procPidMetricsConfig.UsePidSchedstat,
+		usePidSmapsRollup:       procPidMetricsConfig.UsePidSmapsRollup,
+		usePidOomScore:          procPidMetricsConfig.UsePidOomScore,
+		usePidNs:                procPidMetricsConfig.UsePidNs,
+		pidTidListCache:         pidTidListCache,
+		partNo:                  partNo,
+		pidTidMetricsInfo:       make(map[procfs.PidTid]*ProcPidTidMetricsInfo),
+		tsBuf:                   &bytes.Buffer{},
+		pageSize:                uint64(os.Getpagesize()),
+		instance:                GlobalInstance,
+		hostname:                GlobalHostname,
+		timeNowFn:               time.Now,
+		metricsQueue:            GlobalMetricsQueue,
+		procfsRoot:              GlobalProcfsRoot,
+		linuxClktckSec:          utils.LinuxClktckSec,
+		boottimeMsec:            utils.OSBtime.UnixMilli(),
+		newPidStatParser:        procfs.NewPidStat,
+		newPidStatusParser:      procfs.NewPidStatus,
+		newPidSchedstatParser:   procfs.NewPidSchedstat,
+		newPidSmapsRollupParser: procfs.NewPidSmapsRollup,
+		newPidOomScoreParser:    procfs.NewPidOomScore,
+		newPidNsParser:          procfs.NewPidNs,
+		newPidCmdlineParser:     procfs.NewPidCmdline,
 	}
 
 	procPidMetricsLog.Infof("id=%s", procPidMetrics.id)
@@ -405,6 +580,32 @@ func NewProcProcPidMetrics(cfg any, partNo int, pidTidListCache procfs.PidTidLis
 		}
 		procPidMetricsLog.Infof("pid_status_memory_fields=%v", procPidMetricsConfig.PidStatusMemoryFields)
 	}
+	procPidMetricsLog.Infof("use_pid_schedstat=%v", procPidMetrics.usePidSchedstat)
+	procPidMetricsLog.Infof("use_pid_smaps_rollup=%v", procPidMetrics.usePidSmapsRollup)
+
+	if procPidMetrics.usePidSmapsRollup && procPidMetricsConfig.PidSmapsRollupInterval != "" {
+		pidSmapsRollupInterval, err := time.ParseDuration(procPidMetricsConfig.PidSmapsRollupInterval)
+		if err != nil {
+			return nil, fmt.Errorf("pid_smaps_rollup_interval: %v", err)
+		}
+		if pidSmapsRollupInterval > 0 && interval > 0 {
+			procPidMetrics.pidSmapsRollupFactor = int((pidSmapsRollupInterval + interval - 1) / interval)
+		}
+		procPidMetricsLog.Infof(
+			"pid_smaps_rollup_interval=%s (config), %s (using)",
+			pidSmapsRollupInterval,
+			time.Duration(procPidMetrics.pidSmapsRollupFactor)*interval,
+		)
+	}
+	procPidMetricsLog.Infof("use_pid_oom_score=%v", procPidMetrics.usePidOomScore)
+	if procPidMetrics.usePidOomScore && procPidMetricsConfig.PidOomTopCandidates > 0 {
+		procPidMetrics.pidOomTopCandidates = procPidMetricsConfig.PidOomTopCandidates
+		procPidMetricsLog.Infof("pid_oom_top_candidates=%d", procPidMetrics.pidOomTopCandidates)
+	}
+	procPidMetricsLog.Infof("use_pid_ns=%v", procPidMetrics.usePidNs)
+	if procPidMetrics.usePidNs && !procPidMetrics.usePidStatus {
+		procPidMetricsLog.Warn("use_pid_ns: NStgid, NSpid require use_pid_status, the associated labels will be empty")
+	}
 
 	return procPidMetrics, nil
 }
@@ -645,6 +846,71 @@ func (pm *ProcPidMetrics) initMetricsCache() {
 		pm.perPidTidMetricCount += len(pm.pidStatusCtxMetricFmt)
 	}
 
+	if pm.usePidSchedstat {
+		pm.pidSchedstatPctMetricFmt = []*ProcPidMetricsIndexFmt{
+			{
+				procfs.PID_SCHEDSTAT_RUN_TIME,
+				pm.buildMetricFmt(PROC_PID_SCHEDSTAT_RUN_PCT_METRIC, "%.1f"),
+			},
+			{
+				procfs.PID_SCHEDSTAT_WAIT_TIME,
+				pm.buildMetricFmt(PROC_PID_SCHEDSTAT_WAIT_PCT_METRIC, "%.1f"),
+			},
+		}
+		pm.perPidTidMetricCount += len(pm.pidSchedstatPctMetricFmt)
+	}
+
+	if pm.usePidSmapsRollup {
+		pm.pidSmapsRollupMetricFmt = []*ProcPidMetricsIndexFmt{
+			{
+				procfs.PID_SMAPS_ROLLUP_PSS,
+				pm.buildMetricFmt(PROC_PID_SMAPS_ROLLUP_PSS_METRIC, "%d"),
+			},
+			{
+				procfs.PID_SMAPS_ROLLUP_PSS_ANON,
+				pm.buildMetricFmt(PROC_PID_SMAPS_ROLLUP_PSS_ANON_METRIC, "%d"),
+			},
+			{
+				procfs.PID_SMAPS_ROLLUP_PSS_FILE,
+				pm.buildMetricFmt(PROC_PID_SMAPS_ROLLUP_PSS_FILE_METRIC, "%d"),
+			},
+			{
+				procfs.PID_SMAPS_ROLLUP_PSS_SHMEM,
+				pm.buildMetricFmt(PROC_PID_SMAPS_ROLLUP_PSS_SHMEM_METRIC, "%d"),
+			},
+			{
+				procfs.PID_SMAPS_ROLLUP_SWAP_PSS,
+				pm.buildMetricFmt(PROC_PID_SMAPS_ROLLUP_SWAP_PSS_METRIC, "%d"),
+			},
+			{
+				procfs.PID_SMAPS_ROLLUP_PRIVATE_DIRTY,
+				pm.buildMetricFmt(PROC_PID_SMAPS_ROLLUP_PRIVATE_DIRTY_METRIC, "%d"),
+			},
+			{
+				procfs.PID_SMAPS_ROLLUP_SHARED_CLEAN,
+				pm.buildMetricFmt(PROC_PID_SMAPS_ROLLUP_SHARED_CLEAN_METRIC, "%d"),
+			},
+		}
+		pm.perPidOnlyMetricCount += len(pm.pidSmapsRollupMetricFmt)
+	}
+
+	if pm.usePidOomScore {
+		pm.pidOomScoreMetricFmt = pm.buildMetricFmt(PROC_PID_OOM_SCORE_METRIC, "%d")
+		pm.pidOomScoreAdjMetricFmt = pm.buildMetricFmt(PROC_PID_OOM_SCORE_ADJ_METRIC, "%d")
+		pm.perPidOnlyMetricCount += 2
+	}
+
+	if pm.usePidNs {
+		// The labels are built at runtime, since they are needed for clearing
+		// the previous metric as well:
+		pm.pidNsInfoMetricFmt = fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%%s,%%s} %%c %%s`+"\n",
+			PROC_PID_NS_INFO_METRIC,
+			INSTANCE_LABEL_NAME, pm.instance, HOSTNAME_LABEL_NAME, pm.hostname,
+		)
+		pm.perPidOnlyMetricCount++
+	}
+
 	pm.pidCmdlineMetricFmt = pm.buildMetricFmt(
 		PROC_PID_CMDLINE_METRIC, "%c",
 		PROC_PID_CMDLINE_CMD_PATH_LABEL_NAME, PROC_PID_CMDLINE_ARGS_LABEL_NAME, PROC_PID_CMDLINE_CMD_LABEL_NAME,
@@ -666,6 +932,26 @@ func (pm *ProcPidMetrics) initMetricsCache() {
 	pm.pidNewCountMetricFmt = pm.buildGeneratorSpecificMetricFmt(PROC_PID_NEW_COUNT_METRIC, "%d")
 	pm.pidDelCountMetricFmt = pm.buildGeneratorSpecificMetricFmt(PROC_PID_DEL_COUNT_METRIC, "%d")
 	pm.intervalMetricFmt = pm.buildGeneratorSpecificMetricFmt(PROC_PID_INTERVAL_METRIC, "%.6f")
+	if pm.usePidSmapsRollup {
+		pm.pidSmapsRollupParseCountMetricFmt = pm.buildGeneratorSpecificMetricFmt(PROC_PID_SMAPS_ROLLUP_PARSE_COUNT_METRIC, "%d")
+		pm.pidSmapsRollupParseErrCountMetricFmt = pm.buildGeneratorSpecificMetricFmt(PROC_PID_SMAPS_ROLLUP_PARSE_ERR_COUNT_METRIC, "%d")
+		pm.pidSmapsRollupParseSecMetricFmt = pm.buildGeneratorSpecificMetricFmt(PROC_PID_SMAPS_ROLLUP_PARSE_SEC_METRIC, "%.6f")
+	}
+	if pm.pidOomTopCandidates > 0 && pm.partNo == 0 {
+		// The top candidates are host level metrics, hence no partition label:
+		pm.oomTopCandidateMetricFmt = fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%%d",%s="%%d",%s="%%s"} %%c %%s`+"\n",
+			PROC_PID_OOM_TOP_CANDIDATE_METRIC,
+			INSTANCE_LABEL_NAME, pm.instance, HOSTNAME_LABEL_NAME, pm.hostname,
+			PROC_PID_OOM_RANK_LABEL_NAME, PROC_PID_PID_LABEL_NAME, PROC_PID_OOM_COMM_LABEL_NAME,
+		)
+		pm.oomTopCandidateScoreMetricFmt = fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%%d"} %%d %%s`+"\n",
+			PROC_PID_OOM_TOP_CANDIDATE_SCORE_METRIC,
+			INSTANCE_LABEL_NAME, pm.instance, HOSTNAME_LABEL_NAME, pm.hostname,
+			PROC_PID_OOM_RANK_LABEL_NAME,
+		)
+	}
 }
 
 func (pm *ProcPidMetrics) initialize() {
@@ -675,6 +961,21 @@ func (pm *ProcPidMetrics) initialize() {
 	if pm.usePidStatus {
 		pm.pidStatus = pm.newPidStatusParser()
 	}
+	if pm.usePidSchedstat {
+		pm.pidSchedstat = pm.newPidSchedstatParser()
+	}
+	if pm.usePidSmapsRollup {
+		pm.pidSmapsRollup = pm.newPidSmapsRollupParser()
+	}
+	if pm.usePidOomScore {
+		pm.pidOomScore = pm.newPidOomScoreParser()
+	}
+	if pm.usePidNs {
+		pm.pidNs = pm.newPidNsParser()
+	}
+	if pm.pidOomTopCandidates > 0 && pm.partNo == 0 {
+		pm.oomTopCycleNum = initialCycleNum.Get(pm.fullMetricsFactor)
+	}
 	pm.pidCmdline = pm.newPidCmdlineParser()
 	pm.intialized = true
 }
@@ -708,6 +1009,12 @@ func (pm *ProcPidMetrics) initPidTidMetricsInfo(pidTid procfs.PidTid, pidTidPath
 	if pm.usePidStatus {
 		pidTidMetricsInfo.pidStatus = pm.newPidStatusParser()
 	}
+	if pm.usePidSchedstat {
+		pidTidMetricsInfo.pidSchedstat = pm.newPidSchedstatParser()
+	}
+	if pm.usePidSmapsRollup && pidTid.Tid == procfs.PID_ONLY_TID {
+		pidTidMetricsInfo.pidSmapsRollup = pm.newPidSmapsRollupParser()
+	}
 
 	return pidTidMetricsInfo
 }
@@ -952,6 +1259,25 @@ func (pm *ProcPidMetrics) generateMetrics(
 				pidTidMetricsInfo.pidStatusCtxZeroDelta[i] = delta == 0
 			}
 		}
+
+		if pm.usePidSchedstat && pidTidMetricsInfo.pidSchedstatParsed && pidTidMetricsInfo.pidSchedstatHasPrev {
+			currPidSchedstatNF := pm.pidSchedstat.GetData()
+			prevPidSchedstatNF := pidTidMetricsInfo.pidSchedstat.GetData()
+			// The times are in nanoseconds and the delta is relative to the
+			// most recent parse, which may predate the most recent scan:
+			pctFactor := 100. / (currTs.Sub(pidTidMetricsInfo.pidSchedstatTs).Seconds() * 1e9)
+			for _, indexFmt := range pm.pidSchedstatPctMetricFmt {
+				delta := currPidSchedstatNF[indexFmt.index] - prevPidSchedstatNF[indexFmt.index]
+				fmt.Fprintf(
+					buf,
+					indexFmt.fmt,
+					pidTidMetricsInfo.pidTidLabels,
+					float64(delta)*pctFactor,
+					ts,
+				)
+				actualMetricsCount++
+			}
+		}
 	}
 
 	if !isPid {
@@ -1120,6 +1446,63 @@ func (pm *ProcPidMetrics) generateMetrics(
 		}
 	}
 
+	if pm.usePidSmapsRollup && pidTidMetricsInfo.pidSmapsRollupSampled {
+		currPidSmapsRollupNF, currPidSmapsRollupFound := pm.pidSmapsRollup.GetData()
+		var prevPidSmapsRollupNF []uint64
+		if pidTidMetricsInfo.pidSmapsRollupHasPrev {
+			prevPidSmapsRollupNF, _ = pidTidMetricsInfo.pidSmapsRollup.GetData()
+		}
+		for _, indexFmt := range pm.pidSmapsRollupMetricFmt {
+			if !currPidSmapsRollupFound[indexFmt.index] {
+				// Some fields may be missing, for instance for older kernels:
+				continue
+			}
+			if fullMetricsNoPrev || prevPidSmapsRollupNF == nil ||
+				prevPidSmapsRollupNF[indexFmt.index] != currPidSmapsRollupNF[indexFmt.index] {
+				fmt.Fprintf(
+					buf,
+					indexFmt.fmt,
+					pidTidMetricsInfo.pidTidLabels,
+					currPidSmapsRollupNF[indexFmt.index],
+					ts,
+				)
+				actualMetricsCount++
+			}
+		}
+	}
+
+	if pm.usePidOomScore && fullMetricsNoPrev {
+		fmt.Fprintf(buf, pm.pidOomScoreMetricFmt, pidTidMetricsInfo.pidTidLabels, pidTidMetricsInfo.oomScore, ts)
+		fmt.Fprintf(buf, pm.pidOomScoreAdjMetricFmt, pidTidMetricsInfo.pidTidLabels, pidTidMetricsInfo.oomScoreAdj, ts)
+		actualMetricsCount += 2
+	}
+
+	if pm.usePidNs && fullMetricsNoPrev && pidTidMetricsInfo.pidNsParsed {
+		pidNsInfoLabels := pm.buildPidNsInfoLabels(currPidStatusBSF)
+		if pidTidMetricsInfo.pidNsInfoLabels != "" && pidTidMetricsInfo.pidNsInfoLabels != pidNsInfoLabels {
+			// Clear prev metric:
+			fmt.Fprintf(
+				buf,
+				pm.pidNsInfoMetricFmt,
+				pidTidMetricsInfo.pidTidLabels,
+				pidTidMetricsInfo.pidNsInfoLabels,
+				'0',
+				ts,
+			)
+			actualMetricsCount++
+		}
+		fmt.Fprintf(
+			buf,
+			pm.pidNsInfoMetricFmt,
+			pidTidMetricsInfo.pidTidLabels,
+			pidNsInfoLabels,
+			'1',
+			ts,
+		)
+		actualMetricsCount++
+		pidTidMetricsInfo.pidNsInfoLabels = pidNsInfoLabels
+	}
+
 	if fullMetricsNoPrev {
 		cmdPath, args, cmd := pm.pidCmdline.GetData()
 		if len(cmdPath) != 0 {
@@ -1159,6 +1542,93 @@ func (pm *ProcPidMetrics) generateMetrics(
 	return actualMetricsCount
 }
 
+// Build the namespace info labels, based on the most recent /proc/PID/ns/* and
+// /proc/PID/status, if available:
+func (pm *ProcPidMetrics) buildPidNsInfoLabels(pidStatusBSF [][]byte) string {
+	labels := &strings.Builder{}
+	for i, inode := range pm.pidNs.GetData() {
+		if i > 0 {
+			labels.WriteByte(',')
+		}
+		fmt.Fprintf(labels, `%s%s="%s"`, procfs.PidNsNames[i], PROC_PID_NS_INFO_LABEL_NAME_SUFFIX, inode)
+	}
+
+	// The NStgid, NSpid lists start w/ the root namespace, the last value is
+	// the one from the innermost namespace, i.e. as seen inside a container:
+	var nsTgid, nsPid []byte
+	nsLevel := ""
+	if pidStatusBSF != nil {
+		nsTgid, nsPid = pidStatusBSF[procfs.PID_STATUS_NSTGID], pidStatusBSF[procfs.PID_STATUS_NSPID]
+		if i := bytes.LastIndexByte(nsTgid, procfs.PID_STATUS_LIST_DATA_SEP); i >= 0 {
+			nsTgid = nsTgid[i+1:]
+		}
+		if len(nsPid) > 0 {
+			nsLevel = strconv.Itoa(bytes.Count(nsPid, []byte{procfs.PID_STATUS_LIST_DATA_SEP}))
+		}
+		if i := bytes.LastIndexByte(nsPid, procfs.PID_STATUS_LIST_DATA_SEP); i >= 0 {
+			nsPid = nsPid[i+1:]
+		}
+	}
+	fmt.Fprintf(
+		labels,
+		`,%s="%s",%s="%s",%s="%s"`,
+		PROC_PID_NS_INFO_NS_PID_LABEL_NAME, nsPid,
+		PROC_PID_NS_INFO_NS_TGID_LABEL_NAME, nsTgid,
+		PROC_PID_NS_INFO_NS_LEVEL_LABEL_NAME, nsLevel,
+	)
+	return labels.String()
+}
+
+// Generate the host level top OOM candidates metrics, merged across all
+// partitions; return the actual and total metrics counts:
+func (pm *ProcPidMetrics) generateOomTopCandidatesMetrics(
+	pidOomCandidatesContainer *PidOomCandidatesContainer,
+	buf *bytes.Buffer,
+	ts []byte,
+) (int, int) {
+	actualMetricsCount, totalMetricsCount := 0, 0
+
+	fullMetrics := pm.oomTopCycleNum == 0
+	currCandidates := pidOomCandidatesContainer.SnapTop(pm.pidOomTopCandidates, pm.oomTopCandidates)
+	prevCandidates := pm.prevOomTopCandidates
+	for i := 0; i < pm.pidOomTopCandidates; i++ {
+		var curr, prev *PidOomCandidate
+		if i < len(currCandidates) {
+			curr = &currCandidates[i]
+		}
+		if i < len(prevCandidates) {
+			prev = &prevCandidates[i]
+		}
+		rank := i + 1
+		changed := prev != nil && (curr == nil || curr.Pid != prev.Pid || curr.Comm != prev.Comm)
+		if changed {
+			// Clear prev metric:
+			fmt.Fprintf(buf, pm.oomTopCandidateMetricFmt, rank, prev.Pid, prev.Comm, '0', ts)
+			actualMetricsCount++
+		}
+		if curr == nil {
+			continue
+		}
+		if fullMetrics || prev == nil || changed {
+			fmt.Fprintf(buf, pm.oomTopCandidateMetricFmt, rank, curr.Pid, curr.Comm, '1', ts)
+			actualMetricsCount++
+		}
+		if fullMetrics || prev == nil || curr.OomScore != prev.OomScore {
+			fmt.Fprintf(buf, pm.oomTopCandidateScoreMetricFmt, rank, curr.OomScore, ts)
+			actualMetricsCount++
+		}
+		totalMetricsCount += 2
+	}
+
+	// Current becomes previous and the old previous storage will be reused:
+	pm.oomTopCandidates, pm.prevOomTopCandidates = prevCandidates, currCandidates
+	if pm.oomTopCycleNum++; pm.oomTopCycleNum >= pm.fullMetricsFactor {
+		pm.oomTopCycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
 // Satisfy the TaskActivity interface:
 func (pm *ProcPidMetrics) Execute() bool {
 	// If this is the 1st call, initialize various structures:
@@ -1187,6 +1657,8 @@ func (pm *ProcPidMetrics) Execute() bool {
 	actualMetricsCount := 0
 	bufTargetSize := pm.metricsQueue.GetTargetSize()
 	pidTidCount, pidOnlyCount, activePidTidCount, addPidCount, delPidCount := 0, 0, 0, 0, 0
+	pidSmapsRollupParseCount, pidSmapsRollupParseErrCount := 0, 0
+	pidSmapsRollupParseDuration := time.Duration(0)
 	byteCount := 0
 	var buf *bytes.Buffer
 
@@ -1250,6 +1722,12 @@ func (pm *ProcPidMetrics) Execute() bool {
 			}
 		}
 
+		// Whether smaps_rollup is due for sampling based on the number of scans
+		// since the last sample. This applies to inactive processes as well,
+		// since PSS changes when other sharers exit or fork:
+		pidSmapsRollupDue := hasPrev && isPid && pm.usePidSmapsRollup && pm.pidSmapsRollupFactor > 0 &&
+			pidTidMetricsInfo.pidSmapsRollupCycleNum >= pm.pidSmapsRollupFactor
+
 		// Active?
 		active := false
 		if !hasPrev {
@@ -1259,13 +1737,19 @@ func (pm *ProcPidMetrics) Execute() bool {
 		} else if currPidStatNF[procfs.PID_STAT_UTIME] != prevPidStatNF[procfs.PID_STAT_UTIME] ||
 			currPidStatNF[procfs.PID_STAT_STIME] != prevPidStatNF[procfs.PID_STAT_STIME] {
 			active = true
-		} else if !fullMetrics && !pidTidMetricsInfo.active {
-			// Inactive after inactive, non full metrics cycle. Mark it as
-			// scanned but otherwise do nothing:
+		} else if !fullMetrics && !pidTidMetricsInfo.active && !pidSmapsRollupDue {
+			// Inactive after inactive, non full metrics cycle and no
+			// smaps_rollup sampling. Mark it as scanned but otherwise do
+			// nothing:
 			pidTidMetricsInfo.cycleNum++
 			if pidTidMetricsInfo.cycleNum >= pm.fullMetricsFactor {
 				pidTidMetricsInfo.cycleNum = 0
 			}
+			if pidTidMetricsInfo.pidSmapsRollupCycleNum < pm.pidSmapsRollupFactor {
+				pidTidMetricsInfo.pidSmapsRollupCycleNum++
+			}
+			pidTidMetricsInfo.pidSchedstatParsed = false
+			pidTidMetricsInfo.pidSmapsRollupSampled = false
 			pidTidMetricsInfo.scanNum = scanNum
 			pidTidMetricsInfo.prevTs = pm.timeNowFn()
 			// (Re)add to the tail of LRU:
@@ -1296,6 +1780,46 @@ func (pm *ProcPidMetrics) Execute() bool {
 				continue
 			}
 		}
+		// The schedstat file is not available if the kernel was built w/o
+		// CONFIG_SCHEDSTATS, as such parse errors are not fatal for the PID,
+		// TID, the metrics are simply skipped:
+		pidTidMetricsInfo.pidSchedstatParsed = pm.usePidSchedstat &&
+			pm.pidSchedstat.Parse(pidTidPath) == nil
+		// The smaps_rollup file is expensive to read, it is sampled only for
+		// full metrics cycles or every N scans, as configured. Parse errors are
+		// not fatal for the PID, since the file may not be accessible due to
+		// ptrace access mode checks:
+		pidTidMetricsInfo.pidSmapsRollupSampled = false
+		if isPid && pm.usePidSmapsRollup && (fullMetrics || !hasPrev || pidSmapsRollupDue) {
+			parseStart := time.Now()
+			err = pm.pidSmapsRollup.Parse(pidTidPath)
+			pidSmapsRollupParseDuration += time.Since(parseStart)
+			pidSmapsRollupParseCount++
+			if err != nil {
+				pidSmapsRollupParseErrCount++
+			} else {
+				pidTidMetricsInfo.pidSmapsRollupSampled = true
+			}
+			pidTidMetricsInfo.pidSmapsRollupCycleNum = 0
+		}
+		if isPid && pm.usePidOomScore && (fullMetrics || !hasPrev) {
+			err = pm.pidOomScore.Parse(pidTidPath)
+			if err != nil {
+				procPidMetricsLog.Error(err)
+				if hasPrev {
+					delete(pm.pidTidMetricsInfo, pidTid)
+					delPidCount++
+				}
+				continue
+			}
+			pidTidMetricsInfo.oomScore, pidTidMetricsInfo.oomScoreAdj = pm.pidOomScore.GetData()
+			pidTidMetricsInfo.hasOomScore = true
+		}
+		// The namespace links are subject to ptrace access mode checks, as
+		// such parse errors are not fatal for the PID, the metric is simply
+		// skipped:
+		pidTidMetricsInfo.pidNsParsed = isPid && pm.usePidNs && (fullMetrics || !hasPrev) &&
+			pm.pidNs.Parse(pidTidPath) == nil
 		if isPid && (fullMetrics || !hasPrev) {
 			err = pm.pidCmdline.Parse(pidTidPath)
 			if err != nil {
@@ -1323,6 +1847,18 @@ func (pm *ProcPidMetrics) Execute() bool {
 		if pm.usePidStatus {
 			pidTidMetricsInfo.pidStatus, pm.pidStatus = pm.pidStatus, pidTidMetricsInfo.pidStatus
 		}
+		if pidTidMetricsInfo.pidSchedstatParsed {
+			pidTidMetricsInfo.pidSchedstat, pm.pidSchedstat = pm.pidSchedstat, pidTidMetricsInfo.pidSchedstat
+			pidTidMetricsInfo.pidSchedstatHasPrev = true
+			pidTidMetricsInfo.pidSchedstatTs = currTs
+		}
+		if pidTidMetricsInfo.pidSmapsRollupSampled {
+			pidTidMetricsInfo.pidSmapsRollup, pm.pidSmapsRollup = pm.pidSmapsRollup, pidTidMetricsInfo.pidSmapsRollup
+			pidTidMetricsInfo.pidSmapsRollupHasPrev = true
+		}
+		if pidTidMetricsInfo.pidSmapsRollupCycleNum < pm.pidSmapsRollupFactor {
+			pidTidMetricsInfo.pidSmapsRollupCycleNum++
+		}
 		// Mark it as scanned:
 		pidTidMetricsInfo.prevTs = currTs
 		pidTidMetricsInfo.cycleNum++
@@ -1365,6 +1901,56 @@ func (pm *ProcPidMetrics) Execute() bool {
 		pidTidMetricsInfo.prev = nil
 	}
 
+	// Report the per Mems_allowed_list process counts, as needed; at this point
+	// the LRU list contains only the PID, TID found in the current scan:
+	pidMemsAllowedContainer := GlobalPidMemsAllowedContainer
+	if pm.pidMemsAllowedContainer != nil {
+		pidMemsAllowedContainer = pm.pidMemsAllowedContainer
+	}
+	if pidMemsAllowedContainer != nil && pm.usePidStatus {
+		if pm.pidMemsAllowedCounts == nil {
+			pm.pidMemsAllowedCounts = make(PidMemsAllowedCounts)
+		} else {
+			clear(pm.pidMemsAllowedCounts)
+		}
+		for pidTidMetricsInfo := pm.pidTidMetricsInfoHead; pidTidMetricsInfo != nil; pidTidMetricsInfo = pidTidMetricsInfo.next {
+			if pidTidMetricsInfo.pidTid.Tid != procfs.PID_ONLY_TID || pidTidMetricsInfo.pidStatus == nil {
+				continue
+			}
+			pidStatusBSF, _, _ := pidTidMetricsInfo.pidStatus.GetData()
+			if memsAllowed := pidStatusBSF[procfs.PID_STATUS_MEMS_ALLOWED_LIST]; len(memsAllowed) > 0 {
+				pm.pidMemsAllowedCounts[string(memsAllowed)]++
+			}
+		}
+		pidMemsAllowedContainer.Update(pm.partNo, pm.pidMemsAllowedCounts)
+	}
+
+	// Report the top OOM candidates, as needed:
+	pidOomCandidatesContainer := GlobalPidOomCandidatesContainer
+	if pm.pidOomCandidatesContainer != nil {
+		pidOomCandidatesContainer = pm.pidOomCandidatesContainer
+	}
+	if pidOomCandidatesContainer != nil && pm.pidOomTopCandidates > 0 {
+		pm.pidOomCandidates = pm.pidOomCandidates[:0]
+		candidate := &PidOomCandidate{}
+		for pidTidMetricsInfo := pm.pidTidMetricsInfoHead; pidTidMetricsInfo != nil; pidTidMetricsInfo = pidTidMetricsInfo.next {
+			if pidTidMetricsInfo.pidTid.Tid != procfs.PID_ONLY_TID || !pidTidMetricsInfo.hasOomScore {
+				continue
+			}
+			candidate.Pid = pidTidMetricsInfo.pidTid.Pid
+			candidate.OomScore = pidTidMetricsInfo.oomScore
+			candidate.OomScoreAdj = pidTidMetricsInfo.oomScoreAdj
+			if n := len(pm.pidOomCandidates); n == pm.pidOomTopCandidates && !candidate.ranksAbove(&pm.pidOomCandidates[n-1]) {
+				continue
+			}
+			// The COMM is needed only for the retained candidates:
+			pidStatBSF, _ := pidTidMetricsInfo.pidStat.GetData()
+			candidate.Comm = string(pidStatBSF[procfs.PID_STAT_COMM])
+			pm.pidOomCandidates = insertPidOomCandidate(pm.pidOomCandidates, candidate, pm.pidOomTopCandidates)
+		}
+		pidOomCandidatesContainer.Update(pm.partNo, pm.pidOomCandidates)
+	}
+
 	// This generator's specific metrics:
 	currTs := pm.timeNowFn()
 	pm.tsBuf.Reset()
@@ -1385,12 +1971,27 @@ func (pm *ProcPidMetrics) Execute() bool {
 		fmt.Fprintf(buf, pm.intervalMetricFmt, currTs.Sub(pm.prevTs).Seconds(), ts)
 		actualMetricsCount++
 	}
+	specificMetricsCount := PROC_PID_SPECIFIC_METRICS_COUNT
+	if pm.usePidSmapsRollup {
+		fmt.Fprintf(buf, pm.pidSmapsRollupParseCountMetricFmt, pidSmapsRollupParseCount, ts)
+		fmt.Fprintf(buf, pm.pidSmapsRollupParseErrCountMetricFmt, pidSmapsRollupParseErrCount, ts)
+		fmt.Fprintf(buf, pm.pidSmapsRollupParseSecMetricFmt, pidSmapsRollupParseDuration.Seconds(), ts)
+		actualMetricsCount += PROC_PID_SMAPS_ROLLUP_SPECIFIC_METRICS_COUNT
+		specificMetricsCount += PROC_PID_SMAPS_ROLLUP_SPECIFIC_METRICS_COUNT
+	}
+	if pidOomCandidatesContainer != nil && pm.pidOomTopCandidates > 0 && pm.partNo == 0 {
+		oomTopActualMetricsCount, oomTopTotalMetricsCount := pm.generateOomTopCandidatesMetrics(
+			pidOomCandidatesContainer, buf, ts,
+		)
+		actualMetricsCount += oomTopActualMetricsCount
+		specificMetricsCount += oomTopTotalMetricsCount
+	}
 	byteCount += buf.Len()
 	pm.metricsQueue.QueueBuf(buf)
 	pm.prevTs = currTs
 
 	// Generator stats:
-	totalMetricsCount := pm.perPidTidMetricCount*pidTidCount + pm.perPidOnlyMetricCount*pidOnlyCount + PROC_PID_SPECIFIC_METRICS_COUNT
+	totalMetricsCount := pm.perPidTidMetricCount*pidTidCount + pm.perPidOnlyMetricCount*pidOnlyCount + specificMetricsCount
 	GlobalMetricsGeneratorStatsContainer.Update(
 		pm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
 	)
@@ -1434,6 +2035,12 @@ func ProcPidMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
 	)
 	procPidMetricsLog.Infof("pid_list_cache_valid_interval=%s", validFor)
 	pidTidListCache := procfs.NewPidTidListCache(GlobalProcfsRoot, numPart, validFor, flags)
+	// Make it available to other generators, which need the PID/TID counts:
+	GlobalPidTidListCache = pidTidListCache
+	// The top OOM candidates are merged across partitions:
+	if procPidMetricsConfig.UsePidOomScore && procPidMetricsConfig.PidOomTopCandidates > 0 {
+		GlobalPidOomCandidatesContainer = NewPidOomCandidatesContainer()
+	}
 
 	tasks := make([]*Task, numPart)
 	for partNo := 0; partNo < numPart; partNo++ {
@@ -46,6 +46,10 @@ type ProcPidMetricsExecuteTestCase struct {
 	PartNo            int
 	FullMetricsFactor int
 	UsePidStatus      bool
+	UsePidSchedstat   bool
+	UsePidSmapsRollup bool
+	UsePidOomScore    bool
+	UsePidNs          bool
 	ScanNum           int
 
 	PageSize uint64
@@ -95,6 +99,10 @@ func (testPidTidListCache *TestPidTidListCache) Invalidate() {}
 
 func (testPidTidListCache *TestPidTidListCache) GetRefreshCount() uint64 { return 0 }
 
+func (testPidTidListCache *TestPidTidListCache) GetPidTidCount() (int, int, error) {
+	return len(testPidTidListCache.pidTidList), -1, nil
+}
+
 func testProcPidMetricsGenerate(tc *ProcPidMetricsGenerateTestCase, t *testing.T) {
 	tlc := testutils.NewTestLogCollect(t, Log, nil)
 	defer tlc.RestoreLog()
@@ -118,11 +126,22 @@ func testProcPidMetricsGenerate(tc *ProcPidMetricsGenerateTestCase, t *testing.T
 	pm.linuxClktckSec = tc.LinuxClktckSec
 	pm.boottimeMsec = tc.BoottimeMsec
 
+	pm.usePidSchedstat = tc.ParserData.PidSchedstat != nil
+	pm.usePidSmapsRollup = tc.ParserData.PidSmapsRollup != nil
+	pm.usePidOomScore = tc.ParserData.PidOomScore != nil
+	pm.usePidNs = tc.ParserData.PidNs != nil
+
 	tpp := TestPidParsers{}
 	pm.newPidStatParser = tpp.NewPidStat
 	if pm.usePidStatus {
 		pm.newPidStatusParser = tpp.NewPidStatus
 	}
+	if pm.usePidSchedstat {
+		pm.newPidSchedstatParser = tpp.NewPidSchedstat
+	}
+	if pm.usePidSmapsRollup {
+		pm.newPidSmapsRollupParser = tpp.NewPidSmapsRollup
+	}
 
 	var pidTidMetricsInfo *ProcPidTidMetricsInfo
 	if tc.PidTidMetricsInfo != nil {
@@ -137,6 +156,29 @@ func testProcPidMetricsGenerate(tc *ProcPidMetricsGenerateTestCase, t *testing.T
 		pm.pidStatus = &TestPidStatus{}
 		setTestPidStatusData(pm.pidStatus, tc.ParserData.PidStatus)
 	}
+	if pm.usePidSchedstat {
+		pm.pidSchedstat = &TestPidSchedstat{}
+		setTestPidSchedstatData(pm.pidSchedstat, tc.ParserData.PidSchedstat)
+		// Emulate parsing, it is done by the caller, i.e. Execute:
+		pidTidMetricsInfo.pidSchedstatParsed = true
+	}
+	if pm.usePidSmapsRollup {
+		pm.pidSmapsRollup = &TestPidSmapsRollup{}
+		setTestPidSmapsRollupData(pm.pidSmapsRollup, tc.ParserData.PidSmapsRollup)
+		// Emulate sampling, it is decided by the caller, i.e. Execute:
+		pidTidMetricsInfo.pidSmapsRollupSampled = true
+	}
+	if pm.usePidOomScore {
+		// Emulate parsing, the values are stored by the caller, i.e. Execute:
+		pidTidMetricsInfo.oomScore = tc.ParserData.PidOomScore.OomScore
+		pidTidMetricsInfo.oomScoreAdj = tc.ParserData.PidOomScore.OomScoreAdj
+		pidTidMetricsInfo.hasOomScore = true
+	}
+	if pm.usePidNs {
+		pm.pidNs = &TestPidNs{parsedData: tc.ParserData.PidNs}
+		// Emulate parsing, it is done by the caller, i.e. Execute:
+		pidTidMetricsInfo.pidNsParsed = true
+	}
 	pm.pidCmdline = &TestPidCmdline{}
 	setTestPidCmdlineData(pm.pidCmdline, tc.ParserData.PidCmdline)
 
@@ -213,11 +255,19 @@ func testProcPidMetricsExecute(tc *ProcPidMetricsExecuteTestCase, t *testing.T)
 	pm.boottimeMsec = tc.BoottimeMsec
 	pm.fullMetricsFactor = tc.FullMetricsFactor
 	pm.usePidStatus = tc.UsePidStatus
+	pm.usePidSchedstat = tc.UsePidSchedstat
+	pm.usePidSmapsRollup = tc.UsePidSmapsRollup
+	pm.usePidOomScore = tc.UsePidOomScore
+	pm.usePidNs = tc.UsePidNs
 	pm.scanNum = tc.ScanNum
 
 	tpp := NewTestPidParsers(tc.PidParsersDataList, tc.ProcfsRoot, tc.CurrUnixMilli)
 	pm.newPidStatParser = tpp.NewPidStat
 	pm.newPidStatusParser = tpp.NewPidStatus
+	pm.newPidSchedstatParser = tpp.NewPidSchedstat
+	pm.newPidSmapsRollupParser = tpp.NewPidSmapsRollup
+	pm.newPidOomScoreParser = tpp.NewPidOomScore
+	pm.newPidNsParser = tpp.NewPidNs
 	pm.newPidCmdlineParser = tpp.NewPidCmdline
 	pm.timeNowFn = tpp.timeNow
 
@@ -333,3 +383,714 @@ func TestProcPidMetricsExecute(t *testing.T) {
 		)
 	}
 }
+
+// Build minimal PidStat data, for test cases targeting optional parsers:
+func buildTestPidStatParsedData(utime, stime uint64) *TestPidStatParsedData {
+	pidStatData := &TestPidStatParsedData{
+		ByteSliceFields: make([]string, procfs.PID_STAT_BYTE_SLICE_NUM_FIELDS),
+		NumericFields:   make([]uint64, procfs.PID_STAT_ULONG_NUM_FIELDS),
+	}
+	for i := range pidStatData.ByteSliceFields {
+		pidStatData.ByteSliceFields[i] = "0"
+	}
+	pidStatData.ByteSliceFields[procfs.PID_STAT_COMM] = "comm"
+	pidStatData.ByteSliceFields[procfs.PID_STAT_STATE] = "S"
+	pidStatData.NumericFields[procfs.PID_STAT_UTIME] = utime
+	pidStatData.NumericFields[procfs.PID_STAT_STIME] = stime
+	return pidStatData
+}
+
+func TestProcPidMetricsGenerateSchedstat(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	prevUnixMilli := int64(1_700_000_000_000)
+	currUnixMilli := prevUnixMilli + 1_000
+
+	for _, pidTid := range []*procfs.PidTid{
+		{Pid: 1000, Tid: procfs.PID_ONLY_TID},
+		{Pid: 1000, Tid: 1001},
+	} {
+		pidTidLabels := fmt.Sprintf(`%s="%d"`, PROC_PID_PID_LABEL_NAME, pidTid.Pid)
+		if pidTid.Tid != procfs.PID_ONLY_TID {
+			pidTidLabels += fmt.Sprintf(`,%s="%d"`, PROC_PID_TID_LABEL_NAME, pidTid.Tid)
+		}
+		tc := &ProcPidMetricsGenerateTestCase{
+			Name:           fmt.Sprintf("pid=%d,tid=%d", pidTid.Pid, pidTid.Tid),
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			PidTidMetricsInfo: &TestPidParserStateData{
+				PidStat: buildTestPidStatParsedData(100, 100),
+				PidSchedstat: &TestPidSchedstatParsedData{
+					NumericFields: []uint64{1_000_000_000, 100_000_000, 10},
+				},
+				UnixMilli: prevUnixMilli,
+				Active:    true,
+				PidTid:    pidTid,
+			},
+			ParserData: &TestPidParserStateData{
+				PidStat: buildTestPidStatParsedData(150, 100),
+				PidSchedstat: &TestPidSchedstatParsedData{
+					NumericFields: []uint64{1_500_000_000, 125_000_000, 20},
+				},
+				PidCmdline: &TestPidCmdlineParsedData{},
+				UnixMilli:  currUnixMilli,
+				PidTid:     pidTid,
+			},
+			// cpu_num, minflt/majflt deltas, 3 x pcpu and 2 x schedstat pct; the
+			// other metrics are unchanged:
+			WantMetricsCount: 8,
+			WantMetrics: []string{
+				fmt.Sprintf(
+					`%s{instance="%s",hostname="%s",%s} 50.0 %d`,
+					PROC_PID_SCHEDSTAT_RUN_PCT_METRIC, instance, hostname, pidTidLabels, currUnixMilli,
+				),
+				fmt.Sprintf(
+					`%s{instance="%s",hostname="%s",%s} 2.5 %d`,
+					PROC_PID_SCHEDSTAT_WAIT_PCT_METRIC, instance, hostname, pidTidLabels, currUnixMilli,
+				),
+			},
+		}
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcPidMetricsGenerate(tc, t) },
+		)
+	}
+}
+
+func TestProcPidMetricsExecuteSchedstat(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+	savedGlobalMetricsGeneratorStatsContainer := GlobalMetricsGeneratorStatsContainer
+	defer func() { GlobalMetricsGeneratorStatsContainer = savedGlobalMetricsGeneratorStatsContainer }()
+	GlobalMetricsGeneratorStatsContainer = NewMetricsGeneratorStatsContainer()
+
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	procfsRoot := "/proc"
+	pidTid := procfs.PidTid{Pid: 1000, Tid: procfs.PID_ONLY_TID}
+
+	procPidMetricsConfig := DefaultProcPidMetricsConfig()
+	procPidMetricsConfig.Interval = "1s"
+	procPidMetricsConfig.FullMetricsFactor = 1000
+	procPidMetricsConfig.UsePidSchedstat = true
+	pm, err := NewProcProcPidMetrics(procPidMetricsConfig, 0, &TestPidTidListCache{[]procfs.PidTid{pidTid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unixMilli := int64(1_700_000_000_000)
+	parserData := &TestPidParserStateData{
+		PidStat:    buildTestPidStatParsedData(100, 100),
+		PidStatus:  &TestPidStatusParsedData{},
+		PidCmdline: &TestPidCmdlineParsedData{},
+		UnixMilli:  unixMilli,
+		PidTid:     &pidTid,
+	}
+	parserData.PidStatus.ByteSliceFields = make([]string, procfs.PID_STATUS_BYTE_SLICE_NUM_FIELDS)
+	parserData.PidStatus.ByteSliceFieldUnit = make([]string, procfs.PID_STATUS_BYTE_SLICE_NUM_FIELDS)
+	parserData.PidStatus.NumericFields = make([]uint64, procfs.PID_STATUS_ULONG_NUM_FIELDS)
+
+	tpp := NewTestPidParsers([]*TestPidParserStateData{parserData}, procfsRoot, unixMilli)
+	pm.procfsRoot = procfsRoot
+	pm.instance = instance
+	pm.hostname = hostname
+	pm.linuxClktckSec = 0.01
+	pm.newPidStatParser = tpp.NewPidStat
+	pm.newPidStatusParser = tpp.NewPidStatus
+	pm.newPidSchedstatParser = tpp.NewPidSchedstat
+	pm.newPidCmdlineParser = tpp.NewPidCmdline
+	pm.timeNowFn = tpp.timeNow
+
+	schedstatMetrics := func(runPct, waitPct string, unixMilli int64) []string {
+		return []string{
+			fmt.Sprintf(
+				`%s{instance="%s",hostname="%s",%s="%d"} %s %d`,
+				PROC_PID_SCHEDSTAT_RUN_PCT_METRIC, instance, hostname, PROC_PID_PID_LABEL_NAME, pidTid.Pid, runPct, unixMilli,
+			),
+			fmt.Sprintf(
+				`%s{instance="%s",hostname="%s",%s="%d"} %s %d`,
+				PROC_PID_SCHEDSTAT_WAIT_PCT_METRIC, instance, hostname, PROC_PID_PID_LABEL_NAME, pidTid.Pid, waitPct, unixMilli,
+			),
+		}
+	}
+
+	// 1 scan/sec; the run and wait times are in nanoseconds, nil for a
+	// missing schedstat file:
+	for scan, step := range []struct {
+		utime         uint64
+		schedstat     []uint64
+		wantParsed    bool
+		wantSchedstat []string
+	}{
+		{100, []uint64{1_000_000_000, 0, 10}, true, nil},
+		{110, []uint64{1_500_000_000, 100_000_000, 20}, true, schedstatMetrics("50.0", "10.0", unixMilli+1_000)},
+		// Inactive after active, not short-circuited; waiting for the CPU:
+		{110, []uint64{1_500_000_000, 300_000_000, 21}, true, schedstatMetrics("0.0", "20.0", unixMilli+2_000)},
+		// Inactive after inactive, the schedstat file is not parsed:
+		{110, []uint64{1_500_000_000, 500_000_000, 22}, false, nil},
+		// Active again, the deltas cover the last 2 scans:
+		{120, []uint64{2_000_000_000, 700_000_000, 30}, true, schedstatMetrics("25.0", "20.0", unixMilli+4_000)},
+		// Missing schedstat, e.g. kernel w/o CONFIG_SCHED_INFO; the PID is
+		// retained:
+		{130, nil, false, nil},
+		// The deltas cover the last 2 scans:
+		{140, []uint64{2_600_000_000, 700_000_000, 40}, true, schedstatMetrics("30.0", "0.0", unixMilli+6_000)},
+	} {
+		scanUnixMilli := unixMilli + int64(scan)*1_000
+		parserData.UnixMilli = scanUnixMilli
+		tpp.fallbackUnixMilli = scanUnixMilli
+		parserData.PidStat = buildTestPidStatParsedData(step.utime, 100)
+		parserData.PidSchedstat = nil
+		if step.schedstat != nil {
+			parserData.PidSchedstat = &TestPidSchedstatParsedData{NumericFields: step.schedstat}
+		}
+		testMetricsQueue := testutils.NewTestMetricsQueue(0)
+		pm.metricsQueue = testMetricsQueue
+		pm.Execute()
+
+		errBuf := &bytes.Buffer{}
+		pidTidMetricsInfo := pm.pidTidMetricsInfo[pidTid]
+		if pidTidMetricsInfo == nil {
+			t.Fatalf("scan# %d: pidTidMetricsInfo[%#v]: missing", scan, pidTid)
+		}
+		if got := pidTidMetricsInfo.pidSchedstatParsed; step.wantParsed != got {
+			fmt.Fprintf(errBuf, "\npidSchedstatParsed: want: %v, got: %v", step.wantParsed, got)
+		}
+		testMetricsQueue.GenerateReport(step.wantSchedstat, false, errBuf)
+		if errBuf.Len() > 0 {
+			t.Fatalf("scan# %d:%s", scan, errBuf)
+		}
+		// Avoid full metrics cycles:
+		pidTidMetricsInfo.cycleNum = 1
+	}
+}
+
+func TestProcPidMetricsGenerateSmapsRollup(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	prevUnixMilli := int64(1_700_000_000_000)
+	currUnixMilli := prevUnixMilli + 1_000
+	pidTid := &procfs.PidTid{Pid: 1000, Tid: procfs.PID_ONLY_TID}
+	labels := fmt.Sprintf(`instance="%s",hostname="%s",%s="%d"`, instance, hostname, PROC_PID_PID_LABEL_NAME, pidTid.Pid)
+
+	prevSmapsRollup := &TestPidSmapsRollupParsedData{
+		NumericFields: make([]uint64, procfs.PID_SMAPS_ROLLUP_NUM_FIELDS),
+		Found:         make([]bool, procfs.PID_SMAPS_ROLLUP_NUM_FIELDS),
+	}
+	for i := range prevSmapsRollup.NumericFields {
+		prevSmapsRollup.NumericFields[i] = uint64(i+1) * 1024
+		prevSmapsRollup.Found[i] = true
+	}
+	// Changed Pss, Pss_Anon missing, everything else unchanged:
+	currSmapsRollup := &TestPidSmapsRollupParsedData{
+		NumericFields: make([]uint64, procfs.PID_SMAPS_ROLLUP_NUM_FIELDS),
+		Found:         make([]bool, procfs.PID_SMAPS_ROLLUP_NUM_FIELDS),
+	}
+	copy(currSmapsRollup.NumericFields, prevSmapsRollup.NumericFields)
+	copy(currSmapsRollup.Found, prevSmapsRollup.Found)
+	currSmapsRollup.NumericFields[procfs.PID_SMAPS_ROLLUP_PSS] = 2048 * 1024
+	currSmapsRollup.Found[procfs.PID_SMAPS_ROLLUP_PSS_ANON] = false
+
+	for _, tc := range []*ProcPidMetricsGenerateTestCase{
+		{
+			Name:           "changed",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			PidTidMetricsInfo: &TestPidParserStateData{
+				PidStat:        buildTestPidStatParsedData(100, 100),
+				PidSmapsRollup: prevSmapsRollup,
+				UnixMilli:      prevUnixMilli,
+				Active:         true,
+				PidTid:         pidTid,
+			},
+			ParserData: &TestPidParserStateData{
+				PidStat:        buildTestPidStatParsedData(150, 100),
+				PidSmapsRollup: currSmapsRollup,
+				PidCmdline:     &TestPidCmdlineParsedData{},
+				UnixMilli:      currUnixMilli,
+				PidTid:         pidTid,
+			},
+			// cpu_num, minflt/majflt deltas, 3 x pcpu and Pss:
+			WantMetricsCount: 7,
+			WantMetrics: []string{
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_SMAPS_ROLLUP_PSS_METRIC, labels, 2048*1024, currUnixMilli),
+			},
+		},
+		{
+			Name:           "full",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			PidTidMetricsInfo: &TestPidParserStateData{
+				PidStat:        buildTestPidStatParsedData(100, 100),
+				PidSmapsRollup: prevSmapsRollup,
+				UnixMilli:      prevUnixMilli,
+				Active:         true,
+				PidTid:         pidTid,
+			},
+			ParserData: &TestPidParserStateData{
+				PidStat:        buildTestPidStatParsedData(150, 100),
+				PidSmapsRollup: currSmapsRollup,
+				PidCmdline:     &TestPidCmdlineParsedData{},
+				UnixMilli:      currUnixMilli,
+				PidTid:         pidTid,
+			},
+			FullMetrics: true,
+			// All metrics, w/ 6 out of 7 smaps_rollup ones:
+			WantMetricsCount: 21,
+			WantMetrics: []string{
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_SMAPS_ROLLUP_PSS_METRIC, labels, 2048*1024, currUnixMilli),
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_SMAPS_ROLLUP_PSS_FILE_METRIC, labels, 3*1024, currUnixMilli),
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_SMAPS_ROLLUP_PSS_SHMEM_METRIC, labels, 4*1024, currUnixMilli),
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_SMAPS_ROLLUP_SWAP_PSS_METRIC, labels, 5*1024, currUnixMilli),
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_SMAPS_ROLLUP_PRIVATE_DIRTY_METRIC, labels, 6*1024, currUnixMilli),
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_SMAPS_ROLLUP_SHARED_CLEAN_METRIC, labels, 7*1024, currUnixMilli),
+			},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcPidMetricsGenerate(tc, t) },
+		)
+	}
+}
+
+func TestProcPidMetricsExecuteSmapsRollupSampling(t *testing.T) {
+	// The sampling is based on the number of scans only, regardless of the
+	// process being active or not:
+	for _, tc := range []struct {
+		name   string
+		active bool
+	}{
+		{"active", true},
+		{"inactive", false},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testProcPidMetricsExecuteSmapsRollupSampling(tc.active, t) },
+		)
+	}
+}
+
+func testProcPidMetricsExecuteSmapsRollupSampling(active bool, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+	savedGlobalMetricsGeneratorStatsContainer := GlobalMetricsGeneratorStatsContainer
+	defer func() { GlobalMetricsGeneratorStatsContainer = savedGlobalMetricsGeneratorStatsContainer }()
+	GlobalMetricsGeneratorStatsContainer = NewMetricsGeneratorStatsContainer()
+
+	procfsRoot := "/proc"
+	pidTid := procfs.PidTid{Pid: 1000, Tid: procfs.PID_ONLY_TID}
+
+	procPidMetricsConfig := DefaultProcPidMetricsConfig()
+	procPidMetricsConfig.Interval = "1s"
+	procPidMetricsConfig.FullMetricsFactor = 1000
+	procPidMetricsConfig.UsePidSmapsRollup = true
+	procPidMetricsConfig.PidSmapsRollupInterval = "2500ms" // i.e. every 3 scans
+	pm, err := NewProcProcPidMetrics(procPidMetricsConfig, 0, &TestPidTidListCache{[]procfs.PidTid{pidTid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm.pidSmapsRollupFactor != 3 {
+		t.Fatalf("pidSmapsRollupFactor: want: %d, got: %d", 3, pm.pidSmapsRollupFactor)
+	}
+
+	unixMilli := int64(1_700_000_000_000)
+	parserData := &TestPidParserStateData{
+		PidStat:   buildTestPidStatParsedData(100, 100),
+		PidStatus: &TestPidStatusParsedData{},
+		PidSmapsRollup: &TestPidSmapsRollupParsedData{
+			NumericFields: make([]uint64, procfs.PID_SMAPS_ROLLUP_NUM_FIELDS),
+			Found:         make([]bool, procfs.PID_SMAPS_ROLLUP_NUM_FIELDS),
+		},
+		PidCmdline: &TestPidCmdlineParsedData{},
+		UnixMilli:  unixMilli,
+		PidTid:     &pidTid,
+	}
+	parserData.PidStatus.ByteSliceFields = make([]string, procfs.PID_STATUS_BYTE_SLICE_NUM_FIELDS)
+	parserData.PidStatus.ByteSliceFieldUnit = make([]string, procfs.PID_STATUS_BYTE_SLICE_NUM_FIELDS)
+	parserData.PidStatus.NumericFields = make([]uint64, procfs.PID_STATUS_ULONG_NUM_FIELDS)
+
+	tpp := NewTestPidParsers([]*TestPidParserStateData{parserData}, procfsRoot, unixMilli)
+	pm.procfsRoot = procfsRoot
+	pm.instance = "lsvmi-test"
+	pm.hostname = "lsvmi-test-host"
+	pm.linuxClktckSec = 0.01
+	pm.newPidStatParser = tpp.NewPidStat
+	pm.newPidStatusParser = tpp.NewPidStatus
+	pm.newPidSmapsRollupParser = tpp.NewPidSmapsRollup
+	pm.newPidCmdlineParser = tpp.NewPidCmdline
+	pm.timeNowFn = tpp.timeNow
+
+	wantSampled := []bool{true, false, false, true, false, false, true}
+	for scan, want := range wantSampled {
+		pm.metricsQueue = testutils.NewTestMetricsQueue(0)
+		pm.Execute()
+		pidTidMetricsInfo := pm.pidTidMetricsInfo[pidTid]
+		if pidTidMetricsInfo == nil {
+			t.Fatalf("scan# %d: pidTidMetricsInfo[%#v]: missing", scan, pidTid)
+		}
+		if got := pidTidMetricsInfo.pidSmapsRollupSampled; want != got {
+			t.Fatalf("scan# %d: pidSmapsRollupSampled: want: %v, got: %v", scan, want, got)
+		}
+		// Avoid full metrics cycles:
+		pidTidMetricsInfo.cycleNum = 1
+		// Advance time and, if active, CPU usage:
+		unixMilli += 1000
+		parserData.UnixMilli = unixMilli
+		tpp.fallbackUnixMilli = unixMilli
+		if active {
+			utime := parserData.PidStat.NumericFields[procfs.PID_STAT_UTIME] + 10
+			parserData.PidStat = buildTestPidStatParsedData(utime, 100)
+		}
+	}
+}
+
+func TestProcPidMetricsGenerateOomScore(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	prevUnixMilli := int64(1_700_000_000_000)
+	currUnixMilli := prevUnixMilli + 1_000
+	pidTid := &procfs.PidTid{Pid: 1000, Tid: procfs.PID_ONLY_TID}
+	labels := fmt.Sprintf(`instance="%s",hostname="%s",%s="%d"`, instance, hostname, PROC_PID_PID_LABEL_NAME, pidTid.Pid)
+
+	for _, tc := range []*ProcPidMetricsGenerateTestCase{
+		{
+			Name:           "partial",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			PidTidMetricsInfo: &TestPidParserStateData{
+				PidStat:   buildTestPidStatParsedData(100, 100),
+				UnixMilli: prevUnixMilli,
+				Active:    true,
+				PidTid:    pidTid,
+			},
+			ParserData: &TestPidParserStateData{
+				PidStat:     buildTestPidStatParsedData(150, 100),
+				PidOomScore: &TestPidOomScoreParsedData{OomScore: 667, OomScoreAdj: -500},
+				PidCmdline:  &TestPidCmdlineParsedData{},
+				UnixMilli:   currUnixMilli,
+				PidTid:      pidTid,
+			},
+			// cpu_num, minflt/majflt deltas and 3 x pcpu, no OOM score:
+			WantMetricsCount: 6,
+		},
+		{
+			Name:           "full",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			PidTidMetricsInfo: &TestPidParserStateData{
+				PidStat:   buildTestPidStatParsedData(100, 100),
+				UnixMilli: prevUnixMilli,
+				Active:    true,
+				PidTid:    pidTid,
+			},
+			ParserData: &TestPidParserStateData{
+				PidStat:     buildTestPidStatParsedData(150, 100),
+				PidOomScore: &TestPidOomScoreParsedData{OomScore: 667, OomScoreAdj: -500},
+				PidCmdline:  &TestPidCmdlineParsedData{},
+				UnixMilli:   currUnixMilli,
+				PidTid:      pidTid,
+			},
+			FullMetrics: true,
+			// All metrics, w/ OOM score and adj:
+			WantMetricsCount: 17,
+			WantMetrics: []string{
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_OOM_SCORE_METRIC, labels, 667, currUnixMilli),
+				fmt.Sprintf(`%s{%s} %d %d`, PROC_PID_OOM_SCORE_ADJ_METRIC, labels, -500, currUnixMilli),
+			},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcPidMetricsGenerate(tc, t) },
+		)
+	}
+}
+
+func TestProcPidMetricsExecuteOomTopCandidates(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+	savedGlobalMetricsGeneratorStatsContainer := GlobalMetricsGeneratorStatsContainer
+	defer func() { GlobalMetricsGeneratorStatsContainer = savedGlobalMetricsGeneratorStatsContainer }()
+	GlobalMetricsGeneratorStatsContainer = NewMetricsGeneratorStatsContainer()
+
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	procfsRoot := "/proc"
+	unixMilli := int64(1_700_000_000_000)
+	// The generator specific metrics are timestamped w/ the test parsers'
+	// fallback value:
+	specificUnixMilli := unixMilli
+
+	// PID -> COMM, OOM score for 2 partitions:
+	type pidOomInfo struct {
+		comm     string
+		oomScore int
+	}
+	partPidOomInfo := []map[int]*pidOomInfo{
+		{
+			100: {"init", 0},
+			101: {"db", 800},
+			102: {"cache", 300},
+		},
+		{
+			200: {"web", 500},
+			201: {"batch", 900},
+		},
+	}
+
+	procPidMetricsConfig := DefaultProcPidMetricsConfig()
+	// Every cycle a full one, such that the OOM score is re-read:
+	procPidMetricsConfig.FullMetricsFactor = 1
+	procPidMetricsConfig.UsePidStatus = false
+	procPidMetricsConfig.UsePidOomScore = true
+	procPidMetricsConfig.PidOomTopCandidates = 3
+
+	pidOomCandidatesContainer := NewPidOomCandidatesContainer()
+	pmList := make([]*ProcPidMetrics, len(partPidOomInfo))
+	parserDataList := make([][]*TestPidParserStateData, len(partPidOomInfo))
+	for partNo, pidOomInfoMap := range partPidOomInfo {
+		pidTidList := make([]procfs.PidTid, 0)
+		for pid, info := range pidOomInfoMap {
+			pidTid := procfs.PidTid{Pid: pid, Tid: procfs.PID_ONLY_TID}
+			pidTidList = append(pidTidList, pidTid)
+			pidStat := buildTestPidStatParsedData(100, 100)
+			pidStat.ByteSliceFields[procfs.PID_STAT_COMM] = info.comm
+			parserDataList[partNo] = append(parserDataList[partNo], &TestPidParserStateData{
+				PidStat:     pidStat,
+				PidOomScore: &TestPidOomScoreParsedData{OomScore: info.oomScore},
+				PidCmdline:  &TestPidCmdlineParsedData{},
+				UnixMilli:   unixMilli,
+				PidTid:      &pidTid,
+			})
+		}
+		pm, err := NewProcProcPidMetrics(procPidMetricsConfig, partNo, &TestPidTidListCache{pidTidList})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpp := NewTestPidParsers(parserDataList[partNo], procfsRoot, specificUnixMilli)
+		pm.procfsRoot = procfsRoot
+		pm.instance = instance
+		pm.hostname = hostname
+		pm.linuxClktckSec = 0.01
+		pm.newPidStatParser = tpp.NewPidStat
+		pm.newPidOomScoreParser = tpp.NewPidOomScore
+		pm.newPidCmdlineParser = tpp.NewPidCmdline
+		pm.timeNowFn = tpp.timeNow
+		pm.pidOomCandidatesContainer = pidOomCandidatesContainer
+		pmList[partNo] = pm
+	}
+
+	candidateMetric := func(rank, pid int, comm string, val byte) string {
+		return fmt.Sprintf(
+			`%s{instance="%s",hostname="%s",%s="%d",%s="%d",%s="%s"} %c %d`,
+			PROC_PID_OOM_TOP_CANDIDATE_METRIC, instance, hostname,
+			PROC_PID_OOM_RANK_LABEL_NAME, rank, PROC_PID_PID_LABEL_NAME, pid, PROC_PID_OOM_COMM_LABEL_NAME, comm,
+			val, specificUnixMilli,
+		)
+	}
+	scoreMetric := func(rank, oomScore int) string {
+		return fmt.Sprintf(
+			`%s{instance="%s",hostname="%s",%s="%d"} %d %d`,
+			PROC_PID_OOM_TOP_CANDIDATE_SCORE_METRIC, instance, hostname,
+			PROC_PID_OOM_RANK_LABEL_NAME, rank, oomScore,
+			specificUnixMilli,
+		)
+	}
+
+	for scan, wantMetrics := range [][]string{
+		{
+			candidateMetric(1, 201, "batch", '1'),
+			scoreMetric(1, 900),
+			candidateMetric(2, 101, "db", '1'),
+			scoreMetric(2, 800),
+			candidateMetric(3, 200, "web", '1'),
+			scoreMetric(3, 500),
+		},
+		// After the OOM score update below, "cache" takes over the 1st place:
+		{
+			candidateMetric(1, 201, "batch", '0'),
+			candidateMetric(1, 102, "cache", '1'),
+			scoreMetric(1, 1000),
+			candidateMetric(2, 101, "db", '0'),
+			candidateMetric(2, 201, "batch", '1'),
+			scoreMetric(2, 900),
+			candidateMetric(3, 200, "web", '0'),
+			candidateMetric(3, 101, "db", '1'),
+			scoreMetric(3, 800),
+		},
+	} {
+		// Partition 0, which reports the host level metrics, goes last to
+		// collect the most recent info from the other partitions:
+		var testMetricsQueue *testutils.TestMetricsQueue
+		for partNo := len(pmList) - 1; partNo >= 0; partNo-- {
+			testMetricsQueue = testutils.NewTestMetricsQueue(0)
+			pmList[partNo].metricsQueue = testMetricsQueue
+			pmList[partNo].Execute()
+		}
+		errBuf := &bytes.Buffer{}
+		testMetricsQueue.GenerateReport(wantMetrics, false, errBuf)
+		if errBuf.Len() > 0 {
+			t.Fatalf("scan# %d: %s", scan, errBuf)
+		}
+
+		// Update the OOM score and the timestamp for the next scan:
+		unixMilli += 1000
+		for _, partParserDataList := range parserDataList {
+			for _, parserData := range partParserDataList {
+				parserData.UnixMilli = unixMilli
+				if parserData.PidTid.Pid == 102 {
+					parserData.PidOomScore = &TestPidOomScoreParsedData{OomScore: 1000}
+				}
+			}
+		}
+	}
+}
+
+func buildTestPidStatusNsParsedData(nsTgid, nsPid string) *TestPidStatusParsedData {
+	pidStatusData := &TestPidStatusParsedData{
+		ByteSliceFields:    make([]string, procfs.PID_STATUS_BYTE_SLICE_NUM_FIELDS),
+		ByteSliceFieldUnit: make([]string, procfs.PID_STATUS_BYTE_SLICE_NUM_FIELDS),
+		NumericFields:      make([]uint64, procfs.PID_STATUS_ULONG_NUM_FIELDS),
+	}
+	for i := range pidStatusData.ByteSliceFields {
+		pidStatusData.ByteSliceFields[i] = PID_PARSER_NIL_BSF
+	}
+	pidStatusData.ByteSliceFields[procfs.PID_STATUS_NSTGID] = nsTgid
+	pidStatusData.ByteSliceFields[procfs.PID_STATUS_NSPID] = nsPid
+	return pidStatusData
+}
+
+func TestProcPidMetricsGenerateNs(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	prevUnixMilli := int64(1_700_000_000_000)
+	currUnixMilli := prevUnixMilli + 1_000
+	pidTid := &procfs.PidTid{Pid: 2000, Tid: procfs.PID_ONLY_TID}
+
+	rootNs := &TestPidNsParsedData{
+		Inodes: []string{"4026531836", "4026531840", "4026531841", "4026531837", "4026531838", "4026531839", "4026531835"},
+	}
+	containerNs := &TestPidNsParsedData{
+		Inodes: []string{"4026532300", "4026532301", "4026532302", "4026531837", "4026532303", "4026532304", "4026532305"},
+	}
+	// Same as above, different net namespace:
+	containerNewNetNs := &TestPidNsParsedData{
+		Inodes: append([]string{}, containerNs.Inodes...),
+	}
+	containerNewNetNs.Inodes[procfs.PID_NS_NET] = "4026532400"
+
+	nsInfoMetric := func(pidNs *TestPidNsParsedData, nsPid, nsTgid, nsLevel string, val byte) string {
+		return fmt.Sprintf(
+			`%s{instance="%s",hostname="%s",%s="%d",pid_ns="%s",net_ns="%s",mnt_ns="%s",user_ns="%s",uts_ns="%s",ipc_ns="%s",cgroup_ns="%s",%s="%s",%s="%s",%s="%s"} %c %d`,
+			PROC_PID_NS_INFO_METRIC, instance, hostname, PROC_PID_PID_LABEL_NAME, pidTid.Pid,
+			pidNs.Inodes[procfs.PID_NS_PID],
+			pidNs.Inodes[procfs.PID_NS_NET],
+			pidNs.Inodes[procfs.PID_NS_MNT],
+			pidNs.Inodes[procfs.PID_NS_USER],
+			pidNs.Inodes[procfs.PID_NS_UTS],
+			pidNs.Inodes[procfs.PID_NS_IPC],
+			pidNs.Inodes[procfs.PID_NS_CGROUP],
+			PROC_PID_NS_INFO_NS_PID_LABEL_NAME, nsPid,
+			PROC_PID_NS_INFO_NS_TGID_LABEL_NAME, nsTgid,
+			PROC_PID_NS_INFO_NS_LEVEL_LABEL_NAME, nsLevel,
+			val, currUnixMilli,
+		)
+	}
+
+	for _, tc := range []*ProcPidMetricsGenerateTestCase{
+		{
+			Name:           "new_root_ns",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			ParserData: &TestPidParserStateData{
+				PidStat:    buildTestPidStatParsedData(150, 100),
+				PidStatus:  buildTestPidStatusNsParsedData("2000", "2000"),
+				PidNs:      rootNs,
+				PidCmdline: &TestPidCmdlineParsedData{},
+				UnixMilli:  currUnixMilli,
+				PidTid:     pidTid,
+			},
+			WantMetricsCount: 12,
+			WantMetrics: []string{
+				nsInfoMetric(rootNs, "2000", "2000", "0", '1'),
+			},
+		},
+		{
+			Name:           "new_container_ns",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			ParserData: &TestPidParserStateData{
+				PidStat:    buildTestPidStatParsedData(150, 100),
+				PidStatus:  buildTestPidStatusNsParsedData("2000,150,1", "2000,150,1"),
+				PidNs:      containerNs,
+				PidCmdline: &TestPidCmdlineParsedData{},
+				UnixMilli:  currUnixMilli,
+				PidTid:     pidTid,
+			},
+			WantMetricsCount: 12,
+			WantMetrics: []string{
+				nsInfoMetric(containerNs, "1", "1", "2", '1'),
+			},
+		},
+		{
+			Name:           "partial",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			PidTidMetricsInfo: &TestPidParserStateData{
+				PidStat:   buildTestPidStatParsedData(100, 100),
+				PidStatus: buildTestPidStatusNsParsedData("2000,150,1", "2000,150,1"),
+				PidNs:     containerNs,
+				UnixMilli: prevUnixMilli,
+				Active:    true,
+				PidTid:    pidTid,
+			},
+			ParserData: &TestPidParserStateData{
+				PidStat:    buildTestPidStatParsedData(150, 100),
+				PidStatus:  buildTestPidStatusNsParsedData("2000,150,1", "2000,150,1"),
+				PidNs:      containerNewNetNs,
+				PidCmdline: &TestPidCmdlineParsedData{},
+				UnixMilli:  currUnixMilli,
+				PidTid:     pidTid,
+			},
+			// cpu_num, minflt/majflt deltas, 3 x pcpu, ctx switch deltas, no
+			// namespace info:
+			WantMetricsCount: 8,
+		},
+		{
+			Name:           "changed_net_ns",
+			Instance:       instance,
+			Hostname:       hostname,
+			LinuxClktckSec: 0.01,
+			PidTidMetricsInfo: &TestPidParserStateData{
+				PidStat:   buildTestPidStatParsedData(100, 100),
+				PidStatus: buildTestPidStatusNsParsedData("2000,150,1", "2000,150,1"),
+				PidNs:     containerNs,
+				UnixMilli: prevUnixMilli,
+				Active:    true,
+				PidTid:    pidTid,
+			},
+			ParserData: &TestPidParserStateData{
+				PidStat:    buildTestPidStatParsedData(150, 100),
+				PidStatus:  buildTestPidStatusNsParsedData("2000,150,1", "2000,150,1"),
+				PidNs:      containerNewNetNs,
+				PidCmdline: &TestPidCmdlineParsedData{},
+				UnixMilli:  currUnixMilli,
+				PidTid:     pidTid,
+			},
+			FullMetrics:      true,
+			WantMetricsCount: 20,
+			WantMetrics: []string{
+				nsInfoMetric(containerNs, "1", "1", "2", '0'),
+				nsInfoMetric(containerNewNetNs, "1", "1", "2", '1'),
+			},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcPidMetricsGenerate(tc, t) },
+		)
+	}
+}
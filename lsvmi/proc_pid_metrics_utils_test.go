@@ -28,6 +28,23 @@ type TestPidStatusParsedData struct {
 	NumericFields      []uint64
 }
 
+type TestPidSchedstatParsedData struct {
+	NumericFields []uint64
+}
+
+type TestPidSmapsRollupParsedData struct {
+	NumericFields []uint64
+	Found         []bool
+}
+
+type TestPidOomScoreParsedData struct {
+	OomScore, OomScoreAdj int
+}
+
+type TestPidNsParsedData struct {
+	Inodes []string
+}
+
 type TestPidCmdlineParsedData struct {
 	CmdPath, Args string
 }
@@ -36,9 +53,13 @@ type TestPidCmdlineParsedData struct {
 // previous state cache:
 type TestPidParserStateData struct {
 	// Parsed data:
-	PidStat    *TestPidStatParsedData
-	PidStatus  *TestPidStatusParsedData
-	PidCmdline *TestPidCmdlineParsedData
+	PidStat        *TestPidStatParsedData
+	PidStatus      *TestPidStatusParsedData
+	PidSchedstat   *TestPidSchedstatParsedData
+	PidSmapsRollup *TestPidSmapsRollupParsedData
+	PidOomScore    *TestPidOomScoreParsedData
+	PidNs          *TestPidNsParsedData
+	PidCmdline     *TestPidCmdlineParsedData
 	// Timestamp for the above, milliseconds since the epoch, similar to
 	// Prometheus timestamp:
 	UnixMilli int64
@@ -62,7 +83,9 @@ type TestPidParsers struct {
 	byPidTidPath map[string]*TestPidParserStateData
 	// Keep track of PID,TID in Data w/ a lookup error to exclude them from
 	// consistency checks; this happens for simulated parser errors via
-	// PidStat|PidStatus|PidCmdline set to nil.
+	// PidStat|PidStatus|PidOomScore|PidCmdline set to nil. Note that
+	// PidSchedstat, PidSmapsRollup and PidNs parse errors are not fatal for the
+	// PID,TID.
 	failedPidTid map[procfs.PidTid]bool
 	// The timestamp from the most recent successful lookup and the fallback
 	// value:
@@ -234,6 +257,167 @@ func setTestPidStatusData(pidStatParser procfs.PidStatusParser, data *TestPidSta
 	pidStatParser.(*TestPidStatus).parsedData = parsedData
 }
 
+// Test PidSchedstatParser:
+type TestPidSchedstat struct {
+	// The most recent call to Parse result:
+	parsedData *TestPidSchedstatParsedData
+	// Underlying test data:
+	pidParsers *TestPidParsers
+}
+
+func (testPidSchedstat *TestPidSchedstat) Parse(pidTidPath string) error {
+	testPidSchedstat.parsedData = nil
+	pidParsers := testPidSchedstat.pidParsers
+	if pidParsers != nil {
+		if testPidParserData := pidParsers.get(pidTidPath); testPidParserData != nil {
+			testPidSchedstat.parsedData = testPidParserData.PidSchedstat
+		}
+	}
+	if testPidSchedstat.parsedData != nil {
+		return nil
+	}
+	pidParsers.lastUnixMilli = pidParsers.fallbackUnixMilli
+	return fmt.Errorf("%s/schedstat: no such (test case) file", pidTidPath)
+}
+
+func (testPidSchedstat *TestPidSchedstat) GetData() []uint64 {
+	if testPidSchedstat.parsedData == nil {
+		return nil
+	}
+	return testPidSchedstat.parsedData.NumericFields
+}
+
+func (tpp *TestPidParsers) NewPidSchedstat() procfs.PidSchedstatParser {
+	return &TestPidSchedstat{pidParsers: tpp}
+}
+
+func setTestPidSchedstatData(pidSchedstatParser procfs.PidSchedstatParser, data *TestPidSchedstatParsedData) {
+	parsedData := &TestPidSchedstatParsedData{}
+	if data.NumericFields != nil {
+		parsedData.NumericFields = make([]uint64, len(data.NumericFields))
+		copy(parsedData.NumericFields, data.NumericFields)
+	}
+	pidSchedstatParser.(*TestPidSchedstat).parsedData = parsedData
+}
+
+// Test PidSmapsRollupParser:
+type TestPidSmapsRollup struct {
+	// The most recent call to Parse result:
+	parsedData *TestPidSmapsRollupParsedData
+	// Underlying test data:
+	pidParsers *TestPidParsers
+}
+
+func (testPidSmapsRollup *TestPidSmapsRollup) Parse(pidTidPath string) error {
+	testPidSmapsRollup.parsedData = nil
+	pidParsers := testPidSmapsRollup.pidParsers
+	if pidParsers != nil {
+		if testPidParserData := pidParsers.get(pidTidPath); testPidParserData != nil {
+			testPidSmapsRollup.parsedData = testPidParserData.PidSmapsRollup
+		}
+	}
+	if testPidSmapsRollup.parsedData != nil {
+		return nil
+	}
+	pidParsers.lastUnixMilli = pidParsers.fallbackUnixMilli
+	return fmt.Errorf("%s/smaps_rollup: no such (test case) file", pidTidPath)
+}
+
+func (testPidSmapsRollup *TestPidSmapsRollup) GetData() ([]uint64, []bool) {
+	if testPidSmapsRollup.parsedData == nil {
+		return nil, nil
+	}
+	return testPidSmapsRollup.parsedData.NumericFields, testPidSmapsRollup.parsedData.Found
+}
+
+func (tpp *TestPidParsers) NewPidSmapsRollup() procfs.PidSmapsRollupParser {
+	return &TestPidSmapsRollup{pidParsers: tpp}
+}
+
+func setTestPidSmapsRollupData(pidSmapsRollupParser procfs.PidSmapsRollupParser, data *TestPidSmapsRollupParsedData) {
+	parsedData := &TestPidSmapsRollupParsedData{}
+	if data.NumericFields != nil {
+		parsedData.NumericFields = make([]uint64, len(data.NumericFields))
+		copy(parsedData.NumericFields, data.NumericFields)
+	}
+	if data.Found != nil {
+		parsedData.Found = make([]bool, len(data.Found))
+		copy(parsedData.Found, data.Found)
+	}
+	pidSmapsRollupParser.(*TestPidSmapsRollup).parsedData = parsedData
+}
+
+// Test PidOomScoreParser:
+type TestPidOomScore struct {
+	// The most recent call to Parse result:
+	parsedData *TestPidOomScoreParsedData
+	// Underlying test data:
+	pidParsers *TestPidParsers
+}
+
+func (testPidOomScore *TestPidOomScore) Parse(pidTidPath string) error {
+	testPidOomScore.parsedData = nil
+	pidParsers := testPidOomScore.pidParsers
+	if pidParsers != nil {
+		if testPidParserData := pidParsers.get(pidTidPath); testPidParserData != nil {
+			testPidOomScore.parsedData = testPidParserData.PidOomScore
+			if testPidOomScore.parsedData == nil {
+				pidParsers.failedPidTid[*testPidParserData.PidTid] = true
+			}
+		}
+	}
+	if testPidOomScore.parsedData != nil {
+		return nil
+	}
+	pidParsers.lastUnixMilli = pidParsers.fallbackUnixMilli
+	return fmt.Errorf("%s/oom_score: no such (test case) file", pidTidPath)
+}
+
+func (testPidOomScore *TestPidOomScore) GetData() (int, int) {
+	if testPidOomScore.parsedData == nil {
+		return 0, 0
+	}
+	return testPidOomScore.parsedData.OomScore, testPidOomScore.parsedData.OomScoreAdj
+}
+
+func (tpp *TestPidParsers) NewPidOomScore() procfs.PidOomScoreParser {
+	return &TestPidOomScore{pidParsers: tpp}
+}
+
+// Test PidNsParser:
+type TestPidNs struct {
+	// The most recent call to Parse result:
+	parsedData *TestPidNsParsedData
+	// Underlying test data:
+	pidParsers *TestPidParsers
+}
+
+func (testPidNs *TestPidNs) Parse(pidTidPath string) error {
+	testPidNs.parsedData = nil
+	pidParsers := testPidNs.pidParsers
+	if pidParsers != nil {
+		if testPidParserData := pidParsers.get(pidTidPath); testPidParserData != nil {
+			testPidNs.parsedData = testPidParserData.PidNs
+		}
+	}
+	if testPidNs.parsedData != nil {
+		return nil
+	}
+	pidParsers.lastUnixMilli = pidParsers.fallbackUnixMilli
+	return fmt.Errorf("%s/ns: no such (test case) dir", pidTidPath)
+}
+
+func (testPidNs *TestPidNs) GetData() []string {
+	if testPidNs.parsedData == nil {
+		return nil
+	}
+	return testPidNs.parsedData.Inodes
+}
+
+func (tpp *TestPidParsers) NewPidNs() procfs.PidNsParser {
+	return &TestPidNs{pidParsers: tpp}
+}
+
 // Test PidCmdlineParser:
 type TestPidCmdline struct {
 	// The most recent call to Parse result:
@@ -306,6 +490,30 @@ func buildTestPidTidMetricsInfo(pm *ProcPidMetrics, pidParserState *TestPidParse
 		setTestPidStatusData(pidTidMetricsInfo.pidStatus, pidParserState.PidStatus)
 		copy(pidTidMetricsInfo.pidStatusCtxZeroDelta, pidParserState.PidStatusCtxZeroDelta)
 	}
+	if pm.usePidSchedstat && pidParserState.PidSchedstat != nil {
+		setTestPidSchedstatData(pidTidMetricsInfo.pidSchedstat, pidParserState.PidSchedstat)
+		pidTidMetricsInfo.pidSchedstatHasPrev = true
+		pidTidMetricsInfo.pidSchedstatTs = time.UnixMilli(pidParserState.UnixMilli)
+	}
+	if pidTidMetricsInfo.pidSmapsRollup != nil && pidParserState.PidSmapsRollup != nil {
+		setTestPidSmapsRollupData(pidTidMetricsInfo.pidSmapsRollup, pidParserState.PidSmapsRollup)
+		pidTidMetricsInfo.pidSmapsRollupHasPrev = true
+	}
+	if pm.usePidNs && pidParserState.PidNs != nil {
+		savedPidNs := pm.pidNs
+		pm.pidNs = &TestPidNs{parsedData: pidParserState.PidNs}
+		var pidStatusBSF [][]byte
+		if pm.usePidStatus {
+			pidStatusBSF, _, _ = pidTidMetricsInfo.pidStatus.GetData()
+		}
+		pidTidMetricsInfo.pidNsInfoLabels = pm.buildPidNsInfoLabels(pidStatusBSF)
+		pm.pidNs = savedPidNs
+	}
+	if pm.usePidOomScore && pidParserState.PidOomScore != nil {
+		pidTidMetricsInfo.oomScore = pidParserState.PidOomScore.OomScore
+		pidTidMetricsInfo.oomScoreAdj = pidParserState.PidOomScore.OomScoreAdj
+		pidTidMetricsInfo.hasOomScore = true
+	}
 	pidTidMetricsInfo.prevTs = time.UnixMilli(pidParserState.UnixMilli)
 	pidTidMetricsInfo.cycleNum = pidParserState.CycleNum
 	pidTidMetricsInfo.scanNum = pm.scanNum - 1
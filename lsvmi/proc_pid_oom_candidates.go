@@ -0,0 +1,92 @@
+// Top OOM candidates, merged across proc_pid_metrics partitions.
+
+package lsvmi
+
+import (
+	"sync"
+)
+
+// The proc_pid_metrics partitions report their N highest OOM score processes,
+// at the end of each scan, into a container shared among all partitions.
+// Partition 0 merges the reports into the host level top N list; since the
+// partitions run independently, the merge uses the most recent report from
+// each partition, which may be from the previous scan.
+
+type PidOomCandidate struct {
+	Pid         int
+	Comm        string
+	OomScore    int
+	OomScoreAdj int
+}
+
+// Whether a candidate ranks above another, i.e. it is more likely to be picked
+// by the OOM killer. Ties are broken by PID, for a stable order:
+func (candidate *PidOomCandidate) ranksAbove(other *PidOomCandidate) bool {
+	if candidate.OomScore != other.OomScore {
+		return candidate.OomScore > other.OomScore
+	}
+	return candidate.Pid < other.Pid
+}
+
+// Insert a candidate into a list sorted by rank, keeping at most n entries;
+// return the updated list:
+func insertPidOomCandidate(candidates []PidOomCandidate, candidate *PidOomCandidate, n int) []PidOomCandidate {
+	pos := len(candidates)
+	for pos > 0 && candidate.ranksAbove(&candidates[pos-1]) {
+		pos--
+	}
+	if pos >= n {
+		return candidates
+	}
+	if len(candidates) < n {
+		candidates = append(candidates, PidOomCandidate{})
+	}
+	copy(candidates[pos+1:], candidates[pos:])
+	candidates[pos] = *candidate
+	return candidates
+}
+
+type PidOomCandidatesContainer struct {
+	// Candidates indexed by partition#:
+	candidates map[int][]PidOomCandidate
+	// Lock:
+	mu *sync.Mutex
+}
+
+func NewPidOomCandidatesContainer() *PidOomCandidatesContainer {
+	return &PidOomCandidatesContainer{
+		candidates: make(map[int][]PidOomCandidate),
+		mu:         &sync.Mutex{},
+	}
+}
+
+// Replace the candidates for a given partition:
+func (pocc *PidOomCandidatesContainer) Update(partNo int, candidates []PidOomCandidate) {
+	pocc.mu.Lock()
+	defer pocc.mu.Unlock()
+
+	pocc.candidates[partNo] = append(pocc.candidates[partNo][:0], candidates...)
+}
+
+// Return the top n candidates merged across all partitions, reusing the
+// storage provided as an argument:
+func (pocc *PidOomCandidatesContainer) SnapTop(n int, to []PidOomCandidate) []PidOomCandidate {
+	pocc.mu.Lock()
+	defer pocc.mu.Unlock()
+
+	if to == nil {
+		to = make([]PidOomCandidate, 0, n)
+	} else {
+		to = to[:0]
+	}
+	for _, partCandidates := range pocc.candidates {
+		for i := range partCandidates {
+			if len(to) == n && !partCandidates[i].ranksAbove(&to[n-1]) {
+				// The partition list is sorted, no need to look further:
+				break
+			}
+			to = insertPidOomCandidate(to, &partCandidates[i], n)
+		}
+	}
+	return to
+}
@@ -0,0 +1,90 @@
+// Tests for proc_pid_oom_candidates.go
+
+package lsvmi
+
+import (
+	"testing"
+)
+
+func TestPidOomCandidatesContainer(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		partCandidates map[int][]PidOomCandidate
+		n              int
+		wantPids       []int
+	}{
+		{
+			name:     "empty",
+			n:        3,
+			wantPids: []int{},
+		},
+		{
+			name: "merge",
+			partCandidates: map[int][]PidOomCandidate{
+				0: {{Pid: 101, OomScore: 800}, {Pid: 102, OomScore: 300}, {Pid: 100, OomScore: 0}},
+				1: {{Pid: 201, OomScore: 900}, {Pid: 200, OomScore: 500}},
+			},
+			n:        3,
+			wantPids: []int{201, 101, 200},
+		},
+		{
+			name: "fewer_than_n",
+			partCandidates: map[int][]PidOomCandidate{
+				0: {{Pid: 101, OomScore: 800}},
+				1: {{Pid: 201, OomScore: 900}},
+			},
+			n:        3,
+			wantPids: []int{201, 101},
+		},
+		{
+			name: "tie_break_by_pid",
+			partCandidates: map[int][]PidOomCandidate{
+				0: {{Pid: 300, OomScore: 500}, {Pid: 100, OomScore: 400}},
+				1: {{Pid: 200, OomScore: 500}, {Pid: 400, OomScore: 400}},
+			},
+			n:        3,
+			wantPids: []int{200, 300, 100},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) {
+				pidOomCandidatesContainer := NewPidOomCandidatesContainer()
+				for partNo, candidates := range tc.partCandidates {
+					pidOomCandidatesContainer.Update(partNo, candidates)
+				}
+				got := pidOomCandidatesContainer.SnapTop(tc.n, nil)
+				if len(tc.wantPids) != len(got) {
+					t.Fatalf("len: want: %d, got: %d (%v)", len(tc.wantPids), len(got), got)
+				}
+				for i, wantPid := range tc.wantPids {
+					if got[i].Pid != wantPid {
+						t.Errorf("rank %d: want PID: %d, got: %d", i+1, wantPid, got[i].Pid)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestInsertPidOomCandidate(t *testing.T) {
+	candidates := make([]PidOomCandidate, 0)
+	for _, candidate := range []PidOomCandidate{
+		{Pid: 1, OomScore: 10},
+		{Pid: 2, OomScore: 30},
+		{Pid: 3, OomScore: 20},
+		{Pid: 4, OomScore: 5},
+		{Pid: 5, OomScore: 40},
+	} {
+		candidates = insertPidOomCandidate(candidates, &candidate, 3)
+	}
+	wantPids := []int{5, 2, 3}
+	if len(wantPids) != len(candidates) {
+		t.Fatalf("len: want: %d, got: %d (%v)", len(wantPids), len(candidates), candidates)
+	}
+	for i, wantPid := range wantPids {
+		if candidates[i].Pid != wantPid {
+			t.Errorf("rank %d: want PID: %d, got: %d", i+1, wantPid, candidates[i].Pid)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+// Per CPU scheduler run-queue metrics based on /proc/schedstat
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	PROC_SCHEDSTAT_METRICS_CONFIG_INTERVAL_DEFAULT            = "1s"
+	PROC_SCHEDSTAT_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 15
+
+	// This generator id:
+	PROC_SCHEDSTAT_METRICS_ID = "proc_schedstat_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",cpu="CPU"}:
+	PROC_SCHEDSTAT_RUN_PCT_METRIC          = "proc_schedstat_run_pct"
+	PROC_SCHEDSTAT_WAIT_PCT_METRIC         = "proc_schedstat_wait_pct"
+	PROC_SCHEDSTAT_TIMESLICES_DELTA_METRIC = "proc_schedstat_timeslices_delta"
+
+	PROC_SCHEDSTAT_PCT_METRIC_PREC = 1
+
+	// Interval since last generation, i.e. the interval underlying the deltas.
+	// Normally this should be close to scan interval, but this is the actual
+	// value, rather than the desired one:
+	PROC_SCHEDSTAT_INTERVAL_METRIC = "proc_schedstat_metrics_delta_sec"
+)
+
+// The per CPU metrics, in the order in which they are generated:
+const (
+	PROC_SCHEDSTAT_RUN_PCT = iota
+	PROC_SCHEDSTAT_WAIT_PCT
+	PROC_SCHEDSTAT_TIMESLICES_DELTA
+
+	// Must be last:
+	PROC_SCHEDSTAT_NUM_METRICS
+)
+
+var procSchedstatMetricNames = []string{
+	PROC_SCHEDSTAT_RUN_PCT:          PROC_SCHEDSTAT_RUN_PCT_METRIC,
+	PROC_SCHEDSTAT_WAIT_PCT:         PROC_SCHEDSTAT_WAIT_PCT_METRIC,
+	PROC_SCHEDSTAT_TIMESLICES_DELTA: PROC_SCHEDSTAT_TIMESLICES_DELTA_METRIC,
+}
+
+// Map metric index into stats index (see procfs/schedstat_parser.go):
+var procSchedstatMetricStatsIndex = []int{
+	PROC_SCHEDSTAT_RUN_PCT:          procfs.SCHEDSTAT_CPU_RUN_TIME,
+	PROC_SCHEDSTAT_WAIT_PCT:         procfs.SCHEDSTAT_CPU_WAIT_TIME,
+	PROC_SCHEDSTAT_TIMESLICES_DELTA: procfs.SCHEDSTAT_CPU_TIMESLICES,
+}
+
+var procSchedstatMetricsLog = NewCompLogger(PROC_SCHEDSTAT_METRICS_ID)
+
+type ProcSchedstatMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+}
+
+func DefaultProcSchedstatMetricsConfig() *ProcSchedstatMetricsConfig {
+	return &ProcSchedstatMetricsConfig{
+		Interval:          PROC_SCHEDSTAT_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: PROC_SCHEDSTAT_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+	}
+}
+
+// Per CPU metrics cache:
+type ProcSchedstatCpuInfo struct {
+	// The metrics, w/o value, indexed by PROC_SCHEDSTAT_...:
+	metrics [][]byte
+	// Avg (`all' / number of CPUs) metrics for %, for `all' only, indexed by
+	// PROC_SCHEDSTAT_...; nil for non-% metrics:
+	avgMetrics [][]byte
+	// Delta metrics are generated with skip-zero-after-zero rule, i.e. if the
+	// current and previous deltas are both zero, then the current metric is
+	// skipped, save for full cycles. Keep track of zero deltas, indexed by
+	// PROC_SCHEDSTAT_...:
+	zeroDelta []bool
+}
+
+type ProcSchedstatMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// Dual storage for parsed stats used as previous, current:
+	schedstat [2]*procfs.Schedstat
+	// Timestamp when the stats were collected:
+	schedstatTs [2]time.Time
+	// Index for current stats, toggled after each use:
+	currIndex int
+
+	// Per CPU metrics cache, indexed by CPU#, procfs.SCHEDSTAT_CPU_ALL for
+	// `all':
+	cpuInfo map[int]*ProcSchedstatCpuInfo
+
+	// Interval metric:
+	intervalMetric []byte
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+}
+
+func NewProcSchedstatMetrics(cfg any) (*ProcSchedstatMetrics, error) {
+	var (
+		err                     error
+		procSchedstatMetricsCfg *ProcSchedstatMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		procSchedstatMetricsCfg = cfg.ProcSchedstatMetricsConfig
+	case *ProcSchedstatMetricsConfig:
+		procSchedstatMetricsCfg = cfg
+	case nil:
+		procSchedstatMetricsCfg = DefaultProcSchedstatMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewProcSchedstatMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(procSchedstatMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	procSchedstatMetrics := &ProcSchedstatMetrics{
+		id:                PROC_SCHEDSTAT_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: procSchedstatMetricsCfg.FullMetricsFactor,
+		cpuInfo:           make(map[int]*ProcSchedstatCpuInfo),
+		cycleNum:          initialCycleNum.Get(procSchedstatMetricsCfg.FullMetricsFactor),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	procSchedstatMetricsLog.Infof("id=%s", procSchedstatMetrics.id)
+	procSchedstatMetricsLog.Infof("interval=%s", procSchedstatMetrics.interval)
+	procSchedstatMetricsLog.Infof("full_metrics_factor=%d", procSchedstatMetrics.fullMetricsFactor)
+	return procSchedstatMetrics, nil
+}
+
+func (psm *ProcSchedstatMetrics) newCpuInfo(cpu int) *ProcSchedstatCpuInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if psm.instance != "" {
+		instance = psm.instance
+	}
+	if psm.hostname != "" {
+		hostname = psm.hostname
+	}
+	buildMetric := func(name, cpuLabelVal string) []byte {
+		return []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			name,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			PROC_STAT_CPU_LABEL_NAME, cpuLabelVal,
+		))
+	}
+
+	cpuLabelVal := strconv.Itoa(cpu)
+	if cpu == procfs.SCHEDSTAT_CPU_ALL {
+		cpuLabelVal = PROC_STAT_CPU_ALL_LABEL_VALUE
+	}
+	cpuInfo := &ProcSchedstatCpuInfo{
+		metrics:   make([][]byte, PROC_SCHEDSTAT_NUM_METRICS),
+		zeroDelta: make([]bool, PROC_SCHEDSTAT_NUM_METRICS),
+	}
+	for index, name := range procSchedstatMetricNames {
+		cpuInfo.metrics[index] = buildMetric(name, cpuLabelVal)
+	}
+	if cpu == procfs.SCHEDSTAT_CPU_ALL {
+		cpuInfo.avgMetrics = make([][]byte, PROC_SCHEDSTAT_NUM_METRICS)
+		for _, index := range []int{PROC_SCHEDSTAT_RUN_PCT, PROC_SCHEDSTAT_WAIT_PCT} {
+			cpuInfo.avgMetrics[index] = buildMetric(procSchedstatMetricNames[index], PROC_STAT_CPU_AVG_LABEL_VALUE)
+		}
+	}
+	return cpuInfo
+}
+
+func (psm *ProcSchedstatMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	currSchedstat, prevSchedstat := psm.schedstat[psm.currIndex], psm.schedstat[1-psm.currIndex]
+	currTs, prevTs := psm.schedstatTs[psm.currIndex], psm.schedstatTs[1-psm.currIndex]
+	psm.currIndex = 1 - psm.currIndex
+
+	actualMetricsCount, totalMetricsCount := 0, 0
+
+	// All metrics are deltas, wait until a prev stats:
+	if prevSchedstat == nil {
+		return actualMetricsCount, totalMetricsCount
+	}
+
+	psm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		psm.tsSuffixBuf, " %d\n", currTs.UnixMilli(),
+	)
+	promTs := psm.tsSuffixBuf.Bytes()
+
+	fullMetrics := psm.cycleNum == 0
+
+	// %: delta(ns) * pctFactor
+	deltaSec := currTs.Sub(prevTs).Seconds()
+	pctFactor := 100. / (deltaSec * 1e9)
+
+	// The `all' deltas and the avg are based on the CPUs present in both
+	// scans; the parsed sums would be skewed by CPUs going on/offline in
+	// between:
+	var allDelta [procfs.SCHEDSTAT_CPU_NUM_STATS]uint64
+	numCpus := 0
+	for cpu, currCpuStats := range currSchedstat.Cpu {
+		prevCpuStats := prevSchedstat.Cpu[cpu]
+		if cpu == procfs.SCHEDSTAT_CPU_ALL || prevCpuStats == nil {
+			continue
+		}
+		for statsIndex := range allDelta {
+			allDelta[statsIndex] += currCpuStats[statsIndex] - prevCpuStats[statsIndex]
+		}
+		numCpus++
+	}
+
+	for cpu, currCpuStats := range currSchedstat.Cpu {
+		prevCpuStats := prevSchedstat.Cpu[cpu]
+		if prevCpuStats == nil || cpu == procfs.SCHEDSTAT_CPU_ALL && numCpus == 0 {
+			continue
+		}
+		cpuInfo := psm.cpuInfo[cpu]
+		cpuFullMetrics := fullMetrics
+		if cpuInfo == nil {
+			cpuInfo = psm.newCpuInfo(cpu)
+			psm.cpuInfo[cpu] = cpuInfo
+			cpuFullMetrics = true
+		}
+		zeroDelta := cpuInfo.zeroDelta
+		for index, metric := range cpuInfo.metrics {
+			statsIndex := procSchedstatMetricStatsIndex[index]
+			var delta uint64
+			if cpu == procfs.SCHEDSTAT_CPU_ALL {
+				delta = allDelta[statsIndex]
+			} else {
+				delta = currCpuStats[statsIndex] - prevCpuStats[statsIndex]
+			}
+			if delta != 0 || cpuFullMetrics || !zeroDelta[index] {
+				var val, avgVal string
+				if index == PROC_SCHEDSTAT_TIMESLICES_DELTA {
+					val = strconv.FormatUint(delta, 10)
+				} else {
+					pct := float64(delta) * pctFactor
+					val = strconv.FormatFloat(pct, 'f', PROC_SCHEDSTAT_PCT_METRIC_PREC, 64)
+					if cpuInfo.avgMetrics != nil {
+						avgVal = strconv.FormatFloat(pct/float64(numCpus), 'f', PROC_SCHEDSTAT_PCT_METRIC_PREC, 64)
+					}
+				}
+				buf.Write(metric)
+				buf.WriteString(val)
+				buf.Write(promTs)
+				actualMetricsCount++
+				if avgVal != "" {
+					buf.Write(cpuInfo.avgMetrics[index])
+					buf.WriteString(avgVal)
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+			}
+			zeroDelta[index] = delta == 0
+		}
+
+		// The total number of metrics:
+		//		per CPU metrics#: number of metrics
+		//		+ avg % metrics#: 2, for `all'
+		totalMetricsCount += PROC_SCHEDSTAT_NUM_METRICS
+		if cpuInfo.avgMetrics != nil {
+			totalMetricsCount += 2
+		}
+	}
+
+	// CPU's may be unplugged dynamically; remove out-of-scope CPUs:
+	if len(psm.cpuInfo) > len(currSchedstat.Cpu) {
+		for cpu := range psm.cpuInfo {
+			if _, ok := currSchedstat.Cpu[cpu]; !ok {
+				delete(psm.cpuInfo, cpu)
+			}
+		}
+	}
+
+	if psm.intervalMetric == nil {
+		instance, hostname := GlobalInstance, GlobalHostname
+		if psm.instance != "" {
+			instance = psm.instance
+		}
+		if psm.hostname != "" {
+			hostname = psm.hostname
+		}
+		psm.intervalMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			PROC_SCHEDSTAT_INTERVAL_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+	buf.Write(psm.intervalMetric)
+	buf.WriteString(strconv.FormatFloat(deltaSec, 'f', 6, 64))
+	buf.Write(promTs)
+	actualMetricsCount++
+	totalMetricsCount++
+
+	if psm.cycleNum++; psm.cycleNum >= psm.fullMetricsFactor {
+		psm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (psm *ProcSchedstatMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if psm.timeNowFn != nil {
+		timeNowFn = psm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if psm.metricsQueue != nil {
+		metricsQueue = psm.metricsQueue
+	}
+
+	currSchedstat := psm.schedstat[psm.currIndex]
+	if currSchedstat == nil {
+		prevSchedstat := psm.schedstat[1-psm.currIndex]
+		if prevSchedstat != nil {
+			currSchedstat = prevSchedstat.Clone(false)
+		} else {
+			procfsRoot := GlobalProcfsRoot
+			if psm.procfsRoot != "" {
+				procfsRoot = psm.procfsRoot
+			}
+			currSchedstat = procfs.NewSchedstat(procfsRoot)
+		}
+		psm.schedstat[psm.currIndex] = currSchedstat
+	}
+	err := currSchedstat.Parse()
+	if err != nil {
+		procSchedstatMetricsLog.Warnf("%v: proc schedstat metrics will be disabled", err)
+		return false
+	}
+	psm.schedstatTs[psm.currIndex] = timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := psm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		psm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func ProcSchedstatMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	psm, err := NewProcSchedstatMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if psm.interval <= 0 {
+		procSchedstatMetricsLog.Infof(
+			"interval=%s, metrics disabled", psm.interval,
+		)
+		return nil, nil
+	}
+	// The file is available only if the kernel was built w/ CONFIG_SCHEDSTATS:
+	schedstatPath := procfs.SchedstatPath(GlobalProcfsRoot)
+	if _, err := os.Stat(schedstatPath); errors.Is(err, fs.ErrNotExist) {
+		procSchedstatMetricsLog.Infof(
+			"%s not found, kernel w/o CONFIG_SCHEDSTATS?, metrics disabled", schedstatPath,
+		)
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(psm.id, psm.interval, psm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(ProcSchedstatMetricsTaskBuilder)
+}
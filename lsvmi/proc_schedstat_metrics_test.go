@@ -0,0 +1,262 @@
+// Tests for proc_schedstat_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+type ProcSchedstatMetricsTestCase struct {
+	Name                         string
+	Instance                     string
+	Hostname                     string
+	CurrSchedstat, PrevSchedstat *procfs.Schedstat
+	CurrPromTs, PrevPromTs       int64
+	CycleNum                     int
+	FullMetricsFactor            int
+	// CPU's w/ metrics cache primed, all w/ zero deltas:
+	PrimeCpus        []int
+	WantMetricsCount int
+	WantMetrics      []string
+	ReportExtra      bool
+	WantCpus         []int
+}
+
+func buildTestSchedstatCpuStats(runTime, waitTime, timeslices uint64) []uint64 {
+	cpuStats := make([]uint64, procfs.SCHEDSTAT_CPU_NUM_STATS)
+	cpuStats[procfs.SCHEDSTAT_CPU_RUN_TIME] = runTime
+	cpuStats[procfs.SCHEDSTAT_CPU_WAIT_TIME] = waitTime
+	cpuStats[procfs.SCHEDSTAT_CPU_TIMESLICES] = timeslices
+	return cpuStats
+}
+
+func testProcSchedstatMetrics(tc *ProcSchedstatMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	procSchedstatMetrics, err := NewProcSchedstatMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procSchedstatMetrics.instance = tc.Instance
+	procSchedstatMetrics.hostname = tc.Hostname
+	procSchedstatMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	procSchedstatMetrics.cycleNum = tc.CycleNum
+	for _, cpu := range tc.PrimeCpus {
+		cpuInfo := procSchedstatMetrics.newCpuInfo(cpu)
+		for index := range cpuInfo.zeroDelta {
+			cpuInfo.zeroDelta[index] = true
+		}
+		procSchedstatMetrics.cpuInfo[cpu] = cpuInfo
+	}
+	currIndex := procSchedstatMetrics.currIndex
+	procSchedstatMetrics.schedstat[currIndex] = tc.CurrSchedstat
+	procSchedstatMetrics.schedstatTs[currIndex] = time.UnixMilli(tc.CurrPromTs)
+	procSchedstatMetrics.schedstat[1-currIndex] = tc.PrevSchedstat
+	procSchedstatMetrics.schedstatTs[1-currIndex] = time.UnixMilli(tc.PrevPromTs)
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, _ := procSchedstatMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+
+	if tc.WantCpus != nil {
+		if len(tc.WantCpus) != len(procSchedstatMetrics.cpuInfo) {
+			fmt.Fprintf(
+				errBuf,
+				"\nlen(cpuInfo): want: %d, got: %d",
+				len(tc.WantCpus), len(procSchedstatMetrics.cpuInfo),
+			)
+		}
+		for _, cpu := range tc.WantCpus {
+			if procSchedstatMetrics.cpuInfo[cpu] == nil {
+				fmt.Fprintf(errBuf, "\ncpuInfo[%d]: missing", cpu)
+			}
+		}
+	}
+
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestProcSchedstatMetrics(t *testing.T) {
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	labels := fmt.Sprintf(`instance="%s",hostname="%s"`, instance, hostname)
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	prevSchedstat := &procfs.Schedstat{
+		Version: 15,
+		Cpu: map[int][]uint64{
+			procfs.SCHEDSTAT_CPU_ALL: buildTestSchedstatCpuStats(3_000_000_000, 300_000_000, 3000),
+			0:                        buildTestSchedstatCpuStats(1_000_000_000, 100_000_000, 1000),
+			1:                        buildTestSchedstatCpuStats(2_000_000_000, 200_000_000, 2000),
+		},
+		NumCpus: 2,
+	}
+	currSchedstat := &procfs.Schedstat{
+		Version: 15,
+		Cpu: map[int][]uint64{
+			procfs.SCHEDSTAT_CPU_ALL: buildTestSchedstatCpuStats(6_500_000_000, 800_000_000, 3100),
+			0:                        buildTestSchedstatCpuStats(3_500_000_000, 600_000_000, 1100),
+			1:                        buildTestSchedstatCpuStats(3_000_000_000, 200_000_000, 2000),
+		},
+		NumCpus: 2,
+	}
+
+	for _, tc := range []*ProcSchedstatMetricsTestCase{
+		{
+			Name:              "first_scan",
+			Instance:          instance,
+			Hostname:          hostname,
+			CurrSchedstat:     currSchedstat,
+			CurrPromTs:        currPromTs,
+			FullMetricsFactor: 15,
+			WantMetricsCount:  0,
+			ReportExtra:       true,
+		},
+		{
+			Name:              "new_cpus",
+			Instance:          instance,
+			Hostname:          hostname,
+			CurrSchedstat:     currSchedstat,
+			PrevSchedstat:     prevSchedstat,
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          1,
+			FullMetricsFactor: 15,
+			WantMetricsCount:  12,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="0"} 50.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="0"} 10.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_timeslices_delta{%s,cpu="0"} 100 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="1"} 20.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="1"} 0.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_timeslices_delta{%s,cpu="1"} 0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="all"} 70.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="avg"} 35.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="all"} 10.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="avg"} 5.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_timeslices_delta{%s,cpu="all"} 100 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra: true,
+			WantCpus:    []int{procfs.SCHEDSTAT_CPU_ALL, 0, 1},
+		},
+		{
+			Name:              "skip_zero_after_zero",
+			Instance:          instance,
+			Hostname:          hostname,
+			CurrSchedstat:     currSchedstat,
+			PrevSchedstat:     prevSchedstat,
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          1,
+			FullMetricsFactor: 15,
+			PrimeCpus:         []int{procfs.SCHEDSTAT_CPU_ALL, 0, 1},
+			WantMetricsCount:  10,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="0"} 50.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="0"} 10.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_timeslices_delta{%s,cpu="0"} 100 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="1"} 20.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="all"} 70.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="avg"} 35.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="all"} 10.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="avg"} 5.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_timeslices_delta{%s,cpu="all"} 100 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name:              "full_cycle",
+			Instance:          instance,
+			Hostname:          hostname,
+			CurrSchedstat:     currSchedstat,
+			PrevSchedstat:     prevSchedstat,
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          0,
+			FullMetricsFactor: 15,
+			PrimeCpus:         []int{procfs.SCHEDSTAT_CPU_ALL, 0, 1},
+			WantMetricsCount:  12,
+		},
+		{
+			Name:              "cpu_offline",
+			Instance:          instance,
+			Hostname:          hostname,
+			CurrSchedstat:     currSchedstat,
+			PrevSchedstat:     prevSchedstat,
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          1,
+			FullMetricsFactor: 15,
+			// CPU#2 went offline:
+			PrimeCpus:        []int{procfs.SCHEDSTAT_CPU_ALL, 0, 1, 2},
+			WantMetricsCount: 10,
+			WantCpus:         []int{procfs.SCHEDSTAT_CPU_ALL, 0, 1},
+		},
+		{
+			Name:          "cpu_offline_all",
+			Instance:      instance,
+			Hostname:      hostname,
+			CurrSchedstat: currSchedstat,
+			// CPU#2 went offline, the parsed `all' went backwards:
+			PrevSchedstat: &procfs.Schedstat{
+				Version: 15,
+				Cpu: map[int][]uint64{
+					procfs.SCHEDSTAT_CPU_ALL: buildTestSchedstatCpuStats(7_000_000_000, 400_000_000, 8000),
+					0:                        buildTestSchedstatCpuStats(1_000_000_000, 100_000_000, 1000),
+					1:                        buildTestSchedstatCpuStats(2_000_000_000, 200_000_000, 2000),
+					2:                        buildTestSchedstatCpuStats(4_000_000_000, 100_000_000, 5000),
+				},
+				NumCpus: 3,
+			},
+			CurrPromTs:        currPromTs,
+			PrevPromTs:        prevPromTs,
+			CycleNum:          1,
+			FullMetricsFactor: 15,
+			PrimeCpus:         []int{procfs.SCHEDSTAT_CPU_ALL, 0, 1, 2},
+			WantMetricsCount:  10,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="0"} 50.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="0"} 10.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_timeslices_delta{%s,cpu="0"} 100 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="1"} 20.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="all"} 70.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_run_pct{%s,cpu="avg"} 35.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="all"} 10.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_wait_pct{%s,cpu="avg"} 5.0 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_timeslices_delta{%s,cpu="all"} 100 %d`, labels, currPromTs),
+				fmt.Sprintf(`proc_schedstat_metrics_delta_sec{%s} 5.000000 %d`, labels, currPromTs),
+			},
+			ReportExtra: true,
+			WantCpus:    []int{procfs.SCHEDSTAT_CPU_ALL, 0, 1},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcSchedstatMetrics(tc, t) },
+		)
+	}
+}
@@ -0,0 +1,388 @@
+// Slab cache usage metrics based on /proc/slabinfo, for the top N caches by
+// size and for a configurable include list.
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+const (
+	PROC_SLABINFO_METRICS_CONFIG_INTERVAL_DEFAULT            = "30s"
+	PROC_SLABINFO_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 10
+	PROC_SLABINFO_METRICS_CONFIG_TOP_N_DEFAULT               = 10
+
+	// This generator id:
+	PROC_SLABINFO_METRICS_ID = "proc_slabinfo_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",cache="CACHE"}:
+	PROC_SLABINFO_ACTIVE_OBJS_METRIC = "proc_slabinfo_active_objs"
+	PROC_SLABINFO_NUM_OBJS_METRIC    = "proc_slabinfo_num_objs"
+	PROC_SLABINFO_SIZE_BYTES_METRIC  = "proc_slabinfo_size_bytes"
+
+	PROC_SLABINFO_CACHE_LABEL_NAME = "cache"
+
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME"}:
+	PROC_SLABINFO_TOTAL_SIZE_BYTES_METRIC = "proc_slabinfo_total_size_bytes"
+)
+
+// The per cache metrics, in the order in which they are generated:
+const (
+	PROC_SLABINFO_ACTIVE_OBJS = iota
+	PROC_SLABINFO_NUM_OBJS
+	PROC_SLABINFO_SIZE_BYTES
+
+	// Must be last:
+	PROC_SLABINFO_NUM_METRICS
+)
+
+var procSlabinfoMetricNames = []string{
+	PROC_SLABINFO_ACTIVE_OBJS: PROC_SLABINFO_ACTIVE_OBJS_METRIC,
+	PROC_SLABINFO_NUM_OBJS:    PROC_SLABINFO_NUM_OBJS_METRIC,
+	PROC_SLABINFO_SIZE_BYTES:  PROC_SLABINFO_SIZE_BYTES_METRIC,
+}
+
+var procSlabinfoMetricsLog = NewCompLogger(PROC_SLABINFO_METRICS_ID)
+
+type ProcSlabinfoMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The number of caches, largest by size, to report; 0 to report only the
+	// included ones:
+	TopN int `yaml:"top_n"`
+	// The list of cache names to always report, regardless of size:
+	Include []string `yaml:"include"`
+}
+
+func DefaultProcSlabinfoMetricsConfig() *ProcSlabinfoMetricsConfig {
+	return &ProcSlabinfoMetricsConfig{
+		Interval:          PROC_SLABINFO_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: PROC_SLABINFO_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		TopN:              PROC_SLABINFO_METRICS_CONFIG_TOP_N_DEFAULT,
+	}
+}
+
+// Per cache metrics cache:
+type ProcSlabinfoCacheInfo struct {
+	// The metrics, w/o value, indexed by PROC_SLABINFO_...:
+	metrics [][]byte
+	// The previous values, for change detection, indexed by PROC_SLABINFO_...:
+	prevVals []uint64
+	// The scan# when the cache was last reported, used for detecting caches
+	// no longer reported:
+	scanNum uint64
+}
+
+type ProcSlabinfoMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// As configured:
+	topN    int
+	include map[string]bool
+
+	// Parser:
+	slabinfo *procfs.Slabinfo
+	// Timestamp when the stats were collected:
+	statsTs time.Time
+
+	// Caches sorted by size, reused from scan to scan:
+	sortedCaches []*procfs.SlabinfoCache
+
+	// Metrics cache, indexed by cache name:
+	cacheInfo map[string]*ProcSlabinfoCacheInfo
+
+	// Total size metric and its previous value:
+	totalSizeMetric   []byte
+	prevTotalSize     uint64
+	totalSizeReported bool
+
+	// Scan#, used for detecting caches no longer reported:
+	scanNum uint64
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+	procfsRoot         string
+	pageSize           int
+}
+
+func NewProcSlabinfoMetrics(cfg any) (*ProcSlabinfoMetrics, error) {
+	var (
+		err                    error
+		procSlabinfoMetricsCfg *ProcSlabinfoMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		procSlabinfoMetricsCfg = cfg.ProcSlabinfoMetricsConfig
+	case *ProcSlabinfoMetricsConfig:
+		procSlabinfoMetricsCfg = cfg
+	case nil:
+		procSlabinfoMetricsCfg = DefaultProcSlabinfoMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewProcSlabinfoMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(procSlabinfoMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	procSlabinfoMetrics := &ProcSlabinfoMetrics{
+		id:                PROC_SLABINFO_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: procSlabinfoMetricsCfg.FullMetricsFactor,
+		topN:              procSlabinfoMetricsCfg.TopN,
+		include:           make(map[string]bool),
+		cacheInfo:         make(map[string]*ProcSlabinfoCacheInfo),
+		cycleNum:          initialCycleNum.Get(procSlabinfoMetricsCfg.FullMetricsFactor),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+	for _, name := range procSlabinfoMetricsCfg.Include {
+		procSlabinfoMetrics.include[name] = true
+	}
+
+	procSlabinfoMetricsLog.Infof("id=%s", procSlabinfoMetrics.id)
+	procSlabinfoMetricsLog.Infof("interval=%s", procSlabinfoMetrics.interval)
+	procSlabinfoMetricsLog.Infof("full_metrics_factor=%d", procSlabinfoMetrics.fullMetricsFactor)
+	procSlabinfoMetricsLog.Infof("top_n=%d", procSlabinfoMetrics.topN)
+	procSlabinfoMetricsLog.Infof("include=%q", procSlabinfoMetricsCfg.Include)
+	return procSlabinfoMetrics, nil
+}
+
+func (psm *ProcSlabinfoMetrics) newCacheInfo(name string) *ProcSlabinfoCacheInfo {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if psm.instance != "" {
+		instance = psm.instance
+	}
+	if psm.hostname != "" {
+		hostname = psm.hostname
+	}
+	cacheInfo := &ProcSlabinfoCacheInfo{
+		metrics:  make([][]byte, PROC_SLABINFO_NUM_METRICS),
+		prevVals: make([]uint64, PROC_SLABINFO_NUM_METRICS),
+	}
+	for index, metricName := range procSlabinfoMetricNames {
+		cacheInfo.metrics[index] = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			metricName,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			PROC_SLABINFO_CACHE_LABEL_NAME, name,
+		))
+	}
+	return cacheInfo
+}
+
+func (psm *ProcSlabinfoMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
+	actualMetricsCount, totalMetricsCount := 0, 0
+
+	psm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		psm.tsSuffixBuf, " %d\n", psm.statsTs.UnixMilli(),
+	)
+	promTs := psm.tsSuffixBuf.Bytes()
+
+	fullMetrics := psm.cycleNum == 0
+	psm.scanNum++
+
+	pageSize := psm.pageSize
+	if pageSize <= 0 {
+		pageSize = os.Getpagesize()
+	}
+	cacheSize := func(cache *procfs.SlabinfoCache) uint64 {
+		return cache.Stats[procfs.SLABINFO_NUM_SLABS] * cache.Stats[procfs.SLABINFO_PAGESPERSLAB] * uint64(pageSize)
+	}
+
+	totalSize := uint64(0)
+	psm.sortedCaches = psm.sortedCaches[:0]
+	for _, cache := range psm.slabinfo.Caches {
+		totalSize += cacheSize(cache)
+		psm.sortedCaches = append(psm.sortedCaches, cache)
+	}
+	// Largest first, ties broken by name for a stable selection:
+	sort.Slice(psm.sortedCaches, func(i, j int) bool {
+		sizeI, sizeJ := cacheSize(psm.sortedCaches[i]), cacheSize(psm.sortedCaches[j])
+		if sizeI != sizeJ {
+			return sizeI > sizeJ
+		}
+		return psm.sortedCaches[i].Name < psm.sortedCaches[j].Name
+	})
+
+	vals := make([]uint64, PROC_SLABINFO_NUM_METRICS)
+	numCaches := 0
+	for rank, cache := range psm.sortedCaches {
+		if rank >= psm.topN && !psm.include[cache.Name] {
+			continue
+		}
+		numCaches++
+		cacheInfo := psm.cacheInfo[cache.Name]
+		cacheFullMetrics := fullMetrics
+		if cacheInfo == nil {
+			cacheInfo = psm.newCacheInfo(cache.Name)
+			psm.cacheInfo[cache.Name] = cacheInfo
+			cacheFullMetrics = true
+		}
+		cacheInfo.scanNum = psm.scanNum
+		vals[PROC_SLABINFO_ACTIVE_OBJS] = cache.Stats[procfs.SLABINFO_ACTIVE_OBJS]
+		vals[PROC_SLABINFO_NUM_OBJS] = cache.Stats[procfs.SLABINFO_NUM_OBJS]
+		vals[PROC_SLABINFO_SIZE_BYTES] = cacheSize(cache)
+		for index, metric := range cacheInfo.metrics {
+			if cacheFullMetrics || vals[index] != cacheInfo.prevVals[index] {
+				buf.Write(metric)
+				buf.WriteString(strconv.FormatUint(vals[index], 10))
+				buf.Write(promTs)
+				actualMetricsCount++
+				cacheInfo.prevVals[index] = vals[index]
+			}
+		}
+		totalMetricsCount += PROC_SLABINFO_NUM_METRICS
+	}
+
+	// Caches may fall out of the top N or they may be destroyed, e.g. upon
+	// module unload; remove the ones no longer reported, such that they are
+	// fully reported should they come back:
+	if len(psm.cacheInfo) > numCaches {
+		for name, cacheInfo := range psm.cacheInfo {
+			if cacheInfo.scanNum != psm.scanNum {
+				delete(psm.cacheInfo, name)
+			}
+		}
+	}
+
+	if psm.totalSizeMetric == nil {
+		instance, hostname := GlobalInstance, GlobalHostname
+		if psm.instance != "" {
+			instance = psm.instance
+		}
+		if psm.hostname != "" {
+			hostname = psm.hostname
+		}
+		psm.totalSizeMetric = []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			PROC_SLABINFO_TOTAL_SIZE_BYTES_METRIC,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+	if fullMetrics || !psm.totalSizeReported || totalSize != psm.prevTotalSize {
+		buf.Write(psm.totalSizeMetric)
+		buf.WriteString(strconv.FormatUint(totalSize, 10))
+		buf.Write(promTs)
+		actualMetricsCount++
+		psm.prevTotalSize, psm.totalSizeReported = totalSize, true
+	}
+	totalMetricsCount++
+
+	if psm.cycleNum++; psm.cycleNum >= psm.fullMetricsFactor {
+		psm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (psm *ProcSlabinfoMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if psm.timeNowFn != nil {
+		timeNowFn = psm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if psm.metricsQueue != nil {
+		metricsQueue = psm.metricsQueue
+	}
+
+	if psm.slabinfo == nil {
+		procfsRoot := GlobalProcfsRoot
+		if psm.procfsRoot != "" {
+			procfsRoot = psm.procfsRoot
+		}
+		psm.slabinfo = procfs.NewSlabinfo(procfsRoot)
+	}
+	err := psm.slabinfo.Parse()
+	if err != nil {
+		// Returning false disables the task, i.e. a single warning rather than
+		// one every cycle, e.g. for permission errors:
+		procSlabinfoMetricsLog.Warnf("%v: proc slabinfo metrics will be disabled", err)
+		return false
+	}
+	psm.statsTs = timeNowFn()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := psm.generateMetrics(buf)
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		psm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func ProcSlabinfoMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	psm, err := NewProcSlabinfoMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if psm.interval <= 0 {
+		procSlabinfoMetricsLog.Infof(
+			"interval=%s, metrics disabled", psm.interval,
+		)
+		return nil, nil
+	}
+	// The file is readable by root only and it is available only if the
+	// kernel was built w/ CONFIG_SLUB_DEBUG (for SLUB):
+	slabinfoPath := procfs.SlabinfoPath(GlobalProcfsRoot)
+	f, err := os.Open(slabinfoPath)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			procSlabinfoMetricsLog.Infof("%s not found, metrics disabled", slabinfoPath)
+		case errors.Is(err, fs.ErrPermission):
+			procSlabinfoMetricsLog.Warnf("%s: permission denied (root only), metrics disabled", slabinfoPath)
+		default:
+			procSlabinfoMetricsLog.Warnf("%v, metrics disabled", err)
+		}
+		return nil, nil
+	}
+	f.Close()
+	tasks := []*Task{
+		NewTask(psm.id, psm.interval, psm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(ProcSlabinfoMetricsTaskBuilder)
+}
@@ -0,0 +1,183 @@
+// Tests for proc_slabinfo_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+	"github.com/bgp59/linux-stats-victoriametrics-importer/procfs"
+)
+
+type ProcSlabinfoMetricsTestCase struct {
+	Name string
+	// The sequence of parsed stats, metrics are checked after the last one:
+	SlabinfoSeq       []*procfs.Slabinfo
+	TopN              int
+	Include           []string
+	FullMetricsFactor int
+	WantMetricsCount  int
+	WantMetrics       []string
+	ReportExtra       bool
+	// The expected cached caches:
+	WantCaches []string
+}
+
+func buildTestSlabinfoCache(name string, activeObjs, numObjs, pagesPerSlab, numSlabs uint64) *procfs.SlabinfoCache {
+	cache := &procfs.SlabinfoCache{
+		Name:  name,
+		Stats: make([]uint64, procfs.SLABINFO_NUM_STATS),
+	}
+	cache.Stats[procfs.SLABINFO_ACTIVE_OBJS] = activeObjs
+	cache.Stats[procfs.SLABINFO_NUM_OBJS] = numObjs
+	cache.Stats[procfs.SLABINFO_PAGESPERSLAB] = pagesPerSlab
+	cache.Stats[procfs.SLABINFO_NUM_SLABS] = numSlabs
+	cache.Stats[procfs.SLABINFO_ACTIVE_SLABS] = numSlabs
+	return cache
+}
+
+func testProcSlabinfoMetrics(tc *ProcSlabinfoMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	procSlabinfoMetricsCfg := DefaultProcSlabinfoMetricsConfig()
+	procSlabinfoMetricsCfg.TopN = tc.TopN
+	procSlabinfoMetricsCfg.Include = tc.Include
+	procSlabinfoMetrics, err := NewProcSlabinfoMetrics(procSlabinfoMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procSlabinfoMetrics.instance = "lsvmi-test"
+	procSlabinfoMetrics.hostname = "lsvmi-test-host"
+	procSlabinfoMetrics.pageSize = 4096
+	procSlabinfoMetrics.fullMetricsFactor = tc.FullMetricsFactor
+	procSlabinfoMetrics.cycleNum = 0
+
+	ts := time.UnixMilli(1_700_000_000_000)
+	var testMetricsQueue *testutils.TestMetricsQueue
+	gotMetricsCount := 0
+	for _, slabinfo := range tc.SlabinfoSeq {
+		procSlabinfoMetrics.slabinfo = slabinfo
+		procSlabinfoMetrics.statsTs = ts
+		testMetricsQueue = testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ = procSlabinfoMetrics.generateMetrics(buf)
+		testMetricsQueue.QueueBuf(buf)
+		ts = ts.Add(30 * time.Second)
+	}
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	if tc.WantCaches != nil {
+		if len(tc.WantCaches) != len(procSlabinfoMetrics.cacheInfo) {
+			fmt.Fprintf(
+				errBuf,
+				"\nlen(cacheInfo): want: %d, got: %d",
+				len(tc.WantCaches), len(procSlabinfoMetrics.cacheInfo),
+			)
+		}
+		for _, name := range tc.WantCaches {
+			if procSlabinfoMetrics.cacheInfo[name] == nil {
+				fmt.Fprintf(errBuf, "\ncacheInfo[%s]: missing", name)
+			}
+		}
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestProcSlabinfoMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_000_000)
+
+	slabinfo := &procfs.Slabinfo{
+		Caches: []*procfs.SlabinfoCache{
+			buildTestSlabinfoCache("a", 100, 120, 1, 10),
+			buildTestSlabinfoCache("b", 200, 240, 2, 20),
+			buildTestSlabinfoCache("c", 10, 12, 1, 1),
+			buildTestSlabinfoCache("d", 50, 60, 1, 5),
+		},
+	}
+	slabinfo2 := &procfs.Slabinfo{
+		Caches: []*procfs.SlabinfoCache{
+			buildTestSlabinfoCache("a", 100, 120, 1, 10),
+			buildTestSlabinfoCache("b", 200, 240, 2, 20),
+			buildTestSlabinfoCache("c", 10, 12, 1, 1),
+			buildTestSlabinfoCache("d", 500, 600, 1, 50),
+		},
+	}
+
+	for _, tc := range []*ProcSlabinfoMetricsTestCase{
+		{
+			Name:              "full",
+			SlabinfoSeq:       []*procfs.Slabinfo{slabinfo},
+			TopN:              2,
+			Include:           []string{"c"},
+			FullMetricsFactor: 0,
+			WantMetricsCount:  10,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_slabinfo_active_objs{%s,cache="b"} 200 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_num_objs{%s,cache="b"} 240 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_size_bytes{%s,cache="b"} 163840 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_active_objs{%s,cache="a"} 100 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_num_objs{%s,cache="a"} 120 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_size_bytes{%s,cache="a"} 40960 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_active_objs{%s,cache="c"} 10 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_num_objs{%s,cache="c"} 12 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_size_bytes{%s,cache="c"} 4096 %d`, labels, promTs),
+				fmt.Sprintf(`proc_slabinfo_total_size_bytes{%s} 229376 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+			WantCaches:  []string{"a", "b", "c"},
+		},
+		{
+			Name:              "top_n_change",
+			SlabinfoSeq:       []*procfs.Slabinfo{slabinfo, slabinfo2},
+			TopN:              2,
+			Include:           []string{"c"},
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  4,
+			WantMetrics: []string{
+				fmt.Sprintf(`proc_slabinfo_active_objs{%s,cache="d"} 500 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_slabinfo_num_objs{%s,cache="d"} 600 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_slabinfo_size_bytes{%s,cache="d"} 204800 %d`, labels, promTs+30000),
+				fmt.Sprintf(`proc_slabinfo_total_size_bytes{%s} 413696 %d`, labels, promTs+30000),
+			},
+			ReportExtra: true,
+			WantCaches:  []string{"b", "c", "d"},
+		},
+		{
+			Name:              "no_change",
+			SlabinfoSeq:       []*procfs.Slabinfo{slabinfo, slabinfo},
+			TopN:              2,
+			FullMetricsFactor: 1000,
+			WantMetricsCount:  0,
+			WantCaches:        []string{"a", "b"},
+		},
+		{
+			Name:              "include_only",
+			SlabinfoSeq:       []*procfs.Slabinfo{slabinfo},
+			TopN:              0,
+			Include:           []string{"d", "missing"},
+			FullMetricsFactor: 0,
+			WantMetricsCount:  4,
+			WantCaches:        []string{"d"},
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testProcSlabinfoMetrics(tc, t) },
+		)
+	}
+}
@@ -29,6 +29,10 @@ const (
 	PROC_SOFTIRQS_INFO_METRIC         = "proc_softirqs_info"
 	PROC_SOFTIRQS_INFO_IRQ_LABEL_NAME = PROC_SOFTIRQS_IRQ_LABEL_NAME
 
+	// The number of softirqs excluded via include/exclude filters, generated
+	// only if filters are defined:
+	PROC_SOFTIRQS_EXCLUDED_COUNT_METRIC = "proc_softirqs_excluded_count"
+
 	// Interval since last generation, i.e. the interval underlying the deltas.
 	// Normally this should be close to scan interval, but this is the actual
 	// value, rather than the desired one:
@@ -44,6 +48,12 @@ type ProcSoftirqsMetricsConfig struct {
 	// the previous scan. However every N cycles the full set is generated. Use
 	// 0 to generate full metrics every cycle.
 	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The list of softirq name regexps to include (e.g. `NET_.*`); the regexps
+	// should match the entire name. If not defined/empty then all are included:
+	IncludeSoftirqs []string `yaml:"include_softirqs"`
+	// The list of softirq name regexps to exclude; if not defined/empty then
+	// none is excluded. Exclude takes precedence over include.
+	ExcludeSoftirqs []string `yaml:"exclude_softirqs"`
 }
 
 func DefaultProcSoftirqsMetricsConfig() *ProcSoftirqsMetricsConfig {
@@ -89,6 +99,8 @@ type ProcSoftirqsMetrics struct {
 
 	// Data indexed by IRQ:
 	irqDataCache map[string]*ProcSoftirqsMetricsIrqData
+	// IRQ filter, nil if no filtering:
+	irqFilter *ItemFilter
 
 	// Delta metrics suffix cache (CPU#), indexed by counter#:
 	//              ... cpu="CPU"} `
@@ -137,9 +149,20 @@ func NewProcSoftirqsMetrics(cfg any) (*ProcSoftirqsMetrics, error) {
 		tsSuffixBuf:       &bytes.Buffer{},
 	}
 
+	procSoftirqsMetrics.irqFilter, err = NewItemFilter(
+		procSoftirqsMetricsCfg.IncludeSoftirqs,
+		procSoftirqsMetricsCfg.ExcludeSoftirqs,
+		procSoftirqsMetrics.fullMetricsFactor,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("NewProcSoftirqsMetrics: include/exclude_softirqs: %v", err)
+	}
+
 	procSoftirqsMetricsLog.Infof("id=%s", procSoftirqsMetrics.id)
 	procSoftirqsMetricsLog.Infof("interval=%s", procSoftirqsMetrics.interval)
 	procSoftirqsMetricsLog.Infof("full_metrics_factor=%d", procSoftirqsMetrics.fullMetricsFactor)
+	procSoftirqsMetricsLog.Infof("include_softirqs=%q", procSoftirqsMetricsCfg.IncludeSoftirqs)
+	procSoftirqsMetricsLog.Infof("exclude_softirqs=%q", procSoftirqsMetricsCfg.ExcludeSoftirqs)
 	return procSoftirqsMetrics, nil
 }
 
@@ -251,6 +274,9 @@ func (psirqm *ProcSoftirqsMetrics) updateIntervalMetricsCache() {
 		INSTANCE_LABEL_NAME, instance,
 		HOSTNAME_LABEL_NAME, hostname,
 	))
+	if psirqm.irqFilter != nil {
+		psirqm.irqFilter.updateCountMetric(PROC_SOFTIRQS_EXCLUDED_COUNT_METRIC, instance, hostname)
+	}
 }
 
 func (psirqm *ProcSoftirqsMetrics) generateMetrics(buf *bytes.Buffer) (int, int) {
@@ -283,13 +309,17 @@ func (psirqm *ProcSoftirqsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 		}
 
 		for irq, currIrqCounters := range currCounters {
+			irqData := psirqm.irqDataCache[irq]
+			if irqData == nil && psirqm.irqFilter.exclude(irq, irq) {
+				continue
+			}
+
 			prevIrqCounters := prevCounters[irq]
 			if prevIrqCounters == nil {
 				// This is a new IRQ, no deltas for it:
 				continue
 			}
 
-			irqData := psirqm.irqDataCache[irq]
 			fullMetrics := irqData == nil || // 1st time IRQ
 				irqData.cycleNum == 0 // regular full cycle
 			if irqData == nil {
@@ -342,7 +372,8 @@ func (psirqm *ProcSoftirqsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 		}
 
 		// Clear info for removed IRQ's, if any:
-		if len(psirqm.irqDataCache) != len(currCounters) {
+		pruneExcludedItems(psirqm.irqFilter, currCounters)
+		if len(psirqm.irqDataCache)+psirqm.irqFilter.excludedCount() != len(currCounters) {
 			for irq, prevIrqData := range psirqm.irqDataCache {
 				if _, ok := currCounters[irq]; !ok {
 					buf.Write(prevIrqData.infoMetric)
@@ -362,13 +393,20 @@ func (psirqm *ProcSoftirqsMetrics) generateMetrics(buf *bytes.Buffer) (int, int)
 		buf.WriteString(strconv.FormatFloat(deltaSec, 'f', 6, 64))
 		buf.Write(promTs)
 		actualMetricsCount++
+
+		actualMetricsCount += psirqm.irqFilter.generateCountMetric(buf, promTs, psirqm.fullMetricsFactor)
 	}
 
 	// The total number of metrics:
 	//		delta metrics#: number of IRQs * number of counter
 	//		info metrics#:  number of IRQs
 	//		interval metric#: 1
-	totalMetricsCount := len(currProcSoftirqs.Counters)*(currProcSoftirqs.NumCounters+1) + 1
+	//		excluded count metric#: 1 if filtering
+	numIrqs := len(currProcSoftirqs.Counters) - psirqm.irqFilter.excludedCount()
+	totalMetricsCount := numIrqs*(currProcSoftirqs.NumCounters+1) + 1
+	if psirqm.irqFilter != nil {
+		totalMetricsCount++
+	}
 
 	// Toggle the buffers:
 	psirqm.currIndex = 1 - psirqm.currIndex
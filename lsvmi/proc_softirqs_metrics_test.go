@@ -248,3 +248,70 @@ func TestProcSoftirqsMetrics(t *testing.T) {
 		)
 	}
 }
+
+func TestProcSoftirqsMetricsFilter(t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	instance, hostname := "lsvmi-test", "lsvmi-test-host"
+	currPromTs := int64(1_700_000_005_000)
+	prevPromTs := currPromTs - 5_000
+
+	procSoftirqsMetricsCfg := DefaultProcSoftirqsMetricsConfig()
+	procSoftirqsMetricsCfg.IncludeSoftirqs = []string{`NET_.*`}
+	procSoftirqsMetricsCfg.ExcludeSoftirqs = []string{`NET_TX`}
+	procSoftirqsMetrics, err := NewProcSoftirqsMetrics(procSoftirqsMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procSoftirqsMetrics.instance = instance
+	procSoftirqsMetrics.hostname = hostname
+
+	// NET_RX is included, NET_TX is excluded, TIMER is not included:
+	prevSoftirqs := procfs.NewSoftirqs("")
+	prevSoftirqs.NumCounters = 2
+	for _, irq := range []string{"TIMER", "NET_TX", "NET_RX"} {
+		prevSoftirqs.Counters[irq] = make([]uint64, prevSoftirqs.NumCounters)
+	}
+	currSoftirqs := prevSoftirqs.Clone(true)
+
+	currIndex := procSoftirqsMetrics.currIndex
+	procSoftirqsMetrics.procSoftirqs[currIndex] = currSoftirqs
+	procSoftirqsMetrics.procSoftirqsTs[currIndex] = time.UnixMilli(currPromTs)
+	procSoftirqsMetrics.procSoftirqs[1-currIndex] = prevSoftirqs
+	procSoftirqsMetrics.procSoftirqsTs[1-currIndex] = time.UnixMilli(prevPromTs)
+
+	testMetricsQueue := testutils.NewTestMetricsQueue(0)
+	buf := testMetricsQueue.GetBuf()
+	gotMetricsCount, gotTotalMetricsCount := procSoftirqsMetrics.generateMetrics(buf)
+	testMetricsQueue.QueueBuf(buf)
+
+	errBuf := &bytes.Buffer{}
+	// NET_RX: 2 deltas + info, + interval + excluded count:
+	wantMetricsCount := (2 + 1) + 1 + 1
+	if wantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(errBuf, "\nmetrics count: want: %d, got: %d", wantMetricsCount, gotMetricsCount)
+	}
+	if wantMetricsCount != gotTotalMetricsCount {
+		fmt.Fprintf(errBuf, "\ntotal metrics count: want: %d, got: %d", wantMetricsCount, gotTotalMetricsCount)
+	}
+	for _, irq := range []string{"TIMER", "NET_TX"} {
+		if _, ok := procSoftirqsMetrics.irqDataCache[irq]; ok {
+			fmt.Fprintf(errBuf, "\nirqDataCache: unexpected %q", irq)
+		}
+	}
+	wantMetrics := []string{
+		fmt.Sprintf(
+			`proc_softirqs_metrics_delta_sec{instance="%s",hostname="%s"} 5.000000 %d`,
+			instance, hostname, currPromTs,
+		),
+		fmt.Sprintf(
+			`proc_softirqs_excluded_count{instance="%s",hostname="%s"} 2 %d`,
+			instance, hostname, currPromTs,
+		),
+	}
+	testMetricsQueue.GenerateReport(wantMetrics, false, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
@@ -0,0 +1,556 @@
+// Textfile collector: ingest metrics from *.prom files in a directory, a-la
+// node_exporter textfile collector.
+
+package lsvmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/utils"
+)
+
+const (
+	TEXTFILE_METRICS_CONFIG_INTERVAL_DEFAULT            = "5s"
+	TEXTFILE_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT = 12
+	TEXTFILE_METRICS_CONFIG_DIRECTORY_DEFAULT           = ""
+
+	// This generator id:
+	TEXTFILE_METRICS_ID = "textfile_metrics"
+)
+
+const (
+	// METRIC{instance="INSTANCE",hostname="HOSTNAME",file="FILE"}:
+	TEXTFILE_MTIME_SEC_METRIC         = "textfile_mtime_sec"
+	TEXTFILE_PARSE_ERROR_COUNT_METRIC = "textfile_parse_error_count"
+
+	TEXTFILE_FILE_LABEL_NAME = "file"
+
+	TEXTFILE_MTIME_SEC_METRIC_PREC = 3
+
+	// Only files w/ this suffix are considered:
+	TEXTFILE_FILE_SUFFIX = ".prom"
+)
+
+var textfileMetricsLog = NewCompLogger(TEXTFILE_METRICS_ID)
+
+// Limit the size of the files, larger ones are treated as errors:
+var textfileReadFileBufPool = utils.NewReadFileBufPool(4, 0x100000)
+
+// Escape the value of the file label:
+var textfileLabelValueReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+type TextfileMetricsConfig struct {
+	// How often to generate the metrics in time.ParseDuration() format:
+	Interval string `yaml:"interval"`
+	// Normally metrics are generated only if there is a change in value from
+	// the previous scan. However every N cycles the full set is generated. Use
+	// 0 to generate full metrics every cycle.
+	FullMetricsFactor int `yaml:"full_metrics_factor"`
+	// The directory to scan for *.prom files; the generator is disabled if
+	// empty:
+	Directory string `yaml:"directory"`
+}
+
+func DefaultTextfileMetricsConfig() *TextfileMetricsConfig {
+	return &TextfileMetricsConfig{
+		Interval:          TEXTFILE_METRICS_CONFIG_INTERVAL_DEFAULT,
+		FullMetricsFactor: TEXTFILE_METRICS_CONFIG_FULL_METRICS_FACTOR_DEFAULT,
+		Directory:         TEXTFILE_METRICS_CONFIG_DIRECTORY_DEFAULT,
+	}
+}
+
+// A metric parsed from file:
+type TextfileMetric struct {
+	// The metric w/ the injected labels, w/o value:
+	metric []byte
+	// The value, as found in the file:
+	val string
+}
+
+// Per file state:
+type TextfileMetricsFile struct {
+	// The modification time, as of the most recent scan, and as of the most
+	// recent successful read; the file is re-parsed only if the latter
+	// changed:
+	mtime, readMtime time.Time
+	// Whether the most recent read failed or not:
+	readErr bool
+	// The metrics, in file order:
+	metrics []*TextfileMetric
+	// The values from the previous generation, indexed by metric, used for
+	// change detection:
+	prevVals map[string]string
+	// The number of invalid lines in the most recent parse, or 1 if the file
+	// could not be read, and the previous value:
+	parseErrCount, prevParseErrCount int
+	// Whether the file was re-parsed since the previous generation:
+	changed bool
+
+	// Per file metrics, w/o value:
+	mtimeMetric, parseErrCountMetric []byte
+}
+
+type TextfileMetrics struct {
+	// id/task_id:
+	id string
+
+	// Scan interval:
+	interval time.Duration
+
+	// Full metric factor:
+	fullMetricsFactor int
+
+	// The directory to scan:
+	directory string
+
+	// Per file state, indexed by file name:
+	files map[string]*TextfileMetricsFile
+
+	// Whether the previous directory scan failed, used to log errors only
+	// once:
+	dirErr bool
+
+	// The injected labels, `instance="INSTANCE",hostname="HOSTNAME"`:
+	injectedLabels []byte
+
+	// Cycle#:
+	cycleNum int
+
+	// A buffer for the timestamp suffix:
+	tsSuffixBuf *bytes.Buffer
+
+	// The following are needed for testing only. Left to their default values,
+	// the usual objects will be used.
+	instance, hostname string
+	timeNowFn          func() time.Time
+	metricsQueue       MetricsQueue
+}
+
+func NewTextfileMetrics(cfg any) (*TextfileMetrics, error) {
+	var (
+		err                error
+		textfileMetricsCfg *TextfileMetricsConfig
+	)
+
+	switch cfg := cfg.(type) {
+	case *LsvmiConfig:
+		textfileMetricsCfg = cfg.TextfileMetricsConfig
+	case *TextfileMetricsConfig:
+		textfileMetricsCfg = cfg
+	case nil:
+		textfileMetricsCfg = DefaultTextfileMetricsConfig()
+	default:
+		return nil, fmt.Errorf("NewTextfileMetrics: %T invalid config type", cfg)
+	}
+
+	interval, err := time.ParseDuration(textfileMetricsCfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	textfileMetrics := &TextfileMetrics{
+		id:                TEXTFILE_METRICS_ID,
+		interval:          interval,
+		fullMetricsFactor: textfileMetricsCfg.FullMetricsFactor,
+		directory:         textfileMetricsCfg.Directory,
+		files:             make(map[string]*TextfileMetricsFile),
+		cycleNum:          initialCycleNum.Get(textfileMetricsCfg.FullMetricsFactor),
+		tsSuffixBuf:       &bytes.Buffer{},
+	}
+
+	textfileMetricsLog.Infof("id=%s", textfileMetrics.id)
+	textfileMetricsLog.Infof("interval=%s", textfileMetrics.interval)
+	textfileMetricsLog.Infof("full_metrics_factor=%d", textfileMetrics.fullMetricsFactor)
+	textfileMetricsLog.Infof("directory=%q", textfileMetrics.directory)
+	return textfileMetrics, nil
+}
+
+func (tfm *TextfileMetrics) newFile(name string) *TextfileMetricsFile {
+	instance, hostname := GlobalInstance, GlobalHostname
+	if tfm.instance != "" {
+		instance = tfm.instance
+	}
+	if tfm.hostname != "" {
+		hostname = tfm.hostname
+	}
+	buildMetric := func(metricName string) []byte {
+		return []byte(fmt.Sprintf(
+			`%s{%s="%s",%s="%s",%s="%s"} `, // N.B. the space before the value is included!
+			metricName,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+			TEXTFILE_FILE_LABEL_NAME, textfileLabelValueReplacer.Replace(name),
+		))
+	}
+	return &TextfileMetricsFile{
+		prevVals:            make(map[string]string),
+		prevParseErrCount:   -1,
+		mtimeMetric:         buildMetric(TEXTFILE_MTIME_SEC_METRIC),
+		parseErrCountMetric: buildMetric(TEXTFILE_PARSE_ERROR_COUNT_METRIC),
+	}
+}
+
+func isTextfileNameStartChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isTextfileNameChar(c byte) bool {
+	return isTextfileNameStartChar(c) || '0' <= c && c <= '9'
+}
+
+func skipTextfileSpaces(line []byte, pos int) int {
+	for ; pos < len(line) && (line[pos] == ' ' || line[pos] == '\t'); pos++ {
+	}
+	return pos
+}
+
+// Parse a metric line in Prometheus exposition format:
+//
+//	NAME[{LABEL="VALUE",...}] VALUE [TIMESTAMP]
+//
+// and return the metric with the injected labels, w/o value, and the value.
+// The timestamp, if present, is discarded, the scan timestamp will be used
+// instead.
+func (tfm *TextfileMetrics) parseLine(line []byte) ([]byte, string, error) {
+	l := len(line)
+
+	// Metric name, the colon is allowed as well:
+	pos := 0
+	if pos < l && (isTextfileNameStartChar(line[pos]) || line[pos] == ':') {
+		for pos++; pos < l && (isTextfileNameChar(line[pos]) || line[pos] == ':'); pos++ {
+		}
+	}
+	if pos == 0 {
+		return nil, "", fmt.Errorf("invalid metric name")
+	}
+
+	metric := &bytes.Buffer{}
+	metric.Write(line[:pos])
+	metric.WriteByte('{')
+	metric.Write(tfm.injectedLabels)
+
+	// Optional labels:
+	pos = skipTextfileSpaces(line, pos)
+	if pos < l && line[pos] == '{' {
+		pos++
+		for {
+			pos = skipTextfileSpaces(line, pos)
+			if pos < l && line[pos] == '}' {
+				pos++
+				break
+			}
+			labelStart := pos
+			if pos < l && isTextfileNameStartChar(line[pos]) {
+				for pos++; pos < l && isTextfileNameChar(line[pos]); pos++ {
+				}
+			}
+			if pos == labelStart {
+				return nil, "", fmt.Errorf("invalid label name")
+			}
+			labelName := string(line[labelStart:pos])
+			if labelName == INSTANCE_LABEL_NAME || labelName == HOSTNAME_LABEL_NAME {
+				return nil, "", fmt.Errorf("%q: reserved label name", labelName)
+			}
+			pos = skipTextfileSpaces(line, pos)
+			if pos >= l || line[pos] != '=' {
+				return nil, "", fmt.Errorf("%q: missing '='", labelName)
+			}
+			pos = skipTextfileSpaces(line, pos+1)
+			if pos >= l || line[pos] != '"' {
+				return nil, "", fmt.Errorf("%q: missing opening '\"'", labelName)
+			}
+			valStart := pos
+			for pos++; pos < l && line[pos] != '"'; pos++ {
+				if line[pos] == '\\' {
+					pos++
+				}
+			}
+			if pos >= l {
+				return nil, "", fmt.Errorf("%q: missing closing '\"'", labelName)
+			}
+			pos++
+			metric.WriteByte(',')
+			metric.WriteString(labelName)
+			metric.WriteByte('=')
+			metric.Write(line[valStart:pos])
+			pos = skipTextfileSpaces(line, pos)
+			if pos < l && line[pos] == ',' {
+				pos++
+			} else if pos >= l || line[pos] != '}' {
+				return nil, "", fmt.Errorf("%q: missing ',' or '}'", labelName)
+			}
+		}
+	}
+	metric.WriteString("} ") // N.B. the space before the value is included!
+
+	// Value and optional timestamp:
+	fields := bytes.Fields(line[pos:])
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, "", fmt.Errorf("invalid value/timestamp")
+	}
+	val := string(fields[0])
+	if _, err := strconv.ParseFloat(val, 64); err != nil {
+		return nil, "", fmt.Errorf("%q: invalid value", val)
+	}
+	if len(fields) == 2 {
+		if _, err := strconv.ParseInt(string(fields[1]), 10, 64); err != nil {
+			return nil, "", fmt.Errorf("%q: invalid timestamp", fields[1])
+		}
+	}
+
+	return metric.Bytes(), val, nil
+}
+
+// Parse a file, updating the metrics and the parse error count:
+func (tfm *TextfileMetrics) parseFile(name string, file *TextfileMetricsFile) {
+	filePath := path.Join(tfm.directory, name)
+	fBuf, err := textfileReadFileBufPool.ReadFile(filePath)
+	defer textfileReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		// The read is retried at every scan, log only the 1st error:
+		if !file.readErr {
+			textfileMetricsLog.Warnf("%s: %v", filePath, err)
+		}
+		file.readErr = true
+		file.metrics = file.metrics[:0]
+		file.parseErrCount = 1
+		return
+	}
+	file.readErr = false
+
+	metrics := file.metrics[:0]
+	parseErrCount := 0
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := bytes.TrimSpace(buf[pos:eolPos])
+		pos = eolPos + 1
+
+		// Skip empty lines and comments, HELP and TYPE included:
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		metric, val, err := tfm.parseLine(line)
+		if err != nil {
+			if parseErrCount == 0 {
+				// Log only the 1st error per file, to avoid flooding the log:
+				textfileMetricsLog.Warnf("%s:%d: %q: %v", filePath, lineNum, line, err)
+			}
+			parseErrCount++
+			continue
+		}
+		metrics = append(metrics, &TextfileMetric{metric, val})
+	}
+	file.metrics = metrics
+	file.parseErrCount = parseErrCount
+}
+
+// Scan the directory and parse the new or changed files:
+func (tfm *TextfileMetrics) scanDirectory() {
+	if tfm.injectedLabels == nil {
+		instance, hostname := GlobalInstance, GlobalHostname
+		if tfm.instance != "" {
+			instance = tfm.instance
+		}
+		if tfm.hostname != "" {
+			hostname = tfm.hostname
+		}
+		tfm.injectedLabels = []byte(fmt.Sprintf(
+			`%s="%s",%s="%s"`,
+			INSTANCE_LABEL_NAME, instance,
+			HOSTNAME_LABEL_NAME, hostname,
+		))
+	}
+
+	entries, err := os.ReadDir(tfm.directory)
+	if err != nil {
+		if !tfm.dirErr {
+			textfileMetricsLog.Warn(err)
+			tfm.dirErr = true
+		}
+		clear(tfm.files)
+		return
+	}
+	tfm.dirErr = false
+
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, TEXTFILE_FILE_SUFFIX) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// The file may have been removed in the meantime:
+			if !errors.Is(err, os.ErrNotExist) {
+				textfileMetricsLog.Warnf("%s: %v", path.Join(tfm.directory, name), err)
+			}
+			continue
+		}
+		found[name] = true
+		file := tfm.files[name]
+		if file == nil {
+			file = tfm.newFile(name)
+			tfm.files[name] = file
+		}
+		mtime := info.ModTime()
+		if !mtime.Equal(file.readMtime) {
+			// The read mtime is updated only if the read succeeded, such that
+			// a failed read, e.g. EACCES, is retried at the next scan; fixing
+			// the permissions does not update the mtime:
+			prevReadErr := file.readErr
+			tfm.parseFile(name, file)
+			if !file.readErr {
+				file.readMtime = mtime
+			}
+			// Repeated read errors w/ the same mtime change nothing:
+			if !prevReadErr || !file.readErr || !mtime.Equal(file.mtime) {
+				file.changed = true
+			}
+		}
+		file.mtime = mtime
+	}
+
+	// Remove out of scope files:
+	for name := range tfm.files {
+		if !found[name] {
+			delete(tfm.files, name)
+		}
+	}
+}
+
+func (tfm *TextfileMetrics) generateMetrics(buf *bytes.Buffer, ts time.Time) (int, int) {
+	actualMetricsCount := 0
+	tfm.tsSuffixBuf.Reset()
+	fmt.Fprintf(
+		tfm.tsSuffixBuf, " %d\n", ts.UnixMilli(),
+	)
+	promTs := tfm.tsSuffixBuf.Bytes()
+
+	fullMetrics := tfm.cycleNum == 0
+	totalMetricsCount := 0
+
+	// Generate in file name order, for reproducibility:
+	names := make([]string, 0, len(tfm.files))
+	for name := range tfm.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := tfm.files[name]
+
+		// The file metrics can change only if the file changed, save for full
+		// cycles:
+		if file.changed || fullMetrics {
+			prevVals := file.prevVals
+			vals := make(map[string]string, len(file.metrics))
+			for _, metric := range file.metrics {
+				key := string(metric.metric)
+				if prevVal, ok := prevVals[key]; fullMetrics || !ok || prevVal != metric.val {
+					buf.Write(metric.metric)
+					buf.WriteString(metric.val)
+					buf.Write(promTs)
+					actualMetricsCount++
+				}
+				vals[key] = metric.val
+			}
+			file.prevVals = vals
+
+			buf.Write(file.mtimeMetric)
+			buf.WriteString(strconv.FormatFloat(
+				float64(file.mtime.UnixMilli())/1000., 'f', TEXTFILE_MTIME_SEC_METRIC_PREC, 64,
+			))
+			buf.Write(promTs)
+			actualMetricsCount++
+
+			file.changed = false
+		}
+
+		if fullMetrics || file.parseErrCount != file.prevParseErrCount {
+			buf.Write(file.parseErrCountMetric)
+			buf.WriteString(strconv.Itoa(file.parseErrCount))
+			buf.Write(promTs)
+			actualMetricsCount++
+			file.prevParseErrCount = file.parseErrCount
+		}
+
+		// The total number of metrics:
+		//		file metrics#: number of parsed metrics
+		//		per file metrics#: 2 (mtime, parse error count)
+		totalMetricsCount += len(file.metrics) + 2
+	}
+
+	if tfm.cycleNum++; tfm.cycleNum >= tfm.fullMetricsFactor {
+		tfm.cycleNum = 0
+	}
+
+	return actualMetricsCount, totalMetricsCount
+}
+
+// Satisfy the TaskActivity interface:
+func (tfm *TextfileMetrics) Execute() bool {
+	timeNowFn := time.Now
+	if tfm.timeNowFn != nil {
+		timeNowFn = tfm.timeNowFn
+	}
+
+	metricsQueue := GlobalMetricsQueue
+	if tfm.metricsQueue != nil {
+		metricsQueue = tfm.metricsQueue
+	}
+
+	tfm.scanDirectory()
+
+	buf := metricsQueue.GetBuf()
+	actualMetricsCount, totalMetricsCount := tfm.generateMetrics(buf, timeNowFn())
+	byteCount := buf.Len()
+	metricsQueue.QueueBuf(buf)
+	GlobalMetricsGeneratorStatsContainer.Update(
+		tfm.id, uint64(actualMetricsCount), uint64(totalMetricsCount), uint64(byteCount),
+	)
+
+	return true
+}
+
+// Define and register the task builder:
+func TextfileMetricsTaskBuilder(cfg *LsvmiConfig) ([]*Task, error) {
+	tfm, err := NewTextfileMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tfm.interval <= 0 {
+		textfileMetricsLog.Infof(
+			"interval=%s, metrics disabled", tfm.interval,
+		)
+		return nil, nil
+	}
+	if tfm.directory == "" {
+		textfileMetricsLog.Info("no directory configured, metrics disabled")
+		return nil, nil
+	}
+	tasks := []*Task{
+		NewTask(tfm.id, tfm.interval, tfm),
+	}
+	return tasks, nil
+}
+
+func init() {
+	TaskBuilders.Register(TextfileMetricsTaskBuilder)
+}
@@ -0,0 +1,279 @@
+// Tests for textfile_metrics.go
+
+package lsvmi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type TextfileMetricsTestCase struct {
+	Name string
+	// The sequence of directory contents, indexed by file name; files not
+	// present in a step are removed. An empty content denotes an unchanged
+	// file, i.e. w/ the same mtime. Metrics are checked after the last step:
+	ContentSeq []map[string]string
+	// Whether the files keep the mtime from the 1st step when rewritten, e.g.
+	// simulating a permission fix:
+	KeepMtime         bool
+	FullMetricsFactor int
+	WantMetricsCount  int
+	WantMetrics       []string
+	ReportExtra       bool
+}
+
+func testTextfileMetrics(tc *TextfileMetricsTestCase, t *testing.T) {
+	tlc := testutils.NewTestLogCollect(t, Log, nil)
+	defer tlc.RestoreLog()
+
+	directory := t.TempDir()
+	textfileMetricsCfg := DefaultTextfileMetricsConfig()
+	textfileMetricsCfg.FullMetricsFactor = tc.FullMetricsFactor
+	textfileMetricsCfg.Directory = directory
+	textfileMetrics, err := NewTextfileMetrics(textfileMetricsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textfileMetrics.instance = "lsvmi-test"
+	textfileMetrics.hostname = "lsvmi-test-host"
+	textfileMetrics.cycleNum = 0
+
+	ts := time.UnixMilli(1_700_000_000_000)
+	mtime := ts
+	var testMetricsQueue *testutils.TestMetricsQueue
+	gotMetricsCount := 0
+	for _, contents := range tc.ContentSeq {
+		entries, err := os.ReadDir(directory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if _, ok := contents[entry.Name()]; !ok {
+				os.Remove(path.Join(directory, entry.Name()))
+			}
+		}
+		for name, content := range contents {
+			if content == "" {
+				continue
+			}
+			filePath := path.Join(directory, name)
+			if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// Use the scan timestamp as mtime, for reproducibility:
+			if !tc.KeepMtime {
+				mtime = ts
+			}
+			if err := os.Chtimes(filePath, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		textfileMetrics.scanDirectory()
+		testMetricsQueue = testutils.NewTestMetricsQueue(0)
+		buf := testMetricsQueue.GetBuf()
+		gotMetricsCount, _ = textfileMetrics.generateMetrics(buf, ts)
+		testMetricsQueue.QueueBuf(buf)
+		ts = ts.Add(5 * time.Second)
+	}
+
+	errBuf := &bytes.Buffer{}
+	if tc.WantMetricsCount != gotMetricsCount {
+		fmt.Fprintf(
+			errBuf,
+			"\nmetrics count: want: %d, got: %d",
+			tc.WantMetricsCount, gotMetricsCount,
+		)
+	}
+	testMetricsQueue.GenerateReport(tc.WantMetrics, tc.ReportExtra, errBuf)
+	if errBuf.Len() > 0 {
+		t.Fatal(errBuf)
+	}
+}
+
+func TestTextfileMetrics(t *testing.T) {
+	labels := `instance="lsvmi-test",hostname="lsvmi-test-host"`
+	promTs := int64(1_700_000_005_000)
+
+	jobProm := `# HELP job_last_success_sec Last successful run.
+# TYPE job_last_success_sec gauge
+job_last_success_sec{job="backup"} 1699999000
+
+job_runs_total{job="backup",status="ok"} 10 1699999000000
+job_up 1
+`
+	jobPromChanged := `job_last_success_sec{job="backup"} 1700000000
+job_runs_total{job="backup",status="ok"} 10
+job_up 1
+`
+
+	for _, tc := range []*TextfileMetricsTestCase{
+		{
+			Name: "full",
+			ContentSeq: []map[string]string{
+				{"job.prom": jobProm, "ignored.txt": "x 1\n"},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  5,
+			WantMetrics: []string{
+				fmt.Sprintf(`job_last_success_sec{%s,job="backup"} 1699999000 %d`, labels, promTs-5000),
+				fmt.Sprintf(`job_runs_total{%s,job="backup",status="ok"} 10 %d`, labels, promTs-5000),
+				fmt.Sprintf(`job_up{%s} 1 %d`, labels, promTs-5000),
+				fmt.Sprintf(`textfile_mtime_sec{%s,file="job.prom"} 1700000000.000 %d`, labels, promTs-5000),
+				fmt.Sprintf(`textfile_parse_error_count{%s,file="job.prom"} 0 %d`, labels, promTs-5000),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "changed",
+			ContentSeq: []map[string]string{
+				{"job.prom": jobProm},
+				{"job.prom": jobPromChanged},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  2,
+			WantMetrics: []string{
+				fmt.Sprintf(`job_last_success_sec{%s,job="backup"} 1700000000 %d`, labels, promTs),
+				fmt.Sprintf(`textfile_mtime_sec{%s,file="job.prom"} 1700000005.000 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "unchanged",
+			ContentSeq: []map[string]string{
+				{"job.prom": jobProm},
+				{"job.prom": ""},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  0,
+			ReportExtra:       true,
+		},
+		{
+			Name: "unchanged_full",
+			ContentSeq: []map[string]string{
+				{"job.prom": jobProm},
+				{"job.prom": ""},
+			},
+			FullMetricsFactor: 1,
+			WantMetricsCount:  5,
+		},
+		{
+			Name: "parse_error",
+			ContentSeq: []map[string]string{
+				{"job.prom": jobProm},
+				{"job.prom": jobPromChanged + "bad{x=1} 1\njob_up{instance=\"x\"} 1\njob_up NotANumber\n"},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  3,
+			WantMetrics: []string{
+				fmt.Sprintf(`job_last_success_sec{%s,job="backup"} 1700000000 %d`, labels, promTs),
+				fmt.Sprintf(`textfile_mtime_sec{%s,file="job.prom"} 1700000005.000 %d`, labels, promTs),
+				fmt.Sprintf(`textfile_parse_error_count{%s,file="job.prom"} 3 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "read_error_retry",
+			ContentSeq: []map[string]string{
+				// Exceeding the max size is treated as a read error:
+				{"job.prom": "job_up 1\n" + strings.Repeat("#", 0x100000)},
+				{"job.prom": jobProm},
+			},
+			KeepMtime:         true,
+			FullMetricsFactor: 12,
+			WantMetricsCount:  5,
+			WantMetrics: []string{
+				fmt.Sprintf(`job_last_success_sec{%s,job="backup"} 1699999000 %d`, labels, promTs),
+				fmt.Sprintf(`job_runs_total{%s,job="backup",status="ok"} 10 %d`, labels, promTs),
+				fmt.Sprintf(`job_up{%s} 1 %d`, labels, promTs),
+				fmt.Sprintf(`textfile_mtime_sec{%s,file="job.prom"} 1700000000.000 %d`, labels, promTs),
+				fmt.Sprintf(`textfile_parse_error_count{%s,file="job.prom"} 0 %d`, labels, promTs),
+			},
+			ReportExtra: true,
+		},
+		{
+			Name: "read_error_repeated",
+			ContentSeq: []map[string]string{
+				{"job.prom": "job_up 1\n" + strings.Repeat("#", 0x100000)},
+				{"job.prom": ""},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  0,
+			ReportExtra:       true,
+		},
+		{
+			Name: "file_label_escape",
+			ContentSeq: []map[string]string{
+				{`job"1\.prom`: "job_up 1\n"},
+			},
+			FullMetricsFactor: 12,
+			WantMetricsCount:  3,
+			WantMetrics: []string{
+				fmt.Sprintf(`job_up{%s} 1 %d`, labels, promTs-5000),
+				fmt.Sprintf(`textfile_mtime_sec{%s,file="job\"1\\.prom"} 1700000000.000 %d`, labels, promTs-5000),
+				fmt.Sprintf(`textfile_parse_error_count{%s,file="job\"1\\.prom"} 0 %d`, labels, promTs-5000),
+			},
+			ReportExtra: true,
+		},
+	} {
+		t.Run(
+			tc.Name,
+			func(t *testing.T) { testTextfileMetrics(tc, t) },
+		)
+	}
+}
+
+func TestTextfileMetricsParseLine(t *testing.T) {
+	textfileMetrics, err := NewTextfileMetrics(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textfileMetrics.injectedLabels = []byte(`instance="i",hostname="h"`)
+
+	for _, tc := range []struct {
+		line       string
+		wantMetric string
+		wantVal    string
+		wantErr    bool
+	}{
+		{`up 1`, `up{instance="i",hostname="h"} `, "1", false},
+		{`ns:up_total{} 1 123`, `ns:up_total{instance="i",hostname="h"} `, "1", false},
+		{`up { a = "x\"}y" , b="2", } -Inf`, `up{instance="i",hostname="h",a="x\"}y",b="2"} `, "-Inf", false},
+		{`up{a="1"} NaN`, `up{instance="i",hostname="h",a="1"} `, "NaN", false},
+		{`1up 1`, "", "", true},
+		{`up{a="1} 1`, "", "", true},
+		{`up{a="1" b="2"} 1`, "", "", true},
+		{`up{hostname="x"} 1`, "", "", true},
+		{`up`, "", "", true},
+		{`up 1 2 3`, "", "", true},
+		{`up 1 1.5`, "", "", true},
+	} {
+		t.Run(
+			tc.line,
+			func(t *testing.T) {
+				gotMetric, gotVal, err := textfileMetrics.parseLine([]byte(tc.line))
+				if tc.wantErr {
+					if err == nil {
+						t.Fatalf("want error, got: metric: %q, val: %q", gotMetric, gotVal)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tc.wantMetric != string(gotMetric) || tc.wantVal != gotVal {
+					t.Fatalf(
+						"want: (%q, %q), got: (%q, %q)",
+						tc.wantMetric, tc.wantVal, gotMetric, gotVal,
+					)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,138 @@
+// parser for /proc/buddyinfo
+
+package procfs
+
+// File format:
+//
+//  Node 0, zone      DMA      0      0      0      0      0      0      0      0      1      1      3
+//  Node 0, zone    DMA32      2      2      2      2      2      2      5      2      2      2    754
+//  Node 0, zone   Normal   4264   1569   3071    680    282    118     47      1      1      2     12
+//
+// The numbers are the count of free blocks of 2^order pages, starting w/ order
+// 0. The number of orders is given by the kernel config (MAX_PAGE_ORDER + 1),
+// typically 11.
+//
+// References:
+//  https://github.com/torvalds/linux/blob/v6.8/mm/vmstat.c#L1497
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+var (
+	buddyinfoNodePrefix = []byte("Node")
+	buddyinfoZonePrefix = []byte("zone")
+)
+
+type BuddyinfoZone struct {
+	// NUMA node#:
+	Node int
+	// Zone name, e.g. DMA, DMA32, Normal:
+	Zone string
+	// Free block count, indexed by order:
+	FreeBlocks []uint64
+}
+
+type Buddyinfo struct {
+	// The zones, in file order:
+	Zones []*BuddyinfoZone
+	// The path file to read:
+	path string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var buddyinfoReadFileBufPool = ReadFileBufPool16k
+
+func BuddyinfoPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "buddyinfo")
+}
+
+func NewBuddyinfo(procfsRoot string) *Buddyinfo {
+	return &Buddyinfo{
+		path: BuddyinfoPath(procfsRoot),
+	}
+}
+
+func (buddyinfo *Buddyinfo) Clone(full bool) *Buddyinfo {
+	newBuddyinfo := &Buddyinfo{
+		path: buddyinfo.path,
+	}
+	if full {
+		newBuddyinfo.Zones = make([]*BuddyinfoZone, len(buddyinfo.Zones))
+		for i, zone := range buddyinfo.Zones {
+			newBuddyinfo.Zones[i] = &BuddyinfoZone{
+				Node:       zone.Node,
+				Zone:       zone.Zone,
+				FreeBlocks: make([]uint64, len(zone.FreeBlocks)),
+			}
+			copy(newBuddyinfo.Zones[i].FreeBlocks, zone.FreeBlocks)
+		}
+	}
+	return newBuddyinfo
+}
+
+func (buddyinfo *Buddyinfo) Parse() error {
+	fBuf, err := buddyinfoReadFileBufPool.ReadFile(buddyinfo.path)
+	defer buddyinfoReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	// Zones are reused in file order, they change only w/ memory hotplug:
+	numZones := 0
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// Node N, zone NAME COUNT...:
+		if len(fields) < 5 ||
+			!bytes.Equal(fields[0], buddyinfoNodePrefix) ||
+			!bytes.Equal(fields[2], buddyinfoZonePrefix) {
+			return fmt.Errorf("%s:%d: %q: invalid line", buddyinfo.path, lineNum, line)
+		}
+		node, err := strconv.Atoi(string(bytes.TrimSuffix(fields[1], []byte{','})))
+		if err != nil || node < 0 {
+			return fmt.Errorf("%s:%d: %q: invalid node#", buddyinfo.path, lineNum, line)
+		}
+
+		var zone *BuddyinfoZone
+		if numZones < len(buddyinfo.Zones) {
+			zone = buddyinfo.Zones[numZones]
+		} else {
+			zone = &BuddyinfoZone{}
+			buddyinfo.Zones = append(buddyinfo.Zones, zone)
+		}
+		numZones++
+		zone.Node = node
+		if zone.Zone != string(fields[3]) {
+			zone.Zone = string(fields[3])
+		}
+		numOrders := len(fields) - 4
+		if len(zone.FreeBlocks) != numOrders {
+			zone.FreeBlocks = make([]uint64, numOrders)
+		}
+		for order := 0; order < numOrders; order++ {
+			zone.FreeBlocks[order], err = strconv.ParseUint(string(fields[order+4]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %q: invalid value", buddyinfo.path, lineNum, line)
+			}
+		}
+	}
+	buddyinfo.Zones = buddyinfo.Zones[:numZones]
+
+	return nil
+}
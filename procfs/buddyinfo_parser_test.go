@@ -0,0 +1,134 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type BuddyinfoTestCase struct {
+	name           string
+	procfsRoot     string
+	primeBuddyinfo *Buddyinfo
+	wantBuddyinfo  *Buddyinfo
+	wantError      error
+}
+
+var buddyinfoTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "buddyinfo")
+
+func testBuddyinfoParser(tc *BuddyinfoTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+primeBuddyinfo=%v
+`,
+		tc.name, tc.procfsRoot, (tc.primeBuddyinfo != nil),
+	)
+
+	var buddyinfo *Buddyinfo
+	if tc.primeBuddyinfo != nil {
+		buddyinfo = tc.primeBuddyinfo.Clone(true)
+		buddyinfo.path = BuddyinfoPath(tc.procfsRoot)
+	} else {
+		buddyinfo = NewBuddyinfo(tc.procfsRoot)
+	}
+
+	err := buddyinfo.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantBuddyinfo := tc.wantBuddyinfo
+	diffBuf := &bytes.Buffer{}
+
+	if len(wantBuddyinfo.Zones) != len(buddyinfo.Zones) {
+		fmt.Fprintf(diffBuf, "\nlen(Zones): want: %d, got: %d", len(wantBuddyinfo.Zones), len(buddyinfo.Zones))
+	} else {
+		for i, wantZone := range wantBuddyinfo.Zones {
+			gotZone := buddyinfo.Zones[i]
+			if wantZone.Node != gotZone.Node || wantZone.Zone != gotZone.Zone {
+				fmt.Fprintf(
+					diffBuf,
+					"\nZones[%d]: want: node=%d, zone=%s, got: node=%d, zone=%s",
+					i, wantZone.Node, wantZone.Zone, gotZone.Node, gotZone.Zone,
+				)
+				continue
+			}
+			if len(wantZone.FreeBlocks) != len(gotZone.FreeBlocks) {
+				fmt.Fprintf(
+					diffBuf,
+					"\nZones[%d].FreeBlocks: len: want: %d, got: %d",
+					i, len(wantZone.FreeBlocks), len(gotZone.FreeBlocks),
+				)
+				continue
+			}
+			for order, wantVal := range wantZone.FreeBlocks {
+				if gotVal := gotZone.FreeBlocks[order]; wantVal != gotVal {
+					fmt.Fprintf(
+						diffBuf,
+						"\nZones[%d].FreeBlocks[%d]: want: %d, got: %d",
+						i, order, wantVal, gotVal,
+					)
+				}
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestBuddyinfoParser(t *testing.T) {
+	wantBuddyinfo := &Buddyinfo{
+		Zones: []*BuddyinfoZone{
+			{Node: 0, Zone: "DMA", FreeBlocks: []uint64{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 3}},
+			{Node: 0, Zone: "DMA32", FreeBlocks: []uint64{2, 2, 2, 2, 2, 2, 5, 2, 2, 2, 754}},
+			{Node: 0, Zone: "Normal", FreeBlocks: []uint64{4264, 1569, 3071, 680, 282, 118, 47, 1, 1, 2, 12}},
+			{Node: 1, Zone: "Normal", FreeBlocks: []uint64{1000, 500, 250, 125, 60, 30, 15, 7, 3, 1, 0}},
+		},
+	}
+
+	for _, tc := range []*BuddyinfoTestCase{
+		{
+			name:          "field_mapping",
+			procfsRoot:    path.Join(buddyinfoTestDataDir, "field_mapping"),
+			wantBuddyinfo: wantBuddyinfo,
+		},
+		{
+			name:       "reuse",
+			procfsRoot: path.Join(buddyinfoTestDataDir, "field_mapping"),
+			primeBuddyinfo: &Buddyinfo{
+				Zones: []*BuddyinfoZone{
+					{Node: 0, Zone: "Normal", FreeBlocks: []uint64{1, 2, 3}},
+					{Node: 1, Zone: "Normal", FreeBlocks: []uint64{4, 5, 6}},
+					{Node: 2, Zone: "Normal", FreeBlocks: []uint64{7, 8, 9}},
+					{Node: 3, Zone: "Normal", FreeBlocks: []uint64{7, 8, 9}},
+					{Node: 4, Zone: "Normal", FreeBlocks: []uint64{7, 8, 9}},
+				},
+			},
+			wantBuddyinfo: wantBuddyinfo,
+		},
+		{
+			name:       "invalid",
+			procfsRoot: path.Join(buddyinfoTestDataDir, "invalid"),
+			wantError: fmt.Errorf(
+				"%s:2: %q: invalid value",
+				path.Join(buddyinfoTestDataDir, "invalid", "buddyinfo"),
+				"Node 0, zone    DMA32      2      2      2      2      x      2      5      2      2      2    754 ",
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testBuddyinfoParser(tc, t) },
+		)
+	}
+}
@@ -63,6 +63,10 @@ var diskstatsFieldsInJiffies = [DISKSTATS_VALUE_FIELDS_NUM]bool{
 type DiskstatsDevInfo struct {
 	Name  string
 	Stats []uint32
+	// The number of values actually found in the file, which may be less than
+	// DISKSTATS_VALUE_FIELDS_NUM for older kernels (e.g. no discard or flush
+	// fields); the missing values are left at 0:
+	NumValues int
 	// Devices may be appear/disappear dynamically. To keep track of deletion,
 	// each parse invocation is associated with a different from before scan#
 	// and each found device will be updated below for it. At the end of the
@@ -128,9 +132,10 @@ func (diskstats *Diskstats) Clone(full bool) *Diskstats {
 
 	for majorMinor, devInfo := range diskstats.DevInfoMap {
 		newDiskstats.DevInfoMap[majorMinor] = &DiskstatsDevInfo{
-			Name:    devInfo.Name,
-			Stats:   make([]uint32, DISKSTATS_VALUE_FIELDS_NUM),
-			scanNum: devInfo.scanNum,
+			Name:      devInfo.Name,
+			Stats:     make([]uint32, DISKSTATS_VALUE_FIELDS_NUM),
+			NumValues: devInfo.NumValues,
+			scanNum:   devInfo.scanNum,
 		}
 		if full {
 			copy(newDiskstats.DevInfoMap[majorMinor].Stats, devInfo.Stats)
@@ -246,7 +251,8 @@ func (diskstats *Diskstats) Parse() error {
 			}
 		}
 
-		// Update scan# for device:
+		// Update scan# and the number of values for device:
+		devInfo.NumValues = fieldNum
 		devInfo.scanNum = scanNum
 	}
 
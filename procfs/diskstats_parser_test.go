@@ -94,6 +94,14 @@ disableJiffiesToMillisec=%v
 
 			}
 
+			if wantDevInfo.NumValues > 0 && wantDevInfo.NumValues != gotDevInfo.NumValues {
+				fmt.Fprintf(
+					diffBuf,
+					"\nDevInfoMap[%q].NumValues: want: %d, got: %d",
+					devMajMin, wantDevInfo.NumValues, gotDevInfo.NumValues,
+				)
+			}
+
 			wantDevStats, gotDevStats := wantDevInfo.Stats, gotDevInfo.Stats
 			if len(wantDevStats) != len(gotDevStats) {
 				fmt.Fprintf(
@@ -252,6 +260,25 @@ func TestDiskstatsParser(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "older_kernel",
+			procfsRoot: path.Join(diskstatsTestDataDir, "older_kernel"),
+			wantDiskstats: &Diskstats{
+				DevInfoMap: map[string]*DiskstatsDevInfo{
+					"8:0": {
+						Name:      "sda",
+						Stats:     []uint32{1001, 1002, 1003, 1004, 1005, 1006, 1007, 1008, 1009, 1010, 1011, 0, 0, 0, 0, 0, 0},
+						NumValues: 11,
+					},
+					"8:16": {
+						Name:      "sdb",
+						Stats:     []uint32{2001, 2002, 2003, 2004, 2005, 2006, 2007, 2008, 2009, 2010, 2011, 2012, 2013, 2014, 2015, 0, 0},
+						NumValues: 15,
+					},
+				},
+			},
+			disableJiffiesToMillisec: true,
+		},
 	} {
 		t.Run(
 			tc.name,
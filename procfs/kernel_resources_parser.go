@@ -0,0 +1,189 @@
+// parser for kernel global resource usage and limits:
+//  /proc/sys/fs/file-nr
+//  /proc/sys/fs/inode-nr
+//  /proc/sys/kernel/pid_max
+//  /proc/sys/kernel/threads-max
+//  /proc/sys/kernel/random/entropy_avail
+//  /proc/sys/kernel/random/poolsize
+//  /proc/loadavg
+
+package procfs
+
+// File format:
+//
+//  file-nr:       ALLOCATED FREE MAX
+//  inode-nr:      NR_INODES NR_FREE_INODES
+//  pid_max:       VALUE
+//  threads-max:   VALUE
+//  entropy_avail: VALUE
+//  poolsize:      VALUE
+//  loadavg:       LOAD1 LOAD5 LOAD15 NR_RUNNING/NR_THREADS LAST_PID
+//
+// Notes:
+//  - the FREE field of file-nr is always 0 since kernel 2.6, the allocated file
+//    handles are all in use
+//  - NR_THREADS from loadavg is the number of scheduling entities (threads)
+//    in the system; it is used as a fallback when the thread count is not
+//    otherwise available (see PidTidListCache)
+//
+// References:
+//  https://www.kernel.org/doc/html/latest/admin-guide/sysctl/fs.html
+//  https://www.kernel.org/doc/html/latest/admin-guide/sysctl/kernel.html
+//  https://github.com/torvalds/linux/blob/v6.8/fs/proc/loadavg.c#L16
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// Indexes for the values:
+const (
+	KERNEL_RESOURCES_FILE_NR_ALLOCATED = iota
+	KERNEL_RESOURCES_FILE_NR_FREE
+	KERNEL_RESOURCES_FILE_NR_MAX
+	KERNEL_RESOURCES_INODE_NR
+	KERNEL_RESOURCES_INODE_NR_FREE
+	KERNEL_RESOURCES_PID_MAX
+	KERNEL_RESOURCES_THREADS_MAX
+	KERNEL_RESOURCES_ENTROPY_AVAIL
+	KERNEL_RESOURCES_ENTROPY_POOLSIZE
+	KERNEL_RESOURCES_NR_THREADS
+
+	// Must be last:
+	KERNEL_RESOURCES_NUM_VALUES
+)
+
+// The files consisting of whitespace separated decimal values, each file
+// mapping into consecutive indexes, starting w/ a given one:
+type kernelResourcesValueFile struct {
+	path       string
+	startIndex int
+	numValues  int
+}
+
+type KernelResources struct {
+	// The values, indexed by KERNEL_RESOURCES_...:
+	Values []uint64
+	// The value files:
+	valueFiles []*kernelResourcesValueFile
+	// The path to loadavg:
+	loadavgPath string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var kernelResourcesReadFileBufPool = ReadFileBufPool16k
+
+func KernelResourcesFileNrPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "fs", "file-nr")
+}
+
+func KernelResourcesInodeNrPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "fs", "inode-nr")
+}
+
+func KernelResourcesPidMaxPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "kernel", "pid_max")
+}
+
+func KernelResourcesThreadsMaxPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "kernel", "threads-max")
+}
+
+func KernelResourcesEntropyAvailPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "kernel", "random", "entropy_avail")
+}
+
+func KernelResourcesEntropyPoolsizePath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "kernel", "random", "poolsize")
+}
+
+func KernelResourcesLoadavgPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "loadavg")
+}
+
+func NewKernelResources(procfsRoot string) *KernelResources {
+	return &KernelResources{
+		Values: make([]uint64, KERNEL_RESOURCES_NUM_VALUES),
+		valueFiles: []*kernelResourcesValueFile{
+			{KernelResourcesFileNrPath(procfsRoot), KERNEL_RESOURCES_FILE_NR_ALLOCATED, 3},
+			{KernelResourcesInodeNrPath(procfsRoot), KERNEL_RESOURCES_INODE_NR, 2},
+			{KernelResourcesPidMaxPath(procfsRoot), KERNEL_RESOURCES_PID_MAX, 1},
+			{KernelResourcesThreadsMaxPath(procfsRoot), KERNEL_RESOURCES_THREADS_MAX, 1},
+			{KernelResourcesEntropyAvailPath(procfsRoot), KERNEL_RESOURCES_ENTROPY_AVAIL, 1},
+			{KernelResourcesEntropyPoolsizePath(procfsRoot), KERNEL_RESOURCES_ENTROPY_POOLSIZE, 1},
+		},
+		loadavgPath: KernelResourcesLoadavgPath(procfsRoot),
+	}
+}
+
+func (kernelResources *KernelResources) Clone(full bool) *KernelResources {
+	newKernelResources := &KernelResources{
+		Values:      make([]uint64, KERNEL_RESOURCES_NUM_VALUES),
+		valueFiles:  kernelResources.valueFiles, // read only, it can be shared
+		loadavgPath: kernelResources.loadavgPath,
+	}
+	if full {
+		copy(newKernelResources.Values, kernelResources.Values)
+	}
+	return newKernelResources
+}
+
+func (kernelResources *KernelResources) parseValueFile(valueFile *kernelResourcesValueFile) error {
+	fBuf, err := kernelResourcesReadFileBufPool.ReadFile(valueFile.path)
+	defer kernelResourcesReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	buf := fBuf.Bytes()
+	fields := bytes.Fields(buf)
+	if len(fields) < valueFile.numValues {
+		return fmt.Errorf(
+			"%s: %q: invalid value count: want: %d, got: %d",
+			valueFile.path, getCurrentLine(buf, 0), valueFile.numValues, len(fields),
+		)
+	}
+	for i, index := 0, valueFile.startIndex; i < valueFile.numValues; i, index = i+1, index+1 {
+		value, err := strconv.ParseUint(string(fields[i]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q: invalid value", valueFile.path, getCurrentLine(buf, 0))
+		}
+		kernelResources.Values[index] = value
+	}
+	return nil
+}
+
+func (kernelResources *KernelResources) parseLoadavg() error {
+	fBuf, err := kernelResourcesReadFileBufPool.ReadFile(kernelResources.loadavgPath)
+	defer kernelResourcesReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	buf := fBuf.Bytes()
+	fields := bytes.Fields(buf)
+	if len(fields) < 4 {
+		return fmt.Errorf("%s: %q: invalid line", kernelResources.loadavgPath, getCurrentLine(buf, 0))
+	}
+	slashPos := bytes.IndexByte(fields[3], '/')
+	if slashPos < 0 {
+		return fmt.Errorf("%s: %q: invalid NR_RUNNING/NR_THREADS", kernelResources.loadavgPath, getCurrentLine(buf, 0))
+	}
+	value, err := strconv.ParseUint(string(fields[3][slashPos+1:]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %q: invalid NR_THREADS", kernelResources.loadavgPath, getCurrentLine(buf, 0))
+	}
+	kernelResources.Values[KERNEL_RESOURCES_NR_THREADS] = value
+	return nil
+}
+
+func (kernelResources *KernelResources) Parse() error {
+	for _, valueFile := range kernelResources.valueFiles {
+		if err := kernelResources.parseValueFile(valueFile); err != nil {
+			return err
+		}
+	}
+	return kernelResources.parseLoadavg()
+}
@@ -0,0 +1,101 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type KernelResourcesTestCase struct {
+	name       string
+	procfsRoot string
+	wantValues []uint64
+	wantError  error
+}
+
+var kernelResourcesTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "kernel_resources")
+
+var kernelResourcesValueName = []string{
+	"KERNEL_RESOURCES_FILE_NR_ALLOCATED",
+	"KERNEL_RESOURCES_FILE_NR_FREE",
+	"KERNEL_RESOURCES_FILE_NR_MAX",
+	"KERNEL_RESOURCES_INODE_NR",
+	"KERNEL_RESOURCES_INODE_NR_FREE",
+	"KERNEL_RESOURCES_PID_MAX",
+	"KERNEL_RESOURCES_THREADS_MAX",
+	"KERNEL_RESOURCES_ENTROPY_AVAIL",
+	"KERNEL_RESOURCES_ENTROPY_POOLSIZE",
+	"KERNEL_RESOURCES_NR_THREADS",
+}
+
+func testKernelResourcesParser(tc *KernelResourcesTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+`,
+		tc.name, tc.procfsRoot,
+	)
+
+	kernelResources := NewKernelResources(tc.procfsRoot)
+	err := kernelResources.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+	for index, wantValue := range tc.wantValues {
+		gotValue := kernelResources.Values[index]
+		if wantValue != gotValue {
+			fmt.Fprintf(
+				diffBuf,
+				"\nValues[%s]: want: %d, got: %d",
+				kernelResourcesValueName[index], wantValue, gotValue,
+			)
+		}
+	}
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestKernelResourcesParser(t *testing.T) {
+	for _, tc := range []*KernelResourcesTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: path.Join(kernelResourcesTestDataDir, "field_mapping"),
+			wantValues: []uint64{
+				KERNEL_RESOURCES_FILE_NR_ALLOCATED: 9216,
+				KERNEL_RESOURCES_FILE_NR_FREE:      0,
+				KERNEL_RESOURCES_FILE_NR_MAX:       9223372036854775807,
+				KERNEL_RESOURCES_INODE_NR:          123456,
+				KERNEL_RESOURCES_INODE_NR_FREE:     7890,
+				KERNEL_RESOURCES_PID_MAX:           4194304,
+				KERNEL_RESOURCES_THREADS_MAX:       254623,
+				KERNEL_RESOURCES_ENTROPY_AVAIL:     256,
+				KERNEL_RESOURCES_ENTROPY_POOLSIZE:  256,
+				KERNEL_RESOURCES_NR_THREADS:        1234,
+			},
+		},
+		{
+			name:       "invalid_loadavg",
+			procfsRoot: path.Join(kernelResourcesTestDataDir, "invalid_loadavg"),
+			wantError: fmt.Errorf(
+				"%s: %q: invalid NR_RUNNING/NR_THREADS",
+				path.Join(kernelResourcesTestDataDir, "invalid_loadavg", "loadavg"),
+				"0.15 0.20 0.18 3 56789",
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testKernelResourcesParser(tc, t) },
+		)
+	}
+}
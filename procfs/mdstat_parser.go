@@ -0,0 +1,351 @@
+// parser for /proc/mdstat
+
+package procfs
+
+// Sample file:
+//
+// Personalities : [raid1] [raid6] [raid5] [raid4]
+// md1 : active raid5 sdd1[3](S) sdc1[2] sdb2[1](F) sda2[0]
+//       2093056 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [U_U]
+//       [=>...................]  recovery =  8.5% (89600/1046528) finish=1.5min speed=10240K/sec
+//       bitmap: 0/1 pages [0KB], 65536KB chunk
+//
+// md0 : active (auto-read-only) raid1 sdb1[1] sda1[0]
+//       1046528 blocks super 1.2 [2/2] [UU]
+//         resync=PENDING
+//
+// md2 : inactive sde1[0](S)
+//       1046528 blocks super 1.2
+//
+// unused devices: <none>
+//
+// Each array consists of a status line, followed by indented lines. The member
+// flags are: (F) faulty, (S) spare, (W) write-mostly, (J) journal and
+// (R) replacement. The [total/active] disk counts are missing for inactive
+// arrays and for levels w/o redundancy (raid0, linear), in which case they
+// are inferred from the member list.
+//
+// The file is small and it changes rarely, save for sync operations, so the
+// parsing is performed only if the content changed from the previous pass.
+//
+// References:
+//  https://raid.wiki.kernel.org/index.php/Mdstat
+//  https://github.com/torvalds/linux/blob/v6.8/drivers/md/md.c#L8248
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+const (
+	MDSTAT_MEMBER_STATE_ACTIVE      = "active"
+	MDSTAT_MEMBER_STATE_FAULTY      = "faulty"
+	MDSTAT_MEMBER_STATE_SPARE       = "spare"
+	MDSTAT_MEMBER_STATE_JOURNAL     = "journal"
+	MDSTAT_MEMBER_STATE_REPLACEMENT = "replacement"
+	MDSTAT_MEMBER_STATE_WRITEMOSTLY = "writemostly"
+
+	MDSTAT_SYNC_STATUS_IDLE    = "idle"
+	MDSTAT_SYNC_STATUS_RUNNING = "running"
+	MDSTAT_SYNC_STATUS_PENDING = "pending"
+	MDSTAT_SYNC_STATUS_DELAYED = "delayed"
+)
+
+// Map member flag into state, members w/o flag are active:
+var mdstatMemberFlagToState = map[string]string{
+	"F": MDSTAT_MEMBER_STATE_FAULTY,
+	"S": MDSTAT_MEMBER_STATE_SPARE,
+	"J": MDSTAT_MEMBER_STATE_JOURNAL,
+	"R": MDSTAT_MEMBER_STATE_REPLACEMENT,
+	"W": MDSTAT_MEMBER_STATE_WRITEMOSTLY,
+}
+
+type MdstatMember struct {
+	// Device name, e.g. sda1:
+	Dev string
+	// Role (slot#), the number in []:
+	Role int
+	// One of MDSTAT_MEMBER_STATE_...:
+	State string
+}
+
+type MdstatArray struct {
+	// Device name, e.g. md0:
+	Name string
+	// active or inactive:
+	State string
+	// Read-only mode, e.g. read-only, auto-read-only, empty if read-write:
+	Mode string
+	// RAID level, e.g. raid1, empty if unknown (inactive):
+	Level string
+	// Size, in 1KiB blocks:
+	Blocks uint64
+	// Disk counts:
+	TotalDisks, ActiveDisks, FailedDisks, SpareDisks int
+	// Members, in the order listed:
+	Members []*MdstatMember
+	// Sync operation, e.g. resync, recovery, check, reshape, empty if none:
+	SyncAction string
+	// One of MDSTAT_SYNC_STATUS_...:
+	SyncStatus string
+	// Progress %, speed in KiB/s and estimated time to finish in seconds, valid
+	// only for running sync operations:
+	SyncPct, SyncSpeedKiBps, SyncFinishSec float64
+}
+
+type Mdstat struct {
+	// Arrays, indexed by name:
+	Arrays map[string]*MdstatArray
+
+	// Whether the content changed from the previous pass or not:
+	Changed bool
+
+	// Whether to force an update at every parse or not, regardless of content
+	// change, in support of testing/benchmarking.
+	ForceUpdate bool
+
+	// File content, used to determine changes:
+	content *bytes.Buffer
+
+	// The path file to read:
+	path string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var mdstatReadFileBufPool = ReadFileBufPool16k
+
+func MdstatPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "mdstat")
+}
+
+func NewMdstat(procfsRoot string) *Mdstat {
+	return &Mdstat{
+		Arrays:  make(map[string]*MdstatArray),
+		content: &bytes.Buffer{},
+		path:    MdstatPath(procfsRoot),
+	}
+}
+
+// Parse a `dev[role](flag)...' member:
+func parseMdstatMember(field []byte) (*MdstatMember, error) {
+	openPos := bytes.IndexByte(field, '[')
+	closePos := bytes.IndexByte(field, ']')
+	if openPos <= 0 || closePos < openPos {
+		return nil, fmt.Errorf("%q: invalid member", field)
+	}
+	role, err := strconv.Atoi(string(field[openPos+1 : closePos]))
+	if err != nil {
+		return nil, fmt.Errorf("%q: invalid member role", field)
+	}
+	member := &MdstatMember{
+		Dev:   string(field[:openPos]),
+		Role:  role,
+		State: MDSTAT_MEMBER_STATE_ACTIVE,
+	}
+	// Flags, the 1st one that has a mapping wins, (F) takes precedence:
+	for flags := field[closePos+1:]; len(flags) >= 3 && flags[0] == '(' && flags[2] == ')'; flags = flags[3:] {
+		if state, ok := mdstatMemberFlagToState[string(flags[1])]; ok {
+			if member.State == MDSTAT_MEMBER_STATE_ACTIVE || state == MDSTAT_MEMBER_STATE_FAULTY {
+				member.State = state
+			}
+		}
+	}
+	return member, nil
+}
+
+// Parse the status line, e.g. `md1 : active raid5 sdd1[3](S) sdc1[2]':
+func parseMdstatStatusLine(fields [][]byte) (*MdstatArray, error) {
+	if len(fields) < 3 || !bytes.Equal(fields[1], []byte(":")) {
+		return nil, fmt.Errorf("invalid status line")
+	}
+	array := &MdstatArray{
+		Name:       string(fields[0]),
+		State:      string(fields[2]),
+		Members:    make([]*MdstatMember, 0),
+		SyncStatus: MDSTAT_SYNC_STATUS_IDLE,
+	}
+	for _, field := range fields[3:] {
+		switch {
+		case field[0] == '(' && field[len(field)-1] == ')':
+			array.Mode = string(field[1 : len(field)-1])
+		case bytes.IndexByte(field, '[') > 0:
+			member, err := parseMdstatMember(field)
+			if err != nil {
+				return nil, err
+			}
+			array.Members = append(array.Members, member)
+			switch member.State {
+			case MDSTAT_MEMBER_STATE_FAULTY:
+				array.FailedDisks++
+			case MDSTAT_MEMBER_STATE_SPARE:
+				array.SpareDisks++
+			}
+		case array.Level == "" && len(array.Members) == 0:
+			array.Level = string(field)
+		}
+	}
+	array.TotalDisks, array.ActiveDisks = -1, -1
+	return array, nil
+}
+
+// Parse the blocks line, e.g. `1046528 blocks super 1.2 [2/2] [UU]':
+func parseMdstatBlocksLine(array *MdstatArray, fields [][]byte) error {
+	blocks, err := strconv.ParseUint(string(fields[0]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q: invalid blocks", fields[0])
+	}
+	array.Blocks = blocks
+	for _, field := range fields[1:] {
+		l := len(field)
+		if l < 5 || field[0] != '[' || field[l-1] != ']' {
+			continue
+		}
+		slashPos := bytes.IndexByte(field, '/')
+		if slashPos < 0 {
+			continue
+		}
+		total, err := strconv.Atoi(string(field[1:slashPos]))
+		if err != nil {
+			return fmt.Errorf("%q: invalid total disks", field)
+		}
+		active, err := strconv.Atoi(string(field[slashPos+1 : l-1]))
+		if err != nil {
+			return fmt.Errorf("%q: invalid active disks", field)
+		}
+		array.TotalDisks, array.ActiveDisks = total, active
+		break
+	}
+	return nil
+}
+
+// Parse the sync line, e.g.
+// `[=>....]  recovery =  8.5% (89600/1046528) finish=1.5min speed=10240K/sec'
+// or `resync=PENDING'; return false if it is not a sync line:
+func parseMdstatSyncLine(array *MdstatArray, fields [][]byte) (bool, error) {
+	// `resync=PENDING', `resync=DELAYED':
+	if len(fields) == 1 {
+		if action, status, ok := bytes.Cut(fields[0], []byte("=")); ok && len(action) > 0 {
+			status := string(bytes.ToLower(status))
+			if status == MDSTAT_SYNC_STATUS_PENDING || status == MDSTAT_SYNC_STATUS_DELAYED {
+				array.SyncAction = string(action)
+				array.SyncStatus = status
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	for i, field := range fields {
+		if !bytes.Equal(field, []byte("=")) || i == 0 || i+1 >= len(fields) {
+			continue
+		}
+		// `ACTION = PCT%':
+		array.SyncAction = string(fields[i-1])
+		array.SyncStatus = MDSTAT_SYNC_STATUS_RUNNING
+		pct := bytes.TrimSuffix(fields[i+1], []byte("%"))
+		var err error
+		if array.SyncPct, err = strconv.ParseFloat(string(pct), 64); err != nil {
+			return true, fmt.Errorf("%q: invalid sync progress", fields[i+1])
+		}
+		for _, field := range fields[i+2:] {
+			if val, ok := bytes.CutPrefix(field, []byte("finish=")); ok {
+				// E.g. `1.5min':
+				if val, ok = bytes.CutSuffix(val, []byte("min")); ok {
+					if minutes, err := strconv.ParseFloat(string(val), 64); err == nil {
+						array.SyncFinishSec = minutes * 60
+					}
+				}
+			} else if val, ok := bytes.CutPrefix(field, []byte("speed=")); ok {
+				// E.g. `10240K/sec':
+				if val, ok = bytes.CutSuffix(val, []byte("K/sec")); ok {
+					if speed, err := strconv.ParseFloat(string(val), 64); err == nil {
+						array.SyncSpeedKiBps = speed
+					}
+				}
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (mdstat *Mdstat) update() error {
+	for name := range mdstat.Arrays {
+		delete(mdstat.Arrays, name)
+	}
+
+	var (
+		array *MdstatArray
+		err   error
+	)
+	buf, l := mdstat.content.Bytes(), mdstat.content.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		lineStart := pos
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			// Array separator:
+			array = nil
+			continue
+		}
+		if !isWhitespace[line[0]] {
+			// Status line or header/footer:
+			array = nil
+			if bytes.Equal(fields[0], []byte("Personalities")) || bytes.Equal(fields[0], []byte("unused")) {
+				continue
+			}
+			if array, err = parseMdstatStatusLine(fields); err != nil {
+				return fmt.Errorf("%s:%d: %q: %v", mdstat.path, lineNum, getCurrentLine(buf, lineStart), err)
+			}
+			mdstat.Arrays[array.Name] = array
+			continue
+		}
+		if array == nil {
+			continue
+		}
+		if array.Blocks == 0 && len(fields) >= 2 && bytes.Equal(fields[1], []byte("blocks")) {
+			err = parseMdstatBlocksLine(array, fields)
+		} else if array.SyncStatus == MDSTAT_SYNC_STATUS_IDLE {
+			_, err = parseMdstatSyncLine(array, fields)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %q: %v", mdstat.path, lineNum, getCurrentLine(buf, lineStart), err)
+		}
+	}
+
+	// Infer the missing disk counts:
+	for _, array := range mdstat.Arrays {
+		if array.TotalDisks < 0 {
+			array.TotalDisks = len(array.Members)
+			if array.State == "active" {
+				array.ActiveDisks = array.TotalDisks - array.FailedDisks - array.SpareDisks
+			} else {
+				array.ActiveDisks = 0
+			}
+		}
+	}
+
+	return nil
+}
+
+func (mdstat *Mdstat) Parse() error {
+	fBuf, err := mdstatReadFileBufPool.ReadFile(mdstat.path)
+	if err == nil {
+		mdstat.Changed = mdstat.ForceUpdate || !bytes.Equal(mdstat.content.Bytes(), fBuf.Bytes())
+		if mdstat.Changed {
+			fBuf, mdstat.content = mdstat.content, fBuf
+			err = mdstat.update()
+		}
+	}
+	mdstatReadFileBufPool.ReturnBuf(fBuf)
+	return err
+}
@@ -0,0 +1,199 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type MdstatTestCase struct {
+	name       string
+	procfsRoot string
+	wantArrays map[string]*MdstatArray
+	wantError  error
+}
+
+var mdstatTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "mdstat")
+
+func testMdstatParser(tc *MdstatTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+`,
+		tc.name, tc.procfsRoot,
+	)
+
+	mdstat := NewMdstat(tc.procfsRoot)
+	err := mdstat.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	for name, wantArray := range tc.wantArrays {
+		gotArray := mdstat.Arrays[name]
+		if gotArray == nil {
+			fmt.Fprintf(diffBuf, "\n%s: missing array", name)
+			continue
+		}
+		for _, field := range []struct {
+			name      string
+			want, got any
+		}{
+			{"Name", wantArray.Name, gotArray.Name},
+			{"State", wantArray.State, gotArray.State},
+			{"Mode", wantArray.Mode, gotArray.Mode},
+			{"Level", wantArray.Level, gotArray.Level},
+			{"Blocks", wantArray.Blocks, gotArray.Blocks},
+			{"TotalDisks", wantArray.TotalDisks, gotArray.TotalDisks},
+			{"ActiveDisks", wantArray.ActiveDisks, gotArray.ActiveDisks},
+			{"FailedDisks", wantArray.FailedDisks, gotArray.FailedDisks},
+			{"SpareDisks", wantArray.SpareDisks, gotArray.SpareDisks},
+			{"SyncAction", wantArray.SyncAction, gotArray.SyncAction},
+			{"SyncStatus", wantArray.SyncStatus, gotArray.SyncStatus},
+			{"SyncPct", wantArray.SyncPct, gotArray.SyncPct},
+			{"SyncSpeedKiBps", wantArray.SyncSpeedKiBps, gotArray.SyncSpeedKiBps},
+			{"SyncFinishSec", wantArray.SyncFinishSec, gotArray.SyncFinishSec},
+		} {
+			if field.want != field.got {
+				fmt.Fprintf(diffBuf, "\n%s: %s: want: %v, got: %v", name, field.name, field.want, field.got)
+			}
+		}
+		if len(wantArray.Members) != len(gotArray.Members) {
+			fmt.Fprintf(
+				diffBuf,
+				"\n%s: len(Members): want: %d, got: %d",
+				name, len(wantArray.Members), len(gotArray.Members),
+			)
+			continue
+		}
+		for i, wantMember := range wantArray.Members {
+			if gotMember := gotArray.Members[i]; *wantMember != *gotMember {
+				fmt.Fprintf(diffBuf, "\n%s: Members[%d]: want: %+v, got: %+v", name, i, *wantMember, *gotMember)
+			}
+		}
+	}
+	for name := range mdstat.Arrays {
+		if tc.wantArrays[name] == nil {
+			fmt.Fprintf(diffBuf, "\n%s: unexpected array", name)
+		}
+	}
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+
+	// 2nd time around there should be no change.
+	err = mdstat.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mdstat.Changed {
+		t.Fatalf("Changed: %v", mdstat.Changed)
+	}
+}
+
+func TestMdstatParser(t *testing.T) {
+	for _, tc := range []*MdstatTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: path.Join(mdstatTestDataDir, "field_mapping"),
+			wantArrays: map[string]*MdstatArray{
+				"md1": {
+					Name:        "md1",
+					State:       "active",
+					Level:       "raid5",
+					Blocks:      2093056,
+					TotalDisks:  3,
+					ActiveDisks: 2,
+					FailedDisks: 1,
+					SpareDisks:  1,
+					Members: []*MdstatMember{
+						{"sdd1", 3, MDSTAT_MEMBER_STATE_SPARE},
+						{"sdc1", 2, MDSTAT_MEMBER_STATE_ACTIVE},
+						{"sdb2", 1, MDSTAT_MEMBER_STATE_FAULTY},
+						{"sda2", 0, MDSTAT_MEMBER_STATE_ACTIVE},
+					},
+					SyncAction:     "recovery",
+					SyncStatus:     MDSTAT_SYNC_STATUS_RUNNING,
+					SyncPct:        8.5,
+					SyncSpeedKiBps: 10240,
+					SyncFinishSec:  90,
+				},
+				"md0": {
+					Name:        "md0",
+					State:       "active",
+					Mode:        "auto-read-only",
+					Level:       "raid1",
+					Blocks:      1046528,
+					TotalDisks:  2,
+					ActiveDisks: 2,
+					Members: []*MdstatMember{
+						{"sdb1", 1, MDSTAT_MEMBER_STATE_ACTIVE},
+						{"sda1", 0, MDSTAT_MEMBER_STATE_ACTIVE},
+					},
+					SyncAction: "resync",
+					SyncStatus: MDSTAT_SYNC_STATUS_PENDING,
+				},
+				"md3": {
+					Name:        "md3",
+					State:       "active",
+					Level:       "raid0",
+					Blocks:      2093056,
+					TotalDisks:  2,
+					ActiveDisks: 2,
+					Members: []*MdstatMember{
+						{"sdf1", 1, MDSTAT_MEMBER_STATE_ACTIVE},
+						{"sde1", 0, MDSTAT_MEMBER_STATE_ACTIVE},
+					},
+					SyncStatus: MDSTAT_SYNC_STATUS_IDLE,
+				},
+				"md2": {
+					Name:       "md2",
+					State:      "inactive",
+					Blocks:     1046528,
+					TotalDisks: 1,
+					SpareDisks: 1,
+					Members: []*MdstatMember{
+						{"sdg1", 0, MDSTAT_MEMBER_STATE_SPARE},
+					},
+					SyncStatus: MDSTAT_SYNC_STATUS_IDLE,
+				},
+				"md4": {
+					Name:        "md4",
+					State:       "active",
+					Level:       "raid1",
+					Blocks:      1046528,
+					TotalDisks:  2,
+					ActiveDisks: 2,
+					Members: []*MdstatMember{
+						{"sdi1", 1, MDSTAT_MEMBER_STATE_ACTIVE},
+						{"sdh1", 0, MDSTAT_MEMBER_STATE_ACTIVE},
+					},
+					SyncAction:     "check",
+					SyncStatus:     MDSTAT_SYNC_STATUS_RUNNING,
+					SyncPct:        52.3,
+					SyncSpeedKiBps: 20480,
+					SyncFinishSec:  24,
+				},
+			},
+		},
+		{
+			name:       "no_arrays",
+			procfsRoot: path.Join(mdstatTestDataDir, "no_arrays"),
+			wantArrays: map[string]*MdstatArray{},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testMdstatParser(tc, t) },
+		)
+	}
+}
@@ -0,0 +1,240 @@
+// parser for /proc/pid/mountstats, NFS mounts only
+
+package procfs
+
+// Sample file (abridged):
+//
+// device rootfs mounted on / with fstype rootfs
+// device server:/export mounted on /mnt/nfs with fstype nfs4 statvers=1.1
+// 	opts:	rw,vers=4.2,rsize=1048576,wsize=1048576,...
+// 	age:	3600
+// 	events:	36 1253 0 0 6 14 1320 0 0 2 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0
+// 	bytes:	0 0 0 0 1048576 0 256 0
+// 	RPC iostats version: 1.1  p/v: 100003/4 (nfs)
+// 	xprt:	tcp 0 1 1 0 12 345 345 0 345 0 2 0 0
+// 	per-op statistics
+// 	        NULL: 1 1 0 44 24 0 0 0 0
+// 	        READ: 256 256 0 37888 1049600 12 1024 1060 0
+// 	       WRITE: 0 0 0 0 0 0 0 0 0
+// ...
+//
+// device proc mounted on /proc with fstype proc
+//
+// The per-op statistics are:
+//  ops transmissions major_timeouts bytes_sent bytes_recv queue_ms rtt_ms
+//  execute_ms [errors]
+// where the timings are cumulative, in milliseconds. The errors column was
+// added in statvers 1.1 (kernel v5.x) and it is left 0 for older versions.
+//
+// Only the NFS mounts are parsed, the rest are ignored.
+//
+// References:
+//  https://github.com/torvalds/linux/blob/v6.8/fs/nfs/super.c#L734
+//  https://github.com/torvalds/linux/blob/v6.8/net/sunrpc/stats.c#L192
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+const (
+	// Indexes for the per-op stats:
+	MOUNTSTATS_OP_OPS = iota
+	MOUNTSTATS_OP_TRANSMISSIONS
+	MOUNTSTATS_OP_MAJOR_TIMEOUTS
+	MOUNTSTATS_OP_BYTES_SENT
+	MOUNTSTATS_OP_BYTES_RECV
+	MOUNTSTATS_OP_QUEUE_MS
+	MOUNTSTATS_OP_RTT_MS
+	MOUNTSTATS_OP_EXECUTE_MS
+	MOUNTSTATS_OP_ERRORS
+
+	// Must be last:
+	MOUNTSTATS_OP_NUM_STATS
+)
+
+// The minimum number of per-op stats, i.e. w/o errors:
+const MOUNTSTATS_OP_MIN_NUM_STATS = MOUNTSTATS_OP_EXECUTE_MS + 1
+
+// The fs types of interest:
+var mountstatsNfsFsTypes = map[string]bool{
+	"nfs":  true,
+	"nfs4": true,
+}
+
+type MountstatsMount struct {
+	// Device (export), e.g. server:/export, mount point and fs type:
+	Device, MountPoint, FsType string
+	// The op names, in the order in which they appear in the file:
+	OpNames []string
+	// Per op stats, indexed by op name and by MOUNTSTATS_OP_...:
+	OpStats map[string][]uint64
+}
+
+type Mountstats struct {
+	// NFS mounts, indexed by mount point:
+	Mounts map[string]*MountstatsMount
+
+	// The path file to read:
+	path string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool; the file holds per
+// mount and per op stats, so its size is unbound:
+var mountstatsReadFileBufPool = ReadFileBufPoolReadUnbound
+
+func MountstatsPath(procfsRoot string, pid int) string {
+	pidPart := "self"
+	if pid > 0 {
+		pidPart = strconv.Itoa(pid)
+	}
+	return path.Join(procfsRoot, pidPart, "mountstats")
+}
+
+func NewMountstats(procfsRoot string, pid int) *Mountstats {
+	return &Mountstats{
+		Mounts: make(map[string]*MountstatsMount),
+		path:   MountstatsPath(procfsRoot, pid),
+	}
+}
+
+func (mountstats *Mountstats) Clone(full bool) *Mountstats {
+	newMountstats := &Mountstats{
+		Mounts: make(map[string]*MountstatsMount),
+		path:   mountstats.path,
+	}
+	if full {
+		for mountPoint, mount := range mountstats.Mounts {
+			newMount := &MountstatsMount{
+				Device:     mount.Device,
+				MountPoint: mount.MountPoint,
+				FsType:     mount.FsType,
+				OpNames:    append([]string(nil), mount.OpNames...),
+				OpStats:    make(map[string][]uint64, len(mount.OpStats)),
+			}
+			for op, stats := range mount.OpStats {
+				newMount.OpStats[op] = append([]uint64(nil), stats...)
+			}
+			newMountstats.Mounts[mountPoint] = newMount
+		}
+	}
+	return newMountstats
+}
+
+func (mountstats *Mountstats) Parse() error {
+	fBuf, err := mountstatsReadFileBufPool.ReadFile(mountstats.path)
+	defer mountstatsReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	var (
+		// The current NFS mount, nil if the current device is not of interest:
+		mount *MountstatsMount
+		// Whether inside the per-op statistics section:
+		inOps bool
+	)
+	foundMounts := make(map[string]bool)
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		lineStart := pos
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		fields := bytes.Fields(buf[pos:eolPos])
+		pos = eolPos + 1
+		if len(fields) == 0 {
+			inOps = false
+			continue
+		}
+
+		// device DEV mounted on MOUNT_POINT with fstype FS_TYPE [statvers=X]:
+		if bytes.Equal(fields[0], []byte("device")) {
+			mount, inOps = nil, false
+			if len(fields) < 8 {
+				return fmt.Errorf(
+					"%s:%d: %q: invalid device line",
+					mountstats.path, lineNum, getCurrentLine(buf, lineStart),
+				)
+			}
+			fsType := string(fields[7])
+			if !mountstatsNfsFsTypes[fsType] {
+				continue
+			}
+			mountPoint := string(fields[4])
+			if foundMounts[mountPoint] {
+				// Overmounted, keep the 1st one:
+				continue
+			}
+			foundMounts[mountPoint] = true
+			mount = mountstats.Mounts[mountPoint]
+			if mount == nil {
+				mount = &MountstatsMount{
+					MountPoint: mountPoint,
+					OpStats:    make(map[string][]uint64),
+				}
+				mountstats.Mounts[mountPoint] = mount
+			}
+			mount.Device, mount.FsType = string(fields[1]), fsType
+			mount.OpNames = mount.OpNames[:0]
+			continue
+		}
+		if mount == nil {
+			continue
+		}
+
+		if !inOps {
+			inOps = len(fields) == 2 &&
+				bytes.Equal(fields[0], []byte("per-op")) &&
+				bytes.Equal(fields[1], []byte("statistics"))
+			continue
+		}
+
+		// OP: ops transmissions ...:
+		opField := fields[0]
+		if len(opField) < 2 || opField[len(opField)-1] != ':' {
+			inOps = false
+			continue
+		}
+		if len(fields)-1 < MOUNTSTATS_OP_MIN_NUM_STATS {
+			return fmt.Errorf(
+				"%s:%d: %q: invalid per-op stats: want at least %d values, got %d",
+				mountstats.path, lineNum, getCurrentLine(buf, lineStart),
+				MOUNTSTATS_OP_MIN_NUM_STATS, len(fields)-1,
+			)
+		}
+		op := string(opField[:len(opField)-1])
+		stats := mount.OpStats[op]
+		if stats == nil {
+			stats = make([]uint64, MOUNTSTATS_OP_NUM_STATS)
+			mount.OpStats[op] = stats
+		}
+		for i := 0; i < MOUNTSTATS_OP_NUM_STATS; i++ {
+			stats[i] = 0
+			if i+1 >= len(fields) {
+				continue
+			}
+			if stats[i], err = strconv.ParseUint(string(fields[i+1]), 10, 64); err != nil {
+				return fmt.Errorf(
+					"%s:%d: %q: %q: invalid value",
+					mountstats.path, lineNum, getCurrentLine(buf, lineStart), fields[i+1],
+				)
+			}
+		}
+		mount.OpNames = append(mount.OpNames, op)
+	}
+
+	// Remove the mounts that are no longer present:
+	for mountPoint := range mountstats.Mounts {
+		if !foundMounts[mountPoint] {
+			delete(mountstats.Mounts, mountPoint)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type MountstatsTestCase struct {
+	name       string
+	procfsRoot string
+	pid        int
+	wantMounts map[string]*MountstatsMount
+	wantError  error
+}
+
+var mountstatsTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "mountstats")
+
+var mountstatsFieldMappingWant = map[string]*MountstatsMount{
+	"/mnt/nfs": {
+		Device:     "server:/export",
+		MountPoint: "/mnt/nfs",
+		FsType:     "nfs4",
+		OpNames:    []string{"NULL", "READ", "WRITE"},
+		OpStats: map[string][]uint64{
+			"NULL":  {1, 1, 0, 44, 24, 0, 0, 0, 0},
+			"READ":  {256, 258, 1, 37888, 1049600, 12, 1024, 1060, 2},
+			"WRITE": {0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+	},
+	"/mnt/old": {
+		Device:     "old:/export",
+		MountPoint: "/mnt/old",
+		FsType:     "nfs",
+		OpNames:    []string{"NULL", "GETATTR"},
+		OpStats: map[string][]uint64{
+			"NULL":    {0, 0, 0, 0, 0, 0, 0, 0, 0},
+			"GETATTR": {10, 11, 0, 1280, 1120, 1, 20, 25, 0},
+		},
+	},
+}
+
+func testMountstatsParser(tc *MountstatsTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+pid=%d
+`,
+		tc.name, tc.procfsRoot, tc.pid,
+	)
+
+	mountstats := NewMountstats(tc.procfsRoot, tc.pid)
+	err := mountstats.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	for mountPoint, wantMount := range tc.wantMounts {
+		gotMount := mountstats.Mounts[mountPoint]
+		if gotMount == nil {
+			fmt.Fprintf(diffBuf, "\n%s: missing mount", mountPoint)
+			continue
+		}
+		for _, field := range []struct {
+			name      string
+			want, got string
+		}{
+			{"Device", wantMount.Device, gotMount.Device},
+			{"MountPoint", wantMount.MountPoint, gotMount.MountPoint},
+			{"FsType", wantMount.FsType, gotMount.FsType},
+		} {
+			if field.want != field.got {
+				fmt.Fprintf(diffBuf, "\n%s: %s: want: %q, got: %q", mountPoint, field.name, field.want, field.got)
+			}
+		}
+		testutils.CompareSlices(wantMount.OpNames, gotMount.OpNames, mountPoint+": OpNames", diffBuf)
+		for op, wantStats := range wantMount.OpStats {
+			testutils.CompareSlices(wantStats, gotMount.OpStats[op], fmt.Sprintf("%s: OpStats[%q]", mountPoint, op), diffBuf)
+		}
+	}
+	for mountPoint := range mountstats.Mounts {
+		if tc.wantMounts[mountPoint] == nil {
+			fmt.Fprintf(diffBuf, "\n%s: unexpected mount", mountPoint)
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestMountstatsParser(t *testing.T) {
+	for _, tc := range []*MountstatsTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: path.Join(mountstatsTestDataDir, "field_mapping"),
+			wantMounts: mountstatsFieldMappingWant,
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testMountstatsParser(tc, t) },
+		)
+	}
+}
+
+func TestMountstatsParserLarge(t *testing.T) {
+	// Emulate a host with many mounts by repeating the non NFS device lines,
+	// such that the file exceeds the largest bounded read buffer:
+	content, err := os.ReadFile(path.Join(mountstatsTestDataDir, "field_mapping", "self", "mountstats"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceLine := []byte("device proc mounted on /proc with fstype proc\n")
+	deviceLines := bytes.Repeat(deviceLine, 0x100000/len(deviceLine)+1)
+	procfsRoot := t.TempDir()
+	if err = os.MkdirAll(path.Join(procfsRoot, "self"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(
+		path.Join(procfsRoot, "self", "mountstats"),
+		bytes.Replace(content, deviceLine, deviceLines, 1),
+		0644,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testMountstatsParser(
+		&MountstatsTestCase{
+			name:       "large",
+			procfsRoot: procfsRoot,
+			wantMounts: mountstatsFieldMappingWant,
+		},
+		t,
+	)
+}
@@ -0,0 +1,252 @@
+// parser for /proc/net/bonding/BOND
+
+package procfs
+
+// Sample file (802.3ad), excerpt:
+//
+//  Ethernet Channel Bonding Driver: v6.8.0
+//
+//  Bonding Mode: IEEE 802.3ad Dynamic link aggregation
+//  MII Status: up
+//  ...
+//  Active Aggregator Info:
+//  	Aggregator ID: 1
+//  	...
+//  	Partner Mac Address: 00:1c:73:aa:bb:cc
+//
+//  Slave Interface: eth0
+//  MII Status: up
+//  Link Failure Count: 1
+//  ...
+//  Aggregator ID: 1
+//  ...
+//  details partner lacp pdu:
+//      system priority: 32768
+//      system mac address: 00:1c:73:aa:bb:cc
+//      ...
+//
+// For active-backup, tlb and alb modes the bond section has a
+// `Currently Active Slave: DEV' line and there is no LACP info.
+//
+// Each bond has its own file, named after the bond. The files are small, so
+// they are parsed into new objects at every pass.
+//
+// References:
+//  https://docs.kernel.org/networking/bonding.html
+//  https://github.com/torvalds/linux/blob/v6.8/drivers/net/bonding/bond_procfs.c
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+)
+
+// The sub-sections of interest, introduced by a `NAME:' line and consisting of
+// indented lines:
+const (
+	netBondingSubsectionNone = iota
+	netBondingSubsectionActiveAggregator
+	netBondingSubsectionPartnerLacpPdu
+	netBondingSubsectionOther
+)
+
+var netBondingSubsectionHeaders = map[string]int{
+	"Active Aggregator Info:":   netBondingSubsectionActiveAggregator,
+	"details actor lacp pdu:":   netBondingSubsectionOther,
+	"details partner lacp pdu:": netBondingSubsectionPartnerLacpPdu,
+}
+
+var netBondingKeyValueSep = []byte(": ")
+
+type NetBondingSlave struct {
+	// Device name, e.g. eth0:
+	Dev string
+	// MII status, e.g. up, down:
+	MiiStatus string
+	// Link failure count:
+	LinkFailureCount uint64
+	// 802.3ad mode only, empty otherwise: the aggregator ID and the partner
+	// system MAC address, as per the partner LACP PDU:
+	AggregatorId, PartnerMac string
+}
+
+type NetBond struct {
+	// Bond name, e.g. bond0:
+	Name string
+	// Bonding mode, e.g. `IEEE 802.3ad Dynamic link aggregation':
+	Mode string
+	// MII status, e.g. up, down:
+	MiiStatus string
+	// The currently active slave, for active-backup, tlb and alb modes only,
+	// empty otherwise:
+	ActiveSlave string
+	// 802.3ad mode only, empty otherwise: the active aggregator ID and partner
+	// MAC address:
+	AggregatorId, PartnerMac string
+	// Slaves, in the order listed:
+	Slaves []*NetBondingSlave
+}
+
+type NetBonding struct {
+	// Bonds, indexed by name:
+	Bonds map[string]*NetBond
+	// The path to the directory holding the bond files:
+	dir string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var netBondingReadFileBufPool = ReadFileBufPool16k
+
+func NetBondingDirPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "net", "bonding")
+}
+
+func NewNetBonding(procfsRoot string) *NetBonding {
+	return &NetBonding{
+		Bonds: make(map[string]*NetBond),
+		dir:   NetBondingDirPath(procfsRoot),
+	}
+}
+
+func parseNetBond(name, bondPath string) (*NetBond, error) {
+	fBuf, err := netBondingReadFileBufPool.ReadFile(bondPath)
+	defer netBondingReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	bond := &NetBond{
+		Name:   name,
+		Slaves: make([]*NetBondingSlave, 0),
+	}
+	var slave *NetBondingSlave
+	subsection := netBondingSubsectionNone
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		if len(line) == 0 {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		line = bytes.TrimSpace(line)
+		if !indented {
+			subsection = netBondingSubsectionNone
+			if s, ok := netBondingSubsectionHeaders[string(line)]; ok {
+				subsection = s
+				continue
+			}
+		}
+
+		sepPos := bytes.Index(line, netBondingKeyValueSep)
+		if sepPos < 0 {
+			continue
+		}
+		key, value := string(line[:sepPos]), string(bytes.TrimSpace(line[sepPos+len(netBondingKeyValueSep):]))
+
+		switch subsection {
+		case netBondingSubsectionActiveAggregator:
+			switch key {
+			case "Aggregator ID":
+				bond.AggregatorId = value
+			case "Partner Mac Address":
+				bond.PartnerMac = value
+			}
+			continue
+		case netBondingSubsectionPartnerLacpPdu:
+			if key == "system mac address" && slave != nil {
+				slave.PartnerMac = value
+			}
+			continue
+		case netBondingSubsectionOther:
+			continue
+		}
+
+		if key == "Slave Interface" {
+			slave = &NetBondingSlave{Dev: value}
+			bond.Slaves = append(bond.Slaves, slave)
+			continue
+		}
+
+		if slave == nil {
+			switch key {
+			case "Bonding Mode":
+				bond.Mode = value
+			case "MII Status":
+				bond.MiiStatus = value
+			case "Currently Active Slave":
+				if value != "None" {
+					bond.ActiveSlave = value
+				}
+			}
+			continue
+		}
+
+		switch key {
+		case "MII Status":
+			slave.MiiStatus = value
+		case "Link Failure Count":
+			slave.LinkFailureCount, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %q: invalid value", bondPath, lineNum, line)
+			}
+		case "Aggregator ID":
+			slave.AggregatorId = value
+		}
+	}
+
+	return bond, nil
+}
+
+func (netBonding *NetBonding) Parse() error {
+	entries, err := os.ReadDir(netBonding.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// The bonding module was unloaded:
+			clear(netBonding.Bonds)
+			return nil
+		}
+		return err
+	}
+
+	// Bonds may be created or deleted dynamically; keep track of the ones found
+	// at this pass, to remove the out-of-scope ones at the end:
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		bond, err := parseNetBond(name, path.Join(netBonding.dir, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// Deleted in the meantime:
+				continue
+			}
+			return err
+		}
+		netBonding.Bonds[name] = bond
+		found[name] = true
+	}
+	if len(netBonding.Bonds) > len(found) {
+		for name := range netBonding.Bonds {
+			if !found[name] {
+				delete(netBonding.Bonds, name)
+			}
+		}
+	}
+
+	return nil
+}
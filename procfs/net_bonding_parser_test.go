@@ -0,0 +1,164 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type NetBondingTestCase struct {
+	name       string
+	procfsRoot string
+	primeBonds map[string]*NetBond
+	wantBonds  map[string]*NetBond
+	wantError  error
+}
+
+var netBondingTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "net_bonding")
+
+func testNetBondingParser(tc *NetBondingTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+primeBonds=%v
+`,
+		tc.name, tc.procfsRoot, (tc.primeBonds != nil),
+	)
+
+	netBonding := NewNetBonding(tc.procfsRoot)
+	for name, bond := range tc.primeBonds {
+		netBonding.Bonds[name] = bond
+	}
+	err := netBonding.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	if len(tc.wantBonds) != len(netBonding.Bonds) {
+		fmt.Fprintf(diffBuf, "\nlen(Bonds): want: %d, got: %d", len(tc.wantBonds), len(netBonding.Bonds))
+	}
+	for name, wantBond := range tc.wantBonds {
+		gotBond := netBonding.Bonds[name]
+		if gotBond == nil {
+			fmt.Fprintf(diffBuf, "\n%s: missing bond", name)
+			continue
+		}
+		for _, field := range []struct {
+			name      string
+			want, got any
+		}{
+			{"Name", wantBond.Name, gotBond.Name},
+			{"Mode", wantBond.Mode, gotBond.Mode},
+			{"MiiStatus", wantBond.MiiStatus, gotBond.MiiStatus},
+			{"ActiveSlave", wantBond.ActiveSlave, gotBond.ActiveSlave},
+			{"AggregatorId", wantBond.AggregatorId, gotBond.AggregatorId},
+			{"PartnerMac", wantBond.PartnerMac, gotBond.PartnerMac},
+		} {
+			if field.want != field.got {
+				fmt.Fprintf(diffBuf, "\n%s: %s: want: %q, got: %q", name, field.name, field.want, field.got)
+			}
+		}
+		if len(wantBond.Slaves) != len(gotBond.Slaves) {
+			fmt.Fprintf(
+				diffBuf,
+				"\n%s: len(Slaves): want: %d, got: %d",
+				name, len(wantBond.Slaves), len(gotBond.Slaves),
+			)
+			continue
+		}
+		for i, wantSlave := range wantBond.Slaves {
+			if gotSlave := gotBond.Slaves[i]; *wantSlave != *gotSlave {
+				fmt.Fprintf(diffBuf, "\n%s: Slaves[%d]: want: %+v, got: %+v", name, i, *wantSlave, *gotSlave)
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestNetBondingParser(t *testing.T) {
+	wantBonds := map[string]*NetBond{
+		"bond0": {
+			Name:         "bond0",
+			Mode:         "IEEE 802.3ad Dynamic link aggregation",
+			MiiStatus:    "up",
+			AggregatorId: "1",
+			PartnerMac:   "00:1c:73:aa:bb:cc",
+			Slaves: []*NetBondingSlave{
+				{
+					Dev:              "eth0",
+					MiiStatus:        "up",
+					LinkFailureCount: 1,
+					AggregatorId:     "1",
+					PartnerMac:       "00:1c:73:aa:bb:cc",
+				},
+				{
+					Dev:              "eth1",
+					MiiStatus:        "down",
+					LinkFailureCount: 3,
+					AggregatorId:     "2",
+					PartnerMac:       "00:00:00:00:00:00",
+				},
+			},
+		},
+		"bond1": {
+			Name:        "bond1",
+			Mode:        "fault-tolerance (active-backup)",
+			MiiStatus:   "up",
+			ActiveSlave: "eth3",
+			Slaves: []*NetBondingSlave{
+				{Dev: "eth2", MiiStatus: "down", LinkFailureCount: 5},
+				{Dev: "eth3", MiiStatus: "up", LinkFailureCount: 0},
+			},
+		},
+	}
+
+	for _, tc := range []*NetBondingTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: path.Join(netBondingTestDataDir, "field_mapping"),
+			wantBonds:  wantBonds,
+		},
+		{
+			name:       "out_of_scope",
+			procfsRoot: path.Join(netBondingTestDataDir, "field_mapping"),
+			primeBonds: map[string]*NetBond{
+				"bond2": {Name: "bond2"},
+			},
+			wantBonds: wantBonds,
+		},
+		{
+			name:       "no_bonding",
+			procfsRoot: path.Join(netBondingTestDataDir, "no_such_root"),
+			primeBonds: map[string]*NetBond{
+				"bond0": {Name: "bond0"},
+			},
+			wantBonds: map[string]*NetBond{},
+		},
+		{
+			name:       "invalid",
+			procfsRoot: path.Join(netBondingTestDataDir, "invalid"),
+			wantError: fmt.Errorf(
+				"%s:16: %q: invalid value",
+				path.Join(netBondingTestDataDir, "invalid", "net", "bonding", "bond1"),
+				"Link Failure Count: x",
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testNetBondingParser(tc, t) },
+		)
+	}
+}
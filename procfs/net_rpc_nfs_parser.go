@@ -0,0 +1,271 @@
+// parser for /proc/net/rpc/nfs (client) and /proc/net/rpc/nfsd (server)
+
+package procfs
+
+// Sample files:
+//
+// /proc/net/rpc/nfs:
+//
+// net 0 0 0 0
+// rpc 1235 2 0
+// proc3 22 0 563 0 44 102 0 221 7 0 0 0 0 0 0 0 0 1 3 2 1 0 0
+// proc4 69 0 12 5 0 3 0 ...
+//
+// /proc/net/rpc/nfsd:
+//
+// rc 0 154 1109
+// fh 0 0 0 0 0
+// io 1228800 2457600
+// th 8 0 0.000 0.000 0.000 0.000 0.000 0.000 0.000 0.000 0.000 0.000
+// ra 32 0 0 0 0 0 0 0 0 0 0 0
+// net 1263 0 1263 8
+// rpc 1263 0 0 0 0
+// proc3 22 2 36 0 15 42 0 80 100 5 1 0 0 2 0 1 0 0 9 4 2 0 11
+// proc4 2 1 262
+// proc4ops 72 0 0 0 12 4 2 0 ...
+//
+// The lines of interest are:
+//  - rpc: client: calls retrans authrefresh, server: calls badcalls badfmt
+//    badauth badclnt
+//  - procN, proc4ops: the number of values, followed by the call count for
+//    each procedure, indexed by the procedure number.
+//
+// The procedure numbering is defined by the protocol, save for the NFSv4
+// client, where the order is that of the kernel internal enum and may vary
+// with the kernel version.
+//
+// References:
+//  https://github.com/torvalds/linux/blob/v6.8/net/sunrpc/stats.c#L82
+//  https://github.com/torvalds/linux/blob/v6.8/fs/nfsd/stats.c#L37
+//  https://github.com/torvalds/linux/blob/v6.8/include/linux/nfs4.h#L512
+//  https://github.com/torvalds/linux/blob/v6.8/include/linux/nfs4.h#L110
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+const (
+	// Indexes for the client rpc line:
+	NET_RPC_NFS_RPC_CALLS       = 0
+	NET_RPC_NFS_RPC_RETRANS     = 1
+	NET_RPC_NFS_RPC_AUTHREFRESH = 2
+
+	// Indexes for the server rpc line:
+	NET_RPC_NFSD_RPC_CALLS    = 0
+	NET_RPC_NFSD_RPC_BADCALLS = 1
+	NET_RPC_NFSD_RPC_BADFMT   = 2
+	NET_RPC_NFSD_RPC_BADAUTH  = 3
+	NET_RPC_NFSD_RPC_BADCLNT  = 4
+
+	NET_RPC_NFS_RPC_LINE_TAG      = "rpc"
+	NET_RPC_NFS_PROC_LINE_TAG_PFX = "proc"
+)
+
+var netRpcNfsProc2Names = []string{
+	"null", "getattr", "setattr", "root", "lookup", "readlink", "read", "wrcache",
+	"write", "create", "remove", "rename", "link", "symlink", "mkdir", "rmdir",
+	"readdir", "statfs",
+}
+
+var netRpcNfsProc3Names = []string{
+	"null", "getattr", "setattr", "lookup", "access", "readlink", "read", "write",
+	"create", "mkdir", "symlink", "mknod", "remove", "rmdir", "rename", "link",
+	"readdir", "readdirplus", "fsstat", "fsinfo", "pathconf", "commit",
+}
+
+// NFSv4 client, as per enum NFSPROC4_CLNT_...:
+var netRpcNfsClientProc4Names = []string{
+	"null", "read", "write", "commit", "open", "open_confirm", "open_noattr",
+	"open_downgrade", "close", "setattr", "fsinfo", "renew", "setclientid",
+	"setclientid_confirm", "lock", "lockt", "locku", "access", "getattr",
+	"lookup", "lookup_root", "remove", "rename", "link", "symlink", "create",
+	"pathconf", "statfs", "readlink", "readdir", "server_caps", "delegreturn",
+	"getacl", "setacl", "fs_locations", "release_lockowner", "secinfo",
+	"fsid_present", "exchange_id", "create_session", "destroy_session",
+	"sequence", "get_lease_time", "reclaim_complete", "layoutget",
+	"getdeviceinfo", "layoutcommit", "layoutreturn", "secinfo_no_name",
+	"test_stateid", "free_stateid", "getdevicelist", "bind_conn_to_session",
+	"destroy_clientid", "seek", "allocate", "deallocate", "layoutstats", "clone",
+	"copy", "offload_cancel", "lookupp", "layouterror", "copy_notify",
+	"getxattr", "setxattr", "listxattrs", "removexattr", "read_plus",
+}
+
+// NFSv4 server:
+var netRpcNfsdProc4Names = []string{
+	"null", "compound",
+}
+
+// NFSv4 server operations, as per enum nfs_opnum4; 0..2 are not used:
+var netRpcNfsdProc4OpsNames = []string{
+	"", "", "", "access", "close", "commit", "create", "delegpurge",
+	"delegreturn", "getattr", "getfh", "link", "lock", "lockt", "locku",
+	"lookup", "lookupp", "nverify", "open", "openattr", "open_confirm",
+	"open_downgrade", "putfh", "putpubfh", "putrootfh", "read", "readdir",
+	"readlink", "remove", "rename", "renew", "restorefh", "savefh", "secinfo",
+	"setattr", "setclientid", "setclientid_confirm", "verify", "write",
+	"release_lockowner", "backchannel_ctl", "bind_conn_to_session",
+	"exchange_id", "create_session", "destroy_session", "free_stateid",
+	"get_dir_delegation", "getdeviceinfo", "getdevicelist", "layoutcommit",
+	"layoutget", "layoutreturn", "secinfo_no_name", "sequence", "set_ssv",
+	"test_stateid", "want_delegation", "destroy_clientid", "reclaim_complete",
+	"allocate", "copy", "copy_notify", "deallocate", "io_advise", "layouterror",
+	"layoutstats", "offload_cancel", "offload_status", "read_plus", "seek",
+	"write_same", "clone", "getxattr", "setxattr", "listxattrs", "removexattr",
+}
+
+// Map proc line tag into procedure names:
+var netRpcNfsClientProcNames = map[string][]string{
+	"proc2": netRpcNfsProc2Names,
+	"proc3": netRpcNfsProc3Names,
+	"proc4": netRpcNfsClientProc4Names,
+}
+
+var netRpcNfsdProcNames = map[string][]string{
+	"proc2":    netRpcNfsProc2Names,
+	"proc3":    netRpcNfsProc3Names,
+	"proc4":    netRpcNfsdProc4Names,
+	"proc4ops": netRpcNfsdProc4OpsNames,
+}
+
+type NetRpcNfs struct {
+	// Whether this is the server (nfsd) or the client (nfs) file:
+	Server bool
+
+	// The rpc line values, indexed by NET_RPC_NFS_RPC_... for the client and
+	// NET_RPC_NFSD_RPC_... for the server:
+	Rpc []uint64
+
+	// Per procedure call counts, indexed by the proc line tag, e.g. "proc3",
+	// "proc4ops", and by the procedure number:
+	Proc map[string][]uint64
+
+	// The path file to read:
+	path string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var netRpcNfsReadFileBufPool = ReadFileBufPool16k
+
+func NetRpcNfsPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "net", "rpc", "nfs")
+}
+
+func NetRpcNfsdPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "net", "rpc", "nfsd")
+}
+
+func NewNetRpcNfs(procfsRoot string, server bool) *NetRpcNfs {
+	netRpcNfs := &NetRpcNfs{
+		Server: server,
+		Rpc:    make([]uint64, 0),
+		Proc:   make(map[string][]uint64),
+	}
+	if server {
+		netRpcNfs.path = NetRpcNfsdPath(procfsRoot)
+	} else {
+		netRpcNfs.path = NetRpcNfsPath(procfsRoot)
+	}
+	return netRpcNfs
+}
+
+func (netRpcNfs *NetRpcNfs) Clone(full bool) *NetRpcNfs {
+	newNetRpcNfs := &NetRpcNfs{
+		Server: netRpcNfs.Server,
+		Rpc:    make([]uint64, 0, len(netRpcNfs.Rpc)),
+		Proc:   make(map[string][]uint64),
+		path:   netRpcNfs.path,
+	}
+	if full {
+		newNetRpcNfs.Rpc = append(newNetRpcNfs.Rpc, netRpcNfs.Rpc...)
+		for tag, stats := range netRpcNfs.Proc {
+			newNetRpcNfs.Proc[tag] = append([]uint64(nil), stats...)
+		}
+	}
+	return newNetRpcNfs
+}
+
+// Return the name of the procedure number for a given proc line tag, "opN"
+// for numbers past the known ones, e.g. for newer kernels, or "" for the
+// unused ones:
+func (netRpcNfs *NetRpcNfs) ProcName(tag string, procNum int) string {
+	procNames := netRpcNfsClientProcNames
+	if netRpcNfs.Server {
+		procNames = netRpcNfsdProcNames
+	}
+	if names := procNames[tag]; procNum < len(names) {
+		return names[procNum]
+	}
+	return "op" + strconv.Itoa(procNum)
+}
+
+// Parse the values into the provided slice, reusing its storage:
+func parseNetRpcNfsValues(fields [][]byte, values []uint64) ([]uint64, error) {
+	values = values[:0]
+	for _, field := range fields {
+		value, err := strconv.ParseUint(string(field), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid value", field)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (netRpcNfs *NetRpcNfs) Parse() error {
+	fBuf, err := netRpcNfsReadFileBufPool.ReadFile(netRpcNfs.path)
+	defer netRpcNfsReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	foundTags := make(map[string]bool)
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		lineStart := pos
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		fields := bytes.Fields(buf[pos:eolPos])
+		pos = eolPos + 1
+		if len(fields) == 0 {
+			continue
+		}
+
+		tag := string(fields[0])
+		switch {
+		case tag == NET_RPC_NFS_RPC_LINE_TAG:
+			netRpcNfs.Rpc, err = parseNetRpcNfsValues(fields[1:], netRpcNfs.Rpc)
+		case bytes.HasPrefix(fields[0], []byte(NET_RPC_NFS_PROC_LINE_TAG_PFX)):
+			// The 1st value is the number of values that follow:
+			if len(fields) < 2 {
+				err = fmt.Errorf("missing number of values")
+				break
+			}
+			numValues, convErr := strconv.Atoi(string(fields[1]))
+			if convErr != nil || numValues != len(fields)-2 {
+				err = fmt.Errorf("%q: invalid number of values, want: %d", fields[1], len(fields)-2)
+				break
+			}
+			netRpcNfs.Proc[tag], err = parseNetRpcNfsValues(fields[2:], netRpcNfs.Proc[tag])
+			foundTags[tag] = true
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %q: %v", netRpcNfs.path, lineNum, getCurrentLine(buf, lineStart), err)
+		}
+	}
+
+	// Remove the versions that are no longer present:
+	for tag := range netRpcNfs.Proc {
+		if !foundTags[tag] {
+			delete(netRpcNfs.Proc, tag)
+		}
+	}
+
+	return nil
+}
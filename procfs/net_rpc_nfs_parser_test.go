@@ -0,0 +1,123 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type NetRpcNfsTestCase struct {
+	name          string
+	procfsRoot    string
+	server        bool
+	wantNetRpcNfs *NetRpcNfs
+	wantError     error
+}
+
+var netRpcNfsTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "net_rpc_nfs")
+
+func testNetRpcNfsParser(tc *NetRpcNfsTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+server=%v
+`,
+		tc.name, tc.procfsRoot, tc.server,
+	)
+
+	netRpcNfs := NewNetRpcNfs(tc.procfsRoot, tc.server)
+	err := netRpcNfs.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNetRpcNfs := tc.wantNetRpcNfs
+	if wantNetRpcNfs == nil {
+		return
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	testutils.CompareSlices(wantNetRpcNfs.Rpc, netRpcNfs.Rpc, "Rpc", diffBuf)
+	for tag, wantStats := range wantNetRpcNfs.Proc {
+		testutils.CompareSlices(wantStats, netRpcNfs.Proc[tag], fmt.Sprintf("Proc[%q]", tag), diffBuf)
+	}
+	for tag := range netRpcNfs.Proc {
+		if _, ok := wantNetRpcNfs.Proc[tag]; !ok {
+			fmt.Fprintf(diffBuf, "\nProc: unexpected %q", tag)
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestNetRpcNfsParser(t *testing.T) {
+	for _, tc := range []*NetRpcNfsTestCase{
+		{
+			name:       "client",
+			procfsRoot: path.Join(netRpcNfsTestDataDir, "field_mapping"),
+			wantNetRpcNfs: &NetRpcNfs{
+				Rpc: []uint64{1235, 2, 1},
+				Proc: map[string][]uint64{
+					"proc3": {0, 563, 0, 44, 102, 0, 221, 7, 0, 0, 0, 0, 0, 0, 0, 0, 1, 3, 2, 1, 0, 0},
+					"proc4": {0, 12, 5, 0, 3},
+				},
+			},
+		},
+		{
+			name:       "server",
+			procfsRoot: path.Join(netRpcNfsTestDataDir, "field_mapping"),
+			server:     true,
+			wantNetRpcNfs: &NetRpcNfs{
+				Rpc: []uint64{1263, 3, 1, 2, 0},
+				Proc: map[string][]uint64{
+					"proc3":    {2, 36, 0, 15, 42, 0, 80, 100, 5, 1, 0, 0, 2, 0, 1, 0, 0, 9, 4, 2, 0, 11},
+					"proc4":    {1, 262},
+					"proc4ops": {0, 0, 0, 12, 4, 2},
+				},
+			},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testNetRpcNfsParser(tc, t) },
+		)
+	}
+}
+
+func TestNetRpcNfsProcName(t *testing.T) {
+	client, server := NewNetRpcNfs("", false), NewNetRpcNfs("", true)
+	for _, tc := range []struct {
+		netRpcNfs *NetRpcNfs
+		tag       string
+		procNum   int
+		want      string
+	}{
+		{client, "proc3", 1, "getattr"},
+		{client, "proc4", 2, "write"},
+		{client, "proc4", 1000, "op1000"},
+		{client, "proc4ops", 3, "op3"},
+		{server, "proc4", 1, "compound"},
+		{server, "proc4ops", 0, ""},
+		{server, "proc4ops", 3, "access"},
+		{server, "proc2", 17, "statfs"},
+	} {
+		if got := tc.netRpcNfs.ProcName(tc.tag, tc.procNum); tc.want != got {
+			t.Errorf(
+				"server=%v, ProcName(%q, %d): want: %q, got: %q",
+				tc.netRpcNfs.Server, tc.tag, tc.procNum, tc.want, got,
+			)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// parser for /proc/net/softnet_stat
+
+package procfs
+
+// Sample file:
+//
+// 00008c1f 00000000 00000002 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000
+// 0000b4d2 00000003 00000011 00000000 00000000 00000000 00000000 00000000 00000000 00000017 00000000 00000000 00000001
+//
+// There is one line per online CPU, with hex values. The columns of interest
+// are:
+//  0: processed
+//  1: dropped
+//  2: time_squeeze
+//  9: received_rps
+// 10: flow_limit_count
+// 12: the CPU# (kernel 5.10+)
+//
+// Older kernels have fewer columns; the missing ones are considered 0. Since
+// only the online CPUs are listed, the line# is the same as the CPU# only if
+// there are no offline CPUs (in between). If the CPU# column is missing then
+// line# == CPU# is assumed.
+//
+// The values are unsigned 32 bit, so they wrap around.
+//
+// Reference:
+//  https://github.com/torvalds/linux/blob/v6.8/net/core/net-procfs.c#L147
+
+import (
+	"fmt"
+	"path"
+)
+
+// Indexes for the stats:
+const (
+	NET_SOFTNET_STAT_PROCESSED = iota
+	NET_SOFTNET_STAT_DROPPED
+	NET_SOFTNET_STAT_TIME_SQUEEZE
+	NET_SOFTNET_STAT_RECEIVED_RPS
+	NET_SOFTNET_STAT_FLOW_LIMIT_COUNT
+
+	// Must be last:
+	NET_SOFTNET_STAT_NUM_STATS
+)
+
+const (
+	NET_SOFTNET_STAT_CPU_NUM_COL_INDEX = 12
+	// Sanity check:
+	NET_SOFTNET_STAT_MIN_NUM_COLS = 3
+)
+
+// Map column# into stats index, -1 for columns that are not of interest. The
+// columns past the CPU# one are ignored:
+var netSoftnetStatColStatsIndex = [NET_SOFTNET_STAT_CPU_NUM_COL_INDEX]int{
+	0:  NET_SOFTNET_STAT_PROCESSED,
+	1:  NET_SOFTNET_STAT_DROPPED,
+	2:  NET_SOFTNET_STAT_TIME_SQUEEZE,
+	3:  -1,
+	4:  -1,
+	5:  -1,
+	6:  -1,
+	7:  -1,
+	8:  -1,
+	9:  NET_SOFTNET_STAT_RECEIVED_RPS,
+	10: NET_SOFTNET_STAT_FLOW_LIMIT_COUNT,
+	11: -1,
+}
+
+type NetSoftnetStat struct {
+	// Stats, indexed by line# and NET_SOFTNET_STAT_...:
+	Stats [][NET_SOFTNET_STAT_NUM_STATS]uint32
+
+	// Mapping from line# to CPU#; set to nil if no mapping is needed, i.e.
+	// line# == CPU#:
+	CpuList []int
+	// Whether the mapping (or the number of lines) has changed in the current
+	// scan or not:
+	CpuListChanged bool
+
+	// The path file to read:
+	path string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool; the file holds per
+// CPU lines, so its size is unbound:
+var netSoftnetStatReadFileBufPool = ReadFileBufPoolReadUnbound
+
+func NetSoftnetStatPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "net", "softnet_stat")
+}
+
+func NewNetSoftnetStat(procfsRoot string) *NetSoftnetStat {
+	return &NetSoftnetStat{
+		Stats: make([][NET_SOFTNET_STAT_NUM_STATS]uint32, 0),
+		path:  NetSoftnetStatPath(procfsRoot),
+	}
+}
+
+func (netSoftnetStat *NetSoftnetStat) Clone(full bool) *NetSoftnetStat {
+	newNetSoftnetStat := &NetSoftnetStat{
+		Stats:          make([][NET_SOFTNET_STAT_NUM_STATS]uint32, len(netSoftnetStat.Stats)),
+		CpuListChanged: netSoftnetStat.CpuListChanged,
+		path:           netSoftnetStat.path,
+	}
+	if full {
+		copy(newNetSoftnetStat.Stats, netSoftnetStat.Stats)
+	}
+	if netSoftnetStat.CpuList != nil {
+		newNetSoftnetStat.CpuList = make([]int, len(netSoftnetStat.CpuList))
+		copy(newNetSoftnetStat.CpuList, netSoftnetStat.CpuList)
+	}
+	return newNetSoftnetStat
+}
+
+func (netSoftnetStat *NetSoftnetStat) Parse() error {
+	fBuf, err := netSoftnetStatReadFileBufPool.ReadFile(netSoftnetStat.path)
+	defer netSoftnetStatReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	prevNumLines, prevCpuList := len(netSoftnetStat.Stats), netSoftnetStat.CpuList
+	stats := netSoftnetStat.Stats[:0]
+	cpuList := make([]int, 0, prevNumLines)
+	needsCpuList := false
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		// New line starts here:
+		lineStart, eol := pos, false
+
+		lineStats := [NET_SOFTNET_STAT_NUM_STATS]uint32{}
+		cpuNum := len(stats)
+		col := 0
+		for !eol && pos < l && col <= NET_SOFTNET_STAT_CPU_NUM_COL_INDEX {
+			for ; pos < l && isWhitespace[buf[pos]]; pos++ {
+			}
+			value, hasValue := uint32(0), false
+			for done := false; !done && pos < l; pos++ {
+				c := buf[pos]
+				if digit := c - '0'; digit < 10 {
+					value = (value << 4) + uint32(digit)
+					hasValue = true
+				} else if digit := c - 'a'; digit < 6 {
+					value = (value << 4) + uint32(digit+10)
+					hasValue = true
+				} else if digit := c - 'A'; digit < 6 {
+					value = (value << 4) + uint32(digit+10)
+					hasValue = true
+				} else if eol = (c == '\n'); eol || isWhitespace[c] {
+					done = true
+				} else {
+					return fmt.Errorf(
+						"%s:%d: %q: invalid value",
+						netSoftnetStat.path, lineNum, getCurrentLine(buf, lineStart),
+					)
+				}
+			}
+			if hasValue {
+				if col < NET_SOFTNET_STAT_CPU_NUM_COL_INDEX {
+					if index := netSoftnetStatColStatsIndex[col]; index >= 0 {
+						lineStats[index] = value
+					}
+				} else {
+					if int(value) != cpuNum {
+						needsCpuList = true
+					}
+					cpuNum = int(value)
+				}
+				col++
+			}
+		}
+
+		if col == 0 && (eol || pos >= l) {
+			// Empty line:
+			continue
+		}
+
+		if col < NET_SOFTNET_STAT_MIN_NUM_COLS {
+			return fmt.Errorf(
+				"%s:%d: %q: invalid number of columns: want at least: %d, got: %d",
+				netSoftnetStat.path, lineNum, getCurrentLine(buf, lineStart),
+				NET_SOFTNET_STAT_MIN_NUM_COLS, col,
+			)
+		}
+
+		// Advance to EOL, ignoring the columns that are not of interest:
+		for ; !eol && pos < l; pos++ {
+			eol = buf[pos] == '\n'
+		}
+
+		cpuList = append(cpuList, cpuNum)
+		stats = append(stats, lineStats)
+	}
+	netSoftnetStat.Stats = stats
+
+	if !needsCpuList {
+		cpuList = nil
+	}
+	cpuListChanged := len(stats) != prevNumLines || (cpuList == nil) != (prevCpuList == nil)
+	if !cpuListChanged && cpuList != nil {
+		for i, cpuNum := range cpuList {
+			if cpuNum != prevCpuList[i] {
+				cpuListChanged = true
+				break
+			}
+		}
+	}
+	netSoftnetStat.CpuList = cpuList
+	netSoftnetStat.CpuListChanged = cpuListChanged
+
+	return nil
+}
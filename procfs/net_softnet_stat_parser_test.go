@@ -0,0 +1,177 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type NetSoftnetStatTestCase struct {
+	name               string
+	procfsRoot         string
+	primeCpuList       []int
+	primeNumLines      int
+	wantStats          [][NET_SOFTNET_STAT_NUM_STATS]uint32
+	wantCpuList        []int
+	wantCpuListChanged bool
+	wantError          error
+}
+
+var netSoftnetStatTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "net_softnet_stat")
+
+func testNetSoftnetStatParser(tc *NetSoftnetStatTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+primeCpuList=%v
+primeNumLines=%d
+`,
+		tc.name, tc.procfsRoot, tc.primeCpuList, tc.primeNumLines,
+	)
+
+	netSoftnetStat := NewNetSoftnetStat(tc.procfsRoot)
+	if tc.primeNumLines > 0 {
+		netSoftnetStat.Stats = make([][NET_SOFTNET_STAT_NUM_STATS]uint32, tc.primeNumLines)
+		netSoftnetStat.CpuList = tc.primeCpuList
+	}
+	err := netSoftnetStat.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	if len(tc.wantStats) != len(netSoftnetStat.Stats) {
+		fmt.Fprintf(diffBuf, "\nlen(Stats): want: %d, got: %d", len(tc.wantStats), len(netSoftnetStat.Stats))
+	} else {
+		for i, wantStats := range tc.wantStats {
+			testutils.CompareSlices(wantStats[:], netSoftnetStat.Stats[i][:], fmt.Sprintf("Stats[%d]", i), diffBuf)
+		}
+	}
+	if tc.wantCpuList == nil {
+		if netSoftnetStat.CpuList != nil {
+			fmt.Fprintf(diffBuf, "\nCpuList: want: %v, got: %v", tc.wantCpuList, netSoftnetStat.CpuList)
+		}
+	} else {
+		testutils.CompareSlices(tc.wantCpuList, netSoftnetStat.CpuList, "CpuList", diffBuf)
+	}
+	if tc.wantCpuListChanged != netSoftnetStat.CpuListChanged {
+		fmt.Fprintf(
+			diffBuf, "\nCpuListChanged: want: %v, got: %v",
+			tc.wantCpuListChanged, netSoftnetStat.CpuListChanged,
+		)
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestNetSoftnetStatParser(t *testing.T) {
+	for _, tc := range []*NetSoftnetStatTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: path.Join(netSoftnetStatTestDataDir, "field_mapping"),
+			wantStats: [][NET_SOFTNET_STAT_NUM_STATS]uint32{
+				{0x8c1f, 0, 2, 0, 0},
+				{0xb4d2, 3, 0x11, 0x17, 1},
+			},
+			wantCpuListChanged: true,
+		},
+		{
+			name:          "field_mapping_unchanged",
+			procfsRoot:    path.Join(netSoftnetStatTestDataDir, "field_mapping"),
+			primeNumLines: 2,
+			wantStats: [][NET_SOFTNET_STAT_NUM_STATS]uint32{
+				{0x8c1f, 0, 2, 0, 0},
+				{0xb4d2, 3, 0x11, 0x17, 1},
+			},
+		},
+		{
+			name:          "cpu_offline",
+			procfsRoot:    path.Join(netSoftnetStatTestDataDir, "cpu_offline"),
+			primeNumLines: 3,
+			wantStats: [][NET_SOFTNET_STAT_NUM_STATS]uint32{
+				{0x8c1f, 0, 2, 0, 0},
+				{0xb4d2, 3, 0x11, 0x17, 1},
+				{0xffffffff, 1, 0, 0, 0},
+			},
+			wantCpuList:        []int{0, 2, 3},
+			wantCpuListChanged: true,
+		},
+		{
+			name:          "cpu_offline_unchanged",
+			procfsRoot:    path.Join(netSoftnetStatTestDataDir, "cpu_offline"),
+			primeCpuList:  []int{0, 2, 3},
+			primeNumLines: 3,
+			wantStats: [][NET_SOFTNET_STAT_NUM_STATS]uint32{
+				{0x8c1f, 0, 2, 0, 0},
+				{0xb4d2, 3, 0x11, 0x17, 1},
+				{0xffffffff, 1, 0, 0, 0},
+			},
+			wantCpuList: []int{0, 2, 3},
+		},
+		{
+			name:       "old_kernel",
+			procfsRoot: path.Join(netSoftnetStatTestDataDir, "old_kernel"),
+			wantStats: [][NET_SOFTNET_STAT_NUM_STATS]uint32{
+				{0x1000, 1, 2, 5, 6},
+				{0x2000, 0, 3, 7, 0},
+			},
+			wantCpuListChanged: true,
+		},
+		{
+			name:       "invalid",
+			procfsRoot: path.Join(netSoftnetStatTestDataDir, "invalid"),
+			wantError: fmt.Errorf(
+				"%s:2: %q: invalid value",
+				NetSoftnetStatPath(path.Join(netSoftnetStatTestDataDir, "invalid")),
+				"0000b4d2 00000003 0000001g 00000000 00000000 00000000 00000000 00000000 00000000 00000017 00000001 00000000 00000001",
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testNetSoftnetStatParser(tc, t) },
+		)
+	}
+}
+
+func TestNetSoftnetStatParserLarge(t *testing.T) {
+	// Emulate a large host by generating per CPU lines, such that the file
+	// exceeds the largest bounded read buffer:
+	lineFmt := "0000b4d2 00000003 00000011 00000000 00000000 00000000 00000000 00000000 00000000 00000017 00000001 00000000 %08x\n"
+	numCpus := 0x100000/len(fmt.Sprintf(lineFmt, 0)) + 1
+	content := &bytes.Buffer{}
+	wantStats := make([][NET_SOFTNET_STAT_NUM_STATS]uint32, numCpus)
+	for cpu := 0; cpu < numCpus; cpu++ {
+		fmt.Fprintf(content, lineFmt, cpu)
+		wantStats[cpu] = [NET_SOFTNET_STAT_NUM_STATS]uint32{0xb4d2, 3, 0x11, 0x17, 1}
+	}
+	procfsRoot := t.TempDir()
+	if err := os.MkdirAll(path.Dir(NetSoftnetStatPath(procfsRoot)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(NetSoftnetStatPath(procfsRoot), content.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testNetSoftnetStatParser(
+		&NetSoftnetStatTestCase{
+			name:               "large",
+			procfsRoot:         procfsRoot,
+			wantStats:          wantStats,
+			wantCpuListChanged: true,
+		},
+		t,
+	)
+}
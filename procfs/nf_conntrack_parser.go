@@ -0,0 +1,286 @@
+// parser for netfilter connection tracking stats:
+//  /proc/sys/net/netfilter/nf_conntrack_count
+//  /proc/sys/net/netfilter/nf_conntrack_max
+//  /proc/net/stat/nf_conntrack
+
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+)
+
+// /proc/net/stat/nf_conntrack has one line per possible CPU, with the values
+// in hex:
+//
+// entries  clashres found new invalid ignore delete chainlength insert insert_failed drop early_drop icmp_error  expect_new expect_create expect_delete search_restart
+// 00000027  00000000 00000000 00000000 00000001 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000  00000000 00000000 00000000 00000002
+// 00000027  00000000 00000000 00000000 00000003 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000  00000000 00000000 00000000 00000000
+//
+// The column set varies with the kernel version, so the stats of interest
+// are located based on the header.
+//
+// References:
+//  https://github.com/torvalds/linux/blob/v6.8/net/netfilter/nf_conntrack_standalone.c#L449
+//  https://github.com/torvalds/linux/blob/v6.8/include/uapi/linux/netfilter/nfnetlink_conntrack.h#L261
+
+// The stats of interest, summed across all CPUs, indexed as follows:
+const (
+	NF_CONNTRACK_STAT_FOUND = iota
+	NF_CONNTRACK_STAT_INVALID
+	NF_CONNTRACK_STAT_INSERT_FAILED
+	NF_CONNTRACK_STAT_DROP
+	NF_CONNTRACK_STAT_EARLY_DROP
+	NF_CONNTRACK_STAT_SEARCH_RESTART
+
+	// Must be last!
+	NF_CONNTRACK_NUM_STATS
+)
+
+// Map column name in the header into stats index:
+var nfConntrackStatColNameToIndex = map[string]int{
+	"found":          NF_CONNTRACK_STAT_FOUND,
+	"invalid":        NF_CONNTRACK_STAT_INVALID,
+	"insert_failed":  NF_CONNTRACK_STAT_INSERT_FAILED,
+	"drop":           NF_CONNTRACK_STAT_DROP,
+	"early_drop":     NF_CONNTRACK_STAT_EARLY_DROP,
+	"search_restart": NF_CONNTRACK_STAT_SEARCH_RESTART,
+}
+
+type NfConntrack struct {
+	// Current number of tracked connections and the table size:
+	Count, Max uint64
+
+	// Stats summed across all CPUs, indexed by NF_CONNTRACK_STAT_... The
+	// kernel keeps them as unsigned int per CPU so the sum is kept as uint32
+	// as well; this way the wrap around of the individual counters is
+	// preserved in the sum and the delta of the latter (as uint32) is correct.
+	Stats []uint32
+
+	// The number of CPU lines:
+	NumCpus int
+
+	// The paths of the files to read:
+	countPath, maxPath, statPath string
+
+	// The header of the stat file is parsed only for the 1st pass, since the
+	// file syntax cannot change without a kernel change, i.e. a reboot. The
+	// validated header is remembered and it will be checked for changes at
+	// each pass as a sanity check. The column -> stats index mapping is built
+	// based on the header, with -1 for columns that are not of interest:
+	validHeader   []byte
+	colStatsIndex []int
+}
+
+// Read the entire file in one go, using a ReadFileBufPool; the stat file holds
+// per CPU lines, so its size is unbound:
+var nfConntrackReadFileBufPool = ReadFileBufPoolReadUnbound
+
+func NfConntrackCountPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "net", "netfilter", "nf_conntrack_count")
+}
+
+func NfConntrackMaxPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "sys", "net", "netfilter", "nf_conntrack_max")
+}
+
+func NfConntrackStatPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "net", "stat", "nf_conntrack")
+}
+
+func NewNfConntrack(procfsRoot string) *NfConntrack {
+	return &NfConntrack{
+		Stats:     make([]uint32, NF_CONNTRACK_NUM_STATS),
+		countPath: NfConntrackCountPath(procfsRoot),
+		maxPath:   NfConntrackMaxPath(procfsRoot),
+		statPath:  NfConntrackStatPath(procfsRoot),
+	}
+}
+
+func (nfConntrack *NfConntrack) Clone(full bool) *NfConntrack {
+	newNfConntrack := &NfConntrack{
+		Stats:     make([]uint32, NF_CONNTRACK_NUM_STATS),
+		countPath: nfConntrack.countPath,
+		maxPath:   nfConntrack.maxPath,
+		statPath:  nfConntrack.statPath,
+	}
+
+	if nfConntrack.validHeader != nil {
+		newNfConntrack.validHeader = make([]byte, len(nfConntrack.validHeader))
+		copy(newNfConntrack.validHeader, nfConntrack.validHeader)
+	}
+	if nfConntrack.colStatsIndex != nil {
+		newNfConntrack.colStatsIndex = make([]int, len(nfConntrack.colStatsIndex))
+		copy(newNfConntrack.colStatsIndex, nfConntrack.colStatsIndex)
+	}
+
+	if full {
+		newNfConntrack.Count = nfConntrack.Count
+		newNfConntrack.Max = nfConntrack.Max
+		copy(newNfConntrack.Stats, nfConntrack.Stats)
+		newNfConntrack.NumCpus = nfConntrack.NumCpus
+	}
+
+	return newNfConntrack
+}
+
+// Parse a file consisting of a single decimal value:
+func parseNfConntrackValueFile(filePath string) (uint64, error) {
+	fBuf, err := nfConntrackReadFileBufPool.ReadFile(filePath)
+	defer nfConntrackReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return 0, err
+	}
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	pos := 0
+	for ; pos < l && isWhitespaceNl[buf[pos]]; pos++ {
+	}
+	value, hasValue := uint64(0), false
+	for ; pos < l; pos++ {
+		c := buf[pos]
+		if digit := c - '0'; digit < 10 {
+			value = (value << 3) + (value << 1) + uint64(digit)
+			hasValue = true
+		} else if isWhitespaceNl[c] {
+			break
+		} else {
+			return 0, fmt.Errorf("%s: %q: invalid value", filePath, getCurrentLine(buf, 0))
+		}
+	}
+	if !hasValue {
+		return 0, fmt.Errorf("%s: missing value", filePath)
+	}
+	return value, nil
+}
+
+func (nfConntrack *NfConntrack) validateHeader(header []byte) error {
+	colStatsIndex := make([]int, 0)
+	found := make([]bool, NF_CONNTRACK_NUM_STATS)
+	for _, colName := range bytes.Fields(header) {
+		if index, ok := nfConntrackStatColNameToIndex[string(colName)]; ok {
+			colStatsIndex = append(colStatsIndex, index)
+			found[index] = true
+		} else {
+			colStatsIndex = append(colStatsIndex, -1)
+		}
+	}
+	for colName, index := range nfConntrackStatColNameToIndex {
+		if !found[index] {
+			return fmt.Errorf(
+				"%s: %q: unsupported file header, missing %q column",
+				nfConntrack.statPath, header, colName,
+			)
+		}
+	}
+	// Ignore the columns past the last one of interest:
+	lastCol := len(colStatsIndex) - 1
+	for ; lastCol >= 0 && colStatsIndex[lastCol] < 0; lastCol-- {
+	}
+	nfConntrack.colStatsIndex = colStatsIndex[:lastCol+1]
+	nfConntrack.validHeader = make([]byte, len(header))
+	copy(nfConntrack.validHeader, header)
+	return nil
+}
+
+func (nfConntrack *NfConntrack) Parse() error {
+	var err error
+
+	if nfConntrack.Count, err = parseNfConntrackValueFile(nfConntrack.countPath); err != nil {
+		return err
+	}
+	if nfConntrack.Max, err = parseNfConntrackValueFile(nfConntrack.maxPath); err != nil {
+		return err
+	}
+
+	fBuf, err := nfConntrackReadFileBufPool.ReadFile(nfConntrack.statPath)
+	defer nfConntrackReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+
+	// Header, including the `\n':
+	statsOff := bytes.IndexByte(buf, '\n') + 1
+	if statsOff <= 0 {
+		statsOff = l
+	}
+	validHeader := nfConntrack.validHeader
+	if validHeader == nil {
+		if err = nfConntrack.validateHeader(buf[:statsOff]); err != nil {
+			return err
+		}
+	} else if !bytes.Equal(validHeader, buf[:statsOff]) {
+		return fmt.Errorf("%s: invalid/changed file header", nfConntrack.statPath)
+	}
+
+	stats, colStatsIndex := nfConntrack.Stats, nfConntrack.colStatsIndex
+	numCols := len(colStatsIndex)
+	for i := range stats {
+		stats[i] = 0
+	}
+	numCpus := 0
+
+	for pos, lineNum := statsOff, 2; pos < l; lineNum++ {
+		// New line starts here:
+		lineStart, eol := pos, false
+
+		col := 0
+		for !eol && pos < l && col < numCols {
+			for ; pos < l && isWhitespace[buf[pos]]; pos++ {
+			}
+			value, hasValue := uint32(0), false
+			for done := false; !done && pos < l; pos++ {
+				c := buf[pos]
+				if digit := c - '0'; digit < 10 {
+					value = (value << 4) + uint32(digit)
+					hasValue = true
+				} else if digit := c - 'a'; digit < 6 {
+					value = (value << 4) + uint32(digit+10)
+					hasValue = true
+				} else if digit := c - 'A'; digit < 6 {
+					value = (value << 4) + uint32(digit+10)
+					hasValue = true
+				} else if eol = (c == '\n'); eol || isWhitespace[c] {
+					done = true
+				} else {
+					return fmt.Errorf(
+						"%s:%d: %q: invalid value",
+						nfConntrack.statPath, lineNum, getCurrentLine(buf, lineStart),
+					)
+				}
+			}
+			if hasValue {
+				if index := colStatsIndex[col]; index >= 0 {
+					stats[index] += value
+				}
+				col++
+			}
+		}
+
+		if col == 0 && eol {
+			// Empty line:
+			continue
+		}
+
+		// All values retrieved?
+		if col < numCols {
+			return fmt.Errorf(
+				"%s:%d: %q: not enough values: want: %d, got: %d",
+				nfConntrack.statPath, lineNum, getCurrentLine(buf, lineStart), numCols, col,
+			)
+		}
+		numCpus++
+
+		// Advance to EOL, ignoring the columns that are not of interest:
+		for ; !eol && pos < l; pos++ {
+			eol = buf[pos] == '\n'
+		}
+	}
+
+	nfConntrack.NumCpus = numCpus
+
+	return nil
+}
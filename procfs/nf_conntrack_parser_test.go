@@ -0,0 +1,218 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+type NfConntrackTestCase struct {
+	name             string
+	procfsRoot       string
+	primeNfConntrack *NfConntrack
+	wantNfConntrack  *NfConntrack
+	wantError        error
+}
+
+var nfConntrackTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "nf_conntrack")
+
+var nfConntrackStatName = []string{
+	"NF_CONNTRACK_STAT_FOUND",
+	"NF_CONNTRACK_STAT_INVALID",
+	"NF_CONNTRACK_STAT_INSERT_FAILED",
+	"NF_CONNTRACK_STAT_DROP",
+	"NF_CONNTRACK_STAT_EARLY_DROP",
+	"NF_CONNTRACK_STAT_SEARCH_RESTART",
+}
+
+func testNfConntrackParser(tc *NfConntrackTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+primeNfConntrack=%v
+`,
+		tc.name, tc.procfsRoot, (tc.primeNfConntrack != nil),
+	)
+
+	var nfConntrack *NfConntrack
+	if tc.primeNfConntrack != nil {
+		nfConntrack = tc.primeNfConntrack.Clone(true)
+		nfConntrack.countPath = NfConntrackCountPath(tc.procfsRoot)
+		nfConntrack.maxPath = NfConntrackMaxPath(tc.procfsRoot)
+		nfConntrack.statPath = NfConntrackStatPath(tc.procfsRoot)
+	} else {
+		nfConntrack = NewNfConntrack(tc.procfsRoot)
+	}
+
+	err := nfConntrack.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNfConntrack := tc.wantNfConntrack
+	if wantNfConntrack == nil {
+		return
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	if wantNfConntrack.Count != nfConntrack.Count {
+		fmt.Fprintf(
+			diffBuf,
+			"\nCount: want: %d, got: %d",
+			wantNfConntrack.Count, nfConntrack.Count,
+		)
+	}
+	if wantNfConntrack.Max != nfConntrack.Max {
+		fmt.Fprintf(
+			diffBuf,
+			"\nMax: want: %d, got: %d",
+			wantNfConntrack.Max, nfConntrack.Max,
+		)
+	}
+	if wantNfConntrack.NumCpus != nfConntrack.NumCpus {
+		fmt.Fprintf(
+			diffBuf,
+			"\nNumCpus: want: %d, got: %d",
+			wantNfConntrack.NumCpus, nfConntrack.NumCpus,
+		)
+	}
+	if len(wantNfConntrack.Stats) != len(nfConntrack.Stats) {
+		fmt.Fprintf(
+			diffBuf,
+			"\nlen(Stats): want: %d, got: %d",
+			len(wantNfConntrack.Stats), len(nfConntrack.Stats),
+		)
+	} else {
+		for i, wantStat := range wantNfConntrack.Stats {
+			gotStat := nfConntrack.Stats[i]
+			if wantStat != gotStat {
+				fmt.Fprintf(
+					diffBuf,
+					"\nStats[%d (%s)]: want: %d, got: %d",
+					i, nfConntrackStatName[i], wantStat, gotStat,
+				)
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestNfConntrackParser(t *testing.T) {
+	for _, tc := range []*NfConntrackTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: path.Join(nfConntrackTestDataDir, "field_mapping"),
+			wantNfConntrack: &NfConntrack{
+				Count:   39,
+				Max:     262144,
+				Stats:   []uint32{0x11, 0x22, 0x33, 0x44, 0x55, 0x70},
+				NumCpus: 2,
+			},
+		},
+		{
+			name:       "reuse",
+			procfsRoot: path.Join(nfConntrackTestDataDir, "field_mapping"),
+			primeNfConntrack: &NfConntrack{
+				Count:   1,
+				Max:     2,
+				Stats:   []uint32{1, 2, 3, 4, 5, 6},
+				NumCpus: 8,
+			},
+			wantNfConntrack: &NfConntrack{
+				Count:   39,
+				Max:     262144,
+				Stats:   []uint32{0x11, 0x22, 0x33, 0x44, 0x55, 0x70},
+				NumCpus: 2,
+			},
+		},
+		{
+			name:       "old_header",
+			procfsRoot: path.Join(nfConntrackTestDataDir, "old_header"),
+			wantNfConntrack: &NfConntrack{
+				Count:   1000,
+				Max:     65536,
+				Stats:   []uint32{0x103, 0x206, 0x309, 0x40c, 0x50f, 0x612},
+				NumCpus: 4,
+			},
+		},
+		{
+			name:       "wrap_around",
+			procfsRoot: path.Join(nfConntrackTestDataDir, "wrap_around"),
+			wantNfConntrack: &NfConntrack{
+				Count:   2,
+				Max:     8,
+				Stats:   []uint32{2, 0, 0, 0, 0, 0},
+				NumCpus: 2,
+			},
+		},
+		{
+			name:       "not_loaded",
+			procfsRoot: path.Join(nfConntrackTestDataDir, "not_loaded"),
+			wantError: fmt.Errorf(
+				"open %s: no such file or directory",
+				NfConntrackCountPath(path.Join(nfConntrackTestDataDir, "not_loaded")),
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testNfConntrackParser(tc, t) },
+		)
+	}
+}
+
+func TestNfConntrackParserLarge(t *testing.T) {
+	// Emulate a large host by repeating the per CPU lines, such that the stat
+	// file exceeds the largest bounded read buffer:
+	srcRoot := path.Join(nfConntrackTestDataDir, "field_mapping")
+	procfsRoot := t.TempDir()
+	numRepeats := 1
+	for _, pathFn := range []func(string) string{
+		NfConntrackCountPath,
+		NfConntrackMaxPath,
+		NfConntrackStatPath,
+	} {
+		content, err := os.ReadFile(pathFn(srcRoot))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pathFn(srcRoot) == NfConntrackStatPath(srcRoot) {
+			statsOff := bytes.IndexByte(content, '\n') + 1
+			cpuLines := content[statsOff:]
+			numRepeats = 0x100000/len(cpuLines) + 1
+			content = append(content[:statsOff:statsOff], bytes.Repeat(cpuLines, numRepeats)...)
+		}
+		if err = os.MkdirAll(path.Dir(pathFn(procfsRoot)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(pathFn(procfsRoot), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := uint32(numRepeats)
+	testNfConntrackParser(
+		&NfConntrackTestCase{
+			name:       "large",
+			procfsRoot: procfsRoot,
+			wantNfConntrack: &NfConntrack{
+				Count:   39,
+				Max:     262144,
+				Stats:   []uint32{0x11 * n, 0x22 * n, 0x33 * n, 0x44 * n, 0x55 * n, 0x70 * n},
+				NumCpus: 2 * numRepeats,
+			},
+		},
+		t,
+	)
+}
@@ -0,0 +1,94 @@
+// parser for /proc/pid/ns/*
+
+package procfs
+
+// Each namespace the process belongs to is represented by a symbolic link:
+//
+//  /proc/PID/ns/net -> 'net:[4026531840]'
+//
+// The inode number identifies the namespace; processes in the same namespace
+// have the same inode number.
+//
+// Reference:
+//  https://man7.org/linux/man-pages/man7/namespaces.7.html
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// Define the parser as an interface such that it can be replaced w/ a test
+// object for UTs:
+type PidNsParser interface {
+	Parse(pidTidPath string) error
+	GetData() []string
+}
+
+type NewPidNsParser func() PidNsParser
+
+// The indices for the namespaces:
+const (
+	PID_NS_PID = iota
+	PID_NS_NET
+	PID_NS_MNT
+	PID_NS_USER
+	PID_NS_UTS
+	PID_NS_IPC
+	PID_NS_CGROUP
+
+	// Must be last!
+	PID_NS_NUM_FIELDS
+)
+
+// The link names under /proc/PID/ns, indexed as above:
+var PidNsNames = []string{
+	PID_NS_PID:    "pid",
+	PID_NS_NET:    "net",
+	PID_NS_MNT:    "mnt",
+	PID_NS_USER:   "user",
+	PID_NS_UTS:    "uts",
+	PID_NS_IPC:    "ipc",
+	PID_NS_CGROUP: "cgroup",
+}
+
+type PidNs struct {
+	// The namespace inode numbers, empty if the namespace is not supported by
+	// the kernel:
+	inodes []string
+}
+
+func NewPidNs() PidNsParser {
+	return &PidNs{
+		inodes: make([]string, PID_NS_NUM_FIELDS),
+	}
+}
+
+func (pidNs *PidNs) Parse(pidTidPath string) error {
+	for i, name := range PidNsNames {
+		nsPath := path.Join(pidTidPath, "ns", name)
+		link, err := os.Readlink(nsPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				pidNs.inodes[i] = ""
+				continue
+			}
+			return err
+		}
+		// Extract the inode number from `NAME:[INODE]':
+		b := []byte(link)
+		start, end := bytes.IndexByte(b, '['), bytes.LastIndexByte(b, ']')
+		if start < 0 || end <= start+1 {
+			return fmt.Errorf("%s: %q: invalid namespace link", nsPath, link)
+		}
+		pidNs.inodes[i] = link[start+1 : end]
+	}
+	return nil
+}
+
+func (pidNs *PidNs) GetData() []string {
+	return pidNs.inodes
+}
@@ -0,0 +1,107 @@
+package procfs
+
+import (
+	"fmt"
+	"path"
+	"testing"
+)
+
+var pidNsTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "pid_ns")
+
+type PidNsTestCase struct {
+	name       string
+	procfsRoot string
+	pid, tid   int
+	primePid   int
+	wantInodes []string
+	wantError  error
+}
+
+func testPidNsParser(tc *PidNsTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q, pid=%d, tid=%d
+primePid=%d
+`,
+		tc.name,
+		tc.procfsRoot, tc.pid, tc.tid,
+		tc.primePid,
+	)
+
+	pidNs := NewPidNs()
+	if tc.primePid > 0 {
+		err := pidNs.Parse(BuildPidTidPath(tc.procfsRoot, tc.primePid, PID_ONLY_TID))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pidTidPath := BuildPidTidPath(tc.procfsRoot, tc.pid, tc.tid)
+	err := pidNs.Parse(pidTidPath)
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("error: want: %v, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotInodes := pidNs.GetData()
+	for i, wantInode := range tc.wantInodes {
+		if gotInode := gotInodes[i]; wantInode != gotInode {
+			t.Errorf("%s: want: %q, got: %q", PidNsNames[i], wantInode, gotInode)
+		}
+	}
+}
+
+func TestPidNsParser(t *testing.T) {
+	for _, tc := range []*PidNsTestCase{
+		{
+			name:       "all_ns",
+			procfsRoot: pidNsTestDataDir,
+			pid:        1000,
+			tid:        PID_ONLY_TID,
+			wantInodes: []string{
+				PID_NS_PID:    "4026531836",
+				PID_NS_NET:    "4026531837",
+				PID_NS_MNT:    "4026531838",
+				PID_NS_USER:   "4026531839",
+				PID_NS_UTS:    "40265318310",
+				PID_NS_IPC:    "40265318311",
+				PID_NS_CGROUP: "40265318312",
+			},
+		},
+		{
+			name:       "missing_ns",
+			procfsRoot: pidNsTestDataDir,
+			pid:        2000,
+			tid:        PID_ONLY_TID,
+			primePid:   1000,
+			wantInodes: []string{
+				PID_NS_PID:    "4026532000",
+				PID_NS_NET:    "4026532000",
+				PID_NS_MNT:    "4026532000",
+				PID_NS_USER:   "4026532000",
+				PID_NS_UTS:    "4026532000",
+				PID_NS_IPC:    "4026532000",
+				PID_NS_CGROUP: "",
+			},
+		},
+		{
+			name:       "invalid_link",
+			procfsRoot: pidNsTestDataDir,
+			pid:        3000,
+			tid:        PID_ONLY_TID,
+			wantError: fmt.Errorf(
+				"%s: %q: invalid namespace link",
+				path.Join(BuildPidTidPath(pidNsTestDataDir, 3000, PID_ONLY_TID), "ns", "pid"), "pid",
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testPidNsParser(tc, t) },
+		)
+	}
+}
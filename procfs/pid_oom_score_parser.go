@@ -0,0 +1,70 @@
+// parser for /proc/pid/oom_score and /proc/pid/oom_score_adj
+
+package procfs
+
+// File format, a single decimal value, followed by new line:
+//
+//  oom_score:     0 .. 2000
+//  oom_score_adj: -1000 .. 1000
+//
+// Reference:
+//  https://man7.org/linux/man-pages/man5/proc_pid_oom_score.5.html
+//  https://man7.org/linux/man-pages/man5/proc_pid_oom_score_adj.5.html
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// Define the parser as an interface such that it can be replaced w/ a test
+// object for UTs:
+type PidOomScoreParser interface {
+	Parse(pidTidPath string) error
+	GetData() (oomScore, oomScoreAdj int)
+}
+
+type NewPidOomScoreParser func() PidOomScoreParser
+
+type PidOomScore struct {
+	oomScore    int
+	oomScoreAdj int
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var pidOomScoreReadFileBufPool = ReadFileBufPool16k
+
+func NewPidOomScore() PidOomScoreParser {
+	return &PidOomScore{}
+}
+
+func parsePidOomScoreFile(filePath string) (int, error) {
+	fBuf, err := pidOomScoreReadFileBufPool.ReadFile(filePath)
+	defer pidOomScoreReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.Atoi(string(bytes.TrimSpace(fBuf.Bytes())))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", filePath, err)
+	}
+	return value, nil
+}
+
+func (pidOomScore *PidOomScore) Parse(pidTidPath string) error {
+	oomScore, err := parsePidOomScoreFile(path.Join(pidTidPath, "oom_score"))
+	if err != nil {
+		return err
+	}
+	oomScoreAdj, err := parsePidOomScoreFile(path.Join(pidTidPath, "oom_score_adj"))
+	if err != nil {
+		return err
+	}
+	pidOomScore.oomScore, pidOomScore.oomScoreAdj = oomScore, oomScoreAdj
+	return nil
+}
+
+func (pidOomScore *PidOomScore) GetData() (oomScore, oomScoreAdj int) {
+	return pidOomScore.oomScore, pidOomScore.oomScoreAdj
+}
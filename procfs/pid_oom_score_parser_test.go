@@ -0,0 +1,105 @@
+package procfs
+
+import (
+	"fmt"
+	"path"
+	"testing"
+)
+
+var pidOomScoreTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "pid_oom_score")
+
+type PidOomScoreTestCase struct {
+	name            string
+	procfsRoot      string
+	pid, tid        int
+	primePid        int
+	wantOomScore    int
+	wantOomScoreAdj int
+	wantError       error
+}
+
+func testPidOomScoreParser(tc *PidOomScoreTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q, pid=%d, tid=%d
+primePid=%d
+`,
+		tc.name,
+		tc.procfsRoot, tc.pid, tc.tid,
+		tc.primePid,
+	)
+
+	pidOomScore := NewPidOomScore()
+	if tc.primePid > 0 {
+		err := pidOomScore.Parse(BuildPidTidPath(tc.procfsRoot, tc.primePid, PID_ONLY_TID))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pidTidPath := BuildPidTidPath(tc.procfsRoot, tc.pid, tc.tid)
+	err := pidOomScore.Parse(pidTidPath)
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("error: want: %v, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotOomScore, gotOomScoreAdj := pidOomScore.GetData()
+	if tc.wantOomScore != gotOomScore {
+		t.Errorf("oomScore: want: %d, got: %d", tc.wantOomScore, gotOomScore)
+	}
+	if tc.wantOomScoreAdj != gotOomScoreAdj {
+		t.Errorf("oomScoreAdj: want: %d, got: %d", tc.wantOomScoreAdj, gotOomScoreAdj)
+	}
+}
+
+func TestPidOomScoreParser(t *testing.T) {
+	for _, tc := range []*PidOomScoreTestCase{
+		{
+			name:            "negative_adj",
+			procfsRoot:      pidOomScoreTestDataDir,
+			pid:             1000,
+			tid:             PID_ONLY_TID,
+			wantOomScore:    667,
+			wantOomScoreAdj: -500,
+		},
+		{
+			name:            "reuse",
+			procfsRoot:      pidOomScoreTestDataDir,
+			pid:             2000,
+			tid:             PID_ONLY_TID,
+			primePid:        1000,
+			wantOomScore:    1200,
+			wantOomScoreAdj: 1000,
+		},
+		{
+			name:       "missing_file",
+			procfsRoot: pidOomScoreTestDataDir,
+			pid:        3000,
+			tid:        PID_ONLY_TID,
+			wantError: fmt.Errorf(
+				"open %s: no such file or directory",
+				path.Join(BuildPidTidPath(pidOomScoreTestDataDir, 3000, PID_ONLY_TID), "oom_score_adj"),
+			),
+		},
+		{
+			name:       "invalid_value",
+			procfsRoot: pidOomScoreTestDataDir,
+			pid:        4000,
+			tid:        PID_ONLY_TID,
+			wantError: fmt.Errorf(
+				`%s: strconv.Atoi: parsing "12x": invalid syntax`,
+				path.Join(BuildPidTidPath(pidOomScoreTestDataDir, 4000, PID_ONLY_TID), "oom_score"),
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testPidOomScoreParser(tc, t) },
+		)
+	}
+}
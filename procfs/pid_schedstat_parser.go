@@ -0,0 +1,95 @@
+// parser for /proc/pid/schedstat and /proc/pid/task/tid/schedstat
+
+package procfs
+
+// File format:
+//
+//  123456789 987654 33333
+//
+// The fields:
+//   1) time spent on the cpu (in ns)
+//   2) time spent waiting on a runqueue (in ns)
+//   3) # of timeslices run on this cpu
+//
+// Reference:
+//  https://docs.kernel.org/scheduler/sched-stats.html#proc-pid-schedstat
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// Define the parser as an interface such that it can be replaced w/ a test
+// object for UTs:
+type PidSchedstatParser interface {
+	Parse(pidTidPath string) error
+	GetData() []uint64
+}
+
+type NewPidSchedstatParser func() PidSchedstatParser
+
+// The indices for the numeric fields:
+const (
+	PID_SCHEDSTAT_RUN_TIME = iota
+	PID_SCHEDSTAT_WAIT_TIME
+	PID_SCHEDSTAT_TIMESLICES
+
+	// Must be last!
+	PID_SCHEDSTAT_NUM_FIELDS
+)
+
+type PidSchedstat struct {
+	// Numeric fields:
+	numericFields []uint64
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var pidSchedstatReadFileBufPool = ReadFileBufPool16k
+
+func NewPidSchedstat() PidSchedstatParser {
+	return &PidSchedstat{
+		numericFields: make([]uint64, PID_SCHEDSTAT_NUM_FIELDS),
+	}
+}
+
+func (pidSchedstat *PidSchedstat) Parse(pidTidPath string) error {
+	pidSchedstatPath := path.Join(pidTidPath, "schedstat")
+	fBuf, err := pidSchedstatReadFileBufPool.ReadFile(pidSchedstatPath)
+	defer pidSchedstatReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	numericFields := pidSchedstat.numericFields
+	fieldNum := 0
+	for pos := 0; pos < l && fieldNum < PID_SCHEDSTAT_NUM_FIELDS; {
+		// Skip leading white space:
+		for ; pos < l && isWhitespaceNl[buf[pos]]; pos++ {
+		}
+		if pos >= l {
+			break
+		}
+		start := pos
+		for ; pos < l && !isWhitespaceNl[buf[pos]]; pos++ {
+		}
+		value, err := strconv.ParseUint(string(buf[start:pos]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: field# %d: %v", pidSchedstatPath, fieldNum+1, err)
+		}
+		numericFields[fieldNum] = value
+		fieldNum++
+	}
+	if fieldNum < PID_SCHEDSTAT_NUM_FIELDS {
+		return fmt.Errorf(
+			"%s: invalid field count: want: %d, got: %d",
+			pidSchedstatPath, PID_SCHEDSTAT_NUM_FIELDS, fieldNum,
+		)
+	}
+	return nil
+}
+
+func (pidSchedstat *PidSchedstat) GetData() []uint64 {
+	return pidSchedstat.numericFields
+}
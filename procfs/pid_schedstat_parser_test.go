@@ -0,0 +1,110 @@
+package procfs
+
+import (
+	"fmt"
+	"path"
+	"testing"
+)
+
+var pidSchedstatTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "pid_schedstat")
+
+var pidSchedstatFieldName = []string{
+	"PID_SCHEDSTAT_RUN_TIME",
+	"PID_SCHEDSTAT_WAIT_TIME",
+	"PID_SCHEDSTAT_TIMESLICES",
+}
+
+type PidSchedstatTestCase struct {
+	name               string
+	procfsRoot         string
+	pid, tid           int
+	primePid, primeTid int
+	wantNumericFields  []uint64
+	wantError          error
+}
+
+func testPidSchedstatParser(tc *PidSchedstatTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q, pid=%d, tid=%d
+primePid=%d, PrimeTid=%d
+`,
+		tc.name,
+		tc.procfsRoot, tc.pid, tc.tid,
+		tc.primePid, tc.primeTid,
+	)
+
+	pidSchedstat := NewPidSchedstat()
+	if tc.primePid > 0 {
+		err := pidSchedstat.Parse(BuildPidTidPath(tc.procfsRoot, tc.primePid, tc.primeTid))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pidTidPath := BuildPidTidPath(tc.procfsRoot, tc.pid, tc.tid)
+	err := pidSchedstat.Parse(pidTidPath)
+	if tc.wantError != nil {
+		wantError := fmt.Errorf("%s: %v", path.Join(pidTidPath, "schedstat"), tc.wantError)
+		if err == nil || wantError.Error() != err.Error() {
+			t.Fatalf("error: want: %v, got: %v", wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotNumericFields := pidSchedstat.GetData()
+	for i, wantValue := range tc.wantNumericFields {
+		if gotValue := gotNumericFields[i]; wantValue != gotValue {
+			t.Errorf("field[%s]: want: %d, got: %d", pidSchedstatFieldName[i], wantValue, gotValue)
+		}
+	}
+}
+
+func TestPidSchedstatParser(t *testing.T) {
+	for _, tc := range []*PidSchedstatTestCase{
+		{
+			name:              "field_mapping",
+			procfsRoot:        pidSchedstatTestDataDir,
+			pid:               1000,
+			tid:               PID_ONLY_TID,
+			wantNumericFields: []uint64{123456789, 987654, 33333},
+		},
+		{
+			name:              "field_mapping_tid",
+			procfsRoot:        pidSchedstatTestDataDir,
+			pid:               1000,
+			tid:               1001,
+			wantNumericFields: []uint64{23456789, 87654, 3333},
+		},
+		{
+			name:              "reuse",
+			procfsRoot:        pidSchedstatTestDataDir,
+			pid:               1000,
+			tid:               1001,
+			primePid:          1000,
+			primeTid:          PID_ONLY_TID,
+			wantNumericFields: []uint64{23456789, 87654, 3333},
+		},
+		{
+			name:       "missing_field",
+			procfsRoot: pidSchedstatTestDataDir,
+			pid:        2000,
+			tid:        PID_ONLY_TID,
+			wantError:  fmt.Errorf("invalid field count: want: %d, got: %d", PID_SCHEDSTAT_NUM_FIELDS, 2),
+		},
+		{
+			name:       "invalid_value",
+			procfsRoot: pidSchedstatTestDataDir,
+			pid:        3000,
+			tid:        PID_ONLY_TID,
+			wantError:  fmt.Errorf(`field# 2: strconv.ParseUint: parsing "x": invalid syntax`),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testPidSchedstatParser(tc, t) },
+		)
+	}
+}
@@ -0,0 +1,144 @@
+// parser for /proc/pid/smaps_rollup
+
+package procfs
+
+// File format:
+//
+//  55d8f2d0f000-7ffd1a5fe000 ---p 00000000 00:00 0                          [rollup]
+//  Rss:              123456 kB
+//  Pss:               12345 kB
+//  Pss_Dirty:          1234 kB
+//  Pss_Anon:           2345 kB
+//  Pss_File:           3456 kB
+//  Pss_Shmem:           456 kB
+//  Shared_Clean:       5678 kB
+//  ...
+//  Private_Dirty:      6789 kB
+//  ...
+//  SwapPss:              12 kB
+//  ...
+//
+// The file is empty for kernel threads, which have no memory map of their own.
+// Some of the fields may be missing for older kernels, e.g. Pss_Anon, Pss_File
+// and Pss_Shmem were added in 5.8.
+//
+// Reference:
+//  https://docs.kernel.org/filesystems/proc.html#proc-pid-smaps-rollup
+//
+// Note: the file is expensive to read, since the kernel has to walk the entire
+// memory map of the process.
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// Define the parser as an interface such that it can be replaced w/ a test
+// object for UTs:
+type PidSmapsRollupParser interface {
+	Parse(pidTidPath string) error
+	// Return the values, in bytes, and whether they were found or not:
+	GetData() ([]uint64, []bool)
+}
+
+type NewPidSmapsRollupParser func() PidSmapsRollupParser
+
+// The indices for the numeric fields:
+const (
+	PID_SMAPS_ROLLUP_PSS = iota
+	PID_SMAPS_ROLLUP_PSS_ANON
+	PID_SMAPS_ROLLUP_PSS_FILE
+	PID_SMAPS_ROLLUP_PSS_SHMEM
+	PID_SMAPS_ROLLUP_SWAP_PSS
+	PID_SMAPS_ROLLUP_PRIVATE_DIRTY
+	PID_SMAPS_ROLLUP_SHARED_CLEAN
+
+	// Must be last!
+	PID_SMAPS_ROLLUP_NUM_FIELDS
+)
+
+// Map field name into index; only the fields in the map below are processed:
+var pidSmapsRollupFieldNameIndex = map[string]int{
+	"Pss":           PID_SMAPS_ROLLUP_PSS,
+	"Pss_Anon":      PID_SMAPS_ROLLUP_PSS_ANON,
+	"Pss_File":      PID_SMAPS_ROLLUP_PSS_FILE,
+	"Pss_Shmem":     PID_SMAPS_ROLLUP_PSS_SHMEM,
+	"SwapPss":       PID_SMAPS_ROLLUP_SWAP_PSS,
+	"Private_Dirty": PID_SMAPS_ROLLUP_PRIVATE_DIRTY,
+	"Shared_Clean":  PID_SMAPS_ROLLUP_SHARED_CLEAN,
+}
+
+var pidSmapsRollupKbUnit = []byte("kB")
+
+type PidSmapsRollup struct {
+	// Numeric fields, in bytes:
+	numericFields []uint64
+	// Whether the field was found or not:
+	found []bool
+}
+
+// Read the entire file in one go, using a ReadFileBufPool:
+var pidSmapsRollupReadFileBufPool = ReadFileBufPool16k
+
+func NewPidSmapsRollup() PidSmapsRollupParser {
+	return &PidSmapsRollup{
+		numericFields: make([]uint64, PID_SMAPS_ROLLUP_NUM_FIELDS),
+		found:         make([]bool, PID_SMAPS_ROLLUP_NUM_FIELDS),
+	}
+}
+
+func (pidSmapsRollup *PidSmapsRollup) Parse(pidTidPath string) error {
+	pidSmapsRollupPath := path.Join(pidTidPath, "smaps_rollup")
+	fBuf, err := pidSmapsRollupReadFileBufPool.ReadFile(pidSmapsRollupPath)
+	defer pidSmapsRollupReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	numericFields, found := pidSmapsRollup.numericFields, pidSmapsRollup.found
+	clear(numericFields)
+	clear(found)
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		// The header line, i.e. the address range, has no `:' prefix
+		// terminator; skip it together w/ the lines not of interest:
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		prefix := fields[0]
+		if len(prefix) < 2 || prefix[len(prefix)-1] != ':' {
+			continue
+		}
+		index, ok := pidSmapsRollupFieldNameIndex[string(prefix[:len(prefix)-1])]
+		if !ok {
+			continue
+		}
+		if len(fields) != 3 || !bytes.Equal(fields[2], pidSmapsRollupKbUnit) {
+			return fmt.Errorf("%s:%d: %q: invalid line", pidSmapsRollupPath, lineNum, line)
+		}
+		value, err := strconv.ParseUint(string(fields[1]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %q: invalid value", pidSmapsRollupPath, lineNum, line)
+		}
+		numericFields[index] = value * 1024
+		found[index] = true
+	}
+	return nil
+}
+
+func (pidSmapsRollup *PidSmapsRollup) GetData() ([]uint64, []bool) {
+	return pidSmapsRollup.numericFields, pidSmapsRollup.found
+}
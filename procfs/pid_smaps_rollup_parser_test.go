@@ -0,0 +1,133 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+var pidSmapsRollupTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "pid_smaps_rollup")
+
+var pidSmapsRollupFieldName = []string{
+	"PID_SMAPS_ROLLUP_PSS",
+	"PID_SMAPS_ROLLUP_PSS_ANON",
+	"PID_SMAPS_ROLLUP_PSS_FILE",
+	"PID_SMAPS_ROLLUP_PSS_SHMEM",
+	"PID_SMAPS_ROLLUP_SWAP_PSS",
+	"PID_SMAPS_ROLLUP_PRIVATE_DIRTY",
+	"PID_SMAPS_ROLLUP_SHARED_CLEAN",
+}
+
+type PidSmapsRollupTestCase struct {
+	name       string
+	procfsRoot string
+	pid        int
+	primePid   int
+	// Missing fields should not be in the map:
+	wantNumericFields map[int]uint64
+	wantError         error
+}
+
+func testPidSmapsRollupParser(tc *PidSmapsRollupTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q, pid=%d
+primePid=%d
+`,
+		tc.name,
+		tc.procfsRoot, tc.pid,
+		tc.primePid,
+	)
+
+	pidSmapsRollup := NewPidSmapsRollup()
+	if tc.primePid > 0 {
+		err := pidSmapsRollup.Parse(BuildPidTidPath(tc.procfsRoot, tc.primePid, PID_ONLY_TID))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pidTidPath := BuildPidTidPath(tc.procfsRoot, tc.pid, PID_ONLY_TID)
+	err := pidSmapsRollup.Parse(pidTidPath)
+	if tc.wantError != nil {
+		wantError := fmt.Errorf("%s:%v", path.Join(pidTidPath, "smaps_rollup"), tc.wantError)
+		if err == nil || wantError.Error() != err.Error() {
+			t.Fatalf("error: want: %v, got: %v", wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotNumericFields, gotFound := pidSmapsRollup.GetData()
+	diffBuf := &bytes.Buffer{}
+	for i := 0; i < PID_SMAPS_ROLLUP_NUM_FIELDS; i++ {
+		wantValue, wantFound := tc.wantNumericFields[i]
+		if wantFound != gotFound[i] {
+			fmt.Fprintf(
+				diffBuf,
+				"\nfound[%s]: want: %v, got: %v",
+				pidSmapsRollupFieldName[i], wantFound, gotFound[i],
+			)
+		} else if wantFound && wantValue != gotNumericFields[i] {
+			fmt.Fprintf(
+				diffBuf,
+				"\nfield[%s]: want: %d, got: %d",
+				pidSmapsRollupFieldName[i], wantValue, gotNumericFields[i],
+			)
+		}
+	}
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestPidSmapsRollupParser(t *testing.T) {
+	for _, tc := range []*PidSmapsRollupTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: pidSmapsRollupTestDataDir,
+			pid:        1000,
+			wantNumericFields: map[int]uint64{
+				PID_SMAPS_ROLLUP_PSS:           100 * 1024,
+				PID_SMAPS_ROLLUP_PSS_ANON:      101 * 1024,
+				PID_SMAPS_ROLLUP_PSS_FILE:      102 * 1024,
+				PID_SMAPS_ROLLUP_PSS_SHMEM:     103 * 1024,
+				PID_SMAPS_ROLLUP_SHARED_CLEAN:  104 * 1024,
+				PID_SMAPS_ROLLUP_PRIVATE_DIRTY: 105 * 1024,
+				PID_SMAPS_ROLLUP_SWAP_PSS:      106 * 1024,
+			},
+		},
+		{
+			name:       "missing_fields",
+			procfsRoot: pidSmapsRollupTestDataDir,
+			pid:        2000,
+			primePid:   1000,
+			wantNumericFields: map[int]uint64{
+				PID_SMAPS_ROLLUP_PSS:           200 * 1024,
+				PID_SMAPS_ROLLUP_SHARED_CLEAN:  204 * 1024,
+				PID_SMAPS_ROLLUP_PRIVATE_DIRTY: 205 * 1024,
+				PID_SMAPS_ROLLUP_SWAP_PSS:      206 * 1024,
+			},
+		},
+		{
+			name:              "kernel_thread",
+			procfsRoot:        pidSmapsRollupTestDataDir,
+			pid:               3000,
+			primePid:          1000,
+			wantNumericFields: map[int]uint64{},
+		},
+		{
+			name:       "invalid_value",
+			procfsRoot: pidSmapsRollupTestDataDir,
+			pid:        4000,
+			wantError:  fmt.Errorf("%d: %q: invalid value", 2, "Pss:                 1x0 kB"),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testPidSmapsRollupParser(tc, t) },
+		)
+	}
+}
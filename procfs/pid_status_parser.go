@@ -74,6 +74,11 @@ const (
 	PID_STATUS_HUGETLBPAGES
 	PID_STATUS_CPUS_ALLOWED_LIST
 	PID_STATUS_MEMS_ALLOWED_LIST
+	// The PID (thread group ID) and PID as seen in each of the PID namespaces
+	// of the process, from the outermost to the innermost; the lines are
+	// available for kernels 4.1+:
+	PID_STATUS_NSTGID
+	PID_STATUS_NSPID
 	// Must be last:
 	PID_STATUS_BYTE_SLICE_NUM_FIELDS
 )
@@ -145,6 +150,8 @@ var pidStatusLineHandlingMap = map[string]*PidStatusLineHandling{
 	"HugetlbPages":               {dataType: PID_STATUS_SINGLE_VAL_UNIT_DATA, index: PID_STATUS_HUGETLBPAGES},
 	"Cpus_allowed_list":          {dataType: PID_STATUS_SINGLE_VAL_DATA, index: PID_STATUS_CPUS_ALLOWED_LIST},
 	"Mems_allowed_list":          {dataType: PID_STATUS_SINGLE_VAL_DATA, index: PID_STATUS_MEMS_ALLOWED_LIST},
+	"NStgid":                     {dataType: PID_STATUS_LIST_DATA, index: PID_STATUS_NSTGID},
+	"NSpid":                      {dataType: PID_STATUS_LIST_DATA, index: PID_STATUS_NSPID},
 	"voluntary_ctxt_switches":    {dataType: PID_STATUS_ULONG_DATA, index: PID_STATUS_VOLUNTARY_CTXT_SWITCHES},
 	"nonvoluntary_ctxt_switches": {dataType: PID_STATUS_ULONG_DATA, index: PID_STATUS_NONVOLUNTARY_CTXT_SWITCHES},
 }
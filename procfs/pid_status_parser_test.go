@@ -349,6 +349,32 @@ func TestPidStatusParser(t *testing.T) {
 				PID_STATUS_NONVOLUNTARY_CTXT_SWITCHES: 0,
 			},
 		},
+		{
+			name:       "ns_fields",
+			procfsRoot: pidStatusTestDataDir,
+			pid:        2000,
+			tid:        PID_ONLY_TID,
+			wantByteSliceFieldValues: map[int]string{
+				PID_STATUS_UID:               "0,0,0,0",
+				PID_STATUS_MEMS_ALLOWED_LIST: "0",
+				PID_STATUS_NSTGID:            "2000,150,1",
+				PID_STATUS_NSPID:             "2000,150,1",
+			},
+		},
+		{
+			name:       "ns_fields_missing",
+			procfsRoot: pidStatusTestDataDir,
+			pid:        2001,
+			tid:        PID_ONLY_TID,
+			primePid:   2000,
+			primeTid:   PID_ONLY_TID,
+			wantByteSliceFieldValues: map[int]string{
+				PID_STATUS_UID:               "0,0,0,0",
+				PID_STATUS_MEMS_ALLOWED_LIST: "0",
+				PID_STATUS_NSTGID:            "",
+				PID_STATUS_NSPID:             "",
+			},
+		},
 	} {
 		t.Run(
 			tc.name,
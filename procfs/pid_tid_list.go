@@ -34,6 +34,7 @@ type PidTidListCacheIF interface {
 	GetPidTidList(partNo int, into []PidTid) ([]PidTid, error)
 	Invalidate()
 	GetRefreshCount() uint64
+	GetPidTidCount() (pidCount, tidCount int, err error)
 }
 
 type PidTidListCache struct {
@@ -67,6 +68,10 @@ type PidTidListCache struct {
 
 	// Refresh count (mainly for testing):
 	refreshCount uint64
+
+	// The number of PIDs and TIDs found by the most recent scan; TIDs are
+	// counted only if enabled:
+	pidCount, tidCount int
 }
 
 func NewPidTidListCache(procfsRoot string, numPart int, validFor time.Duration, flags uint32) PidTidListCacheIF {
@@ -135,7 +140,7 @@ func (pidTidListCache *PidTidListCache) Refresh(lockAcquired bool) error {
 	mask, numPart, useMask := pidTidListCache.mask, pidTidListCache.numPart, pidTidListCache.mask > 0
 	isPidEnabled := pidTidListCache.flags&PID_LIST_CACHE_PID_ENABLED > 0
 	isTidEnabled := pidTidListCache.flags&PID_LIST_CACHE_TID_ENABLED > 0
-	numEntries := 0
+	numEntries, pidCount, tidCount := 0, 0, 0
 	for _, name := range names {
 		var (
 			partNo   int
@@ -159,6 +164,7 @@ func (pidTidListCache *PidTidListCache) Refresh(lockAcquired bool) error {
 
 		pidTid.Pid = pid
 		pidTid.Tid = PID_ONLY_TID
+		pidCount += 1
 
 		if isPidEnabled {
 			if useMask {
@@ -190,6 +196,7 @@ func (pidTidListCache *PidTidListCache) Refresh(lockAcquired bool) error {
 					continue
 				}
 				pidTid.Tid = tid
+				tidCount += 1
 				if useMask {
 					partNo = tid & pidTidListCache.mask
 				} else {
@@ -205,6 +212,7 @@ func (pidTidListCache *PidTidListCache) Refresh(lockAcquired bool) error {
 	}
 	pidTidListCache.retrievedTime = time.Now()
 	pidTidListCache.refreshCount += 1
+	pidTidListCache.pidCount, pidTidListCache.tidCount = pidCount, tidCount
 	return nil
 }
 
@@ -242,3 +250,24 @@ func (pidTidListCache *PidTidListCache) GetRefreshCount() uint64 {
 	defer pidTidListCache.lock.Unlock()
 	return pidTidListCache.refreshCount
 }
+
+// Return the number of PIDs and TIDs as of the most recent scan. Unlike
+// GetPidTidList, the cache is refreshed only if it was never initialized (or
+// it was invalidated), regardless of the validity interval; this way the
+// counts can be used by other consumers w/o causing additional scans. The TID
+// count is -1 if the cache is not enabled for TIDs.
+func (pidTidListCache *PidTidListCache) GetPidTidCount() (int, int, error) {
+	pidTidListCache.lock.Lock()
+	defer pidTidListCache.lock.Unlock()
+	if !pidTidListCache.initialized {
+		err := pidTidListCache.Refresh(true)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	tidCount := pidTidListCache.tidCount
+	if pidTidListCache.flags&PID_LIST_CACHE_TID_ENABLED == 0 {
+		tidCount = -1
+	}
+	return pidTidListCache.pidCount, tidCount, nil
+}
@@ -2,6 +2,7 @@ package procfs
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"sync"
 	"testing"
@@ -100,3 +101,50 @@ func TestPidTidListCache(t *testing.T) {
 		)
 	}
 }
+
+func TestPidTidListCacheCount(t *testing.T) {
+	// Build a minimal procfs tree: PID dirs w/ task/TID dirs, plus some
+	// non-PID entries that should be ignored:
+	procfsRoot := t.TempDir()
+	for _, dir := range []string{
+		"1/task/1",
+		"100/task/100", "100/task/101", "100/task/102",
+		"200/task/200",
+		"sys/fs", "self",
+	} {
+		if err := os.MkdirAll(path.Join(procfsRoot, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		flags                  uint32
+		wantPidCnt, wantTidCnt int
+	}{
+		{PID_LIST_CACHE_PID_ENABLED, 3, -1},
+		{PID_LIST_CACHE_ALL_ENABLED, 3, 5},
+	} {
+		t.Run(
+			fmt.Sprintf("flags=%d", tc.flags),
+			func(t *testing.T) {
+				pidTidListCache := NewPidTidListCache(procfsRoot, 2, time.Hour, tc.flags)
+				for k := 0; k < 2; k++ {
+					gotPidCnt, gotTidCnt, err := pidTidListCache.GetPidTidCount()
+					if err != nil {
+						t.Fatal(err)
+					}
+					if tc.wantPidCnt != gotPidCnt || tc.wantTidCnt != gotTidCnt {
+						t.Fatalf(
+							"(pidCount, tidCount): want: (%d, %d), got: (%d, %d)",
+							tc.wantPidCnt, tc.wantTidCnt, gotPidCnt, gotTidCnt,
+						)
+					}
+				}
+				// The count should not force a refresh, once initialized:
+				if gotRefreshCount := pidTidListCache.GetRefreshCount(); gotRefreshCount != 1 {
+					t.Fatalf("refreshCount: want: 1, got: %d", gotRefreshCount)
+				}
+			},
+		)
+	}
+}
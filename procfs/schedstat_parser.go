@@ -0,0 +1,223 @@
+// parser for /proc/schedstat
+
+package procfs
+
+// File format (version 15+):
+//
+//  version 15
+//  timestamp 4295014040
+//  cpu0 0 0 22222 11111 9999 5555 123456789 987654 33333
+//  domain0 00000003 ...
+//  cpu1 ...
+//
+// The cpuN line fields:
+//   1) # of times sched_yield() was called
+//   2) legacy, always 0
+//   3) # of times schedule() was called
+//   4) # of times schedule() left the processor idle
+//   5) # of times try_to_wake_up() was called
+//   6) # of times try_to_wake_up() was called to wake up the local cpu
+//   7) sum of all time spent running by tasks on this processor (in ns)
+//   8) sum of all time spent waiting to run by tasks on this processor (in ns)
+//   9) # of timeslices run on this cpu
+//
+// The domainN lines are ignored.
+//
+// References:
+//  https://docs.kernel.org/scheduler/sched-stats.html
+//  https://github.com/torvalds/linux/blob/v6.8/kernel/sched/stats.c#L111
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// Indexes for cpu[] stats:
+const (
+	SCHEDSTAT_CPU_YLD_COUNT = iota
+	SCHEDSTAT_CPU_SCHED_COUNT
+	SCHEDSTAT_CPU_SCHED_GOIDLE
+	SCHEDSTAT_CPU_TTWU_COUNT
+	SCHEDSTAT_CPU_TTWU_LOCAL
+	SCHEDSTAT_CPU_RUN_TIME
+	SCHEDSTAT_CPU_WAIT_TIME
+	SCHEDSTAT_CPU_TIMESLICES
+
+	// Must be last!
+	SCHEDSTAT_CPU_NUM_STATS
+)
+
+const (
+	// The pseudo cpu# used for all, i.e. the sum across all CPUs:
+	SCHEDSTAT_CPU_ALL = -1
+
+	// The minimum supported version:
+	SCHEDSTAT_MIN_VERSION = 15
+
+	// The number of fields expected for cpu stats, excluding the cpuN
+	// prefix:
+	SCHEDSTAT_CPU_NUM_FIELDS = 9
+)
+
+// Map cpuN line field# (0 based, excluding the prefix) into cpu[] stats index,
+// -1 for fields that are ignored:
+var schedstatCpuFieldIndex = [SCHEDSTAT_CPU_NUM_FIELDS]int{
+	SCHEDSTAT_CPU_YLD_COUNT,
+	-1,
+	SCHEDSTAT_CPU_SCHED_COUNT,
+	SCHEDSTAT_CPU_SCHED_GOIDLE,
+	SCHEDSTAT_CPU_TTWU_COUNT,
+	SCHEDSTAT_CPU_TTWU_LOCAL,
+	SCHEDSTAT_CPU_RUN_TIME,
+	SCHEDSTAT_CPU_WAIT_TIME,
+	SCHEDSTAT_CPU_TIMESLICES,
+}
+
+var (
+	schedstatVersionPrefix = []byte("version")
+	schedstatCpuPrefix     = []byte("cpu")
+)
+
+type Schedstat struct {
+	// The file version:
+	Version int
+	// CPU stats indexed by CPU#; SCHEDSTAT_CPU_ALL is the index for the sum
+	// across all CPUs:
+	Cpu map[int][]uint64
+	// The number of CPU's found, excluding `all`:
+	NumCpus int
+	// The path file to read:
+	path string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool; the file holds
+// per CPU and per scheduling domain info so its size is unbound:
+var schedstatReadFileBufPool = ReadFileBufPoolReadUnbound
+
+func SchedstatPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "schedstat")
+}
+
+func NewSchedstat(procfsRoot string) *Schedstat {
+	return &Schedstat{
+		Cpu:  make(map[int][]uint64),
+		path: SchedstatPath(procfsRoot),
+	}
+}
+
+func (schedstat *Schedstat) Clone(full bool) *Schedstat {
+	newSchedstat := &Schedstat{
+		Cpu:  make(map[int][]uint64),
+		path: schedstat.path,
+	}
+	if full {
+		newSchedstat.Version = schedstat.Version
+		newSchedstat.NumCpus = schedstat.NumCpus
+		for cpu, cpuStats := range schedstat.Cpu {
+			newSchedstat.Cpu[cpu] = make([]uint64, SCHEDSTAT_CPU_NUM_STATS)
+			copy(newSchedstat.Cpu[cpu], cpuStats)
+		}
+	}
+	return newSchedstat
+}
+
+func (schedstat *Schedstat) Parse() error {
+	fBuf, err := schedstatReadFileBufPool.ReadFile(schedstat.path)
+	defer schedstatReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	allStats := schedstat.Cpu[SCHEDSTAT_CPU_ALL]
+	if allStats == nil {
+		allStats = make([]uint64, SCHEDSTAT_CPU_NUM_STATS)
+		schedstat.Cpu[SCHEDSTAT_CPU_ALL] = allStats
+	} else {
+		clear(allStats)
+	}
+
+	// CPUs may be unplugged dynamically; keep track of the ones found at this
+	// scan, to remove the out-of-scope ones at the end:
+	found := make(map[int]bool)
+
+	schedstat.Version = 0
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if bytes.Equal(fields[0], schedstatVersionPrefix) {
+			if len(fields) == 2 {
+				schedstat.Version, err = strconv.Atoi(string(fields[1]))
+			}
+			if len(fields) != 2 || err != nil {
+				return fmt.Errorf("%s:%d: %q: invalid version", schedstat.path, lineNum, line)
+			}
+			if schedstat.Version < SCHEDSTAT_MIN_VERSION {
+				return fmt.Errorf(
+					"%s:%d: %q: unsupported version, want: >= %d",
+					schedstat.path, lineNum, line, SCHEDSTAT_MIN_VERSION,
+				)
+			}
+			continue
+		}
+
+		if !bytes.HasPrefix(fields[0], schedstatCpuPrefix) {
+			continue
+		}
+		if schedstat.Version == 0 {
+			return fmt.Errorf("%s:%d: %q: missing version", schedstat.path, lineNum, line)
+		}
+		cpu, err := strconv.Atoi(string(fields[0][len(schedstatCpuPrefix):]))
+		if err != nil || cpu < 0 {
+			return fmt.Errorf("%s:%d: %q: invalid cpu#", schedstat.path, lineNum, line)
+		}
+		if len(fields)-1 < SCHEDSTAT_CPU_NUM_FIELDS {
+			return fmt.Errorf(
+				"%s:%d: %q: invalid field count: want: >= %d, got: %d",
+				schedstat.path, lineNum, line, SCHEDSTAT_CPU_NUM_FIELDS, len(fields)-1,
+			)
+		}
+		cpuStats := schedstat.Cpu[cpu]
+		if cpuStats == nil {
+			cpuStats = make([]uint64, SCHEDSTAT_CPU_NUM_STATS)
+			schedstat.Cpu[cpu] = cpuStats
+		}
+		for i, index := range schedstatCpuFieldIndex {
+			if index < 0 {
+				continue
+			}
+			value, err := strconv.ParseUint(string(fields[i+1]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %q: invalid value", schedstat.path, lineNum, line)
+			}
+			cpuStats[index] = value
+			allStats[index] += value
+		}
+		found[cpu] = true
+	}
+
+	if len(schedstat.Cpu)-1 > len(found) {
+		for cpu := range schedstat.Cpu {
+			if cpu != SCHEDSTAT_CPU_ALL && !found[cpu] {
+				delete(schedstat.Cpu, cpu)
+			}
+		}
+	}
+	schedstat.NumCpus = len(found)
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+type SchedstatTestCase struct {
+	name           string
+	procfsRoot     string
+	primeSchedstat *Schedstat
+	wantSchedstat  *Schedstat
+	wantError      error
+}
+
+var schedstatTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "schedstat")
+
+var schedstatCpuStatName = []string{
+	"SCHEDSTAT_CPU_YLD_COUNT",
+	"SCHEDSTAT_CPU_SCHED_COUNT",
+	"SCHEDSTAT_CPU_SCHED_GOIDLE",
+	"SCHEDSTAT_CPU_TTWU_COUNT",
+	"SCHEDSTAT_CPU_TTWU_LOCAL",
+	"SCHEDSTAT_CPU_RUN_TIME",
+	"SCHEDSTAT_CPU_WAIT_TIME",
+	"SCHEDSTAT_CPU_TIMESLICES",
+}
+
+func testSchedstatParser(tc *SchedstatTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+primeSchedstat=%v
+`,
+		tc.name, tc.procfsRoot, (tc.primeSchedstat != nil),
+	)
+
+	var schedstat *Schedstat
+	if tc.primeSchedstat != nil {
+		schedstat = tc.primeSchedstat.Clone(true)
+		schedstat.path = SchedstatPath(tc.procfsRoot)
+	} else {
+		schedstat = NewSchedstat(tc.procfsRoot)
+	}
+
+	err := schedstat.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSchedstat := tc.wantSchedstat
+	diffBuf := &bytes.Buffer{}
+
+	if wantSchedstat.Version != schedstat.Version {
+		fmt.Fprintf(diffBuf, "\nVersion: want: %d, got: %d", wantSchedstat.Version, schedstat.Version)
+	}
+	if wantSchedstat.NumCpus != schedstat.NumCpus {
+		fmt.Fprintf(diffBuf, "\nNumCpus: want: %d, got: %d", wantSchedstat.NumCpus, schedstat.NumCpus)
+	}
+	if len(wantSchedstat.Cpu) != len(schedstat.Cpu) {
+		fmt.Fprintf(diffBuf, "\nlen(Cpu): want: %d, got: %d", len(wantSchedstat.Cpu), len(schedstat.Cpu))
+	}
+	for cpu, wantCpuStats := range wantSchedstat.Cpu {
+		gotCpuStats := schedstat.Cpu[cpu]
+		if gotCpuStats == nil {
+			fmt.Fprintf(diffBuf, "\nCpu[%d]: missing", cpu)
+			continue
+		}
+		for index, wantVal := range wantCpuStats {
+			if gotVal := gotCpuStats[index]; wantVal != gotVal {
+				fmt.Fprintf(
+					diffBuf,
+					"\nCpu[%d][%s]: want: %d, got: %d",
+					cpu, schedstatCpuStatName[index], wantVal, gotVal,
+				)
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestSchedstatParser(t *testing.T) {
+	cpu0Stats := []uint64{1, 22222, 11111, 9999, 5555, 123456789, 987654, 33333}
+	cpu1Stats := []uint64{2, 44444, 22222, 8888, 4444, 223456789, 87654, 44444}
+	allStats := []uint64{3, 66666, 33333, 18887, 9999, 346913578, 1075308, 77777}
+
+	for _, tc := range []*SchedstatTestCase{
+		{
+			name:       "field_mapping",
+			procfsRoot: path.Join(schedstatTestDataDir, "field_mapping"),
+			wantSchedstat: &Schedstat{
+				Version: 15,
+				Cpu: map[int][]uint64{
+					SCHEDSTAT_CPU_ALL: allStats,
+					0:                 cpu0Stats,
+					1:                 cpu1Stats,
+				},
+				NumCpus: 2,
+			},
+		},
+		{
+			name:       "cpu_offline",
+			procfsRoot: path.Join(schedstatTestDataDir, "cpu_offline"),
+			primeSchedstat: &Schedstat{
+				Version: 15,
+				Cpu: map[int][]uint64{
+					SCHEDSTAT_CPU_ALL: allStats,
+					0:                 cpu0Stats,
+					1:                 cpu1Stats,
+				},
+				NumCpus: 2,
+			},
+			wantSchedstat: &Schedstat{
+				Version: 16,
+				Cpu: map[int][]uint64{
+					SCHEDSTAT_CPU_ALL: cpu1Stats,
+					1:                 cpu1Stats,
+				},
+				NumCpus: 1,
+			},
+		},
+		{
+			name:       "old_version",
+			procfsRoot: path.Join(schedstatTestDataDir, "old_version"),
+			wantError: fmt.Errorf(
+				"%s:1: %q: unsupported version, want: >= %d",
+				path.Join(schedstatTestDataDir, "old_version", "schedstat"),
+				"version 14",
+				SCHEDSTAT_MIN_VERSION,
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testSchedstatParser(tc, t) },
+		)
+	}
+}
+
+func TestSchedstatParserLarge(t *testing.T) {
+	// Emulate a large host by repeating the per CPU domain lines, such that
+	// the file exceeds the largest bounded read buffer:
+	content, err := os.ReadFile(path.Join(schedstatTestDataDir, "field_mapping", "schedstat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	domainLine := content[bytes.Index(content, []byte("domain0 ")):]
+	domainLine = domainLine[:bytes.IndexByte(domainLine, '\n')+1]
+	domainLines := bytes.Repeat(domainLine, 0x100000/len(domainLine)/2+1)
+	procfsRoot := t.TempDir()
+	err = os.WriteFile(
+		path.Join(procfsRoot, "schedstat"),
+		bytes.ReplaceAll(content, domainLine, domainLines),
+		0644,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSchedstatParser(
+		&SchedstatTestCase{
+			name:       "large",
+			procfsRoot: procfsRoot,
+			wantSchedstat: &Schedstat{
+				Version: 15,
+				Cpu: map[int][]uint64{
+					SCHEDSTAT_CPU_ALL: {3, 66666, 33333, 18887, 9999, 346913578, 1075308, 77777},
+					0:                 {1, 22222, 11111, 9999, 5555, 123456789, 987654, 33333},
+					1:                 {2, 44444, 22222, 8888, 4444, 223456789, 87654, 44444},
+				},
+				NumCpus: 2,
+			},
+		},
+		t,
+	)
+}
@@ -0,0 +1,130 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type SlabinfoTestCase struct {
+	name          string
+	procfsRoot    string
+	primeSlabinfo *Slabinfo
+	wantSlabinfo  *Slabinfo
+	wantError     error
+}
+
+var slabinfoTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "slabinfo")
+
+var slabinfoStatName = []string{
+	"SLABINFO_ACTIVE_OBJS",
+	"SLABINFO_NUM_OBJS",
+	"SLABINFO_OBJSIZE",
+	"SLABINFO_OBJPERSLAB",
+	"SLABINFO_PAGESPERSLAB",
+	"SLABINFO_ACTIVE_SLABS",
+	"SLABINFO_NUM_SLABS",
+}
+
+func testSlabinfoParser(tc *SlabinfoTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+primeSlabinfo=%v
+`,
+		tc.name, tc.procfsRoot, (tc.primeSlabinfo != nil),
+	)
+
+	var slabinfo *Slabinfo
+	if tc.primeSlabinfo != nil {
+		slabinfo = tc.primeSlabinfo.Clone(true)
+		slabinfo.path = SlabinfoPath(tc.procfsRoot)
+	} else {
+		slabinfo = NewSlabinfo(tc.procfsRoot)
+	}
+
+	err := slabinfo.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSlabinfo := tc.wantSlabinfo
+	diffBuf := &bytes.Buffer{}
+
+	if len(wantSlabinfo.Caches) != len(slabinfo.Caches) {
+		fmt.Fprintf(diffBuf, "\nlen(Caches): want: %d, got: %d", len(wantSlabinfo.Caches), len(slabinfo.Caches))
+	} else {
+		for i, wantCache := range wantSlabinfo.Caches {
+			gotCache := slabinfo.Caches[i]
+			if wantCache.Name != gotCache.Name {
+				fmt.Fprintf(diffBuf, "\nCaches[%d].Name: want: %q, got: %q", i, wantCache.Name, gotCache.Name)
+				continue
+			}
+			for index, wantVal := range wantCache.Stats {
+				if gotVal := gotCache.Stats[index]; wantVal != gotVal {
+					fmt.Fprintf(
+						diffBuf,
+						"\nCaches[%s].Stats[%s]: want: %d, got: %d",
+						wantCache.Name, slabinfoStatName[index], wantVal, gotVal,
+					)
+				}
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestSlabinfoParser(t *testing.T) {
+	wantSlabinfo := &Slabinfo{
+		Caches: []*SlabinfoCache{
+			{Name: "ext4_groupinfo_4k", Stats: []uint64{2054, 2054, 152, 26, 1, 79, 79}},
+			{Name: "dentry", Stats: []uint64{94290, 94290, 192, 42, 2, 2245, 2245}},
+			{Name: "kmalloc-8k", Stats: []uint64{412, 432, 8192, 4, 8, 108, 108}},
+		},
+	}
+
+	for _, tc := range []*SlabinfoTestCase{
+		{
+			name:         "field_mapping",
+			procfsRoot:   path.Join(slabinfoTestDataDir, "field_mapping"),
+			wantSlabinfo: wantSlabinfo,
+		},
+		{
+			name:       "reuse",
+			procfsRoot: path.Join(slabinfoTestDataDir, "field_mapping"),
+			primeSlabinfo: &Slabinfo{
+				Caches: []*SlabinfoCache{
+					{Name: "dentry", Stats: []uint64{1, 2, 3, 4, 5, 6, 7}},
+					{Name: "inode_cache", Stats: []uint64{1, 2, 3, 4, 5, 6, 7}},
+					{Name: "kmalloc-8k", Stats: []uint64{1, 2, 3, 4, 5, 6, 7}},
+					{Name: "kmalloc-16", Stats: []uint64{1, 2, 3, 4, 5, 6, 7}},
+				},
+			},
+			wantSlabinfo: wantSlabinfo,
+		},
+		{
+			name:       "old_version",
+			procfsRoot: path.Join(slabinfoTestDataDir, "old_version"),
+			wantError: fmt.Errorf(
+				"%s:1: %q: unsupported version, want: 2.x",
+				path.Join(slabinfoTestDataDir, "old_version", "slabinfo"),
+				"slabinfo - version: 1.1",
+			),
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testSlabinfoParser(tc, t) },
+		)
+	}
+}
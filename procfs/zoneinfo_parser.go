@@ -0,0 +1,192 @@
+// parser for /proc/zoneinfo
+
+package procfs
+
+// File format (excerpt):
+//
+//  Node 0, zone      DMA
+//    per-node stats
+//        nr_inactive_anon 40164
+//        ...
+//    pages free     3840
+//          boost    0
+//          min      52
+//          low      65
+//          high     78
+//          ...
+//          managed  3840
+//          protection: (0, 3024, 4816, 4816, 4816)
+//        nr_free_pages 3840
+//        ...
+//    pagesets
+//      cpu: 0
+//                count:    0
+//                high:     0
+//                ...
+//  Node 0, zone    DMA32
+//  ...
+//
+// Only the free pages and the watermarks are retained, all in pages.
+//
+// References:
+//  https://github.com/torvalds/linux/blob/v6.8/mm/vmstat.c#L1704
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// Indexes for Stats[]:
+const (
+	ZONEINFO_FREE_PAGES = iota
+	ZONEINFO_MIN_PAGES
+	ZONEINFO_LOW_PAGES
+	ZONEINFO_HIGH_PAGES
+	ZONEINFO_MANAGED_PAGES
+
+	// Must be last!
+	ZONEINFO_NUM_STATS
+)
+
+var (
+	zoneinfoNodePrefix = []byte("Node")
+	zoneinfoZonePrefix = []byte("zone")
+	zoneinfoPagesField = []byte("pages")
+	zoneinfoFreeField  = []byte("free")
+)
+
+// Map 2 field lines, NAME VALUE, into Stats[] index:
+var zoneinfoStatsIndex = map[string]int{
+	"min":     ZONEINFO_MIN_PAGES,
+	"low":     ZONEINFO_LOW_PAGES,
+	"high":    ZONEINFO_HIGH_PAGES,
+	"managed": ZONEINFO_MANAGED_PAGES,
+}
+
+type ZoneinfoZone struct {
+	// NUMA node#:
+	Node int
+	// Zone name, e.g. DMA, DMA32, Normal:
+	Zone string
+	// Stats, indexed by ZONEINFO_...:
+	Stats []uint64
+}
+
+type Zoneinfo struct {
+	// The zones, in file order:
+	Zones []*ZoneinfoZone
+	// The path file to read:
+	path string
+}
+
+// Read the entire file in one go, using a ReadFileBufPool; the file holds
+// per CPU info for every zone so its size is unbound:
+var zoneinfoReadFileBufPool = ReadFileBufPoolReadUnbound
+
+func ZoneinfoPath(procfsRoot string) string {
+	return path.Join(procfsRoot, "zoneinfo")
+}
+
+func NewZoneinfo(procfsRoot string) *Zoneinfo {
+	return &Zoneinfo{
+		path: ZoneinfoPath(procfsRoot),
+	}
+}
+
+func (zoneinfo *Zoneinfo) Clone(full bool) *Zoneinfo {
+	newZoneinfo := &Zoneinfo{
+		path: zoneinfo.path,
+	}
+	if full {
+		newZoneinfo.Zones = make([]*ZoneinfoZone, len(zoneinfo.Zones))
+		for i, zone := range zoneinfo.Zones {
+			newZoneinfo.Zones[i] = &ZoneinfoZone{
+				Node:  zone.Node,
+				Zone:  zone.Zone,
+				Stats: make([]uint64, ZONEINFO_NUM_STATS),
+			}
+			copy(newZoneinfo.Zones[i].Stats, zone.Stats)
+		}
+	}
+	return newZoneinfo
+}
+
+func (zoneinfo *Zoneinfo) Parse() error {
+	fBuf, err := zoneinfoReadFileBufPool.ReadFile(zoneinfo.path)
+	defer zoneinfoReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	// Zones are reused in file order, they change only w/ memory hotplug:
+	numZones := 0
+	var zone *ZoneinfoZone
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Node N, zone NAME:
+		if bytes.Equal(fields[0], zoneinfoNodePrefix) {
+			if len(fields) != 4 || !bytes.Equal(fields[2], zoneinfoZonePrefix) {
+				return fmt.Errorf("%s:%d: %q: invalid line", zoneinfo.path, lineNum, line)
+			}
+			node, err := strconv.Atoi(string(bytes.TrimSuffix(fields[1], []byte{','})))
+			if err != nil || node < 0 {
+				return fmt.Errorf("%s:%d: %q: invalid node#", zoneinfo.path, lineNum, line)
+			}
+			if numZones < len(zoneinfo.Zones) {
+				zone = zoneinfo.Zones[numZones]
+				clear(zone.Stats)
+			} else {
+				zone = &ZoneinfoZone{Stats: make([]uint64, ZONEINFO_NUM_STATS)}
+				zoneinfo.Zones = append(zoneinfo.Zones, zone)
+			}
+			numZones++
+			zone.Node = node
+			if zone.Zone != string(fields[3]) {
+				zone.Zone = string(fields[3])
+			}
+			continue
+		}
+		if zone == nil {
+			continue
+		}
+
+		index := -1
+		var value []byte
+		switch {
+		case len(fields) == 3 && bytes.Equal(fields[0], zoneinfoPagesField) && bytes.Equal(fields[1], zoneinfoFreeField):
+			index, value = ZONEINFO_FREE_PAGES, fields[2]
+		case len(fields) == 2:
+			// N.B. the pagesets `high:` has a trailing colon so it will not
+			// match:
+			if i, ok := zoneinfoStatsIndex[string(fields[0])]; ok {
+				index, value = i, fields[1]
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		zone.Stats[index], err = strconv.ParseUint(string(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %q: invalid value", zoneinfo.path, lineNum, line)
+		}
+	}
+	zoneinfo.Zones = zoneinfo.Zones[:numZones]
+
+	return nil
+}
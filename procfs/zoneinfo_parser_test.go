@@ -0,0 +1,161 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+type ZoneinfoTestCase struct {
+	name          string
+	procfsRoot    string
+	primeZoneinfo *Zoneinfo
+	wantZoneinfo  *Zoneinfo
+	wantError     error
+}
+
+var zoneinfoTestDataDir = path.Join(PROCFS_TESTDATA_ROOT, "zoneinfo")
+
+var zoneinfoStatName = []string{
+	"ZONEINFO_FREE_PAGES",
+	"ZONEINFO_MIN_PAGES",
+	"ZONEINFO_LOW_PAGES",
+	"ZONEINFO_HIGH_PAGES",
+	"ZONEINFO_MANAGED_PAGES",
+}
+
+func testZoneinfoParser(tc *ZoneinfoTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+procfsRoot=%q
+primeZoneinfo=%v
+`,
+		tc.name, tc.procfsRoot, (tc.primeZoneinfo != nil),
+	)
+
+	var zoneinfo *Zoneinfo
+	if tc.primeZoneinfo != nil {
+		zoneinfo = tc.primeZoneinfo.Clone(true)
+		zoneinfo.path = ZoneinfoPath(tc.procfsRoot)
+	} else {
+		zoneinfo = NewZoneinfo(tc.procfsRoot)
+	}
+
+	err := zoneinfo.Parse()
+	if tc.wantError != nil {
+		if err == nil || tc.wantError.Error() != err.Error() {
+			t.Fatalf("want: %v error, got: %v", tc.wantError, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantZoneinfo := tc.wantZoneinfo
+	diffBuf := &bytes.Buffer{}
+
+	if len(wantZoneinfo.Zones) != len(zoneinfo.Zones) {
+		fmt.Fprintf(diffBuf, "\nlen(Zones): want: %d, got: %d", len(wantZoneinfo.Zones), len(zoneinfo.Zones))
+	} else {
+		for i, wantZone := range wantZoneinfo.Zones {
+			gotZone := zoneinfo.Zones[i]
+			if wantZone.Node != gotZone.Node || wantZone.Zone != gotZone.Zone {
+				fmt.Fprintf(
+					diffBuf,
+					"\nZones[%d]: want: node=%d, zone=%s, got: node=%d, zone=%s",
+					i, wantZone.Node, wantZone.Zone, gotZone.Node, gotZone.Zone,
+				)
+				continue
+			}
+			for index, wantVal := range wantZone.Stats {
+				if gotVal := gotZone.Stats[index]; wantVal != gotVal {
+					fmt.Fprintf(
+						diffBuf,
+						"\nZones[%d].Stats[%s]: want: %d, got: %d",
+						i, zoneinfoStatName[index], wantVal, gotVal,
+					)
+				}
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+var zoneinfoFieldMappingWant = &Zoneinfo{
+	Zones: []*ZoneinfoZone{
+		{Node: 0, Zone: "DMA", Stats: []uint64{3840, 52, 65, 78, 3840}},
+		{Node: 0, Zone: "Normal", Stats: []uint64{123456, 10577, 13221, 15865, 1020000}},
+		{Node: 0, Zone: "Movable", Stats: []uint64{0, 0, 0, 0, 0}},
+	},
+}
+
+func TestZoneinfoParser(t *testing.T) {
+	wantZoneinfo := zoneinfoFieldMappingWant
+
+	for _, tc := range []*ZoneinfoTestCase{
+		{
+			name:         "field_mapping",
+			procfsRoot:   path.Join(zoneinfoTestDataDir, "field_mapping"),
+			wantZoneinfo: wantZoneinfo,
+		},
+		{
+			name:       "reuse",
+			procfsRoot: path.Join(zoneinfoTestDataDir, "field_mapping"),
+			primeZoneinfo: &Zoneinfo{
+				Zones: []*ZoneinfoZone{
+					{Node: 1, Zone: "Normal", Stats: []uint64{1, 2, 3, 4, 5}},
+					{Node: 2, Zone: "Normal", Stats: []uint64{1, 2, 3, 4, 5}},
+					{Node: 3, Zone: "Normal", Stats: []uint64{1, 2, 3, 4, 5}},
+					{Node: 4, Zone: "Normal", Stats: []uint64{1, 2, 3, 4, 5}},
+				},
+			},
+			wantZoneinfo: wantZoneinfo,
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testZoneinfoParser(tc, t) },
+		)
+	}
+}
+
+func TestZoneinfoParserLarge(t *testing.T) {
+	// Emulate a large host by repeating the per CPU pagesets for every zone,
+	// such that the file exceeds the largest bounded read buffer:
+	content, err := os.ReadFile(ZoneinfoPath(path.Join(zoneinfoTestDataDir, "field_mapping")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pagesetsLine := []byte("  pagesets\n")
+	cpuPagesets := &bytes.Buffer{}
+	for cpu := 0; cpuPagesets.Len() <= 0x100000; cpu++ {
+		fmt.Fprintf(
+			cpuPagesets,
+			"    cpu: %d\n              count:    0\n              high:     0\n              batch:    1\n",
+			cpu,
+		)
+	}
+	procfsRoot := t.TempDir()
+	err = os.WriteFile(
+		ZoneinfoPath(procfsRoot),
+		bytes.ReplaceAll(content, pagesetsLine, append(pagesetsLine, cpuPagesets.Bytes()...)),
+		0644,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testZoneinfoParser(
+		&ZoneinfoTestCase{
+			name:         "large",
+			procfsRoot:   procfsRoot,
+			wantZoneinfo: zoneinfoFieldMappingWant,
+		},
+		t,
+	)
+}
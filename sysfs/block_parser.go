@@ -0,0 +1,159 @@
+// parser for /sys/block/DEV attributes
+
+package sysfs
+
+// The files of interest:
+//
+//  /sys/block/dm-0/
+//      dev: 253:0
+//      size: 41934848
+//      dm/name: vg0-root
+//      dm/uuid: LVM-...
+//      holders/
+//      slaves/
+//          sda3 -> ../../../../pci0000:00/.../block/sda/sda3
+//      queue/
+//          rotational: 0
+//          scheduler: [none] mq-deadline
+//          nr_requests: 256
+//          logical_block_size: 512
+//          physical_block_size: 4096
+//      device/
+//          model: Samsung SSD 980 PRO 1TB
+//          serial: S5GXNX0T123456
+//
+// The size is in 512 byte sectors, regardless of the block size. Block device
+// names containing `/', e.g. `cciss/c0d0', have it replaced by `!' in sysfs.
+//
+// References:
+//  https://www.kernel.org/doc/Documentation/ABI/stable/sysfs-block
+//  https://www.kernel.org/doc/Documentation/block/queue-sysfs.rst
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	BLOCK_SECTOR_SIZE = 512
+)
+
+type BlockDev struct {
+	// The device name, as it appears in /proc/diskstats:
+	Name string
+	// major:minor, as read from dev attribute:
+	MajMin string
+	// Device mapper name and UUID, empty if not applicable:
+	DmName, DmUuid string
+	// The names of the devices built on top of (holders) and underneath
+	// (slaves) this device, sorted:
+	Holders, Slaves []string
+	// Queue attributes, -1 if unknown:
+	Rotational, NrRequests, LogicalBlockSize, PhysicalBlockSize int64
+	// The active I/O scheduler, i.e. the one in [], empty if unknown:
+	Scheduler string
+	// Size in bytes, -1 if unknown:
+	SizeBytes int64
+	// Model and serial, empty if unknown:
+	Model, Serial string
+	// The path of the device dir:
+	path string
+}
+
+func BlockPath(sysfsRoot string) string {
+	return path.Join(sysfsRoot, "block")
+}
+
+func NewBlockDev(sysfsRoot string, name string) *BlockDev {
+	return &BlockDev{
+		Name: name,
+		path: path.Join(BlockPath(sysfsRoot), strings.ReplaceAll(name, "/", "!")),
+	}
+}
+
+// Return the list of the entries in a dir, sorted by name as per os.ReadDir,
+// nil if the dir cannot be read or it is empty:
+func readDirNames(dirPath string) []string {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
+
+// Extract the active scheduler from a `[none] mq-deadline' like list:
+func parseActiveScheduler(schedulerList string) string {
+	start := strings.IndexByte(schedulerList, '[')
+	if start < 0 {
+		// Single scheduler, e.g. `none':
+		if strings.IndexByte(schedulerList, ' ') < 0 {
+			return schedulerList
+		}
+		return ""
+	}
+	end := strings.IndexByte(schedulerList[start:], ']')
+	if end < 0 {
+		return ""
+	}
+	return schedulerList[start+1 : start+end]
+}
+
+// Read the attributes. The only error condition is if the device dir doesn't
+// exist (i.e. dev cannot be read), all other attributes are optional:
+func (blockDev *BlockDev) Parse() error {
+	var err error
+
+	if blockDev.MajMin, err = ReadAttribute(path.Join(blockDev.path, "dev")); err != nil {
+		return err
+	}
+
+	if blockDev.DmName, err = ReadAttribute(path.Join(blockDev.path, "dm", "name")); err != nil {
+		blockDev.DmName = ""
+	}
+	if blockDev.DmUuid, err = ReadAttribute(path.Join(blockDev.path, "dm", "uuid")); err != nil {
+		blockDev.DmUuid = ""
+	}
+
+	blockDev.Holders = readDirNames(path.Join(blockDev.path, "holders"))
+	blockDev.Slaves = readDirNames(path.Join(blockDev.path, "slaves"))
+
+	queuePath := path.Join(blockDev.path, "queue")
+	for _, attr := range []struct {
+		name string
+		val  *int64
+	}{
+		{"rotational", &blockDev.Rotational},
+		{"nr_requests", &blockDev.NrRequests},
+		{"logical_block_size", &blockDev.LogicalBlockSize},
+		{"physical_block_size", &blockDev.PhysicalBlockSize},
+	} {
+		if *attr.val, err = ReadIntAttribute(path.Join(queuePath, attr.name)); err != nil {
+			*attr.val = -1
+		}
+	}
+	if schedulerList, err := ReadAttribute(path.Join(queuePath, "scheduler")); err == nil {
+		blockDev.Scheduler = parseActiveScheduler(schedulerList)
+	} else {
+		blockDev.Scheduler = ""
+	}
+
+	if size, err := ReadIntAttribute(path.Join(blockDev.path, "size")); err == nil {
+		blockDev.SizeBytes = size * BLOCK_SECTOR_SIZE
+	} else {
+		blockDev.SizeBytes = -1
+	}
+
+	if blockDev.Model, err = ReadAttribute(path.Join(blockDev.path, "device", "model")); err != nil {
+		blockDev.Model = ""
+	}
+	if blockDev.Serial, err = ReadAttribute(path.Join(blockDev.path, "device", "serial")); err != nil {
+		blockDev.Serial = ""
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package sysfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/testutils"
+)
+
+type BlockDevTestCase struct {
+	name         string
+	sysfsRoot    string
+	dev          string
+	wantErr      bool
+	wantBlockDev *BlockDev
+}
+
+var blockDevTestDataDir = path.Join(SYSFS_TESTDATA_ROOT, "block")
+
+func testBlockDevParser(tc *BlockDevTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+sysfsRoot=%q
+dev=%q
+`,
+		tc.name, tc.sysfsRoot, tc.dev,
+	)
+
+	blockDev := NewBlockDev(tc.sysfsRoot, tc.dev)
+	err := blockDev.Parse()
+	if tc.wantErr {
+		if err == nil {
+			t.Fatal("want error, got nil")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+	want, got := tc.wantBlockDev, blockDev
+	for _, s := range []struct {
+		name      string
+		want, got string
+	}{
+		{"MajMin", want.MajMin, got.MajMin},
+		{"DmName", want.DmName, got.DmName},
+		{"DmUuid", want.DmUuid, got.DmUuid},
+		{"Scheduler", want.Scheduler, got.Scheduler},
+		{"Model", want.Model, got.Model},
+		{"Serial", want.Serial, got.Serial},
+	} {
+		if s.want != s.got {
+			fmt.Fprintf(diffBuf, "\n%s: want: %q, got: %q", s.name, s.want, s.got)
+		}
+	}
+	for _, i := range []struct {
+		name      string
+		want, got int64
+	}{
+		{"Rotational", want.Rotational, got.Rotational},
+		{"NrRequests", want.NrRequests, got.NrRequests},
+		{"LogicalBlockSize", want.LogicalBlockSize, got.LogicalBlockSize},
+		{"PhysicalBlockSize", want.PhysicalBlockSize, got.PhysicalBlockSize},
+		{"SizeBytes", want.SizeBytes, got.SizeBytes},
+	} {
+		if i.want != i.got {
+			fmt.Fprintf(diffBuf, "\n%s: want: %d, got: %d", i.name, i.want, i.got)
+		}
+	}
+	testutils.CompareSlices(want.Holders, got.Holders, "Holders", diffBuf)
+	testutils.CompareSlices(want.Slaves, got.Slaves, "Slaves", diffBuf)
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestBlockDevParser(t *testing.T) {
+	sysfsRoot := path.Join(blockDevTestDataDir, "field_mapping")
+	for _, tc := range []*BlockDevTestCase{
+		{
+			name:      "sda",
+			sysfsRoot: sysfsRoot,
+			dev:       "sda",
+			wantBlockDev: &BlockDev{
+				MajMin:            "8:0",
+				Holders:           []string{"dm-0"},
+				Rotational:        1,
+				NrRequests:        64,
+				LogicalBlockSize:  512,
+				PhysicalBlockSize: 4096,
+				Scheduler:         "mq-deadline",
+				SizeBytes:         1953525168 * 512,
+				Model:             "ST1000DM010-2EP1",
+			},
+		},
+		{
+			name:      "nvme0n1",
+			sysfsRoot: sysfsRoot,
+			dev:       "nvme0n1",
+			wantBlockDev: &BlockDev{
+				MajMin:            "259:0",
+				Rotational:        0,
+				NrRequests:        1023,
+				LogicalBlockSize:  512,
+				PhysicalBlockSize: 512,
+				Scheduler:         "none",
+				SizeBytes:         2000409264 * 512,
+				Model:             "Samsung SSD 980 PRO 1TB",
+				Serial:            "S5GXNX0T123456",
+			},
+		},
+		{
+			name:      "dm-0",
+			sysfsRoot: sysfsRoot,
+			dev:       "dm-0",
+			wantBlockDev: &BlockDev{
+				MajMin:            "253:0",
+				DmName:            "vg0-root",
+				DmUuid:            "LVM-0123456789abcdef",
+				Slaves:            []string{"sda"},
+				Rotational:        1,
+				NrRequests:        -1,
+				LogicalBlockSize:  512,
+				PhysicalBlockSize: 4096,
+				Scheduler:         "none",
+				SizeBytes:         41934848 * 512,
+			},
+		},
+		{
+			name:      "slash_in_name",
+			sysfsRoot: sysfsRoot,
+			dev:       "cciss/c0d0",
+			wantBlockDev: &BlockDev{
+				MajMin:            "104:0",
+				Rotational:        -1,
+				NrRequests:        -1,
+				LogicalBlockSize:  -1,
+				PhysicalBlockSize: -1,
+				SizeBytes:         100 * 512,
+			},
+		},
+		{
+			name:      "partition",
+			sysfsRoot: sysfsRoot,
+			dev:       "sda1",
+			wantErr:   true,
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testBlockDevParser(tc, t) },
+		)
+	}
+}
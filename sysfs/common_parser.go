@@ -0,0 +1,77 @@
+// Common definitions for all sysfs parsers
+
+package sysfs
+
+import (
+	"fmt"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/utils"
+)
+
+// Most sysfs attributes are single value files, at most PAGE_SIZE in length:
+var ReadFileBufPool4k = utils.NewReadFileBufPool(32, 0x1000)
+
+var isWhitespaceNl = [256]bool{
+	' ':  true,
+	'\t': true,
+	'\n': true,
+}
+
+// Read an attribute file and return its content, stripped of leading and
+// trailing whitespaces:
+func ReadAttribute(filePath string) (string, error) {
+	fBuf, err := ReadFileBufPool4k.ReadFile(filePath)
+	defer ReadFileBufPool4k.ReturnBuf(fBuf)
+	if err != nil {
+		return "", err
+	}
+	buf := fBuf.Bytes()
+	start, end := 0, len(buf)
+	for ; start < end && isWhitespaceNl[buf[start]]; start++ {
+	}
+	for ; end > start && isWhitespaceNl[buf[end-1]]; end-- {
+	}
+	return string(buf[start:end]), nil
+}
+
+// Read an attribute file consisting of a signed decimal integer:
+func ReadIntAttribute(filePath string) (int64, error) {
+	fBuf, err := ReadFileBufPool4k.ReadFile(filePath)
+	defer ReadFileBufPool4k.ReturnBuf(fBuf)
+	if err != nil {
+		return 0, err
+	}
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	pos := 0
+	for ; pos < l && isWhitespaceNl[buf[pos]]; pos++ {
+	}
+	negative := pos < l && buf[pos] == '-'
+	if negative {
+		pos++
+	}
+	value, hasValue := int64(0), false
+	for ; pos < l; pos++ {
+		c := buf[pos]
+		if digit := c - '0'; digit < 10 {
+			value = (value << 3) + (value << 1) + int64(digit)
+			hasValue = true
+		} else if isWhitespaceNl[c] {
+			break
+		} else {
+			return 0, fmt.Errorf("%s: %q: invalid value", filePath, buf)
+		}
+	}
+	for ; pos < l; pos++ {
+		if !isWhitespaceNl[buf[pos]] {
+			return 0, fmt.Errorf("%s: %q: invalid value", filePath, buf)
+		}
+	}
+	if !hasValue {
+		return 0, fmt.Errorf("%s: %q: missing value", filePath, buf)
+	}
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
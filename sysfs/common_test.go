@@ -0,0 +1,7 @@
+// Definitions common to all tests:
+
+package sysfs
+
+const (
+	SYSFS_TESTDATA_ROOT = "../testdata/sysfs"
+)
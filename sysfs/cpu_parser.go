@@ -0,0 +1,224 @@
+// parser for /sys/devices/system/cpu/{online,cpu*/cpufreq,cpu*/cpuidle}
+
+package sysfs
+
+// The files of interest:
+//
+//  /sys/devices/system/cpu/
+//      online: 0-3,6
+//      cpu0/cpufreq/
+//          scaling_cur_freq: 2400000
+//          scaling_min_freq: 800000
+//          scaling_max_freq: 3600000
+//      cpu0/cpuidle/
+//          state0/
+//              name: POLL
+//              time: 12345
+//              usage: 67
+//
+// The frequencies are in kHz, the idle time in microseconds. Both cpufreq and
+// cpuidle may be missing (e.g. VMs or disabled drivers), in which case the
+// corresponding info is not available for that CPU.
+//
+// The CPU info, including the idle state names, is discovered the first time
+// a CPU is found online; CPUs going offline are removed. The counters are
+// read at every Parse().
+//
+// References:
+//  https://www.kernel.org/doc/html/latest/admin-guide/cputopology.html
+//  https://www.kernel.org/doc/html/latest/admin-guide/pm/cpufreq.html
+//  https://www.kernel.org/doc/html/latest/admin-guide/pm/cpuidle.html
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type CpuIdleState struct {
+	// The state<N> dir name:
+	State string
+	// The content of the name file, e.g. POLL, C1, C1E:
+	Name string
+	// Cumulative time spent in this state, in microseconds, and number of
+	// times the state was entered:
+	Time, Usage uint64
+	// Whether the counters were successfully read or not:
+	Valid bool
+	// Used for sorting:
+	index int
+	// The counter files:
+	timePath, usagePath string
+}
+
+type CpuFreqIdleCpu struct {
+	// CPU#:
+	Cpu int
+	// Scaling frequencies, in kHz, and whether they were successfully read or
+	// not. Not all cpufreq drivers provide scaling_cur_freq:
+	CurFreq, MinFreq, MaxFreq int64
+	FreqValid                 bool
+	// Idle states, sorted by N:
+	IdleStates []*CpuIdleState
+	// The cpufreq files:
+	curFreqPath, minFreqPath, maxFreqPath string
+}
+
+type CpuFreqIdle struct {
+	// The sorted list of online CPUs, as of the most recent Parse():
+	Online []int
+	// Per CPU# info, for online CPUs only:
+	Cpus map[int]*CpuFreqIdleCpu
+	// The path of the cpu dir:
+	path string
+	// The path of the online file:
+	onlinePath string
+}
+
+func CpuFreqIdlePath(sysfsRoot string) string {
+	return path.Join(sysfsRoot, "devices", "system", "cpu")
+}
+
+func NewCpuFreqIdle(sysfsRoot string) *CpuFreqIdle {
+	cpuPath := CpuFreqIdlePath(sysfsRoot)
+	return &CpuFreqIdle{
+		Online:     make([]int, 0),
+		Cpus:       make(map[int]*CpuFreqIdleCpu),
+		path:       cpuPath,
+		onlinePath: path.Join(cpuPath, "online"),
+	}
+}
+
+// Parse a CPU list, as found in .../cpu/online, e.g. "0-3,6", into a sorted
+// list of CPU#. The result is appended to the list passed as an argument:
+func ParseCpuList(cpuList string, cpus []int) ([]int, error) {
+	for _, cpuRange := range strings.Split(cpuList, ",") {
+		cpuRange = strings.TrimSpace(cpuRange)
+		if cpuRange == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(cpuRange, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid CPU list", cpuList)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return nil, fmt.Errorf("%q: invalid CPU list", cpuList)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+func (cpuFreqIdle *CpuFreqIdle) discoverCpu(cpu int) *CpuFreqIdleCpu {
+	cpuDir := path.Join(cpuFreqIdle.path, "cpu"+strconv.Itoa(cpu))
+	cpufreqDir := path.Join(cpuDir, "cpufreq")
+	cpuInfo := &CpuFreqIdleCpu{
+		Cpu:         cpu,
+		IdleStates:  make([]*CpuIdleState, 0),
+		curFreqPath: path.Join(cpufreqDir, "scaling_cur_freq"),
+		minFreqPath: path.Join(cpufreqDir, "scaling_min_freq"),
+		maxFreqPath: path.Join(cpufreqDir, "scaling_max_freq"),
+	}
+
+	cpuidleDir := path.Join(cpuDir, "cpuidle")
+	entries, err := os.ReadDir(cpuidleDir)
+	if err != nil {
+		// No cpuidle for this CPU:
+		return cpuInfo
+	}
+	for _, entry := range entries {
+		stateName := entry.Name()
+		if !strings.HasPrefix(stateName, "state") {
+			continue
+		}
+		index, err := strconv.Atoi(stateName[len("state"):])
+		if err != nil {
+			continue
+		}
+		stateDir := path.Join(cpuidleDir, stateName)
+		idleState := &CpuIdleState{
+			State:     stateName,
+			index:     index,
+			timePath:  path.Join(stateDir, "time"),
+			usagePath: path.Join(stateDir, "usage"),
+		}
+		if idleState.Name, err = ReadAttribute(path.Join(stateDir, "name")); err != nil {
+			idleState.Name = ""
+		}
+		cpuInfo.IdleStates = append(cpuInfo.IdleStates, idleState)
+	}
+	sort.Slice(cpuInfo.IdleStates, func(i, j int) bool {
+		return cpuInfo.IdleStates[i].index < cpuInfo.IdleStates[j].index
+	})
+	return cpuInfo
+}
+
+// Read the online CPU list, update the per CPU info accordingly and read the
+// frequencies and the idle state counters:
+func (cpuFreqIdle *CpuFreqIdle) Parse() error {
+	cpuList, err := ReadAttribute(cpuFreqIdle.onlinePath)
+	if err != nil {
+		return err
+	}
+	online, err := ParseCpuList(cpuList, cpuFreqIdle.Online[:0])
+	if err != nil {
+		return fmt.Errorf("%s: %v", cpuFreqIdle.onlinePath, err)
+	}
+	cpuFreqIdle.Online = online
+
+	// CPU's may be unplugged dynamically; remove out-of-scope CPUs:
+	if len(cpuFreqIdle.Cpus) > 0 {
+		onlineSet := make(map[int]bool, len(online))
+		for _, cpu := range online {
+			onlineSet[cpu] = true
+		}
+		for cpu := range cpuFreqIdle.Cpus {
+			if !onlineSet[cpu] {
+				delete(cpuFreqIdle.Cpus, cpu)
+			}
+		}
+	}
+
+	for _, cpu := range online {
+		cpuInfo := cpuFreqIdle.Cpus[cpu]
+		if cpuInfo == nil {
+			cpuInfo = cpuFreqIdle.discoverCpu(cpu)
+			cpuFreqIdle.Cpus[cpu] = cpuInfo
+		}
+
+		cpuInfo.CurFreq, err = ReadIntAttribute(cpuInfo.curFreqPath)
+		cpuInfo.FreqValid = err == nil
+		if cpuInfo.FreqValid {
+			if cpuInfo.MinFreq, err = ReadIntAttribute(cpuInfo.minFreqPath); err != nil {
+				cpuInfo.MinFreq = 0
+			}
+			if cpuInfo.MaxFreq, err = ReadIntAttribute(cpuInfo.maxFreqPath); err != nil {
+				cpuInfo.MaxFreq = 0
+			}
+		}
+
+		for _, idleState := range cpuInfo.IdleStates {
+			var val int64
+			val, err = ReadIntAttribute(idleState.timePath)
+			idleState.Valid = err == nil
+			if idleState.Valid {
+				idleState.Time = uint64(val)
+				val, err = ReadIntAttribute(idleState.usagePath)
+				idleState.Valid = err == nil
+				idleState.Usage = uint64(val)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package sysfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type CpuListTestCase struct {
+	cpuList  string
+	wantCpus []int
+	wantErr  bool
+}
+
+type CpuFreqIdleTestCase struct {
+	name       string
+	sysfsRoot  string
+	wantOnline []int
+	wantCpus   []*CpuFreqIdleCpu
+}
+
+var cpuFreqIdleTestDataDir = path.Join(SYSFS_TESTDATA_ROOT, "cpu")
+
+func TestParseCpuList(t *testing.T) {
+	for _, tc := range []*CpuListTestCase{
+		{"0", []int{0}, false},
+		{"0-3", []int{0, 1, 2, 3}, false},
+		{"0-1,3,6-7", []int{0, 1, 3, 6, 7}, false},
+		{"6-7,0", []int{0, 6, 7}, false},
+		{"", []int{}, false},
+		{"0-", nil, true},
+		{"3-1", nil, true},
+		{"x", nil, true},
+	} {
+		t.Run(
+			tc.cpuList,
+			func(t *testing.T) {
+				gotCpus, err := ParseCpuList(tc.cpuList, make([]int, 0))
+				if tc.wantErr {
+					if err == nil {
+						t.Fatalf("want error, got: %v", gotCpus)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(tc.wantCpus) != fmt.Sprint(gotCpus) {
+					t.Fatalf("want: %v, got: %v", tc.wantCpus, gotCpus)
+				}
+			},
+		)
+	}
+}
+
+func testCpuFreqIdleParser(tc *CpuFreqIdleTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+sysfsRoot=%q
+`,
+		tc.name, tc.sysfsRoot,
+	)
+
+	cpuFreqIdle := NewCpuFreqIdle(tc.sysfsRoot)
+	// Parse twice to verify that the reuse of the objects works as expected:
+	for k := 0; k < 2; k++ {
+		if err := cpuFreqIdle.Parse(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	if fmt.Sprint(tc.wantOnline) != fmt.Sprint(cpuFreqIdle.Online) {
+		fmt.Fprintf(diffBuf, "\nOnline: want: %v, got: %v", tc.wantOnline, cpuFreqIdle.Online)
+	}
+	if len(tc.wantCpus) != len(cpuFreqIdle.Cpus) {
+		fmt.Fprintf(diffBuf, "\nlen(Cpus): want: %d, got: %d", len(tc.wantCpus), len(cpuFreqIdle.Cpus))
+	}
+	for _, wantCpu := range tc.wantCpus {
+		gotCpu := cpuFreqIdle.Cpus[wantCpu.Cpu]
+		if gotCpu == nil {
+			fmt.Fprintf(diffBuf, "\nCpus[%d]: missing", wantCpu.Cpu)
+			continue
+		}
+		if wantCpu.FreqValid != gotCpu.FreqValid {
+			fmt.Fprintf(diffBuf, "\nCpus[%d].FreqValid: want: %v, got: %v", wantCpu.Cpu, wantCpu.FreqValid, gotCpu.FreqValid)
+		}
+		if wantCpu.FreqValid &&
+			(wantCpu.CurFreq != gotCpu.CurFreq ||
+				wantCpu.MinFreq != gotCpu.MinFreq ||
+				wantCpu.MaxFreq != gotCpu.MaxFreq) {
+			fmt.Fprintf(
+				diffBuf,
+				"\nCpus[%d]: Cur/Min/MaxFreq: want: %d/%d/%d, got: %d/%d/%d",
+				wantCpu.Cpu,
+				wantCpu.CurFreq, wantCpu.MinFreq, wantCpu.MaxFreq,
+				gotCpu.CurFreq, gotCpu.MinFreq, gotCpu.MaxFreq,
+			)
+		}
+		if len(wantCpu.IdleStates) != len(gotCpu.IdleStates) {
+			fmt.Fprintf(
+				diffBuf, "\nlen(Cpus[%d].IdleStates): want: %d, got: %d",
+				wantCpu.Cpu, len(wantCpu.IdleStates), len(gotCpu.IdleStates),
+			)
+			continue
+		}
+		for j, wantIdleState := range wantCpu.IdleStates {
+			gotIdleState := gotCpu.IdleStates[j]
+			if wantIdleState.State != gotIdleState.State ||
+				wantIdleState.Name != gotIdleState.Name ||
+				wantIdleState.Time != gotIdleState.Time ||
+				wantIdleState.Usage != gotIdleState.Usage ||
+				wantIdleState.Valid != gotIdleState.Valid {
+				fmt.Fprintf(
+					diffBuf,
+					"\nCpus[%d].IdleStates[%d]:\n\twant: {State: %q, Name: %q, Time: %d, Usage: %d, Valid: %v}\n\t got: {State: %q, Name: %q, Time: %d, Usage: %d, Valid: %v}",
+					wantCpu.Cpu, j,
+					wantIdleState.State, wantIdleState.Name, wantIdleState.Time, wantIdleState.Usage, wantIdleState.Valid,
+					gotIdleState.State, gotIdleState.Name, gotIdleState.Time, gotIdleState.Usage, gotIdleState.Valid,
+				)
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestCpuFreqIdleParser(t *testing.T) {
+	for _, tc := range []*CpuFreqIdleTestCase{
+		{
+			name:       "field_mapping",
+			sysfsRoot:  path.Join(cpuFreqIdleTestDataDir, "field_mapping"),
+			wantOnline: []int{0, 1, 3},
+			wantCpus: []*CpuFreqIdleCpu{
+				{
+					Cpu:       0,
+					CurFreq:   2400000,
+					MinFreq:   800000,
+					MaxFreq:   3600000,
+					FreqValid: true,
+					IdleStates: []*CpuIdleState{
+						{State: "state0", Name: "POLL", Time: 1000, Usage: 10, Valid: true},
+						{State: "state1", Name: "C1", Time: 2000000, Usage: 200, Valid: true},
+						{State: "state2", Name: "C6", Time: 3000000, Usage: 30, Valid: true},
+					},
+				},
+				{
+					Cpu:       1,
+					CurFreq:   1200000,
+					MinFreq:   800000,
+					MaxFreq:   3600000,
+					FreqValid: true,
+					IdleStates: []*CpuIdleState{
+						{State: "state0", Name: "POLL", Time: 1100, Usage: 11, Valid: true},
+						{State: "state1", Name: "C1", Time: 2100000, Usage: 210, Valid: true},
+						{State: "state2", Name: "C6", Time: 3100000, Usage: 31, Valid: true},
+					},
+				},
+				{
+					Cpu:       3,
+					FreqValid: false,
+					IdleStates: []*CpuIdleState{
+						{State: "state0", Name: "POLL", Time: 1300, Usage: 13, Valid: true},
+						{State: "state1", Name: "C1", Time: 2300000, Usage: 230, Valid: true},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testCpuFreqIdleParser(tc, t) },
+		)
+	}
+}
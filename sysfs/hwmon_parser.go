@@ -0,0 +1,207 @@
+// parser for /sys/class/hwmon/hwmon*
+
+package sysfs
+
+// Each hwmon device is a directory with a name file and sensor files named
+// TYPE<N>_ATTR, e.g.:
+//
+//  /sys/class/hwmon/hwmon1/
+//      device -> ../../../coretemp.0
+//      name: coretemp
+//      temp1_input: 45000
+//      temp1_label: Package id 0
+//
+// Only the TYPE<N>_input files for the types of interest are discovered and
+// they are read at every Parse(). The values are as reported by the kernel:
+//  temp:  millidegree Celsius
+//  fan:   RPM
+//  in:    millivolt
+//  power: microwatt
+//
+// References:
+//  https://www.kernel.org/doc/html/latest/hwmon/sysfs-interface.html
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sensor types:
+const (
+	HWMON_SENSOR_TEMP = iota
+	HWMON_SENSOR_FAN
+	HWMON_SENSOR_IN
+	HWMON_SENSOR_POWER
+
+	// Must be last:
+	HWMON_SENSOR_NUM_TYPES
+)
+
+// The file name prefix for each sensor type:
+var HwmonSensorTypePrefix = [HWMON_SENSOR_NUM_TYPES]string{
+	HWMON_SENSOR_TEMP:  "temp",
+	HWMON_SENSOR_FAN:   "fan",
+	HWMON_SENSOR_IN:    "in",
+	HWMON_SENSOR_POWER: "power",
+}
+
+var hwmonSensorInputFileRe = regexp.MustCompile(`^(temp|fan|in|power)(\d+)_input$`)
+
+type HwmonSensor struct {
+	// HWMON_SENSOR_...:
+	Type int
+	// The sensor name, i.e. TYPE<N>, e.g. temp1:
+	Name string
+	// The content of TYPE<N>_label if present, the name otherwise:
+	Label string
+	// The most recent value and whether it was successfully read or not. Some
+	// sensors may temporarily fail to return a value (e.g. disconnected fan),
+	// which should not be treated as an error:
+	Value int64
+	Valid bool
+	// Used for sorting:
+	index int
+	// TYPE<N>_input:
+	inputPath string
+}
+
+type HwmonChip struct {
+	// The hwmon<N> dir name:
+	Hwmon string
+	// The content of the name file:
+	Name string
+	// The device path, relative to sysfs root, with a leading `/', as pointed
+	// to by the device symlink, e.g. /devices/platform/coretemp.0. Virtual
+	// devices may lack such a link, in which case the path is empty:
+	Device string
+	// Sensors, sorted by type, N:
+	Sensors []*HwmonSensor
+}
+
+type Hwmon struct {
+	// Chips, sorted by hwmon<N>:
+	Chips []*HwmonChip
+	// sysfs root, needed for device path resolution:
+	sysfsRoot string
+	// The path of the hwmon class dir:
+	path string
+}
+
+func HwmonPath(sysfsRoot string) string {
+	return path.Join(sysfsRoot, "class", "hwmon")
+}
+
+func NewHwmon(sysfsRoot string) *Hwmon {
+	return &Hwmon{
+		Chips:     make([]*HwmonChip, 0),
+		sysfsRoot: sysfsRoot,
+		path:      HwmonPath(sysfsRoot),
+	}
+}
+
+// Resolve the device symlink of a sysfs dir into a path relative to the sysfs
+// root, w/ a leading `/'. Return "" if the dir has no device symlink or if it
+// cannot be resolved:
+func resolveDevicePath(sysfsRoot, dirPath string) string {
+	realDevPath, err := filepath.EvalSymlinks(path.Join(dirPath, "device"))
+	if err != nil {
+		return ""
+	}
+	realSysfsRoot, err := filepath.EvalSymlinks(sysfsRoot)
+	if err != nil {
+		return ""
+	}
+	relPath, err := filepath.Rel(realSysfsRoot, realDevPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return ""
+	}
+	return "/" + filepath.ToSlash(relPath)
+}
+
+// Discover the hwmon devices and their sensors. This is a relatively expensive
+// operation and it should be invoked only every so often. A missing hwmon
+// class dir is not an error, it simply results in no chips.
+func (hwmon *Hwmon) Discover() error {
+	hwmon.Chips = hwmon.Chips[:0]
+
+	entries, err := os.ReadDir(hwmon.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		hwmonName := entry.Name()
+		if !strings.HasPrefix(hwmonName, "hwmon") {
+			continue
+		}
+		chipDir := path.Join(hwmon.path, hwmonName)
+		chipFiles, err := os.ReadDir(chipDir)
+		if err != nil {
+			// The device may have been removed in the meantime:
+			continue
+		}
+		chip := &HwmonChip{
+			Hwmon:   hwmonName,
+			Device:  resolveDevicePath(hwmon.sysfsRoot, chipDir),
+			Sensors: make([]*HwmonSensor, 0),
+		}
+		if chip.Name, err = ReadAttribute(path.Join(chipDir, "name")); err != nil || chip.Name == "" {
+			chip.Name = hwmonName
+		}
+		for _, chipFile := range chipFiles {
+			m := hwmonSensorInputFileRe.FindStringSubmatch(chipFile.Name())
+			if m == nil {
+				continue
+			}
+			sensor := &HwmonSensor{
+				Name:      m[1] + m[2],
+				inputPath: path.Join(chipDir, chipFile.Name()),
+			}
+			for sensorType, prefix := range HwmonSensorTypePrefix {
+				if prefix == m[1] {
+					sensor.Type = sensorType
+					break
+				}
+			}
+			sensor.index, _ = strconv.Atoi(m[2])
+			if sensor.Label, err = ReadAttribute(path.Join(chipDir, sensor.Name+"_label")); err != nil || sensor.Label == "" {
+				sensor.Label = sensor.Name
+			}
+			chip.Sensors = append(chip.Sensors, sensor)
+		}
+		sort.Slice(chip.Sensors, func(i, j int) bool {
+			si, sj := chip.Sensors[i], chip.Sensors[j]
+			return si.Type < sj.Type || si.Type == sj.Type && si.index < sj.index
+		})
+		hwmon.Chips = append(hwmon.Chips, chip)
+	}
+
+	sort.Slice(hwmon.Chips, func(i, j int) bool {
+		ci, cj := hwmon.Chips[i].Hwmon, hwmon.Chips[j].Hwmon
+		return len(ci) < len(cj) || len(ci) == len(cj) && ci < cj
+	})
+
+	return nil
+}
+
+// Read the sensor values for the discovered chips:
+func (hwmon *Hwmon) Parse() error {
+	var err error
+	for _, chip := range hwmon.Chips {
+		for _, sensor := range chip.Sensors {
+			sensor.Value, err = ReadIntAttribute(sensor.inputPath)
+			sensor.Valid = err == nil
+		}
+	}
+	return nil
+}
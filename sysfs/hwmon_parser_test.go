@@ -0,0 +1,130 @@
+package sysfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type HwmonTestCase struct {
+	name      string
+	sysfsRoot string
+	wantChips []*HwmonChip
+}
+
+var hwmonTestDataDir = path.Join(SYSFS_TESTDATA_ROOT, "hwmon")
+
+func testHwmonParser(tc *HwmonTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+sysfsRoot=%q
+`,
+		tc.name, tc.sysfsRoot,
+	)
+
+	hwmon := NewHwmon(tc.sysfsRoot)
+	err := hwmon.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hwmon.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	if len(tc.wantChips) != len(hwmon.Chips) {
+		t.Fatalf("len(Chips): want: %d, got: %d", len(tc.wantChips), len(hwmon.Chips))
+	}
+	for i, wantChip := range tc.wantChips {
+		gotChip := hwmon.Chips[i]
+		if wantChip.Hwmon != gotChip.Hwmon {
+			fmt.Fprintf(diffBuf, "\nChips[%d].Hwmon: want: %q, got: %q", i, wantChip.Hwmon, gotChip.Hwmon)
+		}
+		if wantChip.Name != gotChip.Name {
+			fmt.Fprintf(diffBuf, "\nChips[%d].Name: want: %q, got: %q", i, wantChip.Name, gotChip.Name)
+		}
+		if wantChip.Device != gotChip.Device {
+			fmt.Fprintf(diffBuf, "\nChips[%d].Device: want: %q, got: %q", i, wantChip.Device, gotChip.Device)
+		}
+		if len(wantChip.Sensors) != len(gotChip.Sensors) {
+			fmt.Fprintf(
+				diffBuf, "\nlen(Chips[%d].Sensors): want: %d, got: %d",
+				i, len(wantChip.Sensors), len(gotChip.Sensors),
+			)
+			continue
+		}
+		for j, wantSensor := range wantChip.Sensors {
+			gotSensor := gotChip.Sensors[j]
+			if wantSensor.Type != gotSensor.Type ||
+				wantSensor.Name != gotSensor.Name ||
+				wantSensor.Label != gotSensor.Label ||
+				wantSensor.Value != gotSensor.Value ||
+				wantSensor.Valid != gotSensor.Valid {
+				fmt.Fprintf(
+					diffBuf,
+					"\nChips[%d].Sensors[%d]:\n\twant: {Type: %d, Name: %q, Label: %q, Value: %d, Valid: %v}"+
+						"\n\t got: {Type: %d, Name: %q, Label: %q, Value: %d, Valid: %v}",
+					i, j,
+					wantSensor.Type, wantSensor.Name, wantSensor.Label, wantSensor.Value, wantSensor.Valid,
+					gotSensor.Type, gotSensor.Name, gotSensor.Label, gotSensor.Value, gotSensor.Valid,
+				)
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestHwmonParser(t *testing.T) {
+	for _, tc := range []*HwmonTestCase{
+		{
+			name:      "field_mapping",
+			sysfsRoot: path.Join(hwmonTestDataDir, "field_mapping"),
+			wantChips: []*HwmonChip{
+				{
+					Hwmon:  "hwmon0",
+					Name:   "coretemp",
+					Device: "/devices/platform/coretemp.0",
+					Sensors: []*HwmonSensor{
+						{Type: HWMON_SENSOR_TEMP, Name: "temp1", Label: "Package id 0", Value: 45000, Valid: true},
+						{Type: HWMON_SENSOR_TEMP, Name: "temp2", Label: "Core 0", Value: 43000, Valid: true},
+					},
+				},
+				{
+					Hwmon: "hwmon2",
+					Name:  "nct6775",
+					Sensors: []*HwmonSensor{
+						{Type: HWMON_SENSOR_FAN, Name: "fan1", Label: "fan1", Value: 1100, Valid: true},
+						{Type: HWMON_SENSOR_FAN, Name: "fan2", Label: "fan2", Value: 1200, Valid: true},
+						{Type: HWMON_SENSOR_IN, Name: "in0", Label: "in0", Value: 1050, Valid: true},
+						{Type: HWMON_SENSOR_IN, Name: "in1", Label: "in1", Value: 0, Valid: false},
+						{Type: HWMON_SENSOR_IN, Name: "in10", Label: "in10", Value: -5, Valid: true},
+						{Type: HWMON_SENSOR_POWER, Name: "power1", Label: "power1", Value: 35000000, Valid: true},
+					},
+				},
+				{
+					Hwmon: "hwmon10",
+					Name:  "acpitz",
+					Sensors: []*HwmonSensor{
+						{Type: HWMON_SENSOR_TEMP, Name: "temp1", Label: "temp1", Value: -2000, Valid: true},
+					},
+				},
+			},
+		},
+		{
+			name:      "no_hwmon",
+			sysfsRoot: path.Join(hwmonTestDataDir, "no_hwmon"),
+			wantChips: []*HwmonChip{},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testHwmonParser(tc, t) },
+		)
+	}
+}
@@ -0,0 +1,78 @@
+// parser for /sys/class/net/DEV attributes
+
+package sysfs
+
+// The files of interest:
+//
+//  /sys/class/net/eth0/
+//      speed: 1000
+//      duplex: full
+//      mtu: 1500
+//      operstate: up
+//      carrier_changes: 3
+//      type: 1
+//
+// The speed is in Mbps; it cannot be read for devices that are down or for
+// virtual devices, in which case it is set to -1. Similarly duplex may be
+// unavailable, in which case it is left empty.
+//
+// References:
+//  https://www.kernel.org/doc/Documentation/ABI/testing/sysfs-class-net
+
+import (
+	"path"
+)
+
+type NetClassDev struct {
+	// The device name:
+	Dev string
+	// Link speed in Mbps, -1 if unknown:
+	Speed int64
+	// Duplex (full, half) and operational state (up, down, unknown, etc.),
+	// empty if unknown:
+	Duplex, Operstate string
+	// MTU and ARPHRD_... type (see include/uapi/linux/if_arp.h), -1 if unknown:
+	Mtu, Type int64
+	// Number of carrier (link) up/down transitions and whether it could be
+	// read or not:
+	CarrierChanges      uint64
+	CarrierChangesValid bool
+	// The path of the device dir:
+	path string
+}
+
+func NetClassPath(sysfsRoot string) string {
+	return path.Join(sysfsRoot, "class", "net")
+}
+
+func NewNetClassDev(sysfsRoot string, dev string) *NetClassDev {
+	return &NetClassDev{
+		Dev:  dev,
+		path: path.Join(NetClassPath(sysfsRoot), dev),
+	}
+}
+
+// Read the attributes. The only error condition is if the device dir doesn't
+// exist (i.e. operstate cannot be read), all other attributes are optional:
+func (netClassDev *NetClassDev) Parse() error {
+	var err error
+
+	if netClassDev.Operstate, err = ReadAttribute(path.Join(netClassDev.path, "operstate")); err != nil {
+		return err
+	}
+	if netClassDev.Speed, err = ReadIntAttribute(path.Join(netClassDev.path, "speed")); err != nil {
+		netClassDev.Speed = -1
+	}
+	if netClassDev.Duplex, err = ReadAttribute(path.Join(netClassDev.path, "duplex")); err != nil {
+		netClassDev.Duplex = ""
+	}
+	if netClassDev.Mtu, err = ReadIntAttribute(path.Join(netClassDev.path, "mtu")); err != nil {
+		netClassDev.Mtu = -1
+	}
+	if netClassDev.Type, err = ReadIntAttribute(path.Join(netClassDev.path, "type")); err != nil {
+		netClassDev.Type = -1
+	}
+	carrierChanges, err := ReadIntAttribute(path.Join(netClassDev.path, "carrier_changes"))
+	netClassDev.CarrierChanges, netClassDev.CarrierChangesValid = uint64(carrierChanges), err == nil
+	return nil
+}
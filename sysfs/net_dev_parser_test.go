@@ -0,0 +1,127 @@
+package sysfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type NetClassDevTestCase struct {
+	name         string
+	sysfsRoot    string
+	dev          string
+	wantErr      bool
+	wantClassDev *NetClassDev
+}
+
+var netClassDevTestDataDir = path.Join(SYSFS_TESTDATA_ROOT, "net")
+
+func testNetClassDevParser(tc *NetClassDevTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+sysfsRoot=%q
+dev=%q
+`,
+		tc.name, tc.sysfsRoot, tc.dev,
+	)
+
+	netClassDev := NewNetClassDev(tc.sysfsRoot, tc.dev)
+	err := netClassDev.Parse()
+	if tc.wantErr {
+		if err == nil {
+			t.Fatal("want error, got nil")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+	want, got := tc.wantClassDev, netClassDev
+	if want.Speed != got.Speed {
+		fmt.Fprintf(diffBuf, "\nSpeed: want: %d, got: %d", want.Speed, got.Speed)
+	}
+	if want.Duplex != got.Duplex {
+		fmt.Fprintf(diffBuf, "\nDuplex: want: %q, got: %q", want.Duplex, got.Duplex)
+	}
+	if want.Operstate != got.Operstate {
+		fmt.Fprintf(diffBuf, "\nOperstate: want: %q, got: %q", want.Operstate, got.Operstate)
+	}
+	if want.Mtu != got.Mtu {
+		fmt.Fprintf(diffBuf, "\nMtu: want: %d, got: %d", want.Mtu, got.Mtu)
+	}
+	if want.Type != got.Type {
+		fmt.Fprintf(diffBuf, "\nType: want: %d, got: %d", want.Type, got.Type)
+	}
+	if want.CarrierChanges != got.CarrierChanges {
+		fmt.Fprintf(diffBuf, "\nCarrierChanges: want: %d, got: %d", want.CarrierChanges, got.CarrierChanges)
+	}
+	if want.CarrierChangesValid != got.CarrierChangesValid {
+		fmt.Fprintf(diffBuf, "\nCarrierChangesValid: want: %v, got: %v", want.CarrierChangesValid, got.CarrierChangesValid)
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestNetClassDevParser(t *testing.T) {
+	sysfsRoot := path.Join(netClassDevTestDataDir, "field_mapping")
+	for _, tc := range []*NetClassDevTestCase{
+		{
+			name:      "eth0",
+			sysfsRoot: sysfsRoot,
+			dev:       "eth0",
+			wantClassDev: &NetClassDev{
+				Speed:               1000,
+				Duplex:              "full",
+				Operstate:           "up",
+				Mtu:                 1500,
+				Type:                1,
+				CarrierChanges:      3,
+				CarrierChangesValid: true,
+			},
+		},
+		{
+			name:      "lo",
+			sysfsRoot: sysfsRoot,
+			dev:       "lo",
+			wantClassDev: &NetClassDev{
+				Speed:               -1,
+				Duplex:              "",
+				Operstate:           "unknown",
+				Mtu:                 65536,
+				Type:                772,
+				CarrierChanges:      0,
+				CarrierChangesValid: true,
+			},
+		},
+		{
+			name:      "wlan0_down",
+			sysfsRoot: sysfsRoot,
+			dev:       "wlan0",
+			wantClassDev: &NetClassDev{
+				Speed:               -1,
+				Duplex:              "unknown",
+				Operstate:           "down",
+				Mtu:                 1500,
+				Type:                1,
+				CarrierChanges:      12,
+				CarrierChangesValid: true,
+			},
+		},
+		{
+			name:      "missing",
+			sysfsRoot: sysfsRoot,
+			dev:       "eth1",
+			wantErr:   true,
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testNetClassDevParser(tc, t) },
+		)
+	}
+}
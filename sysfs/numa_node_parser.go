@@ -0,0 +1,262 @@
+// parser for /sys/devices/system/node/{online,node*/{meminfo,numastat,cpulist}}
+
+package sysfs
+
+// The files of interest:
+//
+//  /sys/devices/system/node/
+//      online: 0-1
+//      node0/
+//          cpulist: 0-7,16-23
+//          meminfo:
+//              Node 0 MemTotal:       32768000 kB
+//              Node 0 MemFree:        16384000 kB
+//              ...
+//              Node 0 HugePages_Total:     0
+//          numastat:
+//              numa_hit 123456
+//              numa_miss 0
+//              numa_foreign 0
+//              interleave_hit 1024
+//              local_node 123000
+//              other_node 456
+//
+// The node info (the cpulist) is discovered the first time a node is found
+// online; nodes going offline are removed. The meminfo and numastat are read at
+// every Parse().
+//
+// The numastat values are in pages.
+//
+// References:
+//  https://www.kernel.org/doc/html/latest/admin-guide/numastat.html
+//  https://github.com/torvalds/linux/blob/v6.8/drivers/base/node.c#L371
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/bgp59/linux-stats-victoriametrics-importer/internal/utils"
+)
+
+// Indexes for numastat:
+const (
+	NUMA_NODE_NUMASTAT_NUMA_HIT = iota
+	NUMA_NODE_NUMASTAT_NUMA_MISS
+	NUMA_NODE_NUMASTAT_NUMA_FOREIGN
+	NUMA_NODE_NUMASTAT_INTERLEAVE_HIT
+	NUMA_NODE_NUMASTAT_LOCAL_NODE
+	NUMA_NODE_NUMASTAT_OTHER_NODE
+
+	// Must be last:
+	NUMA_NODE_NUMASTAT_NUM_STATS
+)
+
+var numaNodeNumastatIndex = map[string]int{
+	"numa_hit":       NUMA_NODE_NUMASTAT_NUMA_HIT,
+	"numa_miss":      NUMA_NODE_NUMASTAT_NUMA_MISS,
+	"numa_foreign":   NUMA_NODE_NUMASTAT_NUMA_FOREIGN,
+	"interleave_hit": NUMA_NODE_NUMASTAT_INTERLEAVE_HIT,
+	"local_node":     NUMA_NODE_NUMASTAT_LOCAL_NODE,
+	"other_node":     NUMA_NODE_NUMASTAT_OTHER_NODE,
+}
+
+// meminfo and numastat are multi-line files, possibly larger than a page:
+var numaNodeReadFileBufPool = utils.NewReadFileBufPool(8, 0x4000)
+
+type NumaNode struct {
+	// Node#:
+	Node int
+	// The CPU list, as found in cpulist, e.g. "0-7,16-23":
+	CpuList string
+	// Meminfo field names, in the order they appear in the file:
+	MeminfoNames []string
+	// Meminfo values, indexed like MeminfoNames:
+	Meminfo []uint64
+	// Meminfo units, indexed like MeminfoNames, e.g. "kB", or "" for counts:
+	MeminfoUnits []string
+	// Whether the meminfo was successfully read or not:
+	MeminfoValid bool
+	// Numastat values, indexed by NUMA_NODE_NUMASTAT_...:
+	Numastat []uint64
+	// Whether the numastat was successfully read or not:
+	NumastatValid bool
+	// The files:
+	meminfoPath, numastatPath string
+}
+
+type NumaNodes struct {
+	// The sorted list of online nodes, as of the most recent Parse():
+	Online []int
+	// Per node# info, for online nodes only:
+	Nodes map[int]*NumaNode
+	// The path of the node dir:
+	path string
+	// The path of the online file:
+	onlinePath string
+}
+
+func NumaNodesPath(sysfsRoot string) string {
+	return path.Join(sysfsRoot, "devices", "system", "node")
+}
+
+func NewNumaNodes(sysfsRoot string) *NumaNodes {
+	nodePath := NumaNodesPath(sysfsRoot)
+	return &NumaNodes{
+		Online:     make([]int, 0),
+		Nodes:      make(map[int]*NumaNode),
+		path:       nodePath,
+		onlinePath: path.Join(nodePath, "online"),
+	}
+}
+
+func (numaNodes *NumaNodes) discoverNode(node int) *NumaNode {
+	nodeDir := path.Join(numaNodes.path, "node"+strconv.Itoa(node))
+	numaNode := &NumaNode{
+		Node:         node,
+		MeminfoNames: make([]string, 0),
+		Meminfo:      make([]uint64, 0),
+		MeminfoUnits: make([]string, 0),
+		Numastat:     make([]uint64, NUMA_NODE_NUMASTAT_NUM_STATS),
+		meminfoPath:  path.Join(nodeDir, "meminfo"),
+		numastatPath: path.Join(nodeDir, "numastat"),
+	}
+	if cpuList, err := ReadAttribute(path.Join(nodeDir, "cpulist")); err == nil {
+		numaNode.CpuList = cpuList
+	}
+	return numaNode
+}
+
+// Parse the node meminfo file; the storage is reused from the previous parse:
+func (numaNode *NumaNode) parseMeminfo() error {
+	fBuf, err := numaNodeReadFileBufPool.ReadFile(numaNode.meminfoPath)
+	defer numaNodeReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	index := 0
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		// Node N NAME: VALUE [UNIT]
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 || len(fields) > 5 || !bytes.HasSuffix(fields[2], []byte{':'}) {
+			return fmt.Errorf("%s:%d: %q: invalid line", numaNode.meminfoPath, lineNum, line)
+		}
+		name := string(fields[2][:len(fields[2])-1])
+		value, err := strconv.ParseUint(string(fields[3]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %q: invalid value", numaNode.meminfoPath, lineNum, line)
+		}
+		unit := ""
+		if len(fields) == 5 {
+			unit = string(fields[4])
+		}
+		if index < len(numaNode.MeminfoNames) {
+			numaNode.MeminfoNames[index] = name
+			numaNode.MeminfoUnits[index] = unit
+			numaNode.Meminfo[index] = value
+		} else {
+			numaNode.MeminfoNames = append(numaNode.MeminfoNames, name)
+			numaNode.MeminfoUnits = append(numaNode.MeminfoUnits, unit)
+			numaNode.Meminfo = append(numaNode.Meminfo, value)
+		}
+		index++
+	}
+	numaNode.MeminfoNames = numaNode.MeminfoNames[:index]
+	numaNode.MeminfoUnits = numaNode.MeminfoUnits[:index]
+	numaNode.Meminfo = numaNode.Meminfo[:index]
+	return nil
+}
+
+func (numaNode *NumaNode) parseNumastat() error {
+	fBuf, err := numaNodeReadFileBufPool.ReadFile(numaNode.numastatPath)
+	defer numaNodeReadFileBufPool.ReturnBuf(fBuf)
+	if err != nil {
+		return err
+	}
+
+	buf, l := fBuf.Bytes(), fBuf.Len()
+	for pos, lineNum := 0, 1; pos < l; lineNum++ {
+		eolPos := bytes.IndexByte(buf[pos:], '\n')
+		if eolPos < 0 {
+			eolPos = l
+		} else {
+			eolPos += pos
+		}
+		line := buf[pos:eolPos]
+		pos = eolPos + 1
+
+		// NAME VALUE
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: %q: invalid line", numaNode.numastatPath, lineNum, line)
+		}
+		index, ok := numaNodeNumastatIndex[string(fields[0])]
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseUint(string(fields[1]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %q: invalid value", numaNode.numastatPath, lineNum, line)
+		}
+		numaNode.Numastat[index] = value
+	}
+	return nil
+}
+
+// Read the online node list, update the per node info accordingly and read the
+// meminfo and numastat:
+func (numaNodes *NumaNodes) Parse() error {
+	nodeList, err := ReadAttribute(numaNodes.onlinePath)
+	if err != nil {
+		return err
+	}
+	online, err := ParseCpuList(nodeList, numaNodes.Online[:0])
+	if err != nil {
+		return fmt.Errorf("%s: %v", numaNodes.onlinePath, err)
+	}
+	numaNodes.Online = online
+
+	// Nodes may be taken offline (memory hot-unplug); remove out-of-scope
+	// nodes:
+	if len(numaNodes.Nodes) > 0 {
+		onlineSet := make(map[int]bool, len(online))
+		for _, node := range online {
+			onlineSet[node] = true
+		}
+		for node := range numaNodes.Nodes {
+			if !onlineSet[node] {
+				delete(numaNodes.Nodes, node)
+			}
+		}
+	}
+
+	for _, node := range online {
+		numaNode := numaNodes.Nodes[node]
+		if numaNode == nil {
+			numaNode = numaNodes.discoverNode(node)
+			numaNodes.Nodes[node] = numaNode
+		}
+		numaNode.MeminfoValid = numaNode.parseMeminfo() == nil
+		numaNode.NumastatValid = numaNode.parseNumastat() == nil
+	}
+
+	return nil
+}
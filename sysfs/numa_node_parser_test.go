@@ -0,0 +1,111 @@
+package sysfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type NumaNodesTestCase struct {
+	name       string
+	sysfsRoot  string
+	wantOnline []int
+	wantNodes  []*NumaNode
+}
+
+var numaNodesTestDataDir = path.Join(SYSFS_TESTDATA_ROOT, "numa_node")
+
+func testNumaNodesParser(tc *NumaNodesTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+sysfsRoot=%q
+`,
+		tc.name, tc.sysfsRoot,
+	)
+
+	numaNodes := NewNumaNodes(tc.sysfsRoot)
+	// Parse twice to verify that the reuse of the objects works as expected:
+	for k := 0; k < 2; k++ {
+		if err := numaNodes.Parse(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	if fmt.Sprint(tc.wantOnline) != fmt.Sprint(numaNodes.Online) {
+		fmt.Fprintf(diffBuf, "\nOnline: want: %v, got: %v", tc.wantOnline, numaNodes.Online)
+	}
+	if len(tc.wantNodes) != len(numaNodes.Nodes) {
+		fmt.Fprintf(diffBuf, "\nlen(Nodes): want: %d, got: %d", len(tc.wantNodes), len(numaNodes.Nodes))
+	}
+	for _, wantNode := range tc.wantNodes {
+		gotNode := numaNodes.Nodes[wantNode.Node]
+		if gotNode == nil {
+			fmt.Fprintf(diffBuf, "\nnode%d: missing", wantNode.Node)
+			continue
+		}
+		for _, field := range []struct {
+			name      string
+			want, got any
+		}{
+			{"CpuList", wantNode.CpuList, gotNode.CpuList},
+			{"MeminfoNames", wantNode.MeminfoNames, gotNode.MeminfoNames},
+			{"Meminfo", wantNode.Meminfo, gotNode.Meminfo},
+			{"MeminfoUnits", wantNode.MeminfoUnits, gotNode.MeminfoUnits},
+			{"MeminfoValid", wantNode.MeminfoValid, gotNode.MeminfoValid},
+			{"Numastat", wantNode.Numastat, gotNode.Numastat},
+			{"NumastatValid", wantNode.NumastatValid, gotNode.NumastatValid},
+		} {
+			if fmt.Sprintf("%q", field.want) != fmt.Sprintf("%q", field.got) {
+				fmt.Fprintf(diffBuf, "\nnode%d: %s: want: %v, got: %v", wantNode.Node, field.name, field.want, field.got)
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestNumaNodesParser(t *testing.T) {
+	meminfoNames := []string{
+		"MemTotal", "MemFree", "MemUsed", "FilePages", "AnonPages", "HugePages_Total", "HugePages_Free",
+	}
+	meminfoUnits := []string{"kB", "kB", "kB", "kB", "kB", "", ""}
+	for _, tc := range []*NumaNodesTestCase{
+		{
+			name:       "field_mapping",
+			sysfsRoot:  path.Join(numaNodesTestDataDir, "field_mapping"),
+			wantOnline: []int{0, 1},
+			wantNodes: []*NumaNode{
+				{
+					Node:          0,
+					CpuList:       "0-3,8-11",
+					MeminfoNames:  meminfoNames,
+					Meminfo:       []uint64{32768000, 16384000, 16384000, 4096000, 8192000, 16, 8},
+					MeminfoUnits:  meminfoUnits,
+					MeminfoValid:  true,
+					Numastat:      []uint64{1234567, 12, 34, 5678, 1230000, 4579},
+					NumastatValid: true,
+				},
+				{
+					Node:          1,
+					CpuList:       "4-7,12-15",
+					MeminfoNames:  meminfoNames,
+					Meminfo:       []uint64{33554432, 30000000, 3554432, 1000000, 2000000, 0, 0},
+					MeminfoUnits:  meminfoUnits,
+					MeminfoValid:  true,
+					Numastat:      []uint64{7654321, 34, 12, 5677, 7650000, 4355},
+					NumastatValid: true,
+				},
+			},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testNumaNodesParser(tc, t) },
+		)
+	}
+}
@@ -0,0 +1,150 @@
+// parser for /sys/class/thermal/thermal_zone*
+
+package sysfs
+
+// Each thermal zone is a directory with the following files of interest:
+//
+//  /sys/class/thermal/thermal_zone0/
+//      type: x86_pkg_temp
+//      temp: 45000
+//      trip_point_0_type: passive
+//      trip_point_0_temp: 95000
+//
+// The temperatures are in millidegree Celsius. The zone type and the trip
+// points are read at discovery time only, the temperature is read at every
+// Parse().
+//
+// References:
+//  https://www.kernel.org/doc/html/latest/driver-api/thermal/sysfs-api.html
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var thermalZoneTripPointTempFileRe = regexp.MustCompile(`^trip_point_(\d+)_temp$`)
+
+type ThermalZoneTripPoint struct {
+	// The trip point#, as a string since it is used as-is for label values:
+	Num string
+	// The content of trip_point_<N>_type, e.g. critical, hot, passive:
+	Type string
+	// The content of trip_point_<N>_temp:
+	Temp int64
+	// Used for sorting:
+	index int
+}
+
+type ThermalZone struct {
+	// The thermal_zone<N> dir name:
+	Zone string
+	// The content of the type file:
+	Type string
+	// The most recent temperature and whether it was successfully read or not.
+	// Some zones may fail to return a value (e.g. -ENODATA), which should not
+	// be treated as an error:
+	Temp  int64
+	Valid bool
+	// Trip points, sorted by N:
+	TripPoints []*ThermalZoneTripPoint
+	// The temp file:
+	tempPath string
+}
+
+type ThermalZones struct {
+	// Zones, sorted by thermal_zone<N>:
+	Zones []*ThermalZone
+	// The path of the thermal class dir:
+	path string
+}
+
+func ThermalZonesPath(sysfsRoot string) string {
+	return path.Join(sysfsRoot, "class", "thermal")
+}
+
+func NewThermalZones(sysfsRoot string) *ThermalZones {
+	return &ThermalZones{
+		Zones: make([]*ThermalZone, 0),
+		path:  ThermalZonesPath(sysfsRoot),
+	}
+}
+
+// Discover the thermal zones and their trip points. This is a relatively
+// expensive operation and it should be invoked only every so often. A missing
+// thermal class dir is not an error, it simply results in no zones.
+func (thermalZones *ThermalZones) Discover() error {
+	thermalZones.Zones = thermalZones.Zones[:0]
+
+	entries, err := os.ReadDir(thermalZones.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		zoneName := entry.Name()
+		if !strings.HasPrefix(zoneName, "thermal_zone") {
+			continue
+		}
+		zoneDir := path.Join(thermalZones.path, zoneName)
+		zoneFiles, err := os.ReadDir(zoneDir)
+		if err != nil {
+			// The zone may have been removed in the meantime:
+			continue
+		}
+		zone := &ThermalZone{
+			Zone:       zoneName,
+			TripPoints: make([]*ThermalZoneTripPoint, 0),
+			tempPath:   path.Join(zoneDir, "temp"),
+		}
+		if zone.Type, err = ReadAttribute(path.Join(zoneDir, "type")); err != nil {
+			zone.Type = ""
+		}
+		for _, zoneFile := range zoneFiles {
+			m := thermalZoneTripPointTempFileRe.FindStringSubmatch(zoneFile.Name())
+			if m == nil {
+				continue
+			}
+			tripPoint := &ThermalZoneTripPoint{
+				Num: m[1],
+			}
+			if tripPoint.Temp, err = ReadIntAttribute(path.Join(zoneDir, zoneFile.Name())); err != nil {
+				continue
+			}
+			if tripPoint.Type, err = ReadAttribute(path.Join(zoneDir, "trip_point_"+m[1]+"_type")); err != nil {
+				tripPoint.Type = ""
+			}
+			tripPoint.index, _ = strconv.Atoi(m[1])
+			zone.TripPoints = append(zone.TripPoints, tripPoint)
+		}
+		sort.Slice(zone.TripPoints, func(i, j int) bool {
+			return zone.TripPoints[i].index < zone.TripPoints[j].index
+		})
+		thermalZones.Zones = append(thermalZones.Zones, zone)
+	}
+
+	sort.Slice(thermalZones.Zones, func(i, j int) bool {
+		zi, zj := thermalZones.Zones[i].Zone, thermalZones.Zones[j].Zone
+		return len(zi) < len(zj) || len(zi) == len(zj) && zi < zj
+	})
+
+	return nil
+}
+
+// Read the temperature for the discovered zones:
+func (thermalZones *ThermalZones) Parse() error {
+	var err error
+	for _, zone := range thermalZones.Zones {
+		zone.Temp, err = ReadIntAttribute(zone.tempPath)
+		zone.Valid = err == nil
+	}
+	return nil
+}
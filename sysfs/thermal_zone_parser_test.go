@@ -0,0 +1,133 @@
+package sysfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+)
+
+type ThermalZonesTestCase struct {
+	name      string
+	sysfsRoot string
+	wantZones []*ThermalZone
+}
+
+var thermalZonesTestDataDir = path.Join(SYSFS_TESTDATA_ROOT, "thermal")
+
+func testThermalZonesParser(tc *ThermalZonesTestCase, t *testing.T) {
+	t.Logf(`
+name=%q
+sysfsRoot=%q
+`,
+		tc.name, tc.sysfsRoot,
+	)
+
+	thermalZones := NewThermalZones(tc.sysfsRoot)
+	err := thermalZones.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = thermalZones.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffBuf := &bytes.Buffer{}
+
+	if len(tc.wantZones) != len(thermalZones.Zones) {
+		t.Fatalf("len(Zones): want: %d, got: %d", len(tc.wantZones), len(thermalZones.Zones))
+	}
+	for i, wantZone := range tc.wantZones {
+		gotZone := thermalZones.Zones[i]
+		if wantZone.Zone != gotZone.Zone {
+			fmt.Fprintf(diffBuf, "\nZones[%d].Zone: want: %q, got: %q", i, wantZone.Zone, gotZone.Zone)
+		}
+		if wantZone.Type != gotZone.Type {
+			fmt.Fprintf(diffBuf, "\nZones[%d].Type: want: %q, got: %q", i, wantZone.Type, gotZone.Type)
+		}
+		if wantZone.Temp != gotZone.Temp {
+			fmt.Fprintf(diffBuf, "\nZones[%d].Temp: want: %d, got: %d", i, wantZone.Temp, gotZone.Temp)
+		}
+		if wantZone.Valid != gotZone.Valid {
+			fmt.Fprintf(diffBuf, "\nZones[%d].Valid: want: %v, got: %v", i, wantZone.Valid, gotZone.Valid)
+		}
+		if len(wantZone.TripPoints) != len(gotZone.TripPoints) {
+			fmt.Fprintf(
+				diffBuf, "\nlen(Zones[%d].TripPoints): want: %d, got: %d",
+				i, len(wantZone.TripPoints), len(gotZone.TripPoints),
+			)
+			continue
+		}
+		for j, wantTripPoint := range wantZone.TripPoints {
+			gotTripPoint := gotZone.TripPoints[j]
+			if wantTripPoint.Num != gotTripPoint.Num ||
+				wantTripPoint.Type != gotTripPoint.Type ||
+				wantTripPoint.Temp != gotTripPoint.Temp {
+				fmt.Fprintf(
+					diffBuf,
+					"\nZones[%d].TripPoints[%d]:\n\twant: {Num: %q, Type: %q, Temp: %d}\n\t got: {Num: %q, Type: %q, Temp: %d}",
+					i, j,
+					wantTripPoint.Num, wantTripPoint.Type, wantTripPoint.Temp,
+					gotTripPoint.Num, gotTripPoint.Type, gotTripPoint.Temp,
+				)
+			}
+		}
+	}
+
+	if diffBuf.Len() > 0 {
+		t.Fatal(diffBuf.String())
+	}
+}
+
+func TestThermalZonesParser(t *testing.T) {
+	acpitzTripPoints := make([]*ThermalZoneTripPoint, 11)
+	for i := range acpitzTripPoints {
+		acpitzTripPoints[i] = &ThermalZoneTripPoint{
+			Num:  fmt.Sprintf("%d", i),
+			Type: "active",
+			Temp: int64(100000 - i*1000),
+		}
+	}
+
+	for _, tc := range []*ThermalZonesTestCase{
+		{
+			name:      "field_mapping",
+			sysfsRoot: path.Join(thermalZonesTestDataDir, "field_mapping"),
+			wantZones: []*ThermalZone{
+				{
+					Zone:  "thermal_zone0",
+					Type:  "x86_pkg_temp",
+					Temp:  46000,
+					Valid: true,
+					TripPoints: []*ThermalZoneTripPoint{
+						{Num: "0", Type: "passive", Temp: 0},
+						{Num: "1", Type: "critical", Temp: 95000},
+					},
+				},
+				{
+					Zone:  "thermal_zone1",
+					Type:  "iwlwifi_1",
+					Valid: false,
+				},
+				{
+					Zone:       "thermal_zone2",
+					Type:       "acpitz",
+					Temp:       27800,
+					Valid:      true,
+					TripPoints: acpitzTripPoints,
+				},
+			},
+		},
+		{
+			name:      "no_thermal",
+			sysfsRoot: path.Join(thermalZonesTestDataDir, "no_thermal"),
+			wantZones: []*ThermalZone{},
+		},
+	} {
+		t.Run(
+			tc.name,
+			func(t *testing.T) { testThermalZonesParser(tc, t) },
+		)
+	}
+}